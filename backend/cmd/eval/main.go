@@ -0,0 +1,220 @@
+// Command eval replays the negotiation transcripts in a corpus through the negotiation agent
+// with one or more prompt versions and models, scores the drafts with rule-based checks and an
+// LLM judge, and writes a comparison report. Record a run against the model once, then replay
+// it offline, e.g. to check a prompt change in CI:
+//
+//	go run ./cmd/eval -prompts builtin,drafts/negotiation.tmpl -record eval/cassette.json
+//	go run ./cmd/eval -prompts builtin,drafts/negotiation.tmpl -replay eval/cassette.json -strict
+//	go run ./cmd/eval -prompts v2,v3 -models standard,fast
+//
+// Prompts are "builtin", a stored version such as "v3" (needs DATABASE_URL) or a template file.
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"log"
+	"os"
+	"os/signal"
+	"strconv"
+	"strings"
+
+	"carbuyer/internal/db"
+	"carbuyer/internal/db/models"
+	"carbuyer/internal/eval"
+	"carbuyer/internal/llm"
+	"carbuyer/internal/services"
+
+	"github.com/joho/godotenv"
+)
+
+func main() {
+	corpus := flag.String("corpus", "eval/corpus", "directory of transcript cases (.json)")
+	prompts := flag.String("prompts", "builtin", "comma-separated prompt versions to compare: builtin, vN (stored) or a template file")
+	modelsFlag := flag.String("models", "standard", "comma-separated models to compare: standard, fast or a model ID")
+	judge := flag.Bool("judge", true, "grade drafts with the LLM judge as well as the rule-based checks")
+	record := flag.String("record", "", "call the model and save its responses to this cassette")
+	replay := flag.String("replay", "", "answer from this cassette instead of calling the model")
+	out := flag.String("out", "eval-report.md", "where to write the Markdown report")
+	jsonOut := flag.String("json", "", "also write every result as JSON to this file")
+	strict := flag.Bool("strict", false, "exit with status 1 if any draft fails a check or errors")
+	flag.Usage = func() {
+		fmt.Fprintf(flag.CommandLine.Output(), "Usage: eval [-prompts builtin,v2,file.tmpl] [-models standard,fast] [-record | -replay cassette.json] [flags]\n")
+		flag.PrintDefaults()
+	}
+	flag.Parse()
+
+	if *record != "" && *replay != "" {
+		log.Fatal("Use -record or -replay, not both")
+	}
+
+	if err := godotenv.Load(); err != nil {
+		log.Println("No .env file found, using environment variables")
+	}
+
+	cases, err := eval.LoadCorpus(*corpus)
+	if err != nil {
+		log.Fatalf("Failed to load corpus: %v", err)
+	}
+
+	variants, err := loadVariants(*prompts, *modelsFlag)
+	if err != nil {
+		log.Fatalf("Invalid variants: %v", err)
+	}
+
+	// Replays never call the model. Otherwise the model is called directly, without quotas,
+	// recording its responses when asked.
+	var model llm.LLM
+	var cassette *llm.Cassette
+	switch {
+	case *replay != "":
+		cassette, err = llm.LoadCassette(*replay)
+		if err != nil {
+			log.Fatalf("Failed to load cassette: %v", err)
+		}
+		model = llm.NewReplayer(cassette)
+	default:
+		apiKey := os.Getenv("ANTHROPIC_API_KEY")
+		if apiKey == "" {
+			log.Fatal("ANTHROPIC_API_KEY is required unless replaying a cassette")
+		}
+		model = llm.NewAnthropic(apiKey)
+		if *record != "" {
+			cassette = llm.NewCassette()
+			model = llm.NewRecorder(model, cassette)
+		}
+	}
+
+	runner := &eval.Runner{LLM: model}
+	if *judge {
+		runner.Judge = model
+	}
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt)
+	defer stop()
+
+	log.Printf("Evaluating %d cases with %d variants", len(cases), len(variants))
+	results, err := runner.Run(ctx, cases, variants)
+	if err != nil {
+		log.Printf("Run stopped early: %v", err)
+	}
+
+	if *record != "" {
+		if err := cassette.Save(*record); err != nil {
+			log.Fatalf("Failed to save cassette: %v", err)
+		}
+		log.Printf("Recorded %d responses to %s", cassette.Len(), *record)
+	}
+
+	report, err := os.Create(*out)
+	if err != nil {
+		log.Fatalf("Failed to create report: %v", err)
+	}
+	if err := eval.WriteReport(report, variants, results); err != nil {
+		log.Fatalf("Failed to write report: %v", err)
+	}
+	report.Close()
+
+	if *jsonOut != "" {
+		data, err := json.MarshalIndent(results, "", "  ")
+		if err != nil {
+			log.Fatalf("Failed to encode results: %v", err)
+		}
+		if err := os.WriteFile(*jsonOut, data, 0o644); err != nil {
+			log.Fatalf("Failed to write results: %v", err)
+		}
+	}
+
+	failed := false
+	for _, s := range eval.Summarize(variants, results) {
+		score := "-"
+		if s.Judged > 0 {
+			score = fmt.Sprintf("%.2f", s.JudgeScore)
+		}
+		log.Printf("%s: %d/%d passed all checks, judge score %s, %d errors", s.Variant, s.Passed, s.Requests, score, s.Errors)
+		failed = failed || s.Passed < s.Requests
+	}
+	log.Printf("Wrote report to %s", *out)
+
+	if *strict && failed {
+		os.Exit(1)
+	}
+}
+
+// loadVariants builds a variant for every prompt and model pair
+func loadVariants(promptList, modelList string) ([]eval.Variant, error) {
+	var promptService *services.PromptTemplateService
+
+	var variants []eval.Variant
+	for _, spec := range splitList(promptList) {
+		var prompt *services.Prompt
+		var err error
+		switch {
+		case spec == "builtin":
+			prompt, err = services.DefaultPrompt(models.LLMPurposeNegotiation)
+		case strings.HasPrefix(spec, "v") && isNumber(spec[1:]):
+			if promptService == nil {
+				if promptService, err = storedPrompts(); err != nil {
+					return nil, err
+				}
+			}
+			version, _ := strconv.Atoi(spec[1:])
+			prompt, err = promptService.Version(models.LLMPurposeNegotiation, version)
+		default:
+			var body []byte
+			if body, err = os.ReadFile(spec); err == nil {
+				prompt, err = services.ParsePrompt(models.LLMPurposeNegotiation, string(body))
+			}
+		}
+		if err != nil {
+			return nil, fmt.Errorf("prompt %s: %w", spec, err)
+		}
+
+		for _, name := range splitList(modelList) {
+			model := llm.Model(name)
+			switch name {
+			case "standard":
+				model = llm.ModelStandard
+			case "fast":
+				model = llm.ModelFast
+			}
+			variants = append(variants, eval.Variant{Name: spec + "@" + name, Prompt: prompt, Model: model})
+		}
+	}
+	if len(variants) == 0 {
+		return nil, fmt.Errorf("no prompts or models given")
+	}
+	return variants, nil
+}
+
+// storedPrompts connects to the database for stored prompt versions
+func storedPrompts() (*services.PromptTemplateService, error) {
+	databaseURL := os.Getenv("DATABASE_URL")
+	if databaseURL == "" {
+		return nil, fmt.Errorf("DATABASE_URL is required for stored prompt versions")
+	}
+	database, err := db.NewDatabase(databaseURL)
+	if err != nil {
+		return nil, err
+	}
+	return services.NewPromptTemplateService(database.DB), nil
+}
+
+// splitList splits a comma-separated flag, dropping empty items
+func splitList(list string) []string {
+	var items []string
+	for _, item := range strings.Split(list, ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			items = append(items, item)
+		}
+	}
+	return items
+}
+
+// isNumber reports whether s is a non-empty run of digits
+func isNumber(s string) bool {
+	_, err := strconv.Atoi(s)
+	return s != "" && err == nil
+}
@@ -0,0 +1,119 @@
+// Command import-emails imports earlier dealer conversations from .eml files or mbox archives
+// into a user's threads. Emails are matched to threads (or start new ones) unless -thread is
+// given. Imports are idempotent by Message-ID, so a file can be imported again safely.
+//
+//	go run ./cmd/import-emails -user jane@example.com ~/Downloads/dealers.mbox
+//	go run ./cmd/import-emails -user jane@example.com -thread <thread-id> quote.eml reply.eml
+package main
+
+import (
+	"flag"
+	"fmt"
+	"log"
+	"os"
+
+	"carbuyer/internal/config"
+	"carbuyer/internal/db"
+	"carbuyer/internal/db/models"
+	"carbuyer/internal/inbound"
+	"carbuyer/internal/services"
+	"carbuyer/internal/storage"
+
+	"github.com/google/uuid"
+	"github.com/joho/godotenv"
+)
+
+func main() {
+	userFlag := flag.String("user", "", "user ID or email address to import for (required)")
+	threadFlag := flag.String("thread", "", "thread ID to add every email to instead of matching threads")
+	flag.Usage = func() {
+		fmt.Fprintf(flag.CommandLine.Output(), "Usage: import-emails -user <id|email> [-thread <id>] <file.eml|archive.mbox>...\n")
+		flag.PrintDefaults()
+	}
+	flag.Parse()
+
+	if *userFlag == "" || flag.NArg() == 0 {
+		flag.Usage()
+		os.Exit(2)
+	}
+
+	if err := godotenv.Load(); err != nil {
+		log.Println("No .env file found, using environment variables")
+	}
+
+	cfg, err := config.Load()
+	if err != nil {
+		log.Fatalf("Failed to load configuration: %v", err)
+	}
+
+	database, err := db.NewDatabase(cfg.DatabaseURL)
+	if err != nil {
+		log.Fatalf("Failed to connect to database: %v", err)
+	}
+	defer database.Close()
+
+	if err := database.AutoMigrate(); err != nil {
+		log.Fatalf("Failed to run migrations: %v", err)
+	}
+
+	var user models.User
+	query := database.DB.Where("email = ?", *userFlag)
+	if userID, err := uuid.Parse(*userFlag); err == nil {
+		query = database.DB.Where("id = ?", userID)
+	}
+	if err := query.First(&user).Error; err != nil {
+		log.Fatalf("User %s not found: %v", *userFlag, err)
+	}
+
+	var threadID *uuid.UUID
+	if *threadFlag != "" {
+		parsed, err := uuid.Parse(*threadFlag)
+		if err != nil {
+			log.Fatalf("Invalid thread ID %q: %v", *threadFlag, err)
+		}
+		threadID = &parsed
+	}
+
+	// Build the same pipeline the server uses. Imported emails are classified from headers
+	// only, so Gmail and the LLM are never called.
+	emailService := services.NewEmailService(database.DB, cfg.MailgunAPIKey, cfg.MailgunDomain, nil, services.NewEmailClassifier(nil))
+	blobStore, err := storage.NewLocalBlobStore(cfg.AttachmentStorageDir)
+	if err != nil {
+		log.Fatalf("Failed to initialize attachment storage: %v", err)
+	}
+	attachmentService := services.NewAttachmentService(database.DB, blobStore, nil, cfg.AttachmentMaxBytes)
+	threadService := services.NewThreadService(database.DB, cfg.MailgunDomain)
+	importService := services.NewEmailImportService(database.DB, emailService, attachmentService, threadService)
+
+	var emails []*inbound.Email
+	unparseable := 0
+	for _, path := range flag.Args() {
+		file, err := os.Open(path)
+		if err != nil {
+			log.Fatalf("Failed to open %s: %v", path, err)
+		}
+		parsed, skipped, err := inbound.ParseArchive(file, cfg.AttachmentMaxBytes)
+		file.Close()
+		if err != nil {
+			log.Fatalf("Failed to parse %s: %v", path, err)
+		}
+		log.Printf("%s: %d emails", path, len(parsed))
+		emails = append(emails, parsed...)
+		unparseable += skipped
+	}
+
+	result, err := importService.Import(user.ID, threadID, emails)
+	if err != nil {
+		log.Fatalf("Import failed: %v", err)
+	}
+	result.Skipped += unparseable
+
+	for _, importErr := range result.Errors {
+		fmt.Printf("error: %s\n", importErr)
+	}
+	for _, id := range result.ThreadIDs {
+		fmt.Printf("thread: %s\n", id)
+	}
+	log.Printf("Imported %d emails into %d threads (%d new): %d duplicates, %d skipped, %d errors",
+		result.Imported, len(result.ThreadIDs), result.CreatedThreads, result.Duplicates, result.Skipped, len(result.Errors))
+}
@@ -0,0 +1,153 @@
+// Command replay-webhooks lists stored inbound email webhooks and re-runs processing on
+// failed or selected events. Processing is idempotent by Message-ID, so replaying an event
+// that already produced a message is safe.
+//
+//	go run ./cmd/replay-webhooks -list -status failed
+//	go run ./cmd/replay-webhooks -failed -since 48h
+//	go run ./cmd/replay-webhooks <event-id> [event-id...]
+package main
+
+import (
+	"flag"
+	"fmt"
+	"log"
+	"os"
+	"time"
+
+	"carbuyer/internal/config"
+	"carbuyer/internal/db"
+	"carbuyer/internal/db/models"
+	"carbuyer/internal/inbound"
+	"carbuyer/internal/llm"
+	"carbuyer/internal/services"
+	"carbuyer/internal/storage"
+
+	"github.com/google/uuid"
+	"github.com/joho/godotenv"
+)
+
+func main() {
+	list := flag.Bool("list", false, "list events instead of replaying them")
+	failed := flag.Bool("failed", false, "replay every event with the given status")
+	status := flag.String("status", string(models.WebhookEventStatusFailed), "event status to list or replay (empty for all when listing)")
+	since := flag.Duration("since", 7*24*time.Hour, "only consider events received within this window")
+	limit := flag.Int("limit", 100, "maximum number of events to list or replay")
+	flag.Usage = func() {
+		fmt.Fprintf(flag.CommandLine.Output(), "Usage: replay-webhooks [-list | -failed] [flags] [event-id...]\n")
+		flag.PrintDefaults()
+	}
+	flag.Parse()
+
+	if !*list && !*failed && flag.NArg() == 0 {
+		flag.Usage()
+		os.Exit(2)
+	}
+
+	if err := godotenv.Load(); err != nil {
+		log.Println("No .env file found, using environment variables")
+	}
+
+	cfg, err := config.Load()
+	if err != nil {
+		log.Fatalf("Failed to load configuration: %v", err)
+	}
+
+	database, err := db.NewDatabase(cfg.DatabaseURL)
+	if err != nil {
+		log.Fatalf("Failed to connect to database: %v", err)
+	}
+	defer database.Close()
+
+	if err := database.AutoMigrate(); err != nil {
+		log.Fatalf("Failed to run migrations: %v", err)
+	}
+
+	// Build the same processing pipeline the server uses
+	llmClient := llm.WithMeter(llm.NewAnthropic(cfg.AnthropicAPIKey), services.NewUsageService(database.DB, cfg.LLMMonthlyTokenQuota))
+	gmailService, err := services.NewGmailService(
+		database.DB,
+		cfg.GoogleClientID,
+		cfg.GoogleClientSecret,
+		cfg.GoogleRedirectURL,
+		cfg.TokenEncryptionKey,
+	)
+	if err != nil {
+		log.Fatalf("Failed to initialize Gmail service: %v", err)
+	}
+	// Classify inbound mail from headers, asking the LLM only when they are inconclusive
+	var classifierLLM llm.LLM
+	if cfg.EmailClassifierLLM {
+		classifierLLM = llmClient
+	}
+	emailService := services.NewEmailService(database.DB, cfg.MailgunAPIKey, cfg.MailgunDomain, gmailService, services.NewEmailClassifier(classifierLLM))
+
+	blobStore, err := storage.NewLocalBlobStore(cfg.AttachmentStorageDir)
+	if err != nil {
+		log.Fatalf("Failed to initialize attachment storage: %v", err)
+	}
+	attachmentService := services.NewAttachmentService(database.DB, blobStore, nil, cfg.AttachmentMaxBytes)
+	extractionService := services.NewDocumentExtractionService(database.DB, attachmentService, llmClient)
+	offerExtractionService := services.NewOfferExtractionService(database.DB, llmClient)
+	summaryService := services.NewThreadSummaryService(database.DB, llmClient)
+	deliveryService := services.NewDeliveryService(database.DB)
+	webhookService := services.NewInboundWebhookService(database.DB, blobStore, inbound.Adapters(cfg.MailgunWebhookSigningKey, cfg.InboundWebhookSecret, cfg.AttachmentMaxBytes), emailService, attachmentService, extractionService, offerExtractionService, summaryService, deliveryService)
+
+	var events []models.WebhookEvent
+	if flag.NArg() > 0 {
+		for _, arg := range flag.Args() {
+			eventID, err := uuid.Parse(arg)
+			if err != nil {
+				log.Fatalf("Invalid event ID %q: %v", arg, err)
+			}
+			event, err := webhookService.GetEvent(eventID)
+			if err != nil {
+				log.Fatalf("Failed to load event %s: %v", eventID, err)
+			}
+			events = append(events, *event)
+		}
+	} else {
+		events, err = webhookService.ListEvents(models.WebhookEventStatus(*status), time.Now().Add(-*since), *limit)
+		if err != nil {
+			log.Fatalf("Failed to list events: %v", err)
+		}
+	}
+
+	if *list {
+		for _, event := range events {
+			printEvent(&event)
+		}
+		log.Printf("%d events", len(events))
+		return
+	}
+
+	processed := 0
+	for i := range events {
+		event := &events[i]
+		if _, err := webhookService.ProcessEvent(event); err == nil {
+			processed++
+		}
+		printEvent(event)
+	}
+
+	// Let attachment and offer extraction and summary refreshes started by replayed events finish
+	// before exiting
+	extractionService.Wait()
+	offerExtractionService.Wait()
+	summaryService.Wait()
+
+	log.Printf("Replayed %d events: %d processed, %d not processed", len(events), processed, len(events)-processed)
+}
+
+func printEvent(event *models.WebhookEvent) {
+	messageID := "-"
+	if event.MessageID != nil {
+		messageID = event.MessageID.String()
+	}
+	fmt.Printf("%s  %-8s  %-9s  attempts=%d  received=%s  recipient=%s  message=%s",
+		event.ID, event.Provider, event.Status, event.Attempts,
+		event.CreatedAt.Format(time.RFC3339), event.Recipient, messageID)
+	if event.Error != "" {
+		fmt.Printf("  error=%q", event.Error)
+	}
+	fmt.Println()
+}
@@ -9,7 +9,11 @@ import (
 	"carbuyer/internal/api/middleware"
 	"carbuyer/internal/config"
 	"carbuyer/internal/db"
+	"carbuyer/internal/inbound"
+	"carbuyer/internal/llm"
 	"carbuyer/internal/services"
+	"carbuyer/internal/sms"
+	"carbuyer/internal/storage"
 
 	"github.com/go-chi/chi/v5"
 	chimiddleware "github.com/go-chi/chi/v5/middleware"
@@ -49,11 +53,26 @@ func main() {
 	// Initialize services
 	authService := services.NewAuthService(database.DB, cfg.JWTSecret, cfg.JWTExpirationHours, cfg.MailgunDomain)
 	modelsService := services.NewModelsService(database.DB)
-	claudeService := services.NewClaudeService(cfg.AnthropicAPIKey)
-	dealerService := services.NewDealerService(database.DB, claudeService)
+	// Every LLM request is checked against the user's monthly quota and recorded in the usage ledger
+	usageService := services.NewUsageService(database.DB, cfg.LLMMonthlyTokenQuota)
+	llmClient := llm.WithMeter(llm.NewAnthropic(cfg.AnthropicAPIKey), usageService)
+	// Negotiation and dealer search prompts come from versioned templates, seeded with the built-in ones
+	promptService := services.NewPromptTemplateService(database.DB)
+	if err := promptService.Seed(); err != nil {
+		log.Fatalf("Failed to seed prompt templates: %v", err)
+	}
+	dealerService := services.NewDealerService(database.DB, llmClient, promptService)
+
+	// Threads can follow a negotiation strategy profile, built-in or the user's own
+	strategyService := services.NewStrategyService(database.DB)
+	if err := strategyService.Seed(); err != nil {
+		log.Fatalf("Failed to seed strategy profiles: %v", err)
+	}
 	preferencesService := services.NewPreferencesService(database.DB, modelsService, dealerService)
-	threadService := services.NewThreadService(database.DB)
-	messageService := services.NewMessageService(database.DB, claudeService)
+	threadService := services.NewThreadService(database.DB, cfg.MailgunDomain)
+	offerExtractionService := services.NewOfferExtractionService(database.DB, llmClient)
+	summaryService := services.NewThreadSummaryService(database.DB, llmClient)
+	messageService := services.NewMessageService(database.DB, llmClient, offerExtractionService, summaryService, promptService)
 
 	// Initialize Gmail service (for sending emails via user's Gmail)
 	gmailService, err := services.NewGmailService(
@@ -67,19 +86,61 @@ func main() {
 		log.Fatalf("Failed to initialize Gmail service: %v", err)
 	}
 
-	emailService := services.NewEmailService(database.DB, cfg.MailgunAPIKey, cfg.MailgunDomain, gmailService)
+	// Classify inbound mail from headers, asking the LLM only when they are inconclusive
+	var classifierLLM llm.LLM
+	if cfg.EmailClassifierLLM {
+		classifierLLM = llmClient
+	}
+	emailService := services.NewEmailService(database.DB, cfg.MailgunAPIKey, cfg.MailgunDomain, gmailService, services.NewEmailClassifier(classifierLLM))
+
+	// Initialize attachment and webhook payload storage (local filesystem; swap for an S3-compatible BlobStore in production)
+	blobStore, err := storage.NewLocalBlobStore(cfg.AttachmentStorageDir)
+	if err != nil {
+		log.Fatalf("Failed to initialize attachment storage: %v", err)
+	}
+	attachmentService := services.NewAttachmentService(database.DB, blobStore, nil, cfg.AttachmentMaxBytes)
+	extractionService := services.NewDocumentExtractionService(database.DB, attachmentService, llmClient)
+	deliveryService := services.NewDeliveryService(database.DB)
+	webhookService := services.NewInboundWebhookService(database.DB, blobStore, inbound.Adapters(cfg.MailgunWebhookSigningKey, cfg.InboundWebhookSecret, cfg.AttachmentMaxBytes), emailService, attachmentService, extractionService, offerExtractionService, summaryService, deliveryService)
+
+	emailImportService := services.NewEmailImportService(database.DB, emailService, attachmentService, threadService)
+
+	// Initialize SMS provider (the fake logs texts instead of sending them)
+	var smsProvider sms.Provider = sms.NewFakeProvider(cfg.SMSFakeWebhookSecret)
+	if cfg.SMSProvider == "twilio" {
+		smsProvider = sms.NewTwilioProvider(cfg.TwilioAccountSID, cfg.TwilioAuthToken, cfg.SMSWebhookBaseURL+"/api/v1/webhooks/sms/twilio")
+	}
+	smsService := services.NewSMSService(database.DB, smsProvider, threadService, offerExtractionService, summaryService)
+
+	// Autopilot answers seller messages on threads the user put on autopilot
+	draftGuardrailService := services.NewDraftGuardrailService(database.DB, llmClient)
+	autopilotService := services.NewAutopilotService(database.DB, llmClient, emailService, smsService, draftGuardrailService)
+
+	// The master agent works across all of a user's seller threads
+	masterService := services.NewMasterAgentService(database.DB, llmClient)
 
 	// Initialize handlers
 	authHandler := handlers.NewAuthHandler(authService, gmailService)
 	preferencesHandler := handlers.NewPreferencesHandler(preferencesService)
 	dealerHandler := handlers.NewDealerHandler(dealerService, preferencesService)
-	threadHandler := handlers.NewThreadHandler(threadService)
-	messageHandler := handlers.NewMessageHandler(messageService, emailService)
-	emailHandler := handlers.NewEmailHandler(emailService, cfg.MailgunWebhookSigningKey, database.DB)
+	threadHandler := handlers.NewThreadHandler(threadService, summaryService)
+	messageHandler := handlers.NewMessageHandler(messageService, emailService, autopilotService, draftGuardrailService)
+	emailHandler := handlers.NewEmailHandler(emailService, webhookService, autopilotService, database.DB)
 	gmailHandler := handlers.NewGmailHandler(gmailService, cfg.AllowedOrigins[0]) // Use first allowed origin as frontend URL
-	offerHandler := handlers.NewOfferHandler(database)
+	offerHandler := handlers.NewOfferHandler(database, offerExtractionService)
 	dashboardHandler := handlers.NewDashboardHandler(threadService, messageService, database)
 	modelsHandler := handlers.NewModelsHandler(modelsService)
+	attachmentHandler := handlers.NewAttachmentHandler(attachmentService)
+	extractionHandler := handlers.NewExtractionHandler(extractionService)
+	smsHandler := handlers.NewSMSHandler(smsService, autopilotService, draftGuardrailService)
+	emailImportHandler := handlers.NewEmailImportHandler(emailImportService, cfg.EmailImportMaxBytes, cfg.AttachmentMaxBytes)
+	autopilotHandler := handlers.NewAutopilotHandler(autopilotService)
+	usageHandler := handlers.NewUsageHandler(usageService)
+	promptHandler := handlers.NewPromptHandler(promptService)
+	masterHandler := handlers.NewMasterHandler(masterService)
+	strategyHandler := handlers.NewStrategyHandler(strategyService)
+	draftGuardrailHandler := handlers.NewDraftGuardrailHandler(draftGuardrailService)
+	deliveryHandler := handlers.NewDeliveryHandler(deliveryService, inbound.NewMailgunAdapter(cfg.MailgunWebhookSigningKey, cfg.AttachmentMaxBytes))
 
 	// Initialize router
 	r := chi.NewRouter()
@@ -137,6 +198,7 @@ func main() {
 			// Protected auth routes
 			r.With(middleware.AuthMiddleware(authService)).Get("/me", authHandler.Me)
 			r.With(middleware.AuthMiddleware(authService)).Post("/logout", authHandler.Logout)
+			r.With(middleware.AuthMiddleware(authService)).Put("/me/inbox-alias", authHandler.UpdateInboxAlias)
 		})
 
 		// Preferences routes (all protected)
@@ -167,13 +229,35 @@ func main() {
 			r.Post("/", threadHandler.CreateThread)
 			r.Get("/{id}", threadHandler.GetThread)
 			r.Delete("/{id}", threadHandler.ArchiveThread)
+			r.Get("/{id}/summary", threadHandler.GetThreadSummary)
+			r.Put("/{id}/summary", threadHandler.UpdateThreadSummary)
+			r.Post("/{id}/summary/refresh", threadHandler.RefreshThreadSummary)
+			r.Put("/{id}/strategy", strategyHandler.SetThreadStrategy)
 
 			// Message routes nested under threads
 			r.Get("/{id}/messages", messageHandler.GetMessages)
 			r.Post("/{id}/messages", messageHandler.CreateMessage)
+			r.Post("/{id}/messages/stream", messageHandler.CreateMessageStream)
+			r.Post("/{id}/messages/regenerate", messageHandler.RegenerateReply)
 
 			// Offer routes nested under threads
 			r.Post("/{id}/offers", offerHandler.CreateOffer)
+
+			// Historical email import into this thread
+			r.Post("/{id}/import", emailImportHandler.ImportEmails)
+
+			// Autopilot guardrails and decision log
+			r.Get("/{id}/autopilot", autopilotHandler.GetSettings)
+			r.Put("/{id}/autopilot", autopilotHandler.UpdateSettings)
+			r.Get("/{id}/autopilot/decisions", autopilotHandler.GetDecisions)
+		})
+
+		// Autopilot approval queue (all protected)
+		r.Route("/autopilot", func(r chi.Router) {
+			r.Use(middleware.AuthMiddleware(authService))
+			r.Get("/queue", autopilotHandler.GetApprovalQueue)
+			r.Post("/decisions/{id}/approve", autopilotHandler.ApproveReply)
+			r.Post("/decisions/{id}/reject", autopilotHandler.RejectReply)
 		})
 
 		// Offer routes (all protected)
@@ -181,6 +265,25 @@ func main() {
 			r.Use(middleware.AuthMiddleware(authService))
 			r.Get("/", offerHandler.GetAllOffers)
 			r.Delete("/{id}", offerHandler.DeleteOffer)
+			r.Post("/{id}/confirm", offerHandler.ConfirmOffer)
+			r.Post("/{id}/reject", offerHandler.RejectOffer)
+			r.Put("/{id}/status", offerHandler.UpdateOfferStatus)
+		})
+
+		// Negotiation strategy profiles (all protected)
+		r.Route("/strategies", func(r chi.Router) {
+			r.Use(middleware.AuthMiddleware(authService))
+			r.Get("/", strategyHandler.ListProfiles)
+			r.Post("/", strategyHandler.CreateProfile)
+			r.Put("/{id}", strategyHandler.UpdateProfile)
+			r.Delete("/{id}", strategyHandler.DeleteProfile)
+		})
+
+		// Master agent conversation (all protected)
+		r.Route("/master", func(r chi.Router) {
+			r.Use(middleware.AuthMiddleware(authService))
+			r.Get("/", masterHandler.GetConversation)
+			r.Post("/messages", masterHandler.SendMessage)
 		})
 
 		// Inbox message routes (all protected)
@@ -202,13 +305,68 @@ func main() {
 		// Message reply route (protected)
 		r.Route("/messages", func(r chi.Router) {
 			r.Use(middleware.AuthMiddleware(authService))
+			r.Post("/{messageId}/check", draftGuardrailHandler.CheckDraft)
 			r.Post("/{messageId}/reply-via-gmail", messageHandler.ReplyViaGmail)
 			r.Post("/{messageId}/draft", messageHandler.CreateDraftViaGmail)
+			r.Put("/{messageId}", messageHandler.EditDraft)
+			r.Post("/{messageId}/variants/{variantId}/choose", messageHandler.ChooseDraftVariant)
+			r.Get("/{messageId}/attachments", attachmentHandler.GetMessageAttachments)
+			r.Get("/{messageId}/extractions", extractionHandler.GetMessageExtractions)
+			r.Put("/{messageId}/category", messageHandler.SetMessageCategory)
+			r.Post("/{messageId}/send-sms", smsHandler.SendDraft)
+		})
+
+		// Historical email import (protected)
+		r.Route("/import", func(r chi.Router) {
+			r.Use(middleware.AuthMiddleware(authService))
+			r.Post("/emails", emailImportHandler.ImportEmails)
+		})
+
+		// SMS number routes (protected)
+		r.Route("/sms", func(r chi.Router) {
+			r.Use(middleware.AuthMiddleware(authService))
+			r.Get("/number", smsHandler.GetNumber)
+			r.Post("/number", smsHandler.ProvisionNumber)
+			r.Delete("/number", smsHandler.ReleaseNumber)
+		})
+
+		// Attachment routes (protected)
+		r.Route("/attachments", func(r chi.Router) {
+			r.Use(middleware.AuthMiddleware(authService))
+			r.Get("/{id}/download", attachmentHandler.DownloadAttachment)
+			r.Post("/{id}/extract", extractionHandler.ExtractAttachment)
+		})
+
+		// Document extraction routes (protected)
+		r.Route("/extractions", func(r chi.Router) {
+			r.Use(middleware.AuthMiddleware(authService))
+			r.Post("/{id}/promote", extractionHandler.PromoteToOffer)
+		})
+
+		// LLM usage and quota (protected)
+		r.Route("/usage", func(r chi.Router) {
+			r.Use(middleware.AuthMiddleware(authService))
+			r.Get("/", usageHandler.GetUsage)
+		})
+
+		// Admin routes (admin API key)
+		r.Route("/admin", func(r chi.Router) {
+			r.Use(middleware.AdminMiddleware(cfg.AdminAPIKey))
+			r.Get("/usage", usageHandler.GetGlobalUsage)
+			r.Put("/users/{id}/token-quota", usageHandler.SetUserQuota)
+			r.Get("/prompts/{purpose}", promptHandler.ListTemplates)
+			r.Post("/prompts/{purpose}", promptHandler.CreateTemplate)
+			r.Put("/prompts/{purpose}/active", promptHandler.Activate)
+			r.Put("/prompts/{purpose}/experiment", promptHandler.SetExperiment)
+			r.Post("/webhook-events/{id}/replay", emailHandler.ReplayWebhookEvent)
 		})
 
 		// Webhook routes (public - no auth)
 		r.Route("/webhooks", func(r chi.Router) {
-			r.Post("/email/inbound", emailHandler.InboundEmail)
+			r.Post("/email/inbound", emailHandler.InboundEmail) // Mailgun
+			r.Post("/email/inbound/{provider}", emailHandler.InboundEmail)
+			r.Post("/email/events", deliveryHandler.MailgunEvents) // Mailgun delivered, failed and complained events
+			r.Post("/sms/{provider}", smsHandler.InboundSMS)
 			r.Post("/email/test", emailHandler.TestInboundEmail) // For testing without Mailgun
 		})
 
@@ -0,0 +1,165 @@
+package handlers
+
+import (
+	"encoding/json"
+	"io"
+	"log"
+	"mime"
+	"net/http"
+	"strconv"
+
+	"carbuyer/internal/api/middleware"
+	"carbuyer/internal/db/models"
+	"carbuyer/internal/services"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/google/uuid"
+)
+
+type AttachmentHandler struct {
+	attachmentService *services.AttachmentService
+}
+
+func NewAttachmentHandler(attachmentService *services.AttachmentService) *AttachmentHandler {
+	return &AttachmentHandler{
+		attachmentService: attachmentService,
+	}
+}
+
+// AttachmentResponse represents a message attachment in API responses
+type AttachmentResponse struct {
+	ID           string `json:"id"`
+	MessageID    string `json:"messageId"`
+	Filename     string `json:"filename"`
+	ContentType  string `json:"contentType"`
+	SizeBytes    int64  `json:"sizeBytes"`
+	Status       string `json:"status"`
+	RejectReason string `json:"rejectReason,omitempty"`
+	Downloadable bool   `json:"downloadable"`
+	CreatedAt    string `json:"createdAt"`
+}
+
+// newAttachmentResponses converts attachments to their API representation
+func newAttachmentResponses(attachments []models.MessageAttachment) []AttachmentResponse {
+	if len(attachments) == 0 {
+		return nil
+	}
+
+	responses := make([]AttachmentResponse, len(attachments))
+	for i, attachment := range attachments {
+		responses[i] = AttachmentResponse{
+			ID:           attachment.ID.String(),
+			MessageID:    attachment.MessageID.String(),
+			Filename:     attachment.Filename,
+			ContentType:  attachment.ContentType,
+			SizeBytes:    attachment.SizeBytes,
+			Status:       string(attachment.Status),
+			RejectReason: attachment.RejectReason,
+			Downloadable: attachment.Downloadable(),
+			CreatedAt:    attachment.CreatedAt.Format("2006-01-02T15:04:05Z"),
+		}
+	}
+
+	return responses
+}
+
+// GetMessageAttachments lists the attachments on a message
+// GET /api/v1/messages/{messageId}/attachments
+func (h *AttachmentHandler) GetMessageAttachments(w http.ResponseWriter, r *http.Request) {
+	userID, ok := middleware.GetUserIDFromContext(r.Context())
+	if !ok {
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusUnauthorized)
+		json.NewEncoder(w).Encode(ErrorResponse{Error: "unauthorized"})
+		return
+	}
+
+	messageID, err := uuid.Parse(chi.URLParam(r, "messageId"))
+	if err != nil {
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusBadRequest)
+		json.NewEncoder(w).Encode(ErrorResponse{Error: "invalid message ID"})
+		return
+	}
+
+	attachments, err := h.attachmentService.GetMessageAttachments(messageID, userID)
+	if err != nil {
+		w.Header().Set("Content-Type", "application/json")
+		if err.Error() == "message not found" {
+			w.WriteHeader(http.StatusNotFound)
+		} else {
+			w.WriteHeader(http.StatusInternalServerError)
+		}
+		json.NewEncoder(w).Encode(ErrorResponse{Error: err.Error()})
+		return
+	}
+
+	response := newAttachmentResponses(attachments)
+	if response == nil {
+		response = []AttachmentResponse{}
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(struct {
+		Attachments []AttachmentResponse `json:"attachments"`
+	}{
+		Attachments: response,
+	})
+}
+
+// DownloadAttachment streams an attachment's content to the owner
+// GET /api/v1/attachments/{id}/download
+func (h *AttachmentHandler) DownloadAttachment(w http.ResponseWriter, r *http.Request) {
+	userID, ok := middleware.GetUserIDFromContext(r.Context())
+	if !ok {
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusUnauthorized)
+		json.NewEncoder(w).Encode(ErrorResponse{Error: "unauthorized"})
+		return
+	}
+
+	attachmentID, err := uuid.Parse(chi.URLParam(r, "id"))
+	if err != nil {
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusBadRequest)
+		json.NewEncoder(w).Encode(ErrorResponse{Error: "invalid attachment ID"})
+		return
+	}
+
+	attachment, err := h.attachmentService.GetAttachment(attachmentID, userID)
+	if err != nil {
+		w.Header().Set("Content-Type", "application/json")
+		if err.Error() == "attachment not found" {
+			w.WriteHeader(http.StatusNotFound)
+		} else {
+			w.WriteHeader(http.StatusInternalServerError)
+		}
+		json.NewEncoder(w).Encode(ErrorResponse{Error: err.Error()})
+		return
+	}
+
+	reader, err := h.attachmentService.OpenAttachment(attachment)
+	if err != nil {
+		w.Header().Set("Content-Type", "application/json")
+		if err.Error() == "attachment is not available" {
+			w.WriteHeader(http.StatusGone)
+		} else {
+			w.WriteHeader(http.StatusInternalServerError)
+		}
+		json.NewEncoder(w).Encode(ErrorResponse{Error: err.Error()})
+		return
+	}
+	defer reader.Close()
+
+	// Always download rather than render inline - content comes from untrusted senders
+	w.Header().Set("Content-Type", attachment.ContentType)
+	w.Header().Set("Content-Disposition", mime.FormatMediaType("attachment", map[string]string{"filename": attachment.Filename}))
+	w.Header().Set("Content-Length", strconv.FormatInt(attachment.SizeBytes, 10))
+	w.Header().Set("X-Content-Type-Options", "nosniff")
+	w.WriteHeader(http.StatusOK)
+
+	if _, err := io.Copy(w, reader); err != nil {
+		log.Printf("Failed to stream attachment %s: %v", attachment.ID, err)
+	}
+}
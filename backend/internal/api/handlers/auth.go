@@ -4,6 +4,7 @@ import (
 	"encoding/json"
 	"log"
 	"net/http"
+	"strings"
 
 	"carbuyer/internal/api/middleware"
 	"carbuyer/internal/services"
@@ -44,6 +45,7 @@ type UserResponse struct {
 	ID             string               `json:"id"`
 	Email          string               `json:"email"`
 	InboxEmail     string               `json:"inboxEmail"`
+	InboxAlias     *string              `json:"inboxAlias,omitempty"`
 	ZipCode        string               `json:"zipCode,omitempty"`
 	CreatedAt      string               `json:"createdAt"`
 	Preferences    *PreferencesResponse `json:"preferences,omitempty"`
@@ -182,6 +184,7 @@ func (h *AuthHandler) Me(w http.ResponseWriter, r *http.Request) {
 		ID:         user.ID.String(),
 		Email:      user.Email,
 		InboxEmail: user.InboxEmail,
+		InboxAlias: user.InboxAlias,
 		ZipCode:    user.ZipCode,
 		CreatedAt:  user.CreatedAt.Format("2006-01-02T15:04:05Z"),
 	}
@@ -228,6 +231,55 @@ func (h *AuthHandler) Me(w http.ResponseWriter, r *http.Request) {
 	json.NewEncoder(w).Encode(userResp)
 }
 
+// UpdateInboxAlias sets or clears the friendly alias used in the user's inbox address
+// PUT /api/v1/auth/me/inbox-alias
+func (h *AuthHandler) UpdateInboxAlias(w http.ResponseWriter, r *http.Request) {
+	userID, ok := middleware.GetUserIDFromContext(r.Context())
+	if !ok {
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusUnauthorized)
+		json.NewEncoder(w).Encode(ErrorResponse{Error: "unauthorized"})
+		return
+	}
+
+	var req struct {
+		Alias string `json:"alias"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusBadRequest)
+		json.NewEncoder(w).Encode(ErrorResponse{Error: "invalid request body"})
+		return
+	}
+
+	user, err := h.authService.SetInboxAlias(userID, req.Alias)
+	if err != nil {
+		w.Header().Set("Content-Type", "application/json")
+		errMsg := err.Error()
+		if errMsg == "user not found" {
+			w.WriteHeader(http.StatusNotFound)
+		} else if errMsg == "alias is already taken" {
+			w.WriteHeader(http.StatusConflict)
+		} else if strings.HasPrefix(errMsg, "alias ") {
+			w.WriteHeader(http.StatusBadRequest)
+		} else {
+			w.WriteHeader(http.StatusInternalServerError)
+		}
+		json.NewEncoder(w).Encode(ErrorResponse{Error: errMsg})
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(struct {
+		InboxEmail string  `json:"inboxEmail"`
+		InboxAlias *string `json:"inboxAlias,omitempty"`
+	}{
+		InboxEmail: user.InboxEmail,
+		InboxAlias: user.InboxAlias,
+	})
+}
+
 // Logout handles user logout (client-side token removal, server just confirms)
 func (h *AuthHandler) Logout(w http.ResponseWriter, r *http.Request) {
 	w.Header().Set("Content-Type", "application/json")
@@ -0,0 +1,388 @@
+package handlers
+
+import (
+	"encoding/json"
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"carbuyer/internal/api/middleware"
+	"carbuyer/internal/db/models"
+	"carbuyer/internal/services"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/google/uuid"
+)
+
+type AutopilotHandler struct {
+	autopilotService *services.AutopilotService
+}
+
+func NewAutopilotHandler(autopilotService *services.AutopilotService) *AutopilotHandler {
+	return &AutopilotHandler{
+		autopilotService: autopilotService,
+	}
+}
+
+// AutopilotSettingsRequest represents the request to update a thread's autopilot guardrails
+type AutopilotSettingsRequest struct {
+	Enabled          bool     `json:"enabled"`
+	AutoSend         bool     `json:"autoSend"`
+	TargetPrice      *float64 `json:"targetPrice,omitempty"`
+	WalkAwayPrice    *float64 `json:"walkAwayPrice,omitempty"`
+	NeverDisclose    []string `json:"neverDisclose"`
+	MaxRepliesPerDay int      `json:"maxRepliesPerDay,omitempty"` // Defaults to 3
+}
+
+// AutopilotSettingsResponse represents a thread's autopilot guardrails in API responses
+type AutopilotSettingsResponse struct {
+	ThreadID         string   `json:"threadId"`
+	Enabled          bool     `json:"enabled"`
+	AutoSend         bool     `json:"autoSend"`
+	TargetPrice      *float64 `json:"targetPrice,omitempty"`
+	WalkAwayPrice    *float64 `json:"walkAwayPrice,omitempty"`
+	NeverDisclose    []string `json:"neverDisclose"`
+	MaxRepliesPerDay int      `json:"maxRepliesPerDay"`
+}
+
+func newAutopilotSettingsResponse(settings *models.AutopilotSettings) AutopilotSettingsResponse {
+	neverDisclose := []string{}
+	for _, item := range strings.Split(settings.NeverDisclose, "\n") {
+		if item != "" {
+			neverDisclose = append(neverDisclose, item)
+		}
+	}
+
+	return AutopilotSettingsResponse{
+		ThreadID:         settings.ThreadID.String(),
+		Enabled:          settings.Enabled,
+		AutoSend:         settings.AutoSend,
+		TargetPrice:      settings.TargetPrice,
+		WalkAwayPrice:    settings.WalkAwayPrice,
+		NeverDisclose:    neverDisclose,
+		MaxRepliesPerDay: settings.MaxRepliesPerDay,
+	}
+}
+
+// AutopilotDecisionResponse represents an autopilot decision in API responses
+type AutopilotDecisionResponse struct {
+	ID             string  `json:"id"`
+	ThreadID       string  `json:"threadId"`
+	MessageID      *string `json:"messageId,omitempty"`
+	Action         string  `json:"action"`
+	Reasoning      string  `json:"reasoning"`
+	Guardrail      string  `json:"guardrail,omitempty"`
+	GuardrailNote  string  `json:"guardrailNote,omitempty"`
+	Reply          string  `json:"reply,omitempty"`
+	ReplyStatus    string  `json:"replyStatus,omitempty"`
+	DraftMessageID *string `json:"draftMessageId,omitempty"`
+	Error          string  `json:"error,omitempty"`
+	CreatedAt      string  `json:"createdAt"`
+	ReviewedAt     *string `json:"reviewedAt,omitempty"`
+	SentAt         *string `json:"sentAt,omitempty"`
+	SellerName     *string `json:"sellerName,omitempty"`
+}
+
+func newAutopilotDecisionResponse(decision *models.AutopilotDecision) AutopilotDecisionResponse {
+	response := AutopilotDecisionResponse{
+		ID:            decision.ID.String(),
+		ThreadID:      decision.ThreadID.String(),
+		Action:        string(decision.Action),
+		Reasoning:     decision.Reasoning,
+		Guardrail:     string(decision.Guardrail),
+		GuardrailNote: decision.GuardrailNote,
+		Reply:         decision.Reply,
+		ReplyStatus:   string(decision.ReplyStatus),
+		Error:         decision.Error,
+		CreatedAt:     decision.CreatedAt.Format("2006-01-02T15:04:05Z"),
+	}
+
+	if decision.MessageID != nil {
+		messageID := decision.MessageID.String()
+		response.MessageID = &messageID
+	}
+	if decision.DraftMessageID != nil {
+		draftMessageID := decision.DraftMessageID.String()
+		response.DraftMessageID = &draftMessageID
+	}
+	if decision.ReviewedAt != nil {
+		reviewedAt := decision.ReviewedAt.Format("2006-01-02T15:04:05Z")
+		response.ReviewedAt = &reviewedAt
+	}
+	if decision.SentAt != nil {
+		sentAt := decision.SentAt.Format("2006-01-02T15:04:05Z")
+		response.SentAt = &sentAt
+	}
+	if decision.Thread != nil {
+		response.SellerName = &decision.Thread.SellerName
+	}
+
+	return response
+}
+
+// GetSettings returns a thread's autopilot guardrails
+// GET /api/v1/threads/{id}/autopilot
+func (h *AutopilotHandler) GetSettings(w http.ResponseWriter, r *http.Request) {
+	userID, ok := middleware.GetUserIDFromContext(r.Context())
+	if !ok {
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusUnauthorized)
+		json.NewEncoder(w).Encode(ErrorResponse{Error: "unauthorized"})
+		return
+	}
+
+	threadID, err := uuid.Parse(chi.URLParam(r, "id"))
+	if err != nil {
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusBadRequest)
+		json.NewEncoder(w).Encode(ErrorResponse{Error: "invalid thread ID"})
+		return
+	}
+
+	settings, err := h.autopilotService.GetSettings(threadID, userID)
+	if err != nil {
+		w.Header().Set("Content-Type", "application/json")
+		if err.Error() == "thread not found" {
+			w.WriteHeader(http.StatusNotFound)
+		} else {
+			w.WriteHeader(http.StatusInternalServerError)
+		}
+		json.NewEncoder(w).Encode(ErrorResponse{Error: err.Error()})
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(newAutopilotSettingsResponse(settings))
+}
+
+// UpdateSettings puts a thread on or off autopilot and sets its guardrails
+// PUT /api/v1/threads/{id}/autopilot
+func (h *AutopilotHandler) UpdateSettings(w http.ResponseWriter, r *http.Request) {
+	userID, ok := middleware.GetUserIDFromContext(r.Context())
+	if !ok {
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusUnauthorized)
+		json.NewEncoder(w).Encode(ErrorResponse{Error: "unauthorized"})
+		return
+	}
+
+	threadID, err := uuid.Parse(chi.URLParam(r, "id"))
+	if err != nil {
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusBadRequest)
+		json.NewEncoder(w).Encode(ErrorResponse{Error: "invalid thread ID"})
+		return
+	}
+
+	var req AutopilotSettingsRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusBadRequest)
+		json.NewEncoder(w).Encode(ErrorResponse{Error: "invalid request body"})
+		return
+	}
+
+	settings, err := h.autopilotService.UpdateSettings(threadID, userID, services.AutopilotSettingsInput{
+		Enabled:          req.Enabled,
+		AutoSend:         req.AutoSend,
+		TargetPrice:      req.TargetPrice,
+		WalkAwayPrice:    req.WalkAwayPrice,
+		NeverDisclose:    req.NeverDisclose,
+		MaxRepliesPerDay: req.MaxRepliesPerDay,
+	})
+	if err != nil {
+		w.Header().Set("Content-Type", "application/json")
+		switch {
+		case err.Error() == "thread not found":
+			w.WriteHeader(http.StatusNotFound)
+		case strings.HasPrefix(err.Error(), "database error"), strings.HasPrefix(err.Error(), "failed to"):
+			w.WriteHeader(http.StatusInternalServerError)
+		default:
+			w.WriteHeader(http.StatusBadRequest)
+		}
+		json.NewEncoder(w).Encode(ErrorResponse{Error: err.Error()})
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(newAutopilotSettingsResponse(settings))
+}
+
+// GetDecisions returns the log of a thread's autopilot decisions, newest first
+// GET /api/v1/threads/{id}/autopilot/decisions?limit=50
+func (h *AutopilotHandler) GetDecisions(w http.ResponseWriter, r *http.Request) {
+	userID, ok := middleware.GetUserIDFromContext(r.Context())
+	if !ok {
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusUnauthorized)
+		json.NewEncoder(w).Encode(ErrorResponse{Error: "unauthorized"})
+		return
+	}
+
+	threadID, err := uuid.Parse(chi.URLParam(r, "id"))
+	if err != nil {
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusBadRequest)
+		json.NewEncoder(w).Encode(ErrorResponse{Error: "invalid thread ID"})
+		return
+	}
+
+	limit := 50
+	if l, err := strconv.Atoi(r.URL.Query().Get("limit")); err == nil && l > 0 && l <= 100 {
+		limit = l
+	}
+
+	decisions, err := h.autopilotService.GetDecisions(threadID, userID, limit)
+	if err != nil {
+		w.Header().Set("Content-Type", "application/json")
+		if err.Error() == "thread not found" {
+			w.WriteHeader(http.StatusNotFound)
+		} else {
+			w.WriteHeader(http.StatusInternalServerError)
+		}
+		json.NewEncoder(w).Encode(ErrorResponse{Error: err.Error()})
+		return
+	}
+
+	response := make([]AutopilotDecisionResponse, len(decisions))
+	for i := range decisions {
+		response[i] = newAutopilotDecisionResponse(&decisions[i])
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"decisions": response,
+	})
+}
+
+// GetApprovalQueue returns the user's autopilot replies waiting for approval
+// GET /api/v1/autopilot/queue
+func (h *AutopilotHandler) GetApprovalQueue(w http.ResponseWriter, r *http.Request) {
+	userID, ok := middleware.GetUserIDFromContext(r.Context())
+	if !ok {
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusUnauthorized)
+		json.NewEncoder(w).Encode(ErrorResponse{Error: "unauthorized"})
+		return
+	}
+
+	decisions, err := h.autopilotService.GetApprovalQueue(userID)
+	if err != nil {
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusInternalServerError)
+		json.NewEncoder(w).Encode(ErrorResponse{Error: err.Error()})
+		return
+	}
+
+	response := make([]AutopilotDecisionResponse, len(decisions))
+	for i := range decisions {
+		response[i] = newAutopilotDecisionResponse(&decisions[i])
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"decisions": response,
+	})
+}
+
+// ApproveReply sends a queued autopilot reply, optionally edited
+// POST /api/v1/autopilot/decisions/{id}/approve
+func (h *AutopilotHandler) ApproveReply(w http.ResponseWriter, r *http.Request) {
+	userID, ok := middleware.GetUserIDFromContext(r.Context())
+	if !ok {
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusUnauthorized)
+		json.NewEncoder(w).Encode(ErrorResponse{Error: "unauthorized"})
+		return
+	}
+
+	decisionID, err := uuid.Parse(chi.URLParam(r, "id"))
+	if err != nil {
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusBadRequest)
+		json.NewEncoder(w).Encode(ErrorResponse{Error: "invalid decision ID"})
+		return
+	}
+
+	var req struct {
+		Content             string `json:"content"`
+		AcknowledgeWarnings bool   `json:"acknowledgeWarnings"` // Send despite draft warnings that don't block sending
+	}
+	if r.ContentLength > 0 {
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			w.Header().Set("Content-Type", "application/json")
+			w.WriteHeader(http.StatusBadRequest)
+			json.NewEncoder(w).Encode(ErrorResponse{Error: "invalid request body"})
+			return
+		}
+	}
+
+	decision, err := h.autopilotService.ApproveReply(r.Context(), decisionID, userID, req.Content, req.AcknowledgeWarnings)
+	if err != nil {
+		if writeDraftBlocked(w, err) {
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		switch err.Error() {
+		case "decision not found", "seller message not found":
+			w.WriteHeader(http.StatusNotFound)
+		case "reply is not pending approval", "recipient has opted out of texts", "recipient email address is suppressed":
+			w.WriteHeader(http.StatusConflict)
+		case "the seller's message didn't arrive by email or text", "no phone number for this dealer", "sms number not found":
+			w.WriteHeader(http.StatusBadRequest)
+		default:
+			log.Printf("Failed to send autopilot reply: %v", err)
+			w.WriteHeader(llmErrorStatus(err, http.StatusBadGateway))
+		}
+		json.NewEncoder(w).Encode(ErrorResponse{Error: err.Error()})
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(newAutopilotDecisionResponse(decision))
+}
+
+// RejectReply drops a queued autopilot reply without sending it
+// POST /api/v1/autopilot/decisions/{id}/reject
+func (h *AutopilotHandler) RejectReply(w http.ResponseWriter, r *http.Request) {
+	userID, ok := middleware.GetUserIDFromContext(r.Context())
+	if !ok {
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusUnauthorized)
+		json.NewEncoder(w).Encode(ErrorResponse{Error: "unauthorized"})
+		return
+	}
+
+	decisionID, err := uuid.Parse(chi.URLParam(r, "id"))
+	if err != nil {
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusBadRequest)
+		json.NewEncoder(w).Encode(ErrorResponse{Error: "invalid decision ID"})
+		return
+	}
+
+	decision, err := h.autopilotService.RejectReply(decisionID, userID)
+	if err != nil {
+		w.Header().Set("Content-Type", "application/json")
+		switch err.Error() {
+		case "decision not found":
+			w.WriteHeader(http.StatusNotFound)
+		case "reply is not pending approval":
+			w.WriteHeader(http.StatusConflict)
+		default:
+			w.WriteHeader(http.StatusInternalServerError)
+		}
+		json.NewEncoder(w).Encode(ErrorResponse{Error: err.Error()})
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(newAutopilotDecisionResponse(decision))
+}
@@ -29,20 +29,60 @@ func NewDashboardHandler(threadService *services.ThreadService, messageService *
 
 // DashboardResponse represents the consolidated dashboard data
 type DashboardResponse struct {
-	Threads       []ThreadResponse       `json:"threads"`
-	InboxMessages []InboxMessageResponse `json:"inboxMessages"`
-	Offers        []OfferResponse        `json:"offers"`
+	Threads            []ThreadResponse       `json:"threads"`
+	InboxMessages      []InboxMessageResponse `json:"inboxMessages"`
+	Offers             []OfferResponse        `json:"offers"`
+	FilteredInboxCount int64                  `json:"filteredInboxCount"` // Auto-replies, marketing and spam hidden from InboxMessages
 }
 
 // InboxMessageResponse includes additional fields for inbox messages
 type InboxMessageResponse struct {
-	ID                string `json:"id"`
-	Sender            string `json:"sender"`
-	SenderEmail       string `json:"senderEmail"`
-	Subject           string `json:"subject"`
-	Content           string `json:"content"`
-	Timestamp         string `json:"timestamp"`
-	ExternalMessageID string `json:"externalMessageId,omitempty"`
+	ID                string               `json:"id"`
+	Sender            string               `json:"sender"`
+	SenderEmail       string               `json:"senderEmail"`
+	Subject           string               `json:"subject"`
+	Content           string               `json:"content"`
+	RawContent        string               `json:"rawContent,omitempty"`
+	Timestamp         string               `json:"timestamp"`
+	ExternalMessageID string               `json:"externalMessageId,omitempty"`
+	SuggestedThreadID *string              `json:"suggestedThreadId,omitempty"`
+	MatchConfidence   *float64             `json:"matchConfidence,omitempty"`
+	MatchSignal       string               `json:"matchSignal,omitempty"`
+	Category          string               `json:"category,omitempty"`
+	CategorySource    string               `json:"categorySource,omitempty"`
+	CategoryReason    string               `json:"categoryReason,omitempty"`
+	Channel           string               `json:"channel,omitempty"` // "sms" for texts
+	SenderPhone       string               `json:"senderPhone,omitempty"`
+	Attachments       []AttachmentResponse `json:"attachments,omitempty"`
+}
+
+// newInboxMessageResponse converts an inbox message to its API representation
+func newInboxMessageResponse(msg models.Message) InboxMessageResponse {
+	resp := InboxMessageResponse{
+		ID:                msg.ID.String(),
+		Sender:            string(msg.Sender),
+		SenderEmail:       msg.SenderEmail,
+		Subject:           msg.Subject,
+		Content:           msg.Content,
+		RawContent:        msg.RawContent,
+		Timestamp:         msg.Timestamp.Format("2006-01-02T15:04:05Z"),
+		ExternalMessageID: msg.ExternalMessageID,
+		MatchConfidence:   msg.MatchConfidence,
+		MatchSignal:       msg.MatchSignal,
+		Category:          string(msg.Category),
+		CategorySource:    string(msg.CategorySource),
+		CategoryReason:    msg.CategoryReason,
+		Channel:           string(msg.Channel),
+		SenderPhone:       msg.SenderPhone,
+		Attachments:       newAttachmentResponses(msg.Attachments),
+	}
+
+	if msg.SuggestedThreadID != nil {
+		suggested := msg.SuggestedThreadID.String()
+		resp.SuggestedThreadID = &suggested
+	}
+
+	return resp
 }
 
 // GetDashboard retrieves all dashboard data (threads, inbox messages, and offers) in a single request
@@ -58,6 +98,7 @@ func (h *DashboardHandler) GetDashboard(w http.ResponseWriter, r *http.Request)
 	// Use goroutines to fetch all data in parallel
 	var threads []models.Thread
 	var inboxMessages []models.Message
+	var filteredInboxCount int64
 	var offers []models.TrackedOffer
 	var threadsErr, messagesErr, offersErr error
 
@@ -73,7 +114,10 @@ func (h *DashboardHandler) GetDashboard(w http.ResponseWriter, r *http.Request)
 	// Fetch inbox messages
 	go func() {
 		defer wg.Done()
-		inboxMessages, _, messagesErr = h.messageService.GetInboxMessages(userID, 50, 0)
+		inboxMessages, _, messagesErr = h.messageService.GetInboxMessages(userID, services.InboxViewDefault, 50, 0)
+		if messagesErr == nil {
+			filteredInboxCount, messagesErr = h.messageService.CountFilteredInboxMessages(userID)
+		}
 	}()
 
 	// Fetch offers
@@ -108,9 +152,10 @@ func (h *DashboardHandler) GetDashboard(w http.ResponseWriter, r *http.Request)
 
 	// Build response
 	response := DashboardResponse{
-		Threads:       make([]ThreadResponse, len(threads)),
-		InboxMessages: make([]InboxMessageResponse, len(inboxMessages)),
-		Offers:        make([]OfferResponse, len(offers)),
+		Threads:            make([]ThreadResponse, len(threads)),
+		InboxMessages:      make([]InboxMessageResponse, len(inboxMessages)),
+		Offers:             make([]OfferResponse, len(offers)),
+		FilteredInboxCount: filteredInboxCount,
 	}
 
 	// Convert threads
@@ -133,39 +178,12 @@ func (h *DashboardHandler) GetDashboard(w http.ResponseWriter, r *http.Request)
 
 	// Convert inbox messages
 	for i, msg := range inboxMessages {
-		response.InboxMessages[i] = InboxMessageResponse{
-			ID:                msg.ID.String(),
-			Sender:            string(msg.Sender),
-			SenderEmail:       msg.SenderEmail,
-			Subject:           msg.Subject,
-			Content:           msg.Content,
-			Timestamp:         msg.Timestamp.Format("2006-01-02T15:04:05Z"),
-			ExternalMessageID: msg.ExternalMessageID,
-		}
+		response.InboxMessages[i] = newInboxMessageResponse(msg)
 	}
 
 	// Convert offers
 	for i, offer := range offers {
-		offerResp := OfferResponse{
-			ID:        offer.ID.String(),
-			ThreadID:  offer.ThreadID.String(),
-			OfferText: offer.OfferText,
-			TrackedAt: offer.TrackedAt.Format("2006-01-02T15:04:05Z"),
-		}
-
-		if offer.MessageID != nil {
-			msgID := offer.MessageID.String()
-			offerResp.MessageID = &msgID
-		}
-
-		// Include thread details if available
-		if offer.Thread != nil {
-			offerResp.SellerName = &offer.Thread.SellerName
-			threadType := string(offer.Thread.SellerType)
-			offerResp.ThreadType = &threadType
-		}
-
-		response.Offers[i] = offerResp
+		response.Offers[i] = newOfferResponse(offer)
 	}
 
 	w.Header().Set("Content-Type", "application/json")
@@ -180,12 +198,16 @@ func (h *DashboardHandler) fetchThreads(userID uuid.UUID) ([]models.Thread, erro
 
 // fetchOffers is a helper to fetch offers
 func (h *DashboardHandler) fetchOffers(userID uuid.UUID) ([]models.TrackedOffer, error) {
+	if err := services.ExpireOffers(h.db.DB, userID); err != nil {
+		return nil, err
+	}
+
 	var offers []models.TrackedOffer
 
-	// Get all offers for user's threads, ordered by most recent first
+	// Get all offers for user's threads except rejected detections, ordered by most recent first
 	err := h.db.DB.
 		Joins("JOIN threads ON threads.id = tracked_offers.thread_id").
-		Where("threads.user_id = ?", userID).
+		Where("threads.user_id = ? AND tracked_offers.review_status <> ?", userID, models.OfferReviewRejected).
 		Preload("Thread").
 		Order("tracked_offers.tracked_at DESC").
 		Find(&offers).Error
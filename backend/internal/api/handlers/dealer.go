@@ -24,14 +24,16 @@ func NewDealerHandler(dealerService *services.DealerService, prefsService *servi
 
 // DealerResponse represents a dealer in API responses
 type DealerResponse struct {
-	ID        string  `json:"id"`
-	Name      string  `json:"name"`
-	Location  string  `json:"location"`
-	Email     *string `json:"email,omitempty"`
-	Phone     *string `json:"phone,omitempty"`
-	Website   *string `json:"website,omitempty"`
-	Distance  float64 `json:"distance"`
-	Contacted bool    `json:"contacted"`
+	ID                string  `json:"id"`
+	Name              string  `json:"name"`
+	Location          string  `json:"location"`
+	Email             *string `json:"email,omitempty"`
+	Phone             *string `json:"phone,omitempty"`
+	Website           *string `json:"website,omitempty"`
+	Distance          float64 `json:"distance"`
+	Contacted         bool    `json:"contacted"`
+	EmailStatus       string  `json:"emailStatus,omitempty"` // "invalid" after a hard bounce, "complained" after a spam complaint
+	EmailStatusReason string  `json:"emailStatusReason,omitempty"`
 }
 
 // UpdateDealersRequest represents the request body for updating dealers
@@ -78,14 +80,16 @@ func (h *DealerHandler) GetDealers(w http.ResponseWriter, r *http.Request) {
 	dealerResponses := make([]DealerResponse, len(dealers))
 	for i, dealer := range dealers {
 		dealerResponses[i] = DealerResponse{
-			ID:        dealer.ID.String(),
-			Name:      dealer.Name,
-			Location:  dealer.Location,
-			Email:     dealer.Email,
-			Phone:     dealer.Phone,
-			Website:   dealer.Website,
-			Distance:  dealer.Distance,
-			Contacted:  dealer.Contacted,
+			ID:                dealer.ID.String(),
+			Name:              dealer.Name,
+			Location:          dealer.Location,
+			Email:             dealer.Email,
+			Phone:             dealer.Phone,
+			Website:           dealer.Website,
+			Distance:          dealer.Distance,
+			Contacted:         dealer.Contacted,
+			EmailStatus:       string(dealer.EmailStatus),
+			EmailStatusReason: dealer.EmailStatusReason,
 		}
 	}
 
@@ -0,0 +1,79 @@
+package handlers
+
+import (
+	"encoding/json"
+	"errors"
+	"io"
+	"log"
+	"net/http"
+
+	"carbuyer/internal/inbound"
+	"carbuyer/internal/services"
+)
+
+// maxDeliveryEventBytes caps a delivery event webhook body
+const maxDeliveryEventBytes = 1 << 20 // 1MB
+
+type DeliveryHandler struct {
+	deliveryService *services.DeliveryService
+	mailgun         *inbound.MailgunAdapter
+}
+
+func NewDeliveryHandler(deliveryService *services.DeliveryService, mailgun *inbound.MailgunAdapter) *DeliveryHandler {
+	return &DeliveryHandler{
+		deliveryService: deliveryService,
+		mailgun:         mailgun,
+	}
+}
+
+// MailgunEvents records Mailgun delivered, failed and complained event webhooks against the
+// outbound message they describe
+// POST /api/v1/webhooks/email/events
+func (h *DeliveryHandler) MailgunEvents(w http.ResponseWriter, r *http.Request) {
+	payload, err := io.ReadAll(io.LimitReader(r.Body, maxDeliveryEventBytes))
+	if err != nil {
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusBadRequest)
+		json.NewEncoder(w).Encode(ErrorResponse{Error: "failed to read request body"})
+		return
+	}
+
+	event, err := h.mailgun.ParseEvent(payload)
+	if err != nil {
+		w.Header().Set("Content-Type", "application/json")
+		if errors.Is(err, inbound.ErrUnauthorized) {
+			w.WriteHeader(http.StatusUnauthorized)
+		} else {
+			w.WriteHeader(http.StatusBadRequest)
+		}
+		json.NewEncoder(w).Encode(ErrorResponse{Error: err.Error()})
+		return
+	}
+
+	// Opens, clicks and other events don't change delivery status
+	if event == nil {
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusOK)
+		json.NewEncoder(w).Encode(map[string]string{"status": "ignored"})
+		return
+	}
+
+	message, err := h.deliveryService.RecordEvent(*event)
+	if err != nil {
+		// Mailgun retries on 5xx
+		log.Printf("Failed to record %s event for %s: %v", event.Type, event.Recipient, err)
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusInternalServerError)
+		json.NewEncoder(w).Encode(ErrorResponse{Error: "failed to record event"})
+		return
+	}
+
+	response := map[string]string{"status": "recorded"}
+	if message != nil {
+		response["messageId"] = message.ID.String()
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(response)
+}
@@ -0,0 +1,126 @@
+package handlers
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+
+	"carbuyer/internal/api/middleware"
+	"carbuyer/internal/services"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/google/uuid"
+)
+
+type DraftGuardrailHandler struct {
+	guardrails *services.DraftGuardrailService
+}
+
+func NewDraftGuardrailHandler(guardrails *services.DraftGuardrailService) *DraftGuardrailHandler {
+	return &DraftGuardrailHandler{
+		guardrails: guardrails,
+	}
+}
+
+// DraftWarningResponse represents a problem found in a draft before it's sent
+type DraftWarningResponse struct {
+	Kind     string `json:"kind"`     // competitor, walk_away_price, budget, never_disclose, personal_data or contradiction
+	Severity string `json:"severity"` // block: the draft can't be sent; warn: it can once acknowledged
+	Message  string `json:"message"`
+	Excerpt  string `json:"excerpt,omitempty"`
+}
+
+// DraftCheckResponse represents the result of checking a draft
+type DraftCheckResponse struct {
+	Warnings []DraftWarningResponse `json:"warnings"`
+	Blocked  bool                   `json:"blocked"` // Some warning blocks sending
+}
+
+func newDraftCheckResponse(warnings []services.DraftWarning) DraftCheckResponse {
+	response := DraftCheckResponse{
+		Warnings: make([]DraftWarningResponse, len(warnings)),
+	}
+	for i, warning := range warnings {
+		response.Warnings[i] = DraftWarningResponse{
+			Kind:     string(warning.Kind),
+			Severity: string(warning.Severity),
+			Message:  warning.Message,
+			Excerpt:  warning.Excerpt,
+		}
+		if warning.Severity == services.DraftSeverityBlock {
+			response.Blocked = true
+		}
+	}
+	return response
+}
+
+// CheckDraft checks a draft reply before it's sent, so the warnings can be shown first. The
+// message is the seller message being replied to or the agent draft being sent; without
+// content the agent draft's own is checked.
+// POST /api/v1/messages/{messageId}/check
+func (h *DraftGuardrailHandler) CheckDraft(w http.ResponseWriter, r *http.Request) {
+	userID, ok := middleware.GetUserIDFromContext(r.Context())
+	if !ok {
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusUnauthorized)
+		json.NewEncoder(w).Encode(ErrorResponse{Error: "unauthorized"})
+		return
+	}
+
+	messageID, err := uuid.Parse(chi.URLParam(r, "messageId"))
+	if err != nil {
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusBadRequest)
+		json.NewEncoder(w).Encode(ErrorResponse{Error: "invalid message ID"})
+		return
+	}
+
+	var req struct {
+		Content string `json:"content"`
+	}
+	if r.ContentLength > 0 {
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			w.Header().Set("Content-Type", "application/json")
+			w.WriteHeader(http.StatusBadRequest)
+			json.NewEncoder(w).Encode(ErrorResponse{Error: "invalid request body"})
+			return
+		}
+	}
+
+	warnings, err := h.guardrails.CheckReply(r.Context(), userID, messageID, req.Content)
+	if err != nil {
+		w.Header().Set("Content-Type", "application/json")
+		switch err.Error() {
+		case "message not found", "thread not found":
+			w.WriteHeader(http.StatusNotFound)
+		default:
+			w.WriteHeader(llmErrorStatus(err, http.StatusInternalServerError))
+		}
+		json.NewEncoder(w).Encode(ErrorResponse{Error: err.Error()})
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(newDraftCheckResponse(warnings))
+}
+
+// writeDraftBlocked writes the warnings of a draft that didn't pass the guardrails, reporting
+// whether err was one
+func writeDraftBlocked(w http.ResponseWriter, err error) bool {
+	var blocked *services.DraftBlockedError
+	if !errors.As(err, &blocked) {
+		return false
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusUnprocessableEntity)
+	json.NewEncoder(w).Encode(struct {
+		Error string `json:"error"`
+		DraftCheckResponse
+	}{
+		Error:              err.Error(),
+		DraftCheckResponse: newDraftCheckResponse(blocked.Warnings),
+	})
+	return true
+}
@@ -1,132 +1,117 @@
 package handlers
 
 import (
-	"crypto/hmac"
-	"crypto/sha256"
-	"encoding/hex"
+	"bytes"
 	"encoding/json"
-	"errors"
+	"io"
 	"log"
 	"net/http"
 	"strconv"
+	"strings"
 	"time"
 
-	"carbuyer/internal/db/models"
+	"carbuyer/internal/inbound"
 	"carbuyer/internal/services"
 
+	"github.com/go-chi/chi/v5"
+	"github.com/google/uuid"
 	"gorm.io/gorm"
 )
 
 type EmailHandler struct {
-	emailService         *services.EmailService
-	webhookSigningKey    string
-	db                   *gorm.DB
+	emailService     *services.EmailService
+	webhookService   *services.InboundWebhookService
+	autopilotService *services.AutopilotService
+	db               *gorm.DB
 }
 
-func NewEmailHandler(emailService *services.EmailService, webhookSigningKey string, db *gorm.DB) *EmailHandler {
+func NewEmailHandler(emailService *services.EmailService, webhookService *services.InboundWebhookService, autopilotService *services.AutopilotService, db *gorm.DB) *EmailHandler {
 	return &EmailHandler{
-		emailService:      emailService,
-		webhookSigningKey: webhookSigningKey,
-		db:                db,
+		emailService:     emailService,
+		webhookService:   webhookService,
+		autopilotService: autopilotService,
+		db:               db,
 	}
 }
 
-// MailgunWebhookPayload represents the parsed email data from Mailgun
-type MailgunWebhookPayload struct {
-	Signature struct {
-		Timestamp string `json:"timestamp"`
-		Token     string `json:"token"`
-		Signature string `json:"signature"`
-	} `json:"signature"`
-	EventData struct {
-		Sender      string `json:"sender"`
-		Recipient   string `json:"recipient"`
-		Subject     string `json:"subject"`
-		BodyPlain   string `json:"body-plain"`
-		MessageID   string `json:"Message-Id"`
-		From        string `json:"from"`
-		To          string `json:"to"`
-	} `json:"event-data"`
-}
-
-// InboundEmail handles incoming emails from Mailgun webhook
+// InboundEmail handles incoming email webhooks. The provider comes from the URL
+// (/webhooks/email/inbound/{provider}) and defaults to Mailgun. Verified payloads are stored
+// as webhook events before they're processed, so failures can be replayed; of ones that fail
+// verification only the start is kept, for inspection.
 func (h *EmailHandler) InboundEmail(w http.ResponseWriter, r *http.Request) {
-	// Debug: log request details
-	log.Printf("Content-Type: %s, Method: %s, Content-Length: %d",
-		r.Header.Get("Content-Type"), r.Method, r.ContentLength)
-
-	// Try parsing as multipart form first (Mailgun uses this for attachments)
-	contentType := r.Header.Get("Content-Type")
-	if contentType != "" && len(contentType) > 19 && contentType[:19] == "multipart/form-data" {
-		if err := r.ParseMultipartForm(32 << 20); err != nil { // 32MB max
-			log.Printf("ParseMultipartForm error: %v", err)
-			// Don't fail completely - this might be an incomplete webhook notification
-			// Return 200 to prevent Mailgun retries
-			w.Header().Set("Content-Type", "application/json")
-			w.WriteHeader(http.StatusOK)
-			json.NewEncoder(w).Encode(map[string]string{"status": "skipped - malformed multipart data"})
-			return
-		}
-	} else {
-		// Parse as regular form data
-		if err := r.ParseForm(); err != nil {
-			log.Printf("ParseForm error: %v", err)
-			w.Header().Set("Content-Type", "application/json")
-			w.WriteHeader(http.StatusBadRequest)
-			json.NewEncoder(w).Encode(ErrorResponse{Error: "invalid form data"})
-			return
-		}
+	provider := chi.URLParam(r, "provider")
+	if provider == "" {
+		provider = "mailgun"
 	}
 
-	// Debug: log ALL form fields to see what Mailgun is sending
-	log.Printf("All form fields received: %v", r.Form)
-	if r.MultipartForm != nil {
-		log.Printf("Multipart form values: %v", r.MultipartForm.Value)
+	adapter, ok := h.webhookService.Adapter(provider)
+	if !ok {
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusNotFound)
+		json.NewEncoder(w).Encode(ErrorResponse{Error: "unknown email provider"})
+		return
 	}
 
-	// Extract form fields
-	recipientEmail := r.FormValue("recipient")
-	from := r.FormValue("from")
-	sender := r.FormValue("sender")
-	subject := r.FormValue("subject")
-	bodyPlain := r.FormValue("stripped-text") // Use stripped-text for clean message content
-	messageID := r.FormValue("Message-Id")
-
-	// Debug: log what we received
-	log.Printf("Webhook received - recipient: %s, from: %s, subject: %s, body length: %d",
-		recipientEmail, from, subject, len(bodyPlain))
-
-	// Use sender if from is empty
-	if from == "" {
-		from = sender
+	// Debug: log request details
+	log.Printf("Inbound webhook (%s) - Content-Type: %s, Content-Length: %d",
+		provider, r.Header.Get("Content-Type"), r.ContentLength)
+
+	payload, err := io.ReadAll(http.MaxBytesReader(w, r.Body, services.MaxWebhookPayloadBytes))
+	if err != nil {
+		log.Printf("Failed to read %s webhook body: %v", provider, err)
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusRequestEntityTooLarge)
+		json.NewEncoder(w).Encode(ErrorResponse{Error: "payload too large"})
+		return
 	}
+	r.Body = io.NopCloser(bytes.NewReader(payload))
 
-	// Look up user by inbox_email
-	var user models.User
-	if err := h.db.Where("inbox_email = ?", recipientEmail).First(&user).Error; err != nil {
-		if errors.Is(err, gorm.ErrRecordNotFound) {
-			// User not found - return 200 to prevent retries, but log
-			w.Header().Set("Content-Type", "application/json")
-			w.WriteHeader(http.StatusOK)
-			json.NewEncoder(w).Encode(map[string]string{"status": "user not found"})
-			return
+	if err := adapter.Verify(r); err != nil {
+		// Only the start of an unverified payload is kept
+		if _, recordErr := h.webhookService.RecordRejectedEvent(provider, r.Header.Get("Content-Type"), r.URL.Query(), payload, err); recordErr != nil {
+			log.Printf("Failed to record rejected %s webhook: %v", provider, recordErr)
 		}
 		w.Header().Set("Content-Type", "application/json")
-		w.WriteHeader(http.StatusInternalServerError)
-		json.NewEncoder(w).Encode(ErrorResponse{Error: "database error"})
+		w.WriteHeader(http.StatusUnauthorized)
+		json.NewEncoder(w).Encode(ErrorResponse{Error: "unauthorized"})
 		return
 	}
 
-	// Process inbound email
-	message, err := h.emailService.ProcessInboundEmail(user.ID, from, subject, bodyPlain, messageID)
+	event, err := h.webhookService.RecordEvent(provider, r.Header.Get("Content-Type"), r.URL.Query(), payload)
 	if err != nil {
+		// Not stored - let the provider retry
+		log.Printf("Failed to record %s webhook: %v", provider, err)
 		w.Header().Set("Content-Type", "application/json")
 		w.WriteHeader(http.StatusInternalServerError)
-		json.NewEncoder(w).Encode(ErrorResponse{Error: "failed to process email"})
+		json.NewEncoder(w).Encode(ErrorResponse{Error: "failed to record webhook"})
+		return
+	}
+
+	message, err := h.webhookService.ProcessEvent(event)
+	if err != nil {
+		log.Printf("Webhook event %s (%s) not processed: %v", event.ID, provider, err)
+
+		w.Header().Set("Content-Type", "application/json")
+		switch {
+		case err.Error() == "user not found":
+			// Return 200 to prevent retries - the event is kept for replay
+			w.WriteHeader(http.StatusOK)
+			json.NewEncoder(w).Encode(map[string]string{"status": "user not found"})
+		case strings.HasPrefix(err.Error(), "invalid webhook payload"):
+			// A retry would send the same payload - the event is kept for replay
+			w.WriteHeader(http.StatusOK)
+			json.NewEncoder(w).Encode(map[string]string{"status": "skipped - malformed payload"})
+		default:
+			w.WriteHeader(http.StatusInternalServerError)
+			json.NewEncoder(w).Encode(ErrorResponse{Error: "failed to process email"})
+		}
 		return
 	}
 
-	// Return 200 OK (critical for Mailgun)
+	// Replayed events don't reach here, so autopilot only answers mail as it arrives
+	h.autopilotService.RespondAsync(message.ID)
+
+	// Return 200 OK (critical for webhook providers)
 	w.Header().Set("Content-Type", "application/json")
 	w.WriteHeader(http.StatusOK)
 	json.NewEncoder(w).Encode(map[string]interface{}{
@@ -135,16 +120,36 @@ func (h *EmailHandler) InboundEmail(w http.ResponseWriter, r *http.Request) {
 	})
 }
 
-// verifySignature verifies the Mailgun webhook signature
-func (h *EmailHandler) verifySignature(timestamp, token, signature string) bool {
-	// Compute expected signature
-	h1 := hmac.New(sha256.New, []byte(h.webhookSigningKey))
-	h1.Write([]byte(timestamp))
-	h1.Write([]byte(token))
-	expected := hex.EncodeToString(h1.Sum(nil))
+// ReplayWebhookEvent re-runs processing on a stored inbound webhook event. The outcome is
+// recorded on the returned event.
+// POST /api/v1/admin/webhook-events/{id}/replay
+func (h *EmailHandler) ReplayWebhookEvent(w http.ResponseWriter, r *http.Request) {
+	eventID, err := uuid.Parse(chi.URLParam(r, "id"))
+	if err != nil {
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusBadRequest)
+		json.NewEncoder(w).Encode(ErrorResponse{Error: "invalid webhook event ID"})
+		return
+	}
+
+	event, err := h.webhookService.ReplayEvent(eventID)
+	if err != nil {
+		w.Header().Set("Content-Type", "application/json")
+		switch err.Error() {
+		case "webhook event not found":
+			w.WriteHeader(http.StatusNotFound)
+		case "webhook event failed verification":
+			w.WriteHeader(http.StatusConflict)
+		default:
+			w.WriteHeader(http.StatusInternalServerError)
+		}
+		json.NewEncoder(w).Encode(ErrorResponse{Error: err.Error()})
+		return
+	}
 
-	// Compare signatures
-	return hmac.Equal([]byte(signature), []byte(expected))
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(event)
 }
 
 // Simple test endpoint for testing without Mailgun
@@ -154,6 +159,9 @@ func (h *EmailHandler) TestInboundEmail(w http.ResponseWriter, r *http.Request)
 		From       string `json:"from"`
 		Subject    string `json:"subject"`
 		Body       string `json:"body"`
+		BodyHTML   string `json:"bodyHtml"`
+		InReplyTo  string `json:"inReplyTo"`
+		References string `json:"references"`
 	}
 
 	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
@@ -164,8 +172,8 @@ func (h *EmailHandler) TestInboundEmail(w http.ResponseWriter, r *http.Request)
 	}
 
 	// Look up user
-	var user models.User
-	if err := h.db.Where("inbox_email = ?", req.InboxEmail).First(&user).Error; err != nil {
+	user, threadID, err := h.emailService.ResolveInboundRecipient(req.InboxEmail)
+	if err != nil {
 		w.Header().Set("Content-Type", "application/json")
 		w.WriteHeader(http.StatusNotFound)
 		json.NewEncoder(w).Encode(ErrorResponse{Error: "user not found"})
@@ -173,7 +181,16 @@ func (h *EmailHandler) TestInboundEmail(w http.ResponseWriter, r *http.Request)
 	}
 
 	// Process email
-	message, err := h.emailService.ProcessInboundEmail(user.ID, req.From, req.Subject, req.Body, "test-"+strconv.FormatInt(time.Now().Unix(), 10))
+	message, err := h.emailService.ProcessInboundEmail(user.ID, threadID, &inbound.Email{
+		Recipient:  req.InboxEmail,
+		From:       req.From,
+		Subject:    req.Subject,
+		TextBody:   req.Body,
+		HTMLBody:   req.BodyHTML,
+		MessageID:  "test-" + strconv.FormatInt(time.Now().Unix(), 10),
+		InReplyTo:  req.InReplyTo,
+		References: req.References,
+	})
 	if err != nil {
 		w.Header().Set("Content-Type", "application/json")
 		w.WriteHeader(http.StatusInternalServerError)
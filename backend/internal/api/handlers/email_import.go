@@ -0,0 +1,138 @@
+package handlers
+
+import (
+	"encoding/json"
+	"errors"
+	"io"
+	"log"
+	"net/http"
+
+	"carbuyer/internal/api/middleware"
+	"carbuyer/internal/inbound"
+	"carbuyer/internal/services"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/google/uuid"
+)
+
+type EmailImportHandler struct {
+	importService      *services.EmailImportService
+	maxUploadBytes     int64
+	maxAttachmentBytes int64
+}
+
+func NewEmailImportHandler(importService *services.EmailImportService, maxUploadBytes, maxAttachmentBytes int64) *EmailImportHandler {
+	return &EmailImportHandler{
+		importService:      importService,
+		maxUploadBytes:     maxUploadBytes,
+		maxAttachmentBytes: maxAttachmentBytes,
+	}
+}
+
+// ImportEmails imports earlier dealer emails from uploaded .eml files or mbox archives, sent as
+// multipart "files" fields. Under /threads/{id} every email goes to that thread; otherwise
+// emails are matched to threads, starting new ones as needed.
+// POST /api/v1/import/emails
+// POST /api/v1/threads/{id}/import
+func (h *EmailImportHandler) ImportEmails(w http.ResponseWriter, r *http.Request) {
+	userID, ok := middleware.GetUserIDFromContext(r.Context())
+	if !ok {
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusUnauthorized)
+		json.NewEncoder(w).Encode(ErrorResponse{Error: "unauthorized"})
+		return
+	}
+
+	var threadID *uuid.UUID
+	if threadIDStr := chi.URLParam(r, "id"); threadIDStr != "" {
+		parsed, err := uuid.Parse(threadIDStr)
+		if err != nil {
+			w.Header().Set("Content-Type", "application/json")
+			w.WriteHeader(http.StatusBadRequest)
+			json.NewEncoder(w).Encode(ErrorResponse{Error: "invalid thread ID"})
+			return
+		}
+		threadID = &parsed
+	}
+
+	// Stream the parts rather than buffering the whole upload - mbox archives can be large
+	r.Body = http.MaxBytesReader(w, r.Body, h.maxUploadBytes)
+	reader, err := r.MultipartReader()
+	if err != nil {
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusBadRequest)
+		json.NewEncoder(w).Encode(ErrorResponse{Error: "expected a multipart upload"})
+		return
+	}
+
+	var emails []*inbound.Email
+	skipped := 0
+	var fileErrors []string
+	for {
+		part, err := reader.NextPart()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			var tooLarge *http.MaxBytesError
+			w.Header().Set("Content-Type", "application/json")
+			if errors.As(err, &tooLarge) {
+				w.WriteHeader(http.StatusRequestEntityTooLarge)
+				json.NewEncoder(w).Encode(ErrorResponse{Error: "upload too large"})
+			} else {
+				w.WriteHeader(http.StatusBadRequest)
+				json.NewEncoder(w).Encode(ErrorResponse{Error: "invalid multipart upload"})
+			}
+			return
+		}
+		if part.FormName() != "files" || part.FileName() == "" {
+			part.Close()
+			continue
+		}
+
+		parsed, unparseable, err := inbound.ParseArchive(part, h.maxAttachmentBytes)
+		part.Close()
+		if err != nil {
+			var tooLarge *http.MaxBytesError
+			if errors.As(err, &tooLarge) {
+				w.Header().Set("Content-Type", "application/json")
+				w.WriteHeader(http.StatusRequestEntityTooLarge)
+				json.NewEncoder(w).Encode(ErrorResponse{Error: "upload too large"})
+				return
+			}
+			fileErrors = append(fileErrors, part.FileName()+": "+err.Error())
+			continue
+		}
+		emails = append(emails, parsed...)
+		skipped += unparseable
+	}
+
+	if len(emails) == 0 && len(fileErrors) == 0 {
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusBadRequest)
+		json.NewEncoder(w).Encode(ErrorResponse{Error: "no .eml or mbox files uploaded"})
+		return
+	}
+
+	result, err := h.importService.Import(userID, threadID, emails)
+	if err != nil {
+		w.Header().Set("Content-Type", "application/json")
+		if err.Error() == "thread not found" {
+			w.WriteHeader(http.StatusNotFound)
+		} else {
+			log.Printf("Failed to import emails: %v", err)
+			w.WriteHeader(http.StatusInternalServerError)
+		}
+		json.NewEncoder(w).Encode(ErrorResponse{Error: err.Error()})
+		return
+	}
+	result.Skipped += skipped
+	result.Errors = append(fileErrors, result.Errors...)
+
+	log.Printf("Imported emails for user %s: %d imported, %d duplicates, %d skipped, %d errors",
+		userID, result.Imported, result.Duplicates, result.Skipped, len(result.Errors))
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(result)
+}
@@ -0,0 +1,216 @@
+package handlers
+
+import (
+	"encoding/json"
+	"net/http"
+
+	"carbuyer/internal/api/middleware"
+	"carbuyer/internal/db/models"
+	"carbuyer/internal/services"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/google/uuid"
+)
+
+type ExtractionHandler struct {
+	extractionService *services.DocumentExtractionService
+}
+
+func NewExtractionHandler(extractionService *services.DocumentExtractionService) *ExtractionHandler {
+	return &ExtractionHandler{
+		extractionService: extractionService,
+	}
+}
+
+// ExtractionResponse represents a document extraction in API responses
+type ExtractionResponse struct {
+	ID           string                   `json:"id"`
+	MessageID    string                   `json:"messageId"`
+	AttachmentID string                   `json:"attachmentId"`
+	Status       string                   `json:"status"`
+	Method       string                   `json:"method,omitempty"`
+	DocumentType string                   `json:"documentType,omitempty"`
+	LineItems    []services.QuoteLineItem `json:"lineItems"`
+	VehiclePrice *float64                 `json:"vehiclePrice,omitempty"`
+	DealerAddOns *float64                 `json:"dealerAddOns,omitempty"`
+	DocFee       *float64                 `json:"docFee,omitempty"`
+	Taxes        *float64                 `json:"taxes,omitempty"`
+	Registration *float64                 `json:"registration,omitempty"`
+	Rebates      *float64                 `json:"rebates,omitempty"`
+	OutTheDoor   *float64                 `json:"outTheDoor,omitempty"`
+	Error        string                   `json:"error,omitempty"`
+	OfferID      *string                  `json:"offerId,omitempty"`
+	CreatedAt    string                   `json:"createdAt"`
+
+	OutTheDoorComputed bool `json:"outTheDoorComputed,omitempty"` // Summed from the components - the document didn't state it
+}
+
+// newExtractionResponse converts an extraction to its API representation
+func newExtractionResponse(extraction *models.DocumentExtraction) ExtractionResponse {
+	response := ExtractionResponse{
+		ID:           extraction.ID.String(),
+		MessageID:    extraction.MessageID.String(),
+		AttachmentID: extraction.AttachmentID.String(),
+		Status:       string(extraction.Status),
+		Method:       string(extraction.Method),
+		DocumentType: extraction.DocumentType,
+		LineItems:    []services.QuoteLineItem{},
+		VehiclePrice: extraction.VehiclePrice,
+		DealerAddOns: extraction.DealerAddOns,
+		DocFee:       extraction.DocFee,
+		Taxes:        extraction.Taxes,
+		Registration: extraction.Registration,
+		Rebates:      extraction.Rebates,
+		OutTheDoor:   extraction.OutTheDoor,
+		Error:        extraction.Error,
+		CreatedAt:    extraction.CreatedAt.Format("2006-01-02T15:04:05Z"),
+
+		OutTheDoorComputed: extraction.OutTheDoorComputed,
+	}
+
+	if extraction.LineItems != nil {
+		json.Unmarshal([]byte(*extraction.LineItems), &response.LineItems)
+	}
+
+	if extraction.OfferID != nil {
+		offerID := extraction.OfferID.String()
+		response.OfferID = &offerID
+	}
+
+	return response
+}
+
+// ExtractAttachment runs (or re-runs) line item extraction on an attachment
+// POST /api/v1/attachments/{id}/extract
+func (h *ExtractionHandler) ExtractAttachment(w http.ResponseWriter, r *http.Request) {
+	userID, ok := middleware.GetUserIDFromContext(r.Context())
+	if !ok {
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusUnauthorized)
+		json.NewEncoder(w).Encode(ErrorResponse{Error: "unauthorized"})
+		return
+	}
+
+	attachmentID, err := uuid.Parse(chi.URLParam(r, "id"))
+	if err != nil {
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusBadRequest)
+		json.NewEncoder(w).Encode(ErrorResponse{Error: "invalid attachment ID"})
+		return
+	}
+
+	extraction, err := h.extractionService.ExtractAttachment(attachmentID, userID)
+	if err != nil {
+		w.Header().Set("Content-Type", "application/json")
+		switch err.Error() {
+		case "attachment not found":
+			w.WriteHeader(http.StatusNotFound)
+		case "attachment type cannot be extracted":
+			w.WriteHeader(http.StatusUnprocessableEntity)
+		case "extraction has already been promoted to an offer":
+			w.WriteHeader(http.StatusConflict)
+		default:
+			w.WriteHeader(llmErrorStatus(err, http.StatusInternalServerError))
+		}
+		json.NewEncoder(w).Encode(ErrorResponse{Error: err.Error()})
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(newExtractionResponse(extraction))
+}
+
+// GetMessageExtractions lists the line item extractions for a message's attachments
+// GET /api/v1/messages/{messageId}/extractions
+func (h *ExtractionHandler) GetMessageExtractions(w http.ResponseWriter, r *http.Request) {
+	userID, ok := middleware.GetUserIDFromContext(r.Context())
+	if !ok {
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusUnauthorized)
+		json.NewEncoder(w).Encode(ErrorResponse{Error: "unauthorized"})
+		return
+	}
+
+	messageID, err := uuid.Parse(chi.URLParam(r, "messageId"))
+	if err != nil {
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusBadRequest)
+		json.NewEncoder(w).Encode(ErrorResponse{Error: "invalid message ID"})
+		return
+	}
+
+	extractions, err := h.extractionService.GetMessageExtractions(messageID, userID)
+	if err != nil {
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusInternalServerError)
+		json.NewEncoder(w).Encode(ErrorResponse{Error: err.Error()})
+		return
+	}
+
+	response := make([]ExtractionResponse, len(extractions))
+	for i := range extractions {
+		response[i] = newExtractionResponse(&extractions[i])
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(struct {
+		Extractions []ExtractionResponse `json:"extractions"`
+	}{
+		Extractions: response,
+	})
+}
+
+// PromoteToOffer turns a confirmed extraction into a tracked offer on the message's thread
+// POST /api/v1/extractions/{id}/promote
+func (h *ExtractionHandler) PromoteToOffer(w http.ResponseWriter, r *http.Request) {
+	userID, ok := middleware.GetUserIDFromContext(r.Context())
+	if !ok {
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusUnauthorized)
+		json.NewEncoder(w).Encode(ErrorResponse{Error: "unauthorized"})
+		return
+	}
+
+	extractionID, err := uuid.Parse(chi.URLParam(r, "id"))
+	if err != nil {
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusBadRequest)
+		json.NewEncoder(w).Encode(ErrorResponse{Error: "invalid extraction ID"})
+		return
+	}
+
+	offer, err := h.extractionService.PromoteToOffer(extractionID, userID)
+	if err != nil {
+		w.Header().Set("Content-Type", "application/json")
+		switch err.Error() {
+		case "extraction not found":
+			w.WriteHeader(http.StatusNotFound)
+		case "extraction has already been promoted to an offer":
+			w.WriteHeader(http.StatusConflict)
+		case "extraction is not completed", "assign the message to a thread before tracking its offer", "extraction has no prices to track":
+			w.WriteHeader(http.StatusBadRequest)
+		default:
+			w.WriteHeader(http.StatusInternalServerError)
+		}
+		json.NewEncoder(w).Encode(ErrorResponse{Error: err.Error()})
+		return
+	}
+
+	response := OfferResponse{
+		ID:        offer.ID.String(),
+		ThreadID:  offer.ThreadID.String(),
+		OfferText: offer.OfferText,
+		TrackedAt: offer.TrackedAt.Format("2006-01-02T15:04:05Z"),
+	}
+
+	if offer.MessageID != nil {
+		msgID := offer.MessageID.String()
+		response.MessageID = &msgID
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(response)
+}
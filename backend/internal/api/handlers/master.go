@@ -0,0 +1,148 @@
+package handlers
+
+import (
+	"encoding/json"
+	"net/http"
+	"strconv"
+
+	"carbuyer/internal/api/middleware"
+	"carbuyer/internal/services"
+)
+
+type MasterHandler struct {
+	masterService *services.MasterAgentService
+}
+
+func NewMasterHandler(masterService *services.MasterAgentService) *MasterHandler {
+	return &MasterHandler{
+		masterService: masterService,
+	}
+}
+
+// MasterMessageRequest is the user's message to the master agent
+type MasterMessageRequest struct {
+	Content string `json:"content"`
+}
+
+// MasterReplyResponse represents the master agent's reply in API responses, with the drafts
+// it saved in seller threads
+type MasterReplyResponse struct {
+	UserMessage  MessageResponse   `json:"userMessage"`
+	AgentMessage *MessageResponse  `json:"agentMessage,omitempty"`
+	Drafts       []MessageResponse `json:"drafts"`
+	Error        string            `json:"error,omitempty"` // Why the agent didn't answer; the user's message is still saved
+}
+
+// GetConversation returns the user's master thread and its messages, oldest first
+// GET /api/v1/master
+func (h *MasterHandler) GetConversation(w http.ResponseWriter, r *http.Request) {
+	userID, ok := middleware.GetUserIDFromContext(r.Context())
+	if !ok {
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusUnauthorized)
+		json.NewEncoder(w).Encode(ErrorResponse{Error: "unauthorized"})
+		return
+	}
+
+	limit := 50
+	offset := 0
+	if l, err := strconv.Atoi(r.URL.Query().Get("limit")); err == nil && l > 0 && l <= 100 {
+		limit = l
+	}
+	if o, err := strconv.Atoi(r.URL.Query().Get("offset")); err == nil && o >= 0 {
+		offset = o
+	}
+
+	thread, messages, total, err := h.masterService.GetMessages(userID, limit, offset)
+	if err != nil {
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusInternalServerError)
+		json.NewEncoder(w).Encode(ErrorResponse{Error: err.Error()})
+		return
+	}
+
+	var response struct {
+		Thread   ThreadResponse    `json:"thread"`
+		Messages []MessageResponse `json:"messages"`
+		Total    int64             `json:"total"`
+		HasMore  bool              `json:"hasMore"`
+	}
+
+	response.Thread = ThreadResponse{
+		ID:           thread.ID.String(),
+		SellerName:   thread.SellerName,
+		SellerType:   string(thread.SellerType),
+		CreatedAt:    thread.CreatedAt.Format("2006-01-02T15:04:05Z"),
+		MessageCount: thread.MessageCount,
+	}
+	if thread.LastMessageAt != nil {
+		lastMsg := thread.LastMessageAt.Format("2006-01-02T15:04:05Z")
+		response.Thread.LastMessageAt = &lastMsg
+	}
+
+	response.Messages = make([]MessageResponse, len(messages))
+	for i, msg := range messages {
+		response.Messages[i] = newMessageResponse(msg)
+	}
+	response.Total = total
+	response.HasMore = int64(offset+len(messages)) < total
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(response)
+}
+
+// SendMessage sends the user's message to the master agent and returns its reply. When the
+// agent fails after the user's message was saved, the saved message comes back with the error.
+// POST /api/v1/master/messages
+func (h *MasterHandler) SendMessage(w http.ResponseWriter, r *http.Request) {
+	userID, ok := middleware.GetUserIDFromContext(r.Context())
+	if !ok {
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusUnauthorized)
+		json.NewEncoder(w).Encode(ErrorResponse{Error: "unauthorized"})
+		return
+	}
+
+	var req MasterMessageRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusBadRequest)
+		json.NewEncoder(w).Encode(ErrorResponse{Error: "invalid request body"})
+		return
+	}
+
+	reply, err := h.masterService.SendMessage(r.Context(), userID, req.Content)
+	if err != nil && (reply == nil || reply.UserMessage == nil) {
+		w.Header().Set("Content-Type", "application/json")
+		if err.Error() == "message content is required" {
+			w.WriteHeader(http.StatusBadRequest)
+		} else {
+			w.WriteHeader(http.StatusInternalServerError)
+		}
+		json.NewEncoder(w).Encode(ErrorResponse{Error: err.Error()})
+		return
+	}
+
+	response := MasterReplyResponse{
+		UserMessage: newMessageResponse(*reply.UserMessage),
+		Drafts:      make([]MessageResponse, len(reply.Drafts)),
+	}
+	if reply.AgentMessage != nil {
+		agentResponse := newMessageResponse(*reply.AgentMessage)
+		response.AgentMessage = &agentResponse
+	}
+	for i, draft := range reply.Drafts {
+		response.Drafts[i] = newMessageResponse(draft)
+	}
+
+	status := http.StatusCreated
+	if err != nil {
+		response.Error = err.Error()
+		status = llmErrorStatus(err, http.StatusBadGateway)
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(response)
+}
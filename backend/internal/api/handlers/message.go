@@ -2,11 +2,14 @@ package handlers
 
 import (
 	"encoding/json"
+	"fmt"
+	"log"
 	"net/http"
 	"strconv"
 	"strings"
 
 	"carbuyer/internal/api/middleware"
+	"carbuyer/internal/db/models"
 	"carbuyer/internal/services"
 
 	"github.com/go-chi/chi/v5"
@@ -14,33 +17,101 @@ import (
 )
 
 type MessageHandler struct {
-	messageService *services.MessageService
-	emailService   *services.EmailService
+	messageService   *services.MessageService
+	emailService     *services.EmailService
+	autopilotService *services.AutopilotService
+	guardrails       *services.DraftGuardrailService
 }
 
-func NewMessageHandler(messageService *services.MessageService, emailService *services.EmailService) *MessageHandler {
+func NewMessageHandler(messageService *services.MessageService, emailService *services.EmailService, autopilotService *services.AutopilotService, guardrails *services.DraftGuardrailService) *MessageHandler {
 	return &MessageHandler{
-		messageService: messageService,
-		emailService:   emailService,
+		messageService:   messageService,
+		emailService:     emailService,
+		autopilotService: autopilotService,
+		guardrails:       guardrails,
 	}
 }
 
 // MessageRequest represents the request to send a message
 type MessageRequest struct {
-	Content string `json:"content"`
-	Sender  string `json:"sender"` // "user" or "seller" (for testing)
+	Content  string `json:"content"`
+	Sender   string `json:"sender"`             // "user" or "seller" (for testing)
+	Variants int    `json:"variants,omitempty"` // Ranked drafts the agent offers, up to 4; 0 or 1 for a single reply
+}
+
+// RegenerateRequest asks for a new agent reply to the user's last message
+type RegenerateRequest struct {
+	Variants int `json:"variants,omitempty"`
+}
+
+// DraftVariantResponse represents one of an agent message's draft variants in API responses
+type DraftVariantResponse struct {
+	ID        string `json:"id"`
+	Rank      int    `json:"rank"` // 1 is the agent's recommendation
+	Style     string `json:"style"`
+	Rationale string `json:"rationale"`
+	Content   string `json:"content"`
+	Chosen    bool   `json:"chosen"` // Shown in the message
 }
 
 // MessageResponse represents a message in API responses
 type MessageResponse struct {
-	ID                string `json:"id"`
-	ThreadID          string `json:"threadId"`
-	Sender            string `json:"sender"`
-	Content           string `json:"content"`
-	Timestamp         string `json:"timestamp"`
-	ExternalMessageID string `json:"externalMessageId,omitempty"`
-	SenderEmail       string `json:"senderEmail,omitempty"`
-	Subject           string `json:"subject,omitempty"`
+	ID                string                 `json:"id"`
+	ThreadID          string                 `json:"threadId"`
+	Sender            string                 `json:"sender"`
+	Content           string                 `json:"content"`
+	RawContent        string                 `json:"rawContent,omitempty"`
+	Timestamp         string                 `json:"timestamp"`
+	ExternalMessageID string                 `json:"externalMessageId,omitempty"`
+	SenderEmail       string                 `json:"senderEmail,omitempty"`
+	Subject           string                 `json:"subject,omitempty"`
+	RecipientEmail    string                 `json:"recipientEmail,omitempty"`
+	DeliveryStatus    string                 `json:"deliveryStatus,omitempty"` // Outbound email: sent, deferred, delivered, bounced or complained
+	DeliveryError     string                 `json:"deliveryError,omitempty"`
+	Channel           string                 `json:"channel,omitempty"` // "sms" for texts, empty for email and in-app messages
+	SenderPhone       string                 `json:"senderPhone,omitempty"`
+	RecipientPhone    string                 `json:"recipientPhone,omitempty"`
+	PromptTemplateID  string                 `json:"promptTemplateId,omitempty"` // Agent messages: the prompt template version that produced it
+	PromptVersion     int                    `json:"promptVersion,omitempty"`
+	Attachments       []AttachmentResponse   `json:"attachments,omitempty"`
+	Variants          []DraftVariantResponse `json:"variants,omitempty"` // Agent messages generated with draft variants, best first
+}
+
+// newMessageResponse converts a thread message to its API representation
+func newMessageResponse(msg models.Message) MessageResponse {
+	response := MessageResponse{
+		ID:                msg.ID.String(),
+		ThreadID:          msg.ThreadID.String(),
+		Sender:            string(msg.Sender),
+		Content:           msg.Content,
+		RawContent:        msg.RawContent,
+		Timestamp:         msg.Timestamp.Format("2006-01-02T15:04:05Z"),
+		ExternalMessageID: msg.ExternalMessageID,
+		SenderEmail:       msg.SenderEmail,
+		Subject:           msg.Subject,
+		RecipientEmail:    msg.RecipientEmail,
+		DeliveryStatus:    string(msg.DeliveryStatus),
+		DeliveryError:     msg.DeliveryError,
+		Channel:           string(msg.Channel),
+		SenderPhone:       msg.SenderPhone,
+		RecipientPhone:    msg.RecipientPhone,
+		PromptVersion:     msg.PromptVersion,
+		Attachments:       newAttachmentResponses(msg.Attachments),
+	}
+	if msg.PromptTemplateID != nil {
+		response.PromptTemplateID = msg.PromptTemplateID.String()
+	}
+	for _, variant := range msg.Variants {
+		response.Variants = append(response.Variants, DraftVariantResponse{
+			ID:        variant.ID.String(),
+			Rank:      variant.Rank,
+			Style:     variant.Style,
+			Rationale: variant.Rationale,
+			Content:   variant.Content,
+			Chosen:    variant.Chosen,
+		})
+	}
+	return response
 }
 
 // GetMessages retrieves messages for a thread
@@ -101,16 +172,7 @@ func (h *MessageHandler) GetMessages(w http.ResponseWriter, r *http.Request) {
 
 	response.Messages = make([]MessageResponse, len(messages))
 	for i, msg := range messages {
-		response.Messages[i] = MessageResponse{
-			ID:                msg.ID.String(),
-			ThreadID:          msg.ThreadID.String(),
-			Sender:            string(msg.Sender),
-			Content:           msg.Content,
-			Timestamp:         msg.Timestamp.Format("2006-01-02T15:04:05Z"),
-			ExternalMessageID: msg.ExternalMessageID,
-			SenderEmail:       msg.SenderEmail,
-			Subject:           msg.Subject,
-		}
+		response.Messages[i] = newMessageResponse(msg)
 	}
 
 	response.Total = total
@@ -158,6 +220,7 @@ func (h *MessageHandler) CreateMessage(w http.ResponseWriter, r *http.Request) {
 			json.NewEncoder(w).Encode(ErrorResponse{Error: err.Error()})
 			return
 		}
+		h.autopilotService.RespondAsync(sellerMsg.ID)
 
 		w.Header().Set("Content-Type", "application/json")
 		w.WriteHeader(http.StatusCreated)
@@ -179,10 +242,10 @@ func (h *MessageHandler) CreateMessage(w http.ResponseWriter, r *http.Request) {
 	}
 
 	// Default: create user message + agent response
-	userMsg, agentMsg, err := h.messageService.CreateUserMessage(threadID, userID, req.Content)
+	userMsg, agentMsg, err := h.messageService.CreateUserMessage(threadID, userID, req.Content, req.Variants)
 	if err != nil {
 		w.Header().Set("Content-Type", "application/json")
-		w.WriteHeader(http.StatusBadRequest)
+		w.WriteHeader(llmErrorStatus(err, http.StatusBadRequest))
 		json.NewEncoder(w).Encode(ErrorResponse{Error: err.Error()})
 		return
 	}
@@ -204,16 +267,8 @@ func (h *MessageHandler) CreateMessage(w http.ResponseWriter, r *http.Request) {
 	}
 
 	if agentMsg != nil {
-		response.AgentMessage = &MessageResponse{
-			ID:                agentMsg.ID.String(),
-			ThreadID:          agentMsg.ThreadID.String(),
-			Sender:            string(agentMsg.Sender),
-			Content:           agentMsg.Content,
-			Timestamp:         agentMsg.Timestamp.Format("2006-01-02T15:04:05Z"),
-			ExternalMessageID: agentMsg.ExternalMessageID,
-			SenderEmail:       agentMsg.SenderEmail,
-			Subject:           agentMsg.Subject,
-		}
+		agentResponse := newMessageResponse(*agentMsg)
+		response.AgentMessage = &agentResponse
 	}
 
 	w.Header().Set("Content-Type", "application/json")
@@ -221,6 +276,90 @@ func (h *MessageHandler) CreateMessage(w http.ResponseWriter, r *http.Request) {
 	json.NewEncoder(w).Encode(response)
 }
 
+// CreateMessageStream creates a user message and streams the agent's response as Server-Sent
+// Events: "user_message" with the saved user message, "delta" with each piece of response text,
+// then "agent_message" with the saved agent message (whose content is authoritative) or "error".
+// Closing the connection cancels generation.
+// POST /api/v1/threads/{id}/messages/stream
+func (h *MessageHandler) CreateMessageStream(w http.ResponseWriter, r *http.Request) {
+	userID, ok := middleware.GetUserIDFromContext(r.Context())
+	if !ok {
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusUnauthorized)
+		json.NewEncoder(w).Encode(ErrorResponse{Error: "unauthorized"})
+		return
+	}
+
+	threadID, err := uuid.Parse(chi.URLParam(r, "id"))
+	if err != nil {
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusBadRequest)
+		json.NewEncoder(w).Encode(ErrorResponse{Error: "invalid thread ID"})
+		return
+	}
+
+	var req MessageRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusBadRequest)
+		json.NewEncoder(w).Encode(ErrorResponse{Error: "invalid request body"})
+		return
+	}
+
+	flusher, ok := w.(http.Flusher)
+	if !ok {
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusInternalServerError)
+		json.NewEncoder(w).Encode(ErrorResponse{Error: "streaming not supported"})
+		return
+	}
+
+	// Headers are sent with the first event, so errors before it can still use a status code
+	started := false
+	send := func(event string, data interface{}) {
+		if !started {
+			w.Header().Set("Content-Type", "text/event-stream")
+			w.Header().Set("Cache-Control", "no-cache")
+			w.Header().Set("Connection", "keep-alive")
+			w.Header().Set("X-Accel-Buffering", "no") // Stop proxies buffering the stream
+			w.WriteHeader(http.StatusOK)
+			started = true
+		}
+		payload, _ := json.Marshal(data)
+		fmt.Fprintf(w, "event: %s\ndata: %s\n\n", event, payload)
+		flusher.Flush()
+	}
+
+	_, agentMsg, err := h.messageService.StreamUserMessage(r.Context(), threadID, userID, req.Content,
+		func(userMsg *models.Message) {
+			send("user_message", newMessageResponse(*userMsg))
+		},
+		func(text string) {
+			send("delta", map[string]string{"text": text})
+		},
+	)
+	if err != nil {
+		if r.Context().Err() != nil {
+			log.Printf("Agent response stream for thread %s cancelled by client", threadID)
+			return
+		}
+		if !started {
+			w.Header().Set("Content-Type", "application/json")
+			if err.Error() == "thread not found" {
+				w.WriteHeader(http.StatusNotFound)
+			} else {
+				w.WriteHeader(llmErrorStatus(err, http.StatusBadRequest))
+			}
+			json.NewEncoder(w).Encode(ErrorResponse{Error: err.Error()})
+			return
+		}
+		send("error", ErrorResponse{Error: err.Error()})
+		return
+	}
+
+	send("agent_message", newMessageResponse(*agentMsg))
+}
+
 // GetInboxMessages retrieves inbox messages (messages with no thread)
 func (h *MessageHandler) GetInboxMessages(w http.ResponseWriter, r *http.Request) {
 	userID, ok := middleware.GetUserIDFromContext(r.Context())
@@ -250,46 +389,44 @@ func (h *MessageHandler) GetInboxMessages(w http.ResponseWriter, r *http.Request
 		}
 	}
 
-	messages, total, err := h.messageService.GetInboxMessages(userID, limit, offset)
+	// Human replies by default; "filtered", "all" or a single category otherwise
+	view := r.URL.Query().Get("category")
+
+	messages, total, err := h.messageService.GetInboxMessages(userID, view, limit, offset)
 	if err != nil {
 		w.Header().Set("Content-Type", "application/json")
-		w.WriteHeader(http.StatusInternalServerError)
+		if err.Error() == "invalid inbox category" {
+			w.WriteHeader(http.StatusBadRequest)
+		} else {
+			w.WriteHeader(http.StatusInternalServerError)
+		}
 		json.NewEncoder(w).Encode(ErrorResponse{Error: err.Error()})
 		return
 	}
 
-	// InboxMessageResponse includes additional fields for inbox messages
-	type InboxMessageResponse struct {
-		ID                string `json:"id"`
-		Sender            string `json:"sender"`
-		SenderEmail       string `json:"senderEmail"`
-		Subject           string `json:"subject"`
-		Content           string `json:"content"`
-		Timestamp         string `json:"timestamp"`
-		ExternalMessageID string `json:"externalMessageId,omitempty"`
+	filteredCount, err := h.messageService.CountFilteredInboxMessages(userID)
+	if err != nil {
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusInternalServerError)
+		json.NewEncoder(w).Encode(ErrorResponse{Error: err.Error()})
+		return
 	}
 
 	var response struct {
-		Messages []InboxMessageResponse `json:"messages"`
-		Total    int64                  `json:"total"`
-		HasMore  bool                   `json:"hasMore"`
+		Messages      []InboxMessageResponse `json:"messages"`
+		Total         int64                  `json:"total"`
+		HasMore       bool                   `json:"hasMore"`
+		FilteredCount int64                  `json:"filteredCount"`
 	}
 
 	response.Messages = make([]InboxMessageResponse, len(messages))
 	for i, msg := range messages {
-		response.Messages[i] = InboxMessageResponse{
-			ID:                msg.ID.String(),
-			Sender:            string(msg.Sender),
-			SenderEmail:       msg.SenderEmail,
-			Subject:           msg.Subject,
-			Content:           msg.Content,
-			Timestamp:         msg.Timestamp.Format("2006-01-02T15:04:05Z"),
-			ExternalMessageID: msg.ExternalMessageID,
-		}
+		response.Messages[i] = newInboxMessageResponse(msg)
 	}
 
 	response.Total = total
 	response.HasMore = int64(offset+len(messages)) < total
+	response.FilteredCount = filteredCount
 
 	w.Header().Set("Content-Type", "application/json")
 	w.WriteHeader(http.StatusOK)
@@ -344,6 +481,9 @@ func (h *MessageHandler) AssignInboxMessageToThread(w http.ResponseWriter, r *ht
 		return
 	}
 
+	// The message may be a seller reply the thread's autopilot should answer
+	h.autopilotService.RespondAsync(messageID)
+
 	w.Header().Set("Content-Type", "application/json")
 	w.WriteHeader(http.StatusOK)
 	json.NewEncoder(w).Encode(map[string]string{"message": "assigned successfully"})
@@ -384,6 +524,60 @@ func (h *MessageHandler) ArchiveInboxMessage(w http.ResponseWriter, r *http.Requ
 	json.NewEncoder(w).Encode(map[string]string{"message": "archived successfully"})
 }
 
+// SetMessageCategory corrects the category of an inbound message
+// PUT /api/v1/messages/{messageId}/category
+func (h *MessageHandler) SetMessageCategory(w http.ResponseWriter, r *http.Request) {
+	userID, ok := middleware.GetUserIDFromContext(r.Context())
+	if !ok {
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusUnauthorized)
+		json.NewEncoder(w).Encode(ErrorResponse{Error: "unauthorized"})
+		return
+	}
+
+	messageID, err := uuid.Parse(chi.URLParam(r, "messageId"))
+	if err != nil {
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusBadRequest)
+		json.NewEncoder(w).Encode(ErrorResponse{Error: "invalid message ID"})
+		return
+	}
+
+	var req struct {
+		Category string `json:"category"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusBadRequest)
+		json.NewEncoder(w).Encode(ErrorResponse{Error: "invalid request body"})
+		return
+	}
+
+	category, ok := services.ParseMessageCategory(req.Category)
+	if !ok {
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusBadRequest)
+		json.NewEncoder(w).Encode(ErrorResponse{Error: "category must be human, auto_reply, marketing or spam"})
+		return
+	}
+
+	message, err := h.messageService.SetMessageCategory(messageID, userID, category)
+	if err != nil {
+		w.Header().Set("Content-Type", "application/json")
+		if err.Error() == "message not found" {
+			w.WriteHeader(http.StatusNotFound)
+		} else {
+			w.WriteHeader(http.StatusInternalServerError)
+		}
+		json.NewEncoder(w).Encode(ErrorResponse{Error: err.Error()})
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(newInboxMessageResponse(*message))
+}
+
 // ReplyViaGmail sends an email reply via user's connected Gmail
 // POST /api/v1/messages/{messageId}/reply-via-gmail
 func (h *MessageHandler) ReplyViaGmail(w http.ResponseWriter, r *http.Request) {
@@ -405,7 +599,8 @@ func (h *MessageHandler) ReplyViaGmail(w http.ResponseWriter, r *http.Request) {
 	}
 
 	var req struct {
-		Content string `json:"content"`
+		Content             string `json:"content"`
+		AcknowledgeWarnings bool   `json:"acknowledgeWarnings"` // Send despite draft warnings that don't block sending
 	}
 	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
 		w.Header().Set("Content-Type", "application/json")
@@ -421,6 +616,20 @@ func (h *MessageHandler) ReplyViaGmail(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	if err := h.guardrails.EnforceReply(r.Context(), userID, messageID, req.Content, req.AcknowledgeWarnings); err != nil {
+		if writeDraftBlocked(w, err) {
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		if err.Error() == "message not found" || err.Error() == "thread not found" {
+			w.WriteHeader(http.StatusNotFound)
+		} else {
+			w.WriteHeader(llmErrorStatus(err, http.StatusInternalServerError))
+		}
+		json.NewEncoder(w).Encode(ErrorResponse{Error: err.Error()})
+		return
+	}
+
 	// Send reply via Gmail
 	if err := h.emailService.ReplyViaGmail(userID, messageID, req.Content); err != nil {
 		w.Header().Set("Content-Type", "application/json")
@@ -429,6 +638,8 @@ func (h *MessageHandler) ReplyViaGmail(w http.ResponseWriter, r *http.Request) {
 			w.WriteHeader(http.StatusNotFound)
 		} else if errMsg == "message was not received via email" {
 			w.WriteHeader(http.StatusBadRequest)
+		} else if errMsg == "recipient email address is suppressed" {
+			w.WriteHeader(http.StatusConflict)
 		} else if strings.Contains(errMsg, "gmail not connected") {
 			w.WriteHeader(http.StatusBadRequest)
 			json.NewEncoder(w).Encode(ErrorResponse{Error: "gmail not connected"})
@@ -490,6 +701,8 @@ func (h *MessageHandler) CreateDraftViaGmail(w http.ResponseWriter, r *http.Requ
 			w.WriteHeader(http.StatusNotFound)
 		} else if errMsg == "message was not received via email" {
 			w.WriteHeader(http.StatusBadRequest)
+		} else if errMsg == "recipient email address is suppressed" {
+			w.WriteHeader(http.StatusConflict)
 		} else if strings.Contains(errMsg, "gmail not connected") {
 			w.WriteHeader(http.StatusBadRequest)
 			json.NewEncoder(w).Encode(ErrorResponse{Error: "gmail not connected"})
@@ -505,3 +718,141 @@ func (h *MessageHandler) CreateDraftViaGmail(w http.ResponseWriter, r *http.Requ
 	w.WriteHeader(http.StatusOK)
 	json.NewEncoder(w).Encode(map[string]string{"message": "draft created successfully"})
 }
+
+// RegenerateReply replaces the agent's reply to the user's last message with a new one,
+// optionally as several ranked draft variants
+// POST /api/v1/threads/{id}/messages/regenerate
+func (h *MessageHandler) RegenerateReply(w http.ResponseWriter, r *http.Request) {
+	userID, ok := middleware.GetUserIDFromContext(r.Context())
+	if !ok {
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusUnauthorized)
+		json.NewEncoder(w).Encode(ErrorResponse{Error: "unauthorized"})
+		return
+	}
+
+	threadID, err := uuid.Parse(chi.URLParam(r, "id"))
+	if err != nil {
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusBadRequest)
+		json.NewEncoder(w).Encode(ErrorResponse{Error: "invalid thread ID"})
+		return
+	}
+
+	// The body is optional
+	var req RegenerateRequest
+	if r.ContentLength != 0 {
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			w.Header().Set("Content-Type", "application/json")
+			w.WriteHeader(http.StatusBadRequest)
+			json.NewEncoder(w).Encode(ErrorResponse{Error: "invalid request body"})
+			return
+		}
+	}
+
+	agentMsg, err := h.messageService.RegenerateReply(r.Context(), threadID, userID, req.Variants)
+	if err != nil {
+		writeDraftError(w, err)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(struct {
+		AgentMessage MessageResponse `json:"agentMessage"`
+	}{
+		AgentMessage: newMessageResponse(*agentMsg),
+	})
+}
+
+// ChooseDraftVariant shows one of an agent message's draft variants in the message
+// POST /api/v1/messages/{messageId}/variants/{variantId}/choose
+func (h *MessageHandler) ChooseDraftVariant(w http.ResponseWriter, r *http.Request) {
+	userID, ok := middleware.GetUserIDFromContext(r.Context())
+	if !ok {
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusUnauthorized)
+		json.NewEncoder(w).Encode(ErrorResponse{Error: "unauthorized"})
+		return
+	}
+
+	messageID, err := uuid.Parse(chi.URLParam(r, "messageId"))
+	if err != nil {
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusBadRequest)
+		json.NewEncoder(w).Encode(ErrorResponse{Error: "invalid message ID"})
+		return
+	}
+	variantID, err := uuid.Parse(chi.URLParam(r, "variantId"))
+	if err != nil {
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusBadRequest)
+		json.NewEncoder(w).Encode(ErrorResponse{Error: "invalid draft variant ID"})
+		return
+	}
+
+	message, err := h.messageService.ChooseDraftVariant(messageID, variantID, userID)
+	if err != nil {
+		writeDraftError(w, err)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(newMessageResponse(*message))
+}
+
+// EditDraft replaces an agent message's draft with the user's edit
+// PUT /api/v1/messages/{messageId}
+func (h *MessageHandler) EditDraft(w http.ResponseWriter, r *http.Request) {
+	userID, ok := middleware.GetUserIDFromContext(r.Context())
+	if !ok {
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusUnauthorized)
+		json.NewEncoder(w).Encode(ErrorResponse{Error: "unauthorized"})
+		return
+	}
+
+	messageID, err := uuid.Parse(chi.URLParam(r, "messageId"))
+	if err != nil {
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusBadRequest)
+		json.NewEncoder(w).Encode(ErrorResponse{Error: "invalid message ID"})
+		return
+	}
+
+	var req struct {
+		Content string `json:"content"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusBadRequest)
+		json.NewEncoder(w).Encode(ErrorResponse{Error: "invalid request body"})
+		return
+	}
+
+	message, err := h.messageService.EditDraft(messageID, userID, req.Content)
+	if err != nil {
+		writeDraftError(w, err)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(newMessageResponse(*message))
+}
+
+func writeDraftError(w http.ResponseWriter, err error) {
+	w.Header().Set("Content-Type", "application/json")
+	switch {
+	case err.Error() == "thread not found", err.Error() == "message not found", err.Error() == "draft variant not found":
+		w.WriteHeader(http.StatusNotFound)
+	case err.Error() == "the last message isn't the agent's reply to your message":
+		w.WriteHeader(http.StatusConflict)
+	case err.Error() == "message content is required", strings.HasPrefix(err.Error(), "variants must be"):
+		w.WriteHeader(http.StatusBadRequest)
+	default:
+		w.WriteHeader(llmErrorStatus(err, http.StatusInternalServerError))
+	}
+	json.NewEncoder(w).Encode(ErrorResponse{Error: err.Error()})
+}
@@ -2,44 +2,150 @@ package handlers
 
 import (
 	"encoding/json"
+	"log"
 	"net/http"
+	"strings"
 	"time"
 
 	"carbuyer/internal/api/middleware"
 	"carbuyer/internal/db"
 	"carbuyer/internal/db/models"
+	"carbuyer/internal/services"
 
 	"github.com/go-chi/chi/v5"
 	"github.com/google/uuid"
 )
 
 type OfferHandler struct {
-	db *db.Database
+	db              *db.Database
+	offerExtraction *services.OfferExtractionService
 }
 
-func NewOfferHandler(database *db.Database) *OfferHandler {
+func NewOfferHandler(database *db.Database, offerExtraction *services.OfferExtractionService) *OfferHandler {
 	return &OfferHandler{
-		db: database,
+		db:              database,
+		offerExtraction: offerExtraction,
 	}
 }
 
-// CreateOfferRequest represents the request to create a tracked offer
+// CreateOfferRequest represents the request to create a tracked offer. Either offerText or
+// structured terms are required; without offerText it is written from the terms.
 type CreateOfferRequest struct {
-	OfferText string     `json:"offerText"`
-	MessageID *uuid.UUID `json:"messageId,omitempty"`
+	OfferText      string     `json:"offerText"`
+	MessageID      *uuid.UUID `json:"messageId,omitempty"`
+	Status         string     `json:"status,omitempty"` // Defaults to active
+	VehiclePrice   *float64   `json:"vehiclePrice,omitempty"`
+	DealerAddOns   *float64   `json:"dealerAddOns,omitempty"`
+	DocFee         *float64   `json:"docFee,omitempty"`
+	Taxes          *float64   `json:"taxes,omitempty"`
+	Registration   *float64   `json:"registration,omitempty"`
+	Rebates        *float64   `json:"rebates,omitempty"`
+	OutTheDoor     *float64   `json:"outTheDoor,omitempty"`
+	FinanceType    string     `json:"financeType,omitempty"`
+	APR            *float64   `json:"apr,omitempty"`
+	TermMonths     *int       `json:"termMonths,omitempty"`
+	MonthlyPayment *float64   `json:"monthlyPayment,omitempty"`
+	DueAtSigning   *float64   `json:"dueAtSigning,omitempty"`
+	AnnualMileage  *int       `json:"annualMileage,omitempty"`
+	VIN            string     `json:"vin,omitempty"`
+	StockNumber    string     `json:"stockNumber,omitempty"`
+	ExpiresAt      *time.Time `json:"expiresAt,omitempty"`
+}
+
+// UpdateOfferStatusRequest represents the request to move an offer through its lifecycle
+type UpdateOfferStatusRequest struct {
+	Status string `json:"status"`
 }
 
 // OfferResponse represents an offer in API responses
 type OfferResponse struct {
-	ID         string  `json:"id"`
-	ThreadID   string  `json:"threadId"`
-	MessageID  *string `json:"messageId,omitempty"`
-	OfferText  string  `json:"offerText"`
-	TrackedAt  string  `json:"trackedAt"`
+	ID           string          `json:"id"`
+	ThreadID     string          `json:"threadId"`
+	MessageID    *string         `json:"messageId,omitempty"`
+	OfferText    string          `json:"offerText"`
+	TrackedAt    string          `json:"trackedAt"`
+	ReviewStatus string          `json:"reviewStatus"`
+	Source       string          `json:"source"`
+	Details      json.RawMessage `json:"details,omitempty"`
+	Status       string          `json:"status"`
+
+	VehiclePrice   *float64 `json:"vehiclePrice,omitempty"`
+	DealerAddOns   *float64 `json:"dealerAddOns,omitempty"`
+	DocFee         *float64 `json:"docFee,omitempty"`
+	Taxes          *float64 `json:"taxes,omitempty"`
+	Registration   *float64 `json:"registration,omitempty"`
+	Rebates        *float64 `json:"rebates,omitempty"`
+	OutTheDoor     *float64 `json:"outTheDoor,omitempty"`
+	FinanceType    string   `json:"financeType,omitempty"`
+	APR            *float64 `json:"apr,omitempty"`
+	TermMonths     *int     `json:"termMonths,omitempty"`
+	MonthlyPayment *float64 `json:"monthlyPayment,omitempty"`
+	DueAtSigning   *float64 `json:"dueAtSigning,omitempty"`
+	AnnualMileage  *int     `json:"annualMileage,omitempty"`
+	VIN            string   `json:"vin,omitempty"`
+	StockNumber    string   `json:"stockNumber,omitempty"`
+	ExpiresAt      *string  `json:"expiresAt,omitempty"`
+
+	OutTheDoorComputed bool `json:"outTheDoorComputed,omitempty"` // Calculated from a document's price components
+
 	SellerName *string `json:"sellerName,omitempty"`
 	ThreadType *string `json:"threadType,omitempty"`
 }
 
+// newOfferResponse converts an offer, with its thread when loaded, to its API representation
+func newOfferResponse(offer models.TrackedOffer) OfferResponse {
+	response := OfferResponse{
+		ID:           offer.ID.String(),
+		ThreadID:     offer.ThreadID.String(),
+		OfferText:    offer.OfferText,
+		TrackedAt:    offer.TrackedAt.Format("2006-01-02T15:04:05Z"),
+		ReviewStatus: string(offer.ReviewStatus),
+		Source:       string(offer.Source),
+		Status:       string(offer.Status),
+
+		VehiclePrice:   offer.VehiclePrice,
+		DealerAddOns:   offer.DealerAddOns,
+		DocFee:         offer.DocFee,
+		Taxes:          offer.Taxes,
+		Registration:   offer.Registration,
+		Rebates:        offer.Rebates,
+		OutTheDoor:     offer.OutTheDoor,
+		FinanceType:    string(offer.FinanceType),
+		APR:            offer.APR,
+		TermMonths:     offer.TermMonths,
+		MonthlyPayment: offer.MonthlyPayment,
+		DueAtSigning:   offer.DueAtSigning,
+		AnnualMileage:  offer.AnnualMileage,
+		VIN:            offer.VIN,
+		StockNumber:    offer.StockNumber,
+
+		OutTheDoorComputed: offer.OutTheDoorComputed,
+	}
+
+	if offer.ExpiresAt != nil {
+		expiresAt := offer.ExpiresAt.UTC().Format("2006-01-02T15:04:05Z")
+		response.ExpiresAt = &expiresAt
+	}
+
+	if offer.MessageID != nil {
+		msgID := offer.MessageID.String()
+		response.MessageID = &msgID
+	}
+
+	if offer.Details != nil {
+		response.Details = json.RawMessage(*offer.Details)
+	}
+
+	// Include thread details if available
+	if offer.Thread != nil {
+		response.SellerName = &offer.Thread.SellerName
+		threadType := string(offer.Thread.SellerType)
+		response.ThreadType = &threadType
+	}
+
+	return response
+}
+
 // CreateOffer creates a new tracked offer for a thread
 func (h *OfferHandler) CreateOffer(w http.ResponseWriter, r *http.Request) {
 	userID, ok := middleware.GetUserIDFromContext(r.Context())
@@ -67,12 +173,61 @@ func (h *OfferHandler) CreateOffer(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	if req.OfferText == "" {
+	offer := models.TrackedOffer{
+		ThreadID:       threadID,
+		MessageID:      req.MessageID,
+		OfferText:      strings.TrimSpace(req.OfferText),
+		TrackedAt:      time.Now(),
+		ReviewStatus:   models.OfferReviewConfirmed,
+		Source:         models.OfferSourceManual,
+		Status:         models.OfferStatusActive,
+		VehiclePrice:   req.VehiclePrice,
+		DealerAddOns:   req.DealerAddOns,
+		DocFee:         req.DocFee,
+		Taxes:          req.Taxes,
+		Registration:   req.Registration,
+		Rebates:        req.Rebates,
+		OutTheDoor:     req.OutTheDoor,
+		APR:            req.APR,
+		TermMonths:     req.TermMonths,
+		MonthlyPayment: req.MonthlyPayment,
+		DueAtSigning:   req.DueAtSigning,
+		AnnualMileage:  req.AnnualMileage,
+		VIN:            services.NormalizeVIN(req.VIN),
+		StockNumber:    strings.TrimSpace(req.StockNumber),
+		ExpiresAt:      req.ExpiresAt,
+	}
+
+	if req.Status != "" {
+		status, ok := services.ParseOfferStatus(req.Status)
+		if !ok {
+			w.Header().Set("Content-Type", "application/json")
+			w.WriteHeader(http.StatusBadRequest)
+			json.NewEncoder(w).Encode(ErrorResponse{Error: "status must be active, expired, countered, accepted or declined"})
+			return
+		}
+		offer.Status = status
+	}
+	if req.FinanceType != "" {
+		financeType, ok := services.ParseFinanceType(req.FinanceType)
+		if !ok {
+			w.Header().Set("Content-Type", "application/json")
+			w.WriteHeader(http.StatusBadRequest)
+			json.NewEncoder(w).Encode(ErrorResponse{Error: "financeType must be cash, finance or lease"})
+			return
+		}
+		offer.FinanceType = financeType
+	}
+
+	if err := services.ValidateOffer(&offer); err != nil {
 		w.Header().Set("Content-Type", "application/json")
 		w.WriteHeader(http.StatusBadRequest)
-		json.NewEncoder(w).Encode(ErrorResponse{Error: "offerText is required"})
+		json.NewEncoder(w).Encode(ErrorResponse{Error: err.Error()})
 		return
 	}
+	if offer.OfferText == "" {
+		offer.OfferText = services.OfferSummary(&offer)
+	}
 
 	// Verify thread belongs to user
 	var thread models.Thread
@@ -83,12 +238,15 @@ func (h *OfferHandler) CreateOffer(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	// Create the offer
-	offer := models.TrackedOffer{
-		ThreadID:  threadID,
-		MessageID: req.MessageID,
-		OfferText: req.OfferText,
-		TrackedAt: time.Now(),
+	// An offer can only point at a message in its thread
+	if req.MessageID != nil {
+		var count int64
+		if err := h.db.DB.Model(&models.Message{}).Where("id = ? AND thread_id = ? AND user_id = ?", *req.MessageID, threadID, userID).Count(&count).Error; err != nil || count == 0 {
+			w.Header().Set("Content-Type", "application/json")
+			w.WriteHeader(http.StatusBadRequest)
+			json.NewEncoder(w).Encode(ErrorResponse{Error: "message not found in thread"})
+			return
+		}
 	}
 
 	if err := h.db.DB.Create(&offer).Error; err != nil {
@@ -98,25 +256,14 @@ func (h *OfferHandler) CreateOffer(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	// Build response
-	response := OfferResponse{
-		ID:        offer.ID.String(),
-		ThreadID:  offer.ThreadID.String(),
-		OfferText: offer.OfferText,
-		TrackedAt: offer.TrackedAt.Format("2006-01-02T15:04:05Z"),
-	}
-
-	if offer.MessageID != nil {
-		msgID := offer.MessageID.String()
-		response.MessageID = &msgID
-	}
-
 	w.Header().Set("Content-Type", "application/json")
 	w.WriteHeader(http.StatusCreated)
-	json.NewEncoder(w).Encode(response)
+	json.NewEncoder(w).Encode(newOfferResponse(offer))
 }
 
-// GetAllOffers retrieves all tracked offers for the authenticated user across all threads
+// GetAllOffers retrieves all tracked offers for the authenticated user across all threads.
+// Offers the user rejected are left out; ?review=pending lists only offers awaiting review and
+// ?status= filters by lifecycle status.
 func (h *OfferHandler) GetAllOffers(w http.ResponseWriter, r *http.Request) {
 	userID, ok := middleware.GetUserIDFromContext(r.Context())
 	if !ok {
@@ -126,12 +273,41 @@ func (h *OfferHandler) GetAllOffers(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	if err := services.ExpireOffers(h.db.DB, userID); err != nil {
+		log.Printf("Failed to expire offers: %v", err)
+	}
+
+	query := h.db.DB.
+		Joins("JOIN threads ON threads.id = tracked_offers.thread_id").
+		Where("threads.user_id = ?", userID)
+
+	if statusStr := r.URL.Query().Get("status"); statusStr != "" {
+		status, ok := services.ParseOfferStatus(statusStr)
+		if !ok {
+			w.Header().Set("Content-Type", "application/json")
+			w.WriteHeader(http.StatusBadRequest)
+			json.NewEncoder(w).Encode(ErrorResponse{Error: "status must be active, expired, countered, accepted or declined"})
+			return
+		}
+		query = query.Where("tracked_offers.status = ?", status)
+	}
+
+	switch review := r.URL.Query().Get("review"); review {
+	case "":
+		query = query.Where("tracked_offers.review_status <> ?", models.OfferReviewRejected)
+	case string(models.OfferReviewPending), string(models.OfferReviewConfirmed), string(models.OfferReviewRejected):
+		query = query.Where("tracked_offers.review_status = ?", review)
+	default:
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusBadRequest)
+		json.NewEncoder(w).Encode(ErrorResponse{Error: "review must be pending, confirmed or rejected"})
+		return
+	}
+
 	var offers []models.TrackedOffer
 
 	// Get all offers for user's threads, ordered by most recent first
-	err := h.db.DB.
-		Joins("JOIN threads ON threads.id = tracked_offers.thread_id").
-		Where("threads.user_id = ?", userID).
+	err := query.
 		Preload("Thread").
 		Order("tracked_offers.tracked_at DESC").
 		Find(&offers).Error
@@ -146,24 +322,7 @@ func (h *OfferHandler) GetAllOffers(w http.ResponseWriter, r *http.Request) {
 	// Build response with thread details
 	response := make([]OfferResponse, len(offers))
 	for i, offer := range offers {
-		response[i] = OfferResponse{
-			ID:        offer.ID.String(),
-			ThreadID:  offer.ThreadID.String(),
-			OfferText: offer.OfferText,
-			TrackedAt: offer.TrackedAt.Format("2006-01-02T15:04:05Z"),
-		}
-
-		if offer.MessageID != nil {
-			msgID := offer.MessageID.String()
-			response[i].MessageID = &msgID
-		}
-
-		// Include thread details if available
-		if offer.Thread != nil {
-			response[i].SellerName = &offer.Thread.SellerName
-			threadType := string(offer.Thread.SellerType)
-			response[i].ThreadType = &threadType
-		}
+		response[i] = newOfferResponse(offer)
 	}
 
 	w.Header().Set("Content-Type", "application/json")
@@ -224,3 +383,130 @@ func (h *OfferHandler) DeleteOffer(w http.ResponseWriter, r *http.Request) {
 		Message: "offer deleted successfully",
 	})
 }
+
+// ConfirmOffer confirms an offer detected in a seller message so it is tracked
+// POST /api/v1/offers/{id}/confirm
+func (h *OfferHandler) ConfirmOffer(w http.ResponseWriter, r *http.Request) {
+	h.reviewOffer(w, r, true)
+}
+
+// RejectOffer marks an offer detected in a seller message as not an offer
+// POST /api/v1/offers/{id}/reject
+func (h *OfferHandler) RejectOffer(w http.ResponseWriter, r *http.Request) {
+	h.reviewOffer(w, r, false)
+}
+
+// reviewOffer confirms or rejects a pending offer
+func (h *OfferHandler) reviewOffer(w http.ResponseWriter, r *http.Request, confirm bool) {
+	userID, ok := middleware.GetUserIDFromContext(r.Context())
+	if !ok {
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusUnauthorized)
+		json.NewEncoder(w).Encode(ErrorResponse{Error: "unauthorized"})
+		return
+	}
+
+	offerID, err := uuid.Parse(chi.URLParam(r, "id"))
+	if err != nil {
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusBadRequest)
+		json.NewEncoder(w).Encode(ErrorResponse{Error: "invalid offer ID"})
+		return
+	}
+
+	offer, err := h.offerExtraction.ReviewOffer(offerID, userID, confirm)
+	if err != nil {
+		w.Header().Set("Content-Type", "application/json")
+		switch err.Error() {
+		case "offer not found":
+			w.WriteHeader(http.StatusNotFound)
+		case "offer is not pending review":
+			w.WriteHeader(http.StatusConflict)
+		default:
+			log.Printf("Failed to review offer: %v", err)
+			w.WriteHeader(http.StatusInternalServerError)
+		}
+		json.NewEncoder(w).Encode(ErrorResponse{Error: err.Error()})
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(newOfferResponse(*offer))
+}
+
+// UpdateOfferStatus moves an offer through its lifecycle: active, countered, accepted,
+// declined or expired
+// PUT /api/v1/offers/{id}/status
+func (h *OfferHandler) UpdateOfferStatus(w http.ResponseWriter, r *http.Request) {
+	userID, ok := middleware.GetUserIDFromContext(r.Context())
+	if !ok {
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusUnauthorized)
+		json.NewEncoder(w).Encode(ErrorResponse{Error: "unauthorized"})
+		return
+	}
+
+	offerID, err := uuid.Parse(chi.URLParam(r, "id"))
+	if err != nil {
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusBadRequest)
+		json.NewEncoder(w).Encode(ErrorResponse{Error: "invalid offer ID"})
+		return
+	}
+
+	var req UpdateOfferStatusRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusBadRequest)
+		json.NewEncoder(w).Encode(ErrorResponse{Error: "invalid request body"})
+		return
+	}
+	status, ok := services.ParseOfferStatus(req.Status)
+	if !ok {
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusBadRequest)
+		json.NewEncoder(w).Encode(ErrorResponse{Error: "status must be active, expired, countered, accepted or declined"})
+		return
+	}
+
+	var offer models.TrackedOffer
+	err = h.db.DB.
+		Joins("JOIN threads ON threads.id = tracked_offers.thread_id").
+		Where("tracked_offers.id = ? AND threads.user_id = ?", offerID, userID).
+		Preload("Thread").
+		First(&offer).Error
+	if err != nil {
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusNotFound)
+		json.NewEncoder(w).Encode(ErrorResponse{Error: "offer not found"})
+		return
+	}
+
+	// Detected offers are confirmed before they can be acted on
+	if offer.ReviewStatus != models.OfferReviewConfirmed {
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusConflict)
+		json.NewEncoder(w).Encode(ErrorResponse{Error: "confirm the offer before changing its status"})
+		return
+	}
+	// An expired offer can't be reactivated or accepted while its expiration is past
+	if offer.ExpiresAt != nil && offer.ExpiresAt.Before(time.Now()) && (status == models.OfferStatusActive || status == models.OfferStatusAccepted) {
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusConflict)
+		json.NewEncoder(w).Encode(ErrorResponse{Error: "offer has expired"})
+		return
+	}
+
+	if err := h.db.DB.Model(&offer).Update("status", status).Error; err != nil {
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusInternalServerError)
+		json.NewEncoder(w).Encode(ErrorResponse{Error: "failed to update offer"})
+		return
+	}
+	offer.Status = status
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(newOfferResponse(offer))
+}
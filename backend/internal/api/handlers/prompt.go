@@ -0,0 +1,196 @@
+package handlers
+
+import (
+	"encoding/json"
+	"net/http"
+	"strings"
+
+	"carbuyer/internal/db/models"
+	"carbuyer/internal/services"
+
+	"github.com/go-chi/chi/v5"
+)
+
+type PromptHandler struct {
+	promptService *services.PromptTemplateService
+}
+
+func NewPromptHandler(promptService *services.PromptTemplateService) *PromptHandler {
+	return &PromptHandler{
+		promptService: promptService,
+	}
+}
+
+// PromptTemplateResponse represents a prompt template version in API responses
+type PromptTemplateResponse struct {
+	ID        string `json:"id"`
+	Purpose   string `json:"purpose"`
+	Version   int    `json:"version"`
+	Body      string `json:"body"`
+	Notes     string `json:"notes,omitempty"`
+	CreatedAt string `json:"createdAt"`
+}
+
+// PromptDeploymentResponse represents which versions a purpose uses in API responses
+type PromptDeploymentResponse struct {
+	Purpose       string                         `json:"purpose"`
+	ActiveVersion int                            `json:"activeVersion"`
+	Experiment    []services.PromptExperimentArm `json:"experiment"`
+}
+
+// PromptTemplatesResponse lists a purpose's versions, newest first, with its deployment and
+// the variables its templates can use
+type PromptTemplatesResponse struct {
+	Templates  []PromptTemplateResponse `json:"templates"`
+	Deployment PromptDeploymentResponse `json:"deployment"`
+	Variables  []string                 `json:"variables"`
+}
+
+// CreatePromptTemplateRequest saves a new version of a purpose's template
+type CreatePromptTemplateRequest struct {
+	Body  string `json:"body"`
+	Notes string `json:"notes"`
+}
+
+// ActivatePromptRequest sets the version a purpose uses outside experiments
+type ActivatePromptRequest struct {
+	Version int `json:"version"`
+}
+
+// PromptExperimentRequest splits a purpose's users between versions. An empty list ends the
+// experiment.
+type PromptExperimentRequest struct {
+	Arms []services.PromptExperimentArm `json:"arms"`
+}
+
+func newPromptTemplateResponse(template *models.PromptTemplate) PromptTemplateResponse {
+	return PromptTemplateResponse{
+		ID:        template.ID.String(),
+		Purpose:   string(template.Purpose),
+		Version:   template.Version,
+		Body:      template.Body,
+		Notes:     template.Notes,
+		CreatedAt: template.CreatedAt.Format("2006-01-02T15:04:05Z"),
+	}
+}
+
+func newPromptDeploymentResponse(purpose models.LLMPurpose, deployment *models.PromptDeployment) PromptDeploymentResponse {
+	response := PromptDeploymentResponse{
+		Purpose:       string(purpose),
+		ActiveVersion: deployment.ActiveVersion,
+		Experiment:    []services.PromptExperimentArm{},
+	}
+	if deployment.Experiment != nil {
+		json.Unmarshal([]byte(*deployment.Experiment), &response.Experiment)
+	}
+	return response
+}
+
+// ListTemplates returns a purpose's template versions and which of them are in use
+func (h *PromptHandler) ListTemplates(w http.ResponseWriter, r *http.Request) {
+	purpose := models.LLMPurpose(chi.URLParam(r, "purpose"))
+
+	templates, deployment, err := h.promptService.ListTemplates(purpose)
+	if err != nil {
+		writePromptError(w, err)
+		return
+	}
+
+	response := PromptTemplatesResponse{
+		Templates:  make([]PromptTemplateResponse, 0, len(templates)),
+		Deployment: newPromptDeploymentResponse(purpose, deployment),
+		Variables:  services.PromptVariables(purpose),
+	}
+	for i := range templates {
+		response.Templates = append(response.Templates, newPromptTemplateResponse(&templates[i]))
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(response)
+}
+
+// CreateTemplate saves a new version of a purpose's template
+func (h *PromptHandler) CreateTemplate(w http.ResponseWriter, r *http.Request) {
+	purpose := models.LLMPurpose(chi.URLParam(r, "purpose"))
+
+	var req CreatePromptTemplateRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusBadRequest)
+		json.NewEncoder(w).Encode(ErrorResponse{Error: "invalid request body"})
+		return
+	}
+
+	template, err := h.promptService.CreateTemplate(purpose, req.Body, req.Notes)
+	if err != nil {
+		writePromptError(w, err)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(newPromptTemplateResponse(template))
+}
+
+// Activate sets the version a purpose uses outside experiments
+func (h *PromptHandler) Activate(w http.ResponseWriter, r *http.Request) {
+	purpose := models.LLMPurpose(chi.URLParam(r, "purpose"))
+
+	var req ActivatePromptRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusBadRequest)
+		json.NewEncoder(w).Encode(ErrorResponse{Error: "invalid request body"})
+		return
+	}
+
+	deployment, err := h.promptService.Activate(purpose, req.Version)
+	if err != nil {
+		writePromptError(w, err)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(newPromptDeploymentResponse(purpose, deployment))
+}
+
+// SetExperiment starts, changes or ends a purpose's experiment
+func (h *PromptHandler) SetExperiment(w http.ResponseWriter, r *http.Request) {
+	purpose := models.LLMPurpose(chi.URLParam(r, "purpose"))
+
+	var req PromptExperimentRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusBadRequest)
+		json.NewEncoder(w).Encode(ErrorResponse{Error: "invalid request body"})
+		return
+	}
+
+	deployment, err := h.promptService.SetExperiment(purpose, req.Arms)
+	if err != nil {
+		writePromptError(w, err)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(newPromptDeploymentResponse(purpose, deployment))
+}
+
+// writePromptError writes a prompt template service error with a matching status code
+func writePromptError(w http.ResponseWriter, err error) {
+	w.Header().Set("Content-Type", "application/json")
+	switch {
+	case err.Error() == "unknown prompt purpose", err.Error() == "prompt template not found":
+		w.WriteHeader(http.StatusNotFound)
+	case strings.HasPrefix(err.Error(), "invalid template"),
+		strings.HasPrefix(err.Error(), "an experiment can have at most"),
+		err.Error() == "experiment weights must be positive":
+		w.WriteHeader(http.StatusBadRequest)
+	default:
+		w.WriteHeader(http.StatusInternalServerError)
+	}
+	json.NewEncoder(w).Encode(ErrorResponse{Error: err.Error()})
+}
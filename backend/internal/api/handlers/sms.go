@@ -0,0 +1,259 @@
+package handlers
+
+import (
+	"encoding/json"
+	"log"
+	"net/http"
+
+	"carbuyer/internal/api/middleware"
+	"carbuyer/internal/db/models"
+	"carbuyer/internal/services"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/google/uuid"
+)
+
+// maxSMSWebhookBytes caps an inbound SMS webhook body
+const maxSMSWebhookBytes = 64 << 10 // 64KB
+
+// emptyTwiML acknowledges an inbound text without replying to it
+const emptyTwiML = `<?xml version="1.0" encoding="UTF-8"?><Response></Response>`
+
+type SMSHandler struct {
+	smsService       *services.SMSService
+	autopilotService *services.AutopilotService
+	guardrails       *services.DraftGuardrailService
+}
+
+func NewSMSHandler(smsService *services.SMSService, autopilotService *services.AutopilotService, guardrails *services.DraftGuardrailService) *SMSHandler {
+	return &SMSHandler{
+		smsService:       smsService,
+		autopilotService: autopilotService,
+		guardrails:       guardrails,
+	}
+}
+
+// SMSNumberResponse represents a user's provisioned number in API responses
+type SMSNumberResponse struct {
+	Number    string `json:"number"`
+	Provider  string `json:"provider"`
+	CreatedAt string `json:"createdAt"`
+}
+
+// GetNumber returns the user's provisioned number
+// GET /api/v1/sms/number
+func (h *SMSHandler) GetNumber(w http.ResponseWriter, r *http.Request) {
+	userID, ok := middleware.GetUserIDFromContext(r.Context())
+	if !ok {
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusUnauthorized)
+		json.NewEncoder(w).Encode(ErrorResponse{Error: "unauthorized"})
+		return
+	}
+
+	number, err := h.smsService.GetNumber(userID)
+	if err != nil {
+		w.Header().Set("Content-Type", "application/json")
+		if err.Error() == "sms number not found" {
+			w.WriteHeader(http.StatusNotFound)
+		} else {
+			w.WriteHeader(http.StatusInternalServerError)
+		}
+		json.NewEncoder(w).Encode(ErrorResponse{Error: err.Error()})
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(SMSNumberResponse{
+		Number:    number.Number,
+		Provider:  number.Provider,
+		CreatedAt: number.CreatedAt.Format("2006-01-02T15:04:05Z"),
+	})
+}
+
+// ProvisionNumber buys a number for the user so dealers can text them
+// POST /api/v1/sms/number
+func (h *SMSHandler) ProvisionNumber(w http.ResponseWriter, r *http.Request) {
+	userID, ok := middleware.GetUserIDFromContext(r.Context())
+	if !ok {
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusUnauthorized)
+		json.NewEncoder(w).Encode(ErrorResponse{Error: "unauthorized"})
+		return
+	}
+
+	var req struct {
+		AreaCode string `json:"areaCode"`
+	}
+	if r.ContentLength > 0 {
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			w.Header().Set("Content-Type", "application/json")
+			w.WriteHeader(http.StatusBadRequest)
+			json.NewEncoder(w).Encode(ErrorResponse{Error: "invalid request body"})
+			return
+		}
+	}
+
+	number, err := h.smsService.ProvisionNumber(r.Context(), userID, req.AreaCode)
+	if err != nil {
+		w.Header().Set("Content-Type", "application/json")
+		switch err.Error() {
+		case "sms number already provisioned":
+			w.WriteHeader(http.StatusConflict)
+		case "area code must be 3 digits":
+			w.WriteHeader(http.StatusBadRequest)
+		case "no unused sms number available":
+			w.WriteHeader(http.StatusServiceUnavailable)
+		default:
+			log.Printf("Failed to provision sms number: %v", err)
+			w.WriteHeader(http.StatusBadGateway)
+		}
+		json.NewEncoder(w).Encode(ErrorResponse{Error: err.Error()})
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(SMSNumberResponse{
+		Number:    number.Number,
+		Provider:  number.Provider,
+		CreatedAt: number.CreatedAt.Format("2006-01-02T15:04:05Z"),
+	})
+}
+
+// ReleaseNumber gives the user's number back to the provider
+// DELETE /api/v1/sms/number
+func (h *SMSHandler) ReleaseNumber(w http.ResponseWriter, r *http.Request) {
+	userID, ok := middleware.GetUserIDFromContext(r.Context())
+	if !ok {
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusUnauthorized)
+		json.NewEncoder(w).Encode(ErrorResponse{Error: "unauthorized"})
+		return
+	}
+
+	if err := h.smsService.ReleaseNumber(r.Context(), userID); err != nil {
+		w.Header().Set("Content-Type", "application/json")
+		if err.Error() == "sms number not found" {
+			w.WriteHeader(http.StatusNotFound)
+		} else {
+			log.Printf("Failed to release sms number: %v", err)
+			w.WriteHeader(http.StatusBadGateway)
+		}
+		json.NewEncoder(w).Encode(ErrorResponse{Error: err.Error()})
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// SendDraft texts an agent draft to the thread's dealer
+// POST /api/v1/messages/{messageId}/send-sms
+func (h *SMSHandler) SendDraft(w http.ResponseWriter, r *http.Request) {
+	userID, ok := middleware.GetUserIDFromContext(r.Context())
+	if !ok {
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusUnauthorized)
+		json.NewEncoder(w).Encode(ErrorResponse{Error: "unauthorized"})
+		return
+	}
+
+	messageID, err := uuid.Parse(chi.URLParam(r, "messageId"))
+	if err != nil {
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusBadRequest)
+		json.NewEncoder(w).Encode(ErrorResponse{Error: "invalid message ID"})
+		return
+	}
+
+	// Content is optional - the draft is sent as is without it
+	var req struct {
+		Content             string `json:"content"`
+		AcknowledgeWarnings bool   `json:"acknowledgeWarnings"` // Send despite draft warnings that don't block sending
+	}
+	if r.ContentLength > 0 {
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			w.Header().Set("Content-Type", "application/json")
+			w.WriteHeader(http.StatusBadRequest)
+			json.NewEncoder(w).Encode(ErrorResponse{Error: "invalid request body"})
+			return
+		}
+	}
+
+	// The draft has to pass the guardrails before it's texted
+	var sent *models.Message
+	err = h.guardrails.EnforceReply(r.Context(), userID, messageID, req.Content, req.AcknowledgeWarnings)
+	if err == nil {
+		sent, err = h.smsService.SendDraft(r.Context(), userID, messageID, req.Content)
+	}
+	if err != nil {
+		if writeDraftBlocked(w, err) {
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		switch err.Error() {
+		case "message not found", "thread not found":
+			w.WriteHeader(http.StatusNotFound)
+		case "message is not an agent draft", "no phone number for this dealer", "sms number not found":
+			w.WriteHeader(http.StatusBadRequest)
+		case "recipient has opted out of texts":
+			w.WriteHeader(http.StatusConflict)
+		default:
+			log.Printf("Failed to send sms: %v", err)
+			w.WriteHeader(llmErrorStatus(err, http.StatusBadGateway))
+		}
+		json.NewEncoder(w).Encode(ErrorResponse{Error: err.Error()})
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(newMessageResponse(*sent))
+}
+
+// InboundSMS receives texts sent to our numbers. The provider comes from the URL
+// (/webhooks/sms/{provider}) and must be the configured one.
+// POST /api/v1/webhooks/sms/{provider}
+func (h *SMSHandler) InboundSMS(w http.ResponseWriter, r *http.Request) {
+	provider := h.smsService.Provider()
+	if chi.URLParam(r, "provider") != provider.Name() {
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusNotFound)
+		json.NewEncoder(w).Encode(ErrorResponse{Error: "unknown sms provider"})
+		return
+	}
+
+	r.Body = http.MaxBytesReader(w, r.Body, maxSMSWebhookBytes)
+	if err := provider.Verify(r); err != nil {
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusUnauthorized)
+		json.NewEncoder(w).Encode(ErrorResponse{Error: "unauthorized"})
+		return
+	}
+
+	in, err := provider.Parse(r)
+	if err != nil {
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusBadRequest)
+		json.NewEncoder(w).Encode(ErrorResponse{Error: err.Error()})
+		return
+	}
+
+	message, err := h.smsService.ProcessInbound(in)
+	if err != nil {
+		// The provider retries on 5xx
+		log.Printf("Failed to process inbound sms from %s: %v", in.From, err)
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusInternalServerError)
+		json.NewEncoder(w).Encode(ErrorResponse{Error: "failed to process sms"})
+		return
+	}
+	if message != nil {
+		h.autopilotService.RespondAsync(message.ID)
+	}
+
+	w.Header().Set("Content-Type", "text/xml")
+	w.WriteHeader(http.StatusOK)
+	w.Write([]byte(emptyTwiML))
+}
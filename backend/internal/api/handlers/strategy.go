@@ -0,0 +1,279 @@
+package handlers
+
+import (
+	"encoding/json"
+	"net/http"
+	"strings"
+
+	"carbuyer/internal/api/middleware"
+	"carbuyer/internal/db/models"
+	"carbuyer/internal/services"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/google/uuid"
+)
+
+type StrategyHandler struct {
+	strategyService *services.StrategyService
+}
+
+func NewStrategyHandler(strategyService *services.StrategyService) *StrategyHandler {
+	return &StrategyHandler{
+		strategyService: strategyService,
+	}
+}
+
+// StrategyProfileRequest creates or updates a custom strategy profile
+type StrategyProfileRequest struct {
+	Name            string `json:"name"`
+	Description     string `json:"description"`
+	PromptFragment  string `json:"promptFragment"`
+	OpeningTemplate string `json:"openingTemplate"`
+	EscalationRules string `json:"escalationRules"` // One rule per line
+}
+
+// StrategyProfileResponse represents a strategy profile in API responses
+type StrategyProfileResponse struct {
+	ID              string `json:"id"`
+	Key             string `json:"key,omitempty"` // Built-in profiles only
+	Builtin         bool   `json:"builtin"`
+	Name            string `json:"name"`
+	Description     string `json:"description,omitempty"`
+	PromptFragment  string `json:"promptFragment"`
+	OpeningTemplate string `json:"openingTemplate,omitempty"`
+	EscalationRules string `json:"escalationRules,omitempty"`
+	UpdatedAt       string `json:"updatedAt"`
+}
+
+// ThreadStrategyRequest sets a thread's strategy profile. A null profile goes back to the
+// default approach.
+type ThreadStrategyRequest struct {
+	ProfileID *string `json:"profileId"`
+}
+
+func newStrategyProfileResponse(profile *models.StrategyProfile) StrategyProfileResponse {
+	return StrategyProfileResponse{
+		ID:              profile.ID.String(),
+		Key:             profile.Key,
+		Builtin:         profile.Builtin(),
+		Name:            profile.Name,
+		Description:     profile.Description,
+		PromptFragment:  profile.PromptFragment,
+		OpeningTemplate: profile.OpeningTemplate,
+		EscalationRules: profile.EscalationRules,
+		UpdatedAt:       profile.UpdatedAt.Format("2006-01-02T15:04:05Z"),
+	}
+}
+
+// ListProfiles returns the built-in strategy profiles and the user's own
+// GET /api/v1/strategies
+func (h *StrategyHandler) ListProfiles(w http.ResponseWriter, r *http.Request) {
+	userID, ok := middleware.GetUserIDFromContext(r.Context())
+	if !ok {
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusUnauthorized)
+		json.NewEncoder(w).Encode(ErrorResponse{Error: "unauthorized"})
+		return
+	}
+
+	profiles, err := h.strategyService.ListProfiles(userID)
+	if err != nil {
+		writeStrategyError(w, err)
+		return
+	}
+
+	response := struct {
+		Profiles []StrategyProfileResponse `json:"profiles"`
+	}{
+		Profiles: make([]StrategyProfileResponse, len(profiles)),
+	}
+	for i := range profiles {
+		response.Profiles[i] = newStrategyProfileResponse(&profiles[i])
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(response)
+}
+
+// CreateProfile saves a custom strategy profile
+// POST /api/v1/strategies
+func (h *StrategyHandler) CreateProfile(w http.ResponseWriter, r *http.Request) {
+	userID, ok := middleware.GetUserIDFromContext(r.Context())
+	if !ok {
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusUnauthorized)
+		json.NewEncoder(w).Encode(ErrorResponse{Error: "unauthorized"})
+		return
+	}
+
+	var req StrategyProfileRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusBadRequest)
+		json.NewEncoder(w).Encode(ErrorResponse{Error: "invalid request body"})
+		return
+	}
+
+	profile, err := h.strategyService.CreateProfile(userID, services.StrategyProfileRequest(req))
+	if err != nil {
+		writeStrategyError(w, err)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(newStrategyProfileResponse(profile))
+}
+
+// UpdateProfile replaces a custom strategy profile
+// PUT /api/v1/strategies/{id}
+func (h *StrategyHandler) UpdateProfile(w http.ResponseWriter, r *http.Request) {
+	userID, ok := middleware.GetUserIDFromContext(r.Context())
+	if !ok {
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusUnauthorized)
+		json.NewEncoder(w).Encode(ErrorResponse{Error: "unauthorized"})
+		return
+	}
+
+	profileID, err := uuid.Parse(chi.URLParam(r, "id"))
+	if err != nil {
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusBadRequest)
+		json.NewEncoder(w).Encode(ErrorResponse{Error: "invalid strategy profile ID"})
+		return
+	}
+
+	var req StrategyProfileRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusBadRequest)
+		json.NewEncoder(w).Encode(ErrorResponse{Error: "invalid request body"})
+		return
+	}
+
+	profile, err := h.strategyService.UpdateProfile(userID, profileID, services.StrategyProfileRequest(req))
+	if err != nil {
+		writeStrategyError(w, err)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(newStrategyProfileResponse(profile))
+}
+
+// DeleteProfile deletes a custom strategy profile. Threads using it go back to the default
+// approach.
+// DELETE /api/v1/strategies/{id}
+func (h *StrategyHandler) DeleteProfile(w http.ResponseWriter, r *http.Request) {
+	userID, ok := middleware.GetUserIDFromContext(r.Context())
+	if !ok {
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusUnauthorized)
+		json.NewEncoder(w).Encode(ErrorResponse{Error: "unauthorized"})
+		return
+	}
+
+	profileID, err := uuid.Parse(chi.URLParam(r, "id"))
+	if err != nil {
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusBadRequest)
+		json.NewEncoder(w).Encode(ErrorResponse{Error: "invalid strategy profile ID"})
+		return
+	}
+
+	if err := h.strategyService.DeleteProfile(userID, profileID); err != nil {
+		writeStrategyError(w, err)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(struct {
+		Message string `json:"message"`
+	}{
+		Message: "strategy profile deleted successfully",
+	})
+}
+
+// SetThreadStrategy sets the strategy profile a thread's agent follows
+// PUT /api/v1/threads/{id}/strategy
+func (h *StrategyHandler) SetThreadStrategy(w http.ResponseWriter, r *http.Request) {
+	userID, ok := middleware.GetUserIDFromContext(r.Context())
+	if !ok {
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusUnauthorized)
+		json.NewEncoder(w).Encode(ErrorResponse{Error: "unauthorized"})
+		return
+	}
+
+	threadID, err := uuid.Parse(chi.URLParam(r, "id"))
+	if err != nil {
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusBadRequest)
+		json.NewEncoder(w).Encode(ErrorResponse{Error: "invalid thread ID"})
+		return
+	}
+
+	var req ThreadStrategyRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusBadRequest)
+		json.NewEncoder(w).Encode(ErrorResponse{Error: "invalid request body"})
+		return
+	}
+
+	var profileID *uuid.UUID
+	if req.ProfileID != nil && *req.ProfileID != "" {
+		id, err := uuid.Parse(*req.ProfileID)
+		if err != nil {
+			w.Header().Set("Content-Type", "application/json")
+			w.WriteHeader(http.StatusBadRequest)
+			json.NewEncoder(w).Encode(ErrorResponse{Error: "invalid strategy profile ID"})
+			return
+		}
+		profileID = &id
+	}
+
+	thread, err := h.strategyService.SetThreadStrategy(userID, threadID, profileID)
+	if err != nil {
+		writeStrategyError(w, err)
+		return
+	}
+
+	var response struct {
+		ThreadID string                   `json:"threadId"`
+		Strategy *StrategyProfileResponse `json:"strategy"` // Null for the default approach
+	}
+	response.ThreadID = thread.ID.String()
+	if thread.Strategy != nil {
+		profile := newStrategyProfileResponse(thread.Strategy)
+		response.Strategy = &profile
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(response)
+}
+
+func writeStrategyError(w http.ResponseWriter, err error) {
+	w.Header().Set("Content-Type", "application/json")
+	switch {
+	case err.Error() == "strategy profile not found", err.Error() == "thread not found":
+		w.WriteHeader(http.StatusNotFound)
+	case err.Error() == "built-in strategy profiles can't be changed":
+		w.WriteHeader(http.StatusForbidden)
+	case err.Error() == "name is required",
+		err.Error() == "prompt fragment is required",
+		strings.HasPrefix(err.Error(), "name must be at most"),
+		strings.HasPrefix(err.Error(), "each field must be at most"),
+		strings.HasPrefix(err.Error(), "invalid opening template"),
+		strings.HasPrefix(err.Error(), "you can have at most"):
+		w.WriteHeader(http.StatusBadRequest)
+	default:
+		w.WriteHeader(http.StatusInternalServerError)
+	}
+	json.NewEncoder(w).Encode(ErrorResponse{Error: err.Error()})
+}
@@ -3,6 +3,7 @@ package handlers
 import (
 	"encoding/json"
 	"net/http"
+	"strings"
 
 	"carbuyer/internal/api/middleware"
 	"carbuyer/internal/db/models"
@@ -13,12 +14,14 @@ import (
 )
 
 type ThreadHandler struct {
-	threadService *services.ThreadService
+	threadService  *services.ThreadService
+	summaryService *services.ThreadSummaryService
 }
 
-func NewThreadHandler(threadService *services.ThreadService) *ThreadHandler {
+func NewThreadHandler(threadService *services.ThreadService, summaryService *services.ThreadSummaryService) *ThreadHandler {
 	return &ThreadHandler{
-		threadService: threadService,
+		threadService:  threadService,
+		summaryService: summaryService,
 	}
 }
 
@@ -30,12 +33,51 @@ type CreateThreadRequest struct {
 
 // ThreadResponse represents a thread in API responses
 type ThreadResponse struct {
-	ID            string  `json:"id"`
-	SellerName    string  `json:"sellerName"`
-	SellerType    string  `json:"sellerType"`
-	CreatedAt     string  `json:"createdAt"`
-	LastMessageAt *string `json:"lastMessageAt,omitempty"`
-	MessageCount  int     `json:"messageCount"`
+	ID                string  `json:"id"`
+	SellerName        string  `json:"sellerName"`
+	SellerType        string  `json:"sellerType"`
+	CreatedAt         string  `json:"createdAt"`
+	LastMessageAt     *string `json:"lastMessageAt,omitempty"`
+	MessageCount      int     `json:"messageCount"`
+	ReplyToEmail      string  `json:"replyToEmail,omitempty"`
+	StrategyProfileID *string `json:"strategyProfileId,omitempty"` // Nil uses the agent's default approach
+}
+
+// ThreadSummaryRequest is the user's edit of a thread's summary. An empty summary is rebuilt
+// from the whole thread.
+type ThreadSummaryRequest struct {
+	Content string `json:"content"`
+}
+
+// ThreadSummaryResponse represents a thread's running summary of key facts in API responses
+type ThreadSummaryResponse struct {
+	ThreadID          string  `json:"threadId"`
+	Content           string  `json:"content"`
+	SummarizedThrough *string `json:"summarizedThrough,omitempty"`
+	MessageCount      int     `json:"messageCount"`
+	EditedAt          *string `json:"editedAt,omitempty"`
+	UpdatedAt         *string `json:"updatedAt,omitempty"`
+}
+
+func newThreadSummaryResponse(summary *models.ThreadSummary) ThreadSummaryResponse {
+	resp := ThreadSummaryResponse{
+		ThreadID:     summary.ThreadID.String(),
+		Content:      summary.Content,
+		MessageCount: summary.MessageCount,
+	}
+	if summary.SummarizedThrough != nil {
+		through := summary.SummarizedThrough.Format("2006-01-02T15:04:05Z")
+		resp.SummarizedThrough = &through
+	}
+	if summary.EditedAt != nil {
+		edited := summary.EditedAt.Format("2006-01-02T15:04:05Z")
+		resp.EditedAt = &edited
+	}
+	if !summary.UpdatedAt.IsZero() {
+		updated := summary.UpdatedAt.Format("2006-01-02T15:04:05Z")
+		resp.UpdatedAt = &updated
+	}
+	return resp
 }
 
 // CreateThread creates a new thread
@@ -114,6 +156,10 @@ func (h *ThreadHandler) GetThreads(w http.ResponseWriter, r *http.Request) {
 			lastMsg := thread.LastMessageAt.Format("2006-01-02T15:04:05Z")
 			threadResp.LastMessageAt = &lastMsg
 		}
+		if thread.StrategyProfileID != nil {
+			profileID := thread.StrategyProfileID.String()
+			threadResp.StrategyProfileID = &profileID
+		}
 
 		response.Threads[i] = threadResp
 	}
@@ -166,6 +212,15 @@ func (h *ThreadHandler) GetThread(w http.ResponseWriter, r *http.Request) {
 		lastMsg := thread.LastMessageAt.Format("2006-01-02T15:04:05Z")
 		resp.LastMessageAt = &lastMsg
 	}
+	if thread.StrategyProfileID != nil {
+		profileID := thread.StrategyProfileID.String()
+		resp.StrategyProfileID = &profileID
+	}
+
+	// Include the reply-to alias so the UI can show where seller replies are routed
+	if replyTo, err := h.threadService.GetThreadReplyAddress(thread.ID, userID); err == nil {
+		resp.ReplyToEmail = replyTo
+	}
 
 	w.Header().Set("Content-Type", "application/json")
 	w.WriteHeader(http.StatusOK)
@@ -207,3 +262,113 @@ func (h *ThreadHandler) ArchiveThread(w http.ResponseWriter, r *http.Request) {
 	w.WriteHeader(http.StatusOK)
 	json.NewEncoder(w).Encode(map[string]string{"message": "thread archived successfully"})
 }
+
+// GetThreadSummary returns a thread's running summary of key facts
+func (h *ThreadHandler) GetThreadSummary(w http.ResponseWriter, r *http.Request) {
+	userID, ok := middleware.GetUserIDFromContext(r.Context())
+	if !ok {
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusUnauthorized)
+		json.NewEncoder(w).Encode(ErrorResponse{Error: "unauthorized"})
+		return
+	}
+
+	threadID, err := uuid.Parse(chi.URLParam(r, "id"))
+	if err != nil {
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusBadRequest)
+		json.NewEncoder(w).Encode(ErrorResponse{Error: "invalid thread ID"})
+		return
+	}
+
+	summary, err := h.summaryService.GetSummary(threadID, userID)
+	if err != nil {
+		writeThreadSummaryError(w, err)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(newThreadSummaryResponse(summary))
+}
+
+// UpdateThreadSummary replaces a thread's summary with the user's edit
+func (h *ThreadHandler) UpdateThreadSummary(w http.ResponseWriter, r *http.Request) {
+	userID, ok := middleware.GetUserIDFromContext(r.Context())
+	if !ok {
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusUnauthorized)
+		json.NewEncoder(w).Encode(ErrorResponse{Error: "unauthorized"})
+		return
+	}
+
+	threadID, err := uuid.Parse(chi.URLParam(r, "id"))
+	if err != nil {
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusBadRequest)
+		json.NewEncoder(w).Encode(ErrorResponse{Error: "invalid thread ID"})
+		return
+	}
+
+	var req ThreadSummaryRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusBadRequest)
+		json.NewEncoder(w).Encode(ErrorResponse{Error: "invalid request body"})
+		return
+	}
+
+	summary, err := h.summaryService.UpdateSummary(threadID, userID, req.Content)
+	if err != nil {
+		writeThreadSummaryError(w, err)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(newThreadSummaryResponse(summary))
+}
+
+// RefreshThreadSummary brings a thread's summary up to date with its messages now, rather
+// than waiting for the background refresh
+func (h *ThreadHandler) RefreshThreadSummary(w http.ResponseWriter, r *http.Request) {
+	userID, ok := middleware.GetUserIDFromContext(r.Context())
+	if !ok {
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusUnauthorized)
+		json.NewEncoder(w).Encode(ErrorResponse{Error: "unauthorized"})
+		return
+	}
+
+	threadID, err := uuid.Parse(chi.URLParam(r, "id"))
+	if err != nil {
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusBadRequest)
+		json.NewEncoder(w).Encode(ErrorResponse{Error: "invalid thread ID"})
+		return
+	}
+
+	summary, err := h.summaryService.RefreshThread(r.Context(), threadID, userID)
+	if err != nil {
+		writeThreadSummaryError(w, err)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(newThreadSummaryResponse(summary))
+}
+
+// writeThreadSummaryError writes the status for a thread summary service error
+func writeThreadSummaryError(w http.ResponseWriter, err error) {
+	w.Header().Set("Content-Type", "application/json")
+	switch {
+	case err.Error() == "thread not found":
+		w.WriteHeader(http.StatusNotFound)
+	case strings.HasPrefix(err.Error(), "summary must be"):
+		w.WriteHeader(http.StatusBadRequest)
+	default:
+		w.WriteHeader(llmErrorStatus(err, http.StatusInternalServerError))
+	}
+	json.NewEncoder(w).Encode(ErrorResponse{Error: err.Error()})
+}
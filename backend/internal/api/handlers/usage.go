@@ -0,0 +1,211 @@
+package handlers
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"time"
+
+	"carbuyer/internal/api/middleware"
+	"carbuyer/internal/services"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/google/uuid"
+)
+
+type UsageHandler struct {
+	usageService *services.UsageService
+}
+
+func NewUsageHandler(usageService *services.UsageService) *UsageHandler {
+	return &UsageHandler{
+		usageService: usageService,
+	}
+}
+
+// UsageTotalsResponse represents the LLM usage of a set of requests in API responses
+type UsageTotalsResponse struct {
+	Requests      int64   `json:"requests"`
+	InputTokens   int64   `json:"inputTokens"`
+	OutputTokens  int64   `json:"outputTokens"`
+	TotalTokens   int64   `json:"totalTokens"`
+	EstimatedCost float64 `json:"estimatedCost"` // Dollars, at list prices
+}
+
+// UsageBreakdownResponse is the usage for one purpose, model or user. Key is empty for
+// requests not made for a user.
+type UsageBreakdownResponse struct {
+	Key string `json:"key"`
+	UsageTotalsResponse
+}
+
+// UsageReportResponse represents a month of LLM usage in API responses
+type UsageReportResponse struct {
+	Month           string                   `json:"month"` // YYYY-MM
+	Totals          UsageTotalsResponse      `json:"totals"`
+	ByPurpose       []UsageBreakdownResponse `json:"byPurpose"`
+	ByModel         []UsageBreakdownResponse `json:"byModel"`
+	ByUser          []UsageBreakdownResponse `json:"byUser,omitempty"`
+	Quota           *int64                   `json:"quota,omitempty"` // Monthly tokens; 0 means unlimited
+	RemainingTokens *int64                   `json:"remainingTokens,omitempty"`
+}
+
+// TokenQuotaRequest sets a user's monthly token quota. 0 means unlimited.
+type TokenQuotaRequest struct {
+	MonthlyTokens int64 `json:"monthlyTokens"`
+}
+
+func newUsageTotalsResponse(totals services.UsageTotals) UsageTotalsResponse {
+	return UsageTotalsResponse{
+		Requests:      totals.Requests,
+		InputTokens:   totals.InputTokens,
+		OutputTokens:  totals.OutputTokens,
+		TotalTokens:   totals.Tokens(),
+		EstimatedCost: totals.EstimatedCost,
+	}
+}
+
+func newUsageBreakdownResponses(breakdowns []services.UsageBreakdown) []UsageBreakdownResponse {
+	responses := make([]UsageBreakdownResponse, 0, len(breakdowns))
+	for _, breakdown := range breakdowns {
+		responses = append(responses, UsageBreakdownResponse{
+			Key:                 breakdown.Key,
+			UsageTotalsResponse: newUsageTotalsResponse(breakdown.UsageTotals),
+		})
+	}
+	return responses
+}
+
+func newUsageReportResponse(report *services.UsageReport) UsageReportResponse {
+	response := UsageReportResponse{
+		Month:     report.Month.Format("2006-01"),
+		Totals:    newUsageTotalsResponse(report.Totals),
+		ByPurpose: newUsageBreakdownResponses(report.ByPurpose),
+		ByModel:   newUsageBreakdownResponses(report.ByModel),
+	}
+	if report.ByUser != nil {
+		response.ByUser = newUsageBreakdownResponses(report.ByUser)
+	}
+	return response
+}
+
+// parseUsageMonth reads the month query parameter (YYYY-MM), defaulting to this month
+func parseUsageMonth(r *http.Request) (time.Time, bool) {
+	month := r.URL.Query().Get("month")
+	if month == "" {
+		return time.Now(), true
+	}
+	parsed, err := time.Parse("2006-01", month)
+	return parsed, err == nil
+}
+
+// GetUsage returns the user's LLM usage and quota for a month
+func (h *UsageHandler) GetUsage(w http.ResponseWriter, r *http.Request) {
+	userID, ok := middleware.GetUserIDFromContext(r.Context())
+	if !ok {
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusUnauthorized)
+		json.NewEncoder(w).Encode(ErrorResponse{Error: "unauthorized"})
+		return
+	}
+
+	month, ok := parseUsageMonth(r)
+	if !ok {
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusBadRequest)
+		json.NewEncoder(w).Encode(ErrorResponse{Error: "month must be YYYY-MM"})
+		return
+	}
+
+	report, err := h.usageService.GetUserUsage(userID, month)
+	if err != nil {
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusInternalServerError)
+		json.NewEncoder(w).Encode(ErrorResponse{Error: err.Error()})
+		return
+	}
+
+	response := newUsageReportResponse(report)
+	response.Quota = &report.Quota
+	if report.Quota > 0 {
+		remaining := max(report.Quota-report.Totals.Tokens(), 0)
+		response.RemainingTokens = &remaining
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(response)
+}
+
+// GetGlobalUsage returns every user's LLM usage for a month, heaviest users first
+func (h *UsageHandler) GetGlobalUsage(w http.ResponseWriter, r *http.Request) {
+	month, ok := parseUsageMonth(r)
+	if !ok {
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusBadRequest)
+		json.NewEncoder(w).Encode(ErrorResponse{Error: "month must be YYYY-MM"})
+		return
+	}
+
+	report, err := h.usageService.GetGlobalUsage(month)
+	if err != nil {
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusInternalServerError)
+		json.NewEncoder(w).Encode(ErrorResponse{Error: err.Error()})
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(newUsageReportResponse(report))
+}
+
+// SetUserQuota sets a user's monthly token quota, overriding the default
+func (h *UsageHandler) SetUserQuota(w http.ResponseWriter, r *http.Request) {
+	userID, err := uuid.Parse(chi.URLParam(r, "id"))
+	if err != nil {
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusBadRequest)
+		json.NewEncoder(w).Encode(ErrorResponse{Error: "invalid user ID"})
+		return
+	}
+
+	var req TokenQuotaRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusBadRequest)
+		json.NewEncoder(w).Encode(ErrorResponse{Error: "invalid request body"})
+		return
+	}
+
+	quota, err := h.usageService.SetQuota(userID, req.MonthlyTokens)
+	if err != nil {
+		w.Header().Set("Content-Type", "application/json")
+		switch err.Error() {
+		case "user not found":
+			w.WriteHeader(http.StatusNotFound)
+		case "monthlyTokens can't be negative":
+			w.WriteHeader(http.StatusBadRequest)
+		default:
+			w.WriteHeader(http.StatusInternalServerError)
+		}
+		json.NewEncoder(w).Encode(ErrorResponse{Error: err.Error()})
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"userId":        quota.UserID.String(),
+		"monthlyTokens": quota.MonthlyTokens,
+	})
+}
+
+// llmErrorStatus returns the status for an error from work that calls the LLM: 429 when the
+// user is over their monthly token quota, otherwise fallback
+func llmErrorStatus(err error, fallback int) int {
+	if errors.Is(err, services.ErrTokenQuotaExceeded) {
+		return http.StatusTooManyRequests
+	}
+	return fallback
+}
@@ -20,10 +20,22 @@ type Config struct {
 	MailgunAPIKey            string
 	MailgunDomain            string
 	MailgunWebhookSigningKey string
+	InboundWebhookSecret     string
+	EmailClassifierLLM       bool
 	GoogleClientID           string
 	GoogleClientSecret       string
 	GoogleRedirectURL        string
 	TokenEncryptionKey       string
+	AttachmentStorageDir     string
+	AttachmentMaxBytes       int64
+	EmailImportMaxBytes      int64
+	SMSProvider              string
+	TwilioAccountSID         string
+	TwilioAuthToken          string
+	SMSFakeWebhookSecret     string // Token inbound fake provider webhooks must carry
+	SMSWebhookBaseURL        string
+	LLMMonthlyTokenQuota     int64
+	AdminAPIKey              string
 }
 
 func Load() (*Config, error) {
@@ -41,10 +53,22 @@ func Load() (*Config, error) {
 	mailgunAPIKey := getEnv("MAILGUN_API_KEY", "")
 	mailgunDomain := getEnv("MAILGUN_DOMAIN", "")
 	mailgunWebhookSigningKey := getEnv("MAILGUN_WEBHOOK_SIGNING_KEY", "")
+	inboundWebhookSecret := getEnv("INBOUND_WEBHOOK_SECRET", "") // SendGrid, Postmark and raw MIME webhooks
+	emailClassifierLLM := getEnvAsBool("EMAIL_CLASSIFIER_LLM", false)
 	googleClientID := getEnv("GOOGLE_CLIENT_ID", "")
 	googleClientSecret := getEnv("GOOGLE_CLIENT_SECRET", "")
 	googleRedirectURL := getEnv("GOOGLE_REDIRECT_URL", "http://localhost:3000/oauth/callback")
 	tokenEncryptionKey := getEnv("TOKEN_ENCRYPTION_KEY", "")
+	attachmentStorageDir := getEnv("ATTACHMENT_STORAGE_DIR", "./data/attachments")
+	attachmentMaxBytes := getEnvAsInt("ATTACHMENT_MAX_BYTES", 15*1024*1024) // 15MB
+	emailImportMaxBytes := getEnvAsInt("EMAIL_IMPORT_MAX_BYTES", 100*1024*1024) // 100MB
+	smsProvider := getEnv("SMS_PROVIDER", "fake") // "twilio" or "fake"
+	twilioAccountSID := getEnv("TWILIO_ACCOUNT_SID", "")
+	twilioAuthToken := getEnv("TWILIO_AUTH_TOKEN", "")
+	smsFakeWebhookSecret := getEnv("SMS_FAKE_WEBHOOK_SECRET", "") // Inbound fake webhooks are rejected when unset
+	smsWebhookBaseURL := strings.TrimSuffix(getEnv("SMS_WEBHOOK_BASE_URL", "http://localhost:8080"), "/")
+	llmMonthlyTokenQuota := getEnvAsInt("LLM_MONTHLY_TOKEN_QUOTA", 0) // Per user; 0 means unlimited
+	adminAPIKey := getEnv("ADMIN_API_KEY", "") // Admin endpoints are disabled when unset
 
 	if databaseURL == "" {
 		return nil, fmt.Errorf("DATABASE_URL environment variable is required")
@@ -58,6 +82,14 @@ func Load() (*Config, error) {
 		return nil, fmt.Errorf("ANTHROPIC_API_KEY environment variable is required")
 	}
 
+	if smsProvider != "twilio" && smsProvider != "fake" {
+		return nil, fmt.Errorf("SMS_PROVIDER must be twilio or fake")
+	}
+
+	if smsProvider == "twilio" && (twilioAccountSID == "" || twilioAuthToken == "") {
+		return nil, fmt.Errorf("TWILIO_ACCOUNT_SID and TWILIO_AUTH_TOKEN are required when SMS_PROVIDER is twilio")
+	}
+
 	return &Config{
 		Port:                     port,
 		Environment:              environment,
@@ -71,10 +103,22 @@ func Load() (*Config, error) {
 		MailgunAPIKey:            mailgunAPIKey,
 		MailgunDomain:            mailgunDomain,
 		MailgunWebhookSigningKey: mailgunWebhookSigningKey,
+		InboundWebhookSecret:     inboundWebhookSecret,
+		EmailClassifierLLM:       emailClassifierLLM,
 		GoogleClientID:           googleClientID,
 		GoogleClientSecret:       googleClientSecret,
 		GoogleRedirectURL:        googleRedirectURL,
 		TokenEncryptionKey:       tokenEncryptionKey,
+		AttachmentStorageDir:     attachmentStorageDir,
+		AttachmentMaxBytes:       int64(attachmentMaxBytes),
+		EmailImportMaxBytes:      int64(emailImportMaxBytes),
+		SMSProvider:              smsProvider,
+		TwilioAccountSID:         twilioAccountSID,
+		TwilioAuthToken:          twilioAuthToken,
+		SMSFakeWebhookSecret:     smsFakeWebhookSecret,
+		SMSWebhookBaseURL:        smsWebhookBaseURL,
+		LLMMonthlyTokenQuota:     int64(llmMonthlyTokenQuota),
+		AdminAPIKey:              adminAPIKey,
 	}, nil
 }
 
@@ -97,3 +141,15 @@ func getEnvAsInt(key string, defaultValue int) int {
 	}
 	return value
 }
+
+func getEnvAsBool(key string, defaultValue bool) bool {
+	valueStr := os.Getenv(key)
+	if valueStr == "" {
+		return defaultValue
+	}
+	value, err := strconv.ParseBool(valueStr)
+	if err != nil {
+		return defaultValue
+	}
+	return value
+}
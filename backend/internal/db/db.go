@@ -61,6 +61,18 @@ func (d *Database) AutoMigrate() error {
 		}
 	}
 
+	// Autopilot decisions went from a plain message_id index to a unique one. Drop duplicate
+	// decisions (keeping the first) so the unique index can be built.
+	if d.DB.Migrator().HasIndex(&models.AutopilotDecision{}, "idx_autopilot_decisions_message_id") {
+		if err := d.DB.Exec(`DELETE FROM autopilot_decisions a USING autopilot_decisions b
+			WHERE a.message_id = b.message_id AND (a.created_at, a.id) > (b.created_at, b.id)`).Error; err != nil {
+			return fmt.Errorf("failed to remove duplicate autopilot decisions: %w", err)
+		}
+		if err := d.DB.Migrator().DropIndex(&models.AutopilotDecision{}, "idx_autopilot_decisions_message_id"); err != nil {
+			return fmt.Errorf("failed to drop autopilot decision index: %w", err)
+		}
+	}
+
 	// Run AutoMigrate - it will create new columns and tables
 	err := d.DB.AutoMigrate(
 		&models.User{},
@@ -69,15 +81,37 @@ func (d *Database) AutoMigrate() error {
 		&models.VehicleTrim{},
 		&models.UserPreferences{},
 		&models.Dealer{},
+		&models.StrategyProfile{},
 		&models.Thread{},
 		&models.Message{},
+		&models.MessageAttachment{},
+		&models.DraftVariant{},
+		&models.DraftPreferenceSignal{},
+		&models.DocumentExtraction{},
 		&models.TrackedOffer{},
+		&models.WebhookEvent{},
+		&models.EmailSuppression{},
+		&models.SMSNumber{},
+		&models.SMSOptOut{},
 		&models.GmailToken{},
+		&models.AutopilotSettings{},
+		&models.AutopilotDecision{},
+		&models.AgentToolCall{},
+		&models.ThreadSummary{},
+		&models.LLMUsage{},
+		&models.TokenQuota{},
+		&models.PromptTemplate{},
+		&models.PromptDeployment{},
 	)
 	if err != nil {
 		return fmt.Errorf("failed to run migrations: %w", err)
 	}
 
+	// Offers tracked as free text get structured terms
+	if err := migrateTrackedOffers(d.DB); err != nil {
+		return fmt.Errorf("failed to migrate tracked offers: %w", err)
+	}
+
 	log.Println("Migrations completed successfully")
 	return nil
 }
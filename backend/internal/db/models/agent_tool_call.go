@@ -0,0 +1,21 @@
+package models
+
+import (
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// AgentToolCall logs a tool the negotiation agent called while responding in a thread
+type AgentToolCall struct {
+	ID         uuid.UUID `gorm:"type:uuid;primary_key;default:gen_random_uuid()" json:"id"`
+	UserID     uuid.UUID `gorm:"type:uuid;index;not null" json:"userId"`
+	ThreadID   uuid.UUID `gorm:"type:uuid;index;not null" json:"threadId"`
+	Tool       string    `gorm:"type:varchar(60);not null" json:"tool"`
+	Input      *string   `gorm:"type:jsonb" json:"input,omitempty"`
+	Output     string    `gorm:"type:text" json:"output"`
+	IsError    bool      `gorm:"default:false" json:"isError"`
+	Round      int       `gorm:"not null" json:"round"` // 1 for the first tool calls of a response
+	DurationMs int64     `json:"durationMs"`
+	CreatedAt  time.Time `gorm:"index" json:"createdAt"`
+}
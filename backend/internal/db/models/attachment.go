@@ -0,0 +1,36 @@
+package models
+
+import (
+	"time"
+
+	"github.com/google/uuid"
+)
+
+type AttachmentStatus string
+
+const (
+	AttachmentStatusStored   AttachmentStatus = "stored"   // Saved, no scanner configured
+	AttachmentStatusClean    AttachmentStatus = "clean"    // Saved and passed the virus scan
+	AttachmentStatusRejected AttachmentStatus = "rejected" // Not saved (too large, disallowed type, or infected)
+)
+
+type MessageAttachment struct {
+	ID           uuid.UUID        `gorm:"type:uuid;primary_key;default:gen_random_uuid()" json:"id"`
+	MessageID    uuid.UUID        `gorm:"type:uuid;index;not null" json:"messageId"`
+	UserID       uuid.UUID        `gorm:"type:uuid;index;not null" json:"userId"`
+	Filename     string           `gorm:"not null" json:"filename"`
+	ContentType  string           `gorm:"type:varchar(127);not null" json:"contentType"`
+	SizeBytes    int64            `gorm:"not null" json:"sizeBytes"`
+	SHA256       string           `gorm:"type:varchar(64)" json:"sha256,omitempty"`
+	StorageKey   string           `json:"-"`
+	Status       AttachmentStatus `gorm:"type:varchar(20);not null" json:"status"`
+	RejectReason string           `json:"rejectReason,omitempty"`
+	CreatedAt    time.Time        `json:"createdAt"`
+
+	Message *Message `gorm:"foreignKey:MessageID" json:"message,omitempty"`
+}
+
+// Downloadable reports whether the attachment content was stored and may be served
+func (a *MessageAttachment) Downloadable() bool {
+	return a.StorageKey != "" && (a.Status == AttachmentStatusStored || a.Status == AttachmentStatusClean)
+}
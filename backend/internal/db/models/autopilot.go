@@ -0,0 +1,80 @@
+package models
+
+import (
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// AutopilotSettings are the user's guardrails for letting the agent negotiate a thread on
+// its own. A thread without settings isn't on autopilot.
+type AutopilotSettings struct {
+	ID               uuid.UUID `gorm:"type:uuid;primary_key;default:gen_random_uuid()" json:"id"`
+	ThreadID         uuid.UUID `gorm:"type:uuid;uniqueIndex;not null" json:"threadId"`
+	UserID           uuid.UUID `gorm:"type:uuid;index;not null" json:"userId"`
+	Enabled          bool      `gorm:"default:false" json:"enabled"`
+	AutoSend         bool      `gorm:"default:false" json:"autoSend"` // Send replies without waiting for approval
+	TargetPrice      *float64  `gorm:"type:decimal(10,2)" json:"targetPrice,omitempty"`
+	WalkAwayPrice    *float64  `gorm:"type:decimal(10,2)" json:"walkAwayPrice,omitempty"`
+	NeverDisclose    string    `gorm:"type:text" json:"neverDisclose,omitempty"` // One item per line
+	MaxRepliesPerDay int       `gorm:"not null;default:3" json:"maxRepliesPerDay"`
+	CreatedAt        time.Time `json:"createdAt"`
+	UpdatedAt        time.Time `json:"updatedAt"`
+
+	Thread *Thread `gorm:"foreignKey:ThreadID" json:"thread,omitempty"`
+}
+
+// AutopilotAction is what the agent decided to do about a seller message
+type AutopilotAction string
+
+const (
+	AutopilotActionReply    AutopilotAction = "reply"
+	AutopilotActionWait     AutopilotAction = "wait"     // Nothing needs saying yet
+	AutopilotActionEscalate AutopilotAction = "escalate" // The user needs to decide
+	AutopilotActionDeciding AutopilotAction = "deciding" // The agent claimed the message and is still deciding
+)
+
+// AutopilotReplyStatus tracks a reply the agent drafted on autopilot
+type AutopilotReplyStatus string
+
+const (
+	AutopilotReplyNone     AutopilotReplyStatus = ""
+	AutopilotReplyPending  AutopilotReplyStatus = "pending" // In the approval queue
+	AutopilotReplySending  AutopilotReplyStatus = "sending" // Approved and being sent
+	AutopilotReplySent     AutopilotReplyStatus = "sent"
+	AutopilotReplyRejected AutopilotReplyStatus = "rejected"
+)
+
+// AutopilotGuardrail names the guardrail that held back a reply
+type AutopilotGuardrail string
+
+const (
+	AutopilotGuardrailNone          AutopilotGuardrail = ""
+	AutopilotGuardrailDailyLimit    AutopilotGuardrail = "max_replies_per_day"
+	AutopilotGuardrailWalkAway      AutopilotGuardrail = "walk_away_price"
+	AutopilotGuardrailNeverDisclose AutopilotGuardrail = "never_disclose"
+	AutopilotGuardrailDraftCheck    AutopilotGuardrail = "draft_check" // The checks every draft gets before it's sent
+)
+
+// AutopilotDecision logs what the agent decided about a seller message on autopilot and why,
+// so the user can review it
+type AutopilotDecision struct {
+	ID             uuid.UUID            `gorm:"type:uuid;primary_key;default:gen_random_uuid()" json:"id"`
+	ThreadID       uuid.UUID            `gorm:"type:uuid;index;not null" json:"threadId"`
+	UserID         uuid.UUID            `gorm:"type:uuid;index;not null" json:"userId"`
+	MessageID      *uuid.UUID           `gorm:"type:uuid;uniqueIndex:idx_autopilot_decisions_message" json:"messageId,omitempty"` // The seller message decided on - at most once
+	Action         AutopilotAction      `gorm:"type:varchar(20);not null" json:"action"`
+	Reasoning      string               `gorm:"type:text" json:"reasoning"`
+	Guardrail      AutopilotGuardrail   `gorm:"type:varchar(40)" json:"guardrail,omitempty"`
+	GuardrailNote  string               `gorm:"type:text" json:"guardrailNote,omitempty"`
+	Reply          string               `gorm:"type:text" json:"reply,omitempty"`
+	ReplyStatus    AutopilotReplyStatus `gorm:"type:varchar(20);index" json:"replyStatus,omitempty"`
+	DraftMessageID *uuid.UUID           `gorm:"type:uuid" json:"draftMessageId,omitempty"` // The agent message holding the reply
+	Error          string               `gorm:"type:text" json:"error,omitempty"`
+	CreatedAt      time.Time            `gorm:"index" json:"createdAt"`
+	ReviewedAt     *time.Time           `json:"reviewedAt,omitempty"`
+	SentAt         *time.Time           `json:"sentAt,omitempty"`
+
+	Thread  *Thread  `gorm:"foreignKey:ThreadID" json:"thread,omitempty"`
+	Message *Message `gorm:"foreignKey:MessageID" json:"message,omitempty"`
+}
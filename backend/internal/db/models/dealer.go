@@ -6,18 +6,30 @@ import (
 	"github.com/google/uuid"
 )
 
+// DealerEmailStatus marks dealer addresses that should no longer be emailed
+type DealerEmailStatus string
+
+const (
+	DealerEmailStatusValid      DealerEmailStatus = ""
+	DealerEmailStatusInvalid    DealerEmailStatus = "invalid"    // Hard bounce
+	DealerEmailStatusComplained DealerEmailStatus = "complained" // Marked our email as spam
+)
+
 type Dealer struct {
-	ID               uuid.UUID `gorm:"type:uuid;primary_key;default:gen_random_uuid()" json:"id"`
-	Name             string    `gorm:"not null" json:"name"`
-	Location         string    `gorm:"not null" json:"location"`
-	Email            *string   `gorm:"type:varchar(255)" json:"email,omitempty"`
-	Phone            *string   `gorm:"type:varchar(20)" json:"phone,omitempty"`
-	Website          *string   `gorm:"type:varchar(255)" json:"website,omitempty"`
-	Distance         float64   `gorm:"not null" json:"distance"`
-	Contacted        bool      `gorm:"default:false" json:"contacted"`
-	UserPreferenceID uuid.UUID `gorm:"type:uuid;index;not null" json:"userPreferenceId"`
-	CreatedAt        time.Time `json:"createdAt"`
-	UpdatedAt        time.Time `json:"updatedAt"`
+	ID                uuid.UUID         `gorm:"type:uuid;primary_key;default:gen_random_uuid()" json:"id"`
+	Name              string            `gorm:"not null" json:"name"`
+	Location          string            `gorm:"not null" json:"location"`
+	Email             *string           `gorm:"type:varchar(255)" json:"email,omitempty"`
+	EmailStatus       DealerEmailStatus `gorm:"type:varchar(20)" json:"emailStatus,omitempty"`
+	EmailStatusReason string            `gorm:"type:text" json:"emailStatusReason,omitempty"`
+	EmailStatusAt     *time.Time        `json:"emailStatusAt,omitempty"`
+	Phone             *string           `gorm:"type:varchar(20)" json:"phone,omitempty"`
+	Website           *string           `gorm:"type:varchar(255)" json:"website,omitempty"`
+	Distance          float64           `gorm:"not null" json:"distance"`
+	Contacted         bool              `gorm:"default:false" json:"contacted"`
+	UserPreferenceID  uuid.UUID         `gorm:"type:uuid;index;not null" json:"userPreferenceId"`
+	CreatedAt         time.Time         `json:"createdAt"`
+	UpdatedAt         time.Time         `json:"updatedAt"`
 
 	UserPreference *UserPreferences `gorm:"foreignKey:UserPreferenceID" json:"userPreference,omitempty"`
 }
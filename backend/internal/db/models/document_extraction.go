@@ -0,0 +1,50 @@
+package models
+
+import (
+	"time"
+
+	"github.com/google/uuid"
+)
+
+type ExtractionStatus string
+
+const (
+	ExtractionStatusPending   ExtractionStatus = "pending"
+	ExtractionStatusCompleted ExtractionStatus = "completed"
+	ExtractionStatusFailed    ExtractionStatus = "failed"
+)
+
+type ExtractionMethod string
+
+const (
+	ExtractionMethodPDFText     ExtractionMethod = "pdf_text"     // Text layer extracted from the PDF
+	ExtractionMethodPDFDocument ExtractionMethod = "pdf_document" // Scanned PDF sent to Claude as a document
+	ExtractionMethodImage       ExtractionMethod = "image_vision" // Photo or scan read with Claude vision
+)
+
+// DocumentExtraction holds the structured line items read from a quote or buyer's order attachment
+type DocumentExtraction struct {
+	ID                 uuid.UUID        `gorm:"type:uuid;primary_key;default:gen_random_uuid()" json:"id"`
+	UserID             uuid.UUID        `gorm:"type:uuid;index;not null" json:"userId"`
+	MessageID          uuid.UUID        `gorm:"type:uuid;index;not null" json:"messageId"`
+	AttachmentID       uuid.UUID        `gorm:"type:uuid;uniqueIndex;not null" json:"attachmentId"`
+	Status             ExtractionStatus `gorm:"type:varchar(20);not null" json:"status"`
+	Method             ExtractionMethod `gorm:"type:varchar(20)" json:"method,omitempty"`
+	DocumentType       string           `gorm:"type:varchar(40)" json:"documentType,omitempty"`
+	VehiclePrice       *float64         `gorm:"type:decimal(10,2)" json:"vehiclePrice,omitempty"`
+	DealerAddOns       *float64         `gorm:"type:decimal(10,2)" json:"dealerAddOns,omitempty"`
+	DocFee             *float64         `gorm:"type:decimal(10,2)" json:"docFee,omitempty"`
+	Taxes              *float64         `gorm:"type:decimal(10,2)" json:"taxes,omitempty"`
+	Registration       *float64         `gorm:"type:decimal(10,2)" json:"registration,omitempty"`
+	Rebates            *float64         `gorm:"type:decimal(10,2)" json:"rebates,omitempty"`
+	OutTheDoor         *float64         `gorm:"type:decimal(10,2)" json:"outTheDoor,omitempty"`
+	OutTheDoorComputed bool             `gorm:"not null;default:false" json:"outTheDoorComputed,omitempty"` // Summed from the components - the document didn't state it
+	LineItems          *string          `gorm:"type:jsonb" json:"lineItems,omitempty"`
+	Error              string           `json:"error,omitempty"`
+	OfferID            *uuid.UUID       `gorm:"type:uuid" json:"offerId,omitempty"` // Set once promoted to a TrackedOffer
+	CreatedAt          time.Time        `json:"createdAt"`
+	UpdatedAt          time.Time        `json:"updatedAt"`
+
+	Message    *Message           `gorm:"foreignKey:MessageID" json:"message,omitempty"`
+	Attachment *MessageAttachment `gorm:"foreignKey:AttachmentID" json:"attachment,omitempty"`
+}
@@ -0,0 +1,45 @@
+package models
+
+import (
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// DraftVariant is one of several drafts the agent offered for a reply, in a different tone or
+// length. The agent message shows the chosen variant, which starts as the best ranked one.
+type DraftVariant struct {
+	ID        uuid.UUID `gorm:"type:uuid;primary_key;default:gen_random_uuid()" json:"id"`
+	MessageID uuid.UUID `gorm:"type:uuid;index;not null" json:"messageId"` // The agent message
+	UserID    uuid.UUID `gorm:"type:uuid;index;not null" json:"userId"`
+	Rank      int       `gorm:"not null" json:"rank"`          // 1 is the agent's recommendation
+	Style     string    `gorm:"type:varchar(40)" json:"style"` // e.g. "firm", "friendly", "short"
+	Rationale string    `gorm:"type:text" json:"rationale"`
+	Content   string    `gorm:"type:text;not null" json:"content"`
+	Chosen    bool      `gorm:"default:false" json:"chosen"`
+	CreatedAt time.Time `json:"createdAt"`
+}
+
+// DraftSignalKind is what the user did with a draft
+type DraftSignalKind string
+
+const (
+	DraftSignalChosen      DraftSignalKind = "chosen"      // Picked a variant
+	DraftSignalEdited      DraftSignalKind = "edited"      // Rewrote the draft
+	DraftSignalRegenerated DraftSignalKind = "regenerated" // Asked for a new draft instead
+)
+
+// DraftPreferenceSignal records how the user reacted to one of the agent's drafts, to learn
+// which tones, lengths and wording they prefer
+type DraftPreferenceSignal struct {
+	ID        uuid.UUID       `gorm:"type:uuid;primary_key;default:gen_random_uuid()" json:"id"`
+	UserID    uuid.UUID       `gorm:"type:uuid;index;not null" json:"userId"`
+	ThreadID  uuid.UUID       `gorm:"type:uuid;index;not null" json:"threadId"`
+	MessageID uuid.UUID       `gorm:"type:uuid;index;not null" json:"messageId"` // The agent message
+	Kind      DraftSignalKind `gorm:"type:varchar(20);not null;index" json:"kind"`
+	Style     string          `gorm:"type:varchar(40)" json:"style,omitempty"` // The variant's style, if the draft was one
+	Rank      int             `json:"rank,omitempty"`                          // The variant's rank, if the draft was one
+	Original  string          `gorm:"type:text" json:"original"`               // The draft before the user acted
+	Revised   string          `gorm:"type:text" json:"revised,omitempty"`      // The chosen variant or the user's edit
+	CreatedAt time.Time       `json:"createdAt"`
+}
@@ -0,0 +1,18 @@
+package models
+
+import (
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// EmailSuppression records an address that hard bounced or complained, so it keeps its
+// dealer email status when dealer lists are refreshed
+type EmailSuppression struct {
+	ID        uuid.UUID         `gorm:"type:uuid;primary_key;default:gen_random_uuid()" json:"id"`
+	Email     string            `gorm:"type:varchar(255);uniqueIndex;not null" json:"email"` // Lowercase
+	Status    DealerEmailStatus `gorm:"type:varchar(20);not null" json:"status"`
+	Reason    string            `gorm:"type:text" json:"reason,omitempty"`
+	CreatedAt time.Time         `json:"createdAt"`
+	UpdatedAt time.Time         `json:"updatedAt"`
+}
@@ -0,0 +1,44 @@
+package models
+
+import (
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// LLMPurpose is what an LLM request was made for
+type LLMPurpose string
+
+const (
+	LLMPurposeNegotiation         LLMPurpose = "negotiation"
+	LLMPurposeAutopilot           LLMPurpose = "autopilot"
+	LLMPurposeThreadSummary       LLMPurpose = "thread_summary"
+	LLMPurposeOfferExtraction     LLMPurpose = "offer_extraction"
+	LLMPurposeQuoteExtraction     LLMPurpose = "quote_extraction"
+	LLMPurposeEmailClassification LLMPurpose = "email_classification"
+	LLMPurposeDealerSearch        LLMPurpose = "dealer_search"
+	LLMPurposeEvalJudge           LLMPurpose = "eval_judge"
+	LLMPurposeMasterAgent         LLMPurpose = "master_agent"
+	LLMPurposeDraftGuardrail      LLMPurpose = "draft_guardrail"
+)
+
+// LLMUsage records the tokens one LLM request used, for cost reports and quotas
+type LLMUsage struct {
+	ID           uuid.UUID  `gorm:"type:uuid;primary_key;default:gen_random_uuid()" json:"id"`
+	UserID       *uuid.UUID `gorm:"type:uuid;index:idx_llm_usages_user_created,priority:1" json:"userId,omitempty"` // Nil for requests not made for a user
+	Model        string     `gorm:"type:varchar(60);not null" json:"model"`
+	Purpose      LLMPurpose `gorm:"type:varchar(40);index;not null" json:"purpose"`
+	InputTokens  int        `gorm:"not null" json:"inputTokens"`
+	OutputTokens int        `gorm:"not null" json:"outputTokens"`
+	DurationMs   int64      `json:"durationMs"`
+	CreatedAt    time.Time  `gorm:"index;index:idx_llm_usages_user_created,priority:2" json:"createdAt"`
+}
+
+// TokenQuota overrides the default monthly LLM token quota for a user
+type TokenQuota struct {
+	ID            uuid.UUID `gorm:"type:uuid;primary_key;default:gen_random_uuid()" json:"id"`
+	UserID        uuid.UUID `gorm:"type:uuid;uniqueIndex;not null" json:"userId"`
+	MonthlyTokens int64     `gorm:"not null" json:"monthlyTokens"` // Input and output tokens; 0 means unlimited
+	CreatedAt     time.Time `json:"createdAt"`
+	UpdatedAt     time.Time `json:"updatedAt"`
+}
@@ -14,20 +14,78 @@ const (
 	SenderTypeSeller SenderType = "seller"
 )
 
+// MessageCategory classifies inbound email. Only human replies show in the default inbox.
+type MessageCategory string
+
+const (
+	MessageCategoryHuman     MessageCategory = "human"
+	MessageCategoryAutoReply MessageCategory = "auto_reply"
+	MessageCategoryMarketing MessageCategory = "marketing"
+	MessageCategorySpam      MessageCategory = "spam"
+)
+
+// MessageCategorySource records what decided a message's category
+type MessageCategorySource string
+
+const (
+	MessageCategorySourceHeaders MessageCategorySource = "headers"
+	MessageCategorySourceLLM     MessageCategorySource = "llm"
+	MessageCategorySourceUser    MessageCategorySource = "user"
+	MessageCategorySourceSender  MessageCategorySource = "sender" // Follows the user's correction of an earlier email from the same sender
+)
+
+// DeliveryStatus tracks an outbound email after it is sent
+type DeliveryStatus string
+
+const (
+	DeliveryStatusSent       DeliveryStatus = "sent"
+	DeliveryStatusDeferred   DeliveryStatus = "deferred"
+	DeliveryStatusDelivered  DeliveryStatus = "delivered"
+	DeliveryStatusBounced    DeliveryStatus = "bounced"
+	DeliveryStatusComplained DeliveryStatus = "complained"
+)
+
+// MessageChannel is how a message reached or left the dealer
+type MessageChannel string
+
+const (
+	MessageChannelEmail MessageChannel = "" // Email, and messages that only exist in the app
+	MessageChannelSMS   MessageChannel = "sms"
+)
+
 type Message struct {
-	ID                uuid.UUID  `gorm:"type:uuid;primary_key;default:gen_random_uuid()" json:"id"`
-	UserID            uuid.UUID  `gorm:"type:uuid;index;not null" json:"userId"`
-	ThreadID          *uuid.UUID `gorm:"type:uuid;index" json:"threadId,omitempty"`
-	Sender            SenderType `gorm:"type:varchar(20);not null" json:"sender"`
-	Content           string     `gorm:"type:text;not null" json:"content"`
-	Timestamp         time.Time  `gorm:"not null" json:"timestamp"`
-	SenderEmail       string     `json:"senderEmail,omitempty"`
-	ExternalMessageID string     `gorm:"index" json:"externalMessageId,omitempty"`
-	Subject           string     `json:"subject,omitempty"`
-	Metadata          *string    `gorm:"type:jsonb" json:"metadata,omitempty"`
-	SentViaEmail      bool       `gorm:"default:false" json:"sentViaEmail"`
-	DeletedAt         *time.Time `gorm:"index" json:"deletedAt,omitempty"`
-
-	User   *User   `gorm:"foreignKey:UserID" json:"user,omitempty"`
-	Thread *Thread `gorm:"foreignKey:ThreadID" json:"thread,omitempty"`
+	ID                uuid.UUID             `gorm:"type:uuid;primary_key;default:gen_random_uuid()" json:"id"`
+	Sequence          int64                 `gorm:"->;autoIncrement;index;not null" json:"-"` // Insertion order, assigned by the database
+	UserID            uuid.UUID             `gorm:"type:uuid;index;not null" json:"userId"`
+	ThreadID          *uuid.UUID            `gorm:"type:uuid;index" json:"threadId,omitempty"`
+	Sender            SenderType            `gorm:"type:varchar(20);not null" json:"sender"`
+	Content           string                `gorm:"type:text;not null" json:"content"`
+	RawContent        string                `gorm:"type:text" json:"rawContent,omitempty"` // Inbound body before quote and signature stripping
+	Timestamp         time.Time             `gorm:"not null" json:"timestamp"`
+	SenderEmail       string                `json:"senderEmail,omitempty"`
+	ExternalMessageID string                `gorm:"index" json:"externalMessageId,omitempty"`
+	Subject           string                `json:"subject,omitempty"`
+	Metadata          *string               `gorm:"type:jsonb" json:"metadata,omitempty"`
+	SentViaEmail      bool                  `gorm:"default:false" json:"sentViaEmail"`
+	SuggestedThreadID *uuid.UUID            `gorm:"type:uuid;index" json:"suggestedThreadId,omitempty"`
+	MatchConfidence   *float64              `json:"matchConfidence,omitempty"`
+	MatchSignal       string                `gorm:"type:varchar(20)" json:"matchSignal,omitempty"`
+	Category          MessageCategory       `gorm:"type:varchar(20);index" json:"category,omitempty"` // Empty for outbound and pre-classification messages, treated as human
+	CategorySource    MessageCategorySource `gorm:"type:varchar(20)" json:"categorySource,omitempty"`
+	CategoryReason    string                `gorm:"type:text" json:"categoryReason,omitempty"`
+	RecipientEmail    string                `json:"recipientEmail,omitempty"` // Outbound email recipient
+	DeliveryStatus    DeliveryStatus        `gorm:"type:varchar(20)" json:"deliveryStatus,omitempty"`
+	DeliveryError     string                `gorm:"type:text" json:"deliveryError,omitempty"`
+	DeliveryUpdatedAt *time.Time            `json:"deliveryUpdatedAt,omitempty"`
+	Channel           MessageChannel        `gorm:"type:varchar(20)" json:"channel,omitempty"`
+	SenderPhone       string                `gorm:"type:varchar(20);index" json:"senderPhone,omitempty"`    // Inbound SMS, E.164
+	RecipientPhone    string                `gorm:"type:varchar(20);index" json:"recipientPhone,omitempty"` // Outbound SMS, E.164
+	PromptTemplateID  *uuid.UUID            `gorm:"type:uuid;index" json:"promptTemplateId,omitempty"`      // Agent messages: the prompt template version that produced it
+	PromptVersion     int                   `json:"promptVersion,omitempty"`
+	DeletedAt         *time.Time            `gorm:"index" json:"deletedAt,omitempty"`
+
+	User        *User               `gorm:"foreignKey:UserID" json:"user,omitempty"`
+	Thread      *Thread             `gorm:"foreignKey:ThreadID" json:"thread,omitempty"`
+	Attachments []MessageAttachment `gorm:"foreignKey:MessageID" json:"attachments,omitempty"`
+	Variants    []DraftVariant      `gorm:"foreignKey:MessageID" json:"variants,omitempty"` // Agent messages generated with draft variants
 }
@@ -6,12 +6,79 @@ import (
 	"github.com/google/uuid"
 )
 
+// OfferReviewStatus records whether the user has vetted an offer. Offers the user tracks
+// themselves are confirmed; offers detected in seller messages wait for the user.
+type OfferReviewStatus string
+
+const (
+	OfferReviewConfirmed OfferReviewStatus = "confirmed"
+	OfferReviewPending   OfferReviewStatus = "pending"
+	OfferReviewRejected  OfferReviewStatus = "rejected" // Detected, but the user said it isn't an offer
+)
+
+// OfferSource records how an offer was tracked
+type OfferSource string
+
+const (
+	OfferSourceManual   OfferSource = "manual"   // Entered by the user
+	OfferSourceMessage  OfferSource = "message"  // Detected in a seller message
+	OfferSourceDocument OfferSource = "document" // Promoted from a document extraction
+)
+
+// OfferStatus is where an offer stands in the negotiation
+type OfferStatus string
+
+const (
+	OfferStatusActive    OfferStatus = "active"
+	OfferStatusExpired   OfferStatus = "expired"   // Past its expiration
+	OfferStatusCountered OfferStatus = "countered" // The buyer countered it
+	OfferStatusAccepted  OfferStatus = "accepted"
+	OfferStatusDeclined  OfferStatus = "declined"
+)
+
+// FinanceType is how the buyer would pay under an offer
+type FinanceType string
+
+const (
+	FinanceTypeCash    FinanceType = "cash"
+	FinanceTypeFinance FinanceType = "finance"
+	FinanceTypeLease   FinanceType = "lease"
+)
+
 type TrackedOffer struct {
-	ID        uuid.UUID  `gorm:"type:uuid;primary_key;default:gen_random_uuid()" json:"id"`
-	ThreadID  uuid.UUID  `gorm:"type:uuid;index;not null" json:"threadId"`
-	MessageID *uuid.UUID `gorm:"type:uuid" json:"messageId,omitempty"`
-	OfferText string     `gorm:"type:text;not null" json:"offerText"`
-	TrackedAt time.Time  `gorm:"not null" json:"trackedAt"`
+	ID           uuid.UUID         `gorm:"type:uuid;primary_key;default:gen_random_uuid()" json:"id"`
+	ThreadID     uuid.UUID         `gorm:"type:uuid;index;not null" json:"threadId"`
+	MessageID    *uuid.UUID        `gorm:"type:uuid;index" json:"messageId,omitempty"`
+	OfferText    string            `gorm:"type:text;not null" json:"offerText"`
+	TrackedAt    time.Time         `gorm:"not null" json:"trackedAt"`
+	ReviewStatus OfferReviewStatus `gorm:"type:varchar(20);not null;default:'confirmed'" json:"reviewStatus"`
+	Source       OfferSource       `gorm:"type:varchar(20);not null;default:'manual'" json:"source"`
+	Details      *string           `gorm:"type:jsonb" json:"details,omitempty"` // Terms detected in the seller's message
+	ReviewedAt   *time.Time        `json:"reviewedAt,omitempty"`
+	Status       OfferStatus       `gorm:"type:varchar(20);not null;default:'active';index" json:"status"`
+
+	// Price components
+	VehiclePrice       *float64 `gorm:"type:decimal(10,2)" json:"vehiclePrice,omitempty"`
+	DealerAddOns       *float64 `gorm:"type:decimal(10,2)" json:"dealerAddOns,omitempty"`
+	DocFee             *float64 `gorm:"type:decimal(10,2)" json:"docFee,omitempty"`
+	Taxes              *float64 `gorm:"type:decimal(10,2)" json:"taxes,omitempty"`
+	Registration       *float64 `gorm:"type:decimal(10,2)" json:"registration,omitempty"`
+	Rebates            *float64 `gorm:"type:decimal(10,2)" json:"rebates,omitempty"`
+	OutTheDoor         *float64 `gorm:"type:decimal(10,2)" json:"outTheDoor,omitempty"`
+	OutTheDoorComputed bool     `gorm:"not null;default:false" json:"outTheDoorComputed,omitempty"` // Summed from the components of a document that didn't state it
+
+	// Financing and lease terms
+	FinanceType    FinanceType `gorm:"type:varchar(20)" json:"financeType,omitempty"`
+	APR            *float64    `gorm:"type:decimal(5,2)" json:"apr,omitempty"`
+	TermMonths     *int        `json:"termMonths,omitempty"`
+	MonthlyPayment *float64    `gorm:"type:decimal(10,2)" json:"monthlyPayment,omitempty"`
+	DueAtSigning   *float64    `gorm:"type:decimal(10,2)" json:"dueAtSigning,omitempty"`
+	AnnualMileage  *int        `json:"annualMileage,omitempty"` // Lease mileage allowance
+
+	VIN         string     `gorm:"type:varchar(17)" json:"vin,omitempty"`
+	StockNumber string     `gorm:"type:varchar(40)" json:"stockNumber,omitempty"`
+	ExpiresAt   *time.Time `gorm:"index" json:"expiresAt,omitempty"`
+	UpdatedAt   *time.Time `json:"updatedAt,omitempty"` // Unset on offers from before structured terms, until migrated
 
 	Thread  *Thread  `gorm:"foreignKey:ThreadID" json:"thread,omitempty"`
 	Message *Message `gorm:"foreignKey:MessageID" json:"message,omitempty"`
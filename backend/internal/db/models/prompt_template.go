@@ -0,0 +1,27 @@
+package models
+
+import (
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// PromptTemplate is one version of the prompt for an LLM purpose: a Go text/template defining
+// "system" and "prompt" templates. Versions are never edited; changes are saved as a new version.
+type PromptTemplate struct {
+	ID        uuid.UUID  `gorm:"type:uuid;primary_key;default:gen_random_uuid()" json:"id"`
+	Purpose   LLMPurpose `gorm:"type:varchar(40);not null;uniqueIndex:idx_prompt_templates_purpose_version,priority:1" json:"purpose"`
+	Version   int        `gorm:"not null;uniqueIndex:idx_prompt_templates_purpose_version,priority:2" json:"version"`
+	Body      string     `gorm:"type:text;not null" json:"body"`
+	Notes     string     `gorm:"type:text" json:"notes,omitempty"` // What changed and why
+	CreatedAt time.Time  `json:"createdAt"`
+}
+
+// PromptDeployment is which prompt template version a purpose uses: the active version, or
+// during an experiment, a version assigned to each user by weight
+type PromptDeployment struct {
+	Purpose       LLMPurpose `gorm:"type:varchar(40);primary_key" json:"purpose"`
+	ActiveVersion int        `gorm:"not null" json:"activeVersion"`
+	Experiment    *string    `gorm:"type:jsonb" json:"experiment,omitempty"` // [{"version": 2, "weight": 50}, ...]
+	UpdatedAt     time.Time  `json:"updatedAt"`
+}
@@ -0,0 +1,30 @@
+package models
+
+import (
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// SMSNumber is a phone number provisioned for a user so dealers can text them
+type SMSNumber struct {
+	ID         uuid.UUID  `gorm:"type:uuid;primary_key;default:gen_random_uuid()" json:"id"`
+	UserID     uuid.UUID  `gorm:"type:uuid;index;not null" json:"userId"`
+	Number     string     `gorm:"type:varchar(20);uniqueIndex;not null" json:"number"` // E.164
+	Provider   string     `gorm:"type:varchar(20);not null" json:"provider"`
+	ReleasedAt *time.Time `gorm:"index" json:"releasedAt,omitempty"`
+	CreatedAt  time.Time  `json:"createdAt"`
+	UpdatedAt  time.Time  `json:"updatedAt"`
+
+	User *User `gorm:"foreignKey:UserID" json:"user,omitempty"`
+}
+
+// SMSOptOut records a phone that texted STOP to one of our numbers. Nothing more may be sent
+// from that number to the phone until it texts START.
+type SMSOptOut struct {
+	ID        uuid.UUID `gorm:"type:uuid;primary_key;default:gen_random_uuid()" json:"id"`
+	Number    string    `gorm:"type:varchar(20);uniqueIndex:idx_sms_opt_out_pair;not null" json:"number"` // Our number, E.164
+	Phone     string    `gorm:"type:varchar(20);uniqueIndex:idx_sms_opt_out_pair;not null" json:"phone"`  // Their phone, E.164
+	Keyword   string    `gorm:"type:varchar(20)" json:"keyword"`
+	CreatedAt time.Time `json:"createdAt"`
+}
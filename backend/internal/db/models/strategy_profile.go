@@ -0,0 +1,28 @@
+package models
+
+import (
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// StrategyProfile is a negotiation approach a thread's agent follows: instructions added to its
+// prompt, how to open the conversation, and when to hand decisions back to the buyer. Built-in
+// profiles have a key and no user; users define their own and reuse them across threads.
+type StrategyProfile struct {
+	ID              uuid.UUID  `gorm:"type:uuid;primary_key;default:gen_random_uuid()" json:"id"`
+	UserID          *uuid.UUID `gorm:"type:uuid;index" json:"userId,omitempty"`     // Nil for built-in profiles
+	Key             string     `gorm:"type:varchar(40);index" json:"key,omitempty"` // Built-in profiles only, e.g. "hard_line"
+	Name            string     `gorm:"not null" json:"name"`
+	Description     string     `gorm:"type:text" json:"description,omitempty"`
+	PromptFragment  string     `gorm:"type:text;not null" json:"promptFragment"`
+	OpeningTemplate string     `gorm:"type:text" json:"openingTemplate,omitempty"` // Go text/template with the negotiation prompt variables
+	EscalationRules string     `gorm:"type:text" json:"escalationRules,omitempty"` // One rule per line
+	CreatedAt       time.Time  `json:"createdAt"`
+	UpdatedAt       time.Time  `json:"updatedAt"`
+}
+
+// Builtin reports whether the profile ships with the app
+func (p *StrategyProfile) Builtin() bool {
+	return p.UserID == nil
+}
@@ -14,18 +14,30 @@ const (
 	SellerTypeOther      SellerType = "other"
 )
 
+// ThreadType tells a conversation with a seller apart from the user's conversation with the
+// master agent, which works across all their seller threads
+type ThreadType string
+
+const (
+	ThreadTypeSeller ThreadType = "seller"
+	ThreadTypeMaster ThreadType = "master"
+)
+
 type Thread struct {
-	ID             uuid.UUID  `gorm:"type:uuid;primary_key;default:gen_random_uuid()" json:"id"`
-	UserID         uuid.UUID  `gorm:"type:uuid;index;not null" json:"userId"`
-	SellerName     string     `gorm:"not null" json:"sellerName"`
-	SellerType     SellerType `gorm:"type:varchar(20);not null" json:"sellerType"`
-	CreatedAt      time.Time  `json:"createdAt"`
-	UpdatedAt      time.Time  `json:"updatedAt"`
-	LastMessageAt  *time.Time `json:"lastMessageAt,omitempty"`
-	MessageCount   int        `gorm:"default:0" json:"messageCount"`
-	DeletedAt      *time.Time `gorm:"index" json:"deletedAt,omitempty"`
-
-	User          *User          `gorm:"foreignKey:UserID" json:"user,omitempty"`
-	Messages      []Message      `gorm:"foreignKey:ThreadID" json:"messages,omitempty"`
-	TrackedOffers []TrackedOffer `gorm:"foreignKey:ThreadID" json:"trackedOffers,omitempty"`
+	ID                uuid.UUID  `gorm:"type:uuid;primary_key;default:gen_random_uuid()" json:"id"`
+	UserID            uuid.UUID  `gorm:"type:uuid;index;not null" json:"userId"`
+	SellerName        string     `gorm:"not null" json:"sellerName"`
+	SellerType        SellerType `gorm:"type:varchar(20);not null" json:"sellerType"`
+	Type              ThreadType `gorm:"type:varchar(20);not null;default:'seller';index" json:"type"`
+	StrategyProfileID *uuid.UUID `gorm:"type:uuid;index" json:"strategyProfileId,omitempty"` // Nil uses the agent's default approach
+	CreatedAt         time.Time  `json:"createdAt"`
+	UpdatedAt         time.Time  `json:"updatedAt"`
+	LastMessageAt     *time.Time `json:"lastMessageAt,omitempty"`
+	MessageCount      int        `gorm:"default:0" json:"messageCount"`
+	DeletedAt         *time.Time `gorm:"index" json:"deletedAt,omitempty"`
+
+	User          *User            `gorm:"foreignKey:UserID" json:"user,omitempty"`
+	Messages      []Message        `gorm:"foreignKey:ThreadID" json:"messages,omitempty"`
+	TrackedOffers []TrackedOffer   `gorm:"foreignKey:ThreadID" json:"trackedOffers,omitempty"`
+	Strategy      *StrategyProfile `gorm:"foreignKey:StrategyProfileID" json:"strategy,omitempty"`
 }
@@ -0,0 +1,25 @@
+package models
+
+import (
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// ThreadSummary is a running summary of the key facts in a negotiation thread: prices,
+// concessions, vehicle details and deadlines. It keeps them in the agent's context after the
+// messages they came from are too old to be sent with each request.
+type ThreadSummary struct {
+	ID                 uuid.UUID  `gorm:"type:uuid;primary_key;default:gen_random_uuid()" json:"id"`
+	ThreadID           uuid.UUID  `gorm:"type:uuid;uniqueIndex;not null" json:"threadId"`
+	UserID             uuid.UUID  `gorm:"type:uuid;index;not null" json:"userId"`
+	Content            string     `gorm:"type:text;not null" json:"content"`
+	SummarizedThrough  *time.Time `json:"summarizedThrough,omitempty"`            // Timestamp of the newest message included
+	SummarizedSequence int64      `gorm:"not null;default:0" json:"-"`            // Sequence of the last message included - later insertions are new, whatever their timestamp
+	MessageCount       int        `gorm:"not null;default:0" json:"messageCount"` // Messages included so far
+	EditedAt           *time.Time `json:"editedAt,omitempty"`                     // Last edited by the user
+	CreatedAt          time.Time  `json:"createdAt"`
+	UpdatedAt          time.Time  `json:"updatedAt"`
+
+	Thread *Thread `gorm:"foreignKey:ThreadID" json:"thread,omitempty"`
+}
@@ -0,0 +1,38 @@
+package models
+
+import (
+	"time"
+
+	"github.com/google/uuid"
+)
+
+type WebhookEventStatus string
+
+const (
+	WebhookEventStatusReceived  WebhookEventStatus = "received"  // Stored, not yet processed
+	WebhookEventStatusProcessed WebhookEventStatus = "processed" // Message created (or already existed)
+	WebhookEventStatusIgnored   WebhookEventStatus = "ignored"   // No user for the recipient address
+	WebhookEventStatusFailed    WebhookEventStatus = "failed"    // Parsing or processing failed - can be replayed
+	WebhookEventStatusRejected  WebhookEventStatus = "rejected"  // Failed verification - never processed
+)
+
+// WebhookEvent records every raw inbound email webhook so failures can be inspected and replayed.
+// The payload itself lives in blob storage under PayloadKey.
+type WebhookEvent struct {
+	ID                uuid.UUID          `gorm:"type:uuid;primary_key;default:gen_random_uuid()" json:"id"`
+	Provider          string             `gorm:"type:varchar(20);index;not null" json:"provider"`
+	ContentType       string             `json:"contentType"`
+	RawQuery          string             `json:"rawQuery,omitempty"` // Query string without the webhook secret
+	PayloadKey        string             `gorm:"not null" json:"-"`
+	PayloadBytes      int64              `gorm:"not null" json:"payloadBytes"`
+	Status            WebhookEventStatus `gorm:"type:varchar(20);index;not null" json:"status"`
+	Error             string             `gorm:"type:text" json:"error,omitempty"`
+	Attempts          int                `gorm:"not null;default:0" json:"attempts"`
+	Recipient         string             `json:"recipient,omitempty"`
+	ExternalMessageID string             `gorm:"index" json:"externalMessageId,omitempty"`
+	UserID            *uuid.UUID         `gorm:"type:uuid;index" json:"userId,omitempty"`
+	MessageID         *uuid.UUID         `gorm:"type:uuid" json:"messageId,omitempty"`
+	ProcessedAt       *time.Time         `json:"processedAt,omitempty"`
+	CreatedAt         time.Time          `json:"createdAt"`
+	UpdatedAt         time.Time          `json:"updatedAt"`
+}
@@ -0,0 +1,338 @@
+package db
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	"carbuyer/internal/db/models"
+
+	"gorm.io/gorm"
+)
+
+// migrateTrackedOffers fills in the structured terms of offers tracked before offers had them.
+// Offers detected in seller messages take their terms from the detection details; the rest are
+// read from their text. Such offers have no updated_at until they are migrated.
+func migrateTrackedOffers(db *gorm.DB) error {
+	var offers []models.TrackedOffer
+	if err := db.Where("updated_at IS NULL").Find(&offers).Error; err != nil {
+		return fmt.Errorf("failed to load offers to migrate: %w", err)
+	}
+	if len(offers) == 0 {
+		return nil
+	}
+
+	structured := 0
+	for i := range offers {
+		offer := &offers[i]
+		if offer.Details == nil || !applyOfferDetails(offer, *offer.Details) {
+			parseOfferText(offer)
+		}
+		if offer.VehiclePrice != nil || offer.OutTheDoor != nil || offer.MonthlyPayment != nil {
+			structured++
+		}
+
+		now := time.Now()
+		offer.UpdatedAt = &now
+		if err := db.Model(offer).Select(
+			"vehicle_price", "dealer_add_ons", "doc_fee", "taxes", "registration", "rebates", "out_the_door",
+			"finance_type", "apr", "term_months", "monthly_payment", "due_at_signing", "vin", "stock_number",
+			"expires_at", "updated_at",
+		).Updates(offer).Error; err != nil {
+			return fmt.Errorf("failed to migrate offer %s: %w", offer.ID, err)
+		}
+	}
+
+	log.Printf("Migrated %d tracked offers to structured terms (%d with prices)", len(offers), structured)
+	return nil
+}
+
+// applyOfferDetails copies the terms detected in a seller message onto an offer
+func applyOfferDetails(offer *models.TrackedOffer, details string) bool {
+	var detected struct {
+		VehiclePrice   *float64 `json:"vehiclePrice"`
+		DealerAddOns   *float64 `json:"dealerAddOns"`
+		DocFee         *float64 `json:"docFee"`
+		Taxes          *float64 `json:"taxes"`
+		Registration   *float64 `json:"registration"`
+		Rebates        *float64 `json:"rebates"`
+		OutTheDoor     *float64 `json:"outTheDoor"`
+		FinanceType    string   `json:"financeType"`
+		APR            *float64 `json:"apr"`
+		TermMonths     *int     `json:"termMonths"`
+		MonthlyPayment *float64 `json:"monthlyPayment"`
+		DueAtSigning   *float64 `json:"dueAtSigning"`
+		ExpiresAt      string   `json:"expiresAt"`
+	}
+	if err := json.Unmarshal([]byte(details), &detected); err != nil {
+		return false
+	}
+
+	offer.VehiclePrice = detected.VehiclePrice
+	offer.DealerAddOns = detected.DealerAddOns
+	offer.DocFee = detected.DocFee
+	offer.Taxes = detected.Taxes
+	offer.Registration = detected.Registration
+	offer.Rebates = detected.Rebates
+	offer.OutTheDoor = detected.OutTheDoor
+	offer.FinanceType = models.FinanceType(detected.FinanceType)
+	offer.APR = detected.APR
+	offer.TermMonths = detected.TermMonths
+	offer.MonthlyPayment = detected.MonthlyPayment
+	offer.DueAtSigning = detected.DueAtSigning
+	if day, err := time.Parse("2006-01-02", detected.ExpiresAt); err == nil {
+		end := day.Add(24*time.Hour - time.Second)
+		offer.ExpiresAt = &end
+	}
+	return true
+}
+
+var (
+	offerAmountPattern = regexp.MustCompile(`(?i)(-)?\$\s?(\d{1,3}(?:,\d{3})+|\d+)(?:\.(\d{1,2}))?\s*(k\b)?|\b(\d{1,3}(?:,\d{3})+|\d{4,6})(?:\.(\d{1,2}))?\b|\b(\d{2,3}(?:\.\d)?)k\b`)
+	offerAPRPattern    = regexp.MustCompile(`(?i)(\d{1,2}(?:\.\d{1,2})?)\s?%`)
+	offerTermPattern   = regexp.MustCompile(`(?i)\b(\d{2,3})\s?(?:-\s?)?(?:months?|mos?)\b`)
+	offerVINPattern    = regexp.MustCompile(`\b[A-HJ-NPR-Z0-9]{17}\b`)
+	offerStockPattern  = regexp.MustCompile(`(?i)\bstock\s*(?:#|no\.?|number)?\s*:?\s*#?([A-Z0-9][A-Z0-9-]{2,39})\b`)
+)
+
+// offerAmountLabels classifies an amount by the words around it, most specific first
+var offerAmountLabels = []struct {
+	keywords []string
+	field    func(*models.TrackedOffer) **float64
+}{
+	{[]string{"due at signing", "due at sign", "das", "down"}, func(o *models.TrackedOffer) **float64 { return &o.DueAtSigning }},
+	{[]string{"/mo", "per month", "a month", "monthly", "/month"}, func(o *models.TrackedOffer) **float64 { return &o.MonthlyPayment }},
+	{[]string{"otd", "out the door", "out-the-door", "total"}, func(o *models.TrackedOffer) **float64 { return &o.OutTheDoor }},
+	{[]string{"doc fee", "doc", "documentation", "processing"}, func(o *models.TrackedOffer) **float64 { return &o.DocFee }},
+	{[]string{"tax"}, func(o *models.TrackedOffer) **float64 { return &o.Taxes }},
+	{[]string{"registration", "title", "license", "tag"}, func(o *models.TrackedOffer) **float64 { return &o.Registration }},
+	{[]string{"add-on", "addon", "accessor", "package", "market adjustment", "markup", "protection"}, func(o *models.TrackedOffer) **float64 { return &o.DealerAddOns }},
+	{[]string{"rebate", "discount", "incentive", "off"}, func(o *models.TrackedOffer) **float64 { return &o.Rebates }},
+	{[]string{"vehicle", "price", "sale", "selling", "asking"}, func(o *models.TrackedOffer) **float64 { return &o.VehiclePrice }},
+}
+
+// parseOfferText reads what terms it can from a free-text offer, such as
+// "$38,900 OTD, expires Friday" or "OTD $42,650 - Vehicle $38,900, Doc fee $799". Each amount
+// is labelled by the words just before it, else just after it; a lone unlabelled amount is
+// taken as the vehicle price.
+func parseOfferText(offer *models.TrackedOffer) {
+	text := offer.OfferText
+
+	if strings.Contains(strings.ToLower(text), "lease") {
+		offer.FinanceType = models.FinanceTypeLease
+	}
+	if match := offerAPRPattern.FindStringSubmatch(text); match != nil {
+		if apr, err := strconv.ParseFloat(match[1], 64); err == nil && apr <= 40 {
+			offer.APR = &apr
+			if offer.FinanceType == "" {
+				offer.FinanceType = models.FinanceTypeFinance
+			}
+		}
+	}
+	if match := offerTermPattern.FindStringSubmatch(text); match != nil {
+		if term, err := strconv.Atoi(match[1]); err == nil && term > 0 && term <= 120 {
+			offer.TermMonths = &term
+		}
+	}
+	if vin := offerVINPattern.FindString(strings.ToUpper(text)); vin != "" && strings.ContainsAny(vin, "0123456789") && strings.ContainsAny(vin, "ABCDEFGHJKLMNPRSTUVWXYZ") {
+		offer.VIN = vin
+	}
+	if match := offerStockPattern.FindStringSubmatch(text); match != nil {
+		offer.StockNumber = strings.ToUpper(match[1])
+	}
+
+	var unlabelled []float64
+	for _, clause := range splitOfferClauses(text) {
+		lower := strings.ToLower(clause)
+		amounts := offerAmounts(clause)
+
+		// Words after an amount that label it aren't also read as labelling the next one
+		consumed := false
+		for i, amount := range amounts {
+			prevEnd, nextStart := 0, len(lower)
+			if i > 0 {
+				prevEnd = amounts[i-1].end
+			}
+			if i+1 < len(amounts) {
+				nextStart = amounts[i+1].start
+			}
+
+			var field **float64
+			if !consumed {
+				field = offerAmountField(offer, lastWords(lower[prevEnd:amount.start], 3))
+			}
+			consumed = false
+			if field == nil {
+				field = offerAmountField(offer, firstWords(lower[amount.end:nextStart], 3))
+				consumed = field != nil
+			}
+
+			if field == nil {
+				unlabelled = append(unlabelled, amount.value)
+				continue
+			}
+			if *field == nil {
+				value := amount.value
+				*field = &value
+			}
+		}
+	}
+
+	if len(unlabelled) == 1 && offer.VehiclePrice == nil && offer.OutTheDoor == nil && offer.MonthlyPayment == nil {
+		offer.VehiclePrice = &unlabelled[0]
+	}
+}
+
+// lastWords returns the last n words of text
+func lastWords(text string, n int) string {
+	words := strings.Fields(text)
+	if len(words) > n {
+		words = words[len(words)-n:]
+	}
+	return strings.Join(words, " ")
+}
+
+// firstWords returns the first n words of text
+func firstWords(text string, n int) string {
+	words := strings.Fields(text)
+	if len(words) > n {
+		words = words[:n]
+	}
+	return strings.Join(words, " ")
+}
+
+// offerAmountField picks the field a clause's amount belongs to
+func offerAmountField(offer *models.TrackedOffer, clause string) **float64 {
+	for _, label := range offerAmountLabels {
+		for _, keyword := range label.keywords {
+			if containsWord(clause, keyword) {
+				return label.field(offer)
+			}
+		}
+	}
+	return nil
+}
+
+// containsWord reports whether keyword appears in text, not as part of a longer word
+func containsWord(text, keyword string) bool {
+	for start := 0; ; {
+		i := strings.Index(text[start:], keyword)
+		if i < 0 {
+			return false
+		}
+		i += start
+		end := i + len(keyword)
+		before := i == 0 || !isWordByte(text[i-1]) || !isWordByte(keyword[0])
+		after := end == len(text) || !isWordByte(text[end]) || !isWordByte(keyword[len(keyword)-1])
+		// Allow plurals and "taxes", "fees" and the like
+		if !after && (text[end] == 's' || strings.HasPrefix(text[end:], "es")) {
+			after = true
+		}
+		if before && after {
+			return true
+		}
+		start = i + 1
+	}
+}
+
+func isWordByte(b byte) bool {
+	return b >= 'a' && b <= 'z' || b >= '0' && b <= '9'
+}
+
+// splitOfferClauses splits offer text at commas, semicolons, parentheses, newlines and
+// spaced dashes, keeping thousands separators intact
+func splitOfferClauses(text string) []string {
+	var clauses []string
+	start := 0
+	for i := 0; i < len(text); i++ {
+		split := false
+		switch text[i] {
+		case ';', '(', ')', '\n':
+			split = true
+		case ',':
+			// 38,900 is one number
+			split = !(i > 0 && isDigit(text[i-1]) && i+4 <= len(text) && allDigits(text[i+1:i+4]) &&
+				(i+4 == len(text) || !isDigit(text[i+4])))
+		case '-':
+			split = i > 0 && text[i-1] == ' ' && i+1 < len(text) && text[i+1] == ' '
+		}
+		if split {
+			clauses = append(clauses, text[start:i])
+			start = i + 1
+		}
+	}
+	return append(clauses, text[start:])
+}
+
+func isDigit(b byte) bool {
+	return b >= '0' && b <= '9'
+}
+
+func allDigits(s string) bool {
+	for i := 0; i < len(s); i++ {
+		if !isDigit(s[i]) {
+			return false
+		}
+	}
+	return true
+}
+
+// offerAmount is a dollar amount found in offer text, and where it is
+type offerAmount struct {
+	value      float64
+	start, end int
+}
+
+// offerAmounts returns the dollar amounts in a clause. Bare numbers count as dollars only when
+// they look like prices; percentages, terms, years and mileage are skipped.
+func offerAmounts(clause string) []offerAmount {
+	var amounts []offerAmount
+	for _, match := range offerAmountPattern.FindAllStringSubmatchIndex(clause, -1) {
+		group := func(n int) string {
+			if match[2*n] < 0 {
+				return ""
+			}
+			return clause[match[2*n]:match[2*n+1]]
+		}
+		end := match[1]
+		rest := strings.ToLower(strings.TrimSpace(clause[end:]))
+
+		var number string
+		thousands := false
+		switch {
+		case group(2) != "":
+			number, thousands = group(2)+"."+group(3), group(4) != ""
+		case group(5) != "":
+			// Years, mileage and percentages aren't prices
+			if strings.HasPrefix(rest, "%") || strings.HasPrefix(rest, "mi") || strings.HasPrefix(rest, "month") || strings.HasPrefix(rest, "mo") {
+				continue
+			}
+			if year, err := strconv.Atoi(group(5)); err == nil && year >= 1990 && year <= 2100 && !strings.Contains(group(5), ",") {
+				continue
+			}
+			number = group(5) + "." + group(6)
+		case group(7) != "":
+			if strings.HasPrefix(rest, "mi") {
+				continue
+			}
+			number, thousands = group(7), true
+		}
+
+		value, err := strconv.ParseFloat(strings.TrimSuffix(strings.ReplaceAll(number, ",", ""), "."), 64)
+		if err != nil {
+			continue
+		}
+		if thousands {
+			value *= 1000
+		}
+		if value < 50 {
+			continue
+		}
+		amounts = append(amounts, offerAmount{value: value, start: match[0], end: end})
+	}
+	return amounts
+}
@@ -0,0 +1,112 @@
+package db
+
+import (
+	"testing"
+
+	"carbuyer/internal/db/models"
+)
+
+func TestParseOfferText(t *testing.T) {
+	type want struct {
+		vehiclePrice, outTheDoor, docFee, taxes, addOns, rebates, monthly, dueAtSigning float64
+		apr                                                                             float64
+		term                                                                            int
+		financeType                                                                     models.FinanceType
+		vin, stock                                                                      string
+	}
+
+	tests := []struct {
+		text string
+		want want
+	}{
+		{
+			text: "OTD $42,650 - Vehicle $38,900, Doc fee $799, Tax $2,951",
+			want: want{outTheDoor: 42650, vehiclePrice: 38900, docFee: 799, taxes: 2951},
+		},
+		{
+			text: "$38,900 out the door, expires Friday",
+			want: want{outTheDoor: 38900},
+		},
+		{
+			text: "Best price $36,500 plus $1,295 protection package and $899 doc fees",
+			want: want{vehiclePrice: 36500, addOns: 1295, docFee: 899},
+		},
+		{
+			text: "Doc fee $799 and tax $2,951",
+			want: want{docFee: 799, taxes: 2951},
+		},
+		{
+			text: "36,500; $1,295 protection package; $899 doc fees",
+			want: want{vehiclePrice: 36500, addOns: 1295, docFee: 899},
+		},
+		{
+			text: "Lease $489/mo, 36 months, $2,999 due at signing, 12,000 miles",
+			want: want{monthly: 489, term: 36, dueAtSigning: 2999, financeType: models.FinanceTypeLease},
+		},
+		{
+			text: "2025 Explorer XLT for 41.5k with 4.9% APR for 60 months, $1,000 rebate",
+			want: want{vehiclePrice: 41500, apr: 4.9, term: 60, rebates: 1000, financeType: models.FinanceTypeFinance},
+		},
+		{
+			text: "Stock #F24187 VIN 1FMSK8DH5RGA12345 at $39,995",
+			want: want{vehiclePrice: 39995, vin: "1FMSK8DH5RGA12345", stock: "F24187"},
+		},
+		{
+			text: "Will call back tomorrow",
+		},
+	}
+
+	value := func(v *float64) float64 {
+		if v == nil {
+			return 0
+		}
+		return *v
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.text, func(t *testing.T) {
+			offer := models.TrackedOffer{OfferText: tt.text}
+			parseOfferText(&offer)
+
+			term := 0
+			if offer.TermMonths != nil {
+				term = *offer.TermMonths
+			}
+			got := want{
+				vehiclePrice: value(offer.VehiclePrice),
+				outTheDoor:   value(offer.OutTheDoor),
+				docFee:       value(offer.DocFee),
+				taxes:        value(offer.Taxes),
+				addOns:       value(offer.DealerAddOns),
+				rebates:      value(offer.Rebates),
+				monthly:      value(offer.MonthlyPayment),
+				dueAtSigning: value(offer.DueAtSigning),
+				apr:          value(offer.APR),
+				term:         term,
+				financeType:  offer.FinanceType,
+				vin:          offer.VIN,
+				stock:        offer.StockNumber,
+			}
+			if got != tt.want {
+				t.Errorf("parseOfferText()\n got  %+v\n want %+v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestApplyOfferDetails(t *testing.T) {
+	offer := models.TrackedOffer{OfferText: "OTD $42,650"}
+	if !applyOfferDetails(&offer, `{"outTheDoor": 42650, "financeType": "finance", "apr": 3.9, "termMonths": 60, "expiresAt": "2026-10-31"}`) {
+		t.Fatal("applyOfferDetails() = false")
+	}
+	if offer.OutTheDoor == nil || *offer.OutTheDoor != 42650 || offer.APR == nil || *offer.TermMonths != 60 || offer.FinanceType != models.FinanceTypeFinance {
+		t.Errorf("applyOfferDetails() = %+v", offer)
+	}
+	if offer.ExpiresAt == nil || offer.ExpiresAt.Format("2006-01-02") != "2026-10-31" {
+		t.Errorf("ExpiresAt = %v, want end of 2026-10-31", offer.ExpiresAt)
+	}
+
+	if applyOfferDetails(&offer, "not json") {
+		t.Error("applyOfferDetails() with invalid JSON = true")
+	}
+}
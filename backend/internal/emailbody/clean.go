@@ -0,0 +1,248 @@
+// Package emailbody extracts the newly written part of an inbound email, removing
+// quoted replies, forwarded-message headers, signatures and legal footers.
+package emailbody
+
+import (
+	"regexp"
+	"strings"
+)
+
+// Signature blocks longer than this after a closing line are treated as message content
+const (
+	maxSignatureLines      = 8
+	maxSignatureLineLength = 80
+)
+
+var (
+	// "On Mon, Jan 6, 2025 at 3:04 PM Jane Doe <jane@example.com> wrote:"
+	replyAttributionPattern = regexp.MustCompile(`(?i)^on\b.*\bwrote:$`)
+	originalMessagePattern  = regexp.MustCompile(`(?i)^-{2,}\s*original message\s*-{2,}$`)
+	outlookSeparatorPattern = regexp.MustCompile(`^_{10,}$`)
+	headerFromPattern       = regexp.MustCompile(`(?i)^\*?from:\*?\s*\S`)
+	headerDatePattern       = regexp.MustCompile(`(?i)^\*?(sent|date):\*?\s*\S`)
+	headerToPattern         = regexp.MustCompile(`(?i)^\*?(to|subject):\*?`)
+	headerLinePattern       = regexp.MustCompile(`(?i)^\*?(from|date|sent|subject|to|cc|reply-to):\*?`)
+
+	forwardMarkerPattern = regexp.MustCompile(`(?i)^(-{2,}\s*forwarded message\s*-{2,}|begin forwarded message:?)$`)
+
+	// Mobile client taglines, signature separators, legal disclaimers and CRM footers
+	footerPatterns = []*regexp.Regexp{
+		regexp.MustCompile(`^--$`),
+		regexp.MustCompile(`(?i)^sent (from|via|with) (my|the) \w+`),
+		regexp.MustCompile(`(?i)^sent from (mail|outlook) for windows`),
+		regexp.MustCompile(`(?i)^sent from yahoo mail`),
+		regexp.MustCompile(`(?i)^get outlook for (ios|android)`),
+		regexp.MustCompile(`(?i)^(confidentiality|privileged|legal) notice`),
+		regexp.MustCompile(`(?i)^disclaimer:`),
+		regexp.MustCompile(`(?i)^this (e-?mail|message|communication|transmission)\b.*\b(confidential|privileged|intended (only |solely )?for)`),
+		regexp.MustCompile(`(?i)^the information (contained )?in this (e-?mail|message|communication|transmission)`),
+		regexp.MustCompile(`(?i)^(to )?unsubscribe\b|click here to unsubscribe|\bopt[- ]out of (future|these)`),
+		regexp.MustCompile(`(?i)^you are receiving this (e-?mail|message)`),
+		regexp.MustCompile(`(?i)^this (e-?mail|message) was sent (to|by|on behalf of)`),
+		regexp.MustCompile(`(?i)^powered by \w+`),
+	}
+
+	closingPattern = regexp.MustCompile(`(?i)^(thanks|thank you|thanks again|many thanks|best|all the best|best regards|kind regards|warm regards|regards|sincerely|cheers|respectfully|talk soon)[,.!]*$`)
+
+	invisibleReplacer = strings.NewReplacer(
+		"\r\n", "\n",
+		"\r", "\n",
+		"\u00a0", " ",
+		"\u200b", "",
+		"\ufeff", "",
+	)
+)
+
+// Clean returns the new content of an email. The plain text body is preferred; HTML-only
+// messages are converted to text first.
+func Clean(plain, html string) string {
+	text := plain
+	if strings.TrimSpace(text) == "" {
+		text = HTMLToText(html)
+	}
+	return CleanText(text)
+}
+
+// CleanText removes quoted replies, forwarded-message headers, signatures and footers from
+// a plain text email body
+func CleanText(text string) string {
+	lines := strings.Split(invisibleReplacer.Replace(text), "\n")
+	for i, line := range lines {
+		lines[i] = strings.TrimRight(line, " \t")
+	}
+
+	lines = unwrapForward(lines)
+	lines = stripQuotedReply(lines)
+	lines = stripFooter(lines)
+	lines = stripSignature(lines)
+
+	return joinLines(lines)
+}
+
+// unwrapForward returns the forwarded message when the email is a forward. Users forward
+// dealer emails into their inbox, so the forwarded content is what matters - the
+// forwarder's own note and the forwarded headers are dropped.
+func unwrapForward(lines []string) []string {
+	for i, line := range lines {
+		trimmed := strings.TrimSpace(line)
+		if isReplyHeader(lines, i) {
+			// A quoted reply comes first - this is not a forward
+			return lines
+		}
+		if !forwardMarkerPattern.MatchString(trimmed) {
+			continue
+		}
+
+		// Skip the From/Date/Subject/To block that follows the marker
+		j := i + 1
+		for j < len(lines) {
+			next := strings.TrimSpace(lines[j])
+			if next != "" && !headerLinePattern.MatchString(next) {
+				break
+			}
+			j++
+		}
+
+		// Forwards of forwards unwrap to the innermost message
+		return unwrapForward(lines[j:])
+	}
+
+	return lines
+}
+
+// stripQuotedReply cuts the body at the first reply header and drops ">" quoted lines
+func stripQuotedReply(lines []string) []string {
+	var kept []string
+	for i, line := range lines {
+		if isReplyHeader(lines, i) {
+			break
+		}
+		if strings.HasPrefix(strings.TrimSpace(line), ">") {
+			continue
+		}
+		kept = append(kept, line)
+	}
+	return kept
+}
+
+// isReplyHeader reports whether lines[i] starts the quoted previous message
+func isReplyHeader(lines []string, i int) bool {
+	line := strings.TrimSpace(lines[i])
+	if line == "" {
+		return false
+	}
+
+	if originalMessagePattern.MatchString(line) || isReplyAttribution(line) {
+		return true
+	}
+
+	// Gmail wraps long attributions onto a second line
+	if strings.HasPrefix(line, "On ") && i+1 < len(lines) &&
+		isReplyAttribution(line+" "+strings.TrimSpace(lines[i+1])) {
+		return true
+	}
+
+	if outlookSeparatorPattern.MatchString(line) {
+		for j := i + 1; j < len(lines) && j <= i+2; j++ {
+			if headerFromPattern.MatchString(strings.TrimSpace(lines[j])) {
+				return true
+			}
+		}
+	}
+
+	// Outlook inlines the previous message's headers: From:, Sent:, To:, Subject:
+	if headerFromPattern.MatchString(line) {
+		hasDate, hasTo := false, false
+		for j := i + 1; j < len(lines) && j <= i+4; j++ {
+			next := strings.TrimSpace(lines[j])
+			hasDate = hasDate || headerDatePattern.MatchString(next)
+			hasTo = hasTo || headerToPattern.MatchString(next)
+		}
+		return hasDate && hasTo
+	}
+
+	return false
+}
+
+// isReplyAttribution matches "On <date>, <name> wrote:". Real attributions always carry a
+// date or an address, which keeps sentences like "On Monday my manager wrote:" intact.
+func isReplyAttribution(line string) bool {
+	return replyAttributionPattern.MatchString(line) && strings.ContainsAny(line, "@0123456789")
+}
+
+// stripFooter cuts the body at the first mobile tagline, signature separator, legal
+// disclaimer or mailing footer that follows some content
+func stripFooter(lines []string) []string {
+	seenContent := false
+	for i, line := range lines {
+		trimmed := strings.TrimSpace(line)
+		if trimmed == "" {
+			continue
+		}
+		if seenContent {
+			for _, pattern := range footerPatterns {
+				if pattern.MatchString(trimmed) {
+					return lines[:i]
+				}
+			}
+		}
+		seenContent = true
+	}
+	return lines
+}
+
+// stripSignature drops the contact block after a closing like "Thanks," keeping the
+// closing and the sender's name. Long tails are left alone since they are more likely
+// to be message content than a signature.
+func stripSignature(lines []string) []string {
+	closing := -1
+	firstContent := -1
+	for i, line := range lines {
+		trimmed := strings.TrimSpace(line)
+		if trimmed == "" {
+			continue
+		}
+		if firstContent == -1 {
+			firstContent = i
+		}
+		if closingPattern.MatchString(trimmed) {
+			closing = i
+		}
+	}
+	if closing <= firstContent {
+		return lines
+	}
+
+	var tail []int
+	for i := closing + 1; i < len(lines); i++ {
+		trimmed := strings.TrimSpace(lines[i])
+		if trimmed == "" {
+			continue
+		}
+		if len(trimmed) > maxSignatureLineLength {
+			return lines
+		}
+		tail = append(tail, i)
+	}
+	if len(tail) == 0 || len(tail) > maxSignatureLines {
+		return lines
+	}
+
+	kept := append([]string{}, lines[:closing+1]...)
+	return append(kept, lines[tail[0]])
+}
+
+// joinLines joins lines, collapsing runs of blank lines and trimming the ends
+func joinLines(lines []string) string {
+	var out []string
+	for _, line := range lines {
+		if strings.TrimSpace(line) == "" {
+			if len(out) == 0 || out[len(out)-1] == "" {
+				continue
+			}
+			line = ""
+		}
+		out = append(out, line)
+	}
+	return strings.TrimSpace(strings.Join(out, "\n"))
+}
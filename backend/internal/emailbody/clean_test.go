@@ -0,0 +1,102 @@
+package emailbody
+
+import (
+	"flag"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+var update = flag.Bool("update", false, "rewrite golden files with the current output")
+
+// TestCleanGolden runs every fixture in testdata through Clean and compares the result with
+// its .golden file. Fixtures ending in .html are treated as HTML-only messages.
+func TestCleanGolden(t *testing.T) {
+	fixtures, err := filepath.Glob(filepath.Join("testdata", "*"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, fixture := range fixtures {
+		ext := filepath.Ext(fixture)
+		if ext != ".txt" && ext != ".html" {
+			continue
+		}
+
+		name := strings.TrimSuffix(filepath.Base(fixture), ext)
+		t.Run(name, func(t *testing.T) {
+			input, err := os.ReadFile(fixture)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			var got string
+			if ext == ".html" {
+				got = Clean("", string(input))
+			} else {
+				got = Clean(string(input), "")
+			}
+
+			goldenPath := strings.TrimSuffix(fixture, ext) + ".golden"
+			if *update {
+				if err := os.WriteFile(goldenPath, []byte(got+"\n"), 0o644); err != nil {
+					t.Fatal(err)
+				}
+				return
+			}
+
+			want, err := os.ReadFile(goldenPath)
+			if err != nil {
+				t.Fatalf("missing golden file (run go test -update): %v", err)
+			}
+			if got != strings.TrimSuffix(string(want), "\n") {
+				t.Errorf("Clean(%s) mismatch\n--- got ---\n%s\n--- want ---\n%s", filepath.Base(fixture), got, want)
+			}
+		})
+	}
+}
+
+func TestCleanPrefersPlainText(t *testing.T) {
+	got := Clean("Plain body", "<p>HTML body</p>")
+	if got != "Plain body" {
+		t.Errorf("Clean() = %q, want %q", got, "Plain body")
+	}
+}
+
+func TestHTMLToText(t *testing.T) {
+	tests := []struct {
+		name string
+		html string
+		want string
+	}{
+		{
+			name: "Inline elements and entities",
+			html: "<p>Price: <b>$30,000</b> &amp; no&nbsp;fees</p>",
+			want: "Price: $30,000 & no fees",
+		},
+		{
+			name: "Line breaks and lists",
+			html: "Line one<br>Line two<ul><li>First</li><li>Second</li></ul>",
+			want: "Line one\nLine two\n- First\n- Second",
+		},
+		{
+			name: "Blockquotes become quoted lines",
+			html: "<div>Reply</div><blockquote><div>Original</div></blockquote>",
+			want: "Reply\n> Original",
+		},
+		{
+			name: "Scripts and styles are dropped",
+			html: "<style>p{color:red}</style><script>alert(1)</script><p>Visible</p>",
+			want: "Visible",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := HTMLToText(tt.html); got != tt.want {
+				t.Errorf("HTMLToText() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
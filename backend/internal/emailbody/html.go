@@ -0,0 +1,154 @@
+package emailbody
+
+import (
+	"strings"
+
+	"golang.org/x/net/html"
+	"golang.org/x/net/html/atom"
+)
+
+// HTMLToText converts an HTML email body to plain text. Block elements become line
+// breaks and blockquotes become ">" quoted lines so the text cleaner can strip them.
+func HTMLToText(src string) string {
+	if strings.TrimSpace(src) == "" {
+		return ""
+	}
+
+	doc, err := html.Parse(strings.NewReader(src))
+	if err != nil {
+		return ""
+	}
+
+	w := &textWriter{}
+	w.walk(doc)
+	w.endBlock()
+
+	return strings.TrimRight(strings.Join(w.lines, "\n"), "\n")
+}
+
+// textWriter accumulates rendered lines while walking an HTML tree
+type textWriter struct {
+	lines      []string
+	line       strings.Builder
+	quoteDepth int
+	preDepth   int
+	space      bool // A collapsed space is pending before the next word
+}
+
+func (w *textWriter) walk(n *html.Node) {
+	switch n.Type {
+	case html.TextNode:
+		w.text(n.Data)
+		return
+	case html.ElementNode:
+	default:
+		w.walkChildren(n)
+		return
+	}
+
+	switch n.DataAtom {
+	case atom.Script, atom.Style, atom.Head, atom.Title, atom.Noscript, atom.Template:
+		return
+	case atom.Br:
+		w.breakLine()
+	case atom.Hr:
+		w.endBlock()
+		w.blankLine()
+	case atom.Blockquote:
+		w.endBlock()
+		w.quoteDepth++
+		w.walkChildren(n)
+		w.endBlock()
+		w.quoteDepth--
+	case atom.P, atom.H1, atom.H2, atom.H3, atom.H4, atom.H5, atom.H6:
+		w.endBlock()
+		w.walkChildren(n)
+		w.endBlock()
+		w.blankLine()
+	case atom.Li:
+		w.endBlock()
+		w.line.WriteString("- ")
+		w.walkChildren(n)
+		w.endBlock()
+	case atom.Pre:
+		w.endBlock()
+		w.preDepth++
+		w.walkChildren(n)
+		w.preDepth--
+		w.endBlock()
+	case atom.Td, atom.Th:
+		w.walkChildren(n)
+		w.space = true
+	case atom.Div, atom.Table, atom.Tr, atom.Ul, atom.Ol, atom.Dl, atom.Dt, atom.Dd,
+		atom.Section, atom.Article, atom.Header, atom.Footer, atom.Center, atom.Address, atom.Form:
+		w.endBlock()
+		w.walkChildren(n)
+		w.endBlock()
+	default:
+		w.walkChildren(n)
+	}
+}
+
+func (w *textWriter) walkChildren(n *html.Node) {
+	for c := n.FirstChild; c != nil; c = c.NextSibling {
+		w.walk(c)
+	}
+}
+
+// text writes a text node, collapsing whitespace outside <pre>
+func (w *textWriter) text(s string) {
+	if w.preDepth > 0 {
+		for i, part := range strings.Split(s, "\n") {
+			if i > 0 {
+				w.breakLine()
+			}
+			w.line.WriteString(part)
+		}
+		return
+	}
+
+	if s == "" {
+		return
+	}
+	if strings.TrimLeft(s, " \t\r\n\f") != s {
+		w.space = true
+	}
+
+	words := strings.Fields(s)
+	for _, word := range words {
+		if w.space && w.line.Len() > 0 {
+			w.line.WriteByte(' ')
+		}
+		w.line.WriteString(word)
+		w.space = true
+	}
+	if len(words) > 0 && strings.TrimRight(s, " \t\r\n\f") == s {
+		w.space = false
+	}
+}
+
+// breakLine ends the current line, even if it is empty
+func (w *textWriter) breakLine() {
+	prefix := strings.Repeat("> ", w.quoteDepth)
+	w.lines = append(w.lines, strings.TrimRight(prefix+w.line.String(), " "))
+	w.line.Reset()
+	w.space = false
+}
+
+// endBlock ends the current line if anything has been written to it
+func (w *textWriter) endBlock() {
+	if w.line.Len() > 0 {
+		w.breakLine()
+	}
+	w.space = false
+}
+
+// blankLine adds a paragraph break unless the previous line is already blank
+func (w *textWriter) blankLine() {
+	if len(w.lines) == 0 {
+		return
+	}
+	if strings.Trim(w.lines[len(w.lines)-1], "> ") != "" {
+		w.breakLine()
+	}
+}
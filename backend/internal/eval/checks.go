@@ -0,0 +1,136 @@
+package eval
+
+import (
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// Names of the rule-based checks
+const (
+	CheckSellerNames    = "no_seller_names"
+	CheckLength         = "length"
+	CheckMetaCommentary = "no_meta_commentary"
+	CheckPriceLimit     = "within_price"
+)
+
+// CheckNames lists the rule-based checks in report order
+var CheckNames = []string{CheckSellerNames, CheckLength, CheckMetaCommentary, CheckPriceLimit}
+
+// CheckResult is the outcome of one rule-based check on a draft
+type CheckResult struct {
+	Name   string `json:"name"`
+	Passed bool   `json:"passed"`
+	Detail string `json:"detail,omitempty"` // Why it failed
+}
+
+// metaPrefixes start drafts that talk to the buyer instead of being the message to send
+var metaPrefixes = []string{
+	"here's",
+	"here is",
+	"sure",
+	"certainly",
+	"of course",
+	"absolutely",
+	"i've drafted",
+	"i have drafted",
+	"draft:",
+	"message:",
+}
+
+// metaPhrases anywhere in a draft are addressed to the buyer or are unfilled placeholders
+var metaPhrases = []string{
+	"as an ai",
+	"let me know if you'd like",
+	"let me know if you want",
+	"feel free to adjust",
+	"[your name]",
+	"[dealer name]",
+}
+
+// dollarAmount matches amounts such as $31,000, $31000.00 or $31.5k
+var dollarAmount = regexp.MustCompile(`\$\s?((?:\d{1,3}(?:,\d{3})+|\d+)(?:\.\d+)?)\s?([kK])?\b`)
+
+// RunChecks runs the rule-based checks on a draft for a request in a case
+func RunChecks(c *Case, history []Turn, output string) []CheckResult {
+	return []CheckResult{
+		checkSellerNames(c, output),
+		checkLength(c, output),
+		checkMetaCommentary(output),
+		checkPriceLimit(c, history, output),
+	}
+}
+
+// checkSellerNames fails drafts that name a competing seller
+func checkSellerNames(c *Case, output string) CheckResult {
+	lower := strings.ToLower(output)
+	for _, seller := range c.OtherSellers {
+		if seller != "" && strings.Contains(lower, strings.ToLower(seller)) {
+			return CheckResult{Name: CheckSellerNames, Detail: fmt.Sprintf("names competing seller %q", seller)}
+		}
+	}
+	return CheckResult{Name: CheckSellerNames, Passed: true}
+}
+
+// checkLength fails drafts longer than the case allows
+func checkLength(c *Case, output string) CheckResult {
+	length := len([]rune(output))
+	if length > c.maxChars() {
+		return CheckResult{Name: CheckLength, Detail: fmt.Sprintf("%d characters, limit %d", length, c.maxChars())}
+	}
+	return CheckResult{Name: CheckLength, Passed: true}
+}
+
+// checkMetaCommentary fails drafts with commentary for the buyer instead of only the message
+func checkMetaCommentary(output string) CheckResult {
+	lower := strings.ToLower(strings.TrimSpace(output))
+	for _, prefix := range metaPrefixes {
+		if strings.HasPrefix(lower, prefix) {
+			return CheckResult{Name: CheckMetaCommentary, Detail: fmt.Sprintf("starts with %q", prefix)}
+		}
+	}
+	for _, phrase := range metaPhrases {
+		if strings.Contains(lower, phrase) {
+			return CheckResult{Name: CheckMetaCommentary, Detail: fmt.Sprintf("contains %q", phrase)}
+		}
+	}
+	return CheckResult{Name: CheckMetaCommentary, Passed: true}
+}
+
+// checkPriceLimit fails drafts with a price above the buyer's maximum. Amounts already in the
+// conversation are allowed, since drafts may quote the seller's own price back to them.
+func checkPriceLimit(c *Case, history []Turn, output string) CheckResult {
+	if c.MaxPrice <= 0 {
+		return CheckResult{Name: CheckPriceLimit, Passed: true}
+	}
+
+	mentioned := map[float64]bool{}
+	for _, turn := range history {
+		for _, amount := range dollarAmounts(turn.Content) {
+			mentioned[amount] = true
+		}
+	}
+	for _, amount := range dollarAmounts(output) {
+		if amount > c.MaxPrice && !mentioned[amount] {
+			return CheckResult{Name: CheckPriceLimit, Detail: fmt.Sprintf("offers $%.0f, above the buyer's $%.0f", amount, c.MaxPrice)}
+		}
+	}
+	return CheckResult{Name: CheckPriceLimit, Passed: true}
+}
+
+// dollarAmounts returns the dollar amounts in text
+func dollarAmounts(text string) []float64 {
+	var amounts []float64
+	for _, match := range dollarAmount.FindAllStringSubmatch(text, -1) {
+		amount, err := strconv.ParseFloat(strings.ReplaceAll(match[1], ",", ""), 64)
+		if err != nil {
+			continue
+		}
+		if match[2] != "" {
+			amount *= 1000
+		}
+		amounts = append(amounts, amount)
+	}
+	return amounts
+}
@@ -0,0 +1,241 @@
+// Package eval regression-tests negotiation prompts offline. It replays a corpus of recorded
+// negotiation transcripts through the negotiation agent with each prompt version and model
+// being compared, scores every draft with rule-based checks and an LLM judge, and writes a
+// comparison report. Runs are recorded to a cassette once and replayed without a model after.
+package eval
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"carbuyer/internal/db/models"
+	"carbuyer/internal/llm"
+	"carbuyer/internal/services"
+)
+
+// defaultMaxChars is the longest acceptable draft when a case doesn't set one. The prompt asks
+// for around 500 characters.
+const defaultMaxChars = 1000
+
+// Case is a recorded negotiation. Each user turn in its transcript is a request for a draft to
+// send to the seller, and is replayed with the turns before it as the thread's history.
+type Case struct {
+	ID              string                     `json:"id"`
+	Description     string                     `json:"description,omitempty"`
+	Year            int                        `json:"year"`
+	Make            string                     `json:"make"`
+	Model           string                     `json:"model"`
+	SellerName      string                     `json:"sellerName"`
+	Summary         string                     `json:"summary,omitempty"`
+	CompetingOffers int                        `json:"competingOffers,omitempty"`
+	OtherSellers    []string                   `json:"otherSellers,omitempty"` // Competing sellers drafts mustn't name
+	MaxPrice        float64                    `json:"maxPrice,omitempty"`     // The most the buyer will pay; drafts mustn't offer more
+	MaxChars        int                        `json:"maxChars,omitempty"`     // Longest acceptable draft; defaultMaxChars when 0
+	ToolOutputs     map[string]json.RawMessage `json:"toolOutputs,omitempty"`  // JSON each agent tool returns; tools left out are unavailable
+	Transcript      []Turn                     `json:"transcript"`
+}
+
+// Turn is one message of a recorded transcript
+type Turn struct {
+	Sender  models.SenderType `json:"sender"` // user, agent or seller
+	Content string            `json:"content"`
+}
+
+// maxChars returns the longest acceptable draft for the case
+func (c *Case) maxChars() int {
+	if c.MaxChars > 0 {
+		return c.MaxChars
+	}
+	return defaultMaxChars
+}
+
+// validate checks a case can be replayed
+func (c *Case) validate() error {
+	if c.ID == "" {
+		return errors.New("case has no id")
+	}
+	requests := 0
+	for i, turn := range c.Transcript {
+		switch turn.Sender {
+		case models.SenderTypeUser:
+			requests++
+		case models.SenderTypeAgent, models.SenderTypeSeller:
+		default:
+			return fmt.Errorf("case %s: turn %d has unknown sender %q", c.ID, i+1, turn.Sender)
+		}
+		if strings.TrimSpace(turn.Content) == "" {
+			return fmt.Errorf("case %s: turn %d is empty", c.ID, i+1)
+		}
+	}
+	if requests == 0 {
+		return fmt.Errorf("case %s has no user requests to replay", c.ID)
+	}
+	return nil
+}
+
+// LoadCorpus reads every case from the .json files in dir. Each file holds one case or an
+// array of cases.
+func LoadCorpus(dir string) ([]Case, error) {
+	paths, err := filepath.Glob(filepath.Join(dir, "*.json"))
+	if err != nil {
+		return nil, err
+	}
+	sort.Strings(paths)
+
+	var cases []Case
+	seen := map[string]bool{}
+	for _, path := range paths {
+		data, err := os.ReadFile(path)
+		if err != nil {
+			return nil, err
+		}
+
+		var fileCases []Case
+		if strings.HasPrefix(strings.TrimSpace(string(data)), "[") {
+			err = json.Unmarshal(data, &fileCases)
+		} else {
+			fileCases = make([]Case, 1)
+			err = json.Unmarshal(data, &fileCases[0])
+		}
+		if err != nil {
+			return nil, fmt.Errorf("invalid case file %s: %w", path, err)
+		}
+
+		for _, c := range fileCases {
+			if err := c.validate(); err != nil {
+				return nil, fmt.Errorf("%s: %w", path, err)
+			}
+			if seen[c.ID] {
+				return nil, fmt.Errorf("%s: duplicate case id %s", path, c.ID)
+			}
+			seen[c.ID] = true
+			cases = append(cases, c)
+		}
+	}
+	if len(cases) == 0 {
+		return nil, fmt.Errorf("no cases found in %s", dir)
+	}
+	return cases, nil
+}
+
+// Variant is a prompt version and model to evaluate
+type Variant struct {
+	Name   string
+	Prompt *services.Prompt
+	Model  llm.Model // The negotiation model when empty
+}
+
+// Result is how a variant did on one request in a case
+type Result struct {
+	Variant string        `json:"variant"`
+	CaseID  string        `json:"caseId"`
+	Turn    int           `json:"turn"` // 1-based position of the request in the transcript
+	Request string        `json:"request"`
+	Output  string        `json:"output"`
+	Error   string        `json:"error,omitempty"`
+	Checks  []CheckResult `json:"checks,omitempty"`
+	Verdict *Verdict      `json:"verdict,omitempty"`
+	Usage   llm.Usage     `json:"usage"`
+}
+
+// Passed reports whether the draft was generated and passed every check
+func (r *Result) Passed() bool {
+	if r.Error != "" {
+		return false
+	}
+	for _, check := range r.Checks {
+		if !check.Passed {
+			return false
+		}
+	}
+	return true
+}
+
+// Runner replays cases through the negotiation agent
+type Runner struct {
+	LLM   llm.LLM // Generates the drafts
+	Judge llm.LLM // Grades the drafts; nil to only run the rule-based checks
+}
+
+// Run replays every user request in the cases with each variant, returning results in case,
+// turn and variant order. A request that fails is reported in its result rather than
+// stopping the run; only cancelling ctx does.
+func (r *Runner) Run(ctx context.Context, cases []Case, variants []Variant) ([]Result, error) {
+	var results []Result
+	for i := range cases {
+		c := &cases[i]
+		for turn, request := range c.Transcript {
+			if request.Sender != models.SenderTypeUser {
+				continue
+			}
+			history := c.Transcript[:turn]
+			for _, variant := range variants {
+				if err := ctx.Err(); err != nil {
+					return results, err
+				}
+				results = append(results, r.runTurn(ctx, c, turn, history, variant))
+			}
+		}
+	}
+	return results, nil
+}
+
+// runTurn generates and scores one variant's draft for the request at turn
+func (r *Runner) runTurn(ctx context.Context, c *Case, turn int, history []Turn, variant Variant) Result {
+	request := c.Transcript[turn].Content
+	result := Result{
+		Variant: variant.Name,
+		CaseID:  c.ID,
+		Turn:    turn + 1,
+		Request: request,
+	}
+
+	output, response, err := services.GenerateNegotiationResponse(ctx, r.LLM, variant.Prompt, negotiationTurn(c, history, request, variant.Model))
+	if err != nil {
+		result.Error = err.Error()
+		return result
+	}
+	result.Output = output
+	result.Usage = response.Usage
+	result.Checks = RunChecks(c, history, output)
+
+	if r.Judge != nil {
+		verdict, err := Judge(ctx, r.Judge, c, history, request, output)
+		if err != nil {
+			result.Error = fmt.Sprintf("judge: %v", err)
+		} else {
+			result.Verdict = verdict
+		}
+	}
+	return result
+}
+
+// negotiationTurn builds the agent's input for a request in a case
+func negotiationTurn(c *Case, history []Turn, request string, model llm.Model) services.NegotiationTurn {
+	turn := services.NegotiationTurn{
+		Data: services.NegotiationPromptData{
+			Year:            c.Year,
+			Make:            c.Make,
+			Model:           c.Model,
+			SellerName:      c.SellerName,
+			Summary:         c.Summary,
+			CompetingOffers: c.CompetingOffers,
+			UserMessage:     request,
+		},
+		ToolOutputs: map[string]string{},
+		Model:       model,
+	}
+	for _, msg := range history {
+		turn.History = append(turn.History, models.Message{Sender: msg.Sender, Content: msg.Content})
+	}
+	for name, output := range c.ToolOutputs {
+		turn.ToolOutputs[name] = string(output)
+	}
+	return turn
+}
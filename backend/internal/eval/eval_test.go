@@ -0,0 +1,145 @@
+package eval
+
+import (
+	"context"
+	"encoding/json"
+	"strings"
+	"testing"
+
+	"carbuyer/internal/db/models"
+	"carbuyer/internal/llm"
+	"carbuyer/internal/services"
+)
+
+func testCase() Case {
+	return Case{
+		ID:           "maverick",
+		Year:         2025,
+		Make:         "Ford",
+		Model:        "Maverick",
+		SellerName:   "Metro Ford",
+		OtherSellers: []string{"Eastside Ford"},
+		MaxPrice:     33500,
+		ToolOutputs:  map[string]json.RawMessage{"list_competing_offers": json.RawMessage(`[{"seller":"Eastside Ford"}]`)},
+		Transcript: []Turn{
+			{Sender: models.SenderTypeSeller, Content: "Best we can do is $34,800 out the door."},
+			{Sender: models.SenderTypeUser, Content: "Counter at $32,500"},
+		},
+	}
+}
+
+func TestRunChecks(t *testing.T) {
+	c := testCase()
+	history := c.Transcript[:1]
+
+	tests := []struct {
+		name   string
+		output string
+		failed string // The check that should fail, if any
+	}{
+		{"good draft", "Thanks for removing the package. Your $34,800 is still high; I can do $32,500 out the door today.", ""},
+		{"names a seller", "Eastside Ford offered me $32,900, can you match it?", CheckSellerNames},
+		{"too long", strings.Repeat("Please reconsider. ", 60), CheckLength},
+		{"preamble", "Here's a counteroffer you can send: I can do $32,500.", CheckMetaCommentary},
+		{"placeholder", "I can do $32,500 out the door.\n\nThanks,\n[Your Name]", CheckMetaCommentary},
+		{"over budget", "I could stretch to $33,900 if you include mats.", CheckPriceLimit},
+		{"over budget in k", "I could stretch to $34k.", CheckPriceLimit},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			for _, check := range RunChecks(&c, history, tt.output) {
+				wantPass := check.Name != tt.failed
+				if check.Passed != wantPass {
+					t.Errorf("%s passed = %v, want %v (%s)", check.Name, check.Passed, wantPass, check.Detail)
+				}
+			}
+		})
+	}
+}
+
+func TestDollarAmounts(t *testing.T) {
+	got := dollarAmounts("$36,400 OTD, $799 doc fee, $1295 package, $32.5k target, $349.99/month")
+	want := []float64{36400, 799, 1295, 32500, 349.99}
+	if len(got) != len(want) {
+		t.Fatalf("dollarAmounts = %v, want %v", got, want)
+	}
+	for i := range want {
+		if got[i] != want[i] {
+			t.Errorf("amount %d = %v, want %v", i, got[i], want[i])
+		}
+	}
+}
+
+func TestLoadCorpus(t *testing.T) {
+	cases, err := LoadCorpus("../../eval/corpus")
+	if err != nil {
+		t.Fatalf("LoadCorpus error: %v", err)
+	}
+	if len(cases) < 3 {
+		t.Errorf("loaded %d cases, want the shipped corpus", len(cases))
+	}
+}
+
+func TestRunner(t *testing.T) {
+	c := testCase()
+	prompt, err := services.DefaultPrompt(models.LLMPurposeNegotiation)
+	if err != nil {
+		t.Fatal(err)
+	}
+	variants := []Variant{
+		{Name: "builtin@standard", Prompt: prompt},
+		{Name: "builtin@fast", Prompt: prompt, Model: llm.ModelFast},
+	}
+
+	// The first variant looks up competing offers, then drafts; the second names the seller
+	agent := llm.NewFake()
+	agent.Add(
+		llm.FakeResponse{ToolCalls: []llm.ToolCall{{ID: "call_1", Name: "list_competing_offers", Input: json.RawMessage(`{}`)}}},
+		llm.FakeResponse{Text: "I can do $32,500 out the door today."},
+		llm.FakeResponse{Text: "Eastside Ford will do $32,900. Can you beat it?"},
+	)
+	judge := llm.NewFake(
+		`{"effectiveness": 4, "tone": 5, "instructions": 5, "issues": [], "reason": "Clear counter"}`,
+		`{"effectiveness": 3, "tone": 4, "instructions": 2, "issues": ["Names another seller"], "reason": "Leaks a seller"}`,
+	)
+
+	runner := &Runner{LLM: agent, Judge: judge}
+	results, err := runner.Run(context.Background(), []Case{c}, variants)
+	if err != nil {
+		t.Fatalf("Run error: %v", err)
+	}
+	if len(results) != 2 {
+		t.Fatalf("got %d results, want 2", len(results))
+	}
+
+	requests := agent.Requests()
+	if requests[1].Messages[len(requests[1].Messages)-1].Parts[0].ToolResult.Content != `[{"seller":"Eastside Ford"}]` {
+		t.Error("tool call wasn't answered with the case's tool output")
+	}
+	if requests[2].Model != llm.ModelFast {
+		t.Errorf("second variant used %s, want the fast model", requests[2].Model)
+	}
+
+	if !results[0].Passed() || results[0].Turn != 2 || results[0].Verdict.Score() < 4.6 {
+		t.Errorf("first result = %+v, want a passing draft for turn 2", results[0])
+	}
+	if results[1].Passed() {
+		t.Error("second result passed, want the seller name check to fail")
+	}
+
+	summaries := Summarize(variants, results)
+	if summaries[0].Passed != 1 || summaries[1].Passed != 0 || summaries[1].CheckPasses[CheckSellerNames] != 0 {
+		t.Errorf("summaries = %+v", summaries)
+	}
+
+	var report strings.Builder
+	if err := WriteReport(&report, variants, results); err != nil {
+		t.Fatal(err)
+	}
+	for _, want := range []string{"| builtin@standard | 1 | 100% |", "### maverick turn 2", "Failed no_seller_names", "Judge: Names another seller"} {
+		if !strings.Contains(report.String(), want) {
+			t.Errorf("report is missing %q:\n%s", want, report.String())
+		}
+	}
+}
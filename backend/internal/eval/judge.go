@@ -0,0 +1,95 @@
+package eval
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	"carbuyer/internal/db/models"
+	"carbuyer/internal/llm"
+)
+
+// judgePrompt instructs the LLM to grade a draft the negotiation agent wrote
+const judgePrompt = `You grade drafts written by an assistant that helps a car buyer negotiate with sellers. The buyer asked for a message to send to the seller, and you see the conversation so far, what the buyer asked for and the assistant's draft.
+
+Score the draft from 1 (poor) to 5 (excellent) on:
+- effectiveness: how well it moves the negotiation towards a better price and terms for the buyer
+- tone: firm, polite, professional and concise
+- instructions: how closely it does what the buyer asked
+
+List every problem in issues, such as: naming another seller, revealing the buyer's maximum price, inventing facts, committing the buyer to buy or visit, or text that isn't part of the message to send.
+
+Return ONLY a JSON object, no other text:
+{"effectiveness": 1-5, "tone": 1-5, "instructions": 1-5, "issues": ["..."], "reason": "one sentence"}`
+
+// Verdict is the judge's grading of a draft
+type Verdict struct {
+	Effectiveness int      `json:"effectiveness"`
+	Tone          int      `json:"tone"`
+	Instructions  int      `json:"instructions"`
+	Issues        []string `json:"issues,omitempty"`
+	Reason        string   `json:"reason,omitempty"`
+}
+
+// Score returns the mean of the verdict's scores
+func (v *Verdict) Score() float64 {
+	return float64(v.Effectiveness+v.Tone+v.Instructions) / 3
+}
+
+// validate checks the judge returned scores in range
+func (v *Verdict) validate() error {
+	for _, score := range []int{v.Effectiveness, v.Tone, v.Instructions} {
+		if score < 1 || score > 5 {
+			return fmt.Errorf("judge returned a score of %d, want 1 to 5", score)
+		}
+	}
+	return nil
+}
+
+// Judge asks the LLM to grade a draft for a request in a case
+func Judge(ctx context.Context, model llm.LLM, c *Case, history []Turn, request, output string) (*Verdict, error) {
+	var verdict Verdict
+	if _, err := model.CompleteJSON(ctx, judgeRequest(c, history, request, output), &verdict); err != nil {
+		return nil, err
+	}
+	if err := verdict.validate(); err != nil {
+		return nil, err
+	}
+	return &verdict, nil
+}
+
+// judgeRequest builds the LLM request to grade a draft
+func judgeRequest(c *Case, history []Turn, request, output string) llm.Request {
+	var b strings.Builder
+	fmt.Fprintf(&b, "The buyer wants a %d %s %s and is negotiating with %s.\n", c.Year, c.Make, c.Model, c.SellerName)
+	if c.MaxPrice > 0 {
+		fmt.Fprintf(&b, "The most the buyer will pay is $%.0f. The seller must not learn this.\n", c.MaxPrice)
+	}
+	if len(c.OtherSellers) > 0 {
+		fmt.Fprintf(&b, "Other sellers, who must not be named: %s\n", strings.Join(c.OtherSellers, ", "))
+	}
+
+	b.WriteString("\nConversation so far, oldest first:\n")
+	if len(history) == 0 {
+		b.WriteString("(none)\n")
+	}
+	for _, turn := range history {
+		switch turn.Sender {
+		case models.SenderTypeUser:
+			fmt.Fprintf(&b, "\nBuyer to assistant: %s\n", turn.Content)
+		case models.SenderTypeAgent:
+			fmt.Fprintf(&b, "\nAssistant: %s\n", turn.Content)
+		case models.SenderTypeSeller:
+			fmt.Fprintf(&b, "\nSeller: %s\n", turn.Content)
+		}
+	}
+	fmt.Fprintf(&b, "\nThe buyer asked: %s\n\nThe assistant's draft:\n%s\n", request, output)
+
+	return llm.Request{
+		Model:     llm.ModelStandard,
+		MaxTokens: 512,
+		System:    judgePrompt,
+		Messages:  []llm.Message{llm.UserMessage(llm.Text(b.String()))},
+		Purpose:   string(models.LLMPurposeEvalJudge),
+	}
+}
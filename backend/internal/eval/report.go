@@ -0,0 +1,184 @@
+package eval
+
+import (
+	"fmt"
+	"io"
+	"strings"
+)
+
+// Summary totals a variant's results
+type Summary struct {
+	Variant      string
+	Requests     int
+	Errors       int
+	Passed       int            // Drafts that passed every check
+	CheckPasses  map[string]int // Drafts that passed each check
+	Judged       int
+	JudgeScore   float64 // Mean of the judged drafts' scores
+	AvgChars     float64
+	InputTokens  int
+	OutputTokens int
+}
+
+// Summarize totals the results of each variant, in variant order
+func Summarize(variants []Variant, results []Result) []Summary {
+	summaries := make([]Summary, len(variants))
+	index := map[string]int{}
+	for i, variant := range variants {
+		summaries[i] = Summary{Variant: variant.Name, CheckPasses: map[string]int{}}
+		index[variant.Name] = i
+	}
+
+	chars := make([]int, len(variants))
+	for i := range results {
+		result := &results[i]
+		v, ok := index[result.Variant]
+		if !ok {
+			continue
+		}
+		s := &summaries[v]
+
+		s.Requests++
+		s.InputTokens += result.Usage.InputTokens
+		s.OutputTokens += result.Usage.OutputTokens
+		if result.Error != "" {
+			s.Errors++
+		}
+		if result.Passed() {
+			s.Passed++
+		}
+		for _, check := range result.Checks {
+			if check.Passed {
+				s.CheckPasses[check.Name]++
+			}
+		}
+		if result.Output != "" {
+			chars[v] += len([]rune(result.Output))
+		}
+		if result.Verdict != nil {
+			s.Judged++
+			s.JudgeScore += result.Verdict.Score()
+		}
+	}
+
+	for i := range summaries {
+		s := &summaries[i]
+		if s.Judged > 0 {
+			s.JudgeScore /= float64(s.Judged)
+		}
+		if generated := s.Requests - s.Errors; generated > 0 {
+			s.AvgChars = float64(chars[i]) / float64(generated)
+		}
+	}
+	return summaries
+}
+
+// WriteReport writes a Markdown report comparing the variants: a summary table, then every
+// request where the variants' drafts differ in outcome, or that failed, with the drafts
+func WriteReport(w io.Writer, variants []Variant, results []Result) error {
+	var b strings.Builder
+
+	b.WriteString("# Negotiation prompt evaluation\n\n")
+	b.WriteString("| Variant | Requests | Passed all checks |")
+	for _, name := range CheckNames {
+		fmt.Fprintf(&b, " %s |", name)
+	}
+	b.WriteString(" Judge score | Avg chars | Tokens in/out | Errors |\n|---|---|---|")
+	for range CheckNames {
+		b.WriteString("---|")
+	}
+	b.WriteString("---|---|---|---|\n")
+
+	for _, s := range Summarize(variants, results) {
+		fmt.Fprintf(&b, "| %s | %d | %s |", s.Variant, s.Requests, percent(s.Passed, s.Requests))
+		for _, name := range CheckNames {
+			fmt.Fprintf(&b, " %s |", percent(s.CheckPasses[name], s.Requests))
+		}
+		score := "-"
+		if s.Judged > 0 {
+			score = fmt.Sprintf("%.2f", s.JudgeScore)
+		}
+		fmt.Fprintf(&b, " %s | %.0f | %d/%d | %d |\n", score, s.AvgChars, s.InputTokens, s.OutputTokens, s.Errors)
+	}
+
+	// Group results by request, keeping run order
+	var keys []string
+	byRequest := map[string][]*Result{}
+	for i := range results {
+		key := fmt.Sprintf("%s turn %d", results[i].CaseID, results[i].Turn)
+		if _, ok := byRequest[key]; !ok {
+			keys = append(keys, key)
+		}
+		byRequest[key] = append(byRequest[key], &results[i])
+	}
+
+	b.WriteString("\n## Requests with failures or differences\n")
+	shown := 0
+	for _, key := range keys {
+		group := byRequest[key]
+		if !notable(group) {
+			continue
+		}
+		shown++
+
+		fmt.Fprintf(&b, "\n### %s\n\n> %s\n", key, quote(group[0].Request))
+		for _, result := range group {
+			fmt.Fprintf(&b, "\n**%s**", result.Variant)
+			if result.Verdict != nil {
+				fmt.Fprintf(&b, " (judge %.2f)", result.Verdict.Score())
+			}
+			b.WriteString("\n\n")
+			if result.Error != "" {
+				fmt.Fprintf(&b, "- Error: %s\n", result.Error)
+			}
+			for _, check := range result.Checks {
+				if !check.Passed {
+					fmt.Fprintf(&b, "- Failed %s: %s\n", check.Name, check.Detail)
+				}
+			}
+			if result.Verdict != nil {
+				for _, issue := range result.Verdict.Issues {
+					fmt.Fprintf(&b, "- Judge: %s\n", issue)
+				}
+			}
+			if result.Output != "" {
+				fmt.Fprintf(&b, "\n> %s\n", quote(result.Output))
+			}
+		}
+	}
+	if shown == 0 {
+		b.WriteString("\nEvery draft passed every check, and the variants agree.\n")
+	}
+
+	_, err := io.WriteString(w, b.String())
+	return err
+}
+
+// notable reports whether a request's results are worth showing: any failed, or the
+// variants passed different checks or were judged a point or more apart
+func notable(group []*Result) bool {
+	minScore, maxScore := 6.0, 0.0
+	for _, result := range group {
+		if !result.Passed() {
+			return true
+		}
+		if result.Verdict != nil {
+			minScore = min(minScore, result.Verdict.Score())
+			maxScore = max(maxScore, result.Verdict.Score())
+		}
+	}
+	return maxScore-minScore >= 1
+}
+
+// percent formats n of total as a percentage
+func percent(n, total int) string {
+	if total == 0 {
+		return "-"
+	}
+	return fmt.Sprintf("%d%%", n*100/total)
+}
+
+// quote formats text as the body of a Markdown blockquote
+func quote(text string) string {
+	return strings.ReplaceAll(strings.TrimSpace(text), "\n", "\n> ")
+}
@@ -10,10 +10,12 @@ import (
 
 // SendReply sends an email reply maintaining proper threading
 // externalMessageID is the Message-ID from the original email (stored in database)
-func SendReply(service *gmail.Service, to, subject, htmlBody, externalMessageID string) error {
+// replyTo is the Otto inbound address replies should be routed to (optional)
+// messageID is the Message-ID to send with, so delivery events and bounces can be matched (optional)
+func SendReply(service *gmail.Service, to, subject, htmlBody, externalMessageID, replyTo, messageID string) error {
 	// Build email message with proper threading headers
 	// Format: RFC 2822
-	message := buildReplyMessage(to, subject, htmlBody, externalMessageID)
+	message := buildReplyMessage(to, subject, htmlBody, externalMessageID, replyTo, messageID)
 
 	fmt.Printf("=== SENDING EMAIL VIA GMAIL ===\n")
 	fmt.Printf("To: %s\n", to)
@@ -46,10 +48,11 @@ func SendReply(service *gmail.Service, to, subject, htmlBody, externalMessageID
 
 // CreateDraft creates a Gmail draft maintaining proper threading
 // externalMessageID is the Message-ID from the original email (stored in database)
-func CreateDraft(service *gmail.Service, to, subject, htmlBody, externalMessageID string) error {
+// replyTo is the Otto inbound address replies should be routed to (optional)
+func CreateDraft(service *gmail.Service, to, subject, htmlBody, externalMessageID, replyTo string) error {
 	// Build email message with proper threading headers
 	// Format: RFC 2822
-	message := buildReplyMessage(to, subject, htmlBody, externalMessageID)
+	message := buildReplyMessage(to, subject, htmlBody, externalMessageID, replyTo, "")
 
 	fmt.Printf("=== CREATING DRAFT VIA GMAIL ===\n")
 	fmt.Printf("To: %s\n", to)
@@ -85,7 +88,7 @@ func CreateDraft(service *gmail.Service, to, subject, htmlBody, externalMessageI
 }
 
 // buildReplyMessage constructs the MIME message with threading headers
-func buildReplyMessage(to, subject, htmlBody, externalMessageID string) string {
+func buildReplyMessage(to, subject, htmlBody, externalMessageID, replyTo, messageID string) string {
 	// Ensure subject has "Re:" prefix
 	if !strings.HasPrefix(subject, "Re:") {
 		subject = "Re: " + subject
@@ -98,22 +101,32 @@ func buildReplyMessage(to, subject, htmlBody, externalMessageID string) string {
 	sb.WriteString(fmt.Sprintf("To: %s\r\n", to))
 	sb.WriteString(fmt.Sprintf("Subject: %s\r\n", subject))
 
+	// Our own Message-ID lets bounces and delivery events be matched to the sent message
+	if messageID != "" {
+		sb.WriteString(fmt.Sprintf("Message-ID: %s\r\n", messageID))
+	}
+
+	// Reply-To routes the seller's answer back to the thread's Otto inbound address
+	if replyTo != "" {
+		sb.WriteString(fmt.Sprintf("Reply-To: %s\r\n", replyTo))
+	}
+
 	// Threading headers - these ensure the reply is threaded with the original
 	if externalMessageID != "" {
 		// Ensure Message-ID is wrapped in angle brackets
-		messageID := externalMessageID
-		if !strings.HasPrefix(messageID, "<") {
-			messageID = "<" + messageID
+		originalID := externalMessageID
+		if !strings.HasPrefix(originalID, "<") {
+			originalID = "<" + originalID
 		}
-		if !strings.HasSuffix(messageID, ">") {
-			messageID = messageID + ">"
+		if !strings.HasSuffix(originalID, ">") {
+			originalID = originalID + ">"
 		}
 
 		// In-Reply-To: references the message we're replying to
-		sb.WriteString(fmt.Sprintf("In-Reply-To: %s\r\n", messageID))
+		sb.WriteString(fmt.Sprintf("In-Reply-To: %s\r\n", originalID))
 
 		// References: includes the full chain (in this case, just the original)
-		sb.WriteString(fmt.Sprintf("References: %s\r\n", messageID))
+		sb.WriteString(fmt.Sprintf("References: %s\r\n", originalID))
 	}
 
 	// Content-Type for HTML email
@@ -0,0 +1,180 @@
+package inbound
+
+import (
+	"regexp"
+	"strings"
+	"time"
+)
+
+// DeliveryEventType is the outcome of an outbound email delivery attempt
+type DeliveryEventType string
+
+const (
+	DeliveryEventDelivered  DeliveryEventType = "delivered"
+	DeliveryEventDeferred   DeliveryEventType = "deferred" // Temporary failure - the provider will retry
+	DeliveryEventBounced    DeliveryEventType = "bounced"
+	DeliveryEventComplained DeliveryEventType = "complained"
+)
+
+// DeliveryEvent reports what happened to an outbound email, from a provider event webhook or
+// a bounce notification (NDR)
+type DeliveryEvent struct {
+	Type      DeliveryEventType
+	MessageID string // Message-ID of the outbound email, when known
+	Recipient string
+	Permanent bool // Hard bounce - the address will never accept mail
+	Reason    string
+	Timestamp time.Time
+}
+
+var (
+	bounceSubjectPattern = regexp.MustCompile(`(?i)(undeliverable|undelivered mail|delivery status notification|delivery (has )?failed|failure notice|returned mail|mail delivery (failed|subsystem)|delivery failure|could not be delivered)`)
+	bounceSenderPattern  = regexp.MustCompile(`(?i)(mailer-daemon|postmaster)@`)
+)
+
+// IsBounce reports whether an inbound email is a bounce notification for an email we sent
+func IsBounce(email *Email) bool {
+	if deliveryStatus, _ := reportParts(email); deliveryStatus != "" {
+		return true
+	}
+	if email.Headers != nil && email.Headers.Get("X-Failed-Recipients") != "" {
+		return true
+	}
+	return bounceSenderPattern.MatchString(email.From) && bounceSubjectPattern.MatchString(email.Subject)
+}
+
+// ParseBounce reads the failed recipients out of a bounce notification's RFC 3464
+// delivery-status part (Final-Recipient, or Original-Recipient when that's missing). Returns
+// nil when the email isn't a bounce or carries no delivery-status report.
+func ParseBounce(email *Email) []DeliveryEvent {
+	if !IsBounce(email) {
+		return nil
+	}
+
+	// Without a machine-readable report there is no reliable way to tell which address
+	// failed - the body quotes whatever the original message contained
+	deliveryStatus, originalHeaders := reportParts(email)
+	if deliveryStatus == "" {
+		return nil
+	}
+
+	messageID := bounceOriginalMessageID(email, originalHeaders)
+	var events []DeliveryEvent
+	for _, recipient := range parseDeliveryStatus(deliveryStatus) {
+		eventType, permanent := bounceOutcome(recipient.action, recipient.status)
+		if eventType == "" {
+			continue // Delivered or relayed
+		}
+		events = append(events, DeliveryEvent{
+			Type:      eventType,
+			MessageID: messageID,
+			Recipient: recipient.address,
+			Permanent: permanent,
+			Reason:    joinReason(recipient.status, recipient.diagnostic),
+			Timestamp: time.Now(),
+		})
+	}
+	return events
+}
+
+// reportParts returns the delivery-status and original headers parts of a bounce report.
+// Providers that parse messages into form fields pass these parts on as attachments.
+func reportParts(email *Email) (deliveryStatus, originalHeaders string) {
+	deliveryStatus, originalHeaders = email.DeliveryStatus, email.OriginalHeaders
+	for _, attachment := range email.Attachments {
+		mediaType, _, _ := strings.Cut(strings.ToLower(attachment.ContentType), ";")
+		switch strings.TrimSpace(mediaType) {
+		case "message/delivery-status", "message/global-delivery-status":
+			if deliveryStatus == "" {
+				deliveryStatus = string(attachment.Data)
+			}
+		case "text/rfc822-headers", "message/rfc822", "message/global-headers":
+			if originalHeaders == "" {
+				originalHeaders = headerBlock(string(attachment.Data))
+			}
+		}
+	}
+	return deliveryStatus, originalHeaders
+}
+
+// deliveryStatusRecipient holds the per-recipient fields of a delivery-status report
+type deliveryStatusRecipient struct {
+	address    string
+	action     string
+	status     string
+	diagnostic string
+}
+
+// parseDeliveryStatus reads the per-recipient field groups of a message/delivery-status part.
+// Groups are separated by blank lines; the first group describes the message as a whole.
+func parseDeliveryStatus(report string) []deliveryStatusRecipient {
+	report = strings.ReplaceAll(report, "\r\n", "\n")
+
+	var recipients []deliveryStatusRecipient
+	for _, group := range strings.Split(report, "\n\n") {
+		fields := parseHeaderBlock(group)
+
+		address := fields.Get("Final-Recipient")
+		if address == "" {
+			address = fields.Get("Original-Recipient")
+		}
+		if address == "" {
+			continue // Per-message fields
+		}
+
+		recipients = append(recipients, deliveryStatusRecipient{
+			address:    typedValue(address),
+			action:     strings.ToLower(strings.TrimSpace(fields.Get("Action"))),
+			status:     strings.TrimSpace(fields.Get("Status")),
+			diagnostic: typedValue(fields.Get("Diagnostic-Code")),
+		})
+	}
+	return recipients
+}
+
+// typedValue strips the type from a "type; value" field such as "rfc822; dealer@example.com"
+func typedValue(field string) string {
+	if _, value, found := strings.Cut(field, ";"); found {
+		field = value
+	}
+	return strings.Trim(strings.TrimSpace(field), "<>")
+}
+
+// bounceOutcome maps a delivery-status action and status code to an event. An empty type
+// means the recipient didn't fail.
+func bounceOutcome(action, status string) (DeliveryEventType, bool) {
+	switch {
+	case action == "delayed" || strings.HasPrefix(status, "4"):
+		return DeliveryEventDeferred, false
+	case action == "failed" || strings.HasPrefix(status, "5"):
+		return DeliveryEventBounced, true
+	}
+	return "", false
+}
+
+// bounceOriginalMessageID finds the Message-ID of the email that bounced
+func bounceOriginalMessageID(email *Email, originalHeaders string) string {
+	if originalHeaders != "" {
+		if messageID := parseHeaderBlock(originalHeaders).Get("Message-Id"); messageID != "" {
+			return strings.TrimSpace(messageID)
+		}
+	}
+	// Gmail and most MTAs thread the bounce onto the original
+	if email.InReplyTo != "" {
+		return strings.TrimSpace(email.InReplyTo)
+	}
+	if references := strings.Fields(email.References); len(references) > 0 {
+		return references[len(references)-1]
+	}
+	return ""
+}
+
+func joinReason(parts ...string) string {
+	var nonEmpty []string
+	for _, part := range parts {
+		if part = strings.TrimSpace(part); part != "" {
+			nonEmpty = append(nonEmpty, part)
+		}
+	}
+	return strings.Join(nonEmpty, " ")
+}
@@ -0,0 +1,145 @@
+// Package inbound normalizes inbound email webhooks from different providers into a
+// single Email struct so the rest of the app doesn't depend on any one provider.
+package inbound
+
+import (
+	"crypto/subtle"
+	"errors"
+	"io"
+	"log"
+	"mime/multipart"
+	"net/http"
+	"net/mail"
+	"net/textproto"
+	"strings"
+	"time"
+)
+
+// maxFormMemory is how much of a multipart webhook is held in memory before spilling to disk
+const maxFormMemory = 32 << 20 // 32MB
+
+// ErrUnauthorized is returned when a webhook fails signature or secret verification
+var ErrUnauthorized = errors.New("webhook verification failed")
+
+// Email is an inbound email normalized from a provider's webhook payload
+type Email struct {
+	Recipient   string // Envelope recipient - the inbox address the email was delivered to
+	From        string
+	To          string    // To header, set when parsed from raw MIME
+	Date        time.Time // Date header, set when parsed from raw MIME; zero when missing
+	Subject     string
+	TextBody    string
+	HTMLBody    string
+	MessageID   string
+	InReplyTo   string
+	References  string
+	Headers     textproto.MIMEHeader // All message headers, when the provider passes them on
+	Attachments []Attachment
+
+	// Parts of a bounce report (multipart/report), when the provider passes them on
+	DeliveryStatus  string // message/delivery-status part
+	OriginalHeaders string // Headers of the returned original message
+}
+
+// Attachment is a file received with an inbound email, before it is stored
+type Attachment struct {
+	Filename    string
+	ContentType string
+	Size        int64
+	Data        []byte // nil when the file was too large to read
+}
+
+// Adapter parses a provider's inbound webhook request into an Email
+type Adapter interface {
+	// Name is the provider name used in the webhook URL
+	Name() string
+	// Verify checks the request came from the provider. It returns ErrUnauthorized when it didn't.
+	Verify(r *http.Request) error
+	// Parse reads the request into an Email. Requests are verified separately so stored
+	// payloads can be parsed again on replay.
+	Parse(r *http.Request) (*Email, error)
+}
+
+// Adapters returns an adapter for every supported provider
+func Adapters(mailgunSigningKey, sharedSecret string, maxAttachmentBytes int64) []Adapter {
+	return []Adapter{
+		NewMailgunAdapter(mailgunSigningKey, maxAttachmentBytes),
+		NewSendGridAdapter(sharedSecret, maxAttachmentBytes),
+		NewPostmarkAdapter(sharedSecret, maxAttachmentBytes),
+		NewMIMEAdapter(sharedSecret, maxAttachmentBytes),
+	}
+}
+
+// checkSharedSecret verifies providers without request signing. The secret can be passed as a
+// token query parameter or as the basic auth password in the webhook URL. Without a secret
+// configured every request is rejected.
+func checkSharedSecret(r *http.Request, secret string) error {
+	if secret == "" {
+		return ErrUnauthorized
+	}
+
+	provided := r.URL.Query().Get("token")
+	if _, password, ok := r.BasicAuth(); ok {
+		provided = password
+	}
+
+	if subtle.ConstantTimeCompare([]byte(provided), []byte(secret)) != 1 {
+		return ErrUnauthorized
+	}
+	return nil
+}
+
+// readFormFiles reads every file part of a multipart form into memory, skipping the
+// content of files over maxBytes
+func readFormFiles(form *multipart.Form, maxBytes int64) []Attachment {
+	if form == nil {
+		return nil
+	}
+
+	var attachments []Attachment
+	for _, files := range form.File {
+		for _, fh := range files {
+			attachment := Attachment{
+				Filename:    fh.Filename,
+				ContentType: fh.Header.Get("Content-Type"),
+				Size:        fh.Size,
+			}
+
+			if maxBytes <= 0 || fh.Size <= maxBytes {
+				f, err := fh.Open()
+				if err != nil {
+					log.Printf("Failed to open attachment %s: %v", fh.Filename, err)
+				} else {
+					data, err := io.ReadAll(f)
+					f.Close()
+					if err != nil {
+						log.Printf("Failed to read attachment %s: %v", fh.Filename, err)
+					} else {
+						attachment.Data = data
+					}
+				}
+			}
+
+			attachments = append(attachments, attachment)
+		}
+	}
+
+	return attachments
+}
+
+// parseForm parses a urlencoded or multipart webhook body
+func parseForm(r *http.Request) error {
+	if strings.HasPrefix(r.Header.Get("Content-Type"), "multipart/form-data") {
+		return r.ParseMultipartForm(maxFormMemory)
+	}
+	return r.ParseForm()
+}
+
+// firstAddress returns the first bare address in an address list header
+func firstAddress(list string) string {
+	addresses, err := mail.ParseAddressList(list)
+	if err != nil || len(addresses) == 0 {
+		return strings.TrimSpace(list)
+	}
+	return addresses[0].Address
+}
@@ -0,0 +1,413 @@
+package inbound
+
+import (
+	"bytes"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"mime/multipart"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+)
+
+const rawMIMEMessage = "Delivered-To: jsmith+1a2b3c4d@inbound.otto.dev\r\n" +
+	"From: =?UTF-8?Q?Jos=C3=A9_Ruiz?= <jose@northgateford.com>\r\n" +
+	"To: Jane Doe <jsmith+1a2b3c4d@inbound.otto.dev>\r\n" +
+	"Subject: =?UTF-8?Q?Your_Explorer_quote_=E2=80=94_updated?=\r\n" +
+	"Date: Mon, 4 Mar 2024 09:15:00 -0800\r\n" +
+	"Message-ID: <quote-42@northgateford.com>\r\n" +
+	"In-Reply-To: <abc@mail.gmail.com>\r\n" +
+	"References: <root@mail.gmail.com> <abc@mail.gmail.com>\r\n" +
+	"MIME-Version: 1.0\r\n" +
+	"Content-Type: multipart/mixed; boundary=\"outer\"\r\n" +
+	"\r\n" +
+	"--outer\r\n" +
+	"Content-Type: multipart/alternative; boundary=\"inner\"\r\n" +
+	"\r\n" +
+	"--inner\r\n" +
+	"Content-Type: text/plain; charset=\"iso-8859-1\"\r\n" +
+	"Content-Transfer-Encoding: quoted-printable\r\n" +
+	"\r\n" +
+	"Se=F1ora Doe, the price is $39,250.\r\n" +
+	"--inner\r\n" +
+	"Content-Type: text/html; charset=\"utf-8\"\r\n" +
+	"\r\n" +
+	"<p>The price is $39,250.</p>\r\n" +
+	"--inner--\r\n" +
+	"--outer\r\n" +
+	"Content-Type: application/pdf; name=\"quote.pdf\"\r\n" +
+	"Content-Disposition: attachment; filename=\"quote.pdf\"\r\n" +
+	"Content-Transfer-Encoding: base64\r\n" +
+	"\r\n" +
+	"JVBERi0xLjQK\r\n" +
+	"--outer--\r\n"
+
+func TestParseMIME(t *testing.T) {
+	email, err := ParseMIME(strings.NewReader(rawMIMEMessage), 1024)
+	if err != nil {
+		t.Fatalf("ParseMIME() error = %v", err)
+	}
+
+	checks := map[string][2]string{
+		"Recipient":  {email.Recipient, "jsmith+1a2b3c4d@inbound.otto.dev"},
+		"From":       {email.From, "José Ruiz <jose@northgateford.com>"},
+		"Subject":    {email.Subject, "Your Explorer quote — updated"},
+		"MessageID":  {email.MessageID, "<quote-42@northgateford.com>"},
+		"InReplyTo":  {email.InReplyTo, "<abc@mail.gmail.com>"},
+		"References": {email.References, "<root@mail.gmail.com> <abc@mail.gmail.com>"},
+		"To":         {email.To, "Jane Doe <jsmith+1a2b3c4d@inbound.otto.dev>"},
+		"Date":       {email.Date.UTC().Format(time.RFC3339), "2024-03-04T17:15:00Z"},
+		"TextBody":   {email.TextBody, "Señora Doe, the price is $39,250."},
+		"HTMLBody":   {email.HTMLBody, "<p>The price is $39,250.</p>"},
+	}
+	for field, c := range checks {
+		if c[0] != c[1] {
+			t.Errorf("%s = %q, want %q", field, c[0], c[1])
+		}
+	}
+
+	if len(email.Attachments) != 1 {
+		t.Fatalf("got %d attachments, want 1", len(email.Attachments))
+	}
+	attachment := email.Attachments[0]
+	if attachment.Filename != "quote.pdf" || attachment.ContentType != "application/pdf" || string(attachment.Data) != "%PDF-1.4\n" {
+		t.Errorf("attachment = %+v", attachment)
+	}
+}
+
+func TestParseMIMEOversizedAttachment(t *testing.T) {
+	email, err := ParseMIME(strings.NewReader(rawMIMEMessage), 4)
+	if err != nil {
+		t.Fatalf("ParseMIME() error = %v", err)
+	}
+	if len(email.Attachments) != 1 || email.Attachments[0].Data != nil {
+		t.Errorf("oversized attachment should be kept without data, got %+v", email.Attachments)
+	}
+}
+
+func TestParseMbox(t *testing.T) {
+	mbox := "From jose@northgateford.com Mon Mar  4 09:15:00 2024\n" +
+		"From: jose@northgateford.com\n" +
+		"Subject: Explorer quote\n" +
+		"Message-ID: <q1@northgateford.com>\n" +
+		"\n" +
+		"Out the door at $39,250.\n" +
+		">From the desk of our sales manager\n" +
+		"\n" +
+		"From jane@example.com Mon Mar  4 10:02:00 2024\n" +
+		"this is not a message\n" +
+		"\n" +
+		"From jane@example.com Mon Mar  4 11:30:00 2024\n" +
+		"From: jane@example.com\n" +
+		"To: jose@northgateford.com\n" +
+		"Subject: Re: Explorer quote\n" +
+		"Message-ID: <r1@example.com>\n" +
+		"\n" +
+		"Can you do $38,500?\n"
+
+	emails, skipped, err := ParseArchive(strings.NewReader(mbox), 1024)
+	if err != nil {
+		t.Fatalf("ParseArchive() error = %v", err)
+	}
+	if len(emails) != 2 || skipped != 1 {
+		t.Fatalf("got %d emails and %d skipped, want 2 and 1", len(emails), skipped)
+	}
+	if emails[0].MessageID != "<q1@northgateford.com>" || !strings.Contains(emails[0].TextBody, "\nFrom the desk") {
+		t.Errorf("first email = %+v", emails[0])
+	}
+	if emails[1].To != "jose@northgateford.com" || strings.TrimSpace(emails[1].TextBody) != "Can you do $38,500?" {
+		t.Errorf("second email = %+v", emails[1])
+	}
+}
+
+func TestParseArchiveSingleMessage(t *testing.T) {
+	emails, skipped, err := ParseArchive(strings.NewReader(rawMIMEMessage), 1024)
+	if err != nil {
+		t.Fatalf("ParseArchive() error = %v", err)
+	}
+	if len(emails) != 1 || skipped != 0 || emails[0].MessageID != "<quote-42@northgateford.com>" {
+		t.Errorf("ParseArchive() = %d emails, %d skipped", len(emails), skipped)
+	}
+}
+
+func TestMIMEAdapter(t *testing.T) {
+	adapter := NewMIMEAdapter("s3cret", 1024)
+
+	req := httptest.NewRequest(http.MethodPost, "/inbound/mime?token=wrong", strings.NewReader(rawMIMEMessage))
+	if err := adapter.Verify(req); !errors.Is(err, ErrUnauthorized) {
+		t.Fatalf("Verify() with wrong token error = %v, want ErrUnauthorized", err)
+	}
+
+	req = httptest.NewRequest(http.MethodPost, "/inbound/mime?token=", strings.NewReader(rawMIMEMessage))
+	if err := NewMIMEAdapter("", 1024).Verify(req); !errors.Is(err, ErrUnauthorized) {
+		t.Fatalf("Verify() without a secret configured error = %v, want ErrUnauthorized", err)
+	}
+
+	req = httptest.NewRequest(http.MethodPost, "/inbound/mime?token=s3cret&recipient=other@inbound.otto.dev", strings.NewReader(rawMIMEMessage))
+	if err := adapter.Verify(req); err != nil {
+		t.Fatalf("Verify() error = %v", err)
+	}
+	email, err := adapter.Parse(req)
+	if err != nil {
+		t.Fatalf("Parse() error = %v", err)
+	}
+	if email.Recipient != "other@inbound.otto.dev" {
+		t.Errorf("Recipient = %q, want query parameter override", email.Recipient)
+	}
+}
+
+func TestMailgunAdapter(t *testing.T) {
+	signingKey := "key-123"
+	mac := hmac.New(sha256.New, []byte(signingKey))
+	mac.Write([]byte("1700000000" + "tok"))
+	signature := hex.EncodeToString(mac.Sum(nil))
+
+	form := url.Values{
+		"recipient":       {"jsmith@inbound.otto.dev"},
+		"sender":          {"sales@dealer.com"},
+		"subject":         {"Quote"},
+		"body-plain":      {"Price is $30k"},
+		"Message-Id":      {"<m1@dealer.com>"},
+		"In-Reply-To":     {"<r1@gmail.com>"},
+		"timestamp":       {"1700000000"},
+		"token":           {"tok"},
+		"signature":       {signature},
+		"message-headers": {`[["Received", "by mx.dealer.com"], ["List-Unsubscribe", "<mailto:unsub@dealer.com>"]]`},
+	}
+
+	newRequest := func(form url.Values) *http.Request {
+		req := httptest.NewRequest(http.MethodPost, "/inbound", strings.NewReader(form.Encode()))
+		req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+		return req
+	}
+
+	adapter := NewMailgunAdapter(signingKey, 1024)
+	req := newRequest(form)
+	if err := adapter.Verify(req); err != nil {
+		t.Fatalf("Verify() error = %v", err)
+	}
+	email, err := adapter.Parse(req)
+	if err != nil {
+		t.Fatalf("Parse() error = %v", err)
+	}
+	if email.From != "sales@dealer.com" || email.Recipient != "jsmith@inbound.otto.dev" || email.InReplyTo != "<r1@gmail.com>" {
+		t.Errorf("Parse() = %+v", email)
+	}
+	if got := email.Headers.Get("List-Unsubscribe"); got != "<mailto:unsub@dealer.com>" {
+		t.Errorf("Headers[List-Unsubscribe] = %q", got)
+	}
+
+	form.Set("signature", "forged")
+	if err := adapter.Verify(newRequest(form)); !errors.Is(err, ErrUnauthorized) {
+		t.Errorf("Verify() with forged signature error = %v, want ErrUnauthorized", err)
+	}
+}
+
+func TestSendGridAdapter(t *testing.T) {
+	var body bytes.Buffer
+	writer := multipart.NewWriter(&body)
+	writer.WriteField("to", "Jane <jsmith@inbound.otto.dev>")
+	writer.WriteField("from", "Sam <sam@subaruofkirkland.com>")
+	writer.WriteField("subject", "Outback")
+	writer.WriteField("text", "Sale price $32,100")
+	writer.WriteField("headers", "Message-ID: <sg-1@subaruofkirkland.com>\nIn-Reply-To: <r2@gmail.com>\nReferences: <r1@gmail.com> <r2@gmail.com>\n")
+	writer.WriteField("envelope", `{"to":["jsmith+1a2b3c4d@inbound.otto.dev"],"from":"sam@subaruofkirkland.com"}`)
+	part, _ := writer.CreateFormFile("attachment1", "buyers-order.pdf")
+	part.Write([]byte("%PDF-1.4\n"))
+	writer.Close()
+
+	req := httptest.NewRequest(http.MethodPost, "/inbound/sendgrid", &body)
+	req.Header.Set("Content-Type", writer.FormDataContentType())
+
+	email, err := NewSendGridAdapter("", 1024).Parse(req)
+	if err != nil {
+		t.Fatalf("Parse() error = %v", err)
+	}
+	if email.Recipient != "jsmith+1a2b3c4d@inbound.otto.dev" {
+		t.Errorf("Recipient = %q, want envelope recipient", email.Recipient)
+	}
+	if email.MessageID != "<sg-1@subaruofkirkland.com>" || email.References != "<r1@gmail.com> <r2@gmail.com>" {
+		t.Errorf("headers not parsed: %+v", email)
+	}
+	if len(email.Attachments) != 1 || email.Attachments[0].Filename != "buyers-order.pdf" {
+		t.Errorf("Attachments = %+v", email.Attachments)
+	}
+}
+
+func TestPostmarkAdapter(t *testing.T) {
+	payload := `{
+		"From": "chris@eastsidemazda.com",
+		"To": "\"Jane\" <jsmith@inbound.otto.dev>",
+		"OriginalRecipient": "jsmith+1a2b3c4d@inbound.otto.dev",
+		"Subject": "CX-50",
+		"MessageID": "pm-uuid-1",
+		"TextBody": "Arriving on the 20th",
+		"HtmlBody": "<p>Arriving on the 20th</p>",
+		"Headers": [{"Name": "Message-ID", "Value": "<pm-1@eastsidemazda.com>"}, {"Name": "In-Reply-To", "Value": "<r3@gmail.com>"}],
+		"Attachments": [{"Name": "sticker.png", "Content": "iVBORw0KGgo=", "ContentType": "image/png", "ContentLength": 8}]
+	}`
+
+	req := httptest.NewRequest(http.MethodPost, "/inbound/postmark", strings.NewReader(payload))
+	req.SetBasicAuth("postmark", "s3cret")
+
+	adapter := NewPostmarkAdapter("s3cret", 1024)
+	if err := adapter.Verify(req); err != nil {
+		t.Fatalf("Verify() error = %v", err)
+	}
+	email, err := adapter.Parse(req)
+	if err != nil {
+		t.Fatalf("Parse() error = %v", err)
+	}
+	if email.Recipient != "jsmith+1a2b3c4d@inbound.otto.dev" || email.MessageID != "<pm-1@eastsidemazda.com>" || email.InReplyTo != "<r3@gmail.com>" {
+		t.Errorf("Parse() = %+v", email)
+	}
+	if len(email.Attachments) != 1 || len(email.Attachments[0].Data) != 8 {
+		t.Errorf("Attachments = %+v", email.Attachments)
+	}
+}
+
+const rawBounceMessage = "From: Mail Delivery Subsystem <mailer-daemon@googlemail.com>\r\n" +
+	"To: jane.doe@gmail.com\r\n" +
+	"Subject: Delivery Status Notification (Failure)\r\n" +
+	"Message-ID: <bounce-1@mx.google.com>\r\n" +
+	"MIME-Version: 1.0\r\n" +
+	"Content-Type: multipart/report; report-type=delivery-status; boundary=\"report\"\r\n" +
+	"\r\n" +
+	"--report\r\n" +
+	"Content-Type: text/plain; charset=\"utf-8\"\r\n" +
+	"\r\n" +
+	"Address not found. Your message wasn't delivered to sales@closedmotors.com.\r\n" +
+	"--report\r\n" +
+	"Content-Type: message/delivery-status\r\n" +
+	"\r\n" +
+	"Reporting-MTA: dns; googlemail.com\r\n" +
+	"\r\n" +
+	"Final-Recipient: rfc822; sales@closedmotors.com\r\n" +
+	"Action: failed\r\n" +
+	"Status: 5.1.1\r\n" +
+	"Diagnostic-Code: smtp; 550 5.1.1 The email account that you tried to reach does not exist.\r\n" +
+	"\r\n" +
+	"Final-Recipient: rfc822; fleet@slowmotors.com\r\n" +
+	"Action: delayed\r\n" +
+	"Status: 4.4.1\r\n" +
+	"\r\n" +
+	"--report\r\n" +
+	"Content-Type: message/rfc822\r\n" +
+	"\r\n" +
+	"From: Jane Doe <jane.doe@gmail.com>\r\n" +
+	"To: sales@closedmotors.com\r\n" +
+	"Subject: Re: Explorer XLT pricing\r\n" +
+	"Message-ID: <2f1c@inbound.otto.dev>\r\n" +
+	"\r\n" +
+	"Thanks, can you do $38,500?\r\n" +
+	"--report--\r\n"
+
+func TestParseBounce(t *testing.T) {
+	email, err := ParseMIME(strings.NewReader(rawBounceMessage), 1024)
+	if err != nil {
+		t.Fatalf("ParseMIME() error = %v", err)
+	}
+	if len(email.Attachments) != 0 {
+		t.Errorf("report parts should not become attachments, got %+v", email.Attachments)
+	}
+
+	events := ParseBounce(email)
+	if len(events) != 2 {
+		t.Fatalf("got %d events, want 2: %+v", len(events), events)
+	}
+
+	hard := events[0]
+	if hard.Type != DeliveryEventBounced || !hard.Permanent || hard.Recipient != "sales@closedmotors.com" || hard.MessageID != "<2f1c@inbound.otto.dev>" {
+		t.Errorf("hard bounce = %+v", hard)
+	}
+	if !strings.Contains(hard.Reason, "5.1.1") {
+		t.Errorf("hard bounce reason = %q, want the status code", hard.Reason)
+	}
+
+	soft := events[1]
+	if soft.Type != DeliveryEventDeferred || soft.Permanent || soft.Recipient != "fleet@slowmotors.com" {
+		t.Errorf("delayed recipient = %+v", soft)
+	}
+}
+
+func TestParseBounceWithoutReport(t *testing.T) {
+	// A forwarded or form-parsed bounce keeps only its text, which quotes addresses from the
+	// original message - none of them can be trusted as the failed recipient
+	email := &Email{
+		From:      "Mail Delivery Subsystem <mailer-daemon@googlemail.com>",
+		Subject:   "Delivery Status Notification (Failure)",
+		TextBody:  "Address not found\n\nYour message wasn't delivered to sales@closedmotors.com because the address couldn't be found.\n\n> On Mon, mike@northgateford.com wrote:\n\n550 5.1.1 The email account does not exist.",
+		InReplyTo: "<2f1c@inbound.otto.dev>",
+	}
+	if !IsBounce(email) {
+		t.Fatal("IsBounce() = false, want true")
+	}
+	if events := ParseBounce(email); events != nil {
+		t.Errorf("ParseBounce() without a delivery-status report = %+v, want nil", events)
+	}
+
+	reply := &Email{From: "mike@northgateford.com", Subject: "Re: Delivery date", TextBody: "It failed inspection, new date is the 20th."}
+	if events := ParseBounce(reply); events != nil {
+		t.Errorf("ParseBounce() on a normal reply = %+v, want nil", events)
+	}
+}
+
+func TestMailgunParseEvent(t *testing.T) {
+	signingKey := "key-123"
+	mac := hmac.New(sha256.New, []byte(signingKey))
+	mac.Write([]byte("1700000000" + "tok"))
+	signature := hex.EncodeToString(mac.Sum(nil))
+
+	payload := func(signature, event, severity string) []byte {
+		return []byte(`{
+			"signature": {"timestamp": "1700000000", "token": "tok", "signature": "` + signature + `"},
+			"event-data": {
+				"event": "` + event + `",
+				"severity": "` + severity + `",
+				"recipient": "sales@closedmotors.com",
+				"timestamp": 1700000000.25,
+				"delivery-status": {"code": 550, "message": "5.1.1 mailbox unavailable"},
+				"message": {"headers": {"message-id": "2f1c@inbound.otto.dev"}}
+			}
+		}`)
+	}
+
+	adapter := NewMailgunAdapter(signingKey, 1024)
+
+	tests := []struct {
+		event, severity string
+		wantType        DeliveryEventType
+		wantPermanent   bool
+	}{
+		{"delivered", "", DeliveryEventDelivered, false},
+		{"failed", "permanent", DeliveryEventBounced, true},
+		{"failed", "temporary", DeliveryEventDeferred, false},
+		{"complained", "", DeliveryEventComplained, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.event+" "+tt.severity, func(t *testing.T) {
+			event, err := adapter.ParseEvent(payload(signature, tt.event, tt.severity))
+			if err != nil {
+				t.Fatalf("ParseEvent() error = %v", err)
+			}
+			if event.Type != tt.wantType || event.Permanent != tt.wantPermanent {
+				t.Errorf("ParseEvent() = %+v", event)
+			}
+			if event.MessageID != "<2f1c@inbound.otto.dev>" || event.Recipient != "sales@closedmotors.com" {
+				t.Errorf("ParseEvent() = %+v", event)
+			}
+		})
+	}
+
+	if event, err := adapter.ParseEvent(payload(signature, "opened", "")); err != nil || event != nil {
+		t.Errorf("ParseEvent(opened) = %+v, %v, want nil event", event, err)
+	}
+	if _, err := adapter.ParseEvent(payload("forged", "delivered", "")); !errors.Is(err, ErrUnauthorized) {
+		t.Errorf("ParseEvent() with forged signature error = %v, want ErrUnauthorized", err)
+	}
+}
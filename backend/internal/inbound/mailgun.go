@@ -0,0 +1,168 @@
+package inbound
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/textproto"
+	"strings"
+	"time"
+)
+
+// MailgunAdapter parses Mailgun's inbound route webhook (form fields with attachment-N files)
+type MailgunAdapter struct {
+	signingKey         string
+	maxAttachmentBytes int64
+}
+
+// NewMailgunAdapter creates a Mailgun adapter. Signatures are only checked when signingKey is set.
+func NewMailgunAdapter(signingKey string, maxAttachmentBytes int64) *MailgunAdapter {
+	return &MailgunAdapter{
+		signingKey:         signingKey,
+		maxAttachmentBytes: maxAttachmentBytes,
+	}
+}
+
+func (a *MailgunAdapter) Name() string {
+	return "mailgun"
+}
+
+// Verify checks the HMAC signature Mailgun adds to the form fields
+func (a *MailgunAdapter) Verify(r *http.Request) error {
+	if a.signingKey == "" {
+		return nil
+	}
+	if err := parseForm(r); err != nil {
+		return ErrUnauthorized
+	}
+	if !a.verifySignature(r.FormValue("timestamp"), r.FormValue("token"), r.FormValue("signature")) {
+		return ErrUnauthorized
+	}
+	return nil
+}
+
+func (a *MailgunAdapter) Parse(r *http.Request) (*Email, error) {
+	if err := parseForm(r); err != nil {
+		return nil, fmt.Errorf("invalid form data: %w", err)
+	}
+
+	from := r.FormValue("from")
+	if from == "" {
+		from = r.FormValue("sender")
+	}
+
+	return &Email{
+		Recipient:   r.FormValue("recipient"),
+		From:        from,
+		Subject:     r.FormValue("subject"),
+		TextBody:    r.FormValue("body-plain"), // Full body - quotes and signatures are stripped by emailbody
+		HTMLBody:    r.FormValue("body-html"),
+		MessageID:   r.FormValue("Message-Id"),
+		InReplyTo:   r.FormValue("In-Reply-To"),
+		References:  r.FormValue("References"),
+		Headers:     mailgunHeaders(r.FormValue("message-headers")),
+		Attachments: readFormFiles(r.MultipartForm, a.maxAttachmentBytes),
+	}, nil
+}
+
+// verifySignature verifies the Mailgun webhook signature
+func (a *MailgunAdapter) verifySignature(timestamp, token, signature string) bool {
+	// Compute expected signature
+	h := hmac.New(sha256.New, []byte(a.signingKey))
+	h.Write([]byte(timestamp))
+	h.Write([]byte(token))
+	expected := hex.EncodeToString(h.Sum(nil))
+
+	// Compare signatures
+	return hmac.Equal([]byte(signature), []byte(expected))
+}
+
+// mailgunHeaders reads the message-headers field, a JSON list of [name, value] pairs
+func mailgunHeaders(field string) textproto.MIMEHeader {
+	header := textproto.MIMEHeader{}
+
+	var pairs [][]string
+	if err := json.Unmarshal([]byte(field), &pairs); err != nil {
+		return header
+	}
+	for _, pair := range pairs {
+		if len(pair) == 2 {
+			header.Add(pair[0], pair[1])
+		}
+	}
+	return header
+}
+
+// mailgunEventPayload holds the fields used from Mailgun's event webhook JSON
+type mailgunEventPayload struct {
+	Signature struct {
+		Timestamp string `json:"timestamp"`
+		Token     string `json:"token"`
+		Signature string `json:"signature"`
+	} `json:"signature"`
+	EventData struct {
+		Event          string  `json:"event"`
+		Severity       string  `json:"severity"`
+		Reason         string  `json:"reason"`
+		Recipient      string  `json:"recipient"`
+		Timestamp      float64 `json:"timestamp"`
+		DeliveryStatus struct {
+			Code        int    `json:"code"`
+			Message     string `json:"message"`
+			Description string `json:"description"`
+		} `json:"delivery-status"`
+		Message struct {
+			Headers struct {
+				MessageID string `json:"message-id"`
+			} `json:"headers"`
+		} `json:"message"`
+	} `json:"event-data"`
+}
+
+// ParseEvent verifies and parses a Mailgun event webhook. It returns nil for events that
+// don't change delivery status, such as opens and clicks.
+func (a *MailgunAdapter) ParseEvent(payload []byte) (*DeliveryEvent, error) {
+	var parsed mailgunEventPayload
+	if err := json.Unmarshal(payload, &parsed); err != nil {
+		return nil, fmt.Errorf("invalid JSON payload: %w", err)
+	}
+
+	if a.signingKey != "" && !a.verifySignature(parsed.Signature.Timestamp, parsed.Signature.Token, parsed.Signature.Signature) {
+		return nil, ErrUnauthorized
+	}
+
+	data := parsed.EventData
+	event := &DeliveryEvent{
+		Recipient: data.Recipient,
+		Reason:    joinReason(data.Reason, data.DeliveryStatus.Description, data.DeliveryStatus.Message),
+		Timestamp: time.Unix(int64(data.Timestamp), 0),
+	}
+	// Mailgun reports the Message-ID without angle brackets
+	if messageID := strings.Trim(data.Message.Headers.MessageID, "<> "); messageID != "" {
+		event.MessageID = "<" + messageID + ">"
+	}
+	if data.Timestamp == 0 {
+		event.Timestamp = time.Now()
+	}
+
+	switch data.Event {
+	case "delivered":
+		event.Type = DeliveryEventDelivered
+	case "failed":
+		if data.Severity == "temporary" {
+			event.Type = DeliveryEventDeferred
+		} else {
+			event.Type = DeliveryEventBounced
+			event.Permanent = true
+		}
+	case "complained":
+		event.Type = DeliveryEventComplained
+	default:
+		return nil, nil
+	}
+
+	return event, nil
+}
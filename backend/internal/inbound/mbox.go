@@ -0,0 +1,88 @@
+package inbound
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"io"
+	"log"
+	"regexp"
+)
+
+// mboxEscapedFrom matches body lines that mbox writers quote so they aren't read as a separator
+var mboxEscapedFrom = regexp.MustCompile(`^>+From `)
+
+// ParseArchive parses an uploaded email file: either a single .eml message or an mbox archive
+// of many. Messages in an mbox that can't be parsed are skipped and counted.
+func ParseArchive(r io.Reader, maxAttachmentBytes int64) ([]*Email, int, error) {
+	reader := bufio.NewReader(r)
+	start, err := reader.Peek(5)
+	if err != nil && err != io.EOF {
+		return nil, 0, fmt.Errorf("failed to read email file: %w", err)
+	}
+
+	if string(start) == "From " {
+		return ParseMbox(reader, maxAttachmentBytes)
+	}
+
+	email, err := ParseMIME(reader, maxAttachmentBytes)
+	if err != nil {
+		return nil, 0, err
+	}
+	return []*Email{email}, 0, nil
+}
+
+// ParseMbox parses an mbox archive (mboxo or mboxrd, as exported by Gmail, Thunderbird and
+// Apple Mail). It returns the parsed messages and how many couldn't be parsed.
+func ParseMbox(r io.Reader, maxAttachmentBytes int64) ([]*Email, int, error) {
+	reader := bufio.NewReader(r)
+
+	var emails []*Email
+	skipped := 0
+	var message bytes.Buffer
+	inMessage := false
+	previousBlank := true
+
+	flush := func() {
+		if !inMessage {
+			return
+		}
+		email, err := ParseMIME(bytes.NewReader(message.Bytes()), maxAttachmentBytes)
+		if err != nil {
+			log.Printf("Skipping unparseable mbox message %d: %v", len(emails)+skipped+1, err)
+			skipped++
+		} else {
+			emails = append(emails, email)
+		}
+		message.Reset()
+	}
+
+	for {
+		line, err := reader.ReadBytes('\n')
+		if len(line) > 0 {
+			blank := len(bytes.TrimRight(line, "\r\n")) == 0
+
+			// A "From " line after a blank line (or at the start) begins the next message
+			if previousBlank && bytes.HasPrefix(line, []byte("From ")) {
+				flush()
+				inMessage = true
+			} else if inMessage {
+				if mboxEscapedFrom.Match(line) {
+					line = line[1:]
+				}
+				message.Write(line)
+			}
+			previousBlank = blank
+		}
+
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, 0, fmt.Errorf("failed to read mbox: %w", err)
+		}
+	}
+	flush()
+
+	return emails, skipped, nil
+}
@@ -0,0 +1,259 @@
+package inbound
+
+import (
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"io"
+	"mime"
+	"mime/multipart"
+	"mime/quotedprintable"
+	"net/http"
+	"net/mail"
+	"net/textproto"
+	"strings"
+
+	"golang.org/x/net/html/charset"
+)
+
+const (
+	// maxMIMEBytes caps a raw message POST
+	maxMIMEBytes = 50 << 20 // 50MB
+	// maxMIMEDepth stops runaway nesting of multipart bodies
+	maxMIMEDepth = 10
+	// maxReportPartBytes caps how much of a bounce report part is read
+	maxReportPartBytes = 64 << 10 // 64KB
+)
+
+var headerDecoder = &mime.WordDecoder{CharsetReader: charset.NewReaderLabel}
+
+// MIMEAdapter accepts a raw RFC 5322 message as the request body. This covers providers
+// that forward the original message as-is, such as SES via SNS or a Postfix pipe.
+type MIMEAdapter struct {
+	secret             string
+	maxAttachmentBytes int64
+}
+
+// NewMIMEAdapter creates a raw MIME adapter, checking the shared secret when set
+func NewMIMEAdapter(secret string, maxAttachmentBytes int64) *MIMEAdapter {
+	return &MIMEAdapter{
+		secret:             secret,
+		maxAttachmentBytes: maxAttachmentBytes,
+	}
+}
+
+func (a *MIMEAdapter) Name() string {
+	return "mime"
+}
+
+func (a *MIMEAdapter) Verify(r *http.Request) error {
+	return checkSharedSecret(r, a.secret)
+}
+
+// Parse reads the message from the request body. The envelope recipient can be passed as a
+// recipient query parameter; otherwise it is read from the delivery headers.
+func (a *MIMEAdapter) Parse(r *http.Request) (*Email, error) {
+	email, err := ParseMIME(io.LimitReader(r.Body, maxMIMEBytes), a.maxAttachmentBytes)
+	if err != nil {
+		return nil, err
+	}
+
+	if recipient := r.URL.Query().Get("recipient"); recipient != "" {
+		email.Recipient = recipient
+	}
+
+	return email, nil
+}
+
+// ParseMIME parses a raw RFC 5322 message. The first text/plain and text/html parts become
+// the bodies; parts with a filename or an attachment disposition become attachments.
+func ParseMIME(r io.Reader, maxAttachmentBytes int64) (*Email, error) {
+	msg, err := mail.ReadMessage(r)
+	if err != nil {
+		return nil, fmt.Errorf("invalid MIME message: %w", err)
+	}
+
+	header := msg.Header
+	email := &Email{
+		Recipient:  mimeRecipient(header),
+		From:       decodeHeader(header.Get("From")),
+		To:         decodeHeader(header.Get("To")),
+		Subject:    decodeHeader(header.Get("Subject")),
+		MessageID:  header.Get("Message-Id"),
+		InReplyTo:  header.Get("In-Reply-To"),
+		References: header.Get("References"),
+		Headers:    textproto.MIMEHeader(header),
+	}
+
+	if date, err := header.Date(); err == nil {
+		email.Date = date
+	}
+
+	parser := &mimeParser{email: email, maxAttachmentBytes: maxAttachmentBytes}
+	if err := parser.walk(textproto.MIMEHeader(header), msg.Body, 0, false); err != nil {
+		return nil, err
+	}
+
+	return email, nil
+}
+
+type mimeParser struct {
+	email              *Email
+	maxAttachmentBytes int64
+}
+
+// walk visits a part and its children. inReport is set for the children of a multipart/report.
+func (p *mimeParser) walk(header textproto.MIMEHeader, body io.Reader, depth int, inReport bool) error {
+	if depth > maxMIMEDepth {
+		return errors.New("MIME message is nested too deeply")
+	}
+
+	mediaType, params, err := mime.ParseMediaType(header.Get("Content-Type"))
+	if err != nil {
+		mediaType, params = "text/plain", map[string]string{}
+	}
+
+	if strings.HasPrefix(mediaType, "multipart/") {
+		reader := multipart.NewReader(body, params["boundary"])
+		for {
+			part, err := reader.NextRawPart()
+			if err == io.EOF {
+				return nil
+			}
+			if err != nil {
+				return fmt.Errorf("invalid multipart body: %w", err)
+			}
+			if err := p.walk(part.Header, part, depth+1, mediaType == "multipart/report"); err != nil {
+				return err
+			}
+		}
+	}
+
+	decoded := decodeTransferEncoding(header.Get("Content-Transfer-Encoding"), body)
+
+	// Bounce report parts are kept for ParseBounce rather than stored as attachments
+	switch {
+	case mediaType == "message/delivery-status" || mediaType == "message/global-delivery-status":
+		text, err := readText(io.LimitReader(decoded, maxReportPartBytes), params["charset"])
+		if err != nil {
+			return fmt.Errorf("failed to read %s part: %w", mediaType, err)
+		}
+		p.email.DeliveryStatus = text
+		return nil
+	case inReport && (mediaType == "text/rfc822-headers" || mediaType == "message/rfc822" || mediaType == "message/global-headers"):
+		text, err := readText(io.LimitReader(decoded, maxReportPartBytes), params["charset"])
+		if err != nil {
+			return fmt.Errorf("failed to read %s part: %w", mediaType, err)
+		}
+		p.email.OriginalHeaders = headerBlock(text)
+		return nil
+	}
+
+	disposition, dispositionParams, _ := mime.ParseMediaType(header.Get("Content-Disposition"))
+	filename := dispositionParams["filename"]
+	if filename == "" {
+		filename = params["name"]
+	}
+
+	if disposition == "attachment" || filename != "" {
+		return p.addAttachment(decodeHeader(filename), mediaType, decoded)
+	}
+
+	switch mediaType {
+	case "text/plain", "text/html":
+		text, err := readText(decoded, params["charset"])
+		if err != nil {
+			return fmt.Errorf("failed to read %s part: %w", mediaType, err)
+		}
+		if mediaType == "text/plain" && p.email.TextBody == "" {
+			p.email.TextBody = text
+		} else if mediaType == "text/html" && p.email.HTMLBody == "" {
+			p.email.HTMLBody = text
+		}
+	}
+
+	return nil
+}
+
+func (p *mimeParser) addAttachment(filename, contentType string, body io.Reader) error {
+	limit := p.maxAttachmentBytes
+	if limit <= 0 {
+		limit = maxMIMEBytes
+	}
+
+	data, err := io.ReadAll(io.LimitReader(body, limit+1))
+	if err != nil {
+		return fmt.Errorf("failed to read attachment %s: %w", filename, err)
+	}
+
+	attachment := Attachment{
+		Filename:    filename,
+		ContentType: contentType,
+		Size:        int64(len(data)),
+		Data:        data,
+	}
+	if int64(len(data)) > limit {
+		// Over the limit - record the attachment without its content so it is rejected
+		attachment.Data = nil
+	}
+
+	p.email.Attachments = append(p.email.Attachments, attachment)
+	return nil
+}
+
+// decodeTransferEncoding undoes base64 and quoted-printable transfer encodings
+func decodeTransferEncoding(encoding string, body io.Reader) io.Reader {
+	switch strings.ToLower(strings.TrimSpace(encoding)) {
+	case "base64":
+		return base64.NewDecoder(base64.StdEncoding, body)
+	case "quoted-printable":
+		return quotedprintable.NewReader(body)
+	default:
+		return body
+	}
+}
+
+// readText reads a text part, converting it to UTF-8 from its declared charset
+func readText(body io.Reader, charsetLabel string) (string, error) {
+	label := strings.ToLower(strings.TrimSpace(charsetLabel))
+	if label != "" && label != "utf-8" && label != "us-ascii" {
+		converted, err := charset.NewReaderLabel(label, body)
+		if err == nil {
+			body = converted
+		}
+	}
+
+	data, err := io.ReadAll(body)
+	if err != nil {
+		return "", err
+	}
+	return string(data), nil
+}
+
+// decodeHeader decodes RFC 2047 encoded words such as =?UTF-8?Q?...?=
+func decodeHeader(value string) string {
+	decoded, err := headerDecoder.DecodeHeader(value)
+	if err != nil {
+		return value
+	}
+	return decoded
+}
+
+// headerBlock returns the header section of a message, dropping the body
+func headerBlock(message string) string {
+	message = strings.ReplaceAll(message, "\r\n", "\n")
+	if end := strings.Index(message, "\n\n"); end != -1 {
+		return message[:end]
+	}
+	return message
+}
+
+// mimeRecipient finds the envelope recipient from the headers mail servers add on delivery
+func mimeRecipient(header mail.Header) string {
+	for _, key := range []string{"Delivered-To", "X-Original-To", "Envelope-To", "To"} {
+		if value := header.Get(key); value != "" {
+			return firstAddress(value)
+		}
+	}
+	return ""
+}
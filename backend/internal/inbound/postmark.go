@@ -0,0 +1,115 @@
+package inbound
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"net/textproto"
+	"strings"
+)
+
+// maxPostmarkBodyBytes caps the JSON payload. Postmark inlines attachments as base64, so
+// the limit allows for several attachments at the size cap.
+const maxPostmarkBodyBytes = 100 << 20 // 100MB
+
+// PostmarkAdapter parses Postmark's JSON inbound webhook
+type PostmarkAdapter struct {
+	secret             string
+	maxAttachmentBytes int64
+}
+
+// NewPostmarkAdapter creates a Postmark adapter. Postmark authenticates with basic auth in
+// the webhook URL, which is checked against the shared secret when set.
+func NewPostmarkAdapter(secret string, maxAttachmentBytes int64) *PostmarkAdapter {
+	return &PostmarkAdapter{
+		secret:             secret,
+		maxAttachmentBytes: maxAttachmentBytes,
+	}
+}
+
+func (a *PostmarkAdapter) Name() string {
+	return "postmark"
+}
+
+// postmarkPayload holds the fields used from Postmark's inbound JSON
+type postmarkPayload struct {
+	From              string `json:"From"`
+	OriginalRecipient string `json:"OriginalRecipient"`
+	To                string `json:"To"`
+	Subject           string `json:"Subject"`
+	MessageID         string `json:"MessageID"`
+	TextBody          string `json:"TextBody"`
+	HTMLBody          string `json:"HtmlBody"`
+	Headers           []struct {
+		Name  string `json:"Name"`
+		Value string `json:"Value"`
+	} `json:"Headers"`
+	Attachments []struct {
+		Name          string `json:"Name"`
+		Content       string `json:"Content"`
+		ContentType   string `json:"ContentType"`
+		ContentLength int64  `json:"ContentLength"`
+	} `json:"Attachments"`
+}
+
+func (a *PostmarkAdapter) Verify(r *http.Request) error {
+	return checkSharedSecret(r, a.secret)
+}
+
+func (a *PostmarkAdapter) Parse(r *http.Request) (*Email, error) {
+	var payload postmarkPayload
+	if err := json.NewDecoder(io.LimitReader(r.Body, maxPostmarkBodyBytes)).Decode(&payload); err != nil {
+		return nil, fmt.Errorf("invalid JSON payload: %w", err)
+	}
+
+	email := &Email{
+		Recipient: payload.OriginalRecipient,
+		From:      payload.From,
+		Subject:   payload.Subject,
+		TextBody:  payload.TextBody,
+		HTMLBody:  payload.HTMLBody,
+		Headers:   textproto.MIMEHeader{},
+	}
+	if email.Recipient == "" {
+		email.Recipient = firstAddress(payload.To)
+	}
+
+	for _, header := range payload.Headers {
+		email.Headers.Add(header.Name, header.Value)
+		switch strings.ToLower(header.Name) {
+		case "message-id":
+			email.MessageID = header.Value
+		case "in-reply-to":
+			email.InReplyTo = header.Value
+		case "references":
+			email.References = header.Value
+		}
+	}
+	if email.MessageID == "" {
+		// Postmark's own ID is still unique per message, which is enough for deduplication
+		email.MessageID = payload.MessageID
+	}
+
+	for _, file := range payload.Attachments {
+		attachment := Attachment{
+			Filename:    file.Name,
+			ContentType: file.ContentType,
+			Size:        file.ContentLength,
+		}
+		if a.maxAttachmentBytes <= 0 || file.ContentLength <= a.maxAttachmentBytes {
+			data, err := base64.StdEncoding.DecodeString(file.Content)
+			if err != nil {
+				log.Printf("Failed to decode attachment %s: %v", file.Name, err)
+			} else {
+				attachment.Data = data
+				attachment.Size = int64(len(data))
+			}
+		}
+		email.Attachments = append(email.Attachments, attachment)
+	}
+
+	return email, nil
+}
@@ -0,0 +1,97 @@
+package inbound
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/textproto"
+	"strings"
+)
+
+// SendGridAdapter parses SendGrid Inbound Parse webhooks, in both the default parsed
+// format and the "POST the raw, full MIME message" format
+type SendGridAdapter struct {
+	secret             string
+	maxAttachmentBytes int64
+}
+
+// NewSendGridAdapter creates a SendGrid adapter. Inbound Parse doesn't sign requests, so
+// the shared secret is checked when set.
+func NewSendGridAdapter(secret string, maxAttachmentBytes int64) *SendGridAdapter {
+	return &SendGridAdapter{
+		secret:             secret,
+		maxAttachmentBytes: maxAttachmentBytes,
+	}
+}
+
+func (a *SendGridAdapter) Name() string {
+	return "sendgrid"
+}
+
+func (a *SendGridAdapter) Verify(r *http.Request) error {
+	return checkSharedSecret(r, a.secret)
+}
+
+func (a *SendGridAdapter) Parse(r *http.Request) (*Email, error) {
+	if err := parseForm(r); err != nil {
+		return nil, fmt.Errorf("invalid form data: %w", err)
+	}
+
+	recipient := sendGridEnvelopeRecipient(r.FormValue("envelope"))
+
+	// Raw mode posts the whole message in the email field
+	if raw := r.FormValue("email"); raw != "" {
+		email, err := ParseMIME(strings.NewReader(raw), a.maxAttachmentBytes)
+		if err != nil {
+			return nil, err
+		}
+		if recipient != "" {
+			email.Recipient = recipient
+		}
+		return email, nil
+	}
+
+	headers := parseHeaderBlock(r.FormValue("headers"))
+	// With spam checking on, the score is posted as its own field rather than a header
+	if score := r.FormValue("spam_score"); score != "" && headers.Get("X-Spam-Score") == "" {
+		headers.Set("X-Spam-Score", score)
+	}
+	if recipient == "" {
+		recipient = firstAddress(r.FormValue("to"))
+	}
+
+	return &Email{
+		Recipient:   recipient,
+		From:        r.FormValue("from"),
+		Subject:     r.FormValue("subject"),
+		TextBody:    r.FormValue("text"),
+		HTMLBody:    r.FormValue("html"),
+		MessageID:   headers.Get("Message-Id"),
+		InReplyTo:   headers.Get("In-Reply-To"),
+		References:  headers.Get("References"),
+		Headers:     headers,
+		Attachments: readFormFiles(r.MultipartForm, a.maxAttachmentBytes),
+	}, nil
+}
+
+// sendGridEnvelopeRecipient reads the first recipient from the envelope JSON field
+func sendGridEnvelopeRecipient(envelope string) string {
+	var parsed struct {
+		To []string `json:"to"`
+	}
+	if err := json.Unmarshal([]byte(envelope), &parsed); err != nil || len(parsed.To) == 0 {
+		return ""
+	}
+	return parsed.To[0]
+}
+
+// parseHeaderBlock parses a raw RFC 5322 header block
+func parseHeaderBlock(block string) textproto.MIMEHeader {
+	block = strings.TrimRight(block, "\r\n") + "\r\n\r\n"
+	header, err := textproto.NewReader(bufio.NewReader(strings.NewReader(block))).ReadMIMEHeader()
+	if err != nil && header == nil {
+		return textproto.MIMEHeader{}
+	}
+	return header
+}
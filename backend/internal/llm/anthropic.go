@@ -0,0 +1,181 @@
+package llm
+
+import (
+	"context"
+	"encoding/base64"
+	"fmt"
+	"strings"
+
+	"github.com/anthropics/anthropic-sdk-go"
+	"github.com/anthropics/anthropic-sdk-go/option"
+)
+
+// Anthropic is an LLM backed by the Anthropic Messages API
+type Anthropic struct {
+	client anthropic.Client
+}
+
+// NewAnthropic creates an Anthropic LLM
+func NewAnthropic(apiKey string) *Anthropic {
+	return &Anthropic{
+		client: anthropic.NewClient(option.WithAPIKey(apiKey)),
+	}
+}
+
+func (a *Anthropic) Complete(ctx context.Context, req Request) (*Response, error) {
+	params, err := anthropicParams(req)
+	if err != nil {
+		return nil, err
+	}
+
+	message, err := a.client.Messages.New(ctx, params)
+	if err != nil {
+		return nil, fmt.Errorf("claude API error: %w", err)
+	}
+
+	return anthropicResponse(message)
+}
+
+func (a *Anthropic) CompleteJSON(ctx context.Context, req Request, out interface{}) (*Response, error) {
+	response, err := a.Complete(ctx, req)
+	if err != nil {
+		return nil, err
+	}
+	if err := DecodeJSON(response.Text, out); err != nil {
+		return response, err
+	}
+	return response, nil
+}
+
+func (a *Anthropic) Stream(ctx context.Context, req Request, onDelta func(text string)) (*Response, error) {
+	params, err := anthropicParams(req)
+	if err != nil {
+		return nil, err
+	}
+
+	stream := a.client.Messages.NewStreaming(ctx, params)
+	defer stream.Close()
+
+	var message anthropic.Message
+	for stream.Next() {
+		event := stream.Current()
+		if err := message.Accumulate(event); err != nil {
+			return partialResponse(&message), fmt.Errorf("claude stream error: %w", err)
+		}
+
+		if delta, ok := event.AsAny().(anthropic.ContentBlockDeltaEvent); ok {
+			if text, ok := delta.Delta.AsAny().(anthropic.TextDelta); ok && text.Text != "" {
+				onDelta(text.Text)
+			}
+		}
+	}
+	if err := stream.Err(); err != nil {
+		return partialResponse(&message), fmt.Errorf("claude API error: %w", err)
+	}
+
+	return anthropicResponse(&message)
+}
+
+// partialResponse returns the usage of a stream that was cut short, so the tokens it used
+// are still recorded. Returns nil if the stream ended before the model started responding.
+func partialResponse(message *anthropic.Message) *Response {
+	if message.Usage.InputTokens == 0 {
+		return nil
+	}
+	return &Response{
+		Model: Model(message.Model),
+		Usage: Usage{
+			InputTokens:  int(message.Usage.InputTokens),
+			OutputTokens: int(message.Usage.OutputTokens),
+		},
+	}
+}
+
+// anthropicParams converts a request to Messages API parameters
+func anthropicParams(req Request) (anthropic.MessageNewParams, error) {
+	req = withDefaults(req)
+
+	messages := make([]anthropic.MessageParam, 0, len(req.Messages))
+	for _, msg := range req.Messages {
+		blocks := make([]anthropic.ContentBlockParamUnion, 0, len(msg.Parts))
+		for _, part := range msg.Parts {
+			switch {
+			case part.ToolCall != nil:
+				blocks = append(blocks, anthropic.NewToolUseBlock(part.ToolCall.ID, part.ToolCall.Input, part.ToolCall.Name))
+			case part.ToolResult != nil:
+				blocks = append(blocks, anthropic.NewToolResultBlock(part.ToolResult.ToolCallID, part.ToolResult.Content, part.ToolResult.IsError))
+			case part.Data == nil:
+				blocks = append(blocks, anthropic.NewTextBlock(part.Text))
+			case part.MediaType == "application/pdf":
+				blocks = append(blocks, anthropic.NewDocumentBlock(anthropic.Base64PDFSourceParam{
+					Data: base64.StdEncoding.EncodeToString(part.Data),
+				}))
+			case strings.HasPrefix(part.MediaType, "image/"):
+				blocks = append(blocks, anthropic.NewImageBlockBase64(part.MediaType, base64.StdEncoding.EncodeToString(part.Data)))
+			default:
+				return anthropic.MessageNewParams{}, fmt.Errorf("unsupported document type: %s", part.MediaType)
+			}
+		}
+
+		if msg.Role == RoleAssistant {
+			messages = append(messages, anthropic.NewAssistantMessage(blocks...))
+		} else {
+			messages = append(messages, anthropic.NewUserMessage(blocks...))
+		}
+	}
+
+	params := anthropic.MessageNewParams{
+		Model:     anthropic.Model(req.Model),
+		MaxTokens: int64(req.MaxTokens),
+		Messages:  messages,
+	}
+	if req.System != "" {
+		params.System = []anthropic.TextBlockParam{{Text: req.System}}
+	}
+	if req.UserID != "" {
+		params.Metadata = anthropic.MetadataParam{UserID: anthropic.String(req.UserID)}
+	}
+	for _, tool := range req.Tools {
+		params.Tools = append(params.Tools, anthropic.ToolUnionParam{OfTool: &anthropic.ToolParam{
+			Name:        tool.Name,
+			Description: anthropic.String(tool.Description),
+			InputSchema: anthropic.ToolInputSchemaParam{
+				Properties: tool.Properties,
+				Required:   tool.Required,
+			},
+		}})
+	}
+	return params, nil
+}
+
+// anthropicResponse reads the text and tool calls of a Messages API response
+func anthropicResponse(message *anthropic.Message) (*Response, error) {
+	if len(message.Content) == 0 {
+		return nil, fmt.Errorf("empty response from Claude")
+	}
+
+	var text strings.Builder
+	var toolCalls []ToolCall
+	for _, block := range message.Content {
+		switch block.Type {
+		case "text":
+			text.WriteString(block.Text)
+		case "tool_use":
+			toolCalls = append(toolCalls, ToolCall{ID: block.ID, Name: block.Name, Input: block.Input})
+		}
+	}
+	if text.Len() == 0 && len(toolCalls) == 0 {
+		return nil, fmt.Errorf("unexpected response format from Claude")
+	}
+
+	return &Response{
+		Text:       strings.TrimSpace(text.String()),
+		ToolCalls:  toolCalls,
+		Model:      Model(message.Model),
+		StopReason: string(message.StopReason),
+		Usage: Usage{
+			InputTokens:  int(message.Usage.InputTokens),
+			OutputTokens: int(message.Usage.OutputTokens),
+		},
+	}, nil
+}
@@ -0,0 +1,174 @@
+package llm
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"sync"
+)
+
+// ErrNotRecorded is returned by a replaying LLM for a request its cassette has no response for
+var ErrNotRecorded = errors.New("no recorded response for request")
+
+// Cassette holds model responses keyed by the request that produced them, so a run can be
+// recorded against a real model once and replayed offline after
+type Cassette struct {
+	mu        sync.Mutex
+	Responses map[string]*Response `json:"responses"`
+}
+
+// NewCassette creates an empty cassette
+func NewCassette() *Cassette {
+	return &Cassette{Responses: map[string]*Response{}}
+}
+
+// LoadCassette reads a cassette saved with Save
+func LoadCassette(path string) (*Cassette, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	cassette := NewCassette()
+	if err := json.Unmarshal(data, cassette); err != nil {
+		return nil, fmt.Errorf("invalid cassette %s: %w", path, err)
+	}
+	if cassette.Responses == nil {
+		cassette.Responses = map[string]*Response{}
+	}
+	return cassette, nil
+}
+
+// Save writes the cassette to path
+func (c *Cassette) Save(path string) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	data, err := json.MarshalIndent(c, "", "  ")
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(path, data, 0o644)
+}
+
+// Len returns how many responses are recorded
+func (c *Cassette) Len() int {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	return len(c.Responses)
+}
+
+func (c *Cassette) get(req Request) (*Response, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	response, ok := c.Responses[RequestKey(req)]
+	return response, ok
+}
+
+func (c *Cassette) put(req Request, response *Response) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.Responses[RequestKey(req)] = response
+}
+
+// RequestKey identifies a request by what is sent to the model. The user it is for isn't
+// part of it, so recordings replay for any user.
+func RequestKey(req Request) string {
+	req = withDefaults(req)
+	req.UserID = ""
+
+	data, err := json.Marshal(req)
+	if err != nil {
+		// Requests are plain data, so this doesn't happen
+		panic(fmt.Sprintf("llm: can't encode request: %v", err))
+	}
+	sum := sha256.Sum256(data)
+	return hex.EncodeToString(sum[:])
+}
+
+// recorder is an LLM that saves every response of the LLM it wraps to a cassette
+type recorder struct {
+	llm      LLM
+	cassette *Cassette
+}
+
+// NewRecorder wraps an LLM so its responses are saved to cassette
+func NewRecorder(llm LLM, cassette *Cassette) LLM {
+	return &recorder{llm: llm, cassette: cassette}
+}
+
+func (r *recorder) Complete(ctx context.Context, req Request) (*Response, error) {
+	response, err := r.llm.Complete(ctx, req)
+	if err == nil {
+		r.cassette.put(req, response)
+	}
+	return response, err
+}
+
+func (r *recorder) CompleteJSON(ctx context.Context, req Request, out interface{}) (*Response, error) {
+	response, err := r.llm.CompleteJSON(ctx, req, out)
+	if response != nil {
+		r.cassette.put(req, response)
+	}
+	return response, err
+}
+
+func (r *recorder) Stream(ctx context.Context, req Request, onDelta func(text string)) (*Response, error) {
+	response, err := r.llm.Stream(ctx, req, onDelta)
+	if err == nil {
+		r.cassette.put(req, response)
+	}
+	return response, err
+}
+
+// replayer is an LLM that answers from a cassette without calling a model
+type replayer struct {
+	cassette *Cassette
+}
+
+// NewReplayer creates an LLM that returns the responses recorded in cassette, and
+// ErrNotRecorded for requests that weren't recorded
+func NewReplayer(cassette *Cassette) LLM {
+	return &replayer{cassette: cassette}
+}
+
+func (r *replayer) Complete(ctx context.Context, req Request) (*Response, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	response, ok := r.cassette.get(req)
+	if !ok {
+		return nil, fmt.Errorf("%w (%s, key %.12s)", ErrNotRecorded, req.Purpose, RequestKey(req))
+	}
+	copied := *response
+	return &copied, nil
+}
+
+func (r *replayer) CompleteJSON(ctx context.Context, req Request, out interface{}) (*Response, error) {
+	response, err := r.Complete(ctx, req)
+	if err != nil {
+		return nil, err
+	}
+	if err := DecodeJSON(response.Text, out); err != nil {
+		return response, err
+	}
+	return response, nil
+}
+
+// Stream delivers the recorded response in one piece
+func (r *replayer) Stream(ctx context.Context, req Request, onDelta func(text string)) (*Response, error) {
+	response, err := r.Complete(ctx, req)
+	if err != nil {
+		return nil, err
+	}
+	if response.Text != "" {
+		onDelta(response.Text)
+	}
+	return response, nil
+}
@@ -0,0 +1,145 @@
+package llm
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"sync"
+)
+
+// ErrScriptExhausted is returned by a Fake that has no responses left
+var ErrScriptExhausted = errors.New("fake LLM has no scripted responses left")
+
+// FakeResponse is a scripted response: the text to return and any tools to call, or an error
+type FakeResponse struct {
+	Text      string
+	ToolCalls []ToolCall
+	Err       error
+}
+
+// Fake is a deterministic LLM for tests. It returns scripted responses in order and records
+// every request it receives.
+type Fake struct {
+	mu        sync.Mutex
+	responses []FakeResponse
+	requests  []Request
+}
+
+// NewFake creates a Fake that returns the given texts in order
+func NewFake(texts ...string) *Fake {
+	fake := &Fake{}
+	for _, text := range texts {
+		fake.responses = append(fake.responses, FakeResponse{Text: text})
+	}
+	return fake
+}
+
+// Add appends scripted responses
+func (f *Fake) Add(responses ...FakeResponse) *Fake {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	f.responses = append(f.responses, responses...)
+	return f
+}
+
+// Requests returns the requests received so far
+func (f *Fake) Requests() []Request {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	return append([]Request(nil), f.requests...)
+}
+
+// Remaining returns how many scripted responses haven't been used
+func (f *Fake) Remaining() int {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	return len(f.responses)
+}
+
+func (f *Fake) Complete(ctx context.Context, req Request) (*Response, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+
+	req = withDefaults(req)
+
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	f.requests = append(f.requests, req)
+	if len(f.responses) == 0 {
+		return nil, ErrScriptExhausted
+	}
+	next := f.responses[0]
+	f.responses = f.responses[1:]
+	if next.Err != nil {
+		return nil, next.Err
+	}
+
+	stopReason := "end_turn"
+	if len(next.ToolCalls) > 0 {
+		stopReason = StopReasonToolUse
+	}
+
+	return &Response{
+		Text:       strings.TrimSpace(next.Text),
+		ToolCalls:  next.ToolCalls,
+		Model:      req.Model,
+		StopReason: stopReason,
+		Usage: Usage{
+			InputTokens:  fakeTokens(req),
+			OutputTokens: len(strings.Fields(next.Text)),
+		},
+	}, nil
+}
+
+func (f *Fake) CompleteJSON(ctx context.Context, req Request, out interface{}) (*Response, error) {
+	response, err := f.Complete(ctx, req)
+	if err != nil {
+		return nil, err
+	}
+	if err := DecodeJSON(response.Text, out); err != nil {
+		return response, err
+	}
+	return response, nil
+}
+
+// Stream delivers the scripted response a word at a time. When ctx is cancelled part way,
+// the words delivered so far are returned as a partial response.
+func (f *Fake) Stream(ctx context.Context, req Request, onDelta func(text string)) (*Response, error) {
+	response, err := f.Complete(ctx, req)
+	if err != nil {
+		return nil, err
+	}
+
+	var sent []string
+	for _, word := range strings.SplitAfter(response.Text, " ") {
+		if err := ctx.Err(); err != nil {
+			partial := *response
+			partial.Text = strings.Join(sent, "")
+			partial.ToolCalls = nil
+			partial.Usage.OutputTokens = len(strings.Fields(partial.Text))
+			return &partial, err
+		}
+		onDelta(word)
+		sent = append(sent, word)
+	}
+	return response, nil
+}
+
+// fakeTokens approximates a request's input tokens as its word count
+func fakeTokens(req Request) int {
+	count := len(strings.Fields(req.System))
+	for _, msg := range req.Messages {
+		for _, part := range msg.Parts {
+			count += len(strings.Fields(part.Text))
+			if part.ToolResult != nil {
+				count += len(strings.Fields(part.ToolResult.Content))
+			}
+		}
+	}
+	return count
+}
@@ -0,0 +1,186 @@
+// Package llm is how the app talks to large language models: a small interface for
+// completions, structured JSON output, streaming and tool calls, with an Anthropic implementation, a
+// wrapper that meters usage, and a scripted fake so anything that uses a model can be tested offline.
+package llm
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+)
+
+// Model identifies the model a request is sent to
+type Model string
+
+const (
+	// ModelStandard drafts negotiation messages and reads documents
+	ModelStandard Model = "claude-sonnet-4-5-20250929"
+	// ModelFast handles small classification tasks
+	ModelFast Model = "claude-haiku-4-5"
+)
+
+// Role is the author of a message in a conversation
+type Role string
+
+const (
+	RoleUser      Role = "user"
+	RoleAssistant Role = "assistant"
+)
+
+// StopReasonToolUse is the stop reason of a response that ends by calling tools
+const StopReasonToolUse = "tool_use"
+
+// Part is a piece of message content: text, a document or image when Data is set, a tool call
+// in an assistant message, or a tool result in a user message
+type Part struct {
+	Text       string
+	Data       []byte // Raw document or image bytes
+	MediaType  string // Media type of Data, e.g. application/pdf or image/png
+	ToolCall   *ToolCall
+	ToolResult *ToolResult
+}
+
+// Tool is a function the model may call. The caller runs it and sends back the result.
+type Tool struct {
+	Name        string
+	Description string
+	Properties  map[string]interface{} // JSON Schema properties of the tool's input object
+	Required    []string
+}
+
+// ToolCall is the model asking for a tool to be run
+type ToolCall struct {
+	ID    string
+	Name  string
+	Input json.RawMessage // JSON object matching the tool's schema
+}
+
+// ToolResult is the output of a tool call
+type ToolResult struct {
+	ToolCallID string
+	Content    string
+	IsError    bool
+}
+
+// Message is one turn of a conversation
+type Message struct {
+	Role  Role
+	Parts []Part
+}
+
+// Text creates a text part
+func Text(text string) Part {
+	return Part{Text: text}
+}
+
+// Document creates a document or image part
+func Document(data []byte, mediaType string) Part {
+	return Part{Data: data, MediaType: mediaType}
+}
+
+// UserMessage creates a user message from parts
+func UserMessage(parts ...Part) Message {
+	return Message{Role: RoleUser, Parts: parts}
+}
+
+// AssistantMessage creates an assistant message with text
+func AssistantMessage(text string) Message {
+	return Message{Role: RoleAssistant, Parts: []Part{Text(text)}}
+}
+
+// ToolCallMessage creates the assistant message for a response that called tools, so the
+// conversation can continue with their results
+func ToolCallMessage(response *Response) Message {
+	var parts []Part
+	if response.Text != "" {
+		parts = append(parts, Text(response.Text))
+	}
+	for i := range response.ToolCalls {
+		parts = append(parts, Part{ToolCall: &response.ToolCalls[i]})
+	}
+	return Message{Role: RoleAssistant, Parts: parts}
+}
+
+// Result creates a tool result part
+func Result(toolCallID, content string, isError bool) Part {
+	return Part{ToolResult: &ToolResult{ToolCallID: toolCallID, Content: content, IsError: isError}}
+}
+
+// Request is a completion request
+type Request struct {
+	Model     Model // ModelStandard when empty
+	System    string
+	Messages  []Message
+	MaxTokens int    // 1024 when zero
+	Tools     []Tool // Tools the model may call
+	Purpose   string // What the request is for, recorded with its usage
+	UserID    string // The user the request is for, if any: recorded with its usage and sent to the provider as an opaque ID
+}
+
+// Usage counts the tokens a request used
+type Usage struct {
+	InputTokens  int
+	OutputTokens int
+}
+
+// Response is a completed response
+type Response struct {
+	Text       string
+	Model      Model
+	StopReason string // StopReasonToolUse when ToolCalls are set
+	Usage      Usage
+	ToolCalls  []ToolCall
+}
+
+// LLM generates text from a conversation. Implementations must be safe for concurrent use.
+type LLM interface {
+	// Complete returns the model's response to the request
+	Complete(ctx context.Context, req Request) (*Response, error)
+	// CompleteJSON asks for a response containing a JSON object or array and decodes it into out
+	CompleteJSON(ctx context.Context, req Request, out interface{}) (*Response, error)
+	// Stream returns the same response as Complete, calling onDelta with each piece of text
+	// as it is generated. Cancelling ctx cancels the request. A stream cut short returns its
+	// error with a partial response, when the model had started, so its usage is known.
+	Stream(ctx context.Context, req Request, onDelta func(text string)) (*Response, error)
+}
+
+// ErrNoJSON is returned when a response that should contain JSON doesn't
+var ErrNoJSON = errors.New("no JSON found in model response")
+
+// DecodeJSON decodes the JSON object or array in a model response into out. Models sometimes
+// wrap JSON in a code fence or add a sentence around it, so the outermost braces or brackets
+// are used.
+func DecodeJSON(text string, out interface{}) error {
+	text = strings.TrimSpace(text)
+
+	start := strings.IndexAny(text, "{[")
+	if start == -1 {
+		return ErrNoJSON
+	}
+	closing := "}"
+	if text[start] == '[' {
+		closing = "]"
+	}
+	end := strings.LastIndex(text, closing)
+	if end <= start {
+		return ErrNoJSON
+	}
+
+	if err := json.Unmarshal([]byte(text[start:end+1]), out); err != nil {
+		return fmt.Errorf("failed to parse JSON in model response: %w", err)
+	}
+	return nil
+}
+
+// withDefaults fills in a request's default model and token limit
+func withDefaults(req Request) Request {
+	if req.Model == "" {
+		req.Model = ModelStandard
+	}
+	if req.MaxTokens == 0 {
+		req.MaxTokens = 1024
+	}
+	return req
+}
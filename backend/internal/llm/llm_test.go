@@ -0,0 +1,277 @@
+package llm
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestDecodeJSON(t *testing.T) {
+	type result struct {
+		Category string `json:"category"`
+	}
+
+	tests := []struct {
+		name    string
+		text    string
+		want    string
+		wantErr bool
+	}{
+		{name: "plain object", text: `{"category": "human"}`, want: "human"},
+		{name: "code fence", text: "```json\n{\"category\": \"spam\"}\n```", want: "spam"},
+		{name: "surrounding prose", text: `Sure! {"category": "marketing"} Hope that helps.`, want: "marketing"},
+		{name: "no JSON", text: "I can't tell.", wantErr: true},
+		{name: "malformed", text: `{"category": }`, wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var got result
+			err := DecodeJSON(tt.text, &got)
+			if tt.wantErr {
+				if err == nil {
+					t.Errorf("DecodeJSON() = %+v, want error", got)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("DecodeJSON() error = %v", err)
+			}
+			if got.Category != tt.want {
+				t.Errorf("DecodeJSON() = %q, want %q", got.Category, tt.want)
+			}
+		})
+	}
+
+	var list []int
+	if err := DecodeJSON("Here you go: [1, 2, 3]", &list); err != nil || len(list) != 3 {
+		t.Errorf("DecodeJSON() array = %v, %v", list, err)
+	}
+}
+
+func TestFake(t *testing.T) {
+	ctx := context.Background()
+	fake := NewFake("Could you do $38,500 out the door?", `{"category": "human"}`).
+		Add(FakeResponse{Err: errors.New("overloaded")})
+
+	var deltas []string
+	response, err := fake.Stream(ctx, Request{
+		System:   "You negotiate.",
+		Messages: []Message{UserMessage(Text("Ask for a lower price"))},
+	}, func(text string) { deltas = append(deltas, text) })
+	if err != nil {
+		t.Fatalf("Stream() error = %v", err)
+	}
+	if strings.Join(deltas, "") != response.Text || len(deltas) < 2 {
+		t.Errorf("Stream() deltas = %q, want the response in pieces", deltas)
+	}
+	if response.Model != ModelStandard || response.Usage.InputTokens == 0 || response.Usage.OutputTokens == 0 {
+		t.Errorf("Stream() = %+v, want default model and usage", response)
+	}
+
+	var decoded struct {
+		Category string `json:"category"`
+	}
+	if _, err := fake.CompleteJSON(ctx, Request{Model: ModelFast}, &decoded); err != nil || decoded.Category != "human" {
+		t.Errorf("CompleteJSON() = %+v, %v", decoded, err)
+	}
+
+	if _, err := fake.Complete(ctx, Request{}); err == nil || err.Error() != "overloaded" {
+		t.Errorf("Complete() error = %v, want scripted error", err)
+	}
+	if _, err := fake.Complete(ctx, Request{}); !errors.Is(err, ErrScriptExhausted) {
+		t.Errorf("Complete() error = %v, want ErrScriptExhausted", err)
+	}
+
+	requests := fake.Requests()
+	if len(requests) != 4 || requests[0].MaxTokens != 1024 || requests[1].Model != ModelFast {
+		t.Errorf("Requests() = %+v", requests)
+	}
+}
+
+func TestFakeToolCalls(t *testing.T) {
+	fake := NewFake().Add(FakeResponse{
+		Text:      "Let me check.",
+		ToolCalls: []ToolCall{{ID: "call_1", Name: "list_competing_offers", Input: json.RawMessage(`{}`)}},
+	})
+
+	response, err := fake.Complete(context.Background(), Request{})
+	if err != nil {
+		t.Fatalf("Complete() error = %v", err)
+	}
+	if response.StopReason != StopReasonToolUse || len(response.ToolCalls) != 1 {
+		t.Errorf("Complete() = %+v, want a tool call", response)
+	}
+
+	message := ToolCallMessage(response)
+	if message.Role != RoleAssistant || len(message.Parts) != 2 || message.Parts[1].ToolCall.ID != "call_1" {
+		t.Errorf("ToolCallMessage() = %+v", message)
+	}
+}
+
+func TestAnthropicParamsTools(t *testing.T) {
+	params, err := anthropicParams(Request{
+		Messages: []Message{
+			UserMessage(Text("What are my other offers?")),
+			{Role: RoleAssistant, Parts: []Part{{ToolCall: &ToolCall{ID: "call_1", Name: "list_competing_offers", Input: json.RawMessage(`{}`)}}}},
+			UserMessage(Result("call_1", `{"offers": []}`, false)),
+		},
+		Tools: []Tool{{
+			Name:        "list_competing_offers",
+			Description: "List offers",
+			Properties:  map[string]interface{}{"includeThisThread": map[string]interface{}{"type": "boolean"}},
+		}},
+	})
+	if err != nil {
+		t.Fatalf("anthropicParams() error = %v", err)
+	}
+
+	encoded, err := json.Marshal(params)
+	if err != nil {
+		t.Fatalf("Marshal() error = %v", err)
+	}
+	for _, want := range []string{`"type":"tool_use"`, `"tool_use_id":"call_1"`, `"input_schema":{"properties":{"includeThisThread"`, `"name":"list_competing_offers"`} {
+		if !strings.Contains(string(encoded), want) {
+			t.Errorf("request JSON missing %s: %s", want, encoded)
+		}
+	}
+}
+
+// recordingMeter allows requests until blocked is set and records what it is given
+type recordingMeter struct {
+	blocked  error
+	recorded []Request
+	usage    []Usage
+	failed   int // Allowed requests that got no response
+}
+
+func (m *recordingMeter) Allow(ctx context.Context, req Request) error {
+	return m.blocked
+}
+
+func (m *recordingMeter) Record(ctx context.Context, req Request, response *Response, elapsed time.Duration) {
+	if response == nil {
+		m.failed++
+		return
+	}
+	m.recorded = append(m.recorded, req)
+	m.usage = append(m.usage, response.Usage)
+}
+
+func TestWithMeter(t *testing.T) {
+	fake := NewFake("Hello there", "not json", "Streaming works")
+	meter := &recordingMeter{}
+	model := WithMeter(fake, meter)
+	req := Request{Purpose: "negotiation", UserID: "user-1", Messages: []Message{UserMessage(Text("Hi"))}}
+
+	if _, err := model.Complete(context.Background(), req); err != nil {
+		t.Fatalf("Complete() error = %v", err)
+	}
+	var out map[string]string
+	if _, err := model.CompleteJSON(context.Background(), req, &out); err == nil {
+		t.Error("CompleteJSON() error = nil for a response without JSON")
+	}
+	if _, err := model.Stream(context.Background(), req, func(string) {}); err != nil {
+		t.Fatalf("Stream() error = %v", err)
+	}
+
+	// Every answered request is recorded, including the one that failed to decode
+	if len(meter.recorded) != 3 {
+		t.Fatalf("recorded %d requests, want 3", len(meter.recorded))
+	}
+	if got := meter.recorded[0]; got.Purpose != "negotiation" || got.UserID != "user-1" || got.Model != ModelStandard {
+		t.Errorf("recorded request = %+v", got)
+	}
+	if meter.usage[0].OutputTokens != 2 {
+		t.Errorf("recorded usage = %+v", meter.usage[0])
+	}
+
+	// A request that got no response is still reported, so the meter can release it
+	if _, err := model.Complete(context.Background(), req); !errors.Is(err, ErrScriptExhausted) {
+		t.Fatalf("Complete() error = %v, want ErrScriptExhausted", err)
+	}
+	if meter.failed != 1 || len(meter.recorded) != 3 {
+		t.Errorf("failed = %d, recorded = %d, want 1 and 3", meter.failed, len(meter.recorded))
+	}
+
+	// A request the meter refuses is never sent
+	meter.blocked = errors.New("over quota")
+	if _, err := model.Complete(context.Background(), req); err != meter.blocked {
+		t.Errorf("Complete() error = %v, want the meter's error", err)
+	}
+	if len(fake.Requests()) != 4 || meter.failed != 1 {
+		t.Errorf("sent %d requests (%d failed), want 4 (1 failed)", len(fake.Requests()), meter.failed)
+	}
+}
+
+func TestWithMeterRecordsCancelledStream(t *testing.T) {
+	meter := &recordingMeter{}
+	model := WithMeter(NewFake("Happy to knock another $500 off"), meter)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	_, err := model.Stream(ctx, Request{Messages: []Message{UserMessage(Text("Hi"))}}, func(string) { cancel() })
+	if !errors.Is(err, context.Canceled) {
+		t.Fatalf("Stream() error = %v, want context.Canceled", err)
+	}
+
+	// The client hung up after the first word, which still has to be paid for
+	if len(meter.recorded) != 1 {
+		t.Fatalf("recorded %d requests, want the cancelled stream", len(meter.recorded))
+	}
+	if got := meter.usage[0]; got.InputTokens == 0 || got.OutputTokens != 1 {
+		t.Errorf("recorded usage = %+v, want the input and the word sent", got)
+	}
+}
+
+func TestAnthropicParamsMetadata(t *testing.T) {
+	params, err := anthropicParams(Request{UserID: "4f0c5a4e-8a1e-4d0b-9a39-2f0f3f2f6b1c"})
+	if err != nil {
+		t.Fatalf("anthropicParams() error = %v", err)
+	}
+	if got := params.Metadata.UserID.Value; got != "4f0c5a4e-8a1e-4d0b-9a39-2f0f3f2f6b1c" {
+		t.Errorf("metadata user_id = %q", got)
+	}
+
+	params, err = anthropicParams(Request{})
+	if err != nil {
+		t.Fatalf("anthropicParams() error = %v", err)
+	}
+	if params.Metadata.UserID.Valid() {
+		t.Error("metadata user_id set without a user")
+	}
+}
+
+func TestCassette(t *testing.T) {
+	req := Request{System: "Be brief", Messages: []Message{UserMessage(Text("Hi"))}, Purpose: "negotiation", UserID: "user-1"}
+	other := Request{System: "Be brief", Messages: []Message{UserMessage(Text("Hello"))}}
+
+	cassette := NewCassette()
+	recorder := NewRecorder(NewFake("Hello there"), cassette)
+	if _, err := recorder.Complete(context.Background(), req); err != nil {
+		t.Fatalf("Complete error: %v", err)
+	}
+
+	path := t.TempDir() + "/cassette.json"
+	if err := cassette.Save(path); err != nil {
+		t.Fatalf("Save error: %v", err)
+	}
+	loaded, err := LoadCassette(path)
+	if err != nil {
+		t.Fatalf("LoadCassette error: %v", err)
+	}
+
+	// Recordings replay for any user, but only for the same request
+	replayer := NewReplayer(loaded)
+	req.UserID = "user-2"
+	response, err := replayer.Complete(context.Background(), req)
+	if err != nil || response.Text != "Hello there" {
+		t.Fatalf("replayed %v, %v; want the recorded response", response, err)
+	}
+	if _, err := replayer.Complete(context.Background(), other); !errors.Is(err, ErrNotRecorded) {
+		t.Errorf("unrecorded request error = %v, want ErrNotRecorded", err)
+	}
+}
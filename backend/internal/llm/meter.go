@@ -0,0 +1,59 @@
+package llm
+
+import (
+	"context"
+	"time"
+)
+
+// Meter checks and records the requests sent through a metered LLM
+type Meter interface {
+	// Allow returns an error if a request mustn't be sent, such as when its user is over quota
+	Allow(ctx context.Context, req Request) error
+	// Record is called once for each request Allow let through, with the response the model
+	// returned, including JSON responses that failed to decode and the partial responses of
+	// cancelled streams. response is nil when the model returned nothing.
+	Record(ctx context.Context, req Request, response *Response, elapsed time.Duration)
+}
+
+// metered is an LLM whose requests are checked and recorded by a Meter
+type metered struct {
+	llm   LLM
+	meter Meter
+}
+
+// WithMeter wraps an LLM so every request is checked by meter before it is sent and its usage
+// recorded after
+func WithMeter(llm LLM, meter Meter) LLM {
+	return &metered{llm: llm, meter: meter}
+}
+
+func (m *metered) Complete(ctx context.Context, req Request) (*Response, error) {
+	return m.send(ctx, req, func() (*Response, error) {
+		return m.llm.Complete(ctx, req)
+	})
+}
+
+func (m *metered) CompleteJSON(ctx context.Context, req Request, out interface{}) (*Response, error) {
+	return m.send(ctx, req, func() (*Response, error) {
+		return m.llm.CompleteJSON(ctx, req, out)
+	})
+}
+
+func (m *metered) Stream(ctx context.Context, req Request, onDelta func(text string)) (*Response, error) {
+	return m.send(ctx, req, func() (*Response, error) {
+		return m.llm.Stream(ctx, req, onDelta)
+	})
+}
+
+// send checks a request, sends it with do and records the response
+func (m *metered) send(ctx context.Context, req Request, do func() (*Response, error)) (*Response, error) {
+	req = withDefaults(req)
+	if err := m.meter.Allow(ctx, req); err != nil {
+		return nil, err
+	}
+
+	start := time.Now()
+	response, err := do()
+	m.meter.Record(ctx, req, response, time.Since(start))
+	return response, err
+}
@@ -0,0 +1,523 @@
+package services
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"math"
+	"strings"
+	"time"
+
+	"carbuyer/internal/db/models"
+	"carbuyer/internal/llm"
+
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+)
+
+// maxToolRounds bounds how many rounds of tool calls the agent can make before it must answer
+const maxToolRounds = 5
+
+// maxToolOutputChars keeps one tool result from flooding the context
+const maxToolOutputChars = 8000
+
+// negotiationTools are the server-side tools the negotiation agent can call
+var negotiationTools = []llm.Tool{
+	{
+		Name:        "estimate_dealer_cost",
+		Description: "Estimate what the dealer paid for the buyer's vehicle: invoice price, holdback and net-net price (invoice minus holdback), from typical brand margins. Uses the MSRP given, else the base MSRP of the trim named or the buyer's chosen trim.",
+		Properties: map[string]interface{}{
+			"msrp": map[string]interface{}{"type": "number", "description": "MSRP of the vehicle, e.g. from the window sticker"},
+			"trim": map[string]interface{}{"type": "string", "description": "Trim name, e.g. XLT"},
+		},
+	},
+	{
+		Name:        "get_trim_specs",
+		Description: "Look up specs and base MSRP of trims of the buyer's model: engine, power, drivetrain, fuel economy, dimensions. Returns up to 5 matching trims.",
+		Properties: map[string]interface{}{
+			"trim": map[string]interface{}{"type": "string", "description": "Part of the trim name; all trims when empty"},
+			"year": map[string]interface{}{"type": "integer", "description": "Model year; the buyer's year when empty"},
+		},
+	},
+	{
+		Name:        "list_competing_offers",
+		Description: "List the standing offers the buyer has from other sellers (active or countered, confirmed by the buyer), newest first.",
+		Properties: map[string]interface{}{
+			"includeThisThread": map[string]interface{}{"type": "boolean", "description": "Also include offers from the seller in this thread"},
+		},
+	},
+	{
+		Name:        "get_dealer_details",
+		Description: "Get a dealer's location, contact details and distance from the buyer. Defaults to the seller in this thread.",
+		Properties: map[string]interface{}{
+			"name": map[string]interface{}{"type": "string", "description": "Part of the dealer's name"},
+		},
+	},
+	{
+		Name:        "search_thread_history",
+		Description: "Search every message in this thread, including ones older than the recent messages you can see, for a word or phrase. Returns the newest matches first.",
+		Properties: map[string]interface{}{
+			"query": map[string]interface{}{"type": "string", "description": "Word or phrase to find, e.g. \"doc fee\""},
+			"limit": map[string]interface{}{"type": "integer", "description": "Most matches to return, up to 10 (default 5)"},
+		},
+		Required: []string{"query"},
+	},
+}
+
+// toolRunner runs the tools a model calls, returning each result for the model
+type toolRunner interface {
+	call(ctx context.Context, round int, call llm.ToolCall) llm.Part
+}
+
+// negotiationToolbox runs the negotiation agent's tools for one thread
+type negotiationToolbox struct {
+	db       *gorm.DB
+	pricing  *PricingService
+	userID   uuid.UUID
+	threadID uuid.UUID
+}
+
+func newNegotiationToolbox(db *gorm.DB, userID, threadID uuid.UUID) *negotiationToolbox {
+	return &negotiationToolbox{
+		db:       db,
+		pricing:  NewPricingService(),
+		userID:   userID,
+		threadID: threadID,
+	}
+}
+
+// completeWithTools sends a request, running the tools the model calls and sending back their
+// results until it answers, for at most maxToolRounds rounds of calls. onDelta streams each
+// round's text when set. The response's usage covers every round.
+func completeWithTools(ctx context.Context, model llm.LLM, req llm.Request, tools toolRunner, onDelta func(text string)) (*llm.Response, error) {
+	req.Messages = append([]llm.Message(nil), req.Messages...)
+
+	var usage llm.Usage
+	for round := 1; ; round++ {
+		var response *llm.Response
+		var err error
+		if onDelta != nil {
+			response, err = model.Stream(ctx, req, onDelta)
+		} else {
+			response, err = model.Complete(ctx, req)
+		}
+		if err != nil {
+			return nil, err
+		}
+		usage.InputTokens += response.Usage.InputTokens
+		usage.OutputTokens += response.Usage.OutputTokens
+
+		if len(response.ToolCalls) == 0 {
+			response.Usage = usage
+			return response, nil
+		}
+		if round > maxToolRounds {
+			return nil, errors.New("agent kept calling tools without answering")
+		}
+
+		results := make([]llm.Part, 0, len(response.ToolCalls)+1)
+		for _, call := range response.ToolCalls {
+			results = append(results, tools.call(ctx, round, call))
+		}
+		if round == maxToolRounds {
+			results = append(results, llm.Text("That was your last tool call. Respond now without calling tools."))
+		}
+		req.Messages = append(req.Messages, llm.ToolCallMessage(response), llm.UserMessage(results...))
+	}
+}
+
+// call runs a tool call and logs it, returning its result for the model
+func (t *negotiationToolbox) call(ctx context.Context, round int, call llm.ToolCall) llm.Part {
+	return runLoggedTool(ctx, t.db, t.userID, t.threadID, round, call, t.run)
+}
+
+// runLoggedTool runs a tool call with run and logs it to the thread's tool call log, returning
+// its result, capped in length, for the model
+func runLoggedTool(ctx context.Context, db *gorm.DB, userID, threadID uuid.UUID, round int, call llm.ToolCall, run func(context.Context, llm.ToolCall) (string, error)) llm.Part {
+	started := time.Now()
+	output, err := run(ctx, call)
+	isError := err != nil
+	if isError {
+		output = err.Error()
+	}
+	output = truncateText(output, maxToolOutputChars)
+
+	log.Printf("Agent tool %s on thread %s (round %d, %s): error=%v", call.Name, threadID, round, time.Since(started).Round(time.Millisecond), isError)
+
+	entry := &models.AgentToolCall{
+		UserID:     userID,
+		ThreadID:   threadID,
+		Tool:       call.Name,
+		Output:     output,
+		IsError:    isError,
+		Round:      round,
+		DurationMs: time.Since(started).Milliseconds(),
+	}
+	if json.Valid(call.Input) {
+		input := string(call.Input)
+		entry.Input = &input
+	}
+	if err := db.Create(entry).Error; err != nil {
+		log.Printf("Failed to log agent tool call %s: %v", call.Name, err)
+	}
+
+	return llm.Result(call.ID, output, isError)
+}
+
+// run executes a tool call, returning its output as JSON
+func (t *negotiationToolbox) run(ctx context.Context, call llm.ToolCall) (string, error) {
+	if err := ctx.Err(); err != nil {
+		return "", err
+	}
+
+	var result interface{}
+	var err error
+	switch call.Name {
+	case "estimate_dealer_cost":
+		result, err = t.estimateDealerCost(call.Input)
+	case "get_trim_specs":
+		result, err = t.getTrimSpecs(call.Input)
+	case "list_competing_offers":
+		result, err = t.listCompetingOffers(call.Input)
+	case "get_dealer_details":
+		result, err = t.getDealerDetails(call.Input)
+	case "search_thread_history":
+		result, err = t.searchThreadHistory(call.Input)
+	default:
+		return "", fmt.Errorf("unknown tool %q", call.Name)
+	}
+	if err != nil {
+		return "", err
+	}
+
+	output, err := json.Marshal(result)
+	if err != nil {
+		return "", fmt.Errorf("failed to encode tool output: %w", err)
+	}
+	return string(output), nil
+}
+
+// cannedToolbox answers tool calls with fixed outputs instead of the database, for generating
+// responses outside a thread. Tools without an output report that they're unavailable.
+type cannedToolbox map[string]string
+
+func (t cannedToolbox) call(ctx context.Context, round int, call llm.ToolCall) llm.Part {
+	output, ok := t[call.Name]
+	if !ok {
+		return llm.Result(call.ID, fmt.Sprintf("%s isn't available right now", call.Name), true)
+	}
+	return llm.Result(call.ID, output, false)
+}
+
+// decodeToolInput decodes a tool call's input. Models send {} or nothing for tools without
+// required input.
+func decodeToolInput(input json.RawMessage, out interface{}) error {
+	if len(input) == 0 {
+		return nil
+	}
+	if err := json.Unmarshal(input, out); err != nil {
+		return fmt.Errorf("invalid tool input: %w", err)
+	}
+	return nil
+}
+
+// preferences loads the buyer's vehicle preferences
+func (t *negotiationToolbox) preferences() (*models.UserPreferences, error) {
+	var prefs models.UserPreferences
+	if err := t.db.Where("user_id = ?", t.userID).Preload("Make").Preload("Model").Preload("Trim").First(&prefs).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, errors.New("the buyer hasn't set their vehicle preferences")
+		}
+		return nil, fmt.Errorf("database error: %w", err)
+	}
+	return &prefs, nil
+}
+
+// findTrims returns up to limit trims of the buyer's model whose name contains name
+func (t *negotiationToolbox) findTrims(prefs *models.UserPreferences, name string, year, limit int) ([]models.VehicleTrim, error) {
+	if year == 0 {
+		year = prefs.Year
+	}
+
+	query := t.db.Where("model_id = ? AND year = ?", prefs.ModelID, year)
+	if name = strings.TrimSpace(name); name != "" {
+		query = query.Where("trim_name ILIKE ?", likePattern(name))
+	}
+
+	var trims []models.VehicleTrim
+	if err := query.Order("base_msrp ASC").Limit(limit).Find(&trims).Error; err != nil {
+		return nil, fmt.Errorf("database error: %w", err)
+	}
+	return trims, nil
+}
+
+func (t *negotiationToolbox) estimateDealerCost(raw json.RawMessage) (interface{}, error) {
+	var input struct {
+		MSRP *float64 `json:"msrp"`
+		Trim string   `json:"trim"`
+	}
+	if err := decodeToolInput(raw, &input); err != nil {
+		return nil, err
+	}
+
+	prefs, err := t.preferences()
+	if err != nil {
+		return nil, err
+	}
+
+	trim := prefs.Trim
+	if input.Trim != "" {
+		trims, err := t.findTrims(prefs, input.Trim, 0, 1)
+		if err != nil {
+			return nil, err
+		}
+		if len(trims) == 0 {
+			return nil, fmt.Errorf("no %q trim found", input.Trim)
+		}
+		trim = &trims[0]
+	}
+
+	msrp := 0.0
+	if input.MSRP != nil {
+		msrp = *input.MSRP
+	} else if trim != nil && trim.BaseMSRP.Valid {
+		msrp = trim.BaseMSRP.Float64
+	}
+	if msrp <= 0 {
+		return nil, errors.New("no MSRP known: pass the msrp")
+	}
+
+	makeName := ""
+	if prefs.Make != nil {
+		makeName = prefs.Make.Name
+	}
+	bodyType := ""
+	trimName := ""
+	if trim != nil {
+		bodyType = trim.BodyType.String
+		trimName = trim.TrimName
+	}
+
+	return map[string]interface{}{
+		"make":             makeName,
+		"trim":             trimName,
+		"msrp":             math.Round(msrp),
+		"invoiceEstimate":  math.Round(t.pricing.EstimateInvoicePrice(msrp, makeName, bodyType)),
+		"holdbackEstimate": math.Round(t.pricing.EstimateDealerHoldback(msrp, makeName)),
+		"netNetEstimate":   math.Round(t.pricing.CalculateNetNetPrice(msrp, makeName, bodyType)),
+		"note":             "Estimates from typical brand margins. Factory incentives can lower the dealer's real cost.",
+	}, nil
+}
+
+func (t *negotiationToolbox) getTrimSpecs(raw json.RawMessage) (interface{}, error) {
+	var input struct {
+		Trim string `json:"trim"`
+		Year int    `json:"year"`
+	}
+	if err := decodeToolInput(raw, &input); err != nil {
+		return nil, err
+	}
+
+	prefs, err := t.preferences()
+	if err != nil {
+		return nil, err
+	}
+	trims, err := t.findTrims(prefs, input.Trim, input.Year, 5)
+	if err != nil {
+		return nil, err
+	}
+
+	specs := make([]map[string]interface{}, 0, len(trims))
+	for i := range trims {
+		specs = append(specs, trimSpecs(&trims[i]))
+	}
+	return map[string]interface{}{"trims": specs}, nil
+}
+
+// trimSpecs lists a trim's known specs
+func trimSpecs(trim *models.VehicleTrim) map[string]interface{} {
+	specs := map[string]interface{}{
+		"year": trim.Year,
+		"trim": trim.TrimName,
+	}
+	addString := func(key string, v sql.NullString) {
+		if v.Valid && v.String != "" {
+			specs[key] = v.String
+		}
+	}
+	addFloat := func(key string, v sql.NullFloat64) {
+		if v.Valid {
+			specs[key] = v.Float64
+		}
+	}
+	addInt := func(key string, v sql.NullInt32) {
+		if v.Valid {
+			specs[key] = v.Int32
+		}
+	}
+
+	addString("description", trim.TrimDescription)
+	addFloat("baseMsrp", trim.BaseMSRP)
+	addString("bodyType", trim.BodyType)
+	addString("engineType", trim.EngineType)
+	addFloat("engineSizeL", trim.EngineSizeL)
+	addString("cylinders", trim.Cylinders)
+	addInt("horsepowerHp", trim.HorsepowerHP)
+	addInt("torqueFtLbs", trim.TorqueFtLbs)
+	addString("driveType", trim.DriveType)
+	addString("transmission", trim.Transmission)
+	addString("fuelType", trim.FuelType)
+	addInt("epaCombinedMpg", trim.EPACombinedMPG)
+	addString("epaCityHighwayMpg", trim.EPACityHighwayMPG)
+	addString("rangeMiles", trim.RangeMiles)
+	addFloat("lengthIn", trim.LengthIn)
+	addFloat("wheelbaseIn", trim.WheelbaseIn)
+	addInt("curbWeightLbs", trim.CurbWeightLbs)
+	addString("countryOfOrigin", trim.CountryOfOrigin)
+	return specs
+}
+
+func (t *negotiationToolbox) listCompetingOffers(raw json.RawMessage) (interface{}, error) {
+	var input struct {
+		IncludeThisThread bool `json:"includeThisThread"`
+	}
+	if err := decodeToolInput(raw, &input); err != nil {
+		return nil, err
+	}
+
+	if err := ExpireOffers(t.db, t.userID); err != nil {
+		log.Printf("Failed to expire offers: %v", err)
+	}
+
+	query := t.db.Joins("JOIN threads ON threads.id = tracked_offers.thread_id").
+		Where("threads.user_id = ? AND tracked_offers.review_status = ?", t.userID, models.OfferReviewConfirmed).
+		Where("tracked_offers.status IN ?", []models.OfferStatus{models.OfferStatusActive, models.OfferStatusCountered})
+	if !input.IncludeThisThread {
+		query = query.Where("tracked_offers.thread_id <> ?", t.threadID)
+	}
+
+	var offers []models.TrackedOffer
+	if err := query.Order("tracked_offers.tracked_at DESC").Limit(20).Preload("Thread").Find(&offers).Error; err != nil {
+		return nil, fmt.Errorf("database error: %w", err)
+	}
+
+	results := make([]map[string]interface{}, 0, len(offers))
+	for _, offer := range offers {
+		result := map[string]interface{}{
+			"offer":     offer.OfferText,
+			"status":    offer.Status,
+			"trackedAt": offer.TrackedAt.Format("2006-01-02"),
+		}
+		if offer.Thread != nil {
+			result["seller"] = offer.Thread.SellerName
+		}
+		if offer.ThreadID == t.threadID {
+			result["thisThread"] = true
+		}
+		if offer.OutTheDoor != nil {
+			result["outTheDoor"] = *offer.OutTheDoor
+		}
+		if offer.ExpiresAt != nil {
+			result["expiresAt"] = offer.ExpiresAt.UTC().Format("2006-01-02")
+		}
+		results = append(results, result)
+	}
+	return map[string]interface{}{"offers": results}, nil
+}
+
+func (t *negotiationToolbox) getDealerDetails(raw json.RawMessage) (interface{}, error) {
+	var input struct {
+		Name string `json:"name"`
+	}
+	if err := decodeToolInput(raw, &input); err != nil {
+		return nil, err
+	}
+
+	name := strings.TrimSpace(input.Name)
+	if name == "" {
+		var thread models.Thread
+		if err := t.db.Where("id = ? AND user_id = ?", t.threadID, t.userID).First(&thread).Error; err != nil {
+			return nil, errors.New("thread not found")
+		}
+		name = thread.SellerName
+	}
+
+	var dealers []models.Dealer
+	if err := t.db.Joins("JOIN user_preferences ON user_preferences.id = dealers.user_preference_id").
+		Where("user_preferences.user_id = ? AND dealers.name ILIKE ?", t.userID, likePattern(name)).
+		Order("dealers.distance ASC").
+		Limit(3).
+		Find(&dealers).Error; err != nil {
+		return nil, fmt.Errorf("database error: %w", err)
+	}
+
+	results := make([]map[string]interface{}, 0, len(dealers))
+	for _, dealer := range dealers {
+		result := map[string]interface{}{
+			"name":          dealer.Name,
+			"location":      dealer.Location,
+			"distanceMiles": dealer.Distance,
+			"contacted":     dealer.Contacted,
+		}
+		if dealer.Email != nil && dealer.EmailStatus == models.DealerEmailStatusValid {
+			result["email"] = *dealer.Email
+		}
+		if dealer.Phone != nil {
+			result["phone"] = *dealer.Phone
+		}
+		if dealer.Website != nil {
+			result["website"] = *dealer.Website
+		}
+		results = append(results, result)
+	}
+	return map[string]interface{}{"dealers": results}, nil
+}
+
+func (t *negotiationToolbox) searchThreadHistory(raw json.RawMessage) (interface{}, error) {
+	var input struct {
+		Query string `json:"query"`
+		Limit int    `json:"limit"`
+	}
+	if err := decodeToolInput(raw, &input); err != nil {
+		return nil, err
+	}
+	input.Query = strings.TrimSpace(input.Query)
+	if input.Query == "" {
+		return nil, errors.New("query is required")
+	}
+	if input.Limit <= 0 || input.Limit > 10 {
+		input.Limit = 5
+	}
+
+	var messages []models.Message
+	if err := t.db.Where("thread_id = ? AND user_id = ? AND deleted_at IS NULL AND content ILIKE ?", t.threadID, t.userID, likePattern(input.Query)).
+		Order("timestamp DESC").
+		Limit(input.Limit).
+		Find(&messages).Error; err != nil {
+		return nil, fmt.Errorf("database error: %w", err)
+	}
+
+	results := make([]map[string]interface{}, 0, len(messages))
+	for _, message := range messages {
+		content := truncateText(message.Content, 1500)
+		results = append(results, map[string]interface{}{
+			"sender":    message.Sender,
+			"timestamp": message.Timestamp.UTC().Format("2006-01-02T15:04:05Z"),
+			"content":   content,
+		})
+	}
+	return map[string]interface{}{"messages": results}, nil
+}
+
+// likePattern matches text containing s, escaping LIKE wildcards in it
+func likePattern(s string) string {
+	return "%" + escapeLike(s) + "%"
+}
+
+// escapeLike escapes LIKE wildcards in s so it only matches itself
+func escapeLike(s string) string {
+	return strings.NewReplacer(`\`, `\\`, "%", `\%`, "_", `\_`).Replace(s)
+}
@@ -0,0 +1,130 @@
+package services
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"strings"
+	"testing"
+
+	"carbuyer/internal/db/models"
+	"carbuyer/internal/llm"
+)
+
+// stubTools answers every tool call with the tool's name
+type stubTools struct {
+	calls []string
+}
+
+func (s *stubTools) call(ctx context.Context, round int, call llm.ToolCall) llm.Part {
+	s.calls = append(s.calls, call.Name)
+	return llm.Result(call.ID, `{"tool": "`+call.Name+`"}`, false)
+}
+
+func toolCall(id, name string) llm.ToolCall {
+	return llm.ToolCall{ID: id, Name: name, Input: json.RawMessage(`{}`)}
+}
+
+func TestCompleteWithTools(t *testing.T) {
+	fake := llm.NewFake().Add(
+		llm.FakeResponse{ToolCalls: []llm.ToolCall{toolCall("1", "list_competing_offers"), toolCall("2", "estimate_dealer_cost")}},
+		llm.FakeResponse{ToolCalls: []llm.ToolCall{toolCall("3", "search_thread_history")}},
+		llm.FakeResponse{Text: "Could you do $36,500 out the door?"},
+	)
+	tools := &stubTools{}
+
+	response, err := completeWithTools(context.Background(), fake, llm.Request{
+		Messages: []llm.Message{llm.UserMessage(llm.Text("Draft a counteroffer"))},
+		Tools:    negotiationTools,
+	}, tools, nil)
+	if err != nil {
+		t.Fatalf("completeWithTools() error = %v", err)
+	}
+	if response.Text != "Could you do $36,500 out the door?" {
+		t.Errorf("Text = %q", response.Text)
+	}
+	if got := strings.Join(tools.calls, ","); got != "list_competing_offers,estimate_dealer_cost,search_thread_history" {
+		t.Errorf("tool calls = %s", got)
+	}
+
+	requests := fake.Requests()
+	if len(requests) != 3 {
+		t.Fatalf("sent %d requests, want 3", len(requests))
+	}
+	// The last request carries both rounds of calls and results
+	last := requests[2].Messages
+	if len(last) != 5 || last[1].Role != llm.RoleAssistant || len(last[1].Parts) != 2 || last[2].Parts[1].ToolResult.ToolCallID != "2" {
+		t.Errorf("last request messages = %+v", last)
+	}
+}
+
+func TestCompleteWithToolsIsBounded(t *testing.T) {
+	fake := llm.NewFake()
+	for i := 0; i <= maxToolRounds; i++ {
+		fake.Add(llm.FakeResponse{ToolCalls: []llm.ToolCall{toolCall("x", "search_thread_history")}})
+	}
+	tools := &stubTools{}
+
+	_, err := completeWithTools(context.Background(), fake, llm.Request{
+		Messages: []llm.Message{llm.UserMessage(llm.Text("Draft a counteroffer"))},
+	}, tools, nil)
+	if err == nil {
+		t.Fatal("completeWithTools() error = nil, want an error once the rounds run out")
+	}
+	if len(tools.calls) != maxToolRounds {
+		t.Errorf("ran %d tool calls, want %d", len(tools.calls), maxToolRounds)
+	}
+
+	// The model is told when it has used its last round
+	requests := fake.Requests()
+	final := requests[len(requests)-1].Messages
+	parts := final[len(final)-1].Parts
+	if !strings.Contains(parts[len(parts)-1].Text, "last tool call") {
+		t.Errorf("final request doesn't say the tools are used up: %+v", parts)
+	}
+}
+
+func TestCompleteWithToolsStreams(t *testing.T) {
+	fake := llm.NewFake().Add(
+		llm.FakeResponse{ToolCalls: []llm.ToolCall{toolCall("1", "get_trim_specs")}},
+		llm.FakeResponse{Text: "The XLT has the 2.3L engine."},
+	)
+
+	var streamed strings.Builder
+	response, err := completeWithTools(context.Background(), fake, llm.Request{}, &stubTools{}, func(text string) {
+		streamed.WriteString(text)
+	})
+	if err != nil {
+		t.Fatalf("completeWithTools() error = %v", err)
+	}
+	if streamed.String() != response.Text {
+		t.Errorf("streamed %q, want %q", streamed.String(), response.Text)
+	}
+}
+
+func TestTrimSpecs(t *testing.T) {
+	trim := &models.VehicleTrim{
+		Year:         2025,
+		TrimName:     "XLT",
+		BaseMSRP:     sql.NullFloat64{Float64: 41250, Valid: true},
+		HorsepowerHP: sql.NullInt32{Int32: 300, Valid: true},
+		DriveType:    sql.NullString{String: "4WD", Valid: true},
+		FuelType:     sql.NullString{Valid: true},
+	}
+
+	specs := trimSpecs(trim)
+	if specs["baseMsrp"] != 41250.0 || specs["horsepowerHp"] != int32(300) || specs["driveType"] != "4WD" {
+		t.Errorf("trimSpecs() = %v", specs)
+	}
+	for _, missing := range []string{"fuelType", "torqueFtLbs", "description"} {
+		if _, ok := specs[missing]; ok {
+			t.Errorf("trimSpecs() includes unknown %s", missing)
+		}
+	}
+}
+
+func TestLikePattern(t *testing.T) {
+	if got := likePattern("100% off_road"); got != `%100\% off\_road%` {
+		t.Errorf("likePattern() = %q", got)
+	}
+}
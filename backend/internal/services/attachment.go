@@ -0,0 +1,300 @@
+package services
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"mime"
+	"net/http"
+	"path/filepath"
+	"strings"
+
+	"carbuyer/internal/db/models"
+	"carbuyer/internal/inbound"
+	"carbuyer/internal/storage"
+
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+)
+
+// maxAttachmentsPerMessage caps how many attachments are ingested from a single email
+const maxAttachmentsPerMessage = 20
+
+// allowedAttachmentTypes are the content types dealers realistically send: quotes,
+// buyer's orders, window stickers and photos
+var allowedAttachmentTypes = map[string]bool{
+	"application/pdf":    true,
+	"image/jpeg":         true,
+	"image/png":          true,
+	"image/gif":          true,
+	"image/webp":         true,
+	"image/heic":         true,
+	"image/heif":         true,
+	"text/plain":         true,
+	"text/csv":           true,
+	"application/msword": true,
+	"application/vnd.openxmlformats-officedocument.wordprocessingml.document": true,
+	"application/vnd.ms-excel": true,
+	"application/vnd.openxmlformats-officedocument.spreadsheetml.sheet": true,
+}
+
+// blockedAttachmentExtensions are never stored regardless of the declared content type
+var blockedAttachmentExtensions = map[string]bool{
+	".exe": true, ".bat": true, ".cmd": true, ".com": true, ".scr": true,
+	".js": true, ".vbs": true, ".jar": true, ".msi": true, ".ps1": true,
+	".sh": true, ".html": true, ".htm": true,
+}
+
+// AttachmentScanResult is the outcome of a virus scan
+type AttachmentScanResult struct {
+	Infected bool
+	Detail   string // Signature name or scanner message
+}
+
+// AttachmentScanner is a hook for virus scanning attachments before they are stored
+type AttachmentScanner interface {
+	Scan(ctx context.Context, filename string, data []byte) (AttachmentScanResult, error)
+}
+
+// AttachmentService stores and serves message attachments
+type AttachmentService struct {
+	db       *gorm.DB
+	store    storage.BlobStore
+	scanner  AttachmentScanner
+	maxBytes int64
+}
+
+// NewAttachmentService creates a new attachment service. scanner may be nil to skip virus scanning.
+func NewAttachmentService(db *gorm.DB, store storage.BlobStore, scanner AttachmentScanner, maxBytes int64) *AttachmentService {
+	return &AttachmentService{
+		db:       db,
+		store:    store,
+		scanner:  scanner,
+		maxBytes: maxBytes,
+	}
+}
+
+// MaxBytes returns the largest attachment that will be stored
+func (s *AttachmentService) MaxBytes() int64 {
+	return s.maxBytes
+}
+
+// SaveAttachments validates, scans and stores attachments for a message. Attachments that fail
+// validation are recorded as rejected so the user can see something was dropped.
+func (s *AttachmentService) SaveAttachments(message *models.Message, attachments []inbound.Attachment) ([]models.MessageAttachment, error) {
+	if len(attachments) == 0 {
+		return nil, nil
+	}
+
+	// Duplicate webhook deliveries return the existing message - don't store files twice
+	var existing int64
+	if err := s.db.Model(&models.MessageAttachment{}).Where("message_id = ?", message.ID).Count(&existing).Error; err != nil {
+		return nil, fmt.Errorf("failed to check existing attachments: %w", err)
+	}
+	if existing > 0 {
+		return nil, nil
+	}
+
+	if len(attachments) > maxAttachmentsPerMessage {
+		log.Printf("Message %s has %d attachments, only storing the first %d", message.ID, len(attachments), maxAttachmentsPerMessage)
+		attachments = attachments[:maxAttachmentsPerMessage]
+	}
+
+	saved := make([]models.MessageAttachment, 0, len(attachments))
+	for _, attachment := range attachments {
+		record, err := s.saveAttachment(message, attachment)
+		if err != nil {
+			return saved, err
+		}
+		saved = append(saved, *record)
+	}
+
+	return saved, nil
+}
+
+func (s *AttachmentService) saveAttachment(message *models.Message, attachment inbound.Attachment) (*models.MessageAttachment, error) {
+	filename := sanitizeAttachmentFilename(attachment.Filename)
+	contentType := detectAttachmentContentType(filename, attachment.ContentType, attachment.Data)
+
+	size := attachment.Size
+	if size == 0 {
+		size = int64(len(attachment.Data))
+	}
+
+	record := &models.MessageAttachment{
+		ID:          uuid.New(),
+		MessageID:   message.ID,
+		UserID:      message.UserID,
+		Filename:    filename,
+		ContentType: contentType,
+		SizeBytes:   size,
+		Status:      models.AttachmentStatusStored,
+	}
+
+	if reason := s.rejectReason(filename, contentType, size, attachment.Data); reason != "" {
+		record.Status = models.AttachmentStatusRejected
+		record.RejectReason = reason
+	}
+
+	if record.Status != models.AttachmentStatusRejected && s.scanner != nil {
+		result, err := s.scanner.Scan(context.Background(), filename, attachment.Data)
+		if err != nil {
+			// Fail closed - an unscanned file from an unknown sender isn't worth the risk
+			record.Status = models.AttachmentStatusRejected
+			record.RejectReason = "virus scan failed"
+			log.Printf("Virus scan failed for %s on message %s: %v", filename, message.ID, err)
+		} else if result.Infected {
+			record.Status = models.AttachmentStatusRejected
+			record.RejectReason = "infected: " + result.Detail
+		} else {
+			record.Status = models.AttachmentStatusClean
+		}
+	}
+
+	if record.Status != models.AttachmentStatusRejected {
+		sum := sha256.Sum256(attachment.Data)
+		record.SHA256 = hex.EncodeToString(sum[:])
+		record.StorageKey = fmt.Sprintf("attachments/%s/%s/%s", message.UserID, message.ID, record.ID)
+
+		if err := s.store.Put(context.Background(), record.StorageKey, bytes.NewReader(attachment.Data), contentType); err != nil {
+			return nil, fmt.Errorf("failed to store attachment %s: %w", filename, err)
+		}
+	}
+
+	if err := s.db.Create(record).Error; err != nil {
+		if record.StorageKey != "" {
+			s.store.Delete(context.Background(), record.StorageKey)
+		}
+		return nil, fmt.Errorf("failed to save attachment %s: %w", filename, err)
+	}
+
+	return record, nil
+}
+
+// rejectReason returns why an attachment can't be stored, or an empty string if it can
+func (s *AttachmentService) rejectReason(filename, contentType string, size int64, data []byte) string {
+	if s.maxBytes > 0 && size > s.maxBytes {
+		return fmt.Sprintf("exceeds %d MB limit", s.maxBytes/(1024*1024))
+	}
+	if data == nil {
+		return "file could not be read"
+	}
+	if blockedAttachmentExtensions[strings.ToLower(filepath.Ext(filename))] {
+		return "file type not allowed"
+	}
+	if !allowedAttachmentTypes[contentType] {
+		return "file type not allowed"
+	}
+	return ""
+}
+
+// GetMessageAttachments lists attachments for a message owned by the user
+func (s *AttachmentService) GetMessageAttachments(messageID, userID uuid.UUID) ([]models.MessageAttachment, error) {
+	var message models.Message
+	if err := s.db.Where("id = ? AND user_id = ?", messageID, userID).First(&message).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, errors.New("message not found")
+		}
+		return nil, fmt.Errorf("database error: %w", err)
+	}
+
+	var attachments []models.MessageAttachment
+	if err := s.db.Where("message_id = ?", messageID).Order("created_at ASC").Find(&attachments).Error; err != nil {
+		return nil, fmt.Errorf("failed to retrieve attachments: %w", err)
+	}
+
+	return attachments, nil
+}
+
+// GetAttachment retrieves an attachment owned by the user
+func (s *AttachmentService) GetAttachment(attachmentID, userID uuid.UUID) (*models.MessageAttachment, error) {
+	var attachment models.MessageAttachment
+	if err := s.db.Where("id = ? AND user_id = ?", attachmentID, userID).First(&attachment).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, errors.New("attachment not found")
+		}
+		return nil, fmt.Errorf("database error: %w", err)
+	}
+
+	return &attachment, nil
+}
+
+// OpenAttachment opens a stored attachment's content. Callers must close the reader.
+func (s *AttachmentService) OpenAttachment(attachment *models.MessageAttachment) (io.ReadCloser, error) {
+	if !attachment.Downloadable() {
+		return nil, errors.New("attachment is not available")
+	}
+
+	reader, err := s.store.Get(context.Background(), attachment.StorageKey)
+	if err != nil {
+		if errors.Is(err, storage.ErrBlobNotFound) {
+			return nil, errors.New("attachment is not available")
+		}
+		return nil, err
+	}
+
+	return reader, nil
+}
+
+// ReadAttachment loads a stored attachment's content into memory
+func (s *AttachmentService) ReadAttachment(attachment *models.MessageAttachment) ([]byte, error) {
+	reader, err := s.OpenAttachment(attachment)
+	if err != nil {
+		return nil, err
+	}
+	defer reader.Close()
+
+	return io.ReadAll(reader)
+}
+
+// sanitizeAttachmentFilename strips any path components and control characters from a filename
+func sanitizeAttachmentFilename(name string) string {
+	name = strings.ReplaceAll(name, "\\", "/")
+	name = filepath.Base(strings.TrimSpace(name))
+	name = strings.Map(func(r rune) rune {
+		if r < 0x20 || r == 0x7f {
+			return -1
+		}
+		return r
+	}, name)
+
+	if name == "" || name == "." || name == "/" {
+		return "attachment"
+	}
+	return name
+}
+
+// detectAttachmentContentType picks a content type from the declared type, the extension
+// and the file's magic bytes, in that order of preference
+func detectAttachmentContentType(filename, declared string, data []byte) string {
+	if mediaType, _, err := mime.ParseMediaType(declared); err == nil {
+		declared = strings.ToLower(mediaType)
+	} else {
+		declared = ""
+	}
+	if allowedAttachmentTypes[declared] {
+		return declared
+	}
+
+	if byExt, _, err := mime.ParseMediaType(mime.TypeByExtension(strings.ToLower(filepath.Ext(filename)))); err == nil {
+		if allowedAttachmentTypes[byExt] {
+			return byExt
+		}
+	}
+
+	if len(data) > 0 {
+		if sniffed, _, err := mime.ParseMediaType(http.DetectContentType(data)); err == nil && allowedAttachmentTypes[sniffed] {
+			return sniffed
+		}
+	}
+
+	if declared != "" {
+		return declared
+	}
+	return "application/octet-stream"
+}
@@ -153,6 +153,42 @@ func (s *AuthService) ValidateToken(tokenString string) (uuid.UUID, error) {
 	return userID, nil
 }
 
+// SetInboxAlias sets a friendly alias used in place of the user's UUID in their inbox address.
+// An empty alias reverts the inbox to the UUID address.
+func (s *AuthService) SetInboxAlias(userID uuid.UUID, alias string) (*models.User, error) {
+	var user models.User
+	if err := s.db.Where("id = ?", userID).First(&user).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, errors.New("user not found")
+		}
+		return nil, fmt.Errorf("database error: %w", err)
+	}
+
+	if alias == "" {
+		user.InboxAlias = nil
+	} else {
+		normalized, err := NormalizeInboxAlias(alias)
+		if err != nil {
+			return nil, err
+		}
+
+		// Check the alias isn't taken by another user
+		var existing models.User
+		if err := s.db.Where("inbox_alias = ? AND id <> ?", normalized, userID).First(&existing).Error; err == nil {
+			return nil, errors.New("alias is already taken")
+		}
+		user.InboxAlias = &normalized
+	}
+
+	user.InboxEmail = fmt.Sprintf("%s@%s", InboxLocalPart(&user), s.mailgunDomain)
+
+	if err := s.db.Save(&user).Error; err != nil {
+		return nil, fmt.Errorf("failed to update inbox alias: %w", err)
+	}
+
+	return &user, nil
+}
+
 // GetUserByID retrieves a user by their ID
 func (s *AuthService) GetUserByID(userID uuid.UUID) (*models.User, error) {
 	var user models.User
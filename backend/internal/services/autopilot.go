@@ -0,0 +1,622 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"regexp"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"carbuyer/internal/db/models"
+	"carbuyer/internal/llm"
+
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// Limits autopilot settings are validated against
+const (
+	defaultAutopilotRepliesPerDay = 3
+	maxAutopilotRepliesPerDay     = 20
+	maxNeverDiscloseItems         = 20
+	maxNeverDiscloseLength        = 200
+)
+
+// dollarAmountPattern matches dollar amounts such as $38,900, $38900.00 and $38.9k
+var dollarAmountPattern = regexp.MustCompile(`\$\s?(\d{1,3}(?:,\d{3})+|\d+)(\.\d+)?\s?([kK])?\b`)
+
+// AutopilotSettingsInput is the user's guardrails for a thread on autopilot
+type AutopilotSettingsInput struct {
+	Enabled          bool
+	AutoSend         bool
+	TargetPrice      *float64
+	WalkAwayPrice    *float64
+	NeverDisclose    []string
+	MaxRepliesPerDay int // Zero means the default
+}
+
+// AutopilotChoice is the LLM's decision about a seller message
+type AutopilotChoice struct {
+	Action    models.AutopilotAction `json:"action"`
+	Reasoning string                 `json:"reasoning"`
+	Reply     string                 `json:"reply"`
+}
+
+// ParseAutopilotChoice parses the LLM's autopilot decision JSON. A reply decision without a
+// reply is an error, since there'd be nothing to send.
+func ParseAutopilotChoice(response string) (*AutopilotChoice, error) {
+	var choice AutopilotChoice
+	if err := llm.DecodeJSON(response, &choice); err != nil {
+		return nil, err
+	}
+
+	choice.Action = models.AutopilotAction(strings.ToLower(strings.TrimSpace(string(choice.Action))))
+	choice.Reasoning = strings.TrimSpace(choice.Reasoning)
+	choice.Reply = stripDraftPreamble(choice.Reply)
+
+	switch choice.Action {
+	case models.AutopilotActionReply:
+		if choice.Reply == "" {
+			return nil, errors.New("reply decision without a reply")
+		}
+	case models.AutopilotActionWait, models.AutopilotActionEscalate:
+		choice.Reply = ""
+	default:
+		return nil, fmt.Errorf("unknown autopilot action %q", choice.Action)
+	}
+
+	return &choice, nil
+}
+
+// AutopilotService lets the agent answer seller messages on threads the user put on autopilot.
+// Replies wait in an approval queue unless the user allowed auto-send, and every decision is
+// logged with the agent's reasoning.
+type AutopilotService struct {
+	db           *gorm.DB
+	llm          llm.LLM
+	emailService *EmailService
+	smsService   *SMSService
+	guardrails   *DraftGuardrailService
+	background   sync.WaitGroup
+}
+
+// NewAutopilotService creates a new autopilot service. Replies go out by email or text,
+// the way the seller's message came in, once they pass the draft guardrails.
+func NewAutopilotService(db *gorm.DB, llm llm.LLM, emailService *EmailService, smsService *SMSService, guardrails *DraftGuardrailService) *AutopilotService {
+	return &AutopilotService{
+		db:           db,
+		llm:          llm,
+		emailService: emailService,
+		smsService:   smsService,
+		guardrails:   guardrails,
+	}
+}
+
+// GetSettings returns a thread's autopilot settings, or the defaults if it has none
+func (s *AutopilotService) GetSettings(threadID, userID uuid.UUID) (*models.AutopilotSettings, error) {
+	if err := s.verifyThread(threadID, userID); err != nil {
+		return nil, err
+	}
+
+	var settings models.AutopilotSettings
+	err := s.db.Where("thread_id = ?", threadID).First(&settings).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return &models.AutopilotSettings{
+			ThreadID:         threadID,
+			UserID:           userID,
+			MaxRepliesPerDay: defaultAutopilotRepliesPerDay,
+		}, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("database error: %w", err)
+	}
+
+	return &settings, nil
+}
+
+// UpdateSettings replaces a thread's autopilot settings
+func (s *AutopilotService) UpdateSettings(threadID, userID uuid.UUID, input AutopilotSettingsInput) (*models.AutopilotSettings, error) {
+	if err := validateAutopilotSettings(&input); err != nil {
+		return nil, err
+	}
+
+	settings, err := s.GetSettings(threadID, userID)
+	if err != nil {
+		return nil, err
+	}
+
+	settings.Enabled = input.Enabled
+	settings.AutoSend = input.AutoSend
+	settings.TargetPrice = input.TargetPrice
+	settings.WalkAwayPrice = input.WalkAwayPrice
+	settings.NeverDisclose = strings.Join(input.NeverDisclose, "\n")
+	settings.MaxRepliesPerDay = input.MaxRepliesPerDay
+
+	if err := s.db.Save(settings).Error; err != nil {
+		return nil, fmt.Errorf("failed to save autopilot settings: %w", err)
+	}
+
+	return settings, nil
+}
+
+// validateAutopilotSettings checks the guardrails, trims never-disclose items and fills in
+// the default reply limit
+func validateAutopilotSettings(input *AutopilotSettingsInput) error {
+	if input.TargetPrice != nil && (*input.TargetPrice <= 0 || *input.TargetPrice > maxOfferAmount) {
+		return fmt.Errorf("targetPrice must be between 0 and %d", maxOfferAmount)
+	}
+	if input.WalkAwayPrice != nil && (*input.WalkAwayPrice <= 0 || *input.WalkAwayPrice > maxOfferAmount) {
+		return fmt.Errorf("walkAwayPrice must be between 0 and %d", maxOfferAmount)
+	}
+	if input.TargetPrice != nil && input.WalkAwayPrice != nil && *input.TargetPrice > *input.WalkAwayPrice {
+		return errors.New("targetPrice can't be above walkAwayPrice")
+	}
+
+	if input.MaxRepliesPerDay == 0 {
+		input.MaxRepliesPerDay = defaultAutopilotRepliesPerDay
+	}
+	if input.MaxRepliesPerDay < 0 || input.MaxRepliesPerDay > maxAutopilotRepliesPerDay {
+		return fmt.Errorf("maxRepliesPerDay must be between 1 and %d", maxAutopilotRepliesPerDay)
+	}
+
+	items := neverDiscloseItems(strings.Join(input.NeverDisclose, "\n"))
+	if len(items) > maxNeverDiscloseItems {
+		return fmt.Errorf("neverDisclose can have at most %d items", maxNeverDiscloseItems)
+	}
+	for _, item := range items {
+		if len(item) > maxNeverDiscloseLength {
+			return fmt.Errorf("neverDisclose items must be at most %d characters", maxNeverDiscloseLength)
+		}
+	}
+	input.NeverDisclose = items
+
+	return nil
+}
+
+// RespondAsync decides on a reply to a seller message in the background, if its thread is on
+// autopilot. A nil service does nothing, so callers without autopilot can pass nil.
+func (s *AutopilotService) RespondAsync(messageID uuid.UUID) {
+	if s == nil {
+		return
+	}
+
+	s.background.Add(1)
+	go func() {
+		defer s.background.Done()
+		if _, err := s.Respond(context.Background(), messageID); err != nil {
+			logLLMFailure(err, "run autopilot for message %s", messageID)
+		}
+	}()
+}
+
+// Wait blocks until background decisions have finished. Commands call this before exiting.
+func (s *AutopilotService) Wait() {
+	if s != nil {
+		s.background.Wait()
+	}
+}
+
+// Respond decides what to do about a seller message on a thread that is on autopilot, and
+// logs the decision. It returns nil without deciding when the thread isn't on autopilot, the
+// message was already decided on, or a newer seller message is waiting.
+func (s *AutopilotService) Respond(ctx context.Context, messageID uuid.UUID) (*models.AutopilotDecision, error) {
+	var message models.Message
+	if err := s.db.Where("id = ? AND deleted_at IS NULL", messageID).First(&message).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, errors.New("message not found")
+		}
+		return nil, fmt.Errorf("database error: %w", err)
+	}
+	if !needsAutopilotReply(&message) {
+		return nil, nil
+	}
+	threadID := *message.ThreadID
+
+	var settings models.AutopilotSettings
+	if err := s.db.Where("thread_id = ? AND user_id = ? AND enabled = ?", threadID, message.UserID, true).First(&settings).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, nil
+		}
+		return nil, fmt.Errorf("database error: %w", err)
+	}
+
+	// Only the seller's latest message is answered
+	var newer int64
+	if err := s.db.Model(&models.Message{}).
+		Where("thread_id = ? AND sender = ? AND timestamp > ? AND deleted_at IS NULL", threadID, models.SenderTypeSeller, message.Timestamp).
+		Count(&newer).Error; err != nil {
+		return nil, fmt.Errorf("database error: %w", err)
+	}
+	if newer > 0 {
+		return nil, nil
+	}
+
+	decision := &models.AutopilotDecision{
+		ThreadID:  threadID,
+		UserID:    message.UserID,
+		MessageID: &message.ID,
+		Action:    models.AutopilotActionDeciding,
+	}
+	claimed, err := s.claimMessage(decision)
+	if err != nil || !claimed {
+		return nil, err
+	}
+
+	var replies int64
+	if err := s.db.Model(&models.AutopilotDecision{}).
+		Where("thread_id = ? AND reply_status IN ? AND created_at > ?", threadID,
+			[]models.AutopilotReplyStatus{models.AutopilotReplyPending, models.AutopilotReplySending, models.AutopilotReplySent}, time.Now().Add(-24*time.Hour)).
+		Count(&replies).Error; err != nil {
+		return s.escalate(decision, fmt.Errorf("database error: %w", err))
+	}
+	if replies >= int64(settings.MaxRepliesPerDay) {
+		decision.Action = models.AutopilotActionWait
+		decision.Guardrail = models.AutopilotGuardrailDailyLimit
+		decision.Reasoning = fmt.Sprintf("Already replied %d times in the last 24 hours, the most allowed.", replies)
+		return decision, s.saveDecision(decision)
+	}
+
+	negotiation, err := loadNegotiationContext(s.db, threadID, message.UserID, message.Content)
+	if err != nil {
+		return s.escalate(decision, err)
+	}
+	req := autopilotRequest(negotiation, &settings)
+	req.UserID = settings.UserID.String()
+	response, err := s.llm.Complete(ctx, req)
+	if err != nil {
+		return s.escalate(decision, err)
+	}
+	choice, err := ParseAutopilotChoice(response.Text)
+	if err != nil {
+		return s.escalate(decision, err)
+	}
+
+	decision.Action = choice.Action
+	decision.Reasoning = choice.Reasoning
+	if choice.Action != models.AutopilotActionReply {
+		return decision, s.saveDecision(decision)
+	}
+
+	decision.Reply = choice.Reply
+	warnings, err := s.guardrails.Check(ctx, message.UserID, &threadID, choice.Reply)
+	if err != nil {
+		return s.escalate(decision, err)
+	}
+	decision.Guardrail, decision.GuardrailNote = autopilotGuardrail(warnings)
+
+	// The reply is kept in the thread as an agent draft, like replies the user asks for
+	draft := &models.Message{
+		UserID:    message.UserID,
+		ThreadID:  &threadID,
+		Sender:    models.SenderTypeAgent,
+		Content:   choice.Reply,
+		Timestamp: time.Now(),
+	}
+	if err := saveThreadMessage(s.db, draft); err != nil {
+		return s.escalate(decision, err)
+	}
+	decision.DraftMessageID = &draft.ID
+	decision.ReplyStatus = models.AutopilotReplyPending
+
+	// A reply a guardrail held back always waits for the user
+	if settings.AutoSend && decision.Guardrail == models.AutopilotGuardrailNone {
+		if err := s.send(ctx, decision, &message, choice.Reply); err != nil {
+			decision.Error = "auto-send failed: " + err.Error()
+		} else {
+			now := time.Now()
+			decision.ReplyStatus = models.AutopilotReplySent
+			decision.SentAt = &now
+		}
+	}
+
+	return decision, s.saveDecision(decision)
+}
+
+// escalate logs that the agent couldn't decide, leaving the message to the user
+func (s *AutopilotService) escalate(decision *models.AutopilotDecision, cause error) (*models.AutopilotDecision, error) {
+	decision.Action = models.AutopilotActionEscalate
+	decision.Reasoning = "The agent couldn't decide on a reply, so it's left to you."
+	decision.Error = cause.Error()
+	if err := s.saveDecision(decision); err != nil {
+		return nil, err
+	}
+	return decision, cause
+}
+
+// claimMessage logs a decision on a seller message before it's made, so a message delivered
+// twice (webhook retries, replays) is only decided on once. Reports false when another
+// decision already claimed the message.
+func (s *AutopilotService) claimMessage(decision *models.AutopilotDecision) (bool, error) {
+	result := s.db.Clauses(clause.OnConflict{
+		Columns:   []clause.Column{{Name: "message_id"}},
+		DoNothing: true,
+	}).Create(decision)
+	if result.Error != nil {
+		return false, fmt.Errorf("failed to save autopilot decision: %w", result.Error)
+	}
+	return result.RowsAffected > 0, nil
+}
+
+// saveDecision records the outcome of a claimed decision
+func (s *AutopilotService) saveDecision(decision *models.AutopilotDecision) error {
+	if err := s.db.Save(decision).Error; err != nil {
+		return fmt.Errorf("failed to save autopilot decision: %w", err)
+	}
+	log.Printf("Autopilot decided to %s on thread %s: %s", decision.Action, decision.ThreadID, decision.Reasoning)
+	return nil
+}
+
+// GetDecisions returns a thread's autopilot decisions, newest first
+func (s *AutopilotService) GetDecisions(threadID, userID uuid.UUID, limit int) ([]models.AutopilotDecision, error) {
+	if err := s.verifyThread(threadID, userID); err != nil {
+		return nil, err
+	}
+
+	var decisions []models.AutopilotDecision
+	query := s.db.Where("thread_id = ?", threadID).Order("created_at DESC")
+	if limit > 0 {
+		query = query.Limit(limit)
+	}
+	if err := query.Find(&decisions).Error; err != nil {
+		return nil, fmt.Errorf("failed to retrieve autopilot decisions: %w", err)
+	}
+
+	return decisions, nil
+}
+
+// GetApprovalQueue returns the user's replies waiting for approval, oldest first
+func (s *AutopilotService) GetApprovalQueue(userID uuid.UUID) ([]models.AutopilotDecision, error) {
+	var decisions []models.AutopilotDecision
+	if err := s.db.
+		Where("user_id = ? AND reply_status = ?", userID, models.AutopilotReplyPending).
+		Preload("Thread").
+		Order("created_at ASC").
+		Find(&decisions).Error; err != nil {
+		return nil, fmt.Errorf("failed to retrieve approval queue: %w", err)
+	}
+
+	return decisions, nil
+}
+
+// ApproveReply sends a queued reply. content replaces the reply when given, so the user can
+// edit it first. Replies with draft guardrail warnings are only sent once the user acknowledged
+// them. If sending fails the reply stays in the queue.
+func (s *AutopilotService) ApproveReply(ctx context.Context, decisionID, userID uuid.UUID, content string, acknowledged bool) (*models.AutopilotDecision, error) {
+	decision, err := s.pendingDecision(decisionID, userID)
+	if err != nil {
+		return nil, err
+	}
+
+	content = strings.TrimSpace(content)
+	if content == "" {
+		content = decision.Reply
+	}
+
+	var message models.Message
+	if decision.MessageID == nil || s.db.Where("id = ?", *decision.MessageID).First(&message).Error != nil {
+		return nil, errors.New("seller message not found")
+	}
+
+	if err := s.guardrails.EnforceReply(ctx, userID, message.ID, content, acknowledged); err != nil {
+		return nil, err
+	}
+
+	// Claim the reply first, so a second approval (a double click, a retry) can't send it again
+	if err := s.claimReply(decision, models.AutopilotReplySending); err != nil {
+		return nil, err
+	}
+
+	// The thread's draft shows what was actually sent, edits included
+	if content != decision.Reply {
+		if err := s.editReply(decision, content); err != nil {
+			s.releaseReply(decision, err)
+			return nil, err
+		}
+	}
+
+	if err := s.send(ctx, decision, &message, content); err != nil {
+		s.releaseReply(decision, err)
+		return nil, err
+	}
+
+	now := time.Now()
+	decision.Reply = content
+	decision.ReplyStatus = models.AutopilotReplySent
+	decision.ReviewedAt = &now
+	decision.SentAt = &now
+	decision.Error = ""
+	if err := s.db.Model(decision).Updates(map[string]interface{}{
+		"reply":        decision.Reply,
+		"reply_status": decision.ReplyStatus,
+		"reviewed_at":  now,
+		"sent_at":      now,
+		"error":        "",
+	}).Error; err != nil {
+		// The reply is already sent, so this is logged rather than reported
+		log.Printf("Failed to record approval of autopilot decision %s: %v", decision.ID, err)
+	}
+
+	return decision, nil
+}
+
+// editReply replaces a queued reply and the agent draft holding it with the user's edit
+func (s *AutopilotService) editReply(decision *models.AutopilotDecision, content string) error {
+	err := s.db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Model(decision).Update("reply", content).Error; err != nil {
+			return fmt.Errorf("failed to update autopilot decision: %w", err)
+		}
+		if decision.DraftMessageID != nil {
+			if err := tx.Model(&models.Message{}).Where("id = ?", *decision.DraftMessageID).Update("content", content).Error; err != nil {
+				return fmt.Errorf("failed to update draft: %w", err)
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+
+	decision.Reply = content
+	return nil
+}
+
+// RejectReply drops a queued reply without sending it
+func (s *AutopilotService) RejectReply(decisionID, userID uuid.UUID) (*models.AutopilotDecision, error) {
+	decision, err := s.pendingDecision(decisionID, userID)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := s.claimReply(decision, models.AutopilotReplyRejected); err != nil {
+		return nil, err
+	}
+
+	now := time.Now()
+	decision.ReviewedAt = &now
+	if err := s.db.Model(decision).Update("reviewed_at", now).Error; err != nil {
+		return nil, fmt.Errorf("failed to update autopilot decision: %w", err)
+	}
+
+	return decision, nil
+}
+
+// claimReply moves a pending reply to status, failing if another approval or rejection got
+// to it first
+func (s *AutopilotService) claimReply(decision *models.AutopilotDecision, status models.AutopilotReplyStatus) error {
+	result := s.db.Model(&models.AutopilotDecision{}).
+		Where("id = ? AND reply_status = ?", decision.ID, models.AutopilotReplyPending).
+		Update("reply_status", status)
+	if result.Error != nil {
+		return fmt.Errorf("failed to update autopilot decision: %w", result.Error)
+	}
+	if result.RowsAffected == 0 {
+		return errors.New("reply is not pending approval")
+	}
+
+	decision.ReplyStatus = status
+	return nil
+}
+
+// releaseReply puts a reply that failed to send back in the approval queue
+func (s *AutopilotService) releaseReply(decision *models.AutopilotDecision, cause error) {
+	decision.ReplyStatus = models.AutopilotReplyPending
+	if err := s.db.Model(decision).Updates(map[string]interface{}{
+		"reply_status": decision.ReplyStatus,
+		"error":        cause.Error(),
+	}).Error; err != nil {
+		log.Printf("Failed to return autopilot decision %s to the queue: %v", decision.ID, err)
+	}
+}
+
+// pendingDecision loads a decision whose reply is waiting for approval
+func (s *AutopilotService) pendingDecision(decisionID, userID uuid.UUID) (*models.AutopilotDecision, error) {
+	var decision models.AutopilotDecision
+	if err := s.db.Where("id = ? AND user_id = ?", decisionID, userID).Preload("Thread").First(&decision).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, errors.New("decision not found")
+		}
+		return nil, fmt.Errorf("database error: %w", err)
+	}
+	if decision.ReplyStatus != models.AutopilotReplyPending {
+		return nil, errors.New("reply is not pending approval")
+	}
+	return &decision, nil
+}
+
+// send delivers a reply the way the seller's message came in: by text, or by email from the
+// user's Gmail
+func (s *AutopilotService) send(ctx context.Context, decision *models.AutopilotDecision, message *models.Message, content string) error {
+	switch {
+	case message.Channel == models.MessageChannelSMS:
+		if s.smsService == nil || decision.DraftMessageID == nil {
+			return errors.New("texts can't be sent")
+		}
+		_, err := s.smsService.SendDraft(ctx, decision.UserID, *decision.DraftMessageID, content)
+		return err
+	case message.ExternalMessageID != "" && message.SenderEmail != "":
+		if s.emailService == nil {
+			return errors.New("email can't be sent")
+		}
+		return s.emailService.ReplyViaGmail(decision.UserID, message.ID, content)
+	default:
+		return errors.New("the seller's message didn't arrive by email or text")
+	}
+}
+
+// verifyThread checks that a thread belongs to the user
+func (s *AutopilotService) verifyThread(threadID, userID uuid.UUID) error {
+	var thread models.Thread
+	if err := s.db.Where("id = ? AND user_id = ?", threadID, userID).First(&thread).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return errors.New("thread not found")
+		}
+		return fmt.Errorf("database error: %w", err)
+	}
+	return nil
+}
+
+// needsAutopilotReply reports whether a message is one autopilot answers: a human seller
+// message in a thread
+func needsAutopilotReply(message *models.Message) bool {
+	if message.Sender != models.SenderTypeSeller || message.ThreadID == nil {
+		return false
+	}
+	return message.Category == "" || message.Category == models.MessageCategoryHuman
+}
+
+// autopilotGuardrail picks the draft warning that holds an autopilot reply back for the user,
+// preferring ones that block sending. Any warning holds it, even one the user could acknowledge.
+func autopilotGuardrail(warnings []DraftWarning) (models.AutopilotGuardrail, string) {
+	if len(warnings) == 0 {
+		return models.AutopilotGuardrailNone, ""
+	}
+
+	held := warnings[0]
+	for _, warning := range warnings {
+		if warning.Severity == DraftSeverityBlock {
+			held = warning
+			break
+		}
+	}
+
+	switch held.Kind {
+	case DraftWarningNeverDisclose:
+		return models.AutopilotGuardrailNeverDisclose, held.Message
+	case DraftWarningWalkAway:
+		return models.AutopilotGuardrailWalkAway, held.Message
+	default:
+		return models.AutopilotGuardrailDraftCheck, held.Message
+	}
+}
+
+// neverDiscloseItems splits never-disclose settings into their non-empty items
+func neverDiscloseItems(text string) []string {
+	var items []string
+	for _, line := range strings.Split(text, "\n") {
+		if line = strings.TrimSpace(line); line != "" {
+			items = append(items, line)
+		}
+	}
+	return items
+}
+
+// dollarAmounts returns the dollar amounts written in text
+func dollarAmounts(text string) []float64 {
+	var amounts []float64
+	for _, match := range dollarAmountPattern.FindAllStringSubmatch(text, -1) {
+		value, err := strconv.ParseFloat(strings.ReplaceAll(match[1], ",", "")+match[2], 64)
+		if err != nil {
+			continue
+		}
+		if match[3] != "" {
+			value *= 1000
+		}
+		amounts = append(amounts, value)
+	}
+	return amounts
+}
@@ -0,0 +1,250 @@
+package services
+
+import (
+	"reflect"
+	"testing"
+
+	"carbuyer/internal/db/models"
+
+	"github.com/google/uuid"
+)
+
+func TestParseAutopilotChoice(t *testing.T) {
+	tests := []struct {
+		name       string
+		response   string
+		wantAction models.AutopilotAction
+		wantReply  string
+		wantErr    bool
+	}{
+		{
+			name:       "reply",
+			response:   `{"action": "reply", "reasoning": "They came down $500; push for the target.", "reply": "Thanks. I can do $36,500 out the door."}`,
+			wantAction: models.AutopilotActionReply,
+			wantReply:  "Thanks. I can do $36,500 out the door.",
+		},
+		{
+			name:       "reply with a preamble",
+			response:   "```json\n" + `{"action": "Reply", "reasoning": "Counter.", "reply": "Here's a draft: Can you do $36,500?"}` + "\n```",
+			wantAction: models.AutopilotActionReply,
+			wantReply:  "Can you do $36,500?",
+		},
+		{
+			name:       "wait drops any reply",
+			response:   `{"action": "wait", "reasoning": "They're checking with their manager.", "reply": "Ok"}`,
+			wantAction: models.AutopilotActionWait,
+		},
+		{
+			name:       "escalate",
+			response:   `{"action": "escalate", "reasoning": "They want a deposit."}`,
+			wantAction: models.AutopilotActionEscalate,
+		},
+		{
+			name:     "reply without a reply",
+			response: `{"action": "reply", "reasoning": "Counter."}`,
+			wantErr:  true,
+		},
+		{
+			name:     "unknown action",
+			response: `{"action": "accept", "reasoning": "Good deal."}`,
+			wantErr:  true,
+		},
+		{
+			name:     "not JSON",
+			response: "I would reply with a counteroffer.",
+			wantErr:  true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := ParseAutopilotChoice(tt.response)
+			if tt.wantErr {
+				if err == nil {
+					t.Errorf("ParseAutopilotChoice() = %+v, want error", got)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("ParseAutopilotChoice() error = %v", err)
+			}
+			if got.Action != tt.wantAction {
+				t.Errorf("Action = %q, want %q", got.Action, tt.wantAction)
+			}
+			if got.Reply != tt.wantReply {
+				t.Errorf("Reply = %q, want %q", got.Reply, tt.wantReply)
+			}
+		})
+	}
+}
+
+func TestAutopilotGuardrail(t *testing.T) {
+	walkAway := 38000.0
+	settings := &models.AutopilotSettings{
+		WalkAwayPrice: &walkAway,
+		NeverDisclose: "trade-in\n\n  pre-approved  \n",
+	}
+
+	tests := []struct {
+		name  string
+		reply string
+		want  models.AutopilotGuardrail
+	}{
+		{
+			name:  "within guardrails",
+			reply: "I can do $36,500 out the door, with the $799 doc fee included.",
+			want:  models.AutopilotGuardrailNone,
+		},
+		{
+			name:  "names the walk-away price",
+			reply: "My final offer is $38,000.",
+			want:  models.AutopilotGuardrailDraftCheck,
+		},
+		{
+			name:  "personal data",
+			reply: "My SSN is 123-45-6789 for the credit app.",
+			want:  models.AutopilotGuardrailDraftCheck,
+		},
+		{
+			name:  "a block wins over a warning",
+			reply: "I'm pre-approved, so you can deliver it to 42 Maple Grove Ln, Springfield.",
+			want:  models.AutopilotGuardrailNeverDisclose,
+		},
+		{
+			name:  "above the walk-away price",
+			reply: "I could stretch to $38,500.",
+			want:  models.AutopilotGuardrailWalkAway,
+		},
+		{
+			name:  "thousands shorthand",
+			reply: "Would $39k work?",
+			want:  models.AutopilotGuardrailWalkAway,
+		},
+		{
+			name:  "never-disclose item, any case",
+			reply: "I'm Pre-Approved with my credit union, so I can close quickly.",
+			want:  models.AutopilotGuardrailNeverDisclose,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			warnings := append(personalDataWarnings(tt.reply), disclosureWarnings(tt.reply, settings)...)
+			got, note := autopilotGuardrail(warnings)
+			if got != tt.want {
+				t.Errorf("autopilotGuardrail() = %q (%s), want %q", got, note, tt.want)
+			}
+		})
+	}
+}
+
+func TestDollarAmounts(t *testing.T) {
+	got := dollarAmounts("Price is $38,900.50, $799 doc fee, $ 1200 in add-ons, $41.5k OTD, 2025 model, 4.9% APR")
+	want := []float64{38900.50, 799, 1200, 41500}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("dollarAmounts() = %v, want %v", got, want)
+	}
+}
+
+func TestValidateAutopilotSettings(t *testing.T) {
+	price := func(v float64) *float64 { return &v }
+
+	tests := []struct {
+		name    string
+		input   AutopilotSettingsInput
+		wantErr string
+	}{
+		{
+			name:  "defaults",
+			input: AutopilotSettingsInput{Enabled: true},
+		},
+		{
+			name:  "full guardrails",
+			input: AutopilotSettingsInput{Enabled: true, AutoSend: true, TargetPrice: price(36000), WalkAwayPrice: price(38000), NeverDisclose: []string{"trade-in"}, MaxRepliesPerDay: 5},
+		},
+		{
+			name:    "target above walk-away",
+			input:   AutopilotSettingsInput{TargetPrice: price(39000), WalkAwayPrice: price(38000)},
+			wantErr: "targetPrice can't be above walkAwayPrice",
+		},
+		{
+			name:    "negative price",
+			input:   AutopilotSettingsInput{WalkAwayPrice: price(-1)},
+			wantErr: "walkAwayPrice must be between 0 and 10000000",
+		},
+		{
+			name:    "too many replies",
+			input:   AutopilotSettingsInput{MaxRepliesPerDay: 50},
+			wantErr: "maxRepliesPerDay must be between 1 and 20",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := validateAutopilotSettings(&tt.input)
+			if tt.wantErr == "" {
+				if err != nil {
+					t.Errorf("validateAutopilotSettings() error = %v", err)
+				}
+				return
+			}
+			if err == nil || err.Error() != tt.wantErr {
+				t.Errorf("validateAutopilotSettings() error = %v, want %q", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestValidateAutopilotSettingsCleansInput(t *testing.T) {
+	input := AutopilotSettingsInput{NeverDisclose: []string{" trade-in ", "", "monthly budget"}}
+	if err := validateAutopilotSettings(&input); err != nil {
+		t.Fatalf("validateAutopilotSettings() error = %v", err)
+	}
+	if input.MaxRepliesPerDay != defaultAutopilotRepliesPerDay {
+		t.Errorf("MaxRepliesPerDay = %d, want %d", input.MaxRepliesPerDay, defaultAutopilotRepliesPerDay)
+	}
+	if want := []string{"trade-in", "monthly budget"}; !reflect.DeepEqual(input.NeverDisclose, want) {
+		t.Errorf("NeverDisclose = %q, want %q", input.NeverDisclose, want)
+	}
+}
+
+func TestNeedsAutopilotReply(t *testing.T) {
+	threadID := uuid.New()
+
+	tests := []struct {
+		name    string
+		message models.Message
+		want    bool
+	}{
+		{
+			name:    "seller reply",
+			message: models.Message{Sender: models.SenderTypeSeller, ThreadID: &threadID, Category: models.MessageCategoryHuman},
+			want:    true,
+		},
+		{
+			name:    "unclassified seller message",
+			message: models.Message{Sender: models.SenderTypeSeller, ThreadID: &threadID},
+			want:    true,
+		},
+		{
+			name:    "auto-reply",
+			message: models.Message{Sender: models.SenderTypeSeller, ThreadID: &threadID, Category: models.MessageCategoryAutoReply},
+		},
+		{
+			name:    "inbox message",
+			message: models.Message{Sender: models.SenderTypeSeller},
+		},
+		{
+			name:    "agent draft",
+			message: models.Message{Sender: models.SenderTypeAgent, ThreadID: &threadID},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := needsAutopilotReply(&tt.message); got != tt.want {
+				t.Errorf("needsAutopilotReply() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
@@ -1,30 +1,35 @@
 package services
 
 import (
+	"context"
 	"errors"
 	"fmt"
 	"log"
+	"strings"
 
 	"carbuyer/internal/db/models"
+	"carbuyer/internal/llm"
 
 	"github.com/google/uuid"
 	"gorm.io/gorm"
 )
 
 type DealerService struct {
-	db            *gorm.DB
-	claudeService *ClaudeService
+	db      *gorm.DB
+	llm     llm.LLM
+	prompts *PromptTemplateService
 }
 
-func NewDealerService(db *gorm.DB, claudeService *ClaudeService) *DealerService {
+func NewDealerService(db *gorm.DB, llm llm.LLM, prompts *PromptTemplateService) *DealerService {
 	return &DealerService{
-		db:            db,
-		claudeService: claudeService,
+		db:      db,
+		llm:     llm,
+		prompts: prompts,
 	}
 }
 
-// FetchDealersForZipCode fetches dealers using Claude based on zip code and vehicle info
-func (s *DealerService) FetchDealersForZipCode(zipCode string, make string, model string, year int) ([]DealerInfo, error) {
+// FetchDealersForZipCode fetches dealers using the LLM based on zip code and vehicle info
+func (s *DealerService) FetchDealersForZipCode(userID uuid.UUID, zipCode string, make string, model string, year int) ([]DealerInfo, error) {
 	if zipCode == "" {
 		return nil, errors.New("zip code is required")
 	}
@@ -32,7 +37,32 @@ func (s *DealerService) FetchDealersForZipCode(zipCode string, make string, mode
 		return nil, errors.New("make and model are required")
 	}
 
-	return s.claudeService.FetchNearbyDealers(zipCode, make, model, year)
+	prompt, err := s.prompts.Prompt(models.LLMPurposeDealerSearch, userID)
+	if err != nil {
+		return nil, err
+	}
+	req, err := dealerSearchRequest(prompt, DealerSearchPromptData{ZipCode: zipCode, Make: make, Model: model, Year: year})
+	if err != nil {
+		return nil, err
+	}
+
+	var dealers []DealerInfo
+	req.UserID = userID.String()
+	if _, err := s.llm.CompleteJSON(context.Background(), req, &dealers); err != nil {
+		return nil, err
+	}
+
+	// Validate we have at least some dealers
+	if len(dealers) == 0 {
+		return nil, fmt.Errorf("no dealers found in LLM response")
+	}
+
+	// Limit to 6 dealers
+	if len(dealers) > 6 {
+		dealers = dealers[:6]
+	}
+
+	return dealers, nil
 }
 
 // SaveDealersForPreferences saves dealers to the database for a given preference
@@ -46,6 +76,12 @@ func (s *DealerService) SaveDealersForPreferences(preferenceID uuid.UUID, dealer
 		return fmt.Errorf("failed to delete existing dealers: %w", err)
 	}
 
+	// Keep addresses that bounced or complained flagged when the list is refreshed
+	suppressions, err := s.emailSuppressions(dealers)
+	if err != nil {
+		return err
+	}
+
 	// Create dealer records (contacted defaults to false)
 	for _, dealerInfo := range dealers {
 		dealer := &models.Dealer{
@@ -57,6 +93,13 @@ func (s *DealerService) SaveDealersForPreferences(preferenceID uuid.UUID, dealer
 			Distance:         dealerInfo.Distance,
 			UserPreferenceID: preferenceID,
 		}
+		if dealerInfo.Email != nil {
+			if suppression, ok := suppressions[strings.ToLower(*dealerInfo.Email)]; ok {
+				dealer.EmailStatus = suppression.Status
+				dealer.EmailStatusReason = suppression.Reason
+				dealer.EmailStatusAt = &suppression.UpdatedAt
+			}
+		}
 
 		if err := s.db.Create(dealer).Error; err != nil {
 			return fmt.Errorf("failed to create dealer %s: %w", dealerInfo.Name, err)
@@ -67,6 +110,30 @@ func (s *DealerService) SaveDealersForPreferences(preferenceID uuid.UUID, dealer
 	return nil
 }
 
+// emailSuppressions loads the suppressed addresses among the dealers' emails, keyed by lowercase address
+func (s *DealerService) emailSuppressions(dealers []DealerInfo) (map[string]models.EmailSuppression, error) {
+	var emails []string
+	for _, dealer := range dealers {
+		if dealer.Email != nil && *dealer.Email != "" {
+			emails = append(emails, strings.ToLower(*dealer.Email))
+		}
+	}
+	if len(emails) == 0 {
+		return nil, nil
+	}
+
+	var suppressions []models.EmailSuppression
+	if err := s.db.Where("email IN ?", emails).Find(&suppressions).Error; err != nil {
+		return nil, fmt.Errorf("failed to load email suppressions: %w", err)
+	}
+
+	byEmail := make(map[string]models.EmailSuppression, len(suppressions))
+	for _, suppression := range suppressions {
+		byEmail[suppression.Email] = suppression
+	}
+	return byEmail, nil
+}
+
 // GetDealersForPreferences retrieves dealers for a given preference
 func (s *DealerService) GetDealersForPreferences(preferenceID uuid.UUID) ([]models.Dealer, error) {
 	var dealers []models.Dealer
@@ -0,0 +1,32 @@
+package services
+
+import (
+	"testing"
+
+	"carbuyer/internal/llm"
+
+	"github.com/google/uuid"
+)
+
+func TestFetchDealersForZipCode(t *testing.T) {
+	fake := llm.NewFake("Here are the dealers:\n```json\n" + `[
+		{"name": "Northgate Ford", "location": "Seattle, WA", "email": "sales@northgateford.com", "phone": null, "website": null, "distance": 3.1},
+		{"name": "Bellevue Ford", "location": "Bellevue, WA", "email": null, "phone": "425-555-0100", "website": null, "distance": 9.4}
+	]` + "\n```")
+	service := NewDealerService(nil, fake, nil)
+
+	dealers, err := service.FetchDealersForZipCode(uuid.New(), "98103", "Ford", "Explorer", 2024)
+	if err != nil {
+		t.Fatalf("FetchDealersForZipCode() error = %v", err)
+	}
+	if len(dealers) != 2 || dealers[0].Name != "Northgate Ford" || dealers[0].Email == nil || dealers[1].Phone == nil {
+		t.Errorf("FetchDealersForZipCode() = %+v", dealers)
+	}
+
+	if _, err := NewDealerService(nil, llm.NewFake("[]"), nil).FetchDealersForZipCode(uuid.New(), "98103", "Ford", "Explorer", 2024); err == nil {
+		t.Error("FetchDealersForZipCode() with no dealers: want error")
+	}
+	if _, err := service.FetchDealersForZipCode(uuid.New(), "", "Ford", "Explorer", 2024); err == nil {
+		t.Error("FetchDealersForZipCode() without a zip code: want error")
+	}
+}
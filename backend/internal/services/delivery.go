@@ -0,0 +1,145 @@
+package services
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"strings"
+	"time"
+
+	"carbuyer/internal/db/models"
+	"carbuyer/internal/inbound"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// deliveryStatusRank orders delivery statuses so a late or replayed event never moves a
+// message back to an earlier state
+var deliveryStatusRank = map[models.DeliveryStatus]int{
+	models.DeliveryStatusSent:       1,
+	models.DeliveryStatusDeferred:   2,
+	models.DeliveryStatusDelivered:  3,
+	models.DeliveryStatusBounced:    4,
+	models.DeliveryStatusComplained: 5,
+}
+
+// DeliveryService records what happened to outbound emails, from provider event webhooks and
+// bounce notifications, and stops dealer addresses that hard bounce from being used
+type DeliveryService struct {
+	db *gorm.DB
+}
+
+// NewDeliveryService creates a new delivery service
+func NewDeliveryService(db *gorm.DB) *DeliveryService {
+	return &DeliveryService{db: db}
+}
+
+// RecordEvent applies a delivery event to the outbound message it describes and, for hard
+// bounces and complaints, flags the recipient's dealer address. It returns the updated
+// message, or nil when the event doesn't match a message we sent.
+func (s *DeliveryService) RecordEvent(event inbound.DeliveryEvent) (*models.Message, error) {
+	status := models.DeliveryStatus(event.Type)
+	if _, ok := deliveryStatusRank[status]; !ok {
+		return nil, fmt.Errorf("unknown delivery event type %q", event.Type)
+	}
+
+	switch {
+	case status == models.DeliveryStatusBounced && event.Permanent:
+		if err := s.suppressAddress(event.Recipient, models.DealerEmailStatusInvalid, event.Reason); err != nil {
+			return nil, err
+		}
+	case status == models.DeliveryStatusComplained:
+		if err := s.suppressAddress(event.Recipient, models.DealerEmailStatusComplained, event.Reason); err != nil {
+			return nil, err
+		}
+	}
+
+	if event.MessageID == "" {
+		return nil, nil
+	}
+
+	// Message-IDs are stored as sent, with angle brackets, but providers don't all report them that way
+	bare := strings.Trim(event.MessageID, "<> ")
+	var message models.Message
+	err := s.db.Where("external_message_id IN ? AND sender <> ?", []string{"<" + bare + ">", bare}, models.SenderTypeSeller).
+		First(&message).Error
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			log.Printf("Delivery event %s for unknown message %s", event.Type, event.MessageID)
+			return nil, nil
+		}
+		return nil, fmt.Errorf("database error: %w", err)
+	}
+
+	if deliveryStatusRank[status] < deliveryStatusRank[message.DeliveryStatus] {
+		return &message, nil
+	}
+
+	timestamp := event.Timestamp
+	if timestamp.IsZero() {
+		timestamp = time.Now()
+	}
+	message.DeliveryStatus = status
+	message.DeliveryUpdatedAt = &timestamp
+	if status == models.DeliveryStatusDelivered {
+		message.DeliveryError = ""
+	} else if event.Reason != "" {
+		message.DeliveryError = event.Reason
+	}
+
+	if err := s.db.Model(&message).Updates(map[string]interface{}{
+		"delivery_status":     message.DeliveryStatus,
+		"delivery_error":      message.DeliveryError,
+		"delivery_updated_at": message.DeliveryUpdatedAt,
+	}).Error; err != nil {
+		return nil, fmt.Errorf("failed to update delivery status: %w", err)
+	}
+
+	return &message, nil
+}
+
+// checkEmailSuppression refuses an address that hard bounced or complained
+func checkEmailSuppression(db *gorm.DB, address string) error {
+	var count int64
+	if err := db.Model(&models.EmailSuppression{}).
+		Where("email = ?", strings.ToLower(strings.TrimSpace(address))).
+		Count(&count).Error; err != nil {
+		return fmt.Errorf("database error: %w", err)
+	}
+	if count > 0 {
+		return errors.New("recipient email address is suppressed")
+	}
+	return nil
+}
+
+// suppressAddress records an address that must not be emailed again and flags every dealer
+// using it
+func (s *DeliveryService) suppressAddress(address string, status models.DealerEmailStatus, reason string) error {
+	address = strings.ToLower(strings.TrimSpace(address))
+	if address == "" {
+		return nil
+	}
+
+	suppression := models.EmailSuppression{Email: address, Status: status, Reason: reason}
+	if err := s.db.Clauses(clause.OnConflict{
+		Columns:   []clause.Column{{Name: "email"}},
+		DoUpdates: clause.AssignmentColumns([]string{"status", "reason", "updated_at"}),
+	}).Create(&suppression).Error; err != nil {
+		return fmt.Errorf("failed to save email suppression: %w", err)
+	}
+
+	now := time.Now()
+	if err := s.db.Model(&models.Dealer{}).
+		Where("LOWER(email) = ?", address).
+		Updates(map[string]interface{}{
+			"email_status":        status,
+			"email_status_reason": reason,
+			"email_status_at":     now,
+		}).Error; err != nil {
+		return fmt.Errorf("failed to flag dealer email: %w", err)
+	}
+
+	log.Printf("Dealer email %s marked %s: %s", address, status, reason)
+	return nil
+}
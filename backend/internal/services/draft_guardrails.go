@@ -0,0 +1,389 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"regexp"
+	"strings"
+
+	"carbuyer/internal/db/models"
+	"carbuyer/internal/llm"
+
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+)
+
+// DraftWarningKind names the guardrail a draft breaks
+type DraftWarningKind string
+
+const (
+	DraftWarningCompetitor    DraftWarningKind = "competitor"      // Names another seller the buyer has an offer from
+	DraftWarningWalkAway      DraftWarningKind = "walk_away_price" // Mentions more than the walk-away price
+	DraftWarningBudget        DraftWarningKind = "budget"          // Names the buyer's target or walk-away price, or talks about their budget
+	DraftWarningNeverDisclose DraftWarningKind = "never_disclose"
+	DraftWarningPersonalData  DraftWarningKind = "personal_data"
+	DraftWarningContradiction DraftWarningKind = "contradiction" // Contradicts what the buyer told the seller earlier
+)
+
+// DraftWarningSeverity is whether a warning stops a draft from being sent
+type DraftWarningSeverity string
+
+const (
+	DraftSeverityBlock DraftWarningSeverity = "block" // The draft can't be sent until it's changed
+	DraftSeverityWarn  DraftWarningSeverity = "warn"  // The draft can be sent once the user acknowledges the warning
+)
+
+// DraftWarning is a problem found in a draft before it's sent to a seller
+type DraftWarning struct {
+	Kind     DraftWarningKind
+	Severity DraftWarningSeverity
+	Message  string
+	Excerpt  string // The words in the draft the warning is about
+}
+
+// DraftBlockedError is returned when a draft can't be sent as it is
+type DraftBlockedError struct {
+	Warnings []DraftWarning
+}
+
+func (e *DraftBlockedError) Error() string {
+	return "the draft didn't pass the checks before sending"
+}
+
+// Patterns for personal data that should never go to a seller in writing
+var (
+	ssnPattern          = regexp.MustCompile(`\b\d{3}[- ]\d{2}[- ]\d{4}\b|(?i)\b(?:ssn|social security(?: number| no\.?)?)\W{0,5}\d{9}\b`)
+	birthDatePattern    = regexp.MustCompile(`(?i)\b(?:date of birth|d\.?o\.?b\.?|born on|birthday is)\W{0,5}[^\n]{0,10}\d{1,4}\b`)
+	streetAddrPattern   = regexp.MustCompile(`\b\d{1,6} (?:[A-Z][A-Za-z.']* ){1,3}(?:Street|St|Avenue|Ave|Road|Rd|Boulevard|Blvd|Drive|Dr|Lane|Ln|Court|Ct|Way|Place|Pl|Terrace|Ter|Circle|Cir|Parkway|Pkwy)\b\.?`)
+	budgetPhrasePattern = regexp.MustCompile(`(?i)\b(?:my|our) (?:budget|max(?:imum)?|limit|ceiling|walk[- ]away)\b|\b(?:most|max(?:imum)?) (?:I|we) can (?:spend|pay|afford|go)\b|\bcan(?:'t| ?not)? afford\b|\bwalk away (?:at|above)\b`)
+)
+
+// DraftGuardrailService checks drafts before they're sent to a seller
+type DraftGuardrailService struct {
+	db  *gorm.DB
+	llm llm.LLM
+}
+
+// NewDraftGuardrailService creates a draft guardrail service. Without an LLM, drafts aren't
+// checked for contradictions.
+func NewDraftGuardrailService(db *gorm.DB, llm llm.LLM) *DraftGuardrailService {
+	return &DraftGuardrailService{
+		db:  db,
+		llm: llm,
+	}
+}
+
+// CheckReply checks a draft before it's sent in answer to a message: the seller message being
+// replied to, or the agent draft being sent. Without content the agent draft's own is checked.
+func (s *DraftGuardrailService) CheckReply(ctx context.Context, userID, messageID uuid.UUID, content string) ([]DraftWarning, error) {
+	var message models.Message
+	if err := s.db.Where("id = ? AND user_id = ? AND deleted_at IS NULL", messageID, userID).First(&message).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, errors.New("message not found")
+		}
+		return nil, fmt.Errorf("database error: %w", err)
+	}
+
+	if strings.TrimSpace(content) == "" && message.Sender == models.SenderTypeAgent {
+		content = message.Content
+	}
+	return s.Check(ctx, userID, message.ThreadID, content)
+}
+
+// EnforceReply checks a draft like CheckReply and returns a *DraftBlockedError if it can't be
+// sent: it breaks a blocking guardrail, or it has warnings the user hasn't acknowledged
+func (s *DraftGuardrailService) EnforceReply(ctx context.Context, userID, messageID uuid.UUID, content string, acknowledged bool) error {
+	warnings, err := s.CheckReply(ctx, userID, messageID, content)
+	if err != nil {
+		return err
+	}
+	return enforceDraftWarnings(warnings, acknowledged)
+}
+
+// Check checks a draft to the seller of a thread. Outside a thread only personal data is
+// checked for.
+func (s *DraftGuardrailService) Check(ctx context.Context, userID uuid.UUID, threadID *uuid.UUID, content string) ([]DraftWarning, error) {
+	warnings := personalDataWarnings(content)
+	if threadID == nil {
+		return warnings, nil
+	}
+
+	var thread models.Thread
+	if err := s.db.Where("id = ? AND user_id = ?", *threadID, userID).First(&thread).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, errors.New("thread not found")
+		}
+		return nil, fmt.Errorf("database error: %w", err)
+	}
+
+	// The buyer's limits live in the thread's autopilot settings, whether or not it's on autopilot
+	var settings models.AutopilotSettings
+	if err := s.db.Where("thread_id = ?", thread.ID).First(&settings).Error; err != nil && !errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, fmt.Errorf("database error: %w", err)
+	}
+	warnings = append(warnings, disclosureWarnings(content, &settings)...)
+
+	competitors, err := s.competitors(userID, &thread)
+	if err != nil {
+		return nil, err
+	}
+	warnings = append(warnings, competitorWarnings(content, competitors)...)
+
+	// A failed contradiction check shouldn't stop the buyer from sending
+	contradictions, err := s.contradictions(ctx, userID, &thread, content)
+	if err != nil {
+		logLLMFailure(err, "check draft for contradictions in thread %s", thread.ID)
+	}
+	return append(warnings, contradictions...), nil
+}
+
+// competitors returns the names of the other sellers the buyer has offers from
+func (s *DraftGuardrailService) competitors(userID uuid.UUID, thread *models.Thread) ([]string, error) {
+	var names []string
+	if err := s.db.Model(&models.TrackedOffer{}).
+		Joins("JOIN threads ON threads.id = tracked_offers.thread_id").
+		Where("threads.user_id = ? AND threads.id <> ? AND threads.deleted_at IS NULL", userID, thread.ID).
+		Distinct().
+		Pluck("threads.seller_name", &names).Error; err != nil {
+		return nil, fmt.Errorf("database error: %w", err)
+	}
+
+	var competitors []string
+	for _, name := range names {
+		if !strings.EqualFold(strings.TrimSpace(name), strings.TrimSpace(thread.SellerName)) {
+			competitors = append(competitors, name)
+		}
+	}
+	return competitors, nil
+}
+
+// contradictions asks the LLM whether a draft contradicts what the buyer already told the
+// thread's seller
+func (s *DraftGuardrailService) contradictions(ctx context.Context, userID uuid.UUID, thread *models.Thread, content string) ([]DraftWarning, error) {
+	if s.llm == nil {
+		return nil, nil
+	}
+
+	// Only messages that reached the seller commit the buyer to anything
+	var sent []models.Message
+	if err := s.db.Where("thread_id = ? AND sender = ? AND external_message_id <> '' AND deleted_at IS NULL", thread.ID, models.SenderTypeUser).
+		Order("timestamp DESC").
+		Limit(20).
+		Find(&sent).Error; err != nil {
+		return nil, fmt.Errorf("database error: %w", err)
+	}
+	if len(sent) == 0 {
+		return nil, nil
+	}
+	for i, j := 0, len(sent)-1; i < j; i, j = i+1, j-1 {
+		sent[i], sent[j] = sent[j], sent[i]
+	}
+
+	var summary models.ThreadSummary
+	if err := s.db.Where("thread_id = ?", thread.ID).First(&summary).Error; err != nil && !errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, fmt.Errorf("database error: %w", err)
+	}
+
+	req := commitmentCheckRequest(thread.SellerName, summary.Content, sent, content)
+	req.UserID = userID.String()
+	response, err := s.llm.Complete(ctx, req)
+	if err != nil {
+		return nil, err
+	}
+	return ParseContradictions(response.Text)
+}
+
+// ParseContradictions parses the LLM's contradictions JSON into warnings
+func ParseContradictions(response string) ([]DraftWarning, error) {
+	var parsed struct {
+		Contradictions []struct {
+			Quote       string `json:"quote"`
+			Earlier     string `json:"earlier"`
+			Explanation string `json:"explanation"`
+		} `json:"contradictions"`
+	}
+	if err := llm.DecodeJSON(response, &parsed); err != nil {
+		return nil, err
+	}
+
+	var warnings []DraftWarning
+	for _, c := range parsed.Contradictions {
+		explanation := strings.TrimSpace(c.Explanation)
+		if explanation == "" {
+			continue
+		}
+		if earlier := strings.TrimSpace(c.Earlier); earlier != "" {
+			explanation += fmt.Sprintf(" Earlier you said: %q", earlier)
+		}
+		warnings = append(warnings, DraftWarning{
+			Kind:     DraftWarningContradiction,
+			Severity: DraftSeverityWarn,
+			Message:  explanation,
+			Excerpt:  strings.TrimSpace(c.Quote),
+		})
+	}
+	return warnings, nil
+}
+
+// enforceDraftWarnings returns a *DraftBlockedError if the warnings stop a draft from being sent
+func enforceDraftWarnings(warnings []DraftWarning, acknowledged bool) error {
+	for _, warning := range warnings {
+		if warning.Severity == DraftSeverityBlock || !acknowledged {
+			return &DraftBlockedError{Warnings: warnings}
+		}
+	}
+	return nil
+}
+
+// personalDataWarnings finds personal data a seller doesn't need in writing
+func personalDataWarnings(content string) []DraftWarning {
+	var warnings []DraftWarning
+	if match := ssnPattern.FindString(content); match != "" {
+		warnings = append(warnings, DraftWarning{
+			Kind:     DraftWarningPersonalData,
+			Severity: DraftSeverityBlock,
+			Message:  "The draft includes what looks like a Social Security number. Give it to the dealer's finance office in person, never by email or text.",
+			Excerpt:  match,
+		})
+	}
+	if match := birthDatePattern.FindString(content); match != "" {
+		warnings = append(warnings, DraftWarning{
+			Kind:     DraftWarningPersonalData,
+			Severity: DraftSeverityBlock,
+			Message:  "The draft includes a date of birth.",
+			Excerpt:  match,
+		})
+	}
+	if match := streetAddrPattern.FindString(content); match != "" {
+		warnings = append(warnings, DraftWarning{
+			Kind:     DraftWarningPersonalData,
+			Severity: DraftSeverityWarn,
+			Message:  "The draft includes a street address. Sellers don't need your address to quote a price.",
+			Excerpt:  match,
+		})
+	}
+	return warnings
+}
+
+// disclosureWarnings finds what the buyer's guardrails say never to tell a seller: their target
+// or walk-away price, talk of their budget and never-disclose items. Amounts above the
+// walk-away price are flagged too.
+func disclosureWarnings(content string, settings *models.AutopilotSettings) []DraftWarning {
+	var warnings []DraftWarning
+
+	lower := strings.ToLower(content)
+	for _, item := range neverDiscloseItems(settings.NeverDisclose) {
+		if strings.Contains(lower, strings.ToLower(item)) {
+			warnings = append(warnings, DraftWarning{
+				Kind:     DraftWarningNeverDisclose,
+				Severity: DraftSeverityBlock,
+				Message:  fmt.Sprintf("The draft mentions %q, which you asked never to disclose.", item),
+				Excerpt:  item,
+			})
+		}
+	}
+
+	// Naming the target or walk-away price gives it away. Larger amounts may just repeat the
+	// seller's price, so they only warn.
+	revealed := false
+	for _, match := range dollarAmountPattern.FindAllString(content, -1) {
+		for _, amount := range dollarAmounts(match) {
+			if matchesPrice(amount, settings.WalkAwayPrice) || matchesPrice(amount, settings.TargetPrice) {
+				revealed = true
+			}
+		}
+		if revealed {
+			warnings = append(warnings, DraftWarning{
+				Kind:     DraftWarningBudget,
+				Severity: DraftSeverityBlock,
+				Message:  "The draft gives away your target or walk-away price.",
+				Excerpt:  match,
+			})
+			break
+		}
+	}
+	if settings.WalkAwayPrice != nil {
+		for _, match := range dollarAmountPattern.FindAllString(content, -1) {
+			amounts := dollarAmounts(match)
+			if len(amounts) == 1 && amounts[0] > *settings.WalkAwayPrice {
+				warnings = append(warnings, DraftWarning{
+					Kind:     DraftWarningWalkAway,
+					Severity: DraftSeverityWarn,
+					Message:  fmt.Sprintf("The draft mentions %s, above your walk-away price of $%s. Make sure it doesn't read as an offer.", match, formatDollars(*settings.WalkAwayPrice)),
+					Excerpt:  match,
+				})
+				break
+			}
+		}
+	}
+
+	// Talking about a limit with a number in the same sentence gives the number away
+	for _, sentence := range draftSentences(content) {
+		if revealed {
+			break
+		}
+		if !budgetPhrasePattern.MatchString(sentence) || !dollarAmountPattern.MatchString(sentence) {
+			continue
+		}
+		warnings = append(warnings, DraftWarning{
+			Kind:     DraftWarningBudget,
+			Severity: DraftSeverityWarn,
+			Message:  "The draft tells the seller what you're able to spend. Sellers rarely come down past a number the buyer has named.",
+			Excerpt:  strings.TrimSpace(sentence),
+		})
+		break
+	}
+
+	return warnings
+}
+
+// competitorWarnings finds other sellers the buyer has offers from named in a draft
+func competitorWarnings(content string, competitors []string) []DraftWarning {
+	var warnings []DraftWarning
+	for _, name := range competitors {
+		name = strings.TrimSpace(name)
+		if len(name) < 3 {
+			continue
+		}
+		pattern, err := regexp.Compile(`(?i)\b` + regexp.QuoteMeta(name) + `\b`)
+		if err != nil || !pattern.MatchString(content) {
+			continue
+		}
+		warnings = append(warnings, DraftWarning{
+			Kind:     DraftWarningCompetitor,
+			Severity: DraftSeverityWarn,
+			Message:  fmt.Sprintf("The draft names %s, another seller you have an offer from. Sellers can use that to check or undercut the offer.", name),
+			Excerpt:  pattern.FindString(content),
+		})
+	}
+	return warnings
+}
+
+// matchesPrice reports whether amount is price, to the dollar
+func matchesPrice(amount float64, price *float64) bool {
+	return price != nil && amount >= *price-0.5 && amount <= *price+0.5
+}
+
+// draftSentences splits a draft into sentences and lines
+func draftSentences(content string) []string {
+	var sentences []string
+	start := 0
+	for i, r := range content {
+		if r != '\n' && r != '!' && r != '?' && r != '.' {
+			continue
+		}
+		// Decimal points and thousands separators don't end a sentence
+		if r == '.' && i+1 < len(content) && content[i+1] >= '0' && content[i+1] <= '9' {
+			continue
+		}
+		if sentence := strings.TrimSpace(content[start : i+1]); sentence != "" {
+			sentences = append(sentences, sentence)
+		}
+		start = i + 1
+	}
+	if sentence := strings.TrimSpace(content[start:]); sentence != "" {
+		sentences = append(sentences, sentence)
+	}
+	return sentences
+}
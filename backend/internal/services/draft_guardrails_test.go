@@ -0,0 +1,140 @@
+package services
+
+import (
+	"errors"
+	"testing"
+
+	"carbuyer/internal/db/models"
+)
+
+func TestPersonalDataWarnings(t *testing.T) {
+	tests := []struct {
+		name         string
+		content      string
+		wantSeverity []DraftWarningSeverity
+	}{
+		{"clean", "Can you do $36,500 out the door? I can come in Saturday at 10.", nil},
+		{"ssn", "For the credit app my SSN is 123-45-6789.", []DraftWarningSeverity{DraftSeverityBlock}},
+		{"ssn without dashes", "Social security number: 123456789", []DraftWarningSeverity{DraftSeverityBlock}},
+		{"date of birth", "My date of birth is 04/12/1987.", []DraftWarningSeverity{DraftSeverityBlock}},
+		{"street address", "You can deliver it to 42 Maple Grove Ln, Springfield.", []DraftWarningSeverity{DraftSeverityWarn}},
+		{"phone number", "Call me at 555-123-4567.", nil},
+		{"model year", "Is the 2025 Ford Maverick Lariat still available?", nil},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := personalDataWarnings(tt.content)
+			if len(got) != len(tt.wantSeverity) {
+				t.Fatalf("personalDataWarnings() = %+v, want %d warnings", got, len(tt.wantSeverity))
+			}
+			for i, warning := range got {
+				if warning.Kind != DraftWarningPersonalData || warning.Severity != tt.wantSeverity[i] {
+					t.Errorf("warning %d = %+v, want %s personal data", i, warning, tt.wantSeverity[i])
+				}
+				if warning.Excerpt == "" {
+					t.Errorf("warning %d has no excerpt", i)
+				}
+			}
+		})
+	}
+}
+
+func TestDisclosureWarnings(t *testing.T) {
+	target, walkAway := 35000.0, 38000.0
+	settings := &models.AutopilotSettings{
+		TargetPrice:   &target,
+		WalkAwayPrice: &walkAway,
+		NeverDisclose: "trade-in\npre-approved",
+	}
+
+	tests := []struct {
+		name    string
+		content string
+		want    map[DraftWarningKind]DraftWarningSeverity
+	}{
+		{"counteroffer", "Thanks for the quote. Can you do $36,500 out the door?", nil},
+		{"above walk-away", "Ok, I can go to $38,500.", map[DraftWarningKind]DraftWarningSeverity{DraftWarningWalkAway: DraftSeverityWarn}},
+		{"repeats the seller's price", "Your $45,000 quote is too high.", map[DraftWarningKind]DraftWarningSeverity{DraftWarningWalkAway: DraftSeverityWarn}},
+		{"names the walk-away price", "Honestly my max is $38,000. Can you work with that?", map[DraftWarningKind]DraftWarningSeverity{DraftWarningBudget: DraftSeverityBlock}},
+		{"names the target price", "Could you do $35,000?", map[DraftWarningKind]DraftWarningSeverity{DraftWarningBudget: DraftSeverityBlock}},
+		{"talks about a budget", "My budget is $37,250 all in.", map[DraftWarningKind]DraftWarningSeverity{DraftWarningBudget: DraftSeverityWarn}},
+		{"budget without a number", "That's more than my budget allows.", nil},
+		{"never disclose", "I'm Pre-Approved with my credit union.", map[DraftWarningKind]DraftWarningSeverity{DraftWarningNeverDisclose: DraftSeverityBlock}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := disclosureWarnings(tt.content, settings)
+			if len(got) != len(tt.want) {
+				t.Fatalf("disclosureWarnings() = %+v, want %v", got, tt.want)
+			}
+			for _, warning := range got {
+				if severity, ok := tt.want[warning.Kind]; !ok || severity != warning.Severity {
+					t.Errorf("unexpected warning %+v", warning)
+				}
+			}
+		})
+	}
+
+	if got := disclosureWarnings("I can go to $45,000.", &models.AutopilotSettings{}); len(got) != 0 {
+		t.Errorf("disclosureWarnings() without settings = %+v", got)
+	}
+}
+
+func TestCompetitorWarnings(t *testing.T) {
+	competitors := []string{"Metro Ford", "AB", "Lakeside Motors"}
+
+	got := competitorWarnings("Metro ford quoted me $36,000, can you beat it?", competitors)
+	if len(got) != 1 || got[0].Kind != DraftWarningCompetitor || got[0].Excerpt != "Metro ford" {
+		t.Errorf("competitorWarnings() = %+v", got)
+	}
+
+	// Short names and partial words aren't matches
+	if got := competitorWarnings("Can you do $36,000 ABS included? I saw one at Lakeside Motorsport.", competitors); len(got) != 0 {
+		t.Errorf("competitorWarnings() = %+v, want none", got)
+	}
+}
+
+func TestParseContradictions(t *testing.T) {
+	got, err := ParseContradictions("```json\n" + `{"contradictions": [{"quote": "I'll be financing through you", "earlier": "I'm paying cash", "explanation": "The draft says financing, but the buyer said cash."}, {"quote": "x", "explanation": ""}]}` + "\n```")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(got) != 1 {
+		t.Fatalf("ParseContradictions() = %+v, want 1 warning", got)
+	}
+	if got[0].Kind != DraftWarningContradiction || got[0].Severity != DraftSeverityWarn || got[0].Excerpt != "I'll be financing through you" {
+		t.Errorf("warning = %+v", got[0])
+	}
+	if got[0].Message != `The draft says financing, but the buyer said cash. Earlier you said: "I'm paying cash"` {
+		t.Errorf("Message = %q", got[0].Message)
+	}
+
+	if got, err := ParseContradictions(`{"contradictions": []}`); err != nil || len(got) != 0 {
+		t.Errorf("ParseContradictions(none) = %+v, %v", got, err)
+	}
+	if _, err := ParseContradictions("No contradictions."); err == nil {
+		t.Error("ParseContradictions() without JSON should fail")
+	}
+}
+
+func TestEnforceDraftWarnings(t *testing.T) {
+	warn := DraftWarning{Kind: DraftWarningCompetitor, Severity: DraftSeverityWarn}
+	block := DraftWarning{Kind: DraftWarningPersonalData, Severity: DraftSeverityBlock}
+
+	if err := enforceDraftWarnings(nil, false); err != nil {
+		t.Errorf("no warnings: %v", err)
+	}
+	if err := enforceDraftWarnings([]DraftWarning{warn}, true); err != nil {
+		t.Errorf("acknowledged warning: %v", err)
+	}
+
+	var blocked *DraftBlockedError
+	if err := enforceDraftWarnings([]DraftWarning{warn}, false); !errors.As(err, &blocked) || len(blocked.Warnings) != 1 {
+		t.Errorf("unacknowledged warning: %v", err)
+	}
+	if err := enforceDraftWarnings([]DraftWarning{warn, block}, true); !errors.As(err, &blocked) || len(blocked.Warnings) != 2 {
+		t.Errorf("acknowledged block: %v", err)
+	}
+}
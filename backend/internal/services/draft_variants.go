@@ -0,0 +1,321 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"strings"
+	"time"
+
+	"carbuyer/internal/db/models"
+	"carbuyer/internal/llm"
+
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+)
+
+// maxDraftVariants is the most drafts the agent offers for one reply
+const maxDraftVariants = 4
+
+// errTooManyVariants is returned for requests for more draft variants than the agent offers
+var errTooManyVariants = fmt.Errorf("variants must be between 0 and %d", maxDraftVariants)
+
+// ParseDraftVariants parses the LLM's ranked drafts JSON, best first. At most n are kept, and
+// drafts without content are dropped.
+func ParseDraftVariants(response string, n int) ([]models.DraftVariant, error) {
+	var parsed struct {
+		Variants []struct {
+			Style     string `json:"style"`
+			Rationale string `json:"rationale"`
+			Content   string `json:"content"`
+		} `json:"variants"`
+	}
+	if err := llm.DecodeJSON(response, &parsed); err != nil {
+		return nil, err
+	}
+
+	var variants []models.DraftVariant
+	for _, v := range parsed.Variants {
+		content := stripDraftPreamble(v.Content)
+		if content == "" {
+			continue
+		}
+		// The column holds 40 characters
+		style := []rune(strings.ToLower(strings.TrimSpace(v.Style)))
+		if len(style) > 40 {
+			style = style[:40]
+		}
+		variants = append(variants, models.DraftVariant{
+			Rank:      len(variants) + 1,
+			Style:     string(style),
+			Rationale: strings.TrimSpace(v.Rationale),
+			Content:   content,
+		})
+		if len(variants) == n {
+			break
+		}
+	}
+	if len(variants) == 0 {
+		return nil, errors.New("no draft variants in response")
+	}
+	return variants, nil
+}
+
+// generateReply runs a negotiation request and returns the unsaved agent message. With
+// variants above 1 it asks for that many ranked drafts; the message shows the best one and
+// carries them all. If the drafts can't be parsed, a single reply is asked for instead.
+func (s *MessageService) generateReply(ctx context.Context, req llm.Request, prompt *Prompt, threadID, userID uuid.UUID, variants int) (*models.Message, error) {
+	message := &models.Message{
+		UserID:           userID,
+		ThreadID:         &threadID,
+		Sender:           models.SenderTypeAgent,
+		Timestamp:        time.Now(),
+		PromptTemplateID: prompt.TemplateID,
+		PromptVersion:    prompt.Version,
+	}
+
+	if variants > 1 {
+		response, err := completeWithTools(ctx, s.llm, withDraftVariants(req, variants), newNegotiationToolbox(s.db, userID, threadID), nil)
+		if err != nil {
+			return nil, err
+		}
+
+		drafts, err := ParseDraftVariants(response.Text, variants)
+		if err == nil {
+			for i := range drafts {
+				drafts[i].UserID = userID
+			}
+			drafts[0].Chosen = true
+			message.Content = drafts[0].Content
+			message.Variants = drafts
+			return message, nil
+		}
+		log.Printf("Failed to parse draft variants for thread %s, asking for a single reply: %v", threadID, err)
+	}
+
+	response, err := completeWithTools(ctx, s.llm, req, newNegotiationToolbox(s.db, userID, threadID), nil)
+	if err != nil {
+		return nil, err
+	}
+	message.Content = stripDraftPreamble(response.Text)
+	return message, nil
+}
+
+// RegenerateReply replaces the agent's reply to the user's last message with a new one, so
+// asking again doesn't add turns to the thread. The replaced draft is recorded as a preference
+// signal.
+func (s *MessageService) RegenerateReply(ctx context.Context, threadID, userID uuid.UUID, variants int) (*models.Message, error) {
+	if variants < 0 || variants > maxDraftVariants {
+		return nil, errTooManyVariants
+	}
+
+	// The thread's last two messages must be the user's message and the agent's reply to it
+	var last []models.Message
+	if err := s.db.Where("thread_id = ? AND user_id = ? AND deleted_at IS NULL", threadID, userID).
+		Order("timestamp DESC").
+		Limit(2).
+		Find(&last).Error; err != nil {
+		return nil, fmt.Errorf("database error: %w", err)
+	}
+	if len(last) < 2 || last[0].Sender != models.SenderTypeAgent ||
+		last[1].Sender != models.SenderTypeUser || last[1].ExternalMessageID != "" {
+		return nil, errors.New("the last message isn't the agent's reply to your message")
+	}
+	agentMessage, userMessage := last[0], last[1]
+
+	negotiation, err := loadNegotiationContext(s.db, threadID, userID, userMessage.Content)
+	if err != nil {
+		return nil, err
+	}
+	// Leave out the message being answered and the reply being replaced
+	history := negotiation.history[:0]
+	for _, msg := range negotiation.history {
+		if msg.Timestamp.Before(userMessage.Timestamp) {
+			history = append(history, msg)
+		}
+	}
+	negotiation.history = history
+
+	prompt, err := s.prompts.Prompt(models.LLMPurposeNegotiation, userID)
+	if err != nil {
+		return nil, err
+	}
+	req, err := negotiation.request(prompt, userMessage.Content)
+	if err != nil {
+		return nil, err
+	}
+
+	reply, err := s.generateReply(ctx, req, prompt, threadID, userID, variants)
+	if err != nil {
+		return nil, fmt.Errorf("failed to generate agent response: %w", err)
+	}
+
+	signal, err := s.draftSignal(&agentMessage, models.DraftSignalRegenerated, "")
+	if err != nil {
+		return nil, err
+	}
+
+	err = s.db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Create(signal).Error; err != nil {
+			return fmt.Errorf("failed to record preference signal: %w", err)
+		}
+		if err := tx.Where("message_id = ?", agentMessage.ID).Delete(&models.DraftVariant{}).Error; err != nil {
+			return fmt.Errorf("failed to delete draft variants: %w", err)
+		}
+
+		agentMessage.Content = reply.Content
+		agentMessage.PromptTemplateID = reply.PromptTemplateID
+		agentMessage.PromptVersion = reply.PromptVersion
+		if err := tx.Model(&agentMessage).Updates(map[string]interface{}{
+			"content":            agentMessage.Content,
+			"prompt_template_id": agentMessage.PromptTemplateID,
+			"prompt_version":     agentMessage.PromptVersion,
+		}).Error; err != nil {
+			return fmt.Errorf("failed to update agent message: %w", err)
+		}
+
+		agentMessage.Variants = reply.Variants
+		for i := range agentMessage.Variants {
+			agentMessage.Variants[i].MessageID = agentMessage.ID
+		}
+		if len(agentMessage.Variants) > 0 {
+			if err := tx.Create(&agentMessage.Variants).Error; err != nil {
+				return fmt.Errorf("failed to create draft variants: %w", err)
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return &agentMessage, nil
+}
+
+// ChooseDraftVariant shows one of an agent message's draft variants in the message, and records
+// the choice as a preference signal
+func (s *MessageService) ChooseDraftVariant(messageID, variantID, userID uuid.UUID) (*models.Message, error) {
+	message, err := s.agentDraft(messageID, userID)
+	if err != nil {
+		return nil, err
+	}
+
+	var chosen *models.DraftVariant
+	for i := range message.Variants {
+		if message.Variants[i].ID == variantID {
+			chosen = &message.Variants[i]
+		}
+	}
+	if chosen == nil {
+		return nil, errors.New("draft variant not found")
+	}
+
+	signal, err := s.draftSignal(message, models.DraftSignalChosen, chosen.Content)
+	if err != nil {
+		return nil, err
+	}
+	signal.Style = chosen.Style
+	signal.Rank = chosen.Rank
+
+	err = s.db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Create(signal).Error; err != nil {
+			return fmt.Errorf("failed to record preference signal: %w", err)
+		}
+		if err := tx.Model(&models.DraftVariant{}).Where("message_id = ?", message.ID).
+			Update("chosen", gorm.Expr("id = ?", chosen.ID)).Error; err != nil {
+			return fmt.Errorf("failed to update draft variants: %w", err)
+		}
+		if err := tx.Model(message).Update("content", chosen.Content).Error; err != nil {
+			return fmt.Errorf("failed to update agent message: %w", err)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	for i := range message.Variants {
+		message.Variants[i].Chosen = message.Variants[i].ID == chosen.ID
+	}
+	message.Content = chosen.Content
+	return message, nil
+}
+
+// EditDraft replaces the content of an agent message with the user's edit, and records the
+// edit as a preference signal
+func (s *MessageService) EditDraft(messageID, userID uuid.UUID, content string) (*models.Message, error) {
+	content = strings.TrimSpace(content)
+	if content == "" {
+		return nil, errors.New("message content is required")
+	}
+
+	message, err := s.agentDraft(messageID, userID)
+	if err != nil {
+		return nil, err
+	}
+	if content == message.Content {
+		return message, nil
+	}
+
+	signal, err := s.draftSignal(message, models.DraftSignalEdited, content)
+	if err != nil {
+		return nil, err
+	}
+
+	err = s.db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Create(signal).Error; err != nil {
+			return fmt.Errorf("failed to record preference signal: %w", err)
+		}
+		if err := tx.Model(message).Update("content", content).Error; err != nil {
+			return fmt.Errorf("failed to update agent message: %w", err)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	message.Content = content
+	return message, nil
+}
+
+// agentDraft loads one of the user's agent messages in a seller thread, with its variants
+func (s *MessageService) agentDraft(messageID, userID uuid.UUID) (*models.Message, error) {
+	var message models.Message
+	if err := s.db.Joins("JOIN threads ON threads.id = messages.thread_id").
+		Where("messages.id = ? AND messages.user_id = ? AND messages.sender = ? AND messages.deleted_at IS NULL", messageID, userID, models.SenderTypeAgent).
+		Where("threads.type = ?", models.ThreadTypeSeller).
+		Preload("Variants", func(db *gorm.DB) *gorm.DB { return db.Order("rank ASC") }).
+		First(&message).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, errors.New("message not found")
+		}
+		return nil, fmt.Errorf("database error: %w", err)
+	}
+	return &message, nil
+}
+
+// draftSignal builds a preference signal for what the user did with an agent message's
+// current draft. The style and rank of the variant it shows, if any, are included.
+func (s *MessageService) draftSignal(message *models.Message, kind models.DraftSignalKind, revised string) (*models.DraftPreferenceSignal, error) {
+	signal := &models.DraftPreferenceSignal{
+		UserID:    message.UserID,
+		ThreadID:  *message.ThreadID,
+		MessageID: message.ID,
+		Kind:      kind,
+		Original:  message.Content,
+		Revised:   revised,
+	}
+
+	var shown models.DraftVariant
+	err := s.db.Where("message_id = ? AND chosen = ?", message.ID, true).First(&shown).Error
+	switch {
+	case err == nil:
+		signal.Style = shown.Style
+		signal.Rank = shown.Rank
+	case !errors.Is(err, gorm.ErrRecordNotFound):
+		return nil, fmt.Errorf("database error: %w", err)
+	}
+	return signal, nil
+}
@@ -0,0 +1,134 @@
+package services
+
+import (
+	"context"
+	"strings"
+	"testing"
+
+	"carbuyer/internal/llm"
+
+	"github.com/google/uuid"
+)
+
+func TestParseDraftVariants(t *testing.T) {
+	tests := []struct {
+		name      string
+		response  string
+		n         int
+		wantStyle []string
+		wantFirst string
+		wantErr   bool
+	}{
+		{
+			name:      "ranked drafts",
+			response:  `{"variants": [{"style": "Firm", "rationale": "They have room.", "content": "I can do $36,500 out the door."}, {"style": "friendly", "rationale": "Keeps it warm.", "content": "Thanks! Could you get to $36,500?"}]}`,
+			n:         2,
+			wantStyle: []string{"firm", "friendly"},
+			wantFirst: "I can do $36,500 out the door.",
+		},
+		{
+			name:      "code fences and preambles",
+			response:  "```json\n" + `{"variants": [{"style": "short", "content": "Here's a draft: $36,500?"}]}` + "\n```",
+			n:         2,
+			wantStyle: []string{"short"},
+			wantFirst: "$36,500?",
+		},
+		{
+			name:      "drops empty drafts and keeps at most n",
+			response:  `{"variants": [{"style": "firm", "content": " "}, {"style": "short", "content": "$36,500?"}, {"style": "friendly", "content": "Thanks!"}, {"style": "firm", "content": "No."}]}`,
+			n:         2,
+			wantStyle: []string{"short", "friendly"},
+			wantFirst: "$36,500?",
+		},
+		{
+			name:      "long styles are cut between characters",
+			response:  `{"variants": [{"style": "` + strings.Repeat("é", 45) + `", "content": "$36,500?"}]}`,
+			n:         2,
+			wantStyle: []string{strings.Repeat("é", 40)},
+			wantFirst: "$36,500?",
+		},
+		{
+			name:     "no drafts",
+			response: `{"variants": []}`,
+			n:        2,
+			wantErr:  true,
+		},
+		{
+			name:     "not JSON",
+			response: "Thanks! Could you get to $36,500?",
+			n:        2,
+			wantErr:  true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := ParseDraftVariants(tt.response, tt.n)
+			if tt.wantErr {
+				if err == nil {
+					t.Errorf("ParseDraftVariants() = %+v, want error", got)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("ParseDraftVariants() error = %v", err)
+			}
+			if len(got) != len(tt.wantStyle) {
+				t.Fatalf("got %d variants, want %d", len(got), len(tt.wantStyle))
+			}
+			for i, variant := range got {
+				if variant.Rank != i+1 {
+					t.Errorf("variant %d Rank = %d", i, variant.Rank)
+				}
+				if variant.Style != tt.wantStyle[i] {
+					t.Errorf("variant %d Style = %q, want %q", i, variant.Style, tt.wantStyle[i])
+				}
+			}
+			if got[0].Content != tt.wantFirst {
+				t.Errorf("first Content = %q, want %q", got[0].Content, tt.wantFirst)
+			}
+		})
+	}
+}
+
+func TestWithDraftVariants(t *testing.T) {
+	req := llm.Request{
+		MaxTokens: 1024,
+		Messages:  []llm.Message{llm.UserMessage(llm.Text("Can you do $36,000?"))},
+	}
+
+	got := withDraftVariants(req, 3)
+
+	if got.MaxTokens != 3072 {
+		t.Errorf("MaxTokens = %d, want 3072", got.MaxTokens)
+	}
+	last := got.Messages[len(got.Messages)-1]
+	if len(last.Parts) != 2 || !strings.Contains(last.Parts[1].Text, "write 3 alternative responses") {
+		t.Errorf("last message parts = %+v", last.Parts)
+	}
+	if len(req.Messages[0].Parts) != 1 {
+		t.Error("withDraftVariants() changed the original request")
+	}
+}
+
+func TestGenerateReplyFallsBackToASingleReply(t *testing.T) {
+	fake := llm.NewFake(
+		`{"variants": [{"style": "firm", "content": ""}]}`,
+		"Here's a draft: Could you do $36,500 out the door?",
+	)
+	s := &MessageService{llm: fake}
+	req := llm.Request{Messages: []llm.Message{llm.UserMessage(llm.Text("Counter at $36,500"))}}
+
+	message, err := s.generateReply(context.Background(), req, &Prompt{Version: 1}, uuid.New(), uuid.New(), 3)
+	if err != nil {
+		t.Fatalf("generateReply() error = %v", err)
+	}
+	if message.Content != "Could you do $36,500 out the door?" || len(message.Variants) != 0 {
+		t.Errorf("message = %q with %d variants", message.Content, len(message.Variants))
+	}
+
+	requests := fake.Requests()
+	if len(requests) != 2 || len(requests[1].Messages[0].Parts) != 1 {
+		t.Errorf("the fallback request should be the single-reply request: %+v", requests)
+	}
+}
@@ -1,12 +1,16 @@
 package services
 
 import (
+	"errors"
 	"fmt"
+	"log"
 	"regexp"
 	"strings"
 	"time"
 
 	"carbuyer/internal/db/models"
+	"carbuyer/internal/emailbody"
+	"carbuyer/internal/inbound"
 
 	"github.com/google/uuid"
 	"gorm.io/gorm"
@@ -17,27 +21,69 @@ type EmailService struct {
 	mailgunAPIKey string
 	mailgunDomain string
 	gmailService  *GmailService
+	threadMatcher *ThreadMatcher
+	classifier    *EmailClassifier
 }
 
-func NewEmailService(db *gorm.DB, mailgunAPIKey, mailgunDomain string, gmailService *GmailService) *EmailService {
+func NewEmailService(db *gorm.DB, mailgunAPIKey, mailgunDomain string, gmailService *GmailService, classifier *EmailClassifier) *EmailService {
 	return &EmailService{
 		db:            db,
 		mailgunAPIKey: mailgunAPIKey,
 		mailgunDomain: mailgunDomain,
 		gmailService:  gmailService,
+		threadMatcher: NewThreadMatcher(),
+		classifier:    classifier,
 	}
 }
 
-// ProcessInboundEmail creates an inbox message from a forwarded email
-func (s *EmailService) ProcessInboundEmail(userID uuid.UUID, from, subject, body, messageID string) (*models.Message, error) {
-	// Parse and clean email body
-	cleanedBody := s.cleanEmailBody(body)
+// ResolveInboundRecipient finds the user an inbound address belongs to and, for per-thread
+// plus-addresses, the thread it was tagged with
+func (s *EmailService) ResolveInboundRecipient(recipient string) (*models.User, *uuid.UUID, error) {
+	parsed, err := ParseInboundRecipient(recipient)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	// The local part is either the user's UUID or their friendly alias
+	var user models.User
+	query := s.db.Where("inbox_alias = ?", parsed.LocalPart)
+	if userID, err := uuid.Parse(parsed.LocalPart); err == nil {
+		query = s.db.Where("id = ?", userID)
+	}
+	if err := query.First(&user).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, nil, errors.New("user not found")
+		}
+		return nil, nil, fmt.Errorf("database error: %w", err)
+	}
+
+	if !IsThreadTag(parsed.Tag) {
+		return &user, nil, nil
+	}
+
+	// An unknown, ambiguous or archived tag falls back to normal thread matching
+	var threads []models.Thread
+	if err := s.db.Where("user_id = ? AND deleted_at IS NULL AND CAST(id AS TEXT) LIKE ?", user.ID, escapeLike(parsed.Tag)+"%").
+		Limit(2).
+		Find(&threads).Error; err != nil || len(threads) != 1 {
+		return &user, nil, nil
+	}
+
+	return &user, &threads[0].ID, nil
+}
+
+// ProcessInboundEmail creates a message from a forwarded email. Messages sent to a thread's
+// reply-to alias go straight to that thread; otherwise they are routed when the matcher is
+// confident and left in the inbox with a suggested thread when it isn't.
+func (s *EmailService) ProcessInboundEmail(userID uuid.UUID, threadID *uuid.UUID, email *inbound.Email) (*models.Message, error) {
+	// Strip quoted replies, signatures and footers, keeping the raw body alongside
+	cleanedBody, rawBody, plainBody := inboundBodies(email)
 
 	fmt.Printf("Cleaned body: %s", cleanedBody)
 
 	// Try to extract original sender from forwarded email body
-	originalSender := s.extractOriginalSenderFromBody(body)
-	senderEmail := from
+	originalSender := s.extractOriginalSenderFromBody(plainBody)
+	senderEmail := email.From
 	if originalSender != "" {
 		senderEmail = originalSender
 	}
@@ -50,30 +96,170 @@ func (s *EmailService) ProcessInboundEmail(userID uuid.UUID, from, subject, body
 		ThreadID:          nil, // Unassigned - goes to inbox
 		Sender:            models.SenderTypeSeller,
 		Content:           cleanedBody,
+		RawContent:        rawBody,
 		Timestamp:         time.Now(),
 		SenderEmail:       senderEmail,
-		ExternalMessageID: messageID,
-		Subject:           subject,
+		ExternalMessageID: email.MessageID,
+		Subject:           email.Subject,
 		SentViaEmail:      true,
 	}
 
 	// Check for duplicate based on external_message_id
-	if messageID != "" {
+	if email.MessageID != "" {
 		var existingMessage models.Message
-		if err := s.db.Where("external_message_id = ?", messageID).First(&existingMessage).Error; err == nil {
+		if err := s.db.Where("external_message_id = ?", email.MessageID).First(&existingMessage).Error; err == nil {
 			// Message already exists, return it
 			return &existingMessage, nil
 		}
 	}
 
-	// Save message to database
-	if err := s.db.Create(message).Error; err != nil {
-		return nil, fmt.Errorf("failed to create inbox message: %w", err)
+	// Sort out auto-replies, marketing and spam so they stay out of the default inbox
+	classification := s.classifyInbound(userID, senderEmail, email, cleanedBody)
+	message.Category = classification.Category
+	message.CategorySource = classification.Source
+	message.CategoryReason = classification.Reason
+
+	// Try to route the message to an existing thread
+	var match *ThreadMatch
+	var err error
+	if threadID != nil {
+		match = &ThreadMatch{ThreadID: *threadID, Confidence: 1, Signal: ThreadMatchSignalReplyAlias}
+	} else {
+		match, err = s.matchThread(userID, InboundMatchInput{
+			From:       senderEmail,
+			Subject:    email.Subject,
+			InReplyTo:  email.InReplyTo,
+			References: ParseMessageIDList(email.References),
+		})
+		if err != nil {
+			// Matching is best effort - the message still lands in the inbox
+			log.Printf("Thread matching failed: %v", err)
+		}
+	}
+
+	if match != nil {
+		confidence := match.Confidence
+		message.MatchConfidence = &confidence
+		message.MatchSignal = string(match.Signal)
+		// Only human replies join a thread automatically - the rest keep the thread as a suggestion
+		if match.AutoAssign() && message.Category == models.MessageCategoryHuman {
+			message.ThreadID = &match.ThreadID
+		} else {
+			message.SuggestedThreadID = &match.ThreadID
+		}
+	}
+
+	// Save message and update thread stats if it was routed
+	err = s.db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Create(message).Error; err != nil {
+			return fmt.Errorf("failed to create inbox message: %w", err)
+		}
+
+		if message.ThreadID != nil {
+			if err := tx.Model(&models.Thread{}).Where("id = ?", *message.ThreadID).Updates(map[string]interface{}{
+				"message_count":   gorm.Expr("message_count + ?", 1),
+				"last_message_at": message.Timestamp,
+			}).Error; err != nil {
+				return fmt.Errorf("failed to update thread: %w", err)
+			}
+		}
+
+		return nil
+	})
+	if err != nil {
+		return nil, err
 	}
 
 	return message, nil
 }
 
+// inboundBodies returns an email's body with quoted replies, signatures and footers stripped,
+// the raw body to keep alongside it, and the raw body as plain text
+func inboundBodies(email *inbound.Email) (cleaned, raw, plain string) {
+	cleaned = emailbody.Clean(email.TextBody, email.HTMLBody)
+	raw = email.TextBody
+	plain = email.TextBody
+	if strings.TrimSpace(raw) == "" {
+		raw = email.HTMLBody
+		plain = emailbody.HTMLToText(email.HTMLBody)
+	}
+	return cleaned, raw, plain
+}
+
+// classifyInbound classifies an inbound email. The user's own correction of an earlier email
+// from the same sender takes precedence over the classifier.
+func (s *EmailService) classifyInbound(userID uuid.UUID, senderEmail string, email *inbound.Email, body string) EmailClassification {
+	var corrected models.Message
+	err := s.db.Select("category").
+		Where("user_id = ? AND sender_email = ? AND category_source = ?", userID, senderEmail, models.MessageCategorySourceUser).
+		Order("timestamp DESC").
+		First(&corrected).Error
+	if err == nil {
+		return EmailClassification{
+			Category:   corrected.Category,
+			Source:     models.MessageCategorySourceSender,
+			Confidence: 1,
+			Reason:     "you recategorized an earlier email from this sender",
+		}
+	}
+
+	return s.classifier.Classify(userID, email, body)
+}
+
+// matchThread loads the user's active threads with their known seller contacts and runs the matcher
+func (s *EmailService) matchThread(userID uuid.UUID, input InboundMatchInput) (*ThreadMatch, error) {
+	var threads []models.Thread
+	if err := s.db.Where("user_id = ? AND type = ? AND deleted_at IS NULL", userID, models.ThreadTypeSeller).Find(&threads).Error; err != nil {
+		return nil, fmt.Errorf("failed to load threads: %w", err)
+	}
+	if len(threads) == 0 {
+		return nil, nil
+	}
+
+	var threadMessages []models.Message
+	if err := s.db.Select("thread_id", "sender", "sender_email", "recipient_email", "subject", "external_message_id").
+		Where("user_id = ? AND thread_id IS NOT NULL", userID).
+		Find(&threadMessages).Error; err != nil {
+		return nil, fmt.Errorf("failed to load thread messages: %w", err)
+	}
+
+	candidates := make(map[uuid.UUID]*ThreadMatchCandidate, len(threads))
+	order := make([]uuid.UUID, 0, len(threads))
+	for _, thread := range threads {
+		candidates[thread.ID] = &ThreadMatchCandidate{
+			ThreadID:   thread.ID,
+			SellerName: thread.SellerName,
+		}
+		order = append(order, thread.ID)
+	}
+
+	for _, msg := range threadMessages {
+		candidate, ok := candidates[*msg.ThreadID]
+		if !ok {
+			continue // Archived thread
+		}
+		if msg.ExternalMessageID != "" {
+			candidate.MessageIDs = append(candidate.MessageIDs, msg.ExternalMessageID)
+		}
+		if msg.Subject != "" {
+			candidate.Subjects = append(candidate.Subjects, msg.Subject)
+		}
+		if msg.Sender == models.SenderTypeSeller && msg.SenderEmail != "" {
+			candidate.SellerEmails = append(candidate.SellerEmails, msg.SenderEmail)
+		}
+		if msg.Sender == models.SenderTypeUser && msg.RecipientEmail != "" {
+			candidate.SellerEmails = append(candidate.SellerEmails, msg.RecipientEmail)
+		}
+	}
+
+	list := make([]ThreadMatchCandidate, 0, len(order))
+	for _, id := range order {
+		list = append(list, *candidates[id])
+	}
+
+	return s.threadMatcher.Match(input, list), nil
+}
+
 // extractOriginalSenderFromBody extracts the original sender email from a forwarded email body
 // Looks for pattern: "---------- Forwarded message ---------\nFrom: Name <email@domain.com>"
 // Returns the email address if found, empty string otherwise
@@ -113,36 +299,6 @@ func (s *EmailService) extractOriginalSenderFromBody(body string) string {
 	return strings.ToLower(emailMatches[1]) // Normalize to lowercase
 }
 
-// cleanEmailBody removes quoted text and cleans up email formatting
-func (s *EmailService) cleanEmailBody(body string) string {
-	// Remove leading/trailing whitespace
-	body = strings.TrimSpace(body)
-
-	// Split into lines for processing
-	lines := strings.Split(body, "\n")
-	var cleanedLines []string
-
-	for _, line := range lines {
-		trimmedLine := strings.TrimSpace(line)
-
-		// Stop at common reply separators
-		if strings.HasPrefix(trimmedLine, "On ") && strings.Contains(trimmedLine, "wrote:") {
-			break
-		}
-		if strings.HasPrefix(trimmedLine, ">") {
-			continue // Skip quoted lines
-		}
-		if trimmedLine == "" && len(cleanedLines) > 0 && cleanedLines[len(cleanedLines)-1] == "" {
-			continue // Skip multiple blank lines
-		}
-
-		cleanedLines = append(cleanedLines, line)
-	}
-
-	cleaned := strings.Join(cleanedLines, "\n")
-	return strings.TrimSpace(cleaned)
-}
-
 // ReplyViaGmail sends threaded reply from user's Gmail
 // This is called when user clicks "Send Email" on an AI-drafted response
 func (s *EmailService) ReplyViaGmail(userID uuid.UUID, inboxMessageID uuid.UUID, replyContent string) error {
@@ -159,6 +315,11 @@ func (s *EmailService) ReplyViaGmail(userID uuid.UUID, inboxMessageID uuid.UUID,
 		return fmt.Errorf("message was not received via email")
 	}
 
+	// Addresses that hard bounced or complained are never emailed again
+	if err := checkEmailSuppression(s.db, message.SenderEmail); err != nil {
+		return err
+	}
+
 	fmt.Printf("Sender email: %s", message.SenderEmail)
 
 	// 3. Build reply subject
@@ -167,14 +328,69 @@ func (s *EmailService) ReplyViaGmail(userID uuid.UUID, inboxMessageID uuid.UUID,
 		replySubject = "Re: " + replySubject
 	}
 
-	// 4. Send reply via Gmail
-	return s.gmailService.SendReply(
+	// 4. Send reply via Gmail, with our own Message-ID so bounces can be matched to it
+	outboundMessageID := s.newOutboundMessageID()
+	if err := s.gmailService.SendReply(
 		userID,
-		message.SenderEmail,      // to
-		replySubject,             // subject
-		replyContent,             // body (from AI draft)
+		message.SenderEmail,       // to
+		replySubject,              // subject
+		replyContent,              // body (from AI draft)
 		message.ExternalMessageID, // In-Reply-To header
-	)
+		s.replyToAddress(userID, message.ThreadID), // Reply-To header
+		outboundMessageID,         // Message-ID header
+	); err != nil {
+		return err
+	}
+
+	// 5. Record the sent email so its delivery can be tracked. The email is already sent,
+	// so a failure here is logged rather than reported.
+	if err := s.recordOutboundEmail(userID, &message, replySubject, replyContent, outboundMessageID); err != nil {
+		log.Printf("Failed to record outbound email %s: %v", outboundMessageID, err)
+	}
+
+	return nil
+}
+
+// newOutboundMessageID generates a Message-ID for an email we send
+func (s *EmailService) newOutboundMessageID() string {
+	domain := s.mailgunDomain
+	if domain == "" {
+		domain = "otto.local"
+	}
+	return fmt.Sprintf("<%s@%s>", uuid.New(), domain)
+}
+
+// recordOutboundEmail saves a sent reply alongside the message it answers
+func (s *EmailService) recordOutboundEmail(userID uuid.UUID, original *models.Message, subject, content, messageID string) error {
+	sent := &models.Message{
+		UserID:            userID,
+		ThreadID:          original.ThreadID,
+		Sender:            models.SenderTypeUser,
+		Content:           content,
+		Timestamp:         time.Now(),
+		ExternalMessageID: messageID,
+		Subject:           subject,
+		SentViaEmail:      true,
+		RecipientEmail:    original.SenderEmail,
+		DeliveryStatus:    models.DeliveryStatusSent,
+	}
+
+	return s.db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Create(sent).Error; err != nil {
+			return fmt.Errorf("failed to create outbound message: %w", err)
+		}
+
+		if sent.ThreadID != nil {
+			if err := tx.Model(&models.Thread{}).Where("id = ?", *sent.ThreadID).Updates(map[string]interface{}{
+				"message_count":   gorm.Expr("message_count + ?", 1),
+				"last_message_at": sent.Timestamp,
+			}).Error; err != nil {
+				return fmt.Errorf("failed to update thread: %w", err)
+			}
+		}
+
+		return nil
+	})
 }
 
 // CreateDraftViaGmail creates a threaded draft from user's Gmail
@@ -191,6 +407,11 @@ func (s *EmailService) CreateDraftViaGmail(userID uuid.UUID, inboxMessageID uuid
 		return fmt.Errorf("message was not received via email")
 	}
 
+	// Addresses that hard bounced or complained are never emailed again
+	if err := checkEmailSuppression(s.db, message.SenderEmail); err != nil {
+		return err
+	}
+
 	fmt.Printf("Sender email: %s", message.SenderEmail)
 
 	// 3. Build reply subject
@@ -206,5 +427,25 @@ func (s *EmailService) CreateDraftViaGmail(userID uuid.UUID, inboxMessageID uuid
 		replySubject,             // subject
 		replyContent,             // body (from AI draft)
 		message.ExternalMessageID, // In-Reply-To header
+		s.replyToAddress(userID, message.ThreadID), // Reply-To header
 	)
 }
+
+// replyToAddress returns the inbound address dealer replies should go to: the thread's
+// plus-address when the message belongs to a thread, the user's inbox otherwise.
+// Returns an empty string when no inbound domain is configured.
+func (s *EmailService) replyToAddress(userID uuid.UUID, threadID *uuid.UUID) string {
+	if s.mailgunDomain == "" {
+		return ""
+	}
+
+	var user models.User
+	if err := s.db.Where("id = ?", userID).First(&user).Error; err != nil {
+		return ""
+	}
+
+	if threadID == nil {
+		return fmt.Sprintf("%s@%s", InboxLocalPart(&user), s.mailgunDomain)
+	}
+	return ThreadReplyAddress(&user, *threadID, s.mailgunDomain)
+}
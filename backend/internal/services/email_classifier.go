@@ -0,0 +1,195 @@
+package services
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"carbuyer/internal/db/models"
+	"carbuyer/internal/inbound"
+	"carbuyer/internal/llm"
+
+	"github.com/google/uuid"
+)
+
+// EmailClassificationConfidentThreshold is the header confidence above which the LLM isn't consulted
+const EmailClassificationConfidentThreshold = 0.8
+
+// spamScoreThreshold is the SpamAssassin-style score at or above which mail counts as spam
+const spamScoreThreshold = 5.0
+
+// maxClassificationBodyChars caps how much of the body is sent to the LLM
+const maxClassificationBodyChars = 2000
+
+var (
+	autoReplySubjectPattern = regexp.MustCompile(`(?i)^\s*(automatic reply|auto[- ]?reply|auto[- ]?response|autoreply|out of (the )?office|ooo\b|away from (the )?office)`)
+	noReplySenderPattern    = regexp.MustCompile(`(?i)(^|[<\s"])(no-?reply|do-?not-?reply|donotreply|mailer-daemon|postmaster|newsletters?|notifications?)[^@\s]*@`)
+)
+
+// EmailClassification is the category assigned to an inbound email and why
+type EmailClassification struct {
+	Category   models.MessageCategory
+	Source     models.MessageCategorySource
+	Confidence float64
+	Reason     string
+}
+
+// EmailClassifier sorts inbound email into human replies, auto-replies, marketing and spam.
+// Header heuristics decide clear cases; the LLM is only asked when they are inconclusive.
+type EmailClassifier struct {
+	llm llm.LLM // nil disables the LLM step
+}
+
+// NewEmailClassifier creates a classifier. Pass a nil LLM to use headers only.
+func NewEmailClassifier(llm llm.LLM) *EmailClassifier {
+	return &EmailClassifier{llm: llm}
+}
+
+// Classify classifies an inbound email to userID. body is the cleaned message text.
+func (c *EmailClassifier) Classify(userID uuid.UUID, email *inbound.Email, body string) EmailClassification {
+	result := ClassifyEmailHeaders(email)
+	if c == nil || c.llm == nil || result.Confidence >= EmailClassificationConfidentThreshold {
+		return result
+	}
+
+	if len(body) > maxClassificationBodyChars {
+		body = body[:maxClassificationBodyChars]
+	}
+
+	req := emailClassificationRequest(email.From, email.Subject, body, result.Reason)
+	req.UserID = userID.String()
+	response, err := c.llm.Complete(context.Background(), req)
+	if err != nil {
+		// Classification is best effort - keep the header result
+		logLLMFailure(err, "classify email for user %s with the LLM", userID)
+		return result
+	}
+
+	llmResult, err := ParseEmailClassification(response.Text)
+	if err != nil {
+		log.Printf("Failed to parse LLM email classification: %v", err)
+		return result
+	}
+
+	return *llmResult
+}
+
+// ClassifyEmailHeaders classifies an email from its headers, sender and subject alone
+func ClassifyEmailHeaders(email *inbound.Email) EmailClassification {
+	header := email.Headers
+
+	// Bounce notifications are handled as delivery events, not read as replies
+	if inbound.IsBounce(email) {
+		return headerClassification(models.MessageCategoryAutoReply, 0.95, "delivery failure notice")
+	}
+
+	// Spam verdicts from the receiving mail server
+	if header != nil {
+		if isYes(header.Get("X-Spam-Flag")) || isYes(header.Get("X-Mailgun-Sflag")) || isYes(header.Get("X-Spam-Status")) {
+			return headerClassification(models.MessageCategorySpam, 0.95, "flagged as spam by the mail server")
+		}
+		if score, err := strconv.ParseFloat(strings.TrimSpace(header.Get("X-Spam-Score")), 64); err == nil && score >= spamScoreThreshold {
+			return headerClassification(models.MessageCategorySpam, 0.9, fmt.Sprintf("spam score %.1f", score))
+		}
+	}
+
+	// Auto-responders (RFC 3834 and the common non-standard headers)
+	if header != nil {
+		if value := strings.ToLower(strings.TrimSpace(header.Get("Auto-Submitted"))); value != "" && value != "no" {
+			return headerClassification(models.MessageCategoryAutoReply, 0.95, "Auto-Submitted: "+value)
+		}
+		if header.Get("X-Autoreply") != "" || header.Get("X-Autorespond") != "" {
+			return headerClassification(models.MessageCategoryAutoReply, 0.95, "auto-reply header")
+		}
+		if strings.EqualFold(strings.TrimSpace(header.Get("Precedence")), "auto_reply") {
+			return headerClassification(models.MessageCategoryAutoReply, 0.95, "Precedence: auto_reply")
+		}
+	}
+	if autoReplySubjectPattern.MatchString(email.Subject) {
+		return headerClassification(models.MessageCategoryAutoReply, 0.85, "auto-reply subject")
+	}
+
+	// Replies to the buyer's own emails are usually written by a person, even when a dealer
+	// CRM adds bulk mail headers to them
+	isReply := strings.TrimSpace(email.InReplyTo) != "" || strings.TrimSpace(email.References) != ""
+
+	var bulkSignals []string
+	if header != nil {
+		if header.Get("List-Unsubscribe") != "" {
+			bulkSignals = append(bulkSignals, "List-Unsubscribe")
+		}
+		if header.Get("List-Id") != "" {
+			bulkSignals = append(bulkSignals, "List-Id")
+		}
+		if header.Get("Feedback-Id") != "" {
+			bulkSignals = append(bulkSignals, "Feedback-ID")
+		}
+		switch strings.ToLower(strings.TrimSpace(header.Get("Precedence"))) {
+		case "bulk", "list", "junk":
+			bulkSignals = append(bulkSignals, "Precedence: "+header.Get("Precedence"))
+		}
+	}
+	if len(bulkSignals) > 0 {
+		reason := "bulk mail headers: " + strings.Join(bulkSignals, ", ")
+		if isReply {
+			return headerClassification(models.MessageCategoryHuman, 0.5, "reply with "+reason)
+		}
+		return headerClassification(models.MessageCategoryMarketing, 0.9, reason)
+	}
+
+	if noReplySenderPattern.MatchString(email.From) {
+		return headerClassification(models.MessageCategoryAutoReply, 0.6, "sent from a no-reply address")
+	}
+
+	return headerClassification(models.MessageCategoryHuman, 0.7, "no automated mail headers")
+}
+
+func headerClassification(category models.MessageCategory, confidence float64, reason string) EmailClassification {
+	return EmailClassification{
+		Category:   category,
+		Source:     models.MessageCategorySourceHeaders,
+		Confidence: confidence,
+		Reason:     reason,
+	}
+}
+
+// isYes reports whether a spam verdict header value starts with "yes"
+func isYes(value string) bool {
+	return strings.HasPrefix(strings.ToLower(strings.TrimSpace(value)), "yes")
+}
+
+// ParseEmailClassification parses the LLM's classification JSON
+func ParseEmailClassification(response string) (*EmailClassification, error) {
+	var parsed struct {
+		Category string `json:"category"`
+		Reason   string `json:"reason"`
+	}
+	if err := llm.DecodeJSON(response, &parsed); err != nil {
+		return nil, err
+	}
+
+	category, ok := ParseMessageCategory(parsed.Category)
+	if !ok {
+		return nil, fmt.Errorf("unknown category %q", parsed.Category)
+	}
+
+	return &EmailClassification{
+		Category:   category,
+		Source:     models.MessageCategorySourceLLM,
+		Confidence: EmailClassificationConfidentThreshold,
+		Reason:     strings.TrimSpace(parsed.Reason),
+	}, nil
+}
+
+// ParseMessageCategory validates a category name
+func ParseMessageCategory(value string) (models.MessageCategory, bool) {
+	category := models.MessageCategory(strings.ToLower(strings.TrimSpace(value)))
+	switch category {
+	case models.MessageCategoryHuman, models.MessageCategoryAutoReply, models.MessageCategoryMarketing, models.MessageCategorySpam:
+		return category, true
+	}
+	return "", false
+}
@@ -0,0 +1,239 @@
+package services
+
+import (
+	"errors"
+	"net/textproto"
+	"testing"
+
+	"carbuyer/internal/db/models"
+	"carbuyer/internal/inbound"
+	"carbuyer/internal/llm"
+
+	"github.com/google/uuid"
+)
+
+func TestClassifyEmailHeaders(t *testing.T) {
+	tests := []struct {
+		name          string
+		email         inbound.Email
+		wantCategory  models.MessageCategory
+		wantConfident bool
+	}{
+		{
+			name: "plain dealer reply",
+			email: inbound.Email{
+				From:      "Mike Chen <mike@northgateford.com>",
+				Subject:   "Re: Explorer XLT pricing",
+				InReplyTo: "<abc@mail.gmail.com>",
+			},
+			wantCategory: models.MessageCategoryHuman,
+		},
+		{
+			name: "mail server spam flag",
+			email: inbound.Email{
+				From:    "prize@win-big.example",
+				Subject: "You won",
+				Headers: textproto.MIMEHeader{"X-Mailgun-Sflag": {"Yes"}},
+			},
+			wantCategory:  models.MessageCategorySpam,
+			wantConfident: true,
+		},
+		{
+			name: "high spam score",
+			email: inbound.Email{
+				From:    "deals@cheap-parts.example",
+				Headers: textproto.MIMEHeader{"X-Spam-Score": {"7.4"}},
+			},
+			wantCategory:  models.MessageCategorySpam,
+			wantConfident: true,
+		},
+		{
+			name: "low spam score is ignored",
+			email: inbound.Email{
+				From:    "mike@northgateford.com",
+				Headers: textproto.MIMEHeader{"X-Spam-Score": {"0.3"}},
+			},
+			wantCategory: models.MessageCategoryHuman,
+		},
+		{
+			name: "CRM auto-responder",
+			email: inbound.Email{
+				From:    "Northgate Ford <sales@northgateford.com>",
+				Subject: "Thanks for your inquiry!",
+				Headers: textproto.MIMEHeader{"Auto-Submitted": {"auto-generated"}},
+			},
+			wantCategory:  models.MessageCategoryAutoReply,
+			wantConfident: true,
+		},
+		{
+			name: "Auto-Submitted no is a person",
+			email: inbound.Email{
+				From:    "mike@northgateford.com",
+				Headers: textproto.MIMEHeader{"Auto-Submitted": {"no"}},
+			},
+			wantCategory: models.MessageCategoryHuman,
+		},
+		{
+			name: "out of office subject",
+			email: inbound.Email{
+				From:    "mike@northgateford.com",
+				Subject: "Automatic reply: Explorer XLT pricing",
+			},
+			wantCategory:  models.MessageCategoryAutoReply,
+			wantConfident: true,
+		},
+		{
+			name: "newsletter",
+			email: inbound.Email{
+				From:    "Subaru of Kirkland <news@subaruofkirkland.com>",
+				Subject: "Spring sales event - 0% APR",
+				Headers: textproto.MIMEHeader{
+					"List-Unsubscribe": {"<mailto:unsub@subaruofkirkland.com>"},
+					"Precedence":       {"bulk"},
+				},
+			},
+			wantCategory:  models.MessageCategoryMarketing,
+			wantConfident: true,
+		},
+		{
+			name: "CRM reply with bulk headers is inconclusive",
+			email: inbound.Email{
+				From:       "sam@subaruofkirkland.com",
+				Subject:    "Re: Outback quote",
+				References: "<r1@gmail.com>",
+				Headers:    textproto.MIMEHeader{"List-Unsubscribe": {"<https://crm.example/unsub>"}},
+			},
+			wantCategory: models.MessageCategoryHuman,
+		},
+		{
+			name: "no-reply sender",
+			email: inbound.Email{
+				From:    "Eastside Mazda <no-reply@eastsidemazda.com>",
+				Subject: "We received your request",
+			},
+			wantCategory: models.MessageCategoryAutoReply,
+		},
+		{
+			name: "bounce notification",
+			email: inbound.Email{
+				From:    "Mail Delivery Subsystem <mailer-daemon@googlemail.com>",
+				Subject: "Delivery Status Notification (Failure)",
+			},
+			wantCategory:  models.MessageCategoryAutoReply,
+			wantConfident: true,
+		},
+		{
+			name: "no headers at all",
+			email: inbound.Email{
+				From:    "chris@eastsidemazda.com",
+				Subject: "CX-50 availability",
+			},
+			wantCategory: models.MessageCategoryHuman,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := ClassifyEmailHeaders(&tt.email)
+			if got.Category != tt.wantCategory {
+				t.Errorf("Category = %q (%s), want %q", got.Category, got.Reason, tt.wantCategory)
+			}
+			if confident := got.Confidence >= EmailClassificationConfidentThreshold; confident != tt.wantConfident {
+				t.Errorf("Confidence = %.2f, want confident = %v", got.Confidence, tt.wantConfident)
+			}
+			if got.Source != models.MessageCategorySourceHeaders {
+				t.Errorf("Source = %q, want headers", got.Source)
+			}
+		})
+	}
+}
+
+func TestEmailClassifierLLM(t *testing.T) {
+	inconclusive := &inbound.Email{
+		From:    "Northgate Ford <sales@northgateford.com>",
+		Subject: "Your Explorer is waiting",
+	}
+	spam := &inbound.Email{
+		From:    "prize@win-big.example",
+		Headers: textproto.MIMEHeader{"X-Mailgun-Sflag": {"Yes"}},
+	}
+
+	t.Run("inconclusive headers ask the LLM", func(t *testing.T) {
+		fake := llm.NewFake(`{"category": "marketing", "reason": "Sales event promotion"}`)
+		got := NewEmailClassifier(fake).Classify(uuid.New(), inconclusive, "Come see our year-end deals!")
+
+		if got.Category != models.MessageCategoryMarketing || got.Source != models.MessageCategorySourceLLM {
+			t.Errorf("Classify() = %+v, want marketing from llm", got)
+		}
+		requests := fake.Requests()
+		if len(requests) != 1 || requests[0].Model != llm.ModelFast {
+			t.Errorf("requests = %+v, want one fast model request", requests)
+		}
+	})
+
+	t.Run("confident headers skip the LLM", func(t *testing.T) {
+		fake := llm.NewFake()
+		got := NewEmailClassifier(fake).Classify(uuid.New(), spam, "")
+
+		if got.Category != models.MessageCategorySpam || len(fake.Requests()) != 0 {
+			t.Errorf("Classify() = %+v with %d LLM requests, want spam from headers", got, len(fake.Requests()))
+		}
+	})
+
+	t.Run("LLM errors keep the header result", func(t *testing.T) {
+		fake := llm.NewFake().Add(llm.FakeResponse{Err: errors.New("overloaded")})
+		got := NewEmailClassifier(fake).Classify(uuid.New(), inconclusive, "")
+
+		if got.Source != models.MessageCategorySourceHeaders {
+			t.Errorf("Classify() = %+v, want the header result", got)
+		}
+	})
+}
+
+func TestParseEmailClassification(t *testing.T) {
+	tests := []struct {
+		name     string
+		response string
+		want     models.MessageCategory
+		wantErr  bool
+	}{
+		{
+			name:     "plain JSON",
+			response: `{"category": "marketing", "reason": "Sales event promotion"}`,
+			want:     models.MessageCategoryMarketing,
+		},
+		{
+			name:     "wrapped in a code fence",
+			response: "```json\n{\"category\": \"Auto_Reply\", \"reason\": \"CRM acknowledgement\"}\n```",
+			want:     models.MessageCategoryAutoReply,
+		},
+		{
+			name:     "unknown category",
+			response: `{"category": "newsletter"}`,
+			wantErr:  true,
+		},
+		{
+			name:     "no JSON",
+			response: "This looks like a human reply.",
+			wantErr:  true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := ParseEmailClassification(tt.response)
+			if tt.wantErr {
+				if err == nil {
+					t.Errorf("ParseEmailClassification() = %+v, want error", got)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("ParseEmailClassification() error = %v", err)
+			}
+			if got.Category != tt.want || got.Source != models.MessageCategorySourceLLM {
+				t.Errorf("ParseEmailClassification() = %+v, want category %q from llm", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,293 @@
+package services
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"log"
+	"net/mail"
+	"sort"
+	"strings"
+	"time"
+
+	"carbuyer/internal/db/models"
+	"carbuyer/internal/inbound"
+
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+)
+
+// EmailImportResult summarizes an import of historical emails
+type EmailImportResult struct {
+	Imported       int         `json:"imported"`
+	Duplicates     int         `json:"duplicates"`     // Already imported or received
+	Skipped        int         `json:"skipped"`        // Auto-replies, marketing, spam and unparseable messages
+	ThreadIDs      []uuid.UUID `json:"threadIds"`      // Threads the imported messages were added to
+	CreatedThreads int         `json:"createdThreads"` // How many of those threads the import started
+	Errors         []string    `json:"errors,omitempty"`
+}
+
+// EmailImportService imports earlier dealer conversations from .eml files and mbox archives
+// so threads started before the user joined have their full history
+type EmailImportService struct {
+	db                *gorm.DB
+	emailService      *EmailService
+	attachmentService *AttachmentService
+	threadService     *ThreadService
+}
+
+// NewEmailImportService creates a new email import service
+func NewEmailImportService(db *gorm.DB, emailService *EmailService, attachmentService *AttachmentService, threadService *ThreadService) *EmailImportService {
+	return &EmailImportService{
+		db:                db,
+		emailService:      emailService,
+		attachmentService: attachmentService,
+		threadService:     threadService,
+	}
+}
+
+// Import adds historical emails to the user's threads, oldest first so replies can be matched
+// to the emails they answer. Emails the user sent are recorded as their messages and the rest
+// as the dealer's. With a threadID every email goes to that thread; otherwise each joins the
+// thread it matches confidently or starts a new one with its dealer. Bodies are cleaned the same
+// way as inbound email, and the original Message-IDs and dates are kept, so importing the same
+// file twice adds nothing.
+func (s *EmailImportService) Import(userID uuid.UUID, threadID *uuid.UUID, emails []*inbound.Email) (*EmailImportResult, error) {
+	if threadID != nil {
+		if _, err := s.threadService.GetThreadByID(*threadID, userID); err != nil {
+			return nil, err
+		}
+	}
+
+	ownAddresses, err := s.userAddresses(userID)
+	if err != nil {
+		return nil, err
+	}
+
+	// Emails without a date go last, in the order given
+	sorted := append([]*inbound.Email(nil), emails...)
+	sort.SliceStable(sorted, func(i, j int) bool {
+		if sorted[i].Date.IsZero() || sorted[j].Date.IsZero() {
+			return !sorted[i].Date.IsZero() && sorted[j].Date.IsZero()
+		}
+		return sorted[i].Date.Before(sorted[j].Date)
+	})
+
+	result := &EmailImportResult{ThreadIDs: []uuid.UUID{}}
+	touched := make(map[uuid.UUID]bool)
+	createdThreads := make(map[uuid.UUID]bool)
+	for _, email := range sorted {
+		message, created, err := s.importEmail(userID, threadID, ownAddresses, createdThreads, email)
+		switch {
+		case err != nil:
+			if strings.HasPrefix(err.Error(), "database error") {
+				return nil, err
+			}
+			log.Printf("Failed to import email %s: %v", email.MessageID, err)
+			result.Errors = append(result.Errors, fmt.Sprintf("%s: %v", importLabel(email), err))
+			continue
+		case message == nil:
+			result.Skipped++
+			continue
+		case !created:
+			result.Duplicates++
+			continue
+		}
+
+		result.Imported++
+		if message.ThreadID != nil && !touched[*message.ThreadID] {
+			touched[*message.ThreadID] = true
+			result.ThreadIDs = append(result.ThreadIDs, *message.ThreadID)
+		}
+	}
+
+	result.CreatedThreads = len(createdThreads)
+
+	return result, nil
+}
+
+// importEmail saves one historical email, adding any thread it starts to createdThreads. It
+// returns the message and whether it was created just now, or a nil message when the email
+// was skipped.
+func (s *EmailImportService) importEmail(userID uuid.UUID, threadID *uuid.UUID, ownAddresses map[string]bool, createdThreads map[uuid.UUID]bool, email *inbound.Email) (*models.Message, bool, error) {
+	// Without a Message-ID, derive a stable one so the same file can be imported again safely
+	if email.MessageID == "" {
+		email.MessageID = importMessageID(email)
+	}
+
+	var existing models.Message
+	err := s.db.Where("user_id = ? AND external_message_id = ?", userID, email.MessageID).First(&existing).Error
+	if err == nil {
+		return &existing, false, nil
+	}
+	if !errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, false, fmt.Errorf("database error: %w", err)
+	}
+
+	cleanedBody, rawBody, plainBody := inboundBodies(email)
+
+	message := &models.Message{
+		UserID:            userID,
+		Content:           cleanedBody,
+		RawContent:        rawBody,
+		Timestamp:         email.Date,
+		ExternalMessageID: email.MessageID,
+		Subject:           email.Subject,
+		SentViaEmail:      true,
+	}
+	if message.Timestamp.IsZero() {
+		message.Timestamp = time.Now()
+	}
+
+	// The dealer is whoever the user was writing to or hearing from
+	var dealer string
+	if ownAddresses[extractEmailAddress(email.From)] {
+		dealer = email.To
+		message.Sender = models.SenderTypeUser
+		message.SenderEmail = extractEmailAddress(email.From)
+		message.RecipientEmail = extractEmailAddress(email.To)
+	} else {
+		// Only the dealer's own replies belong in the history
+		classification := ClassifyEmailHeaders(email)
+		if classification.Category != models.MessageCategoryHuman && classification.Confidence >= EmailClassificationConfidentThreshold {
+			return nil, false, nil
+		}
+
+		dealer = email.From
+		if original := s.emailService.extractOriginalSenderFromBody(plainBody); original != "" {
+			dealer = original
+		}
+		message.Sender = models.SenderTypeSeller
+		message.SenderEmail = extractEmailAddress(dealer)
+		message.Category = models.MessageCategoryHuman
+		message.CategorySource = classification.Source
+		message.CategoryReason = classification.Reason
+	}
+	if extractEmailAddress(dealer) == "" {
+		return nil, false, errors.New("no dealer address")
+	}
+
+	if threadID != nil {
+		message.ThreadID = threadID
+	} else {
+		var created bool
+		message.ThreadID, created, err = s.importThread(userID, dealer, email)
+		if err != nil {
+			return nil, false, err
+		}
+		if created {
+			createdThreads[*message.ThreadID] = true
+		}
+	}
+
+	err = s.db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Create(message).Error; err != nil {
+			return fmt.Errorf("failed to create imported message: %w", err)
+		}
+
+		// Older emails don't move the thread's last message time back
+		if err := tx.Model(&models.Thread{}).Where("id = ?", *message.ThreadID).Updates(map[string]interface{}{
+			"message_count":   gorm.Expr("message_count + ?", 1),
+			"last_message_at": gorm.Expr("GREATEST(COALESCE(last_message_at, ?), ?)", message.Timestamp, message.Timestamp),
+		}).Error; err != nil {
+			return fmt.Errorf("failed to update thread: %w", err)
+		}
+
+		return nil
+	})
+	if err != nil {
+		return nil, false, err
+	}
+
+	if len(email.Attachments) > 0 {
+		if _, err := s.attachmentService.SaveAttachments(message, email.Attachments); err != nil {
+			// The message itself is saved - don't fail the import over attachments
+			log.Printf("Failed to save attachments for imported message %s: %v", message.ID, err)
+		}
+	}
+
+	return message, true, nil
+}
+
+// importThread finds the thread an imported email belongs to, starting one with its dealer
+// when no thread matches confidently. It reports whether the thread was started.
+func (s *EmailImportService) importThread(userID uuid.UUID, dealer string, email *inbound.Email) (*uuid.UUID, bool, error) {
+	match, err := s.emailService.matchThread(userID, InboundMatchInput{
+		From:       dealer,
+		Subject:    email.Subject,
+		InReplyTo:  email.InReplyTo,
+		References: ParseMessageIDList(email.References),
+	})
+	if err != nil {
+		return nil, false, fmt.Errorf("database error: %w", err)
+	}
+	if match != nil && match.AutoAssign() {
+		return &match.ThreadID, false, nil
+	}
+
+	name, sellerType := importSeller(dealer)
+	thread, err := s.threadService.CreateThread(userID, name, sellerType)
+	if err != nil {
+		return nil, false, err
+	}
+	return &thread.ID, true, nil
+}
+
+// userAddresses returns the addresses the user sends email from
+func (s *EmailImportService) userAddresses(userID uuid.UUID) (map[string]bool, error) {
+	var user models.User
+	if err := s.db.Where("id = ?", userID).First(&user).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, errors.New("user not found")
+		}
+		return nil, fmt.Errorf("database error: %w", err)
+	}
+
+	addresses := map[string]bool{strings.ToLower(user.Email): true}
+
+	var token models.GmailToken
+	if err := s.db.Select("gmail_email").Where("user_id = ?", userID).First(&token).Error; err == nil && token.GmailEmail != "" {
+		addresses[strings.ToLower(token.GmailEmail)] = true
+	}
+
+	return addresses, nil
+}
+
+// importSeller names the thread for a dealer address: the display name when there is one,
+// else the address's domain. Addresses at consumer mail providers are private sellers.
+func importSeller(address string) (string, models.SellerType) {
+	email := extractEmailAddress(address)
+	domain := emailDomain(email)
+
+	name := ""
+	if parsed, err := mail.ParseAddress(address); err == nil {
+		name = strings.TrimSpace(parsed.Name)
+	}
+
+	if freeEmailDomains[domain] {
+		if name == "" {
+			name = email
+		}
+		return name, models.SellerTypePrivate
+	}
+	if name == "" {
+		name = domain
+	}
+	return name, models.SellerTypeDealership
+}
+
+// importMessageID derives a Message-ID for an email that has none from its sender, date,
+// subject and body
+func importMessageID(email *inbound.Email) string {
+	sum := sha256.Sum256([]byte(email.From + "\n" + email.Date.UTC().Format(time.RFC3339) + "\n" + email.Subject + "\n" + email.TextBody + email.HTMLBody))
+	return "<import-" + hex.EncodeToString(sum[:16]) + "@otto.local>"
+}
+
+// importLabel identifies an email in import errors
+func importLabel(email *inbound.Email) string {
+	if email.Subject != "" {
+		return fmt.Sprintf("%q from %s", email.Subject, email.From)
+	}
+	return email.MessageID
+}
@@ -0,0 +1,50 @@
+package services
+
+import (
+	"testing"
+	"time"
+
+	"carbuyer/internal/db/models"
+	"carbuyer/internal/inbound"
+)
+
+func TestImportSeller(t *testing.T) {
+	tests := []struct {
+		address  string
+		wantName string
+		wantType models.SellerType
+	}{
+		{"Northgate Ford <sales@northgateford.com>", "Northgate Ford", models.SellerTypeDealership},
+		{"sales@northgateford.com", "northgateford.com", models.SellerTypeDealership},
+		{"Pat Lee <pat.lee@gmail.com>", "Pat Lee", models.SellerTypePrivate},
+		{"pat.lee@gmail.com", "pat.lee@gmail.com", models.SellerTypePrivate},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.address, func(t *testing.T) {
+			name, sellerType := importSeller(tt.address)
+			if name != tt.wantName || sellerType != tt.wantType {
+				t.Errorf("importSeller() = %q, %q, want %q, %q", name, sellerType, tt.wantName, tt.wantType)
+			}
+		})
+	}
+}
+
+func TestImportMessageID(t *testing.T) {
+	email := inbound.Email{
+		From:     "sales@northgateford.com",
+		Subject:  "Explorer quote",
+		TextBody: "Out the door at $39,250.",
+		Date:     time.Date(2024, 3, 4, 9, 15, 0, 0, time.UTC),
+	}
+
+	first := importMessageID(&email)
+	if first != importMessageID(&email) {
+		t.Error("importMessageID() is not stable")
+	}
+
+	email.TextBody = "Out the door at $38,900."
+	if first == importMessageID(&email) {
+		t.Error("importMessageID() is the same for different emails")
+	}
+}
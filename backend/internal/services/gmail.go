@@ -64,7 +64,7 @@ func (s *GmailService) DisconnectGmail(userID uuid.UUID) error {
 }
 
 // SendReply sends an email reply via user's Gmail
-func (s *GmailService) SendReply(userID uuid.UUID, to, subject, htmlBody, externalMessageID string) error {
+func (s *GmailService) SendReply(userID uuid.UUID, to, subject, htmlBody, externalMessageID, replyTo, messageID string) error {
 	// Create Gmail service for this user
 	service, err := gmail.CreateGmailService(userID, s.tokenManager, s.oauthConfig)
 	if err != nil {
@@ -72,11 +72,11 @@ func (s *GmailService) SendReply(userID uuid.UUID, to, subject, htmlBody, extern
 	}
 
 	// Send reply
-	return gmail.SendReply(service, to, subject, htmlBody, externalMessageID)
+	return gmail.SendReply(service, to, subject, htmlBody, externalMessageID, replyTo, messageID)
 }
 
 // CreateDraft creates a Gmail draft via user's Gmail
-func (s *GmailService) CreateDraft(userID uuid.UUID, to, subject, htmlBody, externalMessageID string) error {
+func (s *GmailService) CreateDraft(userID uuid.UUID, to, subject, htmlBody, externalMessageID, replyTo string) error {
 	// Create Gmail service for this user
 	service, err := gmail.CreateGmailService(userID, s.tokenManager, s.oauthConfig)
 	if err != nil {
@@ -84,5 +84,5 @@ func (s *GmailService) CreateDraft(userID uuid.UUID, to, subject, htmlBody, exte
 	}
 
 	// Create draft
-	return gmail.CreateDraft(service, to, subject, htmlBody, externalMessageID)
+	return gmail.CreateDraft(service, to, subject, htmlBody, externalMessageID, replyTo)
 }
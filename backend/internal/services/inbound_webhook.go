@@ -0,0 +1,318 @@
+package services
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"carbuyer/internal/db/models"
+	"carbuyer/internal/inbound"
+	"carbuyer/internal/storage"
+
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+)
+
+// MaxWebhookPayloadBytes caps the size of a stored inbound webhook payload
+const MaxWebhookPayloadBytes = 60 << 20 // 60MB
+
+// Webhooks that fail verification can come from anyone, so only the start of each payload
+// and the newest few are kept
+const (
+	maxRejectedPayloadBytes  = 4 << 10 // 4KB
+	maxRejectedWebhookEvents = 1000
+)
+
+// InboundWebhookService stores every inbound email webhook before processing it, so
+// payloads that fail to parse or process can be inspected and replayed
+type InboundWebhookService struct {
+	db                *gorm.DB
+	store             storage.BlobStore
+	adapters          map[string]inbound.Adapter
+	emailService      *EmailService
+	attachmentService *AttachmentService
+	extractionService *DocumentExtractionService
+	offerExtraction   *OfferExtractionService
+	summaries         *ThreadSummaryService
+	deliveryService   *DeliveryService
+}
+
+// NewInboundWebhookService creates a new inbound webhook service
+func NewInboundWebhookService(db *gorm.DB, store storage.BlobStore, adapters []inbound.Adapter, emailService *EmailService, attachmentService *AttachmentService, extractionService *DocumentExtractionService, offerExtraction *OfferExtractionService, summaries *ThreadSummaryService, deliveryService *DeliveryService) *InboundWebhookService {
+	byName := make(map[string]inbound.Adapter, len(adapters))
+	for _, adapter := range adapters {
+		byName[adapter.Name()] = adapter
+	}
+
+	return &InboundWebhookService{
+		db:                db,
+		store:             store,
+		adapters:          byName,
+		emailService:      emailService,
+		attachmentService: attachmentService,
+		extractionService: extractionService,
+		offerExtraction:   offerExtraction,
+		summaries:         summaries,
+		deliveryService:   deliveryService,
+	}
+}
+
+// Adapter returns the adapter for a provider
+func (s *InboundWebhookService) Adapter(provider string) (inbound.Adapter, bool) {
+	adapter, ok := s.adapters[provider]
+	return adapter, ok
+}
+
+// RecordEvent stores a verified raw webhook payload
+func (s *InboundWebhookService) RecordEvent(provider, contentType string, query url.Values, payload []byte) (*models.WebhookEvent, error) {
+	event := newWebhookEvent(provider, contentType, query, int64(len(payload)))
+	if err := s.saveEvent(event, payload); err != nil {
+		return nil, err
+	}
+	return event, nil
+}
+
+// RecordRejectedEvent stores a webhook that failed verification, so a payload the adapter
+// couldn't parse can still be inspected. Only the start of the payload is kept, and older
+// rejected events are pruned. Rejected events are never processed.
+func (s *InboundWebhookService) RecordRejectedEvent(provider, contentType string, query url.Values, payload []byte, cause error) (*models.WebhookEvent, error) {
+	event := newWebhookEvent(provider, contentType, query, int64(len(payload)))
+	event.Status = models.WebhookEventStatusRejected
+	event.Error = cause.Error()
+	if len(payload) > maxRejectedPayloadBytes {
+		payload = payload[:maxRejectedPayloadBytes]
+	}
+	if err := s.saveEvent(event, payload); err != nil {
+		return nil, err
+	}
+
+	s.pruneRejectedEvents()
+	return event, nil
+}
+
+// newWebhookEvent creates an unsaved event for a payload of size bytes
+func newWebhookEvent(provider, contentType string, query url.Values, size int64) *models.WebhookEvent {
+	// Never persist the webhook secret
+	query = cloneValues(query)
+	query.Del("token")
+
+	event := &models.WebhookEvent{
+		ID:           uuid.New(),
+		Provider:     provider,
+		ContentType:  contentType,
+		RawQuery:     query.Encode(),
+		PayloadBytes: size,
+		Status:       models.WebhookEventStatusReceived,
+	}
+	event.PayloadKey = fmt.Sprintf("webhooks/%s/%s", provider, event.ID)
+	return event
+}
+
+// saveEvent stores an event's payload and then the event
+func (s *InboundWebhookService) saveEvent(event *models.WebhookEvent, payload []byte) error {
+	if err := s.store.Put(context.Background(), event.PayloadKey, bytes.NewReader(payload), event.ContentType); err != nil {
+		return fmt.Errorf("failed to store webhook payload: %w", err)
+	}
+
+	if err := s.db.Create(event).Error; err != nil {
+		s.store.Delete(context.Background(), event.PayloadKey)
+		return fmt.Errorf("failed to save webhook event: %w", err)
+	}
+
+	return nil
+}
+
+// pruneRejectedEvents deletes all but the newest rejected events and their payloads
+func (s *InboundWebhookService) pruneRejectedEvents() {
+	var stale []models.WebhookEvent
+	if err := s.db.Where("status = ?", models.WebhookEventStatusRejected).
+		Order("created_at DESC").
+		Offset(maxRejectedWebhookEvents).
+		Find(&stale).Error; err != nil {
+		log.Printf("Failed to find old rejected webhook events: %v", err)
+		return
+	}
+
+	for _, event := range stale {
+		if err := s.store.Delete(context.Background(), event.PayloadKey); err != nil {
+			log.Printf("Failed to delete payload of webhook event %s: %v", event.ID, err)
+			continue
+		}
+		if err := s.db.Delete(&event).Error; err != nil {
+			log.Printf("Failed to delete webhook event %s: %v", event.ID, err)
+		}
+	}
+}
+
+// ProcessEvent parses a stored payload and creates its message. The outcome is recorded on
+// the event. Processing is idempotent by external Message-ID, so events can be replayed.
+//
+// Errors starting with "invalid webhook payload" or "user not found" won't succeed on a
+// provider retry; any other error might.
+func (s *InboundWebhookService) ProcessEvent(event *models.WebhookEvent) (*models.Message, error) {
+	if event.Status == models.WebhookEventStatusRejected {
+		return nil, errors.New("webhook event failed verification")
+	}
+	event.Attempts++
+
+	message, err := s.processEvent(event)
+	now := time.Now()
+	event.ProcessedAt = &now
+	switch {
+	case err == nil:
+		event.Status = models.WebhookEventStatusProcessed
+		event.Error = ""
+		event.MessageID = &message.ID
+		event.UserID = &message.UserID
+	case err.Error() == "user not found":
+		event.Status = models.WebhookEventStatusIgnored
+		event.Error = err.Error()
+	default:
+		event.Status = models.WebhookEventStatusFailed
+		event.Error = err.Error()
+	}
+
+	if saveErr := s.db.Save(event).Error; saveErr != nil {
+		log.Printf("Failed to update webhook event %s: %v", event.ID, saveErr)
+	}
+
+	return message, err
+}
+
+func (s *InboundWebhookService) processEvent(event *models.WebhookEvent) (*models.Message, error) {
+	adapter, ok := s.adapters[event.Provider]
+	if !ok {
+		return nil, fmt.Errorf("invalid webhook payload: unknown provider %q", event.Provider)
+	}
+
+	reader, err := s.store.Get(context.Background(), event.PayloadKey)
+	if err != nil {
+		return nil, fmt.Errorf("failed to load webhook payload: %w", err)
+	}
+	payload, err := io.ReadAll(reader)
+	reader.Close()
+	if err != nil {
+		return nil, fmt.Errorf("failed to load webhook payload: %w", err)
+	}
+
+	// Rebuild the request the adapter originally parsed
+	req, err := http.NewRequest(http.MethodPost, "/?"+event.RawQuery, bytes.NewReader(payload))
+	if err != nil {
+		return nil, fmt.Errorf("invalid webhook payload: %w", err)
+	}
+	req.Header.Set("Content-Type", event.ContentType)
+
+	email, err := adapter.Parse(req)
+	if err != nil {
+		return nil, fmt.Errorf("invalid webhook payload: %w", err)
+	}
+
+	// Without a Message-ID, fall back to the event ID so replays don't create duplicates
+	if email.MessageID == "" {
+		email.MessageID = "webhook-" + event.ID.String()
+	}
+	event.Recipient = email.Recipient
+	event.ExternalMessageID = email.MessageID
+
+	// Look up user (and thread, for plus-addresses) from the recipient address
+	user, threadID, err := s.emailService.ResolveInboundRecipient(email.Recipient)
+	if err != nil {
+		if strings.HasPrefix(err.Error(), "database error") {
+			return nil, err
+		}
+		// Unknown user or unparseable address - the recipient is kept on the event
+		log.Printf("Inbound recipient not resolved (%s): %v", email.Recipient, err)
+		return nil, errors.New("user not found")
+	}
+	event.UserID = &user.ID
+
+	message, err := s.emailService.ProcessInboundEmail(user.ID, threadID, email)
+	if err != nil {
+		return nil, err
+	}
+
+	// Bounce notifications update the delivery status of the email that bounced
+	for _, bounce := range inbound.ParseBounce(email) {
+		if _, err := s.deliveryService.RecordEvent(bounce); err != nil {
+			log.Printf("Failed to record bounce for %s: %v", bounce.Recipient, err)
+		}
+	}
+
+	if len(email.Attachments) > 0 {
+		// Returns nothing when the message already has attachments from an earlier attempt
+		saved, err := s.attachmentService.SaveAttachments(message, email.Attachments)
+		if err != nil {
+			// The message itself is saved - don't fail the event over attachments
+			log.Printf("Failed to save attachments for message %s: %v", message.ID, err)
+		}
+
+		// Read pricing out of quotes and buyer's orders without holding up the webhook
+		s.extractionService.ExtractAttachmentsAsync(message.UserID, saved)
+	}
+
+	// Propose any offers in the dealer's reply for the user to confirm
+	s.offerExtraction.ExtractMessageAsync(message)
+	s.summaries.RefreshAsync(message)
+
+	return message, nil
+}
+
+// GetEvent retrieves a webhook event
+func (s *InboundWebhookService) GetEvent(eventID uuid.UUID) (*models.WebhookEvent, error) {
+	var event models.WebhookEvent
+	if err := s.db.Where("id = ?", eventID).First(&event).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, errors.New("webhook event not found")
+		}
+		return nil, fmt.Errorf("database error: %w", err)
+	}
+
+	return &event, nil
+}
+
+// ListEvents lists webhook events, newest first, optionally filtered by status
+func (s *InboundWebhookService) ListEvents(status models.WebhookEventStatus, since time.Time, limit int) ([]models.WebhookEvent, error) {
+	query := s.db.Where("created_at >= ?", since)
+	if status != "" {
+		query = query.Where("status = ?", status)
+	}
+
+	var events []models.WebhookEvent
+	if err := query.Order("created_at DESC").Limit(limit).Find(&events).Error; err != nil {
+		return nil, fmt.Errorf("failed to retrieve webhook events: %w", err)
+	}
+
+	return events, nil
+}
+
+// ReplayEvent re-runs processing on a stored event. Events that failed verification can't
+// be replayed.
+func (s *InboundWebhookService) ReplayEvent(eventID uuid.UUID) (*models.WebhookEvent, error) {
+	event, err := s.GetEvent(eventID)
+	if err != nil {
+		return nil, err
+	}
+	if event.Status == models.WebhookEventStatusRejected {
+		return nil, errors.New("webhook event failed verification")
+	}
+
+	// The outcome is recorded on the event, so the processing error itself isn't returned
+	s.ProcessEvent(event)
+	return event, nil
+}
+
+// cloneValues copies query values so the caller's map isn't modified
+func cloneValues(values url.Values) url.Values {
+	clone := make(url.Values, len(values))
+	for key, v := range values {
+		clone[key] = append([]string(nil), v...)
+	}
+	return clone
+}
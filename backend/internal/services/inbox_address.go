@@ -0,0 +1,104 @@
+package services
+
+import (
+	"errors"
+	"fmt"
+	"net/mail"
+	"regexp"
+	"strings"
+
+	"carbuyer/internal/db/models"
+
+	"github.com/google/uuid"
+)
+
+// threadShortIDLength is the number of UUID hex characters used in a thread's plus-address tag
+const threadShortIDLength = 8
+
+var inboxAliasPattern = regexp.MustCompile(`^[a-z0-9]([a-z0-9.-]*[a-z0-9])?$`)
+
+// threadTagPattern matches a thread short ID as it appears in a plus-address tag
+var threadTagPattern = regexp.MustCompile(`^[0-9a-f]{8}$`)
+
+// InboundRecipient is a parsed Otto inbox address such as "jsmith+1a2b3c4d@inbound.example.com"
+type InboundRecipient struct {
+	LocalPart string // User alias or user UUID
+	Tag       string // Thread short ID from the plus-address, empty if none
+	Domain    string
+}
+
+// ThreadShortID returns the short identifier used to tag a thread's reply-to address
+func ThreadShortID(threadID uuid.UUID) string {
+	return threadID.String()[:threadShortIDLength]
+}
+
+// IsThreadTag reports whether a plus-address tag has the form of a thread short ID
+func IsThreadTag(tag string) bool {
+	return threadTagPattern.MatchString(tag)
+}
+
+// InboxLocalPart returns the friendly alias for a user if set, otherwise the user's UUID
+func InboxLocalPart(user *models.User) string {
+	if user.InboxAlias != nil && *user.InboxAlias != "" {
+		return *user.InboxAlias
+	}
+	return user.ID.String()
+}
+
+// ThreadReplyAddress builds the per-thread plus-address used as Reply-To on outbound email
+func ThreadReplyAddress(user *models.User, threadID uuid.UUID, domain string) string {
+	return fmt.Sprintf("%s+%s@%s", InboxLocalPart(user), ThreadShortID(threadID), domain)
+}
+
+// ParseInboundRecipient splits an inbound recipient address into its alias, thread tag and domain
+func ParseInboundRecipient(recipient string) (InboundRecipient, error) {
+	recipient = strings.TrimSpace(recipient)
+	if recipient == "" {
+		return InboundRecipient{}, errors.New("recipient is required")
+	}
+
+	// Accept both "Name <addr>" and bare addresses
+	if addr, err := mail.ParseAddress(recipient); err == nil {
+		recipient = addr.Address
+	}
+
+	at := strings.LastIndex(recipient, "@")
+	if at <= 0 || at == len(recipient)-1 {
+		return InboundRecipient{}, fmt.Errorf("invalid recipient address: %s", recipient)
+	}
+
+	local := strings.ToLower(recipient[:at])
+	parsed := InboundRecipient{
+		LocalPart: local,
+		Domain:    strings.ToLower(recipient[at+1:]),
+	}
+
+	if plus := strings.Index(local, "+"); plus >= 0 {
+		parsed.LocalPart = local[:plus]
+		parsed.Tag = local[plus+1:]
+	}
+
+	if parsed.LocalPart == "" {
+		return InboundRecipient{}, fmt.Errorf("invalid recipient address: %s", recipient)
+	}
+
+	return parsed, nil
+}
+
+// NormalizeInboxAlias lowercases and validates a user-chosen inbox alias
+func NormalizeInboxAlias(alias string) (string, error) {
+	alias = strings.ToLower(strings.TrimSpace(alias))
+
+	if len(alias) < 3 || len(alias) > 40 {
+		return "", errors.New("alias must be between 3 and 40 characters")
+	}
+	if !inboxAliasPattern.MatchString(alias) || strings.Contains(alias, "..") {
+		return "", errors.New("alias may only contain letters, numbers, dots and hyphens")
+	}
+	// UUID-shaped aliases would be ambiguous with the default addresses
+	if _, err := uuid.Parse(alias); err == nil {
+		return "", errors.New("alias cannot be a UUID")
+	}
+
+	return alias, nil
+}
@@ -0,0 +1,136 @@
+package services
+
+import (
+	"testing"
+
+	"carbuyer/internal/db/models"
+
+	"github.com/google/uuid"
+)
+
+func TestParseInboundRecipient(t *testing.T) {
+	tests := []struct {
+		name      string
+		recipient string
+		want      InboundRecipient
+		wantErr   bool
+	}{
+		{
+			name:      "UUID address",
+			recipient: "6f1c2d3e-0000-4000-8000-000000000001@inbound.otto.dev",
+			want:      InboundRecipient{LocalPart: "6f1c2d3e-0000-4000-8000-000000000001", Domain: "inbound.otto.dev"},
+		},
+		{
+			name:      "Alias with thread tag",
+			recipient: "JSmith+1A2B3C4D@Inbound.Otto.dev",
+			want:      InboundRecipient{LocalPart: "jsmith", Tag: "1a2b3c4d", Domain: "inbound.otto.dev"},
+		},
+		{
+			name:      "Display name form",
+			recipient: "Otto <jsmith+1a2b3c4d@inbound.otto.dev>",
+			want:      InboundRecipient{LocalPart: "jsmith", Tag: "1a2b3c4d", Domain: "inbound.otto.dev"},
+		},
+		{
+			name:      "Missing local part",
+			recipient: "+1a2b3c4d@inbound.otto.dev",
+			wantErr:   true,
+		},
+		{
+			name:      "Not an address",
+			recipient: "nobody",
+			wantErr:   true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := ParseInboundRecipient(tt.recipient)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("ParseInboundRecipient(%q) error = %v, wantErr %v", tt.recipient, err, tt.wantErr)
+			}
+			if !tt.wantErr && got != tt.want {
+				t.Errorf("ParseInboundRecipient(%q) = %+v, want %+v", tt.recipient, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestThreadReplyAddress(t *testing.T) {
+	threadID := uuid.MustParse("1a2b3c4d-5e6f-4000-8000-000000000000")
+	userID := uuid.MustParse("6f1c2d3e-0000-4000-8000-000000000001")
+	alias := "jsmith"
+
+	tests := []struct {
+		name string
+		user *models.User
+		want string
+	}{
+		{
+			name: "Falls back to user UUID",
+			user: &models.User{ID: userID},
+			want: "6f1c2d3e-0000-4000-8000-000000000001+1a2b3c4d@inbound.otto.dev",
+		},
+		{
+			name: "Uses friendly alias",
+			user: &models.User{ID: userID, InboxAlias: &alias},
+			want: "jsmith+1a2b3c4d@inbound.otto.dev",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := ThreadReplyAddress(tt.user, threadID, "inbound.otto.dev")
+			if got != tt.want {
+				t.Errorf("ThreadReplyAddress() = %q, want %q", got, tt.want)
+			}
+
+			// The generated address must round-trip through the inbound parser
+			parsed, err := ParseInboundRecipient(got)
+			if err != nil {
+				t.Fatalf("ParseInboundRecipient(%q) error = %v", got, err)
+			}
+			if parsed.Tag != ThreadShortID(threadID) {
+				t.Errorf("parsed tag = %q, want %q", parsed.Tag, ThreadShortID(threadID))
+			}
+			if !IsThreadTag(parsed.Tag) {
+				t.Errorf("IsThreadTag(%q) = false", parsed.Tag)
+			}
+		})
+	}
+}
+
+func TestIsThreadTag(t *testing.T) {
+	for _, tag := range []string{"", "%", "1a2b", "1a2b3c4%", "1a2b3c4_", "1A2B3C4D", "1a2b3c4d5", "ghijklmn"} {
+		if IsThreadTag(tag) {
+			t.Errorf("IsThreadTag(%q) = true, want false", tag)
+		}
+	}
+}
+
+func TestNormalizeInboxAlias(t *testing.T) {
+	tests := []struct {
+		alias   string
+		want    string
+		wantErr bool
+	}{
+		{alias: "  JSmith ", want: "jsmith"},
+		{alias: "jane.doe-2", want: "jane.doe-2"},
+		{alias: "ab", wantErr: true},
+		{alias: "jane+doe", wantErr: true},
+		{alias: "jane..doe", wantErr: true},
+		{alias: ".jane", wantErr: true},
+		{alias: "6f1c2d3e-0000-4000-8000-000000000001", wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.alias, func(t *testing.T) {
+			got, err := NormalizeInboxAlias(tt.alias)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("NormalizeInboxAlias(%q) error = %v, wantErr %v", tt.alias, err, tt.wantErr)
+			}
+			if got != tt.want {
+				t.Errorf("NormalizeInboxAlias(%q) = %q, want %q", tt.alias, got, tt.want)
+			}
+		})
+	}
+}
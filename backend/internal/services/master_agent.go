@@ -0,0 +1,676 @@
+package services
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"sort"
+	"strings"
+	"time"
+
+	"carbuyer/internal/db/models"
+	"carbuyer/internal/llm"
+
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+)
+
+// Limits for the master agent
+const (
+	masterHistoryMessages = 20  // Earlier messages of the master conversation sent with a request
+	masterPreviewChars    = 300 // Characters of each thread's latest message in the overview
+	masterSummaryChars    = 600 // Characters of each thread's summary in the overview
+	maxMasterDraftChars   = 5000
+)
+
+// masterThreadName is the seller name of master threads, which have no seller
+const masterThreadName = "All negotiations"
+
+// masterTools are the tools the master agent can call across the user's threads
+var masterTools = []llm.Tool{
+	{
+		Name:        "get_thread_messages",
+		Description: "Read the most recent messages in one of the buyer's seller threads, oldest first: the seller's messages, what the buyer sent, and the buyer's chat with that thread's agent, including unsent drafts.",
+		Properties: map[string]interface{}{
+			"threadId": map[string]interface{}{"type": "string", "description": "Thread ID from the overview"},
+			"limit":    map[string]interface{}{"type": "integer", "description": "Most messages to return, up to 30 (default 10)"},
+		},
+		Required: []string{"threadId"},
+	},
+	{
+		Name:        "list_offers",
+		Description: "List offers from every seller with their terms, cheapest out-the-door first. Offers without an out-the-door price come last.",
+		Properties: map[string]interface{}{
+			"includeInactive": map[string]interface{}{"type": "boolean", "description": "Also include expired, accepted and declined offers, and detected offers the buyer hasn't confirmed"},
+		},
+	},
+	{
+		Name:        "list_inbox",
+		Description: "List recent messages from sellers that aren't in a thread yet, newest first.",
+		Properties: map[string]interface{}{
+			"limit": map[string]interface{}{"type": "integer", "description": "Most messages to return, up to 20 (default 10)"},
+		},
+	},
+	{
+		Name:        "search_messages",
+		Description: "Search the messages of every seller thread for a word or phrase. Returns the newest matches first.",
+		Properties: map[string]interface{}{
+			"query": map[string]interface{}{"type": "string", "description": "Word or phrase to find, e.g. \"doc fee\""},
+			"limit": map[string]interface{}{"type": "integer", "description": "Most matches to return, up to 10 (default 5)"},
+		},
+		Required: []string{"query"},
+	},
+	{
+		Name:        "create_draft",
+		Description: "Save a message in a seller thread for the buyer to review and send. Nothing is sent to the seller.",
+		Properties: map[string]interface{}{
+			"threadId": map[string]interface{}{"type": "string", "description": "Thread ID from the overview"},
+			"content":  map[string]interface{}{"type": "string", "description": "The complete message to the seller, ready to send"},
+		},
+		Required: []string{"threadId", "content"},
+	},
+}
+
+// MasterReply is the master agent's response to the user, with any drafts it created in
+// seller threads
+type MasterReply struct {
+	UserMessage  *models.Message
+	AgentMessage *models.Message
+	Drafts       []models.Message
+}
+
+// MasterAgentService runs each user's master conversation: one agent that sees all their seller
+// threads, offers and inbox. It answers questions across negotiations, recommends next moves and
+// drafts messages in seller threads on command. The conversation is stored like any thread, in
+// a thread of type master.
+type MasterAgentService struct {
+	db  *gorm.DB
+	llm llm.LLM
+}
+
+// NewMasterAgentService creates a new master agent service
+func NewMasterAgentService(db *gorm.DB, llm llm.LLM) *MasterAgentService {
+	return &MasterAgentService{
+		db:  db,
+		llm: llm,
+	}
+}
+
+// GetThread returns the user's master thread, creating it the first time
+func (s *MasterAgentService) GetThread(userID uuid.UUID) (*models.Thread, error) {
+	var thread models.Thread
+	err := s.db.Where("user_id = ? AND type = ? AND deleted_at IS NULL", userID, models.ThreadTypeMaster).
+		Order("created_at ASC").
+		First(&thread).Error
+	if err == nil {
+		return &thread, nil
+	}
+	if !errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, fmt.Errorf("database error: %w", err)
+	}
+
+	thread = models.Thread{
+		UserID:     userID,
+		SellerName: masterThreadName,
+		SellerType: models.SellerTypeOther,
+		Type:       models.ThreadTypeMaster,
+	}
+	if err := s.db.Create(&thread).Error; err != nil {
+		return nil, fmt.Errorf("failed to create master thread: %w", err)
+	}
+	return &thread, nil
+}
+
+// GetMessages returns the master conversation, oldest first
+func (s *MasterAgentService) GetMessages(userID uuid.UUID, limit, offset int) (*models.Thread, []models.Message, int64, error) {
+	thread, err := s.GetThread(userID)
+	if err != nil {
+		return nil, nil, 0, err
+	}
+
+	var total int64
+	if err := s.db.Model(&models.Message{}).Where("thread_id = ?", thread.ID).Count(&total).Error; err != nil {
+		return nil, nil, 0, fmt.Errorf("failed to count messages: %w", err)
+	}
+
+	var messages []models.Message
+	query := s.db.Where("thread_id = ?", thread.ID).Order("timestamp ASC")
+	if limit > 0 {
+		query = query.Limit(limit).Offset(offset)
+	}
+	if err := query.Find(&messages).Error; err != nil {
+		return nil, nil, 0, fmt.Errorf("failed to retrieve messages: %w", err)
+	}
+
+	return thread, messages, total, nil
+}
+
+// SendMessage sends the user's message to the master agent and saves its response. The user's
+// message is kept even when the agent fails to respond.
+func (s *MasterAgentService) SendMessage(ctx context.Context, userID uuid.UUID, content string) (*MasterReply, error) {
+	content = strings.TrimSpace(content)
+	if content == "" {
+		return nil, errors.New("message content is required")
+	}
+
+	thread, err := s.GetThread(userID)
+	if err != nil {
+		return nil, err
+	}
+
+	// Earlier turns of the master conversation, oldest first
+	var history []models.Message
+	if err := s.db.Where("thread_id = ? AND deleted_at IS NULL", thread.ID).
+		Order("timestamp DESC").
+		Limit(masterHistoryMessages).
+		Find(&history).Error; err != nil {
+		return nil, fmt.Errorf("failed to load messages: %w", err)
+	}
+	for i, j := 0, len(history)-1; i < j; i, j = i+1, j-1 {
+		history[i], history[j] = history[j], history[i]
+	}
+
+	overview, err := s.overview(userID)
+	if err != nil {
+		return nil, err
+	}
+
+	reply := &MasterReply{
+		UserMessage: &models.Message{
+			UserID:    userID,
+			ThreadID:  &thread.ID,
+			Sender:    models.SenderTypeUser,
+			Content:   content,
+			Timestamp: time.Now(),
+		},
+	}
+	if err := saveThreadMessage(s.db, reply.UserMessage); err != nil {
+		return nil, err
+	}
+
+	req := masterAgentRequest(overview, history, content)
+	req.UserID = userID.String()
+	tools := &masterToolbox{db: s.db, userID: userID, threadID: thread.ID}
+	response, err := completeWithTools(ctx, s.llm, req, tools, nil)
+	reply.Drafts = tools.drafts
+	if err != nil {
+		return reply, fmt.Errorf("failed to generate agent response: %w", err)
+	}
+
+	reply.AgentMessage = &models.Message{
+		UserID:    userID,
+		ThreadID:  &thread.ID,
+		Sender:    models.SenderTypeAgent,
+		Content:   strings.TrimSpace(response.Text),
+		Timestamp: time.Now(),
+	}
+	if err := saveThreadMessage(s.db, reply.AgentMessage); err != nil {
+		return reply, err
+	}
+
+	return reply, nil
+}
+
+// masterThread is what the master agent's overview says about one seller thread
+type masterThread struct {
+	Thread  models.Thread
+	Latest  *models.Message // The latest message exchanged with the seller
+	Summary string
+	Offers  []models.TrackedOffer // Standing offers the buyer confirmed
+	Pending int                   // Detected offers waiting for the buyer's review
+}
+
+// overview loads the state of all the user's seller threads for the master agent
+func (s *MasterAgentService) overview(userID uuid.UUID) (string, error) {
+	var prefs *models.UserPreferences
+	var loaded models.UserPreferences
+	if err := s.db.Where("user_id = ?", userID).Preload("Make").Preload("Model").Preload("Trim").First(&loaded).Error; err == nil {
+		prefs = &loaded
+	} else if !errors.Is(err, gorm.ErrRecordNotFound) {
+		return "", fmt.Errorf("database error: %w", err)
+	}
+
+	var threads []models.Thread
+	if err := s.db.Where("user_id = ? AND type = ? AND deleted_at IS NULL", userID, models.ThreadTypeSeller).
+		Order("last_message_at DESC NULLS LAST, created_at DESC").
+		Preload("Strategy").
+		Find(&threads).Error; err != nil {
+		return "", fmt.Errorf("failed to load threads: %w", err)
+	}
+
+	overview := make([]masterThread, len(threads))
+	index := map[uuid.UUID]*masterThread{}
+	ids := make([]uuid.UUID, len(threads))
+	for i := range threads {
+		overview[i].Thread = threads[i]
+		index[threads[i].ID] = &overview[i]
+		ids[i] = threads[i].ID
+	}
+
+	if len(ids) > 0 {
+		var latest []models.Message
+		if err := s.db.Select("DISTINCT ON (thread_id) *").
+			Where("thread_id IN ? AND deleted_at IS NULL", ids).
+			Where(summarizedMessageCondition, models.SenderTypeSeller, models.MessageCategoryHuman, models.SenderTypeUser).
+			Order("thread_id, timestamp DESC").
+			Find(&latest).Error; err != nil {
+			return "", fmt.Errorf("failed to load messages: %w", err)
+		}
+		for i := range latest {
+			index[*latest[i].ThreadID].Latest = &latest[i]
+		}
+
+		var summaries []models.ThreadSummary
+		if err := s.db.Where("thread_id IN ?", ids).Find(&summaries).Error; err != nil {
+			return "", fmt.Errorf("failed to load summaries: %w", err)
+		}
+		for _, summary := range summaries {
+			index[summary.ThreadID].Summary = summary.Content
+		}
+
+		if err := ExpireOffers(s.db, userID); err != nil {
+			log.Printf("Failed to expire offers: %v", err)
+		}
+		var offers []models.TrackedOffer
+		if err := s.db.Where("thread_id IN ? AND review_status IN ?", ids, []models.OfferReviewStatus{models.OfferReviewConfirmed, models.OfferReviewPending}).
+			Where("status IN ?", []models.OfferStatus{models.OfferStatusActive, models.OfferStatusCountered}).
+			Order("tracked_at DESC").
+			Find(&offers).Error; err != nil {
+			return "", fmt.Errorf("failed to load offers: %w", err)
+		}
+		for _, offer := range offers {
+			if offer.ReviewStatus == models.OfferReviewPending {
+				index[offer.ThreadID].Pending++
+			} else {
+				index[offer.ThreadID].Offers = append(index[offer.ThreadID].Offers, offer)
+			}
+		}
+	}
+
+	var inbox int64
+	if err := s.db.Model(&models.Message{}).
+		Where(inboxCondition, userID, models.SenderTypeSeller).
+		Where(humanCategoryCondition, models.MessageCategoryHuman).
+		Count(&inbox).Error; err != nil {
+		return "", fmt.Errorf("failed to count inbox messages: %w", err)
+	}
+
+	return masterOverview(time.Now(), prefs, overview, inbox), nil
+}
+
+// masterOverview renders the state of the user's negotiations for the master agent
+func masterOverview(now time.Time, prefs *models.UserPreferences, threads []masterThread, inbox int64) string {
+	var b strings.Builder
+	fmt.Fprintf(&b, "Today is %s.\n", now.Format("Monday, 2006-01-02"))
+
+	if prefs == nil {
+		b.WriteString("The buyer hasn't set their vehicle preferences yet.\n")
+	} else {
+		vehicle := fmt.Sprintf("%d", prefs.Year)
+		if prefs.Make != nil {
+			vehicle += " " + prefs.Make.Name
+		}
+		if prefs.Model != nil {
+			vehicle += " " + prefs.Model.Name
+		}
+		if prefs.Trim != nil {
+			vehicle += " " + prefs.Trim.TrimName
+		}
+		fmt.Fprintf(&b, "The buyer wants a %s.\n", vehicle)
+	}
+
+	if len(threads) == 0 {
+		b.WriteString("\nThe buyer has no seller threads yet.\n")
+	} else {
+		fmt.Fprintf(&b, "\nSeller threads (%d), most recently active first:\n", len(threads))
+	}
+	for _, t := range threads {
+		fmt.Fprintf(&b, "\n- %s (%s) [thread %s]: %d messages", t.Thread.SellerName, t.Thread.SellerType, t.Thread.ID, t.Thread.MessageCount)
+		if t.Thread.LastMessageAt != nil {
+			fmt.Fprintf(&b, ", last activity %s", t.Thread.LastMessageAt.Format("2006-01-02"))
+		}
+		b.WriteString("\n")
+		if t.Thread.Strategy != nil {
+			fmt.Fprintf(&b, "  Strategy: %s\n", t.Thread.Strategy.Name)
+		}
+
+		if t.Latest != nil {
+			from := "the buyer, waiting on the seller"
+			if t.Latest.Sender == models.SenderTypeSeller {
+				from = "the seller, waiting on the buyer"
+			}
+			fmt.Fprintf(&b, "  Latest message (%s, from %s): %s\n", t.Latest.Timestamp.Format("2006-01-02"), from, truncateText(t.Latest.Content, masterPreviewChars))
+		} else {
+			b.WriteString("  Nothing exchanged with the seller yet\n")
+		}
+
+		for _, offer := range t.Offers {
+			terms := OfferSummary(&offer)
+			if terms == "" {
+				terms = offer.OfferText
+			}
+			fmt.Fprintf(&b, "  Offer (%s): %s\n", offer.Status, terms)
+		}
+		if t.Pending > 0 {
+			fmt.Fprintf(&b, "  %d detected offers waiting for the buyer's review\n", t.Pending)
+		}
+		if t.Summary != "" {
+			fmt.Fprintf(&b, "  Summary: %s\n", strings.ReplaceAll(truncateText(t.Summary, masterSummaryChars), "\n", "\n    "))
+		}
+	}
+
+	if inbox > 0 {
+		fmt.Fprintf(&b, "\nInbox: %d messages from sellers aren't in a thread yet.\n", inbox)
+	}
+	return b.String()
+}
+
+// truncateText caps text at n bytes, on a valid UTF-8 boundary
+func truncateText(text string, n int) string {
+	text = strings.TrimSpace(text)
+	if len(text) <= n {
+		return text
+	}
+	return strings.ToValidUTF8(text[:n], "") + "…"
+}
+
+// masterToolbox runs the master agent's tools across one user's seller threads, and keeps the
+// drafts it creates
+type masterToolbox struct {
+	db       *gorm.DB
+	userID   uuid.UUID
+	threadID uuid.UUID // The master thread, which tool calls are logged to
+	drafts   []models.Message
+}
+
+func (t *masterToolbox) call(ctx context.Context, round int, call llm.ToolCall) llm.Part {
+	return runLoggedTool(ctx, t.db, t.userID, t.threadID, round, call, t.run)
+}
+
+// run executes a tool call, returning its output as JSON
+func (t *masterToolbox) run(ctx context.Context, call llm.ToolCall) (string, error) {
+	if err := ctx.Err(); err != nil {
+		return "", err
+	}
+
+	var result interface{}
+	var err error
+	switch call.Name {
+	case "get_thread_messages":
+		result, err = t.getThreadMessages(call.Input)
+	case "list_offers":
+		result, err = t.listOffers(call.Input)
+	case "list_inbox":
+		result, err = t.listInbox(call.Input)
+	case "search_messages":
+		result, err = t.searchMessages(call.Input)
+	case "create_draft":
+		result, err = t.createDraft(call.Input)
+	default:
+		return "", fmt.Errorf("unknown tool %q", call.Name)
+	}
+	if err != nil {
+		return "", err
+	}
+
+	output, err := json.Marshal(result)
+	if err != nil {
+		return "", fmt.Errorf("failed to encode tool output: %w", err)
+	}
+	return string(output), nil
+}
+
+// sellerThread loads one of the user's seller threads by the ID the agent gave
+func (t *masterToolbox) sellerThread(id string) (*models.Thread, error) {
+	threadID, err := uuid.Parse(strings.TrimSpace(id))
+	if err != nil {
+		return nil, errors.New("threadId must be a thread ID from the overview")
+	}
+
+	var thread models.Thread
+	if err := t.db.Where("id = ? AND user_id = ? AND type = ? AND deleted_at IS NULL", threadID, t.userID, models.ThreadTypeSeller).First(&thread).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, errors.New("thread not found")
+		}
+		return nil, fmt.Errorf("database error: %w", err)
+	}
+	return &thread, nil
+}
+
+func (t *masterToolbox) getThreadMessages(raw json.RawMessage) (interface{}, error) {
+	var input struct {
+		ThreadID string `json:"threadId"`
+		Limit    int    `json:"limit"`
+	}
+	if err := decodeToolInput(raw, &input); err != nil {
+		return nil, err
+	}
+	if input.Limit <= 0 || input.Limit > 30 {
+		input.Limit = 10
+	}
+
+	thread, err := t.sellerThread(input.ThreadID)
+	if err != nil {
+		return nil, err
+	}
+
+	var messages []models.Message
+	if err := t.db.Where("thread_id = ? AND deleted_at IS NULL", thread.ID).
+		Order("timestamp DESC").
+		Limit(input.Limit).
+		Find(&messages).Error; err != nil {
+		return nil, fmt.Errorf("database error: %w", err)
+	}
+
+	results := make([]map[string]interface{}, len(messages))
+	for i, message := range messages {
+		result := map[string]interface{}{
+			"sender":    message.Sender,
+			"timestamp": message.Timestamp.UTC().Format("2006-01-02T15:04:05Z"),
+			"content":   truncateText(message.Content, 1500),
+		}
+		switch {
+		case message.Sender == models.SenderTypeAgent:
+			result["note"] = "draft by the thread's agent; may not have been sent"
+		case message.Sender == models.SenderTypeUser && message.ExternalMessageID == "":
+			result["note"] = "the buyer's chat with the thread's agent, not sent to the seller"
+		}
+		// Oldest first
+		results[len(messages)-1-i] = result
+	}
+	return map[string]interface{}{"seller": thread.SellerName, "messages": results}, nil
+}
+
+func (t *masterToolbox) listOffers(raw json.RawMessage) (interface{}, error) {
+	var input struct {
+		IncludeInactive bool `json:"includeInactive"`
+	}
+	if err := decodeToolInput(raw, &input); err != nil {
+		return nil, err
+	}
+
+	if err := ExpireOffers(t.db, t.userID); err != nil {
+		log.Printf("Failed to expire offers: %v", err)
+	}
+
+	query := t.db.Joins("JOIN threads ON threads.id = tracked_offers.thread_id").
+		Where("threads.user_id = ? AND threads.type = ? AND threads.deleted_at IS NULL", t.userID, models.ThreadTypeSeller)
+	if input.IncludeInactive {
+		query = query.Where("tracked_offers.review_status <> ?", models.OfferReviewRejected)
+	} else {
+		query = query.Where("tracked_offers.review_status = ?", models.OfferReviewConfirmed).
+			Where("tracked_offers.status IN ?", []models.OfferStatus{models.OfferStatusActive, models.OfferStatusCountered})
+	}
+
+	var offers []models.TrackedOffer
+	if err := query.Order("tracked_offers.tracked_at DESC").Limit(50).Preload("Thread").Find(&offers).Error; err != nil {
+		return nil, fmt.Errorf("database error: %w", err)
+	}
+	sortOffersByOutTheDoor(offers)
+
+	results := make([]map[string]interface{}, 0, len(offers))
+	for _, offer := range offers {
+		result := map[string]interface{}{
+			"threadId":  offer.ThreadID.String(),
+			"offer":     offer.OfferText,
+			"terms":     OfferSummary(&offer),
+			"status":    offer.Status,
+			"trackedAt": offer.TrackedAt.Format("2006-01-02"),
+		}
+		if offer.Thread != nil {
+			result["seller"] = offer.Thread.SellerName
+		}
+		if offer.ReviewStatus == models.OfferReviewPending {
+			result["unconfirmed"] = true
+		}
+		if offer.OutTheDoor != nil {
+			result["outTheDoor"] = *offer.OutTheDoor
+		}
+		results = append(results, result)
+	}
+	return map[string]interface{}{"offers": results}, nil
+}
+
+// sortOffersByOutTheDoor orders offers by out-the-door price, cheapest first, with offers
+// without one last. Ties keep their order.
+func sortOffersByOutTheDoor(offers []models.TrackedOffer) {
+	sort.SliceStable(offers, func(i, j int) bool {
+		a, b := offers[i].OutTheDoor, offers[j].OutTheDoor
+		if a == nil || b == nil {
+			return a != nil && b == nil
+		}
+		return *a < *b
+	})
+}
+
+func (t *masterToolbox) listInbox(raw json.RawMessage) (interface{}, error) {
+	var input struct {
+		Limit int `json:"limit"`
+	}
+	if err := decodeToolInput(raw, &input); err != nil {
+		return nil, err
+	}
+	if input.Limit <= 0 || input.Limit > 20 {
+		input.Limit = 10
+	}
+
+	var messages []models.Message
+	if err := t.db.Where(inboxCondition, t.userID, models.SenderTypeSeller).
+		Where(humanCategoryCondition, models.MessageCategoryHuman).
+		Order("timestamp DESC").
+		Limit(input.Limit).
+		Find(&messages).Error; err != nil {
+		return nil, fmt.Errorf("database error: %w", err)
+	}
+
+	results := make([]map[string]interface{}, 0, len(messages))
+	for _, message := range messages {
+		result := map[string]interface{}{
+			"from":      firstNonEmpty(message.SenderEmail, message.SenderPhone),
+			"subject":   message.Subject,
+			"timestamp": message.Timestamp.UTC().Format("2006-01-02T15:04:05Z"),
+			"content":   truncateText(message.Content, 1000),
+		}
+		if message.SuggestedThreadID != nil {
+			result["suggestedThreadId"] = message.SuggestedThreadID.String()
+		}
+		results = append(results, result)
+	}
+	return map[string]interface{}{"messages": results}, nil
+}
+
+func (t *masterToolbox) searchMessages(raw json.RawMessage) (interface{}, error) {
+	var input struct {
+		Query string `json:"query"`
+		Limit int    `json:"limit"`
+	}
+	if err := decodeToolInput(raw, &input); err != nil {
+		return nil, err
+	}
+	input.Query = strings.TrimSpace(input.Query)
+	if input.Query == "" {
+		return nil, errors.New("query is required")
+	}
+	if input.Limit <= 0 || input.Limit > 10 {
+		input.Limit = 5
+	}
+
+	var messages []models.Message
+	if err := t.db.Joins("JOIN threads ON threads.id = messages.thread_id").
+		Where("messages.user_id = ? AND threads.type = ? AND threads.deleted_at IS NULL", t.userID, models.ThreadTypeSeller).
+		Where("messages.deleted_at IS NULL AND messages.content ILIKE ?", likePattern(input.Query)).
+		Order("messages.timestamp DESC").
+		Limit(input.Limit).
+		Preload("Thread").
+		Find(&messages).Error; err != nil {
+		return nil, fmt.Errorf("database error: %w", err)
+	}
+
+	results := make([]map[string]interface{}, 0, len(messages))
+	for _, message := range messages {
+		result := map[string]interface{}{
+			"threadId":  message.ThreadID.String(),
+			"sender":    message.Sender,
+			"timestamp": message.Timestamp.UTC().Format("2006-01-02T15:04:05Z"),
+			"content":   truncateText(message.Content, 1500),
+		}
+		if message.Thread != nil {
+			result["seller"] = message.Thread.SellerName
+		}
+		results = append(results, result)
+	}
+	return map[string]interface{}{"messages": results}, nil
+}
+
+func (t *masterToolbox) createDraft(raw json.RawMessage) (interface{}, error) {
+	var input struct {
+		ThreadID string `json:"threadId"`
+		Content  string `json:"content"`
+	}
+	if err := decodeToolInput(raw, &input); err != nil {
+		return nil, err
+	}
+	content := stripDraftPreamble(input.Content)
+	if content == "" {
+		return nil, errors.New("content is required")
+	}
+	if len(content) > maxMasterDraftChars {
+		return nil, fmt.Errorf("content must be at most %d characters", maxMasterDraftChars)
+	}
+
+	thread, err := t.sellerThread(input.ThreadID)
+	if err != nil {
+		return nil, err
+	}
+
+	// The draft is an agent message in the seller thread, like the drafts its own agent writes
+	draft := models.Message{
+		UserID:    t.userID,
+		ThreadID:  &thread.ID,
+		Sender:    models.SenderTypeAgent,
+		Content:   content,
+		Timestamp: time.Now(),
+	}
+	if err := saveThreadMessage(t.db, &draft); err != nil {
+		return nil, err
+	}
+	t.drafts = append(t.drafts, draft)
+
+	return map[string]interface{}{
+		"draftId": draft.ID.String(),
+		"seller":  thread.SellerName,
+		"status":  "saved for the buyer to review and send",
+	}, nil
+}
+
+// firstNonEmpty returns the first of values that isn't empty
+func firstNonEmpty(values ...string) string {
+	for _, value := range values {
+		if value != "" {
+			return value
+		}
+	}
+	return ""
+}
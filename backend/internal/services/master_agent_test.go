@@ -0,0 +1,137 @@
+package services
+
+import (
+	"context"
+	"strings"
+	"testing"
+	"time"
+
+	"carbuyer/internal/db/models"
+	"carbuyer/internal/llm"
+
+	"github.com/google/uuid"
+)
+
+func TestMasterOverview(t *testing.T) {
+	now := time.Date(2025, 3, 10, 12, 0, 0, 0, time.UTC)
+	lastActive := now.Add(-24 * time.Hour)
+	otd := 36400.0
+	metro := uuid.New()
+
+	prefs := &models.UserPreferences{
+		Year:  2025,
+		Make:  &models.Make{Name: "Ford"},
+		Model: &models.Model{Name: "Maverick"},
+	}
+	threads := []masterThread{
+		{
+			Thread:  models.Thread{ID: metro, SellerName: "Metro Ford", SellerType: models.SellerTypeDealership, MessageCount: 6, LastMessageAt: &lastActive},
+			Latest:  &models.Message{Sender: models.SenderTypeSeller, Content: "Best we can do is $36,400 out the door.", Timestamp: lastActive},
+			Offers:  []models.TrackedOffer{{OfferText: "$36,400 OTD", Status: models.OfferStatusActive, OutTheDoor: &otd}},
+			Summary: "Prices:\n- Seller quoted $36,400 out the door",
+		},
+		{
+			Thread:  models.Thread{ID: uuid.New(), SellerName: "Eastside Ford", SellerType: models.SellerTypeDealership},
+			Pending: 2,
+		},
+	}
+
+	got := masterOverview(now, prefs, threads, 3)
+	for _, want := range []string{
+		"Today is Monday, 2025-03-10.",
+		"The buyer wants a 2025 Ford Maverick.",
+		"Seller threads (2)",
+		"- Metro Ford (dealership) [thread " + metro.String() + "]: 6 messages, last activity 2025-03-09",
+		"Latest message (2025-03-09, from the seller, waiting on the buyer): Best we can do",
+		"Offer (active): OTD $36,400",
+		"Summary: Prices:\n    - Seller quoted",
+		"Nothing exchanged with the seller yet",
+		"2 detected offers waiting for the buyer's review",
+		"Inbox: 3 messages",
+	} {
+		if !strings.Contains(got, want) {
+			t.Errorf("overview is missing %q:\n%s", want, got)
+		}
+	}
+
+	empty := masterOverview(now, nil, nil, 0)
+	if !strings.Contains(empty, "hasn't set their vehicle preferences") || !strings.Contains(empty, "no seller threads yet") || strings.Contains(empty, "Inbox") {
+		t.Errorf("empty overview = %q", empty)
+	}
+}
+
+func TestSortOffersByOutTheDoor(t *testing.T) {
+	price := func(p float64) *float64 { return &p }
+	offers := []models.TrackedOffer{
+		{OfferText: "none"},
+		{OfferText: "high", OutTheDoor: price(38900)},
+		{OfferText: "low", OutTheDoor: price(36400)},
+		{OfferText: "none too"},
+		{OfferText: "mid", OutTheDoor: price(37000)},
+	}
+
+	sortOffersByOutTheDoor(offers)
+
+	var got []string
+	for _, offer := range offers {
+		got = append(got, offer.OfferText)
+	}
+	if strings.Join(got, ",") != "low,mid,high,none,none too" {
+		t.Errorf("order = %v", got)
+	}
+}
+
+func TestTruncateText(t *testing.T) {
+	if got := truncateText("  short  ", 10); got != "short" {
+		t.Errorf("truncateText(short) = %q", got)
+	}
+	// "é" is two bytes - cutting through it mustn't leave half a rune
+	if got := truncateText("café au lait", 4); got != "caf…" {
+		t.Errorf("truncateText(split rune) = %q", got)
+	}
+}
+
+func TestMasterAgentRequest(t *testing.T) {
+	history := []models.Message{
+		{Sender: models.SenderTypeAgent, Content: "Dropped: the conversation must open with the buyer"},
+		{Sender: models.SenderTypeUser, Content: "Who is cheapest?"},
+		{Sender: models.SenderTypeAgent, Content: "Metro Ford at $36,400 out the door."},
+	}
+
+	req := masterAgentRequest("OVERVIEW", history, "Draft a counter to Metro Ford")
+
+	if req.Purpose != string(models.LLMPurposeMasterAgent) || len(req.Tools) != len(masterTools) {
+		t.Errorf("purpose = %s, %d tools", req.Purpose, len(req.Tools))
+	}
+	if !strings.Contains(req.System, "OVERVIEW") {
+		t.Error("system prompt is missing the overview")
+	}
+	if len(req.Messages) != 3 || req.Messages[0].Role != llm.RoleUser || req.Messages[1].Role != llm.RoleAssistant {
+		t.Fatalf("messages = %+v", req.Messages)
+	}
+	if req.Messages[2].Parts[0].Text != "Draft a counter to Metro Ford" {
+		t.Errorf("last message = %q", req.Messages[2].Parts[0].Text)
+	}
+}
+
+func TestMasterToolboxRejectsBadInput(t *testing.T) {
+	tools := &masterToolbox{}
+
+	tests := []struct {
+		tool  string
+		input string
+		want  string
+	}{
+		{"send_email", `{}`, "unknown tool"},
+		{"create_draft", `{"threadId": "not-a-thread", "content": "Hi"}`, "threadId must be a thread ID"},
+		{"create_draft", `{"threadId": "` + uuid.NewString() + `", "content": "  "}`, "content is required"},
+		{"search_messages", `{"query": ""}`, "query is required"},
+	}
+
+	for _, tt := range tests {
+		_, err := tools.run(context.Background(), llm.ToolCall{Name: tt.tool, Input: []byte(tt.input)})
+		if err == nil || !strings.Contains(err.Error(), tt.want) {
+			t.Errorf("%s(%s) error = %v, want %q", tt.tool, tt.input, err, tt.want)
+		}
+	}
+}
@@ -1,25 +1,34 @@
 package services
 
 import (
+	"context"
 	"errors"
 	"fmt"
+	"log"
 	"time"
 
 	"carbuyer/internal/db/models"
+	"carbuyer/internal/llm"
 
 	"github.com/google/uuid"
 	"gorm.io/gorm"
 )
 
 type MessageService struct {
-	db            *gorm.DB
-	claudeService *ClaudeService
+	db              *gorm.DB
+	llm             llm.LLM
+	offerExtraction *OfferExtractionService
+	summaries       *ThreadSummaryService
+	prompts         *PromptTemplateService
 }
 
-func NewMessageService(db *gorm.DB, claudeService *ClaudeService) *MessageService {
+func NewMessageService(db *gorm.DB, llm llm.LLM, offerExtraction *OfferExtractionService, summaries *ThreadSummaryService, prompts *PromptTemplateService) *MessageService {
 	return &MessageService{
-		db:            db,
-		claudeService: claudeService,
+		db:              db,
+		llm:             llm,
+		offerExtraction: offerExtraction,
+		summaries:       summaries,
+		prompts:         prompts,
 	}
 }
 
@@ -42,7 +51,10 @@ func (s *MessageService) GetThreadMessages(threadID, userID uuid.UUID, limit, of
 
 	// Get messages with pagination
 	var messages []models.Message
-	query := s.db.Where("thread_id = ?", threadID).Order("timestamp ASC")
+	query := s.db.Where("thread_id = ?", threadID).
+		Preload("Attachments").
+		Preload("Variants", func(db *gorm.DB) *gorm.DB { return db.Order("rank ASC") }).
+		Order("timestamp ASC")
 
 	if limit > 0 {
 		query = query.Limit(limit).Offset(offset)
@@ -55,44 +67,196 @@ func (s *MessageService) GetThreadMessages(threadID, userID uuid.UUID, limit, of
 	return messages, total, nil
 }
 
-// CreateUserMessage creates a user message and generates an agent response
-func (s *MessageService) CreateUserMessage(threadID, userID uuid.UUID, content string) (*models.Message, *models.Message, error) {
+// CreateUserMessage creates a user message and generates an agent response. With variants
+// above 1, the agent offers that many ranked drafts and the response shows the best one.
+func (s *MessageService) CreateUserMessage(threadID, userID uuid.UUID, content string, variants int) (*models.Message, *models.Message, error) {
 	// Validate input
 	if content == "" {
 		return nil, nil, errors.New("message content is required")
 	}
+	if variants < 0 || variants > maxDraftVariants {
+		return nil, nil, errTooManyVariants
+	}
+
+	negotiation, err := loadNegotiationContext(s.db, threadID, userID, content)
+	if err != nil {
+		return nil, nil, err
+	}
+	prompt, err := s.prompts.Prompt(models.LLMPurposeNegotiation, userID)
+	if err != nil {
+		return nil, nil, err
+	}
+	req, err := negotiation.request(prompt, content)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	// Create user message
+	userMessage := &models.Message{
+		UserID:    userID,
+		ThreadID:  &threadID,
+		Sender:    models.SenderTypeUser,
+		Content:   content,
+		Timestamp: time.Now(),
+	}
 
-	// Verify thread belongs to user and get user preferences
+	// Generate agent response, letting it look things up with tools
+	agentMessage, err := s.generateReply(context.Background(), req, prompt, threadID, userID, variants)
+	if err != nil {
+		// Still save user message even if agent fails
+		if err := s.db.Create(userMessage).Error; err != nil {
+			return nil, nil, fmt.Errorf("failed to create user message: %w", err)
+		}
+		return userMessage, nil, fmt.Errorf("failed to generate agent response: %w", err)
+	}
+
+	// Save both messages in a transaction
+	err = s.db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Create(userMessage).Error; err != nil {
+			return fmt.Errorf("failed to create user message: %w", err)
+		}
+
+		if err := tx.Create(agentMessage).Error; err != nil {
+			return fmt.Errorf("failed to create agent message: %w", err)
+		}
+
+		// Update thread message count and last message time
+		now := time.Now()
+		if err := tx.Model(&models.Thread{}).Where("id = ?", threadID).Updates(map[string]interface{}{
+			"message_count":   gorm.Expr("message_count + ?", 2),
+			"last_message_at": now,
+		}).Error; err != nil {
+			return fmt.Errorf("failed to update thread: %w", err)
+		}
+
+		return nil
+	})
+
+	if err != nil {
+		return nil, nil, err
+	}
+
+	return userMessage, agentMessage, nil
+}
+
+// negotiationContext is what the agent is told about a thread when responding to the user
+type negotiationContext struct {
+	userID        uuid.UUID
+	year          int
+	makeName      string
+	modelName     string
+	sellerName    string
+	summary       string // The thread's running summary of key facts
+	history       []models.Message
+	trackedOffers []models.TrackedOffer
+	strategy      *models.StrategyProfile // The thread's strategy profile; nil for the default approach
+	opening       bool                    // Nothing has been exchanged with the seller yet
+}
+
+// request builds the LLM request for an agent response to content with a negotiation prompt
+// template
+func (n *negotiationContext) request(prompt *Prompt, content string) (llm.Request, error) {
+	data := NegotiationPromptData{
+		Year:            n.year,
+		Make:            n.makeName,
+		Model:           n.modelName,
+		SellerName:      n.sellerName,
+		Summary:         n.summary,
+		CompetingOffers: len(n.trackedOffers),
+		UserMessage:     content,
+	}
+	req, err := negotiationRequest(prompt, data, strategyPrompt(n.strategy, data, n.opening), n.history)
+	if err != nil {
+		return llm.Request{}, err
+	}
+	req.UserID = n.userID.String()
+	return req, nil
+}
+
+// NegotiationTurn is one request to the negotiation agent, for generating a response outside a
+// thread
+type NegotiationTurn struct {
+	Data        NegotiationPromptData
+	History     []models.Message        // Earlier messages in the thread, oldest first
+	ToolOutputs map[string]string       // Results of the agent's tools by name; tools left out are unavailable
+	Model       llm.Model               // The negotiation model when empty
+	Strategy    *models.StrategyProfile // The thread's strategy profile, if any
+}
+
+// GenerateNegotiationResponse drafts the agent's response to a turn the way threads do, with
+// the same request and tool loop, but with fixed tool results instead of the database. The
+// evaluation harness replays recorded transcripts through it.
+func GenerateNegotiationResponse(ctx context.Context, model llm.LLM, prompt *Prompt, turn NegotiationTurn) (string, *llm.Response, error) {
+	opening := turn.Data.Summary == ""
+	for _, msg := range turn.History {
+		opening = opening && msg.Sender != models.SenderTypeSeller && msg.ExternalMessageID == ""
+	}
+	req, err := negotiationRequest(prompt, turn.Data, strategyPrompt(turn.Strategy, turn.Data, opening), turn.History)
+	if err != nil {
+		return "", nil, err
+	}
+	if turn.Model != "" {
+		req.Model = turn.Model
+	}
+
+	response, err := completeWithTools(ctx, model, req, cannedToolbox(turn.ToolOutputs), nil)
+	if err != nil {
+		return "", nil, err
+	}
+	return stripDraftPreamble(response.Text), response, nil
+}
+
+// loadNegotiationContext loads the user's preferences, the thread's summary and recent
+// messages, and the user's tracked offers for an agent response to content
+func loadNegotiationContext(db *gorm.DB, threadID, userID uuid.UUID, content string) (*negotiationContext, error) {
+	// Verify thread belongs to user and is with a seller, and get user preferences
 	var thread models.Thread
-	if err := s.db.Where("id = ? AND user_id = ?", threadID, userID).First(&thread).Error; err != nil {
+	if err := db.Where("id = ? AND user_id = ? AND type = ?", threadID, userID, models.ThreadTypeSeller).Preload("Strategy").First(&thread).Error; err != nil {
 		if errors.Is(err, gorm.ErrRecordNotFound) {
-			return nil, nil, errors.New("thread not found")
+			return nil, errors.New("thread not found")
 		}
-		return nil, nil, fmt.Errorf("database error: %w", err)
+		return nil, fmt.Errorf("database error: %w", err)
 	}
 
 	// Get user preferences for context with relationships
 	var prefs models.UserPreferences
-	if err := s.db.Where("user_id = ?", userID).
+	if err := db.Where("user_id = ?", userID).
 		Preload("Make").
 		Preload("Model").
 		First(&prefs).Error; err != nil {
-		return nil, nil, fmt.Errorf("failed to get user preferences: %w", err)
+		return nil, fmt.Errorf("failed to get user preferences: %w", err)
 	}
 
 	// Get recent message history for context
 	var recentMessages []models.Message
-	s.db.Where("thread_id = ?", threadID).Order("timestamp DESC").Limit(10).Find(&recentMessages)
+	db.Where("thread_id = ?", threadID).Order("timestamp DESC").Limit(10).Find(&recentMessages)
 
 	// Reverse to chronological order
 	for i, j := 0, len(recentMessages)-1; i < j; i, j = i+1, j-1 {
 		recentMessages[i], recentMessages[j] = recentMessages[j], recentMessages[i]
 	}
 
-	// Get tracked offers from all user's threads for competitive context
+	// The summary keeps facts from messages too old to be in the history. A thread may not
+	// have one yet.
+	var summary models.ThreadSummary
+	db.Where("thread_id = ?", threadID).Limit(1).Find(&summary)
+
+	// The strategy's opening is for the first message to the seller
+	var exchanged int64
+	db.Model(&models.Message{}).
+		Where("thread_id = ? AND deleted_at IS NULL", threadID).
+		Where(summarizedMessageCondition, models.SenderTypeSeller, models.MessageCategoryHuman, models.SenderTypeUser).
+		Count(&exchanged)
+
+	// Get tracked offers from all user's threads for competitive context. Detected offers
+	// are only used once the user confirms them, and only standing offers are leverage.
+	if err := ExpireOffers(db, userID); err != nil {
+		log.Printf("Failed to expire offers: %v", err)
+	}
 	var trackedOffers []models.TrackedOffer
-	s.db.Joins("JOIN threads ON threads.id = tracked_offers.thread_id").
-		Where("threads.user_id = ?", userID).
+	db.Joins("JOIN threads ON threads.id = tracked_offers.thread_id").
+		Where("threads.user_id = ? AND tracked_offers.review_status = ?", userID, models.OfferReviewConfirmed).
+		Where("tracked_offers.status IN ?", []models.OfferStatus{models.OfferStatusActive, models.OfferStatusCountered}).
 		Order("tracked_offers.tracked_at DESC").
 		Limit(20).
 		Preload("Thread").
@@ -135,7 +299,49 @@ func (s *MessageService) CreateUserMessage(threadID, userID uuid.UUID, content s
 	}
 	fmt.Printf("==========================================\n\n")
 
-	// Create user message
+	return &negotiationContext{
+		userID:        userID,
+		year:          prefs.Year,
+		makeName:      makeName,
+		modelName:     modelName,
+		sellerName:    thread.SellerName,
+		summary:       summary.Content,
+		history:       recentMessages,
+		trackedOffers: trackedOffers,
+		strategy:      thread.Strategy,
+		opening:       exchanged == 0,
+	}, nil
+}
+
+// StreamUserMessage creates a user message and streams the agent's response, calling onUser
+// once the user message is saved and onDelta with each piece of the response as it is
+// generated. Tool calls run between pieces. The agent message is saved once the response is
+// complete. Cancelling ctx stops
+// generation; the user message is kept, as it is when CreateUserMessage fails to get a response.
+func (s *MessageService) StreamUserMessage(
+	ctx context.Context,
+	threadID, userID uuid.UUID,
+	content string,
+	onUser func(*models.Message),
+	onDelta func(text string),
+) (*models.Message, *models.Message, error) {
+	if content == "" {
+		return nil, nil, errors.New("message content is required")
+	}
+
+	negotiation, err := loadNegotiationContext(s.db, threadID, userID, content)
+	if err != nil {
+		return nil, nil, err
+	}
+	prompt, err := s.prompts.Prompt(models.LLMPurposeNegotiation, userID)
+	if err != nil {
+		return nil, nil, err
+	}
+	req, err := negotiation.request(prompt, content)
+	if err != nil {
+		return nil, nil, err
+	}
+
 	userMessage := &models.Message{
 		UserID:    userID,
 		ThreadID:  &threadID,
@@ -143,61 +349,49 @@ func (s *MessageService) CreateUserMessage(threadID, userID uuid.UUID, content s
 		Content:   content,
 		Timestamp: time.Now(),
 	}
+	if err := saveThreadMessage(s.db, userMessage); err != nil {
+		return nil, nil, err
+	}
+	onUser(userMessage)
 
-	// Generate agent response using Claude
-	agentContent, err := s.claudeService.GenerateNegotiationResponse(
-		content,
-		prefs.Year,
-		makeName,
-		modelName,
-		thread.SellerName,
-		recentMessages,
-		trackedOffers,
-	)
+	response, err := completeWithTools(ctx, s.llm, req, newNegotiationToolbox(s.db, userID, threadID), onDelta)
 	if err != nil {
-		// Still save user message even if agent fails
-		if err := s.db.Create(userMessage).Error; err != nil {
-			return nil, nil, fmt.Errorf("failed to create user message: %w", err)
-		}
 		return userMessage, nil, fmt.Errorf("failed to generate agent response: %w", err)
 	}
+	agentContent := stripDraftPreamble(response.Text)
 
-	// Create agent message
 	agentMessage := &models.Message{
-		UserID:    userID,
-		ThreadID:  &threadID,
-		Sender:    models.SenderTypeAgent,
-		Content:   agentContent,
-		Timestamp: time.Now(),
+		UserID:           userID,
+		ThreadID:         &threadID,
+		Sender:           models.SenderTypeAgent,
+		Content:          agentContent,
+		Timestamp:        time.Now(),
+		PromptTemplateID: prompt.TemplateID,
+		PromptVersion:    prompt.Version,
+	}
+	if err := saveThreadMessage(s.db, agentMessage); err != nil {
+		return userMessage, nil, err
 	}
 
-	// Save both messages in a transaction
-	err = s.db.Transaction(func(tx *gorm.DB) error {
-		if err := tx.Create(userMessage).Error; err != nil {
-			return fmt.Errorf("failed to create user message: %w", err)
-		}
+	return userMessage, agentMessage, nil
+}
 
-		if err := tx.Create(agentMessage).Error; err != nil {
-			return fmt.Errorf("failed to create agent message: %w", err)
+// saveThreadMessage saves a message and updates its thread's message count and last message time
+func saveThreadMessage(db *gorm.DB, message *models.Message) error {
+	return db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Create(message).Error; err != nil {
+			return fmt.Errorf("failed to create %s message: %w", message.Sender, err)
 		}
 
-		// Update thread message count and last message time
-		now := time.Now()
-		if err := tx.Model(&models.Thread{}).Where("id = ?", threadID).Updates(map[string]interface{}{
-			"message_count":   gorm.Expr("message_count + ?", 2),
-			"last_message_at": now,
+		if err := tx.Model(&models.Thread{}).Where("id = ?", *message.ThreadID).Updates(map[string]interface{}{
+			"message_count":   gorm.Expr("message_count + ?", 1),
+			"last_message_at": message.Timestamp,
 		}).Error; err != nil {
 			return fmt.Errorf("failed to update thread: %w", err)
 		}
 
 		return nil
 	})
-
-	if err != nil {
-		return nil, nil, err
-	}
-
-	return userMessage, agentMessage, nil
 }
 
 // CreateSellerMessage creates a seller message (for manual testing)
@@ -247,20 +441,43 @@ func (s *MessageService) CreateSellerMessage(threadID, userID uuid.UUID, content
 		return nil, err
 	}
 
+	s.offerExtraction.ExtractMessageAsync(sellerMessage)
+	s.summaries.RefreshAsync(sellerMessage)
+
 	return sellerMessage, nil
 }
 
-// GetInboxMessages retrieves messages with null thread_id (inbox messages) that are not deleted
-func (s *MessageService) GetInboxMessages(userID uuid.UUID, limit, offset int) ([]models.Message, int64, error) {
+// Inbox views accepted by GetInboxMessages, besides a single category name
+const (
+	InboxViewDefault  = ""         // Human replies only
+	InboxViewFiltered = "filtered" // Auto-replies, marketing and spam
+	InboxViewAll      = "all"
+)
+
+// inboxCondition matches received messages not yet assigned to a thread. Replies sent from an
+// inbox message share its (empty) thread but aren't inbox items.
+const inboxCondition = "user_id = ? AND thread_id IS NULL AND deleted_at IS NULL AND sender = ?"
+
+// humanCategoryCondition matches human replies, including messages stored before classification
+const humanCategoryCondition = "(category IS NULL OR category IN ('', ?))"
+
+// GetInboxMessages retrieves messages with null thread_id (inbox messages) that are not deleted.
+// view selects which categories to include; by default only human replies are returned.
+func (s *MessageService) GetInboxMessages(userID uuid.UUID, view string, limit, offset int) ([]models.Message, int64, error) {
+	scope, err := inboxViewScope(view)
+	if err != nil {
+		return nil, 0, err
+	}
+
 	// Get total count of inbox messages (excluding deleted)
 	var total int64
-	if err := s.db.Model(&models.Message{}).Where("user_id = ? AND thread_id IS NULL AND deleted_at IS NULL", userID).Count(&total).Error; err != nil {
+	if err := s.db.Model(&models.Message{}).Where(inboxCondition, userID, models.SenderTypeSeller).Scopes(scope).Count(&total).Error; err != nil {
 		return nil, 0, fmt.Errorf("failed to count inbox messages: %w", err)
 	}
 
 	// Get inbox messages with pagination, ordered by timestamp descending (newest first), excluding deleted
 	var messages []models.Message
-	query := s.db.Where("user_id = ? AND thread_id IS NULL AND deleted_at IS NULL", userID).Order("timestamp DESC")
+	query := s.db.Where(inboxCondition, userID, models.SenderTypeSeller).Scopes(scope).Preload("Attachments").Order("timestamp DESC")
 
 	if limit > 0 {
 		query = query.Limit(limit).Offset(offset)
@@ -273,11 +490,71 @@ func (s *MessageService) GetInboxMessages(userID uuid.UUID, limit, offset int) (
 	return messages, total, nil
 }
 
+// CountFilteredInboxMessages counts inbox messages hidden from the default view
+func (s *MessageService) CountFilteredInboxMessages(userID uuid.UUID) (int64, error) {
+	scope, _ := inboxViewScope(InboxViewFiltered)
+
+	var count int64
+	if err := s.db.Model(&models.Message{}).Where(inboxCondition, userID, models.SenderTypeSeller).Scopes(scope).Count(&count).Error; err != nil {
+		return 0, fmt.Errorf("failed to count filtered inbox messages: %w", err)
+	}
+
+	return count, nil
+}
+
+// inboxViewScope returns the category filter for an inbox view
+func inboxViewScope(view string) (func(*gorm.DB) *gorm.DB, error) {
+	switch view {
+	case InboxViewDefault:
+		return func(db *gorm.DB) *gorm.DB {
+			return db.Where(humanCategoryCondition, models.MessageCategoryHuman)
+		}, nil
+	case InboxViewFiltered:
+		return func(db *gorm.DB) *gorm.DB {
+			return db.Where("NOT "+humanCategoryCondition, models.MessageCategoryHuman)
+		}, nil
+	case InboxViewAll:
+		return func(db *gorm.DB) *gorm.DB { return db }, nil
+	}
+
+	category, ok := ParseMessageCategory(view)
+	if !ok {
+		return nil, errors.New("invalid inbox category")
+	}
+	if category == models.MessageCategoryHuman {
+		return inboxViewScope(InboxViewDefault)
+	}
+	return func(db *gorm.DB) *gorm.DB {
+		return db.Where("category = ?", category)
+	}, nil
+}
+
+// SetMessageCategory records the user's correction of an inbound message's category. Later
+// emails from the same sender follow the correction.
+func (s *MessageService) SetMessageCategory(messageID, userID uuid.UUID, category models.MessageCategory) (*models.Message, error) {
+	var message models.Message
+	if err := s.db.Where("id = ? AND user_id = ? AND sender = ? AND deleted_at IS NULL", messageID, userID, models.SenderTypeSeller).First(&message).Error; err != nil {
+		if err == gorm.ErrRecordNotFound {
+			return nil, errors.New("message not found")
+		}
+		return nil, fmt.Errorf("failed to verify message: %w", err)
+	}
+
+	message.Category = category
+	message.CategorySource = models.MessageCategorySourceUser
+	message.CategoryReason = ""
+	if err := s.db.Save(&message).Error; err != nil {
+		return nil, fmt.Errorf("failed to update message category: %w", err)
+	}
+
+	return &message, nil
+}
+
 // AssignInboxMessageToThread assigns an inbox message to a thread
 func (s *MessageService) AssignInboxMessageToThread(messageID, threadID, userID uuid.UUID) error {
-	// Verify the thread exists and belongs to the user
+	// Verify the thread exists, belongs to the user and is with a seller
 	var thread models.Thread
-	if err := s.db.Where("id = ? AND user_id = ?", threadID, userID).First(&thread).Error; err != nil {
+	if err := s.db.Where("id = ? AND user_id = ? AND type = ?", threadID, userID, models.ThreadTypeSeller).First(&thread).Error; err != nil {
 		if err == gorm.ErrRecordNotFound {
 			return fmt.Errorf("thread not found")
 		}
@@ -293,12 +570,17 @@ func (s *MessageService) AssignInboxMessageToThread(messageID, threadID, userID
 		return fmt.Errorf("failed to verify message: %w", err)
 	}
 
-	// Assign the message to the thread
+	// Assign the message to the thread and clear any matcher suggestion
 	message.ThreadID = &threadID
+	message.SuggestedThreadID = nil
 	if err := s.db.Save(&message).Error; err != nil {
 		return fmt.Errorf("failed to assign message to thread: %w", err)
 	}
 
+	// Offers are only read from messages in a thread, so look now
+	s.offerExtraction.ExtractMessageAsync(&message)
+	s.summaries.RefreshAsync(&message)
+
 	return nil
 }
 
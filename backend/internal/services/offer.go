@@ -0,0 +1,176 @@
+package services
+
+import (
+	"errors"
+	"fmt"
+	"regexp"
+	"strings"
+	"time"
+
+	"carbuyer/internal/db/models"
+
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+)
+
+// vinPattern matches a 17 character VIN. VINs never use I, O or Q.
+var vinPattern = regexp.MustCompile(`^[A-HJ-NPR-Z0-9]{17}$`)
+
+// Limits offer terms are validated against
+const (
+	maxOfferAmount = 10_000_000
+	maxOfferAPR    = 40
+	maxOfferTerm   = 120 // Months
+)
+
+// ParseOfferStatus validates an offer status
+func ParseOfferStatus(value string) (models.OfferStatus, bool) {
+	status := models.OfferStatus(strings.ToLower(strings.TrimSpace(value)))
+	switch status {
+	case models.OfferStatusActive, models.OfferStatusExpired, models.OfferStatusCountered, models.OfferStatusAccepted, models.OfferStatusDeclined:
+		return status, true
+	}
+	return "", false
+}
+
+// ParseFinanceType validates a finance type
+func ParseFinanceType(value string) (models.FinanceType, bool) {
+	financeType := models.FinanceType(strings.ToLower(strings.TrimSpace(value)))
+	switch financeType {
+	case models.FinanceTypeCash, models.FinanceTypeFinance, models.FinanceTypeLease:
+		return financeType, true
+	}
+	return "", false
+}
+
+// NormalizeVIN uppercases a VIN and strips spaces and dashes
+func NormalizeVIN(vin string) string {
+	return strings.ToUpper(strings.NewReplacer(" ", "", "-", "").Replace(strings.TrimSpace(vin)))
+}
+
+// ValidateOffer checks an offer's terms. VIN should already be normalized.
+func ValidateOffer(offer *models.TrackedOffer) error {
+	amounts := []struct {
+		name  string
+		value *float64
+	}{
+		{"vehiclePrice", offer.VehiclePrice},
+		{"dealerAddOns", offer.DealerAddOns},
+		{"docFee", offer.DocFee},
+		{"taxes", offer.Taxes},
+		{"registration", offer.Registration},
+		{"rebates", offer.Rebates},
+		{"outTheDoor", offer.OutTheDoor},
+		{"monthlyPayment", offer.MonthlyPayment},
+		{"dueAtSigning", offer.DueAtSigning},
+	}
+	for _, amount := range amounts {
+		if amount.value != nil && (*amount.value < 0 || *amount.value > maxOfferAmount) {
+			return fmt.Errorf("%s must be between 0 and %d", amount.name, maxOfferAmount)
+		}
+	}
+
+	if offer.APR != nil && (*offer.APR < 0 || *offer.APR > maxOfferAPR) {
+		return fmt.Errorf("apr must be between 0 and %d", maxOfferAPR)
+	}
+	if offer.TermMonths != nil && (*offer.TermMonths <= 0 || *offer.TermMonths > maxOfferTerm) {
+		return fmt.Errorf("termMonths must be between 1 and %d", maxOfferTerm)
+	}
+	if offer.AnnualMileage != nil && *offer.AnnualMileage <= 0 {
+		return errors.New("annualMileage must be positive")
+	}
+	if offer.AnnualMileage != nil && offer.FinanceType != models.FinanceTypeLease {
+		return errors.New("annualMileage only applies to leases")
+	}
+	if offer.APR != nil && offer.FinanceType == models.FinanceTypeCash {
+		return errors.New("apr doesn't apply to cash offers")
+	}
+
+	if offer.VIN != "" && !vinPattern.MatchString(offer.VIN) {
+		return errors.New("vin must be 17 letters and digits, without I, O or Q")
+	}
+	if len(offer.StockNumber) > 40 {
+		return errors.New("stockNumber must be at most 40 characters")
+	}
+
+	if offer.VehiclePrice == nil && offer.OutTheDoor == nil && offer.MonthlyPayment == nil && offer.APR == nil &&
+		strings.TrimSpace(offer.OfferText) == "" {
+		return errors.New("offerText or a price is required")
+	}
+
+	return nil
+}
+
+// OfferSummary renders an offer's terms as text
+func OfferSummary(offer *models.TrackedOffer) string {
+	summary := (&QuoteExtraction{
+		VehiclePrice: offer.VehiclePrice,
+		DealerAddOns: offer.DealerAddOns,
+		DocFee:       offer.DocFee,
+		Taxes:        offer.Taxes,
+		Registration: offer.Registration,
+		Rebates:      offer.Rebates,
+		OutTheDoor:   offer.OutTheDoor,
+	}).OfferSummary()
+
+	var terms []string
+	if offer.FinanceType == models.FinanceTypeLease {
+		terms = append(terms, "Lease")
+	}
+	if offer.MonthlyPayment != nil {
+		terms = append(terms, fmt.Sprintf("$%s/mo", formatDollars(*offer.MonthlyPayment)))
+	}
+	if offer.APR != nil {
+		terms = append(terms, fmt.Sprintf("%s%% APR", strings.TrimSuffix(strings.TrimRight(fmt.Sprintf("%.2f", *offer.APR), "0"), ".")))
+	}
+	if offer.TermMonths != nil {
+		terms = append(terms, fmt.Sprintf("%d months", *offer.TermMonths))
+	}
+	if offer.DueAtSigning != nil {
+		terms = append(terms, fmt.Sprintf("$%s due at signing", formatDollars(*offer.DueAtSigning)))
+	}
+	if offer.AnnualMileage != nil {
+		terms = append(terms, fmt.Sprintf("%s mi/yr", formatDollars(float64(*offer.AnnualMileage))))
+	}
+
+	parts := []string{}
+	if summary != "" {
+		parts = append(parts, summary)
+	}
+	if len(terms) > 0 {
+		if summary != "" {
+			parts[len(parts)-1] += ";"
+		}
+		parts = append(parts, strings.Join(terms, ", "))
+	}
+	if offer.ExpiresAt != nil {
+		parts = append(parts, "(expires "+offer.ExpiresAt.UTC().Format("2006-01-02")+")")
+	}
+
+	return strings.Join(parts, " ")
+}
+
+// ExpireOffers marks the user's active offers that are past their expiration as expired
+func ExpireOffers(db *gorm.DB, userID uuid.UUID) error {
+	err := db.Model(&models.TrackedOffer{}).
+		Where("status = ? AND expires_at < ?", models.OfferStatusActive, time.Now()).
+		Where("thread_id IN (?)", db.Model(&models.Thread{}).Select("id").Where("user_id = ?", userID)).
+		Updates(map[string]interface{}{
+			"status":     models.OfferStatusExpired,
+			"updated_at": time.Now(),
+		}).Error
+	if err != nil {
+		return fmt.Errorf("failed to expire offers: %w", err)
+	}
+	return nil
+}
+
+// expiresEndOfDay returns the end of a YYYY-MM-DD date, when offers dated that day expire
+func expiresEndOfDay(date string) *time.Time {
+	day, err := time.Parse("2006-01-02", date)
+	if err != nil {
+		return nil
+	}
+	end := day.Add(24*time.Hour - time.Second)
+	return &end
+}
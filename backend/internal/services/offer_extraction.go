@@ -0,0 +1,298 @@
+package services
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"math"
+	"strings"
+	"sync"
+	"time"
+
+	"carbuyer/internal/db/models"
+	"carbuyer/internal/llm"
+
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+)
+
+// maxDetectedOffers caps how many offers are proposed from a single message
+const maxDetectedOffers = 3
+
+// DetectedOffer is an offer read from a seller's message. Only terms the seller stated are set.
+type DetectedOffer struct {
+	Vehicle        string   `json:"vehicle,omitempty"`
+	VehiclePrice   *float64 `json:"vehiclePrice,omitempty"`
+	DealerAddOns   *float64 `json:"dealerAddOns,omitempty"`
+	DocFee         *float64 `json:"docFee,omitempty"`
+	Taxes          *float64 `json:"taxes,omitempty"`
+	Registration   *float64 `json:"registration,omitempty"`
+	Rebates        *float64 `json:"rebates,omitempty"`
+	OutTheDoor     *float64 `json:"outTheDoor,omitempty"`
+	FinanceType    string   `json:"financeType,omitempty"`
+	APR            *float64 `json:"apr,omitempty"`
+	TermMonths     *int     `json:"termMonths,omitempty"`
+	MonthlyPayment *float64 `json:"monthlyPayment,omitempty"`
+	DueAtSigning   *float64 `json:"dueAtSigning,omitempty"`
+	ExpiresAt      string   `json:"expiresAt,omitempty"` // YYYY-MM-DD
+	Quote          string   `json:"quote,omitempty"`     // The seller's words
+}
+
+// ParseOfferExtraction parses the LLM's offer extraction JSON. Offers without a price or
+// payment are dropped, and amounts are normalized.
+func ParseOfferExtraction(response string) ([]DetectedOffer, error) {
+	var parsed struct {
+		Offers []DetectedOffer `json:"offers"`
+	}
+	if err := llm.DecodeJSON(response, &parsed); err != nil {
+		return nil, err
+	}
+
+	var offers []DetectedOffer
+	for _, offer := range parsed.Offers {
+		offer.normalize()
+		if !offer.hasTerms() {
+			continue
+		}
+		offers = append(offers, offer)
+		if len(offers) == maxDetectedOffers {
+			break
+		}
+	}
+
+	return offers, nil
+}
+
+// normalize cleans up amounts and drops values that can't be right
+func (o *DetectedOffer) normalize() {
+	amount := func(v *float64) *float64 {
+		if v == nil || *v == 0 || math.IsNaN(*v) || math.IsInf(*v, 0) {
+			return nil
+		}
+		rounded := math.Round(math.Abs(*v)*100) / 100
+		return &rounded
+	}
+
+	o.Vehicle = strings.TrimSpace(o.Vehicle)
+	o.VehiclePrice = amount(o.VehiclePrice)
+	o.DealerAddOns = amount(o.DealerAddOns)
+	o.DocFee = amount(o.DocFee)
+	o.Taxes = amount(o.Taxes)
+	o.Registration = amount(o.Registration)
+	o.Rebates = amount(o.Rebates)
+	o.OutTheDoor = amount(o.OutTheDoor)
+	o.MonthlyPayment = amount(o.MonthlyPayment)
+	o.DueAtSigning = amount(o.DueAtSigning)
+
+	// 0% APR is a real offer, but anything past 40% is a misread
+	if o.APR != nil && (*o.APR < 0 || *o.APR > 40) {
+		o.APR = nil
+	}
+	if o.TermMonths != nil && (*o.TermMonths <= 0 || *o.TermMonths > 120) {
+		o.TermMonths = nil
+	}
+
+	financeType, _ := ParseFinanceType(o.FinanceType)
+	o.FinanceType = string(financeType)
+
+	if _, err := time.Parse("2006-01-02", o.ExpiresAt); err != nil {
+		o.ExpiresAt = ""
+	}
+	o.Quote = strings.TrimSpace(o.Quote)
+}
+
+// hasTerms reports whether the offer states a price or a payment
+func (o *DetectedOffer) hasTerms() bool {
+	return o.VehiclePrice != nil || o.OutTheDoor != nil || o.MonthlyPayment != nil || o.APR != nil
+}
+
+// Apply copies the offer's terms onto a TrackedOffer
+func (o *DetectedOffer) Apply(offer *models.TrackedOffer) {
+	offer.VehiclePrice = o.VehiclePrice
+	offer.DealerAddOns = o.DealerAddOns
+	offer.DocFee = o.DocFee
+	offer.Taxes = o.Taxes
+	offer.Registration = o.Registration
+	offer.Rebates = o.Rebates
+	offer.OutTheDoor = o.OutTheDoor
+	offer.FinanceType = models.FinanceType(o.FinanceType)
+	offer.APR = o.APR
+	offer.TermMonths = o.TermMonths
+	offer.MonthlyPayment = o.MonthlyPayment
+	offer.DueAtSigning = o.DueAtSigning
+	offer.ExpiresAt = expiresEndOfDay(o.ExpiresAt)
+}
+
+// OfferSummary renders the offer as text for a TrackedOffer
+func (o *DetectedOffer) OfferSummary() string {
+	var offer models.TrackedOffer
+	o.Apply(&offer)
+
+	summary := OfferSummary(&offer)
+	if o.Vehicle != "" {
+		summary = o.Vehicle + ": " + summary
+	}
+	return summary
+}
+
+// OfferExtractionService reads offers out of seller messages and proposes them as pending
+// TrackedOffers for the user to confirm or reject
+type OfferExtractionService struct {
+	db         *gorm.DB
+	llm        llm.LLM
+	background sync.WaitGroup
+}
+
+// NewOfferExtractionService creates a new offer extraction service
+func NewOfferExtractionService(db *gorm.DB, llm llm.LLM) *OfferExtractionService {
+	return &OfferExtractionService{
+		db:  db,
+		llm: llm,
+	}
+}
+
+// ExtractMessageAsync looks for offers in a seller message in the background. Messages
+// outside a thread, from anyone but the seller, or filtered out of the inbox are skipped.
+// A nil service does nothing, so callers without offer extraction can pass nil.
+func (s *OfferExtractionService) ExtractMessageAsync(message *models.Message) {
+	if s == nil || !mayContainOffer(message) {
+		return
+	}
+
+	messageID := message.ID
+	s.background.Add(1)
+	go func() {
+		defer s.background.Done()
+		if _, err := s.ExtractMessage(context.Background(), messageID); err != nil {
+			logLLMFailure(err, "extract offers from message %s", messageID)
+		}
+	}()
+}
+
+// Wait blocks until background extractions have finished. Commands call this before exiting.
+func (s *OfferExtractionService) Wait() {
+	if s != nil {
+		s.background.Wait()
+	}
+}
+
+// ExtractMessage proposes the offers in a seller message as pending TrackedOffers. A message
+// is only read once: if offers were already detected in it, nothing new is proposed.
+func (s *OfferExtractionService) ExtractMessage(ctx context.Context, messageID uuid.UUID) ([]models.TrackedOffer, error) {
+	var message models.Message
+	if err := s.db.Preload("Thread").Where("id = ?", messageID).First(&message).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, errors.New("message not found")
+		}
+		return nil, fmt.Errorf("database error: %w", err)
+	}
+	if !mayContainOffer(&message) || message.Thread == nil {
+		return nil, nil
+	}
+
+	var existing int64
+	if err := s.db.Model(&models.TrackedOffer{}).
+		Where("message_id = ? AND source = ?", message.ID, models.OfferSourceMessage).
+		Count(&existing).Error; err != nil {
+		return nil, fmt.Errorf("database error: %w", err)
+	}
+	if existing > 0 {
+		return nil, nil
+	}
+
+	req := offerExtractionRequest(message.Thread.SellerName, message.Timestamp, message.Content)
+	req.UserID = message.UserID.String()
+	response, err := s.llm.Complete(ctx, req)
+	if err != nil {
+		return nil, err
+	}
+	detected, err := ParseOfferExtraction(response.Text)
+	if err != nil {
+		return nil, err
+	}
+	if len(detected) == 0 {
+		return nil, nil
+	}
+
+	offers := make([]models.TrackedOffer, 0, len(detected))
+	for _, offer := range detected {
+		details, err := json.Marshal(offer)
+		if err != nil {
+			return nil, fmt.Errorf("failed to encode offer details: %w", err)
+		}
+		detailsStr := string(details)
+
+		tracked := models.TrackedOffer{
+			ThreadID:     *message.ThreadID,
+			MessageID:    &message.ID,
+			OfferText:    offer.OfferSummary(),
+			TrackedAt:    message.Timestamp,
+			ReviewStatus: models.OfferReviewPending,
+			Source:       models.OfferSourceMessage,
+			Details:      &detailsStr,
+			Status:       models.OfferStatusActive,
+		}
+		offer.Apply(&tracked)
+		if tracked.ExpiresAt != nil && tracked.ExpiresAt.Before(time.Now()) {
+			tracked.Status = models.OfferStatusExpired
+		}
+		offers = append(offers, tracked)
+	}
+
+	if err := s.db.Create(&offers).Error; err != nil {
+		return nil, fmt.Errorf("failed to create offers: %w", err)
+	}
+
+	log.Printf("Detected %d offers in message %s", len(offers), message.ID)
+	return offers, nil
+}
+
+// ReviewOffer confirms or rejects an offer detected in a seller message. Confirmed offers are
+// tracked like any other; rejected ones are kept so the message isn't proposed again.
+func (s *OfferExtractionService) ReviewOffer(offerID, userID uuid.UUID, confirm bool) (*models.TrackedOffer, error) {
+	var offer models.TrackedOffer
+	if err := s.db.
+		Joins("JOIN threads ON threads.id = tracked_offers.thread_id").
+		Where("tracked_offers.id = ? AND threads.user_id = ?", offerID, userID).
+		Preload("Thread").
+		First(&offer).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, errors.New("offer not found")
+		}
+		return nil, fmt.Errorf("database error: %w", err)
+	}
+
+	if offer.ReviewStatus != models.OfferReviewPending {
+		return nil, errors.New("offer is not pending review")
+	}
+
+	now := time.Now()
+	offer.ReviewStatus = models.OfferReviewRejected
+	if confirm {
+		offer.ReviewStatus = models.OfferReviewConfirmed
+	}
+	offer.ReviewedAt = &now
+
+	if err := s.db.Model(&offer).Updates(map[string]interface{}{
+		"review_status": offer.ReviewStatus,
+		"reviewed_at":   now,
+	}).Error; err != nil {
+		return nil, fmt.Errorf("failed to update offer: %w", err)
+	}
+
+	return &offer, nil
+}
+
+// mayContainOffer reports whether a message is worth sending to the LLM: a human seller
+// message in a thread that mentions a number
+func mayContainOffer(message *models.Message) bool {
+	if message.Sender != models.SenderTypeSeller || message.ThreadID == nil {
+		return false
+	}
+	if message.Category != "" && message.Category != models.MessageCategoryHuman {
+		return false
+	}
+	return strings.ContainsAny(message.Content, "0123456789")
+}
@@ -0,0 +1,131 @@
+package services
+
+import (
+	"testing"
+
+	"carbuyer/internal/db/models"
+
+	"github.com/google/uuid"
+)
+
+func TestParseOfferExtraction(t *testing.T) {
+	tests := []struct {
+		name     string
+		response string
+		want     []string // OfferSummary of each offer
+		wantErr  bool
+	}{
+		{
+			name:     "price and fees",
+			response: `{"offers": [{"vehiclePrice": 38900, "docFee": 799, "outTheDoor": 42650.004, "expiresAt": "2026-10-31"}]}`,
+			want:     []string{"OTD $42,650 - Vehicle $38,900, Doc fee $799 (expires 2026-10-31)"},
+		},
+		{
+			name:     "lease terms",
+			response: "```json\n" + `{"offers": [{"vehicle": "2025 Explorer XLT", "financeType": "Lease", "monthlyPayment": 489, "termMonths": 36, "dueAtSigning": 2999}]}` + "\n```",
+			want:     []string{"2025 Explorer XLT: Lease, $489/mo, 36 months, $2,999 due at signing"},
+		},
+		{
+			name:     "price with financing",
+			response: `{"offers": [{"vehiclePrice": 38900, "apr": 4.9, "termMonths": 60}]}`,
+			want:     []string{"Vehicle $38,900; 4.9% APR, 60 months"},
+		},
+		{
+			name:     "negative rebate and bad values are cleaned up",
+			response: `{"offers": [{"vehiclePrice": 38900, "rebates": -1000, "apr": 129, "termMonths": 600, "financeType": "balloon", "expiresAt": "Sunday"}]}`,
+			want:     []string{"Vehicle $38,900, Rebates -$1,000"},
+		},
+		{
+			name:     "offers without a price are dropped",
+			response: `{"offers": [{"vehicle": "Explorer", "docFee": 799}, {"outTheDoor": 41000}]}`,
+			want:     []string{"OTD $41,000"},
+		},
+		{
+			name:     "no offers",
+			response: `{"offers": []}`,
+		},
+		{
+			name:     "not JSON",
+			response: "There is no offer in this message.",
+			wantErr:  true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := ParseOfferExtraction(tt.response)
+			if tt.wantErr {
+				if err == nil {
+					t.Errorf("ParseOfferExtraction() = %+v, want error", got)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("ParseOfferExtraction() error = %v", err)
+			}
+			if len(got) != len(tt.want) {
+				t.Fatalf("ParseOfferExtraction() returned %d offers, want %d", len(got), len(tt.want))
+			}
+			for i := range got {
+				if summary := got[i].OfferSummary(); summary != tt.want[i] {
+					t.Errorf("offer %d summary = %q, want %q", i, summary, tt.want[i])
+				}
+			}
+		})
+	}
+}
+
+func TestParseOfferExtractionCapsOffers(t *testing.T) {
+	got, err := ParseOfferExtraction(`{"offers": [{"outTheDoor": 1}, {"outTheDoor": 2}, {"outTheDoor": 3}, {"outTheDoor": 4}]}`)
+	if err != nil {
+		t.Fatalf("ParseOfferExtraction() error = %v", err)
+	}
+	if len(got) != maxDetectedOffers {
+		t.Errorf("ParseOfferExtraction() returned %d offers, want %d", len(got), maxDetectedOffers)
+	}
+}
+
+func TestMayContainOffer(t *testing.T) {
+	threadID := uuid.New()
+
+	tests := []struct {
+		name    string
+		message models.Message
+		want    bool
+	}{
+		{
+			name:    "seller price",
+			message: models.Message{Sender: models.SenderTypeSeller, ThreadID: &threadID, Content: "Best I can do is $38,900"},
+			want:    true,
+		},
+		{
+			name:    "classified human reply",
+			message: models.Message{Sender: models.SenderTypeSeller, ThreadID: &threadID, Category: models.MessageCategoryHuman, Content: "$38,900 OTD"},
+			want:    true,
+		},
+		{
+			name:    "no numbers",
+			message: models.Message{Sender: models.SenderTypeSeller, ThreadID: &threadID, Content: "Let me check with my manager"},
+		},
+		{
+			name:    "inbox message",
+			message: models.Message{Sender: models.SenderTypeSeller, Content: "Best I can do is $38,900"},
+		},
+		{
+			name:    "user message",
+			message: models.Message{Sender: models.SenderTypeUser, ThreadID: &threadID, Content: "Can you do $37,500?"},
+		},
+		{
+			name:    "marketing",
+			message: models.Message{Sender: models.SenderTypeSeller, ThreadID: &threadID, Category: models.MessageCategoryMarketing, Content: "0% APR for 72 months this weekend!"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := mayContainOffer(&tt.message); got != tt.want {
+				t.Errorf("mayContainOffer() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,134 @@
+package services
+
+import (
+	"testing"
+	"time"
+
+	"carbuyer/internal/db/models"
+)
+
+func TestValidateOffer(t *testing.T) {
+	price := 38900.0
+	negative := -5.0
+	apr := 4.9
+	highAPR := 45.0
+	term := 60
+	longTerm := 180
+	mileage := 10000
+
+	tests := []struct {
+		name    string
+		offer   models.TrackedOffer
+		wantErr string
+	}{
+		{
+			name:  "text only",
+			offer: models.TrackedOffer{OfferText: "$38,900 plus fees"},
+		},
+		{
+			name:  "structured terms",
+			offer: models.TrackedOffer{VehiclePrice: &price, FinanceType: models.FinanceTypeFinance, APR: &apr, TermMonths: &term, VIN: "1FMSK8DH5RGA12345"},
+		},
+		{
+			name:  "lease mileage",
+			offer: models.TrackedOffer{MonthlyPayment: &price, FinanceType: models.FinanceTypeLease, AnnualMileage: &mileage},
+		},
+		{
+			name:    "nothing to track",
+			offer:   models.TrackedOffer{OfferText: "  "},
+			wantErr: "offerText or a price is required",
+		},
+		{
+			name:    "negative amount",
+			offer:   models.TrackedOffer{VehiclePrice: &price, DocFee: &negative},
+			wantErr: "docFee must be between 0 and 10000000",
+		},
+		{
+			name:    "APR out of range",
+			offer:   models.TrackedOffer{VehiclePrice: &price, APR: &highAPR},
+			wantErr: "apr must be between 0 and 40",
+		},
+		{
+			name:    "term out of range",
+			offer:   models.TrackedOffer{VehiclePrice: &price, TermMonths: &longTerm},
+			wantErr: "termMonths must be between 1 and 120",
+		},
+		{
+			name:    "APR on cash offer",
+			offer:   models.TrackedOffer{VehiclePrice: &price, FinanceType: models.FinanceTypeCash, APR: &apr},
+			wantErr: "apr doesn't apply to cash offers",
+		},
+		{
+			name:    "mileage on finance offer",
+			offer:   models.TrackedOffer{VehiclePrice: &price, FinanceType: models.FinanceTypeFinance, AnnualMileage: &mileage},
+			wantErr: "annualMileage only applies to leases",
+		},
+		{
+			name:    "VIN with O",
+			offer:   models.TrackedOffer{VehiclePrice: &price, VIN: "1FMSK8DH5RGO12345"},
+			wantErr: "vin must be 17 letters and digits, without I, O or Q",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := ValidateOffer(&tt.offer)
+			if tt.wantErr == "" {
+				if err != nil {
+					t.Errorf("ValidateOffer() error = %v", err)
+				}
+				return
+			}
+			if err == nil || err.Error() != tt.wantErr {
+				t.Errorf("ValidateOffer() error = %v, want %q", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestNormalizeVIN(t *testing.T) {
+	if got := NormalizeVIN(" 1fmsk8dh5-rga 12345 "); got != "1FMSK8DH5RGA12345" {
+		t.Errorf("NormalizeVIN() = %q", got)
+	}
+}
+
+func TestOfferSummary(t *testing.T) {
+	price := 38900.0
+	otd := 42650.0
+	payment := 489.0
+	due := 2999.0
+	apr := 3.25
+	term := 36
+	mileage := 10000
+	expires := time.Date(2026, 10, 31, 23, 59, 59, 0, time.UTC)
+
+	tests := []struct {
+		name  string
+		offer models.TrackedOffer
+		want  string
+	}{
+		{
+			name:  "prices",
+			offer: models.TrackedOffer{VehiclePrice: &price, OutTheDoor: &otd, ExpiresAt: &expires},
+			want:  "OTD $42,650 - Vehicle $38,900 (expires 2026-10-31)",
+		},
+		{
+			name:  "lease",
+			offer: models.TrackedOffer{FinanceType: models.FinanceTypeLease, MonthlyPayment: &payment, APR: &apr, TermMonths: &term, DueAtSigning: &due, AnnualMileage: &mileage},
+			want:  "Lease, $489/mo, 3.25% APR, 36 months, $2,999 due at signing, 10,000 mi/yr",
+		},
+		{
+			name:  "price with financing",
+			offer: models.TrackedOffer{VehiclePrice: &price, FinanceType: models.FinanceTypeFinance, APR: &apr, TermMonths: &term},
+			want:  "Vehicle $38,900; 3.25% APR, 36 months",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := OfferSummary(&tt.offer); got != tt.want {
+				t.Errorf("OfferSummary() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
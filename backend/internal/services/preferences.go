@@ -116,9 +116,9 @@ func (s *PreferencesService) CreateUserPreferences(userID uuid.UUID, year int, m
 	// Trigger async dealer fetch if zip code is provided
 	if zipCode != "" && s.dealerService != nil {
 		go func() {
-			dealers, err := s.dealerService.FetchDealersForZipCode(zipCode, makeName, modelName, year)
+			dealers, err := s.dealerService.FetchDealersForZipCode(userID, zipCode, makeName, modelName, year)
 			if err != nil {
-				log.Printf("Failed to fetch dealers for zip code %s: %v", zipCode, err)
+				logLLMFailure(err, "fetch dealers for zip code %s", zipCode)
 				return
 			}
 			if err := s.dealerService.SaveDealersForPreferences(prefs.ID, dealers); err != nil {
@@ -219,9 +219,9 @@ func (s *PreferencesService) UpdateUserPreferences(userID uuid.UUID, year int, m
 
 			// Fetch new dealers
 			go func() {
-				dealers, err := s.dealerService.FetchDealersForZipCode(user.ZipCode, makeName, modelName, year)
+				dealers, err := s.dealerService.FetchDealersForZipCode(userID, user.ZipCode, makeName, modelName, year)
 				if err != nil {
-					log.Printf("Failed to fetch dealers for zip code %s: %v", user.ZipCode, err)
+					logLLMFailure(err, "fetch dealers for zip code %s", user.ZipCode)
 					return
 				}
 				if err := s.dealerService.SaveDealersForPreferences(prefs.ID, dealers); err != nil {
@@ -0,0 +1,447 @@
+package services
+
+import (
+	"embed"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"hash/fnv"
+	"log"
+	"reflect"
+	"strings"
+	"sync"
+	"text/template"
+
+	"carbuyer/internal/db/models"
+
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// maxPromptExperimentArms caps how many versions an experiment compares
+const maxPromptExperimentArms = 5
+
+// defaultPromptFiles are the built-in prompt templates, one per templated purpose. They are
+// stored as version 1 the first time the server starts.
+//
+//go:embed prompt_templates/*.tmpl
+var defaultPromptFiles embed.FS
+
+// NegotiationPromptData are the variables of negotiation prompt templates
+type NegotiationPromptData struct {
+	Year            int
+	Make            string
+	Model           string
+	SellerName      string
+	Summary         string // The thread's running summary of key facts; empty until there is one
+	CompetingOffers int    // Standing offers the buyer has, which the agent fetches with a tool
+	UserMessage     string
+}
+
+// DealerSearchPromptData are the variables of dealer search prompt templates
+type DealerSearchPromptData struct {
+	ZipCode string
+	Make    string
+	Model   string
+	Year    int
+}
+
+// promptSamples are example variables for each templated purpose. New versions must render
+// with them.
+var promptSamples = map[models.LLMPurpose]interface{}{
+	models.LLMPurposeNegotiation: NegotiationPromptData{
+		Year:            2025,
+		Make:            "Ford",
+		Model:           "Maverick",
+		SellerName:      "Metro Ford",
+		Summary:         "Prices:\n- Seller quoted $32,500 out the door on 2025-03-03",
+		CompetingOffers: 2,
+		UserMessage:     "Draft a counteroffer at $31,000",
+	},
+	models.LLMPurposeDealerSearch: DealerSearchPromptData{
+		ZipCode: "98103",
+		Make:    "Ford",
+		Model:   "Maverick",
+		Year:    2025,
+	},
+}
+
+// PromptVariables lists the variables a purpose's templates can use, or nil if the purpose
+// isn't templated
+func PromptVariables(purpose models.LLMPurpose) []string {
+	sample, ok := promptSamples[purpose]
+	if !ok {
+		return nil
+	}
+	t := reflect.TypeOf(sample)
+	variables := make([]string, 0, t.NumField())
+	for i := 0; i < t.NumField(); i++ {
+		variables = append(variables, "."+t.Field(i).Name)
+	}
+	return variables
+}
+
+// PromptExperimentArm is one version in a prompt experiment and its share of users
+type PromptExperimentArm struct {
+	Version int `json:"version"`
+	Weight  int `json:"weight"`
+}
+
+// Prompt is a prompt template version ready to render
+type Prompt struct {
+	TemplateID *uuid.UUID // Nil for a built-in template that isn't stored yet
+	Purpose    models.LLMPurpose
+	Version    int
+	tmpl       *template.Template
+}
+
+// Render renders the system prompt and the user prompt with a purpose's variables
+func (p *Prompt) Render(data interface{}) (system string, prompt string, err error) {
+	var b strings.Builder
+	if err := p.tmpl.ExecuteTemplate(&b, "system", data); err != nil {
+		return "", "", fmt.Errorf("failed to render %s prompt v%d: %w", p.Purpose, p.Version, err)
+	}
+	system = strings.TrimSpace(b.String())
+
+	b.Reset()
+	if err := p.tmpl.ExecuteTemplate(&b, "prompt", data); err != nil {
+		return "", "", fmt.Errorf("failed to render %s prompt v%d: %w", p.Purpose, p.Version, err)
+	}
+	return system, strings.TrimSpace(b.String()), nil
+}
+
+// parsePromptTemplate parses a template body for a purpose and checks that it defines the
+// system and user prompts and renders with the purpose's variables
+func parsePromptTemplate(purpose models.LLMPurpose, body string) (*template.Template, error) {
+	sample, ok := promptSamples[purpose]
+	if !ok {
+		return nil, errors.New("unknown prompt purpose")
+	}
+
+	tmpl, err := template.New(string(purpose)).Option("missingkey=error").Parse(body)
+	if err != nil {
+		return nil, fmt.Errorf("invalid template: %w", err)
+	}
+	for _, name := range []string{"system", "prompt"} {
+		if tmpl.Lookup(name) == nil {
+			return nil, fmt.Errorf("invalid template: it must define %q", name)
+		}
+	}
+
+	prompt := &Prompt{Purpose: purpose, tmpl: tmpl}
+	if _, _, err := prompt.Render(sample); err != nil {
+		return nil, fmt.Errorf("invalid template: %w", err)
+	}
+	return tmpl, nil
+}
+
+// defaultPromptBody returns the built-in template for a purpose
+func defaultPromptBody(purpose models.LLMPurpose) (string, error) {
+	body, err := defaultPromptFiles.ReadFile("prompt_templates/" + string(purpose) + ".tmpl")
+	if err != nil {
+		return "", fmt.Errorf("no built-in prompt template for %s", purpose)
+	}
+	return string(body), nil
+}
+
+// DefaultPrompt returns the built-in template for a purpose as version 1
+func DefaultPrompt(purpose models.LLMPurpose) (*Prompt, error) {
+	body, err := defaultPromptBody(purpose)
+	if err != nil {
+		return nil, err
+	}
+	tmpl, err := parsePromptTemplate(purpose, body)
+	if err != nil {
+		return nil, err
+	}
+	return &Prompt{Purpose: purpose, Version: 1, tmpl: tmpl}, nil
+}
+
+// ParsePrompt parses a template body for a purpose that isn't stored, such as a draft being
+// evaluated before it is saved. Its version is 0.
+func ParsePrompt(purpose models.LLMPurpose, body string) (*Prompt, error) {
+	tmpl, err := parsePromptTemplate(purpose, body)
+	if err != nil {
+		return nil, err
+	}
+	return &Prompt{Purpose: purpose, tmpl: tmpl}, nil
+}
+
+// assignPromptVersion picks a user's version in an experiment. The same user always gets the
+// same version for a purpose while the arms stay the same.
+func assignPromptVersion(purpose models.LLMPurpose, userID uuid.UUID, arms []PromptExperimentArm) int {
+	total := 0
+	for _, arm := range arms {
+		total += arm.Weight
+	}
+	if total == 0 {
+		return 0
+	}
+
+	h := fnv.New32a()
+	h.Write([]byte(purpose))
+	h.Write(userID[:])
+	bucket := int(h.Sum32() % uint32(total))
+	for _, arm := range arms {
+		if bucket < arm.Weight {
+			return arm.Version
+		}
+		bucket -= arm.Weight
+	}
+	return arms[len(arms)-1].Version
+}
+
+// PromptTemplateService is the registry of versioned prompt templates. Each templated purpose
+// has an active version, and can run an experiment that assigns versions to users by weight,
+// so prompts can change without a redeploy.
+type PromptTemplateService struct {
+	db     *gorm.DB
+	mu     sync.Mutex
+	parsed map[uuid.UUID]*template.Template // Versions never change, so each is parsed once
+}
+
+// NewPromptTemplateService creates a new prompt template service
+func NewPromptTemplateService(db *gorm.DB) *PromptTemplateService {
+	return &PromptTemplateService{
+		db:     db,
+		parsed: map[uuid.UUID]*template.Template{},
+	}
+}
+
+// Seed stores the built-in templates as version 1, and makes them active, for purposes that
+// have no versions yet
+func (s *PromptTemplateService) Seed() error {
+	for purpose := range promptSamples {
+		body, err := defaultPromptBody(purpose)
+		if err != nil {
+			return err
+		}
+
+		err = s.db.Transaction(func(tx *gorm.DB) error {
+			if err := tx.Clauses(clause.OnConflict{DoNothing: true}).Create(&models.PromptTemplate{
+				Purpose: purpose,
+				Version: 1,
+				Body:    body,
+				Notes:   "Built-in template",
+			}).Error; err != nil {
+				return err
+			}
+			return tx.Clauses(clause.OnConflict{DoNothing: true}).Create(&models.PromptDeployment{
+				Purpose:       purpose,
+				ActiveVersion: 1,
+			}).Error
+		})
+		if err != nil {
+			return fmt.Errorf("failed to seed %s prompt template: %w", purpose, err)
+		}
+	}
+	return nil
+}
+
+// Prompt returns the template version to use for a purpose and user: the user's version if
+// the purpose is running an experiment, else the active version. A nil service, or a purpose
+// without a deployment, uses the built-in template.
+func (s *PromptTemplateService) Prompt(purpose models.LLMPurpose, userID uuid.UUID) (*Prompt, error) {
+	if s == nil {
+		return DefaultPrompt(purpose)
+	}
+
+	var deployment models.PromptDeployment
+	err := s.db.Where("purpose = ?", purpose).First(&deployment).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return DefaultPrompt(purpose)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("database error: %w", err)
+	}
+
+	version := deployment.ActiveVersion
+	if arms := experimentArms(&deployment); len(arms) > 0 {
+		version = assignPromptVersion(purpose, userID, arms)
+	}
+
+	return s.Version(purpose, version)
+}
+
+// Version returns a stored version of a purpose's template
+func (s *PromptTemplateService) Version(purpose models.LLMPurpose, version int) (*Prompt, error) {
+	var stored models.PromptTemplate
+	err := s.db.Where("purpose = ? AND version = ?", purpose, version).First(&stored).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, errors.New("prompt template not found")
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to load %s prompt v%d: %w", purpose, version, err)
+	}
+
+	tmpl, err := s.parse(&stored)
+	if err != nil {
+		return nil, err
+	}
+	return &Prompt{TemplateID: &stored.ID, Purpose: purpose, Version: stored.Version, tmpl: tmpl}, nil
+}
+
+// parse returns a stored version's parsed template
+func (s *PromptTemplateService) parse(stored *models.PromptTemplate) (*template.Template, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if tmpl, ok := s.parsed[stored.ID]; ok {
+		return tmpl, nil
+	}
+	tmpl, err := parsePromptTemplate(stored.Purpose, stored.Body)
+	if err != nil {
+		return nil, fmt.Errorf("%s prompt v%d: %w", stored.Purpose, stored.Version, err)
+	}
+	s.parsed[stored.ID] = tmpl
+	return tmpl, nil
+}
+
+// ListTemplates returns a purpose's versions, newest first, and its deployment
+func (s *PromptTemplateService) ListTemplates(purpose models.LLMPurpose) ([]models.PromptTemplate, *models.PromptDeployment, error) {
+	if _, ok := promptSamples[purpose]; !ok {
+		return nil, nil, errors.New("unknown prompt purpose")
+	}
+
+	var templates []models.PromptTemplate
+	if err := s.db.Where("purpose = ?", purpose).Order("version DESC").Find(&templates).Error; err != nil {
+		return nil, nil, fmt.Errorf("database error: %w", err)
+	}
+
+	var deployment models.PromptDeployment
+	if err := s.db.Where("purpose = ?", purpose).First(&deployment).Error; err != nil && !errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, nil, fmt.Errorf("database error: %w", err)
+	}
+
+	return templates, &deployment, nil
+}
+
+// CreateTemplate saves a new version of a purpose's template. It isn't used until it is
+// activated or added to an experiment.
+func (s *PromptTemplateService) CreateTemplate(purpose models.LLMPurpose, body, notes string) (*models.PromptTemplate, error) {
+	if _, err := parsePromptTemplate(purpose, body); err != nil {
+		return nil, err
+	}
+
+	stored := &models.PromptTemplate{
+		Purpose: purpose,
+		Body:    body,
+		Notes:   strings.TrimSpace(notes),
+	}
+	err := s.db.Transaction(func(tx *gorm.DB) error {
+		var latest int
+		if err := tx.Model(&models.PromptTemplate{}).
+			Select("COALESCE(MAX(version), 0)").
+			Where("purpose = ?", purpose).
+			Scan(&latest).Error; err != nil {
+			return err
+		}
+		stored.Version = latest + 1
+		return tx.Create(stored).Error
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to save prompt template: %w", err)
+	}
+
+	return stored, nil
+}
+
+// Activate makes a version the one a purpose uses outside experiments
+func (s *PromptTemplateService) Activate(purpose models.LLMPurpose, version int) (*models.PromptDeployment, error) {
+	if err := s.verifyVersions(purpose, version); err != nil {
+		return nil, err
+	}
+
+	deployment, err := s.deployment(purpose)
+	if err != nil {
+		return nil, err
+	}
+	deployment.ActiveVersion = version
+	if err := s.db.Save(deployment).Error; err != nil {
+		return nil, fmt.Errorf("failed to save prompt deployment: %w", err)
+	}
+
+	return deployment, nil
+}
+
+// SetExperiment splits a purpose's users between versions by weight. No arms ends the
+// experiment, going back to the active version.
+func (s *PromptTemplateService) SetExperiment(purpose models.LLMPurpose, arms []PromptExperimentArm) (*models.PromptDeployment, error) {
+	if len(arms) > maxPromptExperimentArms {
+		return nil, fmt.Errorf("an experiment can have at most %d versions", maxPromptExperimentArms)
+	}
+	versions := make([]int, 0, len(arms))
+	for _, arm := range arms {
+		if arm.Weight <= 0 {
+			return nil, errors.New("experiment weights must be positive")
+		}
+		versions = append(versions, arm.Version)
+	}
+	if err := s.verifyVersions(purpose, versions...); err != nil {
+		return nil, err
+	}
+
+	deployment, err := s.deployment(purpose)
+	if err != nil {
+		return nil, err
+	}
+	deployment.Experiment = nil
+	if len(arms) > 0 {
+		encoded, err := json.Marshal(arms)
+		if err != nil {
+			return nil, fmt.Errorf("failed to encode experiment: %w", err)
+		}
+		experiment := string(encoded)
+		deployment.Experiment = &experiment
+	}
+	if err := s.db.Save(deployment).Error; err != nil {
+		return nil, fmt.Errorf("failed to save prompt deployment: %w", err)
+	}
+
+	return deployment, nil
+}
+
+// verifyVersions checks that a purpose is templated and has each version
+func (s *PromptTemplateService) verifyVersions(purpose models.LLMPurpose, versions ...int) error {
+	if _, ok := promptSamples[purpose]; !ok {
+		return errors.New("unknown prompt purpose")
+	}
+	for _, version := range versions {
+		var count int64
+		if err := s.db.Model(&models.PromptTemplate{}).Where("purpose = ? AND version = ?", purpose, version).Count(&count).Error; err != nil {
+			return fmt.Errorf("database error: %w", err)
+		}
+		if count == 0 {
+			return errors.New("prompt template not found")
+		}
+	}
+	return nil
+}
+
+// deployment returns a purpose's deployment, or a new one if it has none
+func (s *PromptTemplateService) deployment(purpose models.LLMPurpose) (*models.PromptDeployment, error) {
+	var deployment models.PromptDeployment
+	err := s.db.Where("purpose = ?", purpose).First(&deployment).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return &models.PromptDeployment{Purpose: purpose, ActiveVersion: 1}, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("database error: %w", err)
+	}
+	return &deployment, nil
+}
+
+// experimentArms decodes a deployment's experiment. A malformed experiment is ignored, so the
+// active version is used.
+func experimentArms(deployment *models.PromptDeployment) []PromptExperimentArm {
+	if deployment.Experiment == nil {
+		return nil
+	}
+	var arms []PromptExperimentArm
+	if err := json.Unmarshal([]byte(*deployment.Experiment), &arms); err != nil {
+		log.Printf("Ignoring malformed %s prompt experiment: %v", deployment.Purpose, err)
+		return nil
+	}
+	return arms
+}
@@ -0,0 +1,111 @@
+package services
+
+import (
+	"strings"
+	"testing"
+
+	"carbuyer/internal/db/models"
+
+	"github.com/google/uuid"
+)
+
+func TestDefaultPrompts(t *testing.T) {
+	tests := []struct {
+		purpose    models.LLMPurpose
+		wantSystem string
+		wantPrompt string
+	}{
+		{models.LLMPurposeNegotiation, "Current Seller: Metro Ford\n\nThread Summary", `Here is the users message: "Draft a counteroffer at $31,000" . In this thread they are negotiating with Metro Ford.`},
+		{models.LLMPurposeNegotiation, "Competitive Context: the buyer has 2 offers", ""},
+		{models.LLMPurposeDealerSearch, "return a JSON array of up to 6 nearest dealerships", "for a 2025 Ford Maverick near zip code 98103"},
+	}
+
+	for _, tt := range tests {
+		prompt, err := DefaultPrompt(tt.purpose)
+		if err != nil {
+			t.Fatalf("DefaultPrompt(%s) error: %v", tt.purpose, err)
+		}
+		if prompt.Version != 1 || prompt.TemplateID != nil {
+			t.Errorf("%s: got version %d, template %v; want built-in version 1", tt.purpose, prompt.Version, prompt.TemplateID)
+		}
+
+		system, user, err := prompt.Render(promptSamples[tt.purpose])
+		if err != nil {
+			t.Fatalf("%s: Render error: %v", tt.purpose, err)
+		}
+		if !strings.Contains(system, tt.wantSystem) {
+			t.Errorf("%s: system prompt is missing %q:\n%s", tt.purpose, tt.wantSystem, system)
+		}
+		if !strings.Contains(user, tt.wantPrompt) {
+			t.Errorf("%s: prompt is missing %q:\n%s", tt.purpose, tt.wantPrompt, user)
+		}
+		if strings.Contains(system+user, "<no value>") {
+			t.Errorf("%s: rendered a missing variable", tt.purpose)
+		}
+	}
+}
+
+func TestParsePromptTemplate(t *testing.T) {
+	tests := []struct {
+		name    string
+		purpose models.LLMPurpose
+		body    string
+		wantErr string
+	}{
+		{"valid", models.LLMPurposeDealerSearch, `{{define "system"}}Find dealers{{end}}{{define "prompt"}}{{.Make}} near {{.ZipCode}}{{end}}`, ""},
+		{"unknown purpose", models.LLMPurposeThreadSummary, `{{define "system"}}x{{end}}{{define "prompt"}}y{{end}}`, "unknown prompt purpose"},
+		{"syntax error", models.LLMPurposeDealerSearch, `{{define "system"}}{{.Make{{end}}`, "invalid template"},
+		{"missing prompt", models.LLMPurposeDealerSearch, `{{define "system"}}Find dealers{{end}}`, `must define "prompt"`},
+		{"unknown variable", models.LLMPurposeNegotiation, `{{define "system"}}{{.Trim}}{{end}}{{define "prompt"}}{{.UserMessage}}{{end}}`, "can't evaluate field Trim"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := parsePromptTemplate(tt.purpose, tt.body)
+			if tt.wantErr == "" {
+				if err != nil {
+					t.Errorf("unexpected error: %v", err)
+				}
+				return
+			}
+			if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+				t.Errorf("error = %v, want it to contain %q", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestAssignPromptVersion(t *testing.T) {
+	arms := []PromptExperimentArm{{Version: 1, Weight: 75}, {Version: 2, Weight: 25}}
+
+	counts := map[int]int{}
+	for i := 0; i < 4000; i++ {
+		userID := uuid.New()
+		version := assignPromptVersion(models.LLMPurposeNegotiation, userID, arms)
+		if again := assignPromptVersion(models.LLMPurposeNegotiation, userID, arms); again != version {
+			t.Fatalf("user %s got version %d, then %d", userID, version, again)
+		}
+		counts[version]++
+	}
+
+	if len(counts) != 2 {
+		t.Fatalf("assigned versions %v, want 1 and 2", counts)
+	}
+	if share := float64(counts[2]) / 4000; share < 0.2 || share > 0.3 {
+		t.Errorf("version 2 got %.0f%% of users, want about 25%%", share*100)
+	}
+
+	if got := assignPromptVersion(models.LLMPurposeNegotiation, uuid.New(), []PromptExperimentArm{{Version: 3, Weight: 10}}); got != 3 {
+		t.Errorf("single arm assigned version %d, want 3", got)
+	}
+}
+
+func TestPromptVariables(t *testing.T) {
+	got := strings.Join(PromptVariables(models.LLMPurposeDealerSearch), " ")
+	if got != ".ZipCode .Make .Model .Year" {
+		t.Errorf("PromptVariables = %q", got)
+	}
+	if PromptVariables(models.LLMPurposeAutopilot) != nil {
+		t.Error("autopilot isn't templated, want no variables")
+	}
+}
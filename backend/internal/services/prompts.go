@@ -0,0 +1,482 @@
+package services
+
+import (
+	"fmt"
+	"strings"
+	"time"
+
+	"carbuyer/internal/db/models"
+	"carbuyer/internal/llm"
+)
+
+// DealerInfo represents dealer information returned from the LLM
+type DealerInfo struct {
+	Name     string  `json:"name"`
+	Location string  `json:"location"`
+	Email    *string `json:"email,omitempty"`
+	Phone    *string `json:"phone,omitempty"`
+	Website  *string `json:"website,omitempty"`
+	Distance float64 `json:"distance"`
+}
+
+// negotiationRequest builds the LLM request for a negotiation response, rendering the system
+// prompt and the user's request with a negotiation prompt template. The thread's strategy, if
+// any, is added after the rendered system prompt so every template version follows it.
+func negotiationRequest(prompt *Prompt, data NegotiationPromptData, strategy string, messageHistory []models.Message) (llm.Request, error) {
+	systemPrompt, userPrompt, err := prompt.Render(data)
+	if err != nil {
+		return llm.Request{}, err
+	}
+	if strategy != "" {
+		systemPrompt += "\n\n" + strategy
+	}
+
+	// Build conversation history
+	messages := []llm.Message{}
+
+	// Add message history for context
+	for _, msg := range messageHistory {
+		content := msg.Content
+
+		switch msg.Sender {
+		case models.SenderTypeUser:
+			content = "User's draft message: " + content
+			messages = append(messages, llm.UserMessage(llm.Text(content)))
+		case models.SenderTypeAgent:
+			messages = append(messages, llm.AssistantMessage(content))
+		case models.SenderTypeSeller:
+			content = fmt.Sprintf("Seller (%s) said: %s", data.SellerName, content)
+			messages = append(messages, llm.UserMessage(llm.Text(content)))
+		}
+	}
+
+	// Add current user message
+	messages = append(messages, llm.UserMessage(llm.Text(userPrompt)))
+
+	// Log the full request
+	fmt.Printf("\n========== LLM NEGOTIATION REQUEST ==========\n")
+	fmt.Printf("Prompt Template: %s v%d\n", prompt.Purpose, prompt.Version)
+	fmt.Printf("System Prompt:\n%s\n\n", systemPrompt)
+	fmt.Printf("Message Count: %d\n", len(messages))
+	fmt.Printf("Messages:\n")
+	for i, msg := range messages {
+		fmt.Printf("  [%d] %s:\n", i+1, msg.Role)
+		for _, part := range msg.Parts {
+			fmt.Printf("    Text: %s\n", part.Text)
+		}
+	}
+	fmt.Printf("=============================================\n\n")
+
+	return llm.Request{
+		Model:     llm.ModelStandard,
+		MaxTokens: 1024,
+		System:    systemPrompt,
+		Messages:  messages,
+		Tools:     negotiationTools,
+		Purpose:   string(models.LLMPurposeNegotiation),
+	}, nil
+}
+
+// stripDraftPreamble removes explanatory prefixes such as "Here's a draft:" from a response
+func stripDraftPreamble(responseText string) string {
+	responseText = strings.TrimSpace(responseText)
+
+	// Remove common prefixes that might indicate explanations or meta-commentary
+	// This is a safeguard in case Claude still adds explanatory text
+	// All these prefixes end with a colon, so we can find the colon position
+	prefixes := []string{
+		"Here's a draft:",
+		"Here's the draft:",
+		"Here is a draft:",
+		"Here is the draft:",
+		"Draft message:",
+		"Message draft:",
+		"Here's the message:",
+		"Here is the message:",
+		"Here's your message:",
+		"Here is your message:",
+	}
+
+	responseLower := strings.ToLower(responseText)
+	for _, prefix := range prefixes {
+		prefixLower := strings.ToLower(prefix)
+		if strings.HasPrefix(responseLower, prefixLower) {
+			// Find the colon position in the original text (should be at len(prefix)-1)
+			// Remove everything up to and including the colon, then trim whitespace
+			colonPos := strings.Index(responseText, ":")
+			if colonPos >= 0 && colonPos < len(responseText) {
+				responseText = strings.TrimSpace(responseText[colonPos+1:])
+			}
+			break
+		}
+	}
+
+	return responseText
+}
+
+// dealerSearchRequest builds the LLM request for dealerships near a zip code, rendering it
+// with a dealer search prompt template
+func dealerSearchRequest(prompt *Prompt, data DealerSearchPromptData) (llm.Request, error) {
+	systemPrompt, userPrompt, err := prompt.Render(data)
+	if err != nil {
+		return llm.Request{}, err
+	}
+
+	return llm.Request{
+		Model:     llm.ModelStandard,
+		MaxTokens: 2048,
+		System:    systemPrompt,
+		Messages:  []llm.Message{llm.UserMessage(llm.Text(userPrompt))},
+		Purpose:   string(models.LLMPurposeDealerSearch),
+	}, nil
+}
+
+// quoteExtractionPrompt instructs the LLM to read pricing line items from a dealer document
+const quoteExtractionPrompt = `You read car dealer pricing documents: quotes, buyer's orders, purchase agreements, worksheets and window stickers.
+Extract every priced line item and return ONLY a JSON object, no other text, with this structure:
+
+{
+  "documentType": "quote" | "buyers_order" | "window_sticker" | "worksheet" | "other",
+  "lineItems": [
+    {"label": "Line item text as printed", "amount": 1234.56, "category": "vehicle_price"}
+  ]
+}
+
+Categories:
+- vehicle_price: the selling price / sale price of the vehicle (not MSRP unless it is the only price)
+- msrp: MSRP or sticker price
+- add_on: dealer add-ons, accessories, protection packages, market adjustments
+- doc_fee: documentation / dealer processing fees
+- tax: sales tax and other taxes
+- registration: title, license, registration and plate fees
+- rebate: rebates, incentives and discounts (use positive amounts)
+- out_the_door: the final out-the-door / total amount due
+- other: anything else that affects the price
+
+Use plain numbers for amounts (no currency symbols or commas). If the document has no prices, return an empty lineItems array.`
+
+// quoteExtractionRequest builds the LLM request to read pricing line items from a dealer
+// document. Pass the extracted text for PDFs with a text layer, or the raw document bytes and
+// media type for scanned PDFs and images.
+func quoteExtractionRequest(text string, document []byte, mediaType string) (llm.Request, error) {
+	var parts []llm.Part
+
+	switch {
+	case text != "":
+		parts = append(parts, llm.Text("Document text:\n\n"+text))
+	case mediaType == "application/pdf", strings.HasPrefix(mediaType, "image/"):
+		parts = append(parts, llm.Document(document, mediaType))
+	default:
+		return llm.Request{}, fmt.Errorf("unsupported document type: %s", mediaType)
+	}
+	parts = append(parts, llm.Text("Extract the pricing line items from this document as JSON."))
+
+	return llm.Request{
+		Model:     llm.ModelStandard,
+		MaxTokens: 2048,
+		System:    quoteExtractionPrompt,
+		Messages:  []llm.Message{llm.UserMessage(parts...)},
+		Purpose:   string(models.LLMPurposeQuoteExtraction),
+	}, nil
+}
+
+// emailClassificationPrompt instructs the LLM to sort inbound mail for a car buyer's inbox
+const emailClassificationPrompt = `You sort email received at a car buyer's inbox address. The buyer gives this address to car dealers while negotiating.
+Classify the email into exactly one category:
+
+- "human": a person at a dealership (or anyone else) writing to the buyer personally, including salespeople replying from a CRM
+- "auto_reply": an automatic response such as an out-of-office notice or a CRM "thanks for your inquiry, someone will contact you" acknowledgement
+- "marketing": newsletters, promotions, sales events, surveys and other bulk mail
+- "spam": unsolicited junk, phishing or scams
+
+Return ONLY a JSON object, no other text: {"category": "...", "reason": "one short sentence"}`
+
+// emailClassificationRequest builds the LLM request to classify an inbound email
+func emailClassificationRequest(from, subject, body, headerNotes string) llm.Request {
+	prompt := fmt.Sprintf("From: %s\nSubject: %s\n", from, subject)
+	if headerNotes != "" {
+		prompt += fmt.Sprintf("Header signals: %s\n", headerNotes)
+	}
+	prompt += "\n" + body
+
+	return llm.Request{
+		Model:     llm.ModelFast,
+		MaxTokens: 256,
+		System:    emailClassificationPrompt,
+		Messages:  []llm.Message{llm.UserMessage(llm.Text(prompt))},
+		Purpose:   string(models.LLMPurposeEmailClassification),
+	}
+}
+
+// offerExtractionPrompt instructs the LLM to pick out the offers in a seller's message
+const offerExtractionPrompt = `You read messages from car sellers to a buyer and pick out concrete offers: prices, fees, out-the-door totals, financing or lease terms, and when the offer expires.
+Return ONLY a JSON object, no other text, with this structure:
+
+{
+  "offers": [
+    {
+      "vehicle": "the vehicle the offer is for, if stated",
+      "vehiclePrice": 38900,
+      "dealerAddOns": 1295,
+      "docFee": 799,
+      "taxes": 3500,
+      "registration": 450,
+      "rebates": 1000,
+      "outTheDoor": 43844,
+      "financeType": "cash" | "finance" | "lease",
+      "apr": 4.9,
+      "termMonths": 60,
+      "monthlyPayment": 529,
+      "dueAtSigning": 2999,
+      "expiresAt": "YYYY-MM-DD",
+      "quote": "the sentence from the message stating the offer"
+    }
+  ]
+}
+
+Rules:
+- Only include terms the seller actually states. Use null for anything not stated; never calculate or guess.
+- Use plain numbers for amounts (no currency symbols or commas). Rebates and discounts are positive amounts.
+- Resolve relative expirations ("through Sunday", "end of the month") against the message date.
+- Prices the buyer proposed, MSRP mentioned in passing and vague promises ("we can work with you") are not offers.
+- If the seller quotes several distinct deals (e.g. two trims, or cash and lease), return one offer for each.
+- If the message contains no offer, return {"offers": []}.`
+
+// offerExtractionRequest builds the LLM request to find the offers in a seller's message
+func offerExtractionRequest(sellerName string, sentAt time.Time, content string) llm.Request {
+	prompt := fmt.Sprintf("Seller: %s\nMessage date: %s\n\n%s", sellerName, sentAt.Format("Monday, 2006-01-02"), content)
+
+	return llm.Request{
+		Model:     llm.ModelFast,
+		MaxTokens: 1024,
+		System:    offerExtractionPrompt,
+		Messages:  []llm.Message{llm.UserMessage(llm.Text(prompt))},
+		Purpose:   string(models.LLMPurposeOfferExtraction),
+	}
+}
+
+// autopilotPrompt instructs the LLM to decide how to answer a seller on the buyer's behalf
+const autopilotPrompt = `You are negotiating a car purchase on the buyer's behalf, on autopilot. A seller just wrote to the buyer and you decide what happens next:
+
+- "reply": write the next message to the seller
+- "wait": nothing needs saying yet (e.g. the seller said they'll get back, or only confirmed something)
+- "escalate": the buyer must decide (e.g. the seller wants to close, asks something only the buyer can answer, or won't come within the walk-away price)
+
+Guardrails from the buyer:
+%s
+Rules for replies:
+- Work towards the target price. Never agree to or propose a price above the walk-away price.
+- Never reveal the target or walk-away price, or anything the buyer listed as never to disclose.
+- Never commit the buyer to buy, sign, put down a deposit or visit. Those are the buyer's decisions.
+- Use competing offers as leverage without naming the other sellers.
+- Be firm, polite and concise: around 500 characters.
+
+Return ONLY a JSON object, no other text:
+{"action": "reply" | "wait" | "escalate", "reasoning": "one or two sentences on why, for the buyer to review", "reply": "the message to send, only when action is reply"}`
+
+// autopilotRequest builds the LLM request for an autopilot decision about the latest seller
+// message in a negotiation
+func autopilotRequest(n *negotiationContext, settings *models.AutopilotSettings) llm.Request {
+	guardrails := ""
+	if settings.TargetPrice != nil {
+		guardrails += fmt.Sprintf("- Target price: $%s\n", formatDollars(*settings.TargetPrice))
+	}
+	if settings.WalkAwayPrice != nil {
+		guardrails += fmt.Sprintf("- Walk-away price: $%s\n", formatDollars(*settings.WalkAwayPrice))
+	}
+	for _, item := range neverDiscloseItems(settings.NeverDisclose) {
+		guardrails += fmt.Sprintf("- Never disclose: %s\n", item)
+	}
+	if guardrails == "" {
+		guardrails = "- None beyond the rules below\n"
+	}
+
+	prompt := fmt.Sprintf("The buyer wants a %d %s %s. They are negotiating with %s.\n", n.year, n.makeName, n.modelName, n.sellerName)
+	if n.summary != "" {
+		prompt += "\nKey facts from the whole conversation so far:\n" + n.summary + "\n"
+	}
+	if len(n.trackedOffers) > 0 {
+		prompt += "\nOffers the buyer has:\n"
+		for _, offer := range n.trackedOffers {
+			sellerInfo := "Unknown Seller"
+			if offer.Thread != nil {
+				sellerInfo = offer.Thread.SellerName
+			}
+			prompt += fmt.Sprintf("- %s: %s\n", sellerInfo, offer.OfferText)
+		}
+	}
+
+	prompt += "\nConversation so far, oldest first:\n"
+	for _, msg := range n.history {
+		switch msg.Sender {
+		case models.SenderTypeUser:
+			prompt += fmt.Sprintf("\nBuyer: %s\n", msg.Content)
+		case models.SenderTypeAgent:
+			prompt += fmt.Sprintf("\nYour earlier draft for the buyer (may not have been sent): %s\n", msg.Content)
+		case models.SenderTypeSeller:
+			prompt += fmt.Sprintf("\nSeller (%s): %s\n", n.sellerName, msg.Content)
+		}
+	}
+	prompt += "\nDecide how to answer the seller's latest message."
+
+	system := fmt.Sprintf(autopilotPrompt, guardrails)
+	if strategy := strategyPrompt(n.strategy, NegotiationPromptData{}, false); strategy != "" {
+		system += "\n\n" + strategy + "\nOn autopilot, handing the decision back to the buyer means escalate."
+	}
+
+	return llm.Request{
+		Model:     llm.ModelStandard,
+		MaxTokens: 1024,
+		System:    system,
+		Messages:  []llm.Message{llm.UserMessage(llm.Text(prompt))},
+		Purpose:   string(models.LLMPurposeAutopilot),
+	}
+}
+
+// threadSummaryPrompt instructs the LLM to bring a thread's running summary up to date
+const threadSummaryPrompt = `You keep a running summary of a car purchase negotiation between a buyer and a seller, so the key facts survive after the messages they came from are no longer shown. You get the current summary and the messages since it was written. Return the updated summary.
+
+Use these sections, with short bullet points, and leave out any section with nothing in it:
+Prices: every price, offer and counteroffer, who made it and when (e.g. "Seller quoted $38,900 out the door on 2025-03-03")
+Concessions: anything either side agreed to or promised (e.g. "Seller will remove the $1,295 protection package")
+Vehicle: year, make, model, trim, color, VIN, stock number and options
+Deadlines: offer expirations, appointments and other dates
+Open questions: what either side is still waiting to hear
+
+Rules:
+- Only record what the messages say. Never guess or calculate.
+- Keep the facts in the current summary unless a newer message changes them, then note the change (e.g. "Seller came down from $39,500 to $38,900").
+- The buyer may have edited the current summary. Keep their edits.
+- Write dates as dates, not "yesterday" or "Friday".
+- Return ONLY the summary, no other text, in at most 300 words.`
+
+// threadSummaryRequest builds the LLM request to fold new messages into a thread's summary
+func threadSummaryRequest(sellerName, current string, messages []models.Message) llm.Request {
+	if current == "" {
+		current = "(none yet)"
+	}
+
+	prompt := fmt.Sprintf("Seller: %s\n\nCurrent summary:\n%s\n\nNew messages, oldest first:\n", sellerName, current)
+	for _, msg := range messages {
+		from := "Buyer"
+		if msg.Sender == models.SenderTypeSeller {
+			from = "Seller"
+		}
+		content := msg.Content
+		if len(content) > maxSummaryMessageChars {
+			content = strings.ToValidUTF8(content[:maxSummaryMessageChars], "") + "…"
+		}
+		prompt += fmt.Sprintf("\n[%s] %s: %s\n", msg.Timestamp.Format("Monday, 2006-01-02"), from, content)
+	}
+	prompt += "\nReturn the updated summary."
+
+	return llm.Request{
+		Model:     llm.ModelFast,
+		MaxTokens: 1024,
+		System:    threadSummaryPrompt,
+		Messages:  []llm.Message{llm.UserMessage(llm.Text(prompt))},
+		Purpose:   string(models.LLMPurposeThreadSummary),
+	}
+}
+
+// masterAgentPrompt instructs the LLM to act as the buyer's assistant across all their negotiations
+const masterAgentPrompt = `You are a car buyer's assistant. The buyer is negotiating with several sellers at once, each in its own thread with its own negotiation agent. You see all of them: every thread, every offer and the inbox.
+
+You help the buyer:
+- Answer questions across negotiations, e.g. "who is cheapest out the door right now?" or "which dealers haven't answered?"
+- Recommend the next move in each thread, with a short reason
+- Draft messages to sellers when the buyer asks. Use create_draft to save the draft in the seller's thread for the buyer to review and send; you can't send anything yourself.
+
+Rules:
+- The overview below is current. Use the tools for details it leaves out: a thread's messages, all offers with their terms, the inbox, or a search of every thread.
+- Compare offers on out-the-door price. Say when an offer has no out-the-door price or the buyer hasn't confirmed it.
+- Only state what the threads, offers and inbox say. If you don't know, say so.
+- Drafts to a seller never name another seller, never reveal the buyer's budget, and never commit the buyer to buy, sign, put down a deposit or visit.
+- Refer to threads by seller name, not by ID.
+- Be concise. Use short lists when comparing sellers.
+
+Current state of the buyer's negotiations:
+%s`
+
+// masterAgentRequest builds the LLM request for the master agent's answer to the buyer, with
+// the overview of their negotiations and the earlier turns of the master conversation
+func masterAgentRequest(overview string, history []models.Message, content string) llm.Request {
+	messages := []llm.Message{}
+	for _, msg := range history {
+		switch msg.Sender {
+		case models.SenderTypeUser:
+			messages = append(messages, llm.UserMessage(llm.Text(msg.Content)))
+		case models.SenderTypeAgent:
+			// The conversation must open with the buyer
+			if len(messages) > 0 {
+				messages = append(messages, llm.AssistantMessage(msg.Content))
+			}
+		}
+	}
+	messages = append(messages, llm.UserMessage(llm.Text(content)))
+
+	return llm.Request{
+		Model:     llm.ModelStandard,
+		MaxTokens: 2048,
+		System:    fmt.Sprintf(masterAgentPrompt, overview),
+		Messages:  messages,
+		Tools:     masterTools,
+		Purpose:   string(models.LLMPurposeMasterAgent),
+	}
+}
+
+// draftVariantsPrompt asks the negotiation agent for several ranked drafts instead of one
+const draftVariantsPrompt = `Instead of a single response, write %d alternative responses that differ in tone or length, for example firmer, friendlier or shorter. Rank them best first for this buyer and this moment in the negotiation. Each must be complete on its own and follow all the rules above.
+
+Return ONLY a JSON object, no other text:
+{"variants": [{"style": "one or two words, e.g. firm", "rationale": "one short sentence on why or when this works best", "content": "the complete response"}]}`
+
+// withDraftVariants changes a negotiation request to ask for n ranked drafts
+func withDraftVariants(req llm.Request, n int) llm.Request {
+	messages := append([]llm.Message{}, req.Messages...)
+	last := messages[len(messages)-1]
+	last.Parts = append(append([]llm.Part{}, last.Parts...), llm.Text(fmt.Sprintf(draftVariantsPrompt, n)))
+	messages[len(messages)-1] = last
+
+	req.Messages = messages
+	req.MaxTokens = 1024 * n
+	return req
+}
+
+// commitmentCheckPrompt instructs the LLM to compare a draft with what the buyer already told
+// the seller
+const commitmentCheckPrompt = `You check a car buyer's draft message to a seller before it is sent. You get what the buyer already told this seller and the draft. Find places where the draft contradicts something the buyer committed to or stated earlier: how they are paying (cash, financing, lease), trade-ins, offers they made or turned down, deadlines, the vehicle, trim or options they want, and anything they promised to do.
+
+Return ONLY a JSON object, no other text:
+{"contradictions": [{"quote": "the words in the draft", "earlier": "what the buyer said earlier", "explanation": "one short sentence"}]}
+
+Rules:
+- Only report clear contradictions a seller would notice. Moving a price offer as part of normal negotiation is not a contradiction.
+- Quote the draft exactly.
+- If there are none, return {"contradictions": []}.`
+
+// commitmentCheckRequest builds the LLM request to find contradictions between a draft and the
+// messages the buyer already sent a seller
+func commitmentCheckRequest(sellerName, summary string, sent []models.Message, draft string) llm.Request {
+	prompt := fmt.Sprintf("Seller: %s\n", sellerName)
+	if summary != "" {
+		prompt += "\nKey facts from the conversation so far:\n" + summary + "\n"
+	}
+	prompt += "\nMessages the buyer sent this seller, oldest first:\n"
+	for _, msg := range sent {
+		content := msg.Content
+		if len(content) > maxSummaryMessageChars {
+			content = strings.ToValidUTF8(content[:maxSummaryMessageChars], "") + "…"
+		}
+		prompt += fmt.Sprintf("\n[%s] %s\n", msg.Timestamp.Format("Monday, 2006-01-02"), content)
+	}
+	prompt += "\nDraft:\n" + draft
+
+	return llm.Request{
+		Model:     llm.ModelFast,
+		MaxTokens: 512,
+		System:    commitmentCheckPrompt,
+		Messages:  []llm.Message{llm.UserMessage(llm.Text(prompt))},
+		Purpose:   string(models.LLMPurposeDraftGuardrail),
+	}
+}
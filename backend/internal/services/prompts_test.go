@@ -0,0 +1,40 @@
+package services
+
+import "testing"
+
+func TestStripDraftPreamble(t *testing.T) {
+	tests := []struct {
+		name     string
+		response string
+		want     string
+	}{
+		{
+			name:     "plain draft",
+			response: "Hi Mike, could you do $38,500 out the door?",
+			want:     "Hi Mike, could you do $38,500 out the door?",
+		},
+		{
+			name:     "draft preamble",
+			response: "Here's a draft:\n\nHi Mike, could you do $38,500 out the door?",
+			want:     "Hi Mike, could you do $38,500 out the door?",
+		},
+		{
+			name:     "preamble in a different case",
+			response: "  HERE IS THE MESSAGE: Thanks for the quote.  ",
+			want:     "Thanks for the quote.",
+		},
+		{
+			name:     "colon later in the text is kept",
+			response: "Price check: is $38,500 doable?",
+			want:     "Price check: is $38,500 doable?",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := stripDraftPreamble(tt.response); got != tt.want {
+				t.Errorf("stripDraftPreamble() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,464 @@
+package services
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"strings"
+	"sync"
+	"time"
+
+	"carbuyer/internal/db/models"
+	"carbuyer/internal/llm"
+
+	"github.com/google/uuid"
+	"github.com/ledongthuc/pdf"
+	"gorm.io/gorm"
+)
+
+// minPDFTextLength is the amount of text below which a PDF is treated as a scan
+const minPDFTextLength = 40
+
+// Quote line item categories returned by the extraction prompt
+const (
+	QuoteCategoryVehiclePrice = "vehicle_price"
+	QuoteCategoryMSRP         = "msrp"
+	QuoteCategoryAddOn        = "add_on"
+	QuoteCategoryDocFee       = "doc_fee"
+	QuoteCategoryTax          = "tax"
+	QuoteCategoryRegistration = "registration"
+	QuoteCategoryRebate       = "rebate"
+	QuoteCategoryOutTheDoor   = "out_the_door"
+	QuoteCategoryOther        = "other"
+)
+
+// QuoteLineItem is a single priced line on a dealer document
+type QuoteLineItem struct {
+	Label    string  `json:"label"`
+	Amount   float64 `json:"amount"`
+	Category string  `json:"category"`
+}
+
+// QuoteExtraction is the structured pricing read from a dealer document
+type QuoteExtraction struct {
+	DocumentType       string          `json:"documentType"`
+	LineItems          []QuoteLineItem `json:"lineItems"`
+	VehiclePrice       *float64        `json:"vehiclePrice,omitempty"`
+	DealerAddOns       *float64        `json:"dealerAddOns,omitempty"`
+	DocFee             *float64        `json:"docFee,omitempty"`
+	Taxes              *float64        `json:"taxes,omitempty"`
+	Registration       *float64        `json:"registration,omitempty"`
+	Rebates            *float64        `json:"rebates,omitempty"`
+	OutTheDoor         *float64        `json:"outTheDoor,omitempty"`
+	OutTheDoorComputed bool            `json:"outTheDoorComputed,omitempty"`
+}
+
+// ParseQuoteExtraction parses the LLM's JSON response and rolls line items up into totals
+func ParseQuoteExtraction(response string) (*QuoteExtraction, error) {
+	var extraction QuoteExtraction
+	if err := llm.DecodeJSON(response, &extraction); err != nil {
+		return nil, err
+	}
+
+	extraction.summarize()
+	return &extraction, nil
+}
+
+// summarize totals line items by category. When the document doesn't state an out-the-door
+// total, it is computed from the components and flagged as computed.
+func (e *QuoteExtraction) summarize() {
+	totals := make(map[string]float64)
+	seen := make(map[string]bool)
+
+	for i := range e.LineItems {
+		item := &e.LineItems[i]
+		item.Category = strings.ToLower(strings.TrimSpace(item.Category))
+		if item.Category == "" {
+			item.Category = QuoteCategoryOther
+		}
+		amount := item.Amount
+		if item.Category == QuoteCategoryRebate {
+			amount = math.Abs(amount)
+		}
+		totals[item.Category] += amount
+		seen[item.Category] = true
+	}
+
+	total := func(category string) *float64 {
+		if !seen[category] {
+			return nil
+		}
+		v := math.Round(totals[category]*100) / 100
+		return &v
+	}
+
+	e.VehiclePrice = total(QuoteCategoryVehiclePrice)
+	if e.VehiclePrice == nil {
+		// Window stickers only carry MSRP
+		e.VehiclePrice = total(QuoteCategoryMSRP)
+	}
+	e.DealerAddOns = total(QuoteCategoryAddOn)
+	e.DocFee = total(QuoteCategoryDocFee)
+	e.Taxes = total(QuoteCategoryTax)
+	e.Registration = total(QuoteCategoryRegistration)
+	e.Rebates = total(QuoteCategoryRebate)
+
+	if seen[QuoteCategoryOutTheDoor] {
+		// Documents sometimes repeat the total - take the largest rather than summing
+		otd := 0.0
+		for _, item := range e.LineItems {
+			if item.Category == QuoteCategoryOutTheDoor && item.Amount > otd {
+				otd = item.Amount
+			}
+		}
+		e.OutTheDoor = &otd
+		e.OutTheDoorComputed = false
+	} else if e.VehiclePrice != nil && seen[QuoteCategoryVehiclePrice] {
+		otd := totals[QuoteCategoryVehiclePrice] + totals[QuoteCategoryAddOn] + totals[QuoteCategoryDocFee] +
+			totals[QuoteCategoryTax] + totals[QuoteCategoryRegistration] + totals[QuoteCategoryOther] -
+			totals[QuoteCategoryRebate]
+		otd = math.Round(otd*100) / 100
+		e.OutTheDoor = &otd
+		e.OutTheDoorComputed = true
+	}
+}
+
+// OfferSummary renders the extraction as text for a TrackedOffer
+func (e *QuoteExtraction) OfferSummary() string {
+	var parts []string
+	add := func(label string, v *float64) {
+		if v != nil {
+			parts = append(parts, fmt.Sprintf("%s $%s", label, formatDollars(*v)))
+		}
+	}
+
+	add("Vehicle", e.VehiclePrice)
+	add("Add-ons", e.DealerAddOns)
+	add("Doc fee", e.DocFee)
+	add("Tax", e.Taxes)
+	add("Registration", e.Registration)
+	if e.Rebates != nil {
+		parts = append(parts, fmt.Sprintf("Rebates -$%s", formatDollars(*e.Rebates)))
+	}
+
+	summary := strings.Join(parts, ", ")
+	if e.OutTheDoor != nil {
+		otd := fmt.Sprintf("OTD $%s", formatDollars(*e.OutTheDoor))
+		if e.OutTheDoorComputed {
+			otd += " (calculated)"
+		}
+		if summary != "" {
+			summary = otd + " - " + summary
+		} else {
+			summary = otd
+		}
+	}
+
+	return summary
+}
+
+// formatDollars formats an amount with thousands separators and cents only when needed
+func formatDollars(v float64) string {
+	s := fmt.Sprintf("%.2f", v)
+	s = strings.TrimSuffix(s, ".00")
+
+	intPart, frac := s, ""
+	if dot := strings.Index(s, "."); dot >= 0 {
+		intPart, frac = s[:dot], s[dot:]
+	}
+
+	negative := strings.HasPrefix(intPart, "-")
+	intPart = strings.TrimPrefix(intPart, "-")
+
+	var b strings.Builder
+	for i, r := range intPart {
+		if i > 0 && (len(intPart)-i)%3 == 0 {
+			b.WriteByte(',')
+		}
+		b.WriteRune(r)
+	}
+
+	result := b.String() + frac
+	if negative {
+		result = "-" + result
+	}
+	return result
+}
+
+// extractPDFText returns the text layer of a PDF. Malformed PDFs can panic inside the
+// parser, so panics are converted to errors.
+func extractPDFText(data []byte) (text string, err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			err = fmt.Errorf("failed to parse PDF: %v", r)
+		}
+	}()
+
+	reader, err := pdf.NewReader(bytes.NewReader(data), int64(len(data)))
+	if err != nil {
+		return "", fmt.Errorf("failed to open PDF: %w", err)
+	}
+
+	plain, err := reader.GetPlainText()
+	if err != nil {
+		return "", fmt.Errorf("failed to read PDF text: %w", err)
+	}
+
+	content, err := io.ReadAll(plain)
+	if err != nil {
+		return "", fmt.Errorf("failed to read PDF text: %w", err)
+	}
+
+	return strings.TrimSpace(string(content)), nil
+}
+
+// DocumentExtractionService extracts pricing line items from dealer document attachments
+type DocumentExtractionService struct {
+	db                *gorm.DB
+	attachmentService *AttachmentService
+	llm               llm.LLM
+	background        sync.WaitGroup
+}
+
+// NewDocumentExtractionService creates a new document extraction service
+func NewDocumentExtractionService(db *gorm.DB, attachmentService *AttachmentService, llm llm.LLM) *DocumentExtractionService {
+	return &DocumentExtractionService{
+		db:                db,
+		attachmentService: attachmentService,
+		llm:               llm,
+	}
+}
+
+// IsExtractable reports whether an attachment is a document type the pipeline can read
+func (s *DocumentExtractionService) IsExtractable(attachment *models.MessageAttachment) bool {
+	if !attachment.Downloadable() {
+		return false
+	}
+	switch attachment.ContentType {
+	case "application/pdf", "image/jpeg", "image/png", "image/gif", "image/webp":
+		return true
+	}
+	return false
+}
+
+// ExtractAttachmentsAsync runs extraction for every readable attachment in the background
+func (s *DocumentExtractionService) ExtractAttachmentsAsync(userID uuid.UUID, attachments []models.MessageAttachment) {
+	for _, attachment := range attachments {
+		if !s.IsExtractable(&attachment) {
+			continue
+		}
+		attachmentID := attachment.ID
+		s.background.Add(1)
+		go func() {
+			defer s.background.Done()
+			if _, err := s.ExtractAttachment(attachmentID, userID); err != nil {
+				logLLMFailure(err, "extract attachment %s", attachmentID)
+			}
+		}()
+	}
+}
+
+// Wait blocks until background extractions have finished. Commands call this before exiting.
+func (s *DocumentExtractionService) Wait() {
+	s.background.Wait()
+}
+
+// ExtractAttachment reads pricing line items from an attachment and stores the result.
+// Re-running extraction on the same attachment replaces the previous result.
+func (s *DocumentExtractionService) ExtractAttachment(attachmentID, userID uuid.UUID) (*models.DocumentExtraction, error) {
+	attachment, err := s.attachmentService.GetAttachment(attachmentID, userID)
+	if err != nil {
+		return nil, err
+	}
+	if !s.IsExtractable(attachment) {
+		return nil, errors.New("attachment type cannot be extracted")
+	}
+
+	var extraction models.DocumentExtraction
+	err = s.db.Where("attachment_id = ?", attachmentID).First(&extraction).Error
+	if err != nil && !errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, fmt.Errorf("database error: %w", err)
+	}
+	if extraction.OfferID != nil {
+		return nil, errors.New("extraction has already been promoted to an offer")
+	}
+
+	extraction = models.DocumentExtraction{
+		ID:           extraction.ID,
+		UserID:       userID,
+		MessageID:    attachment.MessageID,
+		AttachmentID: attachment.ID,
+		Status:       models.ExtractionStatusPending,
+		CreatedAt:    extraction.CreatedAt,
+	}
+	if err := s.db.Save(&extraction).Error; err != nil {
+		return nil, fmt.Errorf("failed to save extraction: %w", err)
+	}
+
+	result, method, err := s.extract(attachment)
+	extraction.Method = method
+	if err != nil {
+		extraction.Status = models.ExtractionStatusFailed
+		extraction.Error = err.Error()
+		if saveErr := s.db.Save(&extraction).Error; saveErr != nil {
+			return nil, fmt.Errorf("failed to save extraction: %w", saveErr)
+		}
+		// Reported rather than kept as a failed extraction, so the user knows to wait
+		if errors.Is(err, ErrTokenQuotaExceeded) {
+			return nil, err
+		}
+		return &extraction, nil
+	}
+
+	lineItems, err := json.Marshal(result.LineItems)
+	if err != nil {
+		return nil, fmt.Errorf("failed to encode line items: %w", err)
+	}
+	lineItemsStr := string(lineItems)
+
+	extraction.Status = models.ExtractionStatusCompleted
+	extraction.DocumentType = result.DocumentType
+	extraction.VehiclePrice = result.VehiclePrice
+	extraction.DealerAddOns = result.DealerAddOns
+	extraction.DocFee = result.DocFee
+	extraction.Taxes = result.Taxes
+	extraction.Registration = result.Registration
+	extraction.Rebates = result.Rebates
+	extraction.OutTheDoor = result.OutTheDoor
+	extraction.OutTheDoorComputed = result.OutTheDoorComputed
+	extraction.LineItems = &lineItemsStr
+
+	if err := s.db.Save(&extraction).Error; err != nil {
+		return nil, fmt.Errorf("failed to save extraction: %w", err)
+	}
+
+	return &extraction, nil
+}
+
+// extract picks the cheapest method that can read the document: the PDF text layer when
+// there is one, otherwise the LLM reading the PDF or image directly
+func (s *DocumentExtractionService) extract(attachment *models.MessageAttachment) (*QuoteExtraction, models.ExtractionMethod, error) {
+	data, err := s.attachmentService.ReadAttachment(attachment)
+	if err != nil {
+		return nil, "", fmt.Errorf("failed to read attachment: %w", err)
+	}
+
+	method := models.ExtractionMethodImage
+	text := ""
+	if attachment.ContentType == "application/pdf" {
+		method = models.ExtractionMethodPDFDocument
+		if extracted, err := extractPDFText(data); err == nil && len(extracted) >= minPDFTextLength {
+			text = extracted
+			method = models.ExtractionMethodPDFText
+		}
+	}
+
+	request, err := quoteExtractionRequest(text, data, attachment.ContentType)
+	if err != nil {
+		return nil, method, err
+	}
+	request.UserID = attachment.UserID.String()
+	response, err := s.llm.Complete(context.Background(), request)
+	if err != nil {
+		return nil, method, err
+	}
+
+	result, err := ParseQuoteExtraction(response.Text)
+	if err != nil {
+		return nil, method, err
+	}
+
+	return result, method, nil
+}
+
+// GetMessageExtractions lists extractions for a message owned by the user
+func (s *DocumentExtractionService) GetMessageExtractions(messageID, userID uuid.UUID) ([]models.DocumentExtraction, error) {
+	var extractions []models.DocumentExtraction
+	if err := s.db.Where("message_id = ? AND user_id = ?", messageID, userID).
+		Order("created_at ASC").
+		Find(&extractions).Error; err != nil {
+		return nil, fmt.Errorf("failed to retrieve extractions: %w", err)
+	}
+
+	return extractions, nil
+}
+
+// PromoteToOffer creates a TrackedOffer from a completed extraction. The message must
+// belong to a thread so the offer can be attributed to a seller.
+func (s *DocumentExtractionService) PromoteToOffer(extractionID, userID uuid.UUID) (*models.TrackedOffer, error) {
+	var extraction models.DocumentExtraction
+	if err := s.db.Where("id = ? AND user_id = ?", extractionID, userID).First(&extraction).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, errors.New("extraction not found")
+		}
+		return nil, fmt.Errorf("database error: %w", err)
+	}
+
+	if extraction.Status != models.ExtractionStatusCompleted {
+		return nil, errors.New("extraction is not completed")
+	}
+	if extraction.OfferID != nil {
+		return nil, errors.New("extraction has already been promoted to an offer")
+	}
+
+	var message models.Message
+	if err := s.db.Where("id = ?", extraction.MessageID).First(&message).Error; err != nil {
+		return nil, fmt.Errorf("failed to load message: %w", err)
+	}
+	if message.ThreadID == nil {
+		return nil, errors.New("assign the message to a thread before tracking its offer")
+	}
+
+	summary := (&QuoteExtraction{
+		VehiclePrice: extraction.VehiclePrice,
+		DealerAddOns: extraction.DealerAddOns,
+		DocFee:       extraction.DocFee,
+		Taxes:        extraction.Taxes,
+		Registration: extraction.Registration,
+		Rebates:      extraction.Rebates,
+		OutTheDoor:   extraction.OutTheDoor,
+
+		OutTheDoorComputed: extraction.OutTheDoorComputed,
+	}).OfferSummary()
+	if summary == "" {
+		return nil, errors.New("extraction has no prices to track")
+	}
+
+	offer := &models.TrackedOffer{
+		ThreadID:     *message.ThreadID,
+		MessageID:    &message.ID,
+		OfferText:    summary,
+		TrackedAt:    time.Now(),
+		ReviewStatus: models.OfferReviewConfirmed,
+		Source:       models.OfferSourceDocument,
+		Status:       models.OfferStatusActive,
+		VehiclePrice: extraction.VehiclePrice,
+		DealerAddOns: extraction.DealerAddOns,
+		DocFee:       extraction.DocFee,
+		Taxes:        extraction.Taxes,
+		Registration: extraction.Registration,
+		Rebates:      extraction.Rebates,
+		OutTheDoor:   extraction.OutTheDoor,
+
+		OutTheDoorComputed: extraction.OutTheDoorComputed,
+	}
+
+	err := s.db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Create(offer).Error; err != nil {
+			return fmt.Errorf("failed to create offer: %w", err)
+		}
+		if err := tx.Model(&extraction).Update("offer_id", offer.ID).Error; err != nil {
+			return fmt.Errorf("failed to link offer: %w", err)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return offer, nil
+}
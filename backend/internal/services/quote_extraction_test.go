@@ -0,0 +1,108 @@
+package services
+
+import (
+	"testing"
+)
+
+func floatPtrValue(v *float64) float64 {
+	if v == nil {
+		return -1
+	}
+	return *v
+}
+
+func TestParseQuoteExtraction(t *testing.T) {
+	tests := []struct {
+		name         string
+		response     string
+		wantVehicle  float64
+		wantAddOns   float64
+		wantRebates  float64
+		wantOTD      float64
+		wantComputed bool
+		wantErr      bool
+	}{
+		{
+			name: "Explicit out-the-door total",
+			response: `{"documentType":"buyers_order","lineItems":[
+				{"label":"Selling Price","amount":32500,"category":"vehicle_price"},
+				{"label":"Nitrogen Tires","amount":199,"category":"add_on"},
+				{"label":"Paint Protection","amount":895,"category":"add_on"},
+				{"label":"Doc Fee","amount":799,"category":"doc_fee"},
+				{"label":"Sales Tax","amount":2671.3,"category":"tax"},
+				{"label":"Total Cash Price","amount":37064.3,"category":"out_the_door"}]}`,
+			wantVehicle: 32500,
+			wantAddOns:  1094,
+			wantRebates: -1,
+			wantOTD:     37064.3,
+		},
+		{
+			name: "Computed total subtracts rebates given as negatives",
+			response: "Here is the data:\n```json\n" + `{"documentType":"quote","lineItems":[
+				{"label":"Price","amount":30000,"category":"vehicle_price"},
+				{"label":"Customer Cash","amount":-1500,"category":"rebate"},
+				{"label":"Doc","amount":500,"category":"doc_fee"},
+				{"label":"Title & Reg","amount":350.5,"category":"registration"}]}` + "\n```",
+			wantVehicle:  30000,
+			wantAddOns:   -1,
+			wantRebates:  1500,
+			wantOTD:      29350.5,
+			wantComputed: true,
+		},
+		{
+			name:        "Window sticker falls back to MSRP",
+			response:    `{"documentType":"window_sticker","lineItems":[{"label":"Total MSRP","amount":41250,"category":"msrp"}]}`,
+			wantVehicle: 41250,
+			wantAddOns:  -1,
+			wantRebates: -1,
+			wantOTD:     -1,
+		},
+		{
+			name:     "No JSON",
+			response: "I couldn't find any pricing in this document.",
+			wantErr:  true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := ParseQuoteExtraction(tt.response)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("ParseQuoteExtraction() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if tt.wantErr {
+				return
+			}
+			if v := floatPtrValue(got.VehiclePrice); v != tt.wantVehicle {
+				t.Errorf("VehiclePrice = %v, want %v", v, tt.wantVehicle)
+			}
+			if v := floatPtrValue(got.DealerAddOns); v != tt.wantAddOns {
+				t.Errorf("DealerAddOns = %v, want %v", v, tt.wantAddOns)
+			}
+			if v := floatPtrValue(got.Rebates); v != tt.wantRebates {
+				t.Errorf("Rebates = %v, want %v", v, tt.wantRebates)
+			}
+			if v := floatPtrValue(got.OutTheDoor); v != tt.wantOTD {
+				t.Errorf("OutTheDoor = %v, want %v", v, tt.wantOTD)
+			}
+			if got.OutTheDoorComputed != tt.wantComputed {
+				t.Errorf("OutTheDoorComputed = %v, want %v", got.OutTheDoorComputed, tt.wantComputed)
+			}
+		})
+	}
+}
+
+func TestQuoteExtractionOfferSummary(t *testing.T) {
+	vehicle, docFee, otd := 32500.0, 799.0, 35870.25
+	extraction := &QuoteExtraction{
+		VehiclePrice:       &vehicle,
+		DocFee:             &docFee,
+		OutTheDoor:         &otd,
+		OutTheDoorComputed: true,
+	}
+
+	want := "OTD $35,870.25 (calculated) - Vehicle $32,500, Doc fee $799"
+	if got := extraction.OfferSummary(); got != want {
+		t.Errorf("OfferSummary() = %q, want %q", got, want)
+	}
+}
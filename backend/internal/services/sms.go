@@ -0,0 +1,430 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"strings"
+	"time"
+
+	"carbuyer/internal/db/models"
+	"carbuyer/internal/sms"
+
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// smsOptOutNotice is appended to the first text sent to a phone, as carriers require
+const smsOptOutNotice = "Reply STOP to opt out."
+
+// maxProvisionAttempts is how many numbers are tried before giving up on finding an unused one
+const maxProvisionAttempts = 10
+
+// SMSService negotiates with dealers by text: it provisions a number per user, routes
+// inbound texts into threads by the dealer's phone, sends agent drafts and honours STOP
+type SMSService struct {
+	db              *gorm.DB
+	provider        sms.Provider
+	threadService   *ThreadService
+	offerExtraction *OfferExtractionService
+	summaries       *ThreadSummaryService
+}
+
+// NewSMSService creates a new SMS service
+func NewSMSService(db *gorm.DB, provider sms.Provider, threadService *ThreadService, offerExtraction *OfferExtractionService, summaries *ThreadSummaryService) *SMSService {
+	return &SMSService{
+		db:              db,
+		provider:        provider,
+		threadService:   threadService,
+		offerExtraction: offerExtraction,
+		summaries:       summaries,
+	}
+}
+
+// Provider returns the SMS provider inbound webhooks are verified and parsed with
+func (s *SMSService) Provider() sms.Provider {
+	return s.provider
+}
+
+// GetNumber returns the user's active number
+func (s *SMSService) GetNumber(userID uuid.UUID) (*models.SMSNumber, error) {
+	var number models.SMSNumber
+	if err := s.db.Where("user_id = ? AND released_at IS NULL", userID).First(&number).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, errors.New("sms number not found")
+		}
+		return nil, fmt.Errorf("database error: %w", err)
+	}
+	return &number, nil
+}
+
+// ProvisionNumber buys a number for the user, in the area code when one is given
+func (s *SMSService) ProvisionNumber(ctx context.Context, userID uuid.UUID, areaCode string) (*models.SMSNumber, error) {
+	if _, err := s.GetNumber(userID); err == nil {
+		return nil, errors.New("sms number already provisioned")
+	} else if err.Error() != "sms number not found" {
+		return nil, err
+	}
+
+	if areaCode != "" && (len(areaCode) != 3 || strings.Trim(areaCode, "0123456789") != "") {
+		return nil, errors.New("area code must be 3 digits")
+	}
+
+	provisioned, err := s.unusedNumber(ctx, areaCode)
+	if err != nil {
+		return nil, err
+	}
+
+	number := &models.SMSNumber{
+		UserID:   userID,
+		Number:   sms.NormalizePhone(provisioned),
+		Provider: s.provider.Name(),
+	}
+	if err := s.db.Create(number).Error; err != nil {
+		// Don't keep paying for a number we couldn't record
+		if releaseErr := s.provider.ReleaseNumber(ctx, provisioned); releaseErr != nil {
+			log.Printf("Failed to release unrecorded number %s: %v", provisioned, releaseErr)
+		}
+		return nil, fmt.Errorf("failed to save sms number: %w", err)
+	}
+
+	return number, nil
+}
+
+// unusedNumber provisions a number no user has had yet. Numbers stay recorded after they're
+// released, and providers can hand out a number again, so taken ones are given back and
+// another is tried.
+func (s *SMSService) unusedNumber(ctx context.Context, areaCode string) (string, error) {
+	for attempt := 0; attempt < maxProvisionAttempts; attempt++ {
+		provisioned, err := s.provider.ProvisionNumber(ctx, areaCode)
+		if err != nil {
+			return "", err
+		}
+
+		var taken int64
+		if err := s.db.Model(&models.SMSNumber{}).Where("number = ?", sms.NormalizePhone(provisioned)).Count(&taken).Error; err != nil {
+			return "", fmt.Errorf("database error: %w", err)
+		}
+		if taken == 0 {
+			return provisioned, nil
+		}
+
+		if err := s.provider.ReleaseNumber(ctx, provisioned); err != nil {
+			log.Printf("Failed to release taken number %s: %v", provisioned, err)
+		}
+	}
+	return "", errors.New("no unused sms number available")
+}
+
+// ReleaseNumber gives the user's number back to the provider. Texts already received stay
+// in their threads.
+func (s *SMSService) ReleaseNumber(ctx context.Context, userID uuid.UUID) error {
+	number, err := s.GetNumber(userID)
+	if err != nil {
+		return err
+	}
+
+	if err := s.provider.ReleaseNumber(ctx, number.Number); err != nil {
+		return err
+	}
+
+	now := time.Now()
+	if err := s.db.Model(number).Update("released_at", &now).Error; err != nil {
+		return fmt.Errorf("failed to release sms number: %w", err)
+	}
+	return nil
+}
+
+// ProcessInbound saves a text received on one of our numbers. Opt-out and opt-in keywords
+// only update the sender's opt-out status; the provider sends the carrier-required
+// confirmation. Other texts are routed to the thread with the dealer whose phone sent it, a new
+// thread is started for a known dealer without one, and anything else lands in the inbox. It
+// returns nil when the number isn't ours or the text was a keyword.
+func (s *SMSService) ProcessInbound(in *sms.InboundSMS) (*models.Message, error) {
+	var number models.SMSNumber
+	if err := s.db.Where("number = ? AND released_at IS NULL", in.To).First(&number).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			log.Printf("Inbound SMS to unknown number %s", in.To)
+			return nil, nil
+		}
+		return nil, fmt.Errorf("database error: %w", err)
+	}
+
+	// Providers retry webhooks, so the same text can arrive twice
+	if in.MessageID != "" {
+		var existing models.Message
+		err := s.db.Where("external_message_id = ? AND channel = ?", in.MessageID, models.MessageChannelSMS).First(&existing).Error
+		if err == nil {
+			return &existing, nil
+		}
+		if !errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, fmt.Errorf("database error: %w", err)
+		}
+	}
+
+	switch {
+	case sms.IsOptOut(in.Body):
+		if err := s.optOut(number.Number, in.From, sms.Keyword(in.Body)); err != nil {
+			return nil, err
+		}
+		return nil, nil
+	case sms.IsOptIn(in.Body):
+		if err := s.db.Where("number = ? AND phone = ?", number.Number, in.From).Delete(&models.SMSOptOut{}).Error; err != nil {
+			return nil, fmt.Errorf("failed to remove sms opt-out: %w", err)
+		}
+		return nil, nil
+	}
+
+	threadID, err := s.routeInbound(number.UserID, in.From)
+	if err != nil {
+		// Routing is best effort - the text still lands in the inbox
+		log.Printf("SMS thread routing failed for %s: %v", in.From, err)
+	}
+
+	message := &models.Message{
+		UserID:            number.UserID,
+		ThreadID:          threadID,
+		Sender:            models.SenderTypeSeller,
+		Content:           in.Body,
+		Timestamp:         time.Now(),
+		ExternalMessageID: in.MessageID,
+		Channel:           models.MessageChannelSMS,
+		SenderPhone:       in.From,
+		Category:          models.MessageCategoryHuman,
+	}
+
+	err = s.db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Create(message).Error; err != nil {
+			return fmt.Errorf("failed to create sms message: %w", err)
+		}
+
+		if message.ThreadID != nil {
+			if err := tx.Model(&models.Thread{}).Where("id = ?", *message.ThreadID).Updates(map[string]interface{}{
+				"message_count":   gorm.Expr("message_count + ?", 1),
+				"last_message_at": message.Timestamp,
+			}).Error; err != nil {
+				return fmt.Errorf("failed to update thread: %w", err)
+			}
+		}
+
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	s.offerExtraction.ExtractMessageAsync(message)
+	s.summaries.RefreshAsync(message)
+
+	return message, nil
+}
+
+// routeInbound picks the thread for a text from phone: the thread already texting with it,
+// else the thread with the dealer that has this phone, creating one if needed. Returns nil
+// for the inbox.
+func (s *SMSService) routeInbound(userID uuid.UUID, phone string) (*uuid.UUID, error) {
+	threadID, err := s.smsThread(userID, phone)
+	if err != nil || threadID != nil {
+		return threadID, err
+	}
+
+	dealer, err := s.dealerByPhone(userID, phone)
+	if err != nil || dealer == nil {
+		return nil, err
+	}
+
+	var thread models.Thread
+	err = s.db.Where("user_id = ? AND deleted_at IS NULL AND LOWER(seller_name) = LOWER(?)", userID, dealer.Name).
+		Order("updated_at DESC").
+		First(&thread).Error
+	if err == nil {
+		return &thread.ID, nil
+	}
+	if !errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, fmt.Errorf("database error: %w", err)
+	}
+
+	created, err := s.threadService.CreateThread(userID, dealer.Name, models.SellerTypeDealership)
+	if err != nil {
+		return nil, err
+	}
+	return &created.ID, nil
+}
+
+// smsThread returns the user's active thread with the latest text to or from phone
+func (s *SMSService) smsThread(userID uuid.UUID, phone string) (*uuid.UUID, error) {
+	var message models.Message
+	err := s.db.Joins("JOIN threads ON threads.id = messages.thread_id").
+		Where("messages.user_id = ? AND messages.channel = ? AND threads.deleted_at IS NULL", userID, models.MessageChannelSMS).
+		Where("messages.sender_phone = ? OR messages.recipient_phone = ?", phone, phone).
+		Order("messages.timestamp DESC").
+		First(&message).Error
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, nil
+		}
+		return nil, fmt.Errorf("database error: %w", err)
+	}
+	return message.ThreadID, nil
+}
+
+// dealerByPhone finds the user's dealer with phone. Dealer phones are stored as the dealer
+// lists them, so they are compared after normalizing.
+func (s *SMSService) dealerByPhone(userID uuid.UUID, phone string) (*models.Dealer, error) {
+	var dealers []models.Dealer
+	if err := s.db.Joins("JOIN user_preferences ON user_preferences.id = dealers.user_preference_id").
+		Where("user_preferences.user_id = ? AND dealers.phone IS NOT NULL AND dealers.phone <> ''", userID).
+		Find(&dealers).Error; err != nil {
+		return nil, fmt.Errorf("failed to get dealers: %w", err)
+	}
+
+	for i := range dealers {
+		if sms.NormalizePhone(*dealers[i].Phone) == phone {
+			return &dealers[i], nil
+		}
+	}
+	return nil, nil
+}
+
+// optOut records that phone texted an opt-out keyword to our number
+func (s *SMSService) optOut(number, phone, keyword string) error {
+	optOut := models.SMSOptOut{Number: number, Phone: phone, Keyword: keyword}
+	if err := s.db.Clauses(clause.OnConflict{
+		Columns:   []clause.Column{{Name: "number"}, {Name: "phone"}},
+		DoUpdates: clause.AssignmentColumns([]string{"keyword"}),
+	}).Create(&optOut).Error; err != nil {
+		return fmt.Errorf("failed to save sms opt-out: %w", err)
+	}
+	return nil
+}
+
+// SendDraft texts an agent draft to the dealer of the draft's thread from the user's number.
+// content replaces the draft's text when given, so the user can edit it first.
+func (s *SMSService) SendDraft(ctx context.Context, userID, messageID uuid.UUID, content string) (*models.Message, error) {
+	var draft models.Message
+	if err := s.db.Where("id = ? AND user_id = ? AND deleted_at IS NULL", messageID, userID).First(&draft).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, errors.New("message not found")
+		}
+		return nil, fmt.Errorf("database error: %w", err)
+	}
+	if draft.Sender != models.SenderTypeAgent || draft.ThreadID == nil {
+		return nil, errors.New("message is not an agent draft")
+	}
+
+	content = strings.TrimSpace(content)
+	if content == "" {
+		content = draft.Content
+	}
+
+	number, err := s.GetNumber(userID)
+	if err != nil {
+		return nil, err
+	}
+
+	phone, err := s.threadPhone(userID, *draft.ThreadID)
+	if err != nil {
+		return nil, err
+	}
+	if phone == "" {
+		return nil, errors.New("no phone number for this dealer")
+	}
+
+	var optedOut int64
+	if err := s.db.Model(&models.SMSOptOut{}).Where("number = ? AND phone = ?", number.Number, phone).Count(&optedOut).Error; err != nil {
+		return nil, fmt.Errorf("database error: %w", err)
+	}
+	if optedOut > 0 {
+		return nil, errors.New("recipient has opted out of texts")
+	}
+
+	// The first text to a phone says how to opt out
+	body := content
+	var previous int64
+	if err := s.db.Model(&models.Message{}).
+		Where("user_id = ? AND channel = ? AND recipient_phone = ?", userID, models.MessageChannelSMS, phone).
+		Count(&previous).Error; err != nil {
+		return nil, fmt.Errorf("database error: %w", err)
+	}
+	if previous == 0 {
+		body = content + "\n\n" + smsOptOutNotice
+	}
+
+	providerID, err := s.provider.Send(ctx, number.Number, phone, body)
+	if err != nil {
+		return nil, err
+	}
+
+	sent := &models.Message{
+		UserID:            userID,
+		ThreadID:          draft.ThreadID,
+		Sender:            models.SenderTypeUser,
+		Content:           body,
+		Timestamp:         time.Now(),
+		ExternalMessageID: providerID,
+		Channel:           models.MessageChannelSMS,
+		RecipientPhone:    phone,
+		DeliveryStatus:    models.DeliveryStatusSent,
+	}
+
+	// The text is already sent, so a failure to record it is logged rather than reported
+	err = s.db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Create(sent).Error; err != nil {
+			return fmt.Errorf("failed to create outbound sms: %w", err)
+		}
+
+		return tx.Model(&models.Thread{}).Where("id = ?", *sent.ThreadID).Updates(map[string]interface{}{
+			"message_count":   gorm.Expr("message_count + ?", 1),
+			"last_message_at": sent.Timestamp,
+		}).Error
+	})
+	if err != nil {
+		log.Printf("Failed to record outbound sms %s: %v", providerID, err)
+	} else {
+		s.summaries.RefreshAsync(sent)
+	}
+
+	return sent, nil
+}
+
+// threadPhone returns the phone to text for a thread: the one it is already texting with,
+// else the phone of the dealer the thread is named after
+func (s *SMSService) threadPhone(userID, threadID uuid.UUID) (string, error) {
+	var thread models.Thread
+	if err := s.db.Where("id = ? AND user_id = ? AND deleted_at IS NULL", threadID, userID).First(&thread).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return "", errors.New("thread not found")
+		}
+		return "", fmt.Errorf("database error: %w", err)
+	}
+
+	var message models.Message
+	err := s.db.Where("thread_id = ? AND channel = ?", threadID, models.MessageChannelSMS).
+		Order("timestamp DESC").
+		First(&message).Error
+	if err == nil {
+		if message.SenderPhone != "" {
+			return message.SenderPhone, nil
+		}
+		return message.RecipientPhone, nil
+	}
+	if !errors.Is(err, gorm.ErrRecordNotFound) {
+		return "", fmt.Errorf("database error: %w", err)
+	}
+
+	var dealers []models.Dealer
+	if err := s.db.Joins("JOIN user_preferences ON user_preferences.id = dealers.user_preference_id").
+		Where("user_preferences.user_id = ? AND LOWER(dealers.name) = LOWER(?) AND dealers.phone IS NOT NULL", userID, thread.SellerName).
+		Find(&dealers).Error; err != nil {
+		return "", fmt.Errorf("failed to get dealers: %w", err)
+	}
+	for _, dealer := range dealers {
+		if phone := sms.NormalizePhone(*dealer.Phone); phone != "" {
+			return phone, nil
+		}
+	}
+
+	return "", nil
+}
@@ -0,0 +1,368 @@
+package services
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+	"text/template"
+
+	"carbuyer/internal/db/models"
+
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+)
+
+// Limits for custom strategy profiles
+const (
+	maxStrategyNameChars     = 80
+	maxStrategyFragmentChars = 4000
+	maxStrategyProfiles      = 50 // Custom profiles per user
+)
+
+// builtinStrategies are the strategy profiles every user can pick, seeded by key
+var builtinStrategies = []models.StrategyProfile{
+	{
+		Key:         "collaborative",
+		Name:        "Collaborative",
+		Description: "Friendly and relationship-focused. Works with the seller towards a deal both sides are happy with.",
+		PromptFragment: `Take a collaborative approach:
+- Be warm and appreciative. Thank the seller for their time and acknowledge their effort on each concession.
+- Frame the negotiation as solving a problem together: ask what flexibility they have on price, fees and add-ons.
+- Make reasonable counteroffers in moderate steps and explain them briefly.
+- Mention competing offers gently, as context rather than a threat.`,
+		OpeningTemplate: `Hi {{.SellerName}} team,
+
+I'm shopping for a {{.Year}} {{.Make}} {{.Model}} and would love to work with you on it. Could you share your best out-the-door price, with any dealer add-ons and fees itemized? I'm ready to move quickly for the right deal.
+
+Thanks!`,
+		EscalationRules: `The seller asks for a commitment, deposit or appointment
+The seller stops moving on price after two counteroffers`,
+	},
+	{
+		Key:         "hard_line",
+		Name:        "Hard-line",
+		Description: "Firm and brief. Anchors low, concedes little and is ready to walk away.",
+		PromptFragment: `Take a hard-line approach:
+- Be brief and direct. No small talk, no apologies, no explaining the buyer's reasons.
+- Anchor low and concede in small steps. Never make two concessions in a row without one from the seller.
+- Reject dealer add-ons, market adjustments and padded fees outright.
+- Make clear the buyer has other options and will walk away, without naming other sellers.`,
+		OpeningTemplate: `Hello,
+
+I'm buying a {{.Year}} {{.Make}} {{.Model}} this week and am collecting out-the-door quotes from several dealers. Send me your best out-the-door price, itemized, with no add-ons. I'll go with the best number.`,
+		EscalationRules: `The seller makes a final offer or says they can't go lower
+The seller's price is still far above the competing offers after two rounds`,
+	},
+	{
+		Key:         "otd_only",
+		Name:        "Out-the-door only",
+		Description: "Negotiates only the total out-the-door price and refuses to discuss monthly payments.",
+		PromptFragment: `Negotiate on the out-the-door price only:
+- Every counteroffer is an out-the-door total including taxes, fees and add-ons.
+- Refuse to discuss monthly payments, down payments, trade-in values or financing until the out-the-door price is agreed.
+- If the seller quotes a monthly payment or a price before fees, ask for the full out-the-door total, itemized.
+- Compare offers by their out-the-door totals.`,
+		OpeningTemplate: `Hello,
+
+I'm interested in a {{.Year}} {{.Make}} {{.Model}}. Please send your out-the-door price, including all taxes, fees and any add-ons, itemized. I'm negotiating on the total price only, not monthly payments.
+
+Thank you.`,
+		EscalationRules: `The seller won't give an out-the-door total after being asked twice
+The seller offers financing or trade-in terms the buyer has to decide on`,
+	},
+	{
+		Key:         "lease_focused",
+		Name:        "Lease-focused",
+		Description: "Negotiates a lease: selling price, money factor, residual and fees.",
+		PromptFragment: `The buyer wants to lease:
+- Negotiate the selling price (capitalized cost) first, as if buying, then the lease terms.
+- Ask for the money factor, residual value, term, annual mileage, acquisition fee and total due at signing, and check they are all stated.
+- Push back on marked-up money factors, and on capitalized cost reductions hiding a higher price.
+- Compare offers by total lease cost (monthly payments times term plus due at signing), not the monthly payment alone.`,
+		OpeningTemplate: `Hello,
+
+I'm looking to lease a {{.Year}} {{.Make}} {{.Model}}. Could you send your lease quote with the selling price, money factor, residual, term, annual mileage, and an itemized total due at signing?
+
+Thanks.`,
+		EscalationRules: `The seller asks for a down payment or credit application
+The buyer would need to choose a different term or mileage`,
+	},
+	{
+		Key:         "end_of_month",
+		Name:        "End-of-month pressure",
+		Description: "Uses the seller's sales targets and a close-by deadline to push for a better deal.",
+		PromptFragment: `Use time pressure:
+- Sellers have monthly and quarterly targets. Remind them the buyer can close before the end of the month if the price is right.
+- Give each counteroffer a short deadline, such as the end of the week or month.
+- Ask the seller to check with their manager for any end-of-month incentives or targets they're trying to hit.
+- Don't let the seller stall into next month: if they delay, say the buyer will decide with the offers they have.`,
+		OpeningTemplate: `Hello,
+
+I'm planning to buy a {{.Year}} {{.Make}} {{.Model}} before the end of this month. If you can send a competitive out-the-door price soon, itemized, I can move quickly.
+
+Thanks.`,
+		EscalationRules: `The seller agrees to the buyer's price and wants to set up the purchase
+The deadline the buyer set has passed`,
+	},
+}
+
+// StrategyProfileRequest creates or updates a custom strategy profile
+type StrategyProfileRequest struct {
+	Name            string
+	Description     string
+	PromptFragment  string
+	OpeningTemplate string
+	EscalationRules string
+}
+
+// StrategyService manages negotiation strategy profiles and which one each thread uses
+type StrategyService struct {
+	db *gorm.DB
+}
+
+// NewStrategyService creates a new strategy service
+func NewStrategyService(db *gorm.DB) *StrategyService {
+	return &StrategyService{
+		db: db,
+	}
+}
+
+// Seed creates the built-in strategy profiles, and updates them to the current built-in text
+func (s *StrategyService) Seed() error {
+	for _, builtin := range builtinStrategies {
+		var profile models.StrategyProfile
+		err := s.db.Where("key = ? AND user_id IS NULL", builtin.Key).First(&profile).Error
+		switch {
+		case errors.Is(err, gorm.ErrRecordNotFound):
+			profile = builtin
+			err = s.db.Create(&profile).Error
+		case err == nil:
+			err = s.db.Model(&profile).Updates(map[string]interface{}{
+				"name":             builtin.Name,
+				"description":      builtin.Description,
+				"prompt_fragment":  builtin.PromptFragment,
+				"opening_template": builtin.OpeningTemplate,
+				"escalation_rules": builtin.EscalationRules,
+			}).Error
+		}
+		if err != nil {
+			return fmt.Errorf("failed to seed %s strategy profile: %w", builtin.Key, err)
+		}
+	}
+	return nil
+}
+
+// ListProfiles returns the built-in strategy profiles, then the user's own by name
+func (s *StrategyService) ListProfiles(userID uuid.UUID) ([]models.StrategyProfile, error) {
+	var profiles []models.StrategyProfile
+	if err := s.db.Where("user_id IS NULL OR user_id = ?", userID).Find(&profiles).Error; err != nil {
+		return nil, fmt.Errorf("database error: %w", err)
+	}
+	sortStrategyProfiles(profiles)
+	return profiles, nil
+}
+
+// GetProfile returns a built-in profile or one of the user's own
+func (s *StrategyService) GetProfile(userID, profileID uuid.UUID) (*models.StrategyProfile, error) {
+	var profile models.StrategyProfile
+	if err := s.db.Where("id = ? AND (user_id IS NULL OR user_id = ?)", profileID, userID).First(&profile).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, errors.New("strategy profile not found")
+		}
+		return nil, fmt.Errorf("database error: %w", err)
+	}
+	return &profile, nil
+}
+
+// CreateProfile saves a custom strategy profile for the user
+func (s *StrategyService) CreateProfile(userID uuid.UUID, req StrategyProfileRequest) (*models.StrategyProfile, error) {
+	if err := validateStrategyProfile(&req); err != nil {
+		return nil, err
+	}
+
+	var count int64
+	if err := s.db.Model(&models.StrategyProfile{}).Where("user_id = ?", userID).Count(&count).Error; err != nil {
+		return nil, fmt.Errorf("database error: %w", err)
+	}
+	if count >= maxStrategyProfiles {
+		return nil, fmt.Errorf("you can have at most %d strategy profiles", maxStrategyProfiles)
+	}
+
+	profile := models.StrategyProfile{
+		UserID:          &userID,
+		Name:            req.Name,
+		Description:     req.Description,
+		PromptFragment:  req.PromptFragment,
+		OpeningTemplate: req.OpeningTemplate,
+		EscalationRules: req.EscalationRules,
+	}
+	if err := s.db.Create(&profile).Error; err != nil {
+		return nil, fmt.Errorf("failed to create strategy profile: %w", err)
+	}
+	return &profile, nil
+}
+
+// UpdateProfile replaces a custom strategy profile. Threads using it follow the new version.
+func (s *StrategyService) UpdateProfile(userID, profileID uuid.UUID, req StrategyProfileRequest) (*models.StrategyProfile, error) {
+	profile, err := s.GetProfile(userID, profileID)
+	if err != nil {
+		return nil, err
+	}
+	if profile.Builtin() {
+		return nil, errors.New("built-in strategy profiles can't be changed")
+	}
+	if err := validateStrategyProfile(&req); err != nil {
+		return nil, err
+	}
+
+	profile.Name = req.Name
+	profile.Description = req.Description
+	profile.PromptFragment = req.PromptFragment
+	profile.OpeningTemplate = req.OpeningTemplate
+	profile.EscalationRules = req.EscalationRules
+	if err := s.db.Save(profile).Error; err != nil {
+		return nil, fmt.Errorf("failed to update strategy profile: %w", err)
+	}
+	return profile, nil
+}
+
+// DeleteProfile deletes a custom strategy profile. Threads using it go back to the default
+// approach.
+func (s *StrategyService) DeleteProfile(userID, profileID uuid.UUID) error {
+	profile, err := s.GetProfile(userID, profileID)
+	if err != nil {
+		return err
+	}
+	if profile.Builtin() {
+		return errors.New("built-in strategy profiles can't be changed")
+	}
+
+	return s.db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Model(&models.Thread{}).Where("strategy_profile_id = ?", profile.ID).
+			Update("strategy_profile_id", nil).Error; err != nil {
+			return fmt.Errorf("failed to update threads: %w", err)
+		}
+		if err := tx.Delete(profile).Error; err != nil {
+			return fmt.Errorf("failed to delete strategy profile: %w", err)
+		}
+		return nil
+	})
+}
+
+// SetThreadStrategy sets the strategy profile a seller thread's agent follows. A nil profile
+// goes back to the default approach.
+func (s *StrategyService) SetThreadStrategy(userID, threadID uuid.UUID, profileID *uuid.UUID) (*models.Thread, error) {
+	var thread models.Thread
+	if err := s.db.Where("id = ? AND user_id = ? AND type = ? AND deleted_at IS NULL", threadID, userID, models.ThreadTypeSeller).First(&thread).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, errors.New("thread not found")
+		}
+		return nil, fmt.Errorf("database error: %w", err)
+	}
+
+	if profileID != nil {
+		profile, err := s.GetProfile(userID, *profileID)
+		if err != nil {
+			return nil, err
+		}
+		thread.Strategy = profile
+	}
+
+	if err := s.db.Model(&thread).Update("strategy_profile_id", profileID).Error; err != nil {
+		return nil, fmt.Errorf("failed to update thread: %w", err)
+	}
+	thread.StrategyProfileID = profileID
+	return &thread, nil
+}
+
+// validateStrategyProfile trims a custom profile and checks it is complete and its opening
+// template renders
+func validateStrategyProfile(req *StrategyProfileRequest) error {
+	req.Name = strings.TrimSpace(req.Name)
+	req.Description = strings.TrimSpace(req.Description)
+	req.PromptFragment = strings.TrimSpace(req.PromptFragment)
+	req.OpeningTemplate = strings.TrimSpace(req.OpeningTemplate)
+	req.EscalationRules = strings.Join(neverDiscloseItems(req.EscalationRules), "\n")
+
+	if req.Name == "" {
+		return errors.New("name is required")
+	}
+	if len(req.Name) > maxStrategyNameChars {
+		return fmt.Errorf("name must be at most %d characters", maxStrategyNameChars)
+	}
+	if req.PromptFragment == "" {
+		return errors.New("prompt fragment is required")
+	}
+	for _, text := range []string{req.Description, req.PromptFragment, req.OpeningTemplate, req.EscalationRules} {
+		if len(text) > maxStrategyFragmentChars {
+			return fmt.Errorf("each field must be at most %d characters", maxStrategyFragmentChars)
+		}
+	}
+	if _, err := renderOpening(req.OpeningTemplate, promptSamples[models.LLMPurposeNegotiation].(NegotiationPromptData)); err != nil {
+		return err
+	}
+	return nil
+}
+
+// renderOpening renders a profile's opening template with the negotiation prompt variables
+func renderOpening(opening string, data NegotiationPromptData) (string, error) {
+	if opening == "" {
+		return "", nil
+	}
+	tmpl, err := template.New("opening").Option("missingkey=error").Parse(opening)
+	if err != nil {
+		return "", fmt.Errorf("invalid opening template: %w", err)
+	}
+	var b strings.Builder
+	if err := tmpl.Execute(&b, data); err != nil {
+		return "", fmt.Errorf("invalid opening template: %w", err)
+	}
+	return strings.TrimSpace(b.String()), nil
+}
+
+// strategyPrompt renders the instructions a strategy profile adds to the negotiation system
+// prompt. The opening is only included for the first message to the seller.
+func strategyPrompt(profile *models.StrategyProfile, data NegotiationPromptData, opening bool) string {
+	if profile == nil {
+		return ""
+	}
+
+	var b strings.Builder
+	fmt.Fprintf(&b, "Negotiation Strategy (%s), chosen by the buyer for this seller. Where it differs from the style guidelines above, follow the strategy:\n%s\n", profile.Name, profile.PromptFragment)
+
+	if opening {
+		// Profiles are validated when saved, so a failure here is a built-in template bug
+		if text, err := renderOpening(profile.OpeningTemplate, data); err == nil && text != "" {
+			fmt.Fprintf(&b, "\nNothing has been exchanged with the seller yet. When drafting the first message to them, base it on this opening, adapted to what the buyer asks:\n%s\n", text)
+		}
+	}
+
+	if rules := neverDiscloseItems(profile.EscalationRules); len(rules) > 0 {
+		b.WriteString("\nHand the decision back to the buyer instead of drafting a reply when:\n")
+		for _, rule := range rules {
+			fmt.Fprintf(&b, "- %s\n", rule)
+		}
+		b.WriteString("In that case, briefly explain the situation and the buyer's options.\n")
+	}
+	return strings.TrimSpace(b.String())
+}
+
+// sortStrategyProfiles orders built-in profiles as they are defined, then custom profiles by
+// name, case-insensitively
+func sortStrategyProfiles(profiles []models.StrategyProfile) {
+	builtinOrder := map[string]int{}
+	for i, builtin := range builtinStrategies {
+		builtinOrder[builtin.Key] = i
+	}
+	sort.SliceStable(profiles, func(i, j int) bool {
+		a, b := &profiles[i], &profiles[j]
+		if a.Builtin() != b.Builtin() {
+			return a.Builtin()
+		}
+		if a.Builtin() {
+			return builtinOrder[a.Key] < builtinOrder[b.Key]
+		}
+		return strings.ToLower(a.Name) < strings.ToLower(b.Name)
+	})
+}
@@ -0,0 +1,130 @@
+package services
+
+import (
+	"strings"
+	"testing"
+
+	"carbuyer/internal/db/models"
+
+	"github.com/google/uuid"
+)
+
+func TestBuiltinStrategiesAreValid(t *testing.T) {
+	keys := map[string]bool{}
+	for _, builtin := range builtinStrategies {
+		req := StrategyProfileRequest{
+			Name:            builtin.Name,
+			Description:     builtin.Description,
+			PromptFragment:  builtin.PromptFragment,
+			OpeningTemplate: builtin.OpeningTemplate,
+			EscalationRules: builtin.EscalationRules,
+		}
+		if err := validateStrategyProfile(&req); err != nil {
+			t.Errorf("%s: %v", builtin.Key, err)
+		}
+		if keys[builtin.Key] {
+			t.Errorf("duplicate key %s", builtin.Key)
+		}
+		keys[builtin.Key] = true
+	}
+}
+
+func TestValidateStrategyProfile(t *testing.T) {
+	tests := []struct {
+		name string
+		req  StrategyProfileRequest
+		want string // Error, if any
+	}{
+		{"valid", StrategyProfileRequest{Name: " Trade-in first ", PromptFragment: "Settle the trade-in value before the price.", OpeningTemplate: "Hi {{.SellerName}},"}, ""},
+		{"no name", StrategyProfileRequest{PromptFragment: "Be nice."}, "name is required"},
+		{"no fragment", StrategyProfileRequest{Name: "Nice"}, "prompt fragment is required"},
+		{"long name", StrategyProfileRequest{Name: strings.Repeat("a", maxStrategyNameChars+1), PromptFragment: "Be nice."}, "name must be at most"},
+		{"unknown variable", StrategyProfileRequest{Name: "Nice", PromptFragment: "Be nice.", OpeningTemplate: "Hi {{.Dealer}}"}, "invalid opening template"},
+		{"bad syntax", StrategyProfileRequest{Name: "Nice", PromptFragment: "Be nice.", OpeningTemplate: "Hi {{.SellerName"}, "invalid opening template"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := validateStrategyProfile(&tt.req)
+			if tt.want == "" {
+				if err != nil {
+					t.Fatalf("validateStrategyProfile() error = %v", err)
+				}
+				return
+			}
+			if err == nil || !strings.Contains(err.Error(), tt.want) {
+				t.Errorf("validateStrategyProfile() error = %v, want %q", err, tt.want)
+			}
+		})
+	}
+
+	req := StrategyProfileRequest{Name: " Nice ", PromptFragment: "Be nice.", EscalationRules: "\n  Seller asks for a deposit \n\nSeller goes silent\n"}
+	if err := validateStrategyProfile(&req); err != nil {
+		t.Fatal(err)
+	}
+	if req.Name != "Nice" || req.EscalationRules != "Seller asks for a deposit\nSeller goes silent" {
+		t.Errorf("validateStrategyProfile() didn't trim: %+v", req)
+	}
+}
+
+func TestStrategyPrompt(t *testing.T) {
+	profile := &models.StrategyProfile{
+		Name:            "Hard-line",
+		PromptFragment:  "Be brief.",
+		OpeningTemplate: "Hello {{.SellerName}}, I want a {{.Year}} {{.Make}} {{.Model}}.",
+		EscalationRules: "The seller makes a final offer\nThe seller asks for a deposit",
+	}
+	data := NegotiationPromptData{Year: 2025, Make: "Ford", Model: "Maverick", SellerName: "Metro Ford"}
+
+	if got := strategyPrompt(nil, data, true); got != "" {
+		t.Errorf("strategyPrompt(nil) = %q, want empty", got)
+	}
+
+	opening := strategyPrompt(profile, data, true)
+	for _, want := range []string{
+		"Negotiation Strategy (Hard-line)",
+		"Be brief.",
+		"Hello Metro Ford, I want a 2025 Ford Maverick.",
+		"- The seller makes a final offer\n- The seller asks for a deposit",
+	} {
+		if !strings.Contains(opening, want) {
+			t.Errorf("strategy prompt is missing %q:\n%s", want, opening)
+		}
+	}
+
+	if later := strategyPrompt(profile, data, false); strings.Contains(later, "Hello Metro Ford") {
+		t.Errorf("opening included after the first message:\n%s", later)
+	}
+
+	prompt, err := DefaultPrompt(models.LLMPurposeNegotiation)
+	if err != nil {
+		t.Fatal(err)
+	}
+	req, err := negotiationRequest(prompt, data, opening, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.HasSuffix(req.System, opening) {
+		t.Error("negotiation system prompt doesn't end with the strategy")
+	}
+}
+
+func TestSortStrategyProfiles(t *testing.T) {
+	userID := uuid.New()
+	profiles := []models.StrategyProfile{
+		{Name: "zebra", UserID: &userID},
+		{Key: "end_of_month", Name: "End-of-month pressure"},
+		{Name: "Alpha", UserID: &userID},
+		{Key: "collaborative", Name: "Collaborative"},
+	}
+
+	sortStrategyProfiles(profiles)
+
+	var got []string
+	for _, profile := range profiles {
+		got = append(got, profile.Name)
+	}
+	if strings.Join(got, ",") != "Collaborative,End-of-month pressure,Alpha,zebra" {
+		t.Errorf("order = %v", got)
+	}
+}
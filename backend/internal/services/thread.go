@@ -12,12 +12,14 @@ import (
 )
 
 type ThreadService struct {
-	db *gorm.DB
+	db            *gorm.DB
+	mailgunDomain string
 }
 
-func NewThreadService(db *gorm.DB) *ThreadService {
+func NewThreadService(db *gorm.DB, mailgunDomain string) *ThreadService {
 	return &ThreadService{
-		db: db,
+		db:            db,
+		mailgunDomain: mailgunDomain,
 	}
 }
 
@@ -37,6 +39,7 @@ func (s *ThreadService) CreateThread(userID uuid.UUID, sellerName string, seller
 		UserID:     userID,
 		SellerName: sellerName,
 		SellerType: sellerType,
+		Type:       models.ThreadTypeSeller,
 	}
 
 	if err := s.db.Create(thread).Error; err != nil {
@@ -49,7 +52,7 @@ func (s *ThreadService) CreateThread(userID uuid.UUID, sellerName string, seller
 // GetUserThreads retrieves all threads for a user
 func (s *ThreadService) GetUserThreads(userID uuid.UUID) ([]models.Thread, error) {
 	var threads []models.Thread
-	if err := s.db.Where("user_id = ? AND deleted_at IS NULL", userID).Order("created_at DESC").Find(&threads).Error; err != nil {
+	if err := s.db.Where("user_id = ? AND type = ? AND deleted_at IS NULL", userID, models.ThreadTypeSeller).Order("created_at DESC").Find(&threads).Error; err != nil {
 		return nil, fmt.Errorf("failed to retrieve threads: %w", err)
 	}
 
@@ -103,3 +106,18 @@ func (s *ThreadService) ArchiveThread(threadID, userID uuid.UUID) error {
 
 	return nil
 }
+
+// GetThreadReplyAddress returns the per-thread plus-address sellers should reply to.
+// Returns an empty string when no inbound domain is configured.
+func (s *ThreadService) GetThreadReplyAddress(threadID, userID uuid.UUID) (string, error) {
+	if s.mailgunDomain == "" {
+		return "", nil
+	}
+
+	var user models.User
+	if err := s.db.Where("id = ?", userID).First(&user).Error; err != nil {
+		return "", fmt.Errorf("failed to load user: %w", err)
+	}
+
+	return ThreadReplyAddress(&user, threadID, s.mailgunDomain), nil
+}
@@ -0,0 +1,329 @@
+package services
+
+import (
+	"regexp"
+	"sort"
+	"strings"
+
+	"github.com/google/uuid"
+)
+
+// Confidence thresholds for routing inbound emails to threads
+const (
+	// ThreadMatchAutoAssignThreshold is the minimum confidence to assign a message to a thread automatically
+	ThreadMatchAutoAssignThreshold = 0.85
+	// ThreadMatchSuggestThreshold is the minimum confidence to keep a thread as a suggestion on an inbox message
+	ThreadMatchSuggestThreshold = 0.4
+)
+
+// ThreadMatchSignal identifies which heuristic produced a match
+type ThreadMatchSignal string
+
+const (
+	ThreadMatchSignalReplyAlias   ThreadMatchSignal = "reply_alias"
+	ThreadMatchSignalReplyHeader  ThreadMatchSignal = "reply_header"
+	ThreadMatchSignalSenderEmail  ThreadMatchSignal = "sender_email"
+	ThreadMatchSignalSenderDomain ThreadMatchSignal = "sender_domain"
+	ThreadMatchSignalSellerName   ThreadMatchSignal = "seller_name"
+	ThreadMatchSignalSubject      ThreadMatchSignal = "subject"
+)
+
+// Per-signal confidence weights
+const (
+	replyHeaderConfidence       = 0.99
+	uniqueSenderEmailConfidence = 0.9
+	sharedSenderEmailConfidence = 0.6
+	senderDomainConfidence      = 0.6
+	sellerNameDomainConfidence  = 0.5
+	subjectMaxConfidence        = 0.75
+	minSubjectSimilarity        = 0.5
+	ambiguousMatchMargin        = 0.05
+)
+
+// freeEmailDomains are consumer mail providers whose domain says nothing about the seller
+var freeEmailDomains = map[string]bool{
+	"gmail.com":      true,
+	"googlemail.com": true,
+	"yahoo.com":      true,
+	"hotmail.com":    true,
+	"outlook.com":    true,
+	"live.com":       true,
+	"msn.com":        true,
+	"icloud.com":     true,
+	"me.com":         true,
+	"aol.com":        true,
+	"proton.me":      true,
+	"protonmail.com": true,
+}
+
+var (
+	subjectPrefixPattern = regexp.MustCompile(`(?i)^\s*((re|fw|fwd|aw|sv)\s*(\[\d+\])?\s*:|\[[^\]]*\])\s*`)
+	nonAlphanumPattern   = regexp.MustCompile(`[^a-z0-9]+`)
+)
+
+// InboundMatchInput holds the parts of an inbound email used for thread matching
+type InboundMatchInput struct {
+	From       string
+	Subject    string
+	InReplyTo  string
+	References []string
+}
+
+// ThreadMatchCandidate describes a thread and what is known about its seller
+type ThreadMatchCandidate struct {
+	ThreadID     uuid.UUID
+	SellerName   string
+	MessageIDs   []string // External Message-IDs already stored in the thread
+	SellerEmails []string // Addresses the seller has written from
+	Subjects     []string // Subjects of emails already in the thread
+}
+
+// ThreadMatch is the best thread found for an inbound email
+type ThreadMatch struct {
+	ThreadID   uuid.UUID
+	Confidence float64
+	Signal     ThreadMatchSignal
+}
+
+// AutoAssign reports whether the match is confident enough to route the message without the user
+func (m *ThreadMatch) AutoAssign() bool {
+	return m != nil && m.Confidence >= ThreadMatchAutoAssignThreshold
+}
+
+// ThreadMatcher routes inbound emails to existing threads using reply headers,
+// known seller contacts and subject similarity
+type ThreadMatcher struct{}
+
+// NewThreadMatcher creates a new thread matcher
+func NewThreadMatcher() *ThreadMatcher {
+	return &ThreadMatcher{}
+}
+
+// Match returns the most likely thread for the email, or nil if nothing clears the suggestion threshold
+func (m *ThreadMatcher) Match(input InboundMatchInput, candidates []ThreadMatchCandidate) *ThreadMatch {
+	if len(candidates) == 0 {
+		return nil
+	}
+
+	// Reply headers are authoritative: the sender's client is telling us what it replied to
+	replyIDs := make(map[string]bool)
+	for _, id := range append([]string{input.InReplyTo}, input.References...) {
+		if normalized := NormalizeMessageID(id); normalized != "" {
+			replyIDs[normalized] = true
+		}
+	}
+	if len(replyIDs) > 0 {
+		for _, candidate := range candidates {
+			for _, id := range candidate.MessageIDs {
+				if replyIDs[NormalizeMessageID(id)] {
+					return &ThreadMatch{
+						ThreadID:   candidate.ThreadID,
+						Confidence: replyHeaderConfidence,
+						Signal:     ThreadMatchSignalReplyHeader,
+					}
+				}
+			}
+		}
+	}
+
+	senderEmail := extractEmailAddress(input.From)
+	senderDomain := emailDomain(senderEmail)
+
+	// Count how many threads already know this sender so shared contacts score lower
+	senderThreadCount := 0
+	if senderEmail != "" {
+		for _, candidate := range candidates {
+			if containsEmail(candidate.SellerEmails, senderEmail) {
+				senderThreadCount++
+			}
+		}
+	}
+
+	var matches []ThreadMatch
+	for _, candidate := range candidates {
+		confidence := 0.0
+		var signal ThreadMatchSignal
+		strongest := 0.0
+
+		addSignal := func(score float64, s ThreadMatchSignal) {
+			if score <= 0 {
+				return
+			}
+			// Combine independent signals with a noisy-OR so agreement raises confidence
+			confidence = 1 - (1-confidence)*(1-score)
+			if score > strongest {
+				strongest = score
+				signal = s
+			}
+		}
+
+		if senderEmail != "" && containsEmail(candidate.SellerEmails, senderEmail) {
+			if senderThreadCount == 1 {
+				addSignal(uniqueSenderEmailConfidence, ThreadMatchSignalSenderEmail)
+			} else {
+				addSignal(sharedSenderEmailConfidence, ThreadMatchSignalSenderEmail)
+			}
+		} else if senderDomain != "" && !freeEmailDomains[senderDomain] {
+			if containsDomain(candidate.SellerEmails, senderDomain) {
+				addSignal(senderDomainConfidence, ThreadMatchSignalSenderDomain)
+			} else if sellerNameMatchesDomain(candidate.SellerName, senderDomain) {
+				addSignal(sellerNameDomainConfidence, ThreadMatchSignalSellerName)
+			}
+		}
+
+		bestSimilarity := 0.0
+		for _, subject := range candidate.Subjects {
+			if sim := SubjectSimilarity(input.Subject, subject); sim > bestSimilarity {
+				bestSimilarity = sim
+			}
+		}
+		if bestSimilarity >= minSubjectSimilarity {
+			addSignal(bestSimilarity*subjectMaxConfidence, ThreadMatchSignalSubject)
+		}
+
+		if confidence > 0 {
+			matches = append(matches, ThreadMatch{
+				ThreadID:   candidate.ThreadID,
+				Confidence: confidence,
+				Signal:     signal,
+			})
+		}
+	}
+
+	if len(matches) == 0 {
+		return nil
+	}
+
+	sort.SliceStable(matches, func(i, j int) bool {
+		return matches[i].Confidence > matches[j].Confidence
+	})
+
+	best := matches[0]
+
+	// Two threads scoring about the same is a coin flip - let the user decide
+	if len(matches) > 1 && best.Confidence-matches[1].Confidence < ambiguousMatchMargin &&
+		best.Confidence >= ThreadMatchAutoAssignThreshold {
+		best.Confidence = ThreadMatchAutoAssignThreshold - ambiguousMatchMargin
+	}
+
+	if best.Confidence < ThreadMatchSuggestThreshold {
+		return nil
+	}
+
+	return &best
+}
+
+// NormalizeMessageID strips whitespace and angle brackets from a Message-ID header value
+func NormalizeMessageID(id string) string {
+	id = strings.TrimSpace(id)
+	id = strings.TrimPrefix(id, "<")
+	id = strings.TrimSuffix(id, ">")
+	return strings.TrimSpace(id)
+}
+
+// ParseMessageIDList splits a References header into individual Message-IDs
+func ParseMessageIDList(header string) []string {
+	var ids []string
+	for _, field := range strings.Fields(header) {
+		// Headers may also be comma separated
+		for _, part := range strings.Split(field, ",") {
+			if id := NormalizeMessageID(part); id != "" {
+				ids = append(ids, id)
+			}
+		}
+	}
+	return ids
+}
+
+// NormalizeSubject lowercases a subject and removes reply/forward prefixes and tags
+func NormalizeSubject(subject string) string {
+	subject = strings.ToLower(strings.TrimSpace(subject))
+	for {
+		stripped := subjectPrefixPattern.ReplaceAllString(subject, "")
+		if stripped == subject {
+			break
+		}
+		subject = stripped
+	}
+	return strings.TrimSpace(subject)
+}
+
+// SubjectSimilarity returns the Jaccard similarity (0-1) of the word sets of two subjects
+func SubjectSimilarity(a, b string) float64 {
+	tokensA := subjectTokens(a)
+	tokensB := subjectTokens(b)
+	if len(tokensA) == 0 || len(tokensB) == 0 {
+		return 0
+	}
+
+	intersection := 0
+	for token := range tokensA {
+		if tokensB[token] {
+			intersection++
+		}
+	}
+	union := len(tokensA) + len(tokensB) - intersection
+	return float64(intersection) / float64(union)
+}
+
+func subjectTokens(subject string) map[string]bool {
+	tokens := make(map[string]bool)
+	for _, token := range nonAlphanumPattern.Split(NormalizeSubject(subject), -1) {
+		if token != "" {
+			tokens[token] = true
+		}
+	}
+	return tokens
+}
+
+// extractEmailAddress pulls the bare, lowercased address out of "Name <email>" or "email"
+func extractEmailAddress(from string) string {
+	from = strings.TrimSpace(from)
+	if start := strings.LastIndex(from, "<"); start >= 0 {
+		if end := strings.Index(from[start:], ">"); end > 0 {
+			from = from[start+1 : start+end]
+		}
+	}
+	from = strings.ToLower(strings.TrimSpace(from))
+	if !strings.Contains(from, "@") {
+		return ""
+	}
+	return from
+}
+
+func emailDomain(email string) string {
+	at := strings.LastIndex(email, "@")
+	if at < 0 {
+		return ""
+	}
+	return strings.ToLower(email[at+1:])
+}
+
+func containsEmail(emails []string, email string) bool {
+	for _, e := range emails {
+		if extractEmailAddress(e) == email {
+			return true
+		}
+	}
+	return false
+}
+
+func containsDomain(emails []string, domain string) bool {
+	for _, e := range emails {
+		if emailDomain(extractEmailAddress(e)) == domain {
+			return true
+		}
+	}
+	return false
+}
+
+// sellerNameMatchesDomain checks whether a seller name like "Toyota of Seattle"
+// appears in a domain like "toyotaofseattle.com"
+func sellerNameMatchesDomain(sellerName, domain string) bool {
+	compactName := nonAlphanumPattern.ReplaceAllString(strings.ToLower(sellerName), "")
+	if len(compactName) < 4 {
+		return false
+	}
+	compactDomain := nonAlphanumPattern.ReplaceAllString(domain, "")
+	return strings.Contains(compactDomain, compactName)
+}
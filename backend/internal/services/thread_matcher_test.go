@@ -0,0 +1,209 @@
+package services
+
+import (
+	"testing"
+
+	"github.com/google/uuid"
+)
+
+func TestThreadMatcherMatch(t *testing.T) {
+	matcher := NewThreadMatcher()
+
+	toyota := uuid.MustParse("11111111-1111-1111-1111-111111111111")
+	honda := uuid.MustParse("22222222-2222-2222-2222-222222222222")
+	private := uuid.MustParse("33333333-3333-3333-3333-333333333333")
+
+	candidates := []ThreadMatchCandidate{
+		{
+			ThreadID:     toyota,
+			SellerName:   "Toyota of Seattle",
+			MessageIDs:   []string{"<quote-123@toyotaofseattle.com>"},
+			SellerEmails: []string{"Jane Smith <jane@toyotaofseattle.com>"},
+			Subjects:     []string{"Your 2025 RAV4 Hybrid XLE quote"},
+		},
+		{
+			ThreadID:     honda,
+			SellerName:   "Bellevue Honda",
+			MessageIDs:   []string{"abc-456@mail.bellevuehonda.com"},
+			SellerEmails: []string{"sales@bellevuehonda.com"},
+			Subjects:     []string{"CR-V availability"},
+		},
+		{
+			ThreadID:     private,
+			SellerName:   "Bob",
+			SellerEmails: []string{"bob.seller@gmail.com"},
+			Subjects:     []string{"Craigslist RAV4"},
+		},
+	}
+
+	tests := []struct {
+		name           string
+		input          InboundMatchInput
+		candidates     []ThreadMatchCandidate
+		wantThread     *uuid.UUID
+		wantSignal     ThreadMatchSignal
+		wantAutoAssign bool
+	}{
+		{
+			name: "In-Reply-To matches stored Message-ID",
+			input: InboundMatchInput{
+				From:      "someone-else@example.com",
+				Subject:   "unrelated",
+				InReplyTo: "quote-123@toyotaofseattle.com",
+			},
+			candidates:     candidates,
+			wantThread:     &toyota,
+			wantSignal:     ThreadMatchSignalReplyHeader,
+			wantAutoAssign: true,
+		},
+		{
+			name: "References chain matches stored Message-ID",
+			input: InboundMatchInput{
+				From:       "someone-else@example.com",
+				References: []string{"<unknown@x.com>", "<abc-456@mail.bellevuehonda.com>"},
+			},
+			candidates:     candidates,
+			wantThread:     &honda,
+			wantSignal:     ThreadMatchSignalReplyHeader,
+			wantAutoAssign: true,
+		},
+		{
+			name: "Known sender email auto-assigns",
+			input: InboundMatchInput{
+				From:    "JANE@toyotaofseattle.com",
+				Subject: "Following up",
+			},
+			candidates:     candidates,
+			wantThread:     &toyota,
+			wantSignal:     ThreadMatchSignalSenderEmail,
+			wantAutoAssign: true,
+		},
+		{
+			name: "Same dealer domain is only a suggestion",
+			input: InboundMatchInput{
+				From:    "Mark <mark@bellevuehonda.com>",
+				Subject: "Hello from Mark",
+			},
+			candidates:     candidates,
+			wantThread:     &honda,
+			wantSignal:     ThreadMatchSignalSenderDomain,
+			wantAutoAssign: false,
+		},
+		{
+			name: "Domain plus matching subject auto-assigns",
+			input: InboundMatchInput{
+				From:    "mark@bellevuehonda.com",
+				Subject: "RE: CR-V availability",
+			},
+			candidates:     candidates,
+			wantThread:     &honda,
+			wantSignal:     ThreadMatchSignalSubject,
+			wantAutoAssign: true,
+		},
+		{
+			name: "Seller name found in domain of new contact",
+			input: InboundMatchInput{
+				From:    "internet@toyotaofseattle.com",
+				Subject: "Thanks for your inquiry",
+			},
+			candidates: []ThreadMatchCandidate{
+				{ThreadID: toyota, SellerName: "Toyota of Seattle"},
+				{ThreadID: honda, SellerName: "Bellevue Honda"},
+			},
+			wantThread:     &toyota,
+			wantSignal:     ThreadMatchSignalSellerName,
+			wantAutoAssign: false,
+		},
+		{
+			name: "Free mail domain is not a dealer signal",
+			input: InboundMatchInput{
+				From:    "stranger@gmail.com",
+				Subject: "Hi",
+			},
+			candidates: candidates,
+			wantThread: nil,
+		},
+		{
+			name: "Subject similarity alone is a suggestion",
+			input: InboundMatchInput{
+				From:    "stranger@gmail.com",
+				Subject: "Fwd: Re: Your 2025 RAV4 Hybrid XLE quote",
+			},
+			candidates:     candidates,
+			wantThread:     &toyota,
+			wantSignal:     ThreadMatchSignalSubject,
+			wantAutoAssign: false,
+		},
+		{
+			name: "Sender shared by two threads is not auto-assigned",
+			input: InboundMatchInput{
+				From:    "sales@bellevuehonda.com",
+				Subject: "Price update",
+			},
+			candidates: []ThreadMatchCandidate{
+				{ThreadID: honda, SellerName: "Bellevue Honda", SellerEmails: []string{"sales@bellevuehonda.com"}},
+				{ThreadID: toyota, SellerName: "Bellevue Honda (used)", SellerEmails: []string{"sales@bellevuehonda.com"}},
+			},
+			wantThread:     &honda,
+			wantSignal:     ThreadMatchSignalSenderEmail,
+			wantAutoAssign: false,
+		},
+		{
+			name: "No threads",
+			input: InboundMatchInput{
+				From:    "jane@toyotaofseattle.com",
+				Subject: "Your quote",
+			},
+			candidates: nil,
+			wantThread: nil,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := matcher.Match(tt.input, tt.candidates)
+			if tt.wantThread == nil {
+				if got != nil {
+					t.Fatalf("Match() = %+v, want nil", got)
+				}
+				return
+			}
+			if got == nil {
+				t.Fatalf("Match() = nil, want thread %s", *tt.wantThread)
+			}
+			if got.ThreadID != *tt.wantThread {
+				t.Errorf("Match() thread = %s, want %s", got.ThreadID, *tt.wantThread)
+			}
+			if got.Signal != tt.wantSignal {
+				t.Errorf("Match() signal = %q, want %q", got.Signal, tt.wantSignal)
+			}
+			if got.AutoAssign() != tt.wantAutoAssign {
+				t.Errorf("Match() auto-assign = %v (confidence %.2f), want %v", got.AutoAssign(), got.Confidence, tt.wantAutoAssign)
+			}
+		})
+	}
+}
+
+func TestSubjectSimilarity(t *testing.T) {
+	tests := []struct {
+		name string
+		a    string
+		b    string
+		want float64
+	}{
+		{name: "Identical", a: "CR-V availability", b: "CR-V availability", want: 1},
+		{name: "Reply prefixes ignored", a: "RE: Fwd: CR-V availability", b: "cr-v availability", want: 1},
+		{name: "Tag prefix ignored", a: "[EXT] Re[2]: CR-V availability", b: "CR-V availability", want: 1},
+		{name: "Partial overlap", a: "CR-V price", b: "CR-V availability", want: 0.5},
+		{name: "Empty subject", a: "", b: "CR-V availability", want: 0},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := SubjectSimilarity(tt.a, tt.b)
+			if got != tt.want {
+				t.Errorf("SubjectSimilarity(%q, %q) = %v, want %v", tt.a, tt.b, got, tt.want)
+			}
+		})
+	}
+}
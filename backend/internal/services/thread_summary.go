@@ -0,0 +1,269 @@
+package services
+
+import (
+	"context"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"carbuyer/internal/db/models"
+	"carbuyer/internal/llm"
+
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+)
+
+// Limits for thread summaries
+const (
+	summaryBatchSize       = 40   // Messages folded into the summary per LLM call
+	maxSummaryMessageChars = 2000 // Characters of each message sent to the LLM
+	maxThreadSummaryChars  = 8000 // Characters in a summary, generated or edited
+	summaryLockCount       = 64   // Mutexes shared between threads' summaries
+)
+
+// summarizedMessageCondition matches the messages a summary is built from: the seller's human
+// replies and what the buyer actually sent them. Chat with the agent and unsent drafts are left
+// out, since nothing in them was said to the seller.
+const summarizedMessageCondition = "((sender = ? AND " + humanCategoryCondition + ") OR (sender = ? AND external_message_id <> ''))"
+
+// ThreadSummaryService keeps a running summary of the key facts in each thread, so the agent
+// still knows about earlier prices and promises once their messages are too old to be sent
+// with a request. Summaries are updated incrementally: each refresh folds the messages since
+// the last one into the current summary, which keeps any edits the user made.
+type ThreadSummaryService struct {
+	db         *gorm.DB
+	llm        llm.LLM
+	locks      [summaryLockCount]sync.Mutex // Picked by thread ID, so a thread's summary has one writer at a time
+	background sync.WaitGroup
+}
+
+// NewThreadSummaryService creates a new thread summary service
+func NewThreadSummaryService(db *gorm.DB, llm llm.LLM) *ThreadSummaryService {
+	return &ThreadSummaryService{
+		db:  db,
+		llm: llm,
+	}
+}
+
+// GetSummary returns a thread's summary, or an empty one if nothing has been summarized yet
+func (s *ThreadSummaryService) GetSummary(threadID, userID uuid.UUID) (*models.ThreadSummary, error) {
+	thread, err := s.thread(threadID, &userID)
+	if err != nil {
+		return nil, err
+	}
+	return s.load(thread)
+}
+
+// UpdateSummary replaces a thread's summary with the user's edit. Later refreshes build on the
+// edited summary. Clearing it starts over: the next refresh summarizes the whole thread again.
+func (s *ThreadSummaryService) UpdateSummary(threadID, userID uuid.UUID, content string) (*models.ThreadSummary, error) {
+	content = strings.TrimSpace(content)
+	if len(content) > maxThreadSummaryChars {
+		return nil, fmt.Errorf("summary must be at most %d characters", maxThreadSummaryChars)
+	}
+
+	thread, err := s.thread(threadID, &userID)
+	if err != nil {
+		return nil, err
+	}
+
+	// Wait out a running refresh so it can't overwrite the edit
+	lock := s.lock(threadID)
+	lock.Lock()
+	defer lock.Unlock()
+
+	summary, err := s.load(thread)
+	if err != nil {
+		return nil, err
+	}
+
+	now := time.Now()
+	summary.Content = content
+	summary.EditedAt = &now
+	if content == "" {
+		summary.SummarizedThrough = nil
+		summary.SummarizedSequence = 0
+		summary.MessageCount = 0
+	}
+	if err := s.db.Save(summary).Error; err != nil {
+		return nil, fmt.Errorf("failed to save thread summary: %w", err)
+	}
+
+	if content == "" {
+		s.refreshAsync(threadID)
+	}
+
+	return summary, nil
+}
+
+// RefreshThread brings a thread's summary up to date with its messages
+func (s *ThreadSummaryService) RefreshThread(ctx context.Context, threadID, userID uuid.UUID) (*models.ThreadSummary, error) {
+	if _, err := s.thread(threadID, &userID); err != nil {
+		return nil, err
+	}
+	return s.Refresh(ctx, threadID)
+}
+
+// RefreshAsync updates the summary of a message's thread in the background, if the message is
+// one summaries are built from. The buyer's replies sent from other paths are picked up by the
+// next refresh. A nil service does nothing, so callers without summaries can pass nil.
+func (s *ThreadSummaryService) RefreshAsync(message *models.Message) {
+	if s == nil || !isSummarized(message) {
+		return
+	}
+	s.refreshAsync(*message.ThreadID)
+}
+
+// refreshAsync updates a thread's summary in the background
+func (s *ThreadSummaryService) refreshAsync(threadID uuid.UUID) {
+	s.background.Add(1)
+	go func() {
+		defer s.background.Done()
+		if _, err := s.Refresh(context.Background(), threadID); err != nil {
+			logLLMFailure(err, "refresh summary of thread %s", threadID)
+		}
+	}()
+}
+
+// Wait blocks until background refreshes have finished. Commands call this before exiting.
+func (s *ThreadSummaryService) Wait() {
+	if s != nil {
+		s.background.Wait()
+	}
+}
+
+// Refresh folds the messages inserted since a thread's last refresh into its summary, in
+// batches, and returns the summary. Messages are picked up in insertion order, so ones that
+// arrive late with an older timestamp (imports, delayed webhooks) aren't skipped. Nothing is
+// sent to the LLM when there are no new messages.
+func (s *ThreadSummaryService) Refresh(ctx context.Context, threadID uuid.UUID) (*models.ThreadSummary, error) {
+	lock := s.lock(threadID)
+	lock.Lock()
+	defer lock.Unlock()
+
+	thread, err := s.thread(threadID, nil)
+	if err != nil {
+		return nil, err
+	}
+	summary, err := s.load(thread)
+	if err != nil {
+		return nil, err
+	}
+
+	for {
+		query := s.db.Where("thread_id = ? AND deleted_at IS NULL", threadID).
+			Where(summarizedMessageCondition, models.SenderTypeSeller, models.MessageCategoryHuman, models.SenderTypeUser)
+		switch {
+		case summary.SummarizedSequence > 0:
+			query = query.Where("sequence > ?", summary.SummarizedSequence)
+		case summary.SummarizedThrough != nil:
+			// Summaries from before insertion order was tracked
+			query = query.Where("timestamp > ?", *summary.SummarizedThrough)
+		}
+		var messages []models.Message
+		if err := query.Order("sequence ASC").Limit(summaryBatchSize).Find(&messages).Error; err != nil {
+			return nil, fmt.Errorf("failed to load messages: %w", err)
+		}
+		if len(messages) == 0 {
+			return summary, nil
+		}
+		lastSequence := messages[len(messages)-1].Sequence
+
+		// The LLM reads the batch oldest first
+		sort.SliceStable(messages, func(i, j int) bool {
+			return messages[i].Timestamp.Before(messages[j].Timestamp)
+		})
+
+		req := threadSummaryRequest(thread.SellerName, summary.Content, messages)
+		req.UserID = thread.UserID.String()
+		response, err := s.llm.Complete(ctx, req)
+		if err != nil {
+			return nil, err
+		}
+		content, err := parseThreadSummary(response.Text)
+		if err != nil {
+			return nil, err
+		}
+
+		summary.Content = content
+		summary.SummarizedSequence = lastSequence
+		if newest := messages[len(messages)-1].Timestamp; summary.SummarizedThrough == nil || newest.After(*summary.SummarizedThrough) {
+			summary.SummarizedThrough = &newest
+		}
+		summary.MessageCount += len(messages)
+		if err := s.db.Save(summary).Error; err != nil {
+			return nil, fmt.Errorf("failed to save thread summary: %w", err)
+		}
+
+		if len(messages) < summaryBatchSize {
+			return summary, nil
+		}
+	}
+}
+
+// parseThreadSummary cleans up the summary the LLM returned, capping its length
+func parseThreadSummary(response string) (string, error) {
+	content := strings.TrimSpace(response)
+	if content == "" {
+		return "", errors.New("empty summary")
+	}
+	if len(content) > maxThreadSummaryChars {
+		content = strings.ToValidUTF8(content[:maxThreadSummaryChars], "") + "…"
+	}
+	return content, nil
+}
+
+// isSummarized reports whether a message is one summaries are built from: a human seller reply
+// or a message the buyer sent, in a thread
+func isSummarized(message *models.Message) bool {
+	if message.ThreadID == nil || message.DeletedAt != nil {
+		return false
+	}
+	switch message.Sender {
+	case models.SenderTypeSeller:
+		return message.Category == "" || message.Category == models.MessageCategoryHuman
+	case models.SenderTypeUser:
+		return message.ExternalMessageID != ""
+	}
+	return false
+}
+
+// lock returns the mutex guarding a thread's summary. Threads share a fixed set of mutexes
+// rather than each getting its own, so the set doesn't grow with every thread refreshed.
+func (s *ThreadSummaryService) lock(threadID uuid.UUID) *sync.Mutex {
+	return &s.locks[binary.BigEndian.Uint32(threadID[12:])%summaryLockCount]
+}
+
+// thread loads a thread, checking it belongs to userID when given
+func (s *ThreadSummaryService) thread(threadID uuid.UUID, userID *uuid.UUID) (*models.Thread, error) {
+	query := s.db.Where("id = ?", threadID)
+	if userID != nil {
+		query = query.Where("user_id = ?", *userID)
+	}
+
+	var thread models.Thread
+	if err := query.First(&thread).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, errors.New("thread not found")
+		}
+		return nil, fmt.Errorf("database error: %w", err)
+	}
+	return &thread, nil
+}
+
+// load returns a thread's stored summary, or a new empty one
+func (s *ThreadSummaryService) load(thread *models.Thread) (*models.ThreadSummary, error) {
+	var summary models.ThreadSummary
+	err := s.db.Where("thread_id = ?", thread.ID).First(&summary).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return &models.ThreadSummary{ThreadID: thread.ID, UserID: thread.UserID}, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("database error: %w", err)
+	}
+	return &summary, nil
+}
@@ -0,0 +1,149 @@
+package services
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"carbuyer/internal/db/models"
+	"carbuyer/internal/llm"
+
+	"github.com/google/uuid"
+)
+
+func TestIsSummarized(t *testing.T) {
+	threadID := uuid.New()
+	deletedAt := time.Now()
+
+	tests := []struct {
+		name    string
+		message models.Message
+		want    bool
+	}{
+		{
+			name:    "seller reply",
+			message: models.Message{Sender: models.SenderTypeSeller, ThreadID: &threadID, Category: models.MessageCategoryHuman},
+			want:    true,
+		},
+		{
+			name:    "unclassified seller message",
+			message: models.Message{Sender: models.SenderTypeSeller, ThreadID: &threadID},
+			want:    true,
+		},
+		{
+			name:    "sent reply",
+			message: models.Message{Sender: models.SenderTypeUser, ThreadID: &threadID, ExternalMessageID: "<abc@otto.local>"},
+			want:    true,
+		},
+		{
+			name:    "chat with the agent",
+			message: models.Message{Sender: models.SenderTypeUser, ThreadID: &threadID},
+		},
+		{
+			name:    "agent draft",
+			message: models.Message{Sender: models.SenderTypeAgent, ThreadID: &threadID},
+		},
+		{
+			name:    "marketing",
+			message: models.Message{Sender: models.SenderTypeSeller, ThreadID: &threadID, Category: models.MessageCategoryMarketing},
+		},
+		{
+			name:    "inbox message",
+			message: models.Message{Sender: models.SenderTypeSeller},
+		},
+		{
+			name:    "archived",
+			message: models.Message{Sender: models.SenderTypeSeller, ThreadID: &threadID, DeletedAt: &deletedAt},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := isSummarized(&tt.message); got != tt.want {
+				t.Errorf("isSummarized() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestParseThreadSummary(t *testing.T) {
+	got, err := parseThreadSummary("\n Prices:\n- Seller quoted $38,900 out the door on 2025-03-03\n")
+	if err != nil {
+		t.Fatalf("parseThreadSummary() error = %v", err)
+	}
+	if got != "Prices:\n- Seller quoted $38,900 out the door on 2025-03-03" {
+		t.Errorf("parseThreadSummary() = %q", got)
+	}
+
+	if _, err := parseThreadSummary("  "); err == nil {
+		t.Error("parseThreadSummary() error = nil for an empty summary")
+	}
+
+	long, err := parseThreadSummary(strings.Repeat("é", maxThreadSummaryChars))
+	if err != nil {
+		t.Fatalf("parseThreadSummary() error = %v", err)
+	}
+	if len(long) > maxThreadSummaryChars+len("…") || !strings.HasSuffix(long, "…") {
+		t.Errorf("parseThreadSummary() kept %d bytes of a long summary", len(long))
+	}
+}
+
+func TestThreadSummaryRequest(t *testing.T) {
+	sent := time.Date(2025, 3, 3, 15, 0, 0, 0, time.UTC)
+	messages := []models.Message{
+		{Sender: models.SenderTypeSeller, Content: "Best I can do is $38,900 out the door.", Timestamp: sent},
+		{Sender: models.SenderTypeUser, Content: "Can you drop the protection package?", Timestamp: sent.Add(time.Hour)},
+	}
+
+	req := threadSummaryRequest("Metro Ford", "", messages)
+	if req.Model != llm.ModelFast {
+		t.Errorf("Model = %q, want the fast model", req.Model)
+	}
+	prompt := req.Messages[0].Parts[0].Text
+	for _, want := range []string{
+		"Seller: Metro Ford",
+		"Current summary:\n(none yet)",
+		"[Monday, 2025-03-03] Seller: Best I can do is $38,900 out the door.",
+		"[Monday, 2025-03-03] Buyer: Can you drop the protection package?",
+	} {
+		if !strings.Contains(prompt, want) {
+			t.Errorf("prompt is missing %q:\n%s", want, prompt)
+		}
+	}
+}
+
+func TestNegotiationRequestIncludesSummary(t *testing.T) {
+	summary := "Concessions:\n- Seller will remove the $1,295 protection package"
+
+	prompt, err := DefaultPrompt(models.LLMPurposeNegotiation)
+	if err != nil {
+		t.Fatal(err)
+	}
+	data := NegotiationPromptData{Year: 2025, Make: "Ford", Model: "Maverick", SellerName: "Metro Ford", Summary: summary, UserMessage: "Draft a counteroffer"}
+
+	req, err := negotiationRequest(prompt, data, "", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(req.System, summary) {
+		t.Errorf("system prompt doesn't include the thread summary:\n%s", req.System)
+	}
+
+	data.Summary = ""
+	req, err = negotiationRequest(prompt, data, "", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if strings.Contains(req.System, "Thread Summary") {
+		t.Error("system prompt has a summary section without a summary")
+	}
+}
+
+func TestThreadSummaryLock(t *testing.T) {
+	s := NewThreadSummaryService(nil, nil)
+	threadID := uuid.New()
+
+	if s.lock(threadID) != s.lock(threadID) {
+		t.Error("lock() returned different mutexes for the same thread")
+	}
+}
@@ -0,0 +1,391 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"sort"
+	"sync"
+	"time"
+
+	"carbuyer/internal/db/models"
+	"carbuyer/internal/llm"
+
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+)
+
+// ErrTokenQuotaExceeded is returned for LLM requests made for a user over their monthly quota
+var ErrTokenQuotaExceeded = errors.New("monthly token quota exceeded")
+
+// logLLMFailure logs the error of LLM work done in the background, where there is no caller
+// to report it to. task completes "Failed to ...". A user over their quota is expected rather
+// than a failure, so it's logged as skipped work.
+func logLLMFailure(err error, task string, args ...interface{}) {
+	task = fmt.Sprintf(task, args...)
+	if errors.Is(err, ErrTokenQuotaExceeded) {
+		log.Printf("Skipped: %s (%v)", task, err)
+		return
+	}
+	log.Printf("Failed to %s: %v", task, err)
+}
+
+// maxUsageReportUsers caps how many users the global usage report lists
+const maxUsageReportUsers = 50
+
+// modelPrice is what a model costs in dollars per million tokens
+type modelPrice struct {
+	Input  float64
+	Output float64
+}
+
+// modelPrices are the list prices used to estimate spend. Models missing here are reported
+// without a cost.
+var modelPrices = map[llm.Model]modelPrice{
+	llm.ModelStandard: {Input: 3, Output: 15},
+	llm.ModelFast:     {Input: 1, Output: 5},
+}
+
+// UsageTotals sums the usage of a set of LLM requests
+type UsageTotals struct {
+	Requests      int64
+	InputTokens   int64
+	OutputTokens  int64
+	EstimatedCost float64 // Dollars, at list prices
+}
+
+// Tokens returns the input and output tokens together, as quotas count them
+func (t UsageTotals) Tokens() int64 {
+	return t.InputTokens + t.OutputTokens
+}
+
+// UsageBreakdown is the usage for one purpose, model or user in a report
+type UsageBreakdown struct {
+	Key string
+	UsageTotals
+}
+
+// UsageReport is the LLM usage for a calendar month (UTC)
+type UsageReport struct {
+	Month     time.Time
+	Totals    UsageTotals
+	ByPurpose []UsageBreakdown
+	ByModel   []UsageBreakdown
+	ByUser    []UsageBreakdown // Heaviest users first; only in the global report
+	Quota     int64            // Monthly tokens; 0 means unlimited. Only in a user's report.
+}
+
+// usageRow is one group of the usage ledger
+type usageRow struct {
+	UserID       *uuid.UUID
+	Purpose      string
+	Model        string
+	Requests     int64
+	InputTokens  int64
+	OutputTokens int64
+}
+
+// UsageService keeps the ledger of LLM tokens used and enforces monthly quotas. It is the
+// Meter of the app's LLM, so every request is checked and recorded.
+//
+// A request's usage is only known once it's answered, so until then its estimated tokens are
+// reserved against the quota; concurrent requests can't all pass on the same remaining
+// tokens. Reservations are per process and estimates can run low, so quotas are soft: a
+// user can go over by what the requests in flight use beyond their estimates.
+type UsageService struct {
+	db           *gorm.DB
+	defaultQuota int64
+
+	mu       sync.Mutex          // Guards reserved, and is held while checking a quota
+	reserved map[uuid.UUID]int64 // Estimated tokens of each user's requests in flight
+}
+
+// NewUsageService creates a new usage service. defaultQuota is each user's monthly token
+// quota unless overridden; 0 means unlimited.
+func NewUsageService(db *gorm.DB, defaultQuota int64) *UsageService {
+	return &UsageService{
+		db:           db,
+		defaultQuota: defaultQuota,
+		reserved:     map[uuid.UUID]int64{},
+	}
+}
+
+// Allow refuses requests made for a user who has used up this month's quota, counting the
+// requests they have in flight. An allowed request's estimated tokens are reserved until
+// it's recorded.
+func (s *UsageService) Allow(ctx context.Context, req llm.Request) error {
+	if req.UserID == "" {
+		return nil
+	}
+	userID, err := uuid.Parse(req.UserID)
+	if err != nil {
+		return fmt.Errorf("invalid user ID for LLM request: %w", err)
+	}
+
+	quota, err := s.GetQuota(userID)
+	if err != nil || quota == 0 {
+		return err
+	}
+
+	// Held across the ledger query, so a request recorded meanwhile isn't missed by both the
+	// query and the reservations
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	month := monthStart(time.Now())
+	used, err := s.monthTokens(userID, month)
+	if err != nil {
+		return err
+	}
+	used += s.reserved[userID]
+	if used+estimateRequestTokens(req) > quota {
+		return fmt.Errorf("%w: %d of %d tokens used, resets %s", ErrTokenQuotaExceeded, min(used, quota), quota, month.AddDate(0, 1, 0).Format("January 2"))
+	}
+
+	s.reserved[userID] += estimateRequestTokens(req)
+	return nil
+}
+
+// Record adds a response's usage to the ledger and releases the request's reservation. The
+// request has already been paid for, so failures are logged rather than returned.
+func (s *UsageService) Record(ctx context.Context, req llm.Request, response *llm.Response, elapsed time.Duration) {
+	// Released after the usage is in the ledger, so it's never missing from both
+	defer s.release(req)
+	if response == nil {
+		return
+	}
+
+	usage := models.LLMUsage{
+		Model:        string(req.Model),
+		Purpose:      models.LLMPurpose(req.Purpose),
+		InputTokens:  response.Usage.InputTokens,
+		OutputTokens: response.Usage.OutputTokens,
+		DurationMs:   elapsed.Milliseconds(),
+	}
+	if response.Model != "" {
+		usage.Model = string(response.Model)
+	}
+	if userID, err := uuid.Parse(req.UserID); err == nil {
+		usage.UserID = &userID
+	}
+
+	if err := s.db.Create(&usage).Error; err != nil {
+		log.Printf("Failed to record LLM usage (%s, %d in, %d out): %v", usage.Purpose, usage.InputTokens, usage.OutputTokens, err)
+	}
+}
+
+// release frees the tokens Allow reserved for a request
+func (s *UsageService) release(req llm.Request) {
+	userID, err := uuid.Parse(req.UserID)
+	if err != nil {
+		return
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if _, ok := s.reserved[userID]; !ok {
+		return // No quota, so nothing was reserved
+	}
+	s.reserved[userID] -= estimateRequestTokens(req)
+	if s.reserved[userID] <= 0 {
+		delete(s.reserved, userID)
+	}
+}
+
+// estimateRequestTokens guesses what a request will use: its text at about four characters
+// a token, plus its whole output limit. Documents aren't counted.
+func estimateRequestTokens(req llm.Request) int64 {
+	chars := len(req.System)
+	for _, message := range req.Messages {
+		for _, part := range message.Parts {
+			chars += len(part.Text)
+			if part.ToolCall != nil {
+				chars += len(part.ToolCall.Input)
+			}
+			if part.ToolResult != nil {
+				chars += len(part.ToolResult.Content)
+			}
+		}
+	}
+	for _, tool := range req.Tools {
+		chars += len(tool.Name) + len(tool.Description)
+	}
+	return int64(chars/4 + req.MaxTokens)
+}
+
+// GetQuota returns a user's monthly token quota: their own if set, else the default.
+// 0 means unlimited.
+func (s *UsageService) GetQuota(userID uuid.UUID) (int64, error) {
+	var quota models.TokenQuota
+	err := s.db.Where("user_id = ?", userID).First(&quota).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return s.defaultQuota, nil
+	}
+	if err != nil {
+		return 0, fmt.Errorf("database error: %w", err)
+	}
+	return quota.MonthlyTokens, nil
+}
+
+// SetQuota sets a user's monthly token quota, overriding the default. 0 means unlimited.
+func (s *UsageService) SetQuota(userID uuid.UUID, monthlyTokens int64) (*models.TokenQuota, error) {
+	if monthlyTokens < 0 {
+		return nil, errors.New("monthlyTokens can't be negative")
+	}
+
+	var user models.User
+	if err := s.db.Select("id").Where("id = ?", userID).First(&user).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, errors.New("user not found")
+		}
+		return nil, fmt.Errorf("database error: %w", err)
+	}
+
+	var quota models.TokenQuota
+	err := s.db.Where("user_id = ?", userID).First(&quota).Error
+	if err != nil && !errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, fmt.Errorf("database error: %w", err)
+	}
+	quota.UserID = userID
+	quota.MonthlyTokens = monthlyTokens
+	if err := s.db.Save(&quota).Error; err != nil {
+		return nil, fmt.Errorf("failed to save token quota: %w", err)
+	}
+
+	return &quota, nil
+}
+
+// GetUserUsage reports a user's usage for the month containing month
+func (s *UsageService) GetUserUsage(userID uuid.UUID, month time.Time) (*UsageReport, error) {
+	quota, err := s.GetQuota(userID)
+	if err != nil {
+		return nil, err
+	}
+
+	rows, err := s.usageRows(monthStart(month), "purpose, model", "user_id = ?", userID)
+	if err != nil {
+		return nil, err
+	}
+
+	report := summarizeUsage(monthStart(month), rows, false)
+	report.Quota = quota
+	return report, nil
+}
+
+// GetGlobalUsage reports every user's usage, and requests not made for a user, for the month
+// containing month
+func (s *UsageService) GetGlobalUsage(month time.Time) (*UsageReport, error) {
+	rows, err := s.usageRows(monthStart(month), "user_id, purpose, model", "")
+	if err != nil {
+		return nil, err
+	}
+
+	return summarizeUsage(monthStart(month), rows, true), nil
+}
+
+// usageRows groups a month of the ledger by the given columns, optionally filtered
+func (s *UsageService) usageRows(month time.Time, groupBy string, where string, args ...interface{}) ([]usageRow, error) {
+	query := s.db.Model(&models.LLMUsage{}).
+		Select(groupBy+", COUNT(*) AS requests, SUM(input_tokens) AS input_tokens, SUM(output_tokens) AS output_tokens").
+		Where("created_at >= ? AND created_at < ?", month, month.AddDate(0, 1, 0))
+	if where != "" {
+		query = query.Where(where, args...)
+	}
+
+	var rows []usageRow
+	if err := query.Group(groupBy).Scan(&rows).Error; err != nil {
+		return nil, fmt.Errorf("failed to load usage: %w", err)
+	}
+	return rows, nil
+}
+
+// monthTokens returns the tokens a user has used since the start of month
+func (s *UsageService) monthTokens(userID uuid.UUID, month time.Time) (int64, error) {
+	var used int64
+	if err := s.db.Model(&models.LLMUsage{}).
+		Select("COALESCE(SUM(input_tokens + output_tokens), 0)").
+		Where("user_id = ? AND created_at >= ?", userID, month).
+		Scan(&used).Error; err != nil {
+		return 0, fmt.Errorf("database error: %w", err)
+	}
+	return used, nil
+}
+
+// summarizeUsage totals grouped ledger rows into a report, estimating their cost. Users are
+// only broken down when byUser is set.
+func summarizeUsage(month time.Time, rows []usageRow, byUser bool) *UsageReport {
+	report := &UsageReport{Month: month}
+	purposes := map[string]*UsageTotals{}
+	modelTotals := map[string]*UsageTotals{}
+	users := map[string]*UsageTotals{}
+
+	add := func(totals map[string]*UsageTotals, key string, row UsageTotals) {
+		t, ok := totals[key]
+		if !ok {
+			t = &UsageTotals{}
+			totals[key] = t
+		}
+		t.add(row)
+	}
+
+	for _, row := range rows {
+		price := modelPrices[llm.Model(row.Model)]
+		totals := UsageTotals{
+			Requests:      row.Requests,
+			InputTokens:   row.InputTokens,
+			OutputTokens:  row.OutputTokens,
+			EstimatedCost: (float64(row.InputTokens)*price.Input + float64(row.OutputTokens)*price.Output) / 1e6,
+		}
+
+		report.Totals.add(totals)
+		add(purposes, row.Purpose, totals)
+		add(modelTotals, row.Model, totals)
+		if byUser {
+			user := ""
+			if row.UserID != nil {
+				user = row.UserID.String()
+			}
+			add(users, user, totals)
+		}
+	}
+
+	report.ByPurpose = usageBreakdowns(purposes, 0)
+	report.ByModel = usageBreakdowns(modelTotals, 0)
+	if byUser {
+		report.ByUser = usageBreakdowns(users, maxUsageReportUsers)
+	}
+	return report
+}
+
+// add adds other to t
+func (t *UsageTotals) add(other UsageTotals) {
+	t.Requests += other.Requests
+	t.InputTokens += other.InputTokens
+	t.OutputTokens += other.OutputTokens
+	t.EstimatedCost += other.EstimatedCost
+}
+
+// usageBreakdowns lists totals by key, most tokens first, keeping at most limit (0 for all)
+func usageBreakdowns(totals map[string]*UsageTotals, limit int) []UsageBreakdown {
+	breakdowns := make([]UsageBreakdown, 0, len(totals))
+	for key, t := range totals {
+		breakdowns = append(breakdowns, UsageBreakdown{Key: key, UsageTotals: *t})
+	}
+	sort.Slice(breakdowns, func(i, j int) bool {
+		if breakdowns[i].Tokens() != breakdowns[j].Tokens() {
+			return breakdowns[i].Tokens() > breakdowns[j].Tokens()
+		}
+		return breakdowns[i].Key < breakdowns[j].Key
+	})
+	if limit > 0 && len(breakdowns) > limit {
+		breakdowns = breakdowns[:limit]
+	}
+	return breakdowns
+}
+
+// monthStart returns the start of t's calendar month in UTC
+func monthStart(t time.Time) time.Time {
+	t = t.UTC()
+	return time.Date(t.Year(), t.Month(), 1, 0, 0, 0, 0, time.UTC)
+}
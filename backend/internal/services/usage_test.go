@@ -0,0 +1,83 @@
+package services
+
+import (
+	"math"
+	"strings"
+	"testing"
+	"time"
+
+	"carbuyer/internal/llm"
+
+	"github.com/google/uuid"
+)
+
+func TestSummarizeUsage(t *testing.T) {
+	alice, bob := uuid.New(), uuid.New()
+	month := time.Date(2025, 3, 1, 0, 0, 0, 0, time.UTC)
+	rows := []usageRow{
+		{UserID: &alice, Purpose: "negotiation", Model: string(llm.ModelStandard), Requests: 10, InputTokens: 200000, OutputTokens: 10000},
+		{UserID: &alice, Purpose: "thread_summary", Model: string(llm.ModelFast), Requests: 4, InputTokens: 40000, OutputTokens: 2000},
+		{UserID: &bob, Purpose: "negotiation", Model: string(llm.ModelStandard), Requests: 1, InputTokens: 5000, OutputTokens: 500},
+		{Purpose: "email_classification", Model: "retired-model", Requests: 2, InputTokens: 1000, OutputTokens: 100},
+	}
+
+	report := summarizeUsage(month, rows, true)
+
+	if report.Totals.Requests != 17 || report.Totals.Tokens() != 258600 {
+		t.Errorf("Totals = %+v", report.Totals)
+	}
+	// $0.60 + $0.15 for alice's negotiation, $0.04 + $0.01 for summaries, $0.015 + $0.0075 for
+	// bob's; the retired model has no price
+	if want := 0.8225; math.Abs(report.Totals.EstimatedCost-want) > 1e-9 {
+		t.Errorf("EstimatedCost = %v, want %v", report.Totals.EstimatedCost, want)
+	}
+
+	if len(report.ByPurpose) != 3 || report.ByPurpose[0].Key != "negotiation" || report.ByPurpose[0].Requests != 11 {
+		t.Errorf("ByPurpose = %+v", report.ByPurpose)
+	}
+	if len(report.ByModel) != 3 || report.ByModel[0].Key != string(llm.ModelStandard) {
+		t.Errorf("ByModel = %+v", report.ByModel)
+	}
+	if len(report.ByUser) != 3 || report.ByUser[0].Key != alice.String() || report.ByUser[0].Tokens() != 252000 || report.ByUser[2].Key != "" {
+		t.Errorf("ByUser = %+v", report.ByUser)
+	}
+
+	if report := summarizeUsage(month, rows, false); report.ByUser != nil {
+		t.Errorf("ByUser = %+v without byUser", report.ByUser)
+	}
+}
+
+func TestUsageBreakdownsLimit(t *testing.T) {
+	totals := map[string]*UsageTotals{
+		"a": {InputTokens: 1},
+		"b": {InputTokens: 3},
+		"c": {InputTokens: 2},
+	}
+
+	got := usageBreakdowns(totals, 2)
+	if len(got) != 2 || got[0].Key != "b" || got[1].Key != "c" {
+		t.Errorf("usageBreakdowns() = %+v", got)
+	}
+}
+
+func TestMonthStart(t *testing.T) {
+	pacific := time.FixedZone("PST", -8*3600)
+	got := monthStart(time.Date(2025, 2, 28, 20, 0, 0, 0, pacific))
+	if want := time.Date(2025, 3, 1, 0, 0, 0, 0, time.UTC); !got.Equal(want) {
+		t.Errorf("monthStart() = %v, want %v", got, want)
+	}
+}
+
+func TestEstimateRequestTokens(t *testing.T) {
+	req := llm.Request{
+		System:    strings.Repeat("s", 400),
+		MaxTokens: 1024,
+		Messages: []llm.Message{
+			llm.UserMessage(llm.Text(strings.Repeat("u", 200))),
+			llm.UserMessage(llm.Result("call_1", strings.Repeat("r", 200), false)),
+		},
+	}
+	if got := estimateRequestTokens(req); got != 1024+200 {
+		t.Errorf("estimateRequestTokens() = %d, want %d", got, 1024+200)
+	}
+}
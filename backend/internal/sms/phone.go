@@ -0,0 +1,67 @@
+package sms
+
+import (
+	"strings"
+	"unicode"
+)
+
+// Carrier keywords that must be honoured on every number (CTIA guidelines)
+var (
+	optOutKeywords = map[string]bool{"STOP": true, "STOPALL": true, "UNSUBSCRIBE": true, "CANCEL": true, "END": true, "QUIT": true, "OPTOUT": true, "REVOKE": true}
+	optInKeywords  = map[string]bool{"START": true, "UNSTOP": true, "YES": true}
+	helpKeywords   = map[string]bool{"HELP": true, "INFO": true}
+)
+
+// NormalizePhone converts a phone number to E.164. Numbers without a country code are
+// assumed to be North American. Returns an empty string when the input isn't a phone number.
+func NormalizePhone(phone string) string {
+	phone = strings.TrimSpace(phone)
+	international := strings.HasPrefix(phone, "+")
+
+	// Drop extensions such as "x204" or "ext. 12"
+	if i := strings.IndexFunc(phone, func(r rune) bool { return unicode.IsLetter(r) }); i != -1 {
+		phone = phone[:i]
+	}
+
+	var digits strings.Builder
+	for _, r := range phone {
+		if r >= '0' && r <= '9' {
+			digits.WriteRune(r)
+		}
+	}
+	number := digits.String()
+
+	switch {
+	case international && len(number) >= 8 && len(number) <= 15:
+		return "+" + number
+	case len(number) == 10:
+		return "+1" + number
+	case len(number) == 11 && number[0] == '1':
+		return "+" + number
+	}
+	return ""
+}
+
+// Keyword returns the normalized carrier keyword a message consists of, if any
+func Keyword(body string) string {
+	keyword := strings.ToUpper(strings.Trim(strings.TrimSpace(body), ".!"))
+	if optOutKeywords[keyword] || optInKeywords[keyword] || helpKeywords[keyword] {
+		return keyword
+	}
+	return ""
+}
+
+// IsOptOut reports whether a message asks to stop receiving texts
+func IsOptOut(body string) bool {
+	return optOutKeywords[Keyword(body)]
+}
+
+// IsOptIn reports whether a message asks to resume receiving texts after opting out
+func IsOptIn(body string) bool {
+	return optInKeywords[Keyword(body)]
+}
+
+// IsHelp reports whether a message asks for help
+func IsHelp(body string) bool {
+	return helpKeywords[Keyword(body)]
+}
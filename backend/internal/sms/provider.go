@@ -0,0 +1,38 @@
+// Package sms sends and receives text messages through an SMS provider so dealers can be
+// negotiated with by text as well as by email.
+package sms
+
+import (
+	"context"
+	"errors"
+	"net/http"
+)
+
+// ErrUnauthorized is returned when an inbound webhook fails signature verification
+var ErrUnauthorized = errors.New("webhook verification failed")
+
+// InboundSMS is a text message received on one of our numbers
+type InboundSMS struct {
+	From      string // E.164 sender number
+	To        string // E.164 number of ours the message was sent to
+	Body      string
+	MessageID string // Provider message ID
+}
+
+// Provider provisions numbers and sends and receives text messages.
+// Implementations must be safe for concurrent use.
+type Provider interface {
+	// Name is the provider name used in the webhook URL
+	Name() string
+	// ProvisionNumber buys a number, in the area code when one is given, and points its
+	// inbound webhook at us. It returns the number in E.164 format.
+	ProvisionNumber(ctx context.Context, areaCode string) (string, error)
+	// ReleaseNumber gives a provisioned number back to the provider
+	ReleaseNumber(ctx context.Context, number string) error
+	// Send sends a text message and returns the provider's message ID
+	Send(ctx context.Context, from, to, body string) (string, error)
+	// Verify checks an inbound webhook came from the provider. It returns ErrUnauthorized when it didn't.
+	Verify(r *http.Request) error
+	// Parse reads an inbound webhook into an InboundSMS
+	Parse(r *http.Request) (*InboundSMS, error)
+}
@@ -0,0 +1,196 @@
+package sms
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/sha1"
+	"encoding/base64"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+)
+
+func TestNormalizePhone(t *testing.T) {
+	tests := []struct {
+		phone string
+		want  string
+	}{
+		{"(206) 555-0142", "+12065550142"},
+		{"206.555.0142", "+12065550142"},
+		{"1-206-555-0142", "+12065550142"},
+		{"+1 206 555 0142", "+12065550142"},
+		{"(206) 555-0142 ext. 12", "+12065550142"},
+		{"206-555-0142x204", "+12065550142"},
+		{"+44 20 7946 0958", "+442079460958"},
+		{"555-0142", ""},
+		{"", ""},
+		{"call us", ""},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.phone, func(t *testing.T) {
+			if got := NormalizePhone(tt.phone); got != tt.want {
+				t.Errorf("NormalizePhone(%q) = %q, want %q", tt.phone, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestKeywords(t *testing.T) {
+	tests := []struct {
+		body    string
+		optOut  bool
+		optIn   bool
+		help    bool
+		keyword string
+	}{
+		{body: "STOP", optOut: true, keyword: "STOP"},
+		{body: " stop. ", optOut: true, keyword: "STOP"},
+		{body: "Unsubscribe", optOut: true, keyword: "UNSUBSCRIBE"},
+		{body: "start", optIn: true, keyword: "START"},
+		{body: "HELP", help: true, keyword: "HELP"},
+		{body: "Please stop texting me", keyword: ""},
+		{body: "Yes we have it in stock", keyword: ""},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.body, func(t *testing.T) {
+			if got := Keyword(tt.body); got != tt.keyword {
+				t.Errorf("Keyword() = %q, want %q", got, tt.keyword)
+			}
+			if got := IsOptOut(tt.body); got != tt.optOut {
+				t.Errorf("IsOptOut() = %v, want %v", got, tt.optOut)
+			}
+			if got := IsOptIn(tt.body); got != tt.optIn {
+				t.Errorf("IsOptIn() = %v, want %v", got, tt.optIn)
+			}
+			if got := IsHelp(tt.body); got != tt.help {
+				t.Errorf("IsHelp() = %v, want %v", got, tt.help)
+			}
+		})
+	}
+}
+
+func TestTwilioInboundWebhook(t *testing.T) {
+	webhookURL := "https://api.otto.dev/api/v1/webhooks/sms/twilio"
+	authToken := "token-123"
+	form := url.Values{
+		"MessageSid": {"SM123"},
+		"From":       {"+12065550142"},
+		"To":         {"+12065550100"},
+		"Body":       {"Best I can do is $38,900"},
+	}
+
+	sign := func(form url.Values) string {
+		mac := hmac.New(sha1.New, []byte(authToken))
+		mac.Write([]byte(webhookURL + "BodyBest I can do is $38,900" + "From+12065550142" + "MessageSidSM123" + "To+12065550100"))
+		return base64.StdEncoding.EncodeToString(mac.Sum(nil))
+	}
+	newRequest := func(form url.Values, signature string) *http.Request {
+		req := httptest.NewRequest(http.MethodPost, "/api/v1/webhooks/sms/twilio", strings.NewReader(form.Encode()))
+		req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+		req.Header.Set("X-Twilio-Signature", signature)
+		return req
+	}
+
+	provider := NewTwilioProvider("AC123", authToken, webhookURL)
+	req := newRequest(form, sign(form))
+	if err := provider.Verify(req); err != nil {
+		t.Fatalf("Verify() error = %v", err)
+	}
+	message, err := provider.Parse(req)
+	if err != nil {
+		t.Fatalf("Parse() error = %v", err)
+	}
+	if message.From != "+12065550142" || message.To != "+12065550100" || message.MessageID != "SM123" || message.Body != "Best I can do is $38,900" {
+		t.Errorf("Parse() = %+v", message)
+	}
+
+	if err := provider.Verify(newRequest(form, "forged")); !errors.Is(err, ErrUnauthorized) {
+		t.Errorf("Verify() with forged signature error = %v, want ErrUnauthorized", err)
+	}
+
+	tampered := url.Values{}
+	for key, values := range form {
+		tampered[key] = values
+	}
+	tampered.Set("Body", "Best I can do is $1")
+	if err := provider.Verify(newRequest(tampered, sign(form))); !errors.Is(err, ErrUnauthorized) {
+		t.Errorf("Verify() with tampered body error = %v, want ErrUnauthorized", err)
+	}
+}
+
+func TestTwilioSend(t *testing.T) {
+	var got url.Values
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/Accounts/AC123/Messages.json" {
+			t.Errorf("path = %s", r.URL.Path)
+		}
+		if user, pass, _ := r.BasicAuth(); user != "AC123" || pass != "token-123" {
+			t.Errorf("basic auth = %s:%s", user, pass)
+		}
+		r.ParseForm()
+		got = r.PostForm
+		w.WriteHeader(http.StatusCreated)
+		w.Write([]byte(`{"sid": "SM456"}`))
+	}))
+	defer server.Close()
+
+	provider := NewTwilioProvider("AC123", "token-123", "https://api.otto.dev/api/v1/webhooks/sms/twilio")
+	provider.baseURL = server.URL
+
+	sid, err := provider.Send(context.Background(), "+12065550100", "+12065550142", "Can you do $38,500?")
+	if err != nil {
+		t.Fatalf("Send() error = %v", err)
+	}
+	if sid != "SM456" {
+		t.Errorf("Send() = %q, want SM456", sid)
+	}
+	if got.Get("From") != "+12065550100" || got.Get("To") != "+12065550142" || got.Get("Body") != "Can you do $38,500?" {
+		t.Errorf("posted form = %v", got)
+	}
+}
+
+func TestFakeProvider(t *testing.T) {
+	provider := NewFakeProvider("secret-123")
+
+	number, err := provider.ProvisionNumber(context.Background(), "425")
+	if err != nil {
+		t.Fatalf("ProvisionNumber() error = %v", err)
+	}
+	if NormalizePhone(number) != number || !strings.HasPrefix(number, "+1425555") {
+		t.Errorf("ProvisionNumber() = %q, want a +1425555 E.164 number", number)
+	}
+
+	if _, err := provider.Send(context.Background(), number, "+12065550142", "Hi"); err != nil {
+		t.Fatalf("Send() error = %v", err)
+	}
+	if sent := provider.Sent(); len(sent) != 1 || sent[0].To != "+12065550142" {
+		t.Errorf("Sent() = %+v", sent)
+	}
+
+	req := httptest.NewRequest(http.MethodPost, "/api/v1/webhooks/sms/fake", strings.NewReader("From=%28206%29+555-0142&To=%2B14255550101&Body=STOP"))
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	if err := provider.Verify(req); err != ErrUnauthorized {
+		t.Errorf("Verify() without a token = %v, want ErrUnauthorized", err)
+	}
+	if err := NewFakeProvider("").Verify(httptest.NewRequest(http.MethodPost, "/api/v1/webhooks/sms/fake?token=", nil)); err != ErrUnauthorized {
+		t.Errorf("Verify() without a webhook secret = %v, want ErrUnauthorized", err)
+	}
+
+	req = httptest.NewRequest(http.MethodPost, "/api/v1/webhooks/sms/fake?token=secret-123", strings.NewReader("From=%28206%29+555-0142&To=%2B14255550101&Body=STOP"))
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	if err := provider.Verify(req); err != nil {
+		t.Errorf("Verify() = %v", err)
+	}
+	message, err := provider.Parse(req)
+	if err != nil {
+		t.Fatalf("Parse() error = %v", err)
+	}
+	if message.From != "+12065550142" || !IsOptOut(message.Body) {
+		t.Errorf("Parse() = %+v", message)
+	}
+}
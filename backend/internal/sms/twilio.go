@@ -0,0 +1,203 @@
+package sms
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/sha1"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"sort"
+	"strings"
+	"time"
+)
+
+const twilioAPIBase = "https://api.twilio.com/2010-04-01"
+
+// TwilioProvider sends and receives texts through Twilio's Programmable Messaging API
+type TwilioProvider struct {
+	accountSID string
+	authToken  string
+	webhookURL string // Public URL of our inbound SMS webhook, used for signatures and number setup
+	baseURL    string
+	client     *http.Client
+}
+
+// NewTwilioProvider creates a Twilio provider. webhookURL must be the exact public URL Twilio
+// posts inbound messages to, since Twilio signs requests with it.
+func NewTwilioProvider(accountSID, authToken, webhookURL string) *TwilioProvider {
+	return &TwilioProvider{
+		accountSID: accountSID,
+		authToken:  authToken,
+		webhookURL: webhookURL,
+		baseURL:    twilioAPIBase,
+		client:     &http.Client{Timeout: 30 * time.Second},
+	}
+}
+
+func (p *TwilioProvider) Name() string {
+	return "twilio"
+}
+
+func (p *TwilioProvider) ProvisionNumber(ctx context.Context, areaCode string) (string, error) {
+	// Find an available local number
+	query := url.Values{"SmsEnabled": {"true"}}
+	if areaCode != "" {
+		query.Set("AreaCode", areaCode)
+	}
+	var available struct {
+		AvailablePhoneNumbers []struct {
+			PhoneNumber string `json:"phone_number"`
+		} `json:"available_phone_numbers"`
+	}
+	if err := p.do(ctx, http.MethodGet, "/AvailablePhoneNumbers/US/Local.json?"+query.Encode(), nil, &available); err != nil {
+		return "", fmt.Errorf("failed to search numbers: %w", err)
+	}
+	if len(available.AvailablePhoneNumbers) == 0 {
+		return "", errors.New("no phone numbers available in that area code")
+	}
+
+	// Buy it and point inbound messages at our webhook
+	form := url.Values{
+		"PhoneNumber": {available.AvailablePhoneNumbers[0].PhoneNumber},
+		"SmsUrl":      {p.webhookURL},
+		"SmsMethod":   {http.MethodPost},
+	}
+	var purchased struct {
+		PhoneNumber string `json:"phone_number"`
+	}
+	if err := p.do(ctx, http.MethodPost, "/IncomingPhoneNumbers.json", form, &purchased); err != nil {
+		return "", fmt.Errorf("failed to buy number: %w", err)
+	}
+
+	return purchased.PhoneNumber, nil
+}
+
+func (p *TwilioProvider) ReleaseNumber(ctx context.Context, number string) error {
+	var found struct {
+		IncomingPhoneNumbers []struct {
+			SID string `json:"sid"`
+		} `json:"incoming_phone_numbers"`
+	}
+	if err := p.do(ctx, http.MethodGet, "/IncomingPhoneNumbers.json?"+url.Values{"PhoneNumber": {number}}.Encode(), nil, &found); err != nil {
+		return fmt.Errorf("failed to look up number: %w", err)
+	}
+	if len(found.IncomingPhoneNumbers) == 0 {
+		return nil // Already released
+	}
+
+	if err := p.do(ctx, http.MethodDelete, "/IncomingPhoneNumbers/"+found.IncomingPhoneNumbers[0].SID+".json", nil, nil); err != nil {
+		return fmt.Errorf("failed to release number: %w", err)
+	}
+	return nil
+}
+
+func (p *TwilioProvider) Send(ctx context.Context, from, to, body string) (string, error) {
+	form := url.Values{
+		"From": {from},
+		"To":   {to},
+		"Body": {body},
+	}
+	var sent struct {
+		SID string `json:"sid"`
+	}
+	if err := p.do(ctx, http.MethodPost, "/Messages.json", form, &sent); err != nil {
+		return "", fmt.Errorf("failed to send SMS: %w", err)
+	}
+	return sent.SID, nil
+}
+
+// Verify checks the X-Twilio-Signature header: an HMAC-SHA1 of the webhook URL followed by
+// the sorted form fields, keyed with the auth token
+func (p *TwilioProvider) Verify(r *http.Request) error {
+	if err := r.ParseForm(); err != nil {
+		return ErrUnauthorized
+	}
+
+	keys := make([]string, 0, len(r.PostForm))
+	for key := range r.PostForm {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	var signed strings.Builder
+	signed.WriteString(p.webhookURL)
+	for _, key := range keys {
+		for _, value := range r.PostForm[key] {
+			signed.WriteString(key)
+			signed.WriteString(value)
+		}
+	}
+
+	mac := hmac.New(sha1.New, []byte(p.authToken))
+	mac.Write([]byte(signed.String()))
+	expected := base64.StdEncoding.EncodeToString(mac.Sum(nil))
+
+	if !hmac.Equal([]byte(r.Header.Get("X-Twilio-Signature")), []byte(expected)) {
+		return ErrUnauthorized
+	}
+	return nil
+}
+
+func (p *TwilioProvider) Parse(r *http.Request) (*InboundSMS, error) {
+	return parseTwilioForm(r)
+}
+
+// parseTwilioForm reads Twilio's inbound message form fields
+func parseTwilioForm(r *http.Request) (*InboundSMS, error) {
+	if err := r.ParseForm(); err != nil {
+		return nil, fmt.Errorf("invalid form data: %w", err)
+	}
+
+	message := &InboundSMS{
+		From:      NormalizePhone(r.PostFormValue("From")),
+		To:        NormalizePhone(r.PostFormValue("To")),
+		Body:      r.PostFormValue("Body"),
+		MessageID: r.PostFormValue("MessageSid"),
+	}
+	if message.From == "" || message.To == "" {
+		return nil, errors.New("missing From or To number")
+	}
+	return message, nil
+}
+
+// do calls the Twilio REST API with basic auth, decoding the JSON response into out
+func (p *TwilioProvider) do(ctx context.Context, method, path string, form url.Values, out interface{}) error {
+	var body io.Reader
+	if form != nil {
+		body = strings.NewReader(form.Encode())
+	}
+
+	req, err := http.NewRequestWithContext(ctx, method, p.baseURL+"/Accounts/"+p.accountSID+path, body)
+	if err != nil {
+		return err
+	}
+	req.SetBasicAuth(p.accountSID, p.authToken)
+	if form != nil {
+		req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	}
+
+	resp, err := p.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode >= 300 {
+		var apiErr struct {
+			Code    int    `json:"code"`
+			Message string `json:"message"`
+		}
+		json.NewDecoder(resp.Body).Decode(&apiErr)
+		return fmt.Errorf("twilio API error (status %d, code %d): %s", resp.StatusCode, apiErr.Code, apiErr.Message)
+	}
+
+	if out == nil {
+		return nil
+	}
+	return json.NewDecoder(resp.Body).Decode(out)
+}
@@ -0,0 +1,53 @@
+package storage
+
+import (
+	"context"
+	"errors"
+	"io"
+	"strings"
+	"testing"
+)
+
+func TestLocalBlobStoreRoundTrip(t *testing.T) {
+	store, err := NewLocalBlobStore(t.TempDir())
+	if err != nil {
+		t.Fatalf("NewLocalBlobStore() error = %v", err)
+	}
+	ctx := context.Background()
+
+	if err := store.Put(ctx, "attachments/u/m/a", strings.NewReader("quote"), "application/pdf"); err != nil {
+		t.Fatalf("Put() error = %v", err)
+	}
+
+	reader, err := store.Get(ctx, "attachments/u/m/a")
+	if err != nil {
+		t.Fatalf("Get() error = %v", err)
+	}
+	data, _ := io.ReadAll(reader)
+	reader.Close()
+	if string(data) != "quote" {
+		t.Errorf("Get() = %q, want %q", data, "quote")
+	}
+
+	if err := store.Delete(ctx, "attachments/u/m/a"); err != nil {
+		t.Fatalf("Delete() error = %v", err)
+	}
+	if _, err := store.Get(ctx, "attachments/u/m/a"); !errors.Is(err, ErrBlobNotFound) {
+		t.Errorf("Get() after Delete error = %v, want ErrBlobNotFound", err)
+	}
+}
+
+func TestLocalBlobStoreRejectsUnsafeKeys(t *testing.T) {
+	store, err := NewLocalBlobStore(t.TempDir())
+	if err != nil {
+		t.Fatalf("NewLocalBlobStore() error = %v", err)
+	}
+
+	for _, key := range []string{"", "../escape", "a/../../escape", "/etc/passwd"} {
+		t.Run(key, func(t *testing.T) {
+			if err := store.Put(context.Background(), key, strings.NewReader("x"), "text/plain"); err == nil {
+				t.Errorf("Put(%q) succeeded, want error", key)
+			}
+		})
+	}
+}
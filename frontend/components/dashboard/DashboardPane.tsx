@@ -369,7 +369,11 @@ export default function DashboardPane({ offers, threads, dealers = [], onNavigat
                           <tr key={dealer.id} className="border-b border-border last:border-b-0">
                             <td className="px-4 py-3 text-sm text-card-foreground font-medium">{dealer.name}</td>
                             <td className="px-4 py-3 text-sm text-card-foreground">
-                              {dealer.email ? (
+                              {dealer.email && dealer.emailStatus ? (
+                                <span className="text-muted-foreground line-through" title={dealer.emailStatusReason || 'This address bounced'}>
+                                  {dealer.email}
+                                </span>
+                              ) : dealer.email ? (
                                 <a href={`mailto:${dealer.email}`} className="text-primary hover:underline">
                                   {dealer.email}
                                 </a>
@@ -26,6 +26,7 @@ export interface User {
   email: string;
   createdAt: string;
   inboxEmail?: string;
+  inboxAlias?: string;
   zipCode?: string;
   preferences?: UserPreferences;
   gmailConnected?: boolean;
@@ -48,6 +49,18 @@ export interface Thread {
   createdAt: string;
   lastMessageAt?: string;
   messageCount: number;
+  replyToEmail?: string;
+  strategyProfileId?: string; // Unset uses the agent's default approach
+}
+
+// Running summary of a thread's key facts: prices, concessions, vehicle details and deadlines
+export interface ThreadSummary {
+  threadId: string;
+  content: string;
+  summarizedThrough?: string;
+  messageCount: number;
+  editedAt?: string;
+  updatedAt?: string;
 }
 
 export interface Message {
@@ -55,10 +68,43 @@ export interface Message {
   threadId: string;
   sender: 'user' | 'agent' | 'seller';
   content: string;
+  rawContent?: string;
   timestamp: string;
   externalMessageId?: string;
   senderEmail?: string;
   subject?: string;
+  recipientEmail?: string;
+  deliveryStatus?: 'sent' | 'deferred' | 'delivered' | 'bounced' | 'complained';
+  deliveryError?: string;
+  channel?: 'sms';
+  senderPhone?: string;
+  recipientPhone?: string;
+  promptTemplateId?: string; // Agent messages: the prompt template version that produced it
+  promptVersion?: number;
+  variants?: DraftVariant[]; // Agent messages: ranked alternative drafts, best first
+}
+
+// A problem found in a draft before it's sent. Sends fail with 422 and the warnings while any
+// warning blocks, or until the warnings are acknowledged.
+export interface DraftWarning {
+  kind: 'competitor' | 'walk_away_price' | 'budget' | 'never_disclose' | 'personal_data' | 'contradiction';
+  severity: 'block' | 'warn';
+  message: string;
+  excerpt?: string; // The words in the draft the warning is about
+}
+
+export interface DraftCheckResult {
+  warnings: DraftWarning[];
+  blocked: boolean;
+}
+
+export interface DraftVariant {
+  id: string;
+  rank: number;
+  style: string;
+  rationale?: string;
+  content: string;
+  chosen: boolean; // The variant shown in the message's content
 }
 
 export interface InboxMessage {
@@ -67,16 +113,90 @@ export interface InboxMessage {
   senderEmail: string;
   subject: string;
   content: string;
+  rawContent?: string;
   timestamp: string;
   externalMessageId?: string;
+  suggestedThreadId?: string;
+  matchConfidence?: number;
+  matchSignal?: string;
+  category?: MessageCategory;
+  categorySource?: 'headers' | 'llm' | 'user' | 'sender';
+  categoryReason?: string;
+  channel?: 'sms';
+  senderPhone?: string;
+}
+
+export type MessageCategory = 'human' | 'auto_reply' | 'marketing' | 'spam';
+
+export interface SMSNumber {
+  number: string;
+  provider: string;
+  createdAt: string;
+}
+
+export interface EmailImportResult {
+  imported: number;
+  duplicates: number;
+  skipped: number;
+  threadIds: string[];
+  createdThreads: number;
+  errors?: string[];
+}
+
+export type OfferReviewStatus = 'confirmed' | 'pending' | 'rejected';
+
+export type OfferStatus = 'active' | 'expired' | 'countered' | 'accepted' | 'declined';
+
+export type FinanceType = 'cash' | 'finance' | 'lease';
+
+export interface OfferTerms {
+  vehiclePrice?: number;
+  dealerAddOns?: number;
+  docFee?: number;
+  taxes?: number;
+  registration?: number;
+  rebates?: number;
+  outTheDoor?: number;
+  financeType?: FinanceType;
+  apr?: number;
+  termMonths?: number;
+  monthlyPayment?: number;
+  dueAtSigning?: number;
+  annualMileage?: number;
+  vin?: string;
+  stockNumber?: string;
+  expiresAt?: string;
 }
 
-export interface TrackedOffer {
+export interface DetectedOfferDetails {
+  vehicle?: string;
+  vehiclePrice?: number;
+  dealerAddOns?: number;
+  docFee?: number;
+  taxes?: number;
+  registration?: number;
+  rebates?: number;
+  outTheDoor?: number;
+  financeType?: FinanceType;
+  apr?: number;
+  termMonths?: number;
+  monthlyPayment?: number;
+  dueAtSigning?: number;
+  expiresAt?: string;
+  quote?: string;
+}
+
+export interface TrackedOffer extends OfferTerms {
   id: string;
   threadId: string;
   messageId?: string;
   offerText: string;
   trackedAt: string;
+  reviewStatus: OfferReviewStatus;
+  source: 'manual' | 'message' | 'document';
+  details?: DetectedOfferDetails;
+  status: OfferStatus;
+  outTheDoorComputed?: boolean; // Calculated from a document's price components
   sellerName?: string;
   threadType?: string;
 }
@@ -95,6 +215,7 @@ export interface CreateThreadRequest {
 export interface CreateMessageRequest {
   content: string;
   sender: 'user' | 'seller';
+  variants?: number; // User messages: ask for up to 4 ranked drafts instead of one
 }
 
 export interface CreateUserMessageResponse {
@@ -119,6 +240,7 @@ export interface DashboardResponse {
   threads: Thread[];
   inboxMessages: InboxMessage[];
   offers: TrackedOffer[];
+  filteredInboxCount?: number;
 }
 
 export interface VehicleModelsResponse {
@@ -139,6 +261,8 @@ export interface Dealer {
   website?: string;
   distance: number;
   contacted: boolean;
+  emailStatus?: 'invalid' | 'complained';
+  emailStatusReason?: string;
 }
 
 // Auth API
@@ -213,6 +337,31 @@ export const threadAPI = {
   archive: async (threadId: string): Promise<void> => {
     await api.delete(`/threads/${threadId}`);
   },
+
+  getSummary: async (threadId: string): Promise<ThreadSummary> => {
+    const response = await api.get<ThreadSummary>(`/threads/${threadId}/summary`);
+    return response.data;
+  },
+
+  // An empty summary is rebuilt from the whole thread
+  updateSummary: async (threadId: string, content: string): Promise<ThreadSummary> => {
+    const response = await api.put<ThreadSummary>(`/threads/${threadId}/summary`, { content });
+    return response.data;
+  },
+
+  refreshSummary: async (threadId: string): Promise<ThreadSummary> => {
+    const response = await api.post<ThreadSummary>(`/threads/${threadId}/summary/refresh`);
+    return response.data;
+  },
+
+  // A null profile goes back to the default approach
+  setStrategy: async (threadId: string, profileId: string | null): Promise<StrategyProfile | null> => {
+    const response = await api.put<{ threadId: string; strategy: StrategyProfile | null }>(
+      `/threads/${threadId}/strategy`,
+      { profileId }
+    );
+    return response.data.strategy;
+  },
 };
 
 // Message API
@@ -235,13 +384,104 @@ export const messageAPI = {
     return response.data;
   },
 
-  getInboxMessages: async (limit = 50, offset = 0): Promise<{ messages: InboxMessage[]; total: number; hasMore: boolean }> => {
-    const response = await api.get<{ messages: InboxMessage[]; total: number; hasMore: boolean }>('/inbox/messages', {
-      params: { limit, offset },
+  // Streams the agent's response over Server-Sent Events. Abort the signal to stop generation;
+  // the agent message's content replaces the streamed text once it arrives.
+  createMessageStream: async (
+    threadId: string,
+    content: string,
+    handlers: {
+      onUserMessage?: (message: Message) => void;
+      onDelta: (text: string) => void;
+      onAgentMessage: (message: Message) => void;
+      onError?: (error: string) => void;
+    },
+    signal?: AbortSignal
+  ): Promise<void> => {
+    const token = typeof window !== 'undefined' ? localStorage.getItem('token') : null;
+    const response = await fetch(`${API_URL}/threads/${threadId}/messages/stream`, {
+      method: 'POST',
+      headers: {
+        'Content-Type': 'application/json',
+        ...(token ? { Authorization: `Bearer ${token}` } : {}),
+      },
+      body: JSON.stringify({ content }),
+      signal,
+    });
+
+    if (!response.ok || !response.body) {
+      const body = (await response.json().catch(() => ({}))) as Partial<ErrorResponse>;
+      throw new Error(body.error || `Request failed with status ${response.status}`);
+    }
+
+    const reader = response.body.getReader();
+    const decoder = new TextDecoder();
+    let buffer = '';
+    for (;;) {
+      const { done, value } = await reader.read();
+      if (done) break;
+      buffer += decoder.decode(value, { stream: true });
+
+      let boundary;
+      while ((boundary = buffer.indexOf('\n\n')) !== -1) {
+        const chunk = buffer.slice(0, boundary);
+        buffer = buffer.slice(boundary + 2);
+
+        let event = 'message';
+        let data = '';
+        for (const line of chunk.split('\n')) {
+          if (line.startsWith('event: ')) event = line.slice(7);
+          else if (line.startsWith('data: ')) data += line.slice(6);
+        }
+        if (!data) continue;
+
+        const payload = JSON.parse(data);
+        switch (event) {
+          case 'user_message':
+            handlers.onUserMessage?.(payload as Message);
+            break;
+          case 'delta':
+            handlers.onDelta(payload.text);
+            break;
+          case 'agent_message':
+            handlers.onAgentMessage(payload as Message);
+            break;
+          case 'error':
+            handlers.onError?.(payload.error);
+            break;
+        }
+      }
+    }
+  },
+
+  // Replaces the agent's reply to the user's last message, as ranked drafts when variants > 1
+  regenerateReply: async (threadId: string, variants?: number): Promise<{ agentMessage: Message }> => {
+    const response = await api.post<{ agentMessage: Message }>(`/threads/${threadId}/messages/regenerate`, { variants });
+    return response.data;
+  },
+
+  chooseDraftVariant: async (messageId: string, variantId: string): Promise<Message> => {
+    const response = await api.post<Message>(`/messages/${messageId}/variants/${variantId}/choose`);
+    return response.data;
+  },
+
+  editDraft: async (messageId: string, content: string): Promise<Message> => {
+    const response = await api.put<Message>(`/messages/${messageId}`, { content });
+    return response.data;
+  },
+
+  // category: omit for human replies only, or 'filtered', 'all' or a single category
+  getInboxMessages: async (limit = 50, offset = 0, category?: MessageCategory | 'filtered' | 'all'): Promise<{ messages: InboxMessage[]; total: number; hasMore: boolean; filteredCount?: number }> => {
+    const response = await api.get<{ messages: InboxMessage[]; total: number; hasMore: boolean; filteredCount?: number }>('/inbox/messages', {
+      params: { limit, offset, category },
     });
     return response.data;
   },
 
+  setMessageCategory: async (messageId: string, category: MessageCategory): Promise<InboxMessage> => {
+    const response = await api.put<InboxMessage>(`/messages/${messageId}/category`, { category });
+    return response.data;
+  },
+
   assignInboxMessageToThread: async (messageId: string, threadId: string): Promise<void> => {
     await api.put(`/inbox/messages/${messageId}/assign`, { threadId });
   },
@@ -249,23 +489,89 @@ export const messageAPI = {
   archiveInboxMessage: async (messageId: string): Promise<void> => {
     await api.delete(`/inbox/messages/${messageId}`);
   },
+
+  // Texts an agent draft to the thread's dealer; content replaces the draft text when given
+  sendDraftViaSMS: async (messageId: string, content?: string, acknowledgeWarnings = false): Promise<Message> => {
+    const response = await api.post<Message>(`/messages/${messageId}/send-sms`, { content, acknowledgeWarnings });
+    return response.data;
+  },
+
+  // Checks a reply before it's sent; messageId is the seller message or the agent draft
+  checkDraft: async (messageId: string, content?: string): Promise<DraftCheckResult> => {
+    const response = await api.post<DraftCheckResult>(`/messages/${messageId}/check`, { content });
+    return response.data;
+  },
+};
+
+// Email import API
+export const importAPI = {
+  // Imports .eml files or mbox archives; with threadId every email goes to that thread
+  importEmails: async (files: File[], threadId?: string): Promise<EmailImportResult> => {
+    const formData = new FormData();
+    files.forEach((file) => formData.append('files', file));
+    const url = threadId ? `/threads/${threadId}/import` : '/import/emails';
+    const response = await api.post<EmailImportResult>(url, formData, {
+      headers: { 'Content-Type': 'multipart/form-data' },
+    });
+    return response.data;
+  },
+};
+
+// SMS API
+export const smsAPI = {
+  getNumber: async (): Promise<SMSNumber> => {
+    const response = await api.get<SMSNumber>('/sms/number');
+    return response.data;
+  },
+
+  provisionNumber: async (areaCode?: string): Promise<SMSNumber> => {
+    const response = await api.post<SMSNumber>('/sms/number', { areaCode });
+    return response.data;
+  },
+
+  releaseNumber: async (): Promise<void> => {
+    await api.delete('/sms/number');
+  },
 };
 
 // Offer API
 export const offerAPI = {
-  createOffer: async (threadId: string, offerText: string, messageId?: string): Promise<TrackedOffer> => {
+  createOffer: async (
+    threadId: string,
+    offerText: string,
+    messageId?: string,
+    terms?: OfferTerms & { status?: OfferStatus }
+  ): Promise<TrackedOffer> => {
     const response = await api.post<TrackedOffer>(`/threads/${threadId}/offers`, {
+      ...terms,
       offerText,
       messageId: messageId || null,
     });
     return response.data;
   },
 
-  getAllOffers: async (): Promise<TrackedOffer[]> => {
-    const response = await api.get<{ offers: TrackedOffer[] }>('/offers');
+  getAllOffers: async (review?: OfferReviewStatus, status?: OfferStatus): Promise<TrackedOffer[]> => {
+    const response = await api.get<{ offers: TrackedOffer[] }>('/offers', {
+      params: { review, status },
+    });
     return response.data.offers;
   },
 
+  updateOfferStatus: async (offerId: string, status: OfferStatus): Promise<TrackedOffer> => {
+    const response = await api.put<TrackedOffer>(`/offers/${offerId}/status`, { status });
+    return response.data;
+  },
+
+  confirmOffer: async (offerId: string): Promise<TrackedOffer> => {
+    const response = await api.post<TrackedOffer>(`/offers/${offerId}/confirm`);
+    return response.data;
+  },
+
+  rejectOffer: async (offerId: string): Promise<TrackedOffer> => {
+    const response = await api.post<TrackedOffer>(`/offers/${offerId}/reject`);
+    return response.data;
+  },
+
   deleteOffer: async (offerId: string): Promise<void> => {
     await api.delete(`/offers/${offerId}`);
   },
@@ -287,8 +593,8 @@ export const gmailAPI = {
     await api.post('/gmail/disconnect');
   },
 
-  replyViaGmail: async (messageId: string, content: string): Promise<void> => {
-    await api.post(`/messages/${messageId}/reply-via-gmail`, { content });
+  replyViaGmail: async (messageId: string, content: string, acknowledgeWarnings = false): Promise<void> => {
+    await api.post(`/messages/${messageId}/reply-via-gmail`, { content, acknowledgeWarnings });
   },
 
   createDraft: async (messageId: string, content: string): Promise<void> => {
@@ -335,3 +641,175 @@ export const dealersAPI = {
     });
   },
 };
+
+export interface AutopilotSettings {
+  threadId: string;
+  enabled: boolean;
+  autoSend: boolean;
+  targetPrice?: number;
+  walkAwayPrice?: number;
+  neverDisclose: string[];
+  maxRepliesPerDay: number;
+}
+
+export interface AutopilotDecision {
+  id: string;
+  threadId: string;
+  messageId?: string;
+  action: 'reply' | 'wait' | 'escalate' | 'deciding';
+  reasoning: string;
+  guardrail?: 'max_replies_per_day' | 'walk_away_price' | 'never_disclose' | 'draft_check';
+  guardrailNote?: string;
+  reply?: string;
+  replyStatus?: 'pending' | 'sending' | 'sent' | 'rejected';
+  draftMessageId?: string;
+  error?: string;
+  createdAt: string;
+  reviewedAt?: string;
+  sentAt?: string;
+  sellerName?: string;
+}
+
+// Autopilot API
+export const autopilotAPI = {
+  getSettings: async (threadId: string): Promise<AutopilotSettings> => {
+    const response = await api.get<AutopilotSettings>(`/threads/${threadId}/autopilot`);
+    return response.data;
+  },
+
+  updateSettings: async (
+    threadId: string,
+    settings: Omit<AutopilotSettings, 'threadId'>
+  ): Promise<AutopilotSettings> => {
+    const response = await api.put<AutopilotSettings>(`/threads/${threadId}/autopilot`, settings);
+    return response.data;
+  },
+
+  getDecisions: async (threadId: string, limit?: number): Promise<AutopilotDecision[]> => {
+    const response = await api.get<{ decisions: AutopilotDecision[] }>(`/threads/${threadId}/autopilot/decisions`, {
+      params: limit ? { limit } : undefined,
+    });
+    return response.data.decisions;
+  },
+
+  getApprovalQueue: async (): Promise<AutopilotDecision[]> => {
+    const response = await api.get<{ decisions: AutopilotDecision[] }>('/autopilot/queue');
+    return response.data.decisions;
+  },
+
+  approveReply: async (decisionId: string, content?: string, acknowledgeWarnings = false): Promise<AutopilotDecision> => {
+    const response = await api.post<AutopilotDecision>(
+      `/autopilot/decisions/${decisionId}/approve`,
+      content || acknowledgeWarnings ? { content, acknowledgeWarnings } : undefined
+    );
+    return response.data;
+  },
+
+  rejectReply: async (decisionId: string): Promise<AutopilotDecision> => {
+    const response = await api.post<AutopilotDecision>(`/autopilot/decisions/${decisionId}/reject`);
+    return response.data;
+  },
+};
+
+// LLM usage
+export interface UsageTotals {
+  requests: number;
+  inputTokens: number;
+  outputTokens: number;
+  totalTokens: number;
+  estimatedCost: number; // Dollars, at list prices
+}
+
+export interface UsageBreakdown extends UsageTotals {
+  key: string; // Purpose or model
+}
+
+export interface UsageReport {
+  month: string; // YYYY-MM
+  totals: UsageTotals;
+  byPurpose: UsageBreakdown[];
+  byModel: UsageBreakdown[];
+  quota: number; // Monthly tokens; 0 means unlimited
+  remainingTokens?: number;
+}
+
+export const usageAPI = {
+  // month is YYYY-MM; defaults to the current month
+  getUsage: async (month?: string): Promise<UsageReport> => {
+    const response = await api.get<UsageReport>('/usage', {
+      params: month ? { month } : undefined,
+    });
+    return response.data;
+  },
+};
+
+// Master agent: one conversation across all of the user's seller threads
+export interface MasterConversation {
+  thread: Thread;
+  messages: Message[];
+  total: number;
+  hasMore: boolean;
+}
+
+export interface MasterReply {
+  userMessage: Message;
+  agentMessage?: Message;
+  drafts: Message[]; // Agent messages the master agent saved in seller threads for review
+  error?: string; // Why the agent didn't answer; the user's message is still saved
+}
+
+export const masterAPI = {
+  getConversation: async (limit = 50, offset = 0): Promise<MasterConversation> => {
+    const response = await api.get<MasterConversation>('/master', {
+      params: { limit, offset },
+    });
+    return response.data;
+  },
+
+  sendMessage: async (content: string): Promise<MasterReply> => {
+    const response = await api.post<MasterReply>('/master/messages', { content });
+    return response.data;
+  },
+};
+
+// Negotiation strategy profiles: built-in ones, and the user's own reused across threads
+export interface StrategyProfile {
+  id: string;
+  key?: string; // Built-in profiles only
+  builtin: boolean;
+  name: string;
+  description?: string;
+  promptFragment: string;
+  openingTemplate?: string; // Go template with the negotiation prompt variables, e.g. {{.SellerName}}
+  escalationRules?: string; // One rule per line
+  updatedAt: string;
+}
+
+export interface StrategyProfileRequest {
+  name: string;
+  description?: string;
+  promptFragment: string;
+  openingTemplate?: string;
+  escalationRules?: string;
+}
+
+export const strategyAPI = {
+  getAll: async (): Promise<StrategyProfile[]> => {
+    const response = await api.get<{ profiles: StrategyProfile[] }>('/strategies');
+    return response.data.profiles;
+  },
+
+  create: async (data: StrategyProfileRequest): Promise<StrategyProfile> => {
+    const response = await api.post<StrategyProfile>('/strategies', data);
+    return response.data;
+  },
+
+  update: async (profileId: string, data: StrategyProfileRequest): Promise<StrategyProfile> => {
+    const response = await api.put<StrategyProfile>(`/strategies/${profileId}`, data);
+    return response.data;
+  },
+
+  delete: async (profileId: string): Promise<void> => {
+    await api.delete(`/strategies/${profileId}`);
+  },
+};